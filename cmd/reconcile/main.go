@@ -0,0 +1,135 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"text/tabwriter"
+
+	"github.com/linemk/avito-shop/internal/app"
+	"github.com/linemk/avito-shop/internal/config"
+	"github.com/linemk/avito-shop/internal/service"
+	"github.com/linemk/avito-shop/internal/storage"
+)
+
+// Коды выхода
+const (
+	exitOK       = 0
+	exitMismatch = 1
+	exitError    = 2
+)
+
+func main() {
+	var (
+		format string
+		fix    bool
+		reason string
+	)
+	flag.StringVar(&format, "format", "text", "report format: text or json")
+	flag.BoolVar(&fix, "fix", false, "write correcting ledger entries for balance mismatches")
+	flag.StringVar(&reason, "reason", "", "audit reason for correcting entries (required with -fix)")
+
+	// MustLoad разбирает флаги, поэтому собственные флаги объявляются до него
+	cfg := config.MustLoad()
+
+	if format != "text" && format != "json" {
+		fmt.Fprintf(os.Stderr, "unknown format %q\n", format)
+		os.Exit(exitError)
+	}
+	if fix && reason == "" {
+		fmt.Fprintln(os.Stderr, "-reason is required with -fix")
+		os.Exit(exitError)
+	}
+
+	// отчёт пишется в stdout, поэтому логи уходят в stderr
+	log := slog.New(slog.NewTextHandler(os.Stderr, nil))
+
+	application, err := app.NewApp(log, cfg)
+	if err != nil {
+		log.Error("failed to initialize app", slog.Any("error", err))
+		os.Exit(exitError)
+	}
+	defer application.DB.Close()
+
+	txManager := storage.NewTxManager(application.DB, storage.RetryPolicy{
+		MaxRetries:  cfg.Database.TxMaxRetries,
+		BaseBackoff: cfg.Database.TxRetryBackoff,
+		MaxBackoff:  cfg.Database.TxMaxBackoff,
+	})
+	reconcileService := service.NewReconcileService(
+		log,
+		txManager,
+		storage.NewUserRepository(application.DB),
+		storage.NewLedgerRepository(application.DB),
+		storage.NewReconcileRepository(application.DB),
+	)
+
+	ctx := context.Background()
+	report, err := reconcileService.Reconcile(ctx)
+	if err != nil {
+		log.Error("reconciliation failed", slog.Any("error", err))
+		os.Exit(exitError)
+	}
+
+	if fix {
+		if err := reconcileService.Fix(ctx, report, reason); err != nil {
+			log.Error("fix failed", slog.Any("error", err))
+			_ = writeReport(os.Stdout, format, report)
+			os.Exit(exitError)
+		}
+	}
+
+	if err := writeReport(os.Stdout, format, report); err != nil {
+		log.Error("failed to write report", slog.Any("error", err))
+		os.Exit(exitError)
+	}
+
+	if report.HasMismatches() {
+		os.Exit(exitMismatch)
+	}
+	os.Exit(exitOK)
+}
+
+func writeReport(w io.Writer, format string, report *service.ReconcileReport) error {
+	if format == "json" {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+	return writeTextReport(w, report)
+}
+
+// writeTextReport печатает отчёт в виде таблиц
+func writeTextReport(w io.Writer, report *service.ReconcileReport) error {
+	fmt.Fprintf(w, "checked users: %d at %s\n", report.CheckedUsers, report.CheckedAt.Format("2006-01-02 15:04:05 MST"))
+
+	if len(report.Users) == 0 {
+		fmt.Fprintln(w, "balances: OK")
+	} else {
+		fmt.Fprintf(w, "\nbalance mismatches: %d\n", len(report.Users))
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "USER ID\tEMAIL\tBALANCE\tEXPECTED\tDIFF\tLEDGER\tFIXED")
+		for _, u := range report.Users {
+			fmt.Fprintf(tw, "%d\t%s\t%d\t%d\t%+d\t%d\t%t\n", u.UserID, u.Email, u.CoinBalance, u.Expected, u.Difference, u.LedgerBalance, u.Fixed)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(report.Orders) == 0 {
+		fmt.Fprintln(w, "order prices: OK")
+		return nil
+	}
+	fmt.Fprintf(w, "\norder price mismatches: %d\n", len(report.Orders))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ORDER ID\tUSER ID\tITEM\tQTY\tTOTAL\tEXPECTED")
+	for _, o := range report.Orders {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%d\t%d\t%d\n", o.OrderID, o.UserID, o.Item, o.Quantity, o.TotalPrice, o.ExpectedPrice)
+	}
+	return tw.Flush()
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 
 	"log/slog"
 	"net/http"
@@ -15,9 +16,14 @@ import (
 	"github.com/linemk/avito-shop/internal/app"
 	"github.com/linemk/avito-shop/internal/app/handlers"
 	"github.com/linemk/avito-shop/internal/config"
+	security "github.com/linemk/avito-shop/internal/jwtNew"
 	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
+	"github.com/linemk/avito-shop/internal/lib/identity"
 	"github.com/linemk/avito-shop/internal/lib/logger"
 	"github.com/linemk/avito-shop/internal/lib/logger/handlers/urllog"
+	"github.com/linemk/avito-shop/internal/lib/mailer"
+	"github.com/linemk/avito-shop/internal/lib/notifier"
+	"github.com/linemk/avito-shop/internal/lib/password"
 	"github.com/linemk/avito-shop/internal/service"
 	"github.com/linemk/avito-shop/internal/storage"
 	"github.com/pkg/errors"
@@ -43,34 +49,116 @@ func main() {
 	router := chi.NewRouter()
 	// настройка middleware
 	router.Use(middleware.RequestID)
+	if cfg.HTTPServer.TrustProxyHeaders {
+		// IP клиента нужен для ограничения попыток входа; за прокси он приходит в заголовках
+		router.Use(middleware.RealIP)
+	}
 	router.Use(urllog.CustomLoggerMiddleware(log))
 	router.Use(middleware.Recoverer)
 	router.Use(middleware.URLFormat)
 
 	// реализация объектов приложения
+	txManager := storage.NewTxManager(application.DB, storage.RetryPolicy{
+		MaxRetries:  cfg.Database.TxMaxRetries,
+		BaseBackoff: cfg.Database.TxRetryBackoff,
+		MaxBackoff:  cfg.Database.TxMaxBackoff,
+	})
 	userRepo := storage.NewUserRepository(application.DB)
 	merchRepo := storage.NewMerchRepository(application.DB)
 	orderRepo := storage.NewOrderRepository(application.DB)
 	coinTxRepo := storage.NewCoinTransactionRepository(application.DB)
+	idemRepo := storage.NewIdempotencyRepository(application.DB)
+	ledgerRepo := storage.NewLedgerRepository(application.DB)
+	tokenRepo := storage.NewOneTimeTokenRepository(application.DB)
+	refreshRepo := storage.NewRefreshTokenRepository(application.DB)
+	roleRepo := storage.NewRoleRepository(application.DB)
+	twoFactorRepo := storage.NewTwoFactorRepository(application.DB)
+	personalTokenRepo := storage.NewPersonalTokenRepository(application.DB)
+	identityRepo := storage.NewIdentityRepository(application.DB)
+	sessionRepo := storage.NewSessionRepository(application.DB)
+	cartRepo := storage.NewCartRepository(application.DB)
+	attemptRepo, err := storage.NewLoginAttemptStorage(cfg.Auth.BruteForce.Store, application.DB)
+	if err != nil {
+		log.Error("failed to initialize login attempt store", slog.Any("error", err))
+		os.Exit(1)
+	}
 
-	authService := service.NewAuthService(application.Logger, userRepo, time.Duration(application.Config.JWT.TokenTTL)*time.Minute)
-	buyService := service.NewBuyService(application.Logger, application.DB, userRepo, merchRepo, orderRepo)
-	sendCoinService := service.NewSendCoinService(application.Logger, application.DB, userRepo, coinTxRepo)
-	infoService := service.NewInfoService(application.Logger, userRepo, orderRepo, coinTxRepo) // Предполагается, что NewInfoService реализован
+	mail, err := mailer.New(application.Logger, cfg.Mailer)
+	if err != nil {
+		log.Error("failed to initialize mailer", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	// хэширование паролей: алгоритм и параметры из конфига, старые хэши пересчитываются при входе
+	hasher, err := password.New(cfg.Auth.Password)
+	if err != nil {
+		log.Error("failed to initialize password hasher", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	// ключи подписи JWT: RS256/EdDSA из PEM-файлов или HS256 с JWT_SECRET
+	keys, err := security.LoadKeySet(cfg.JWT)
+	if err != nil {
+		log.Error("failed to load jwt keys", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	// провайдеры учётных записей: локальные пароли, LDAP и OIDC в порядке из конфига
+	identityProviders, err := newIdentityProviders(application.Logger, cfg.Auth.Identity, userRepo, hasher)
+	if err != nil {
+		log.Error("failed to initialize identity providers", slog.Any("error", err))
+		os.Exit(1)
+	}
 
-	// эндпоинт для аутентификации
-	router.Post("/api/auth", handlers.AuthHandler(application.Logger, authService))
-
-	router.Group(func(r chi.Router) {
-		jwtMW := jwtmiddleware.NewJWTMiddleware()
-		r.Use(jwtMW)
-		// эндпоинт для инфо
-		r.Get("/api/info", handlers.InfoHandler(application.Logger, infoService))
-		// эндпоинт для отправки монет другому пользователю
-		r.Post("/api/sendCoin", handlers.SendCoinHandler(application.Logger, sendCoinService))
-		// эндпоинт для покупки мерча (параметр в path — название товара)
-		r.Get("/api/buy/{item}", handlers.BuyHandler(application.Logger, buyService))
+	// получатель оповещений менеджерам мерча: лог или вебхук из конфига
+	stockNotifier, err := notifier.New(application.Logger, cfg.Notifier)
+	if err != nil {
+		log.Error("failed to initialize notifier", slog.Any("error", err))
+		os.Exit(1)
+	}
+
+	authService := service.NewAuthService(application.Logger, txManager, userRepo, ledgerRepo, tokenRepo, refreshRepo, attemptRepo, twoFactorRepo, identityRepo, sessionRepo, mail, hasher, keys, service.AuthOptions{
+		TokenTTL:         time.Duration(application.Config.JWT.TokenTTL) * time.Minute,
+		RefreshTokenTTL:  cfg.JWT.RefreshTokenTTL,
+		AutoRegister:     cfg.Auth.AutoRegister,
+		VerificationTTL:  cfg.Auth.VerificationTTL,
+		PasswordResetTTL: cfg.Auth.PasswordResetTTL,
+		Throttle: service.LoginThrottleOptions{
+			Account:         service.ThrottlePolicy{FreeAttempts: cfg.Auth.BruteForce.AccountFreeAttempts, MaxFailures: cfg.Auth.BruteForce.AccountMaxFailures},
+			IP:              service.ThrottlePolicy{FreeAttempts: cfg.Auth.BruteForce.IPFreeAttempts, MaxFailures: cfg.Auth.BruteForce.IPMaxFailures},
+			Window:          cfg.Auth.BruteForce.Window,
+			BaseDelay:       cfg.Auth.BruteForce.BaseDelay,
+			MaxDelay:        cfg.Auth.BruteForce.MaxDelay,
+			LockoutDuration: cfg.Auth.BruteForce.LockoutDuration,
+		},
+		TwoFactor: service.TwoFactorOptions{
+			Issuer:       cfg.Auth.TwoFactor.Issuer,
+			ChallengeTTL: cfg.Auth.TwoFactor.ChallengeTTL,
+			Skew:         cfg.Auth.TwoFactor.Skew,
+		},
+		Identity: identityProviders,
 	})
+	merchService := service.NewMerchService(application.Logger, txManager, merchRepo, service.MerchOptions{CatalogCacheTTL: cfg.Merch.CatalogCacheTTL})
+	buyService := service.NewBuyService(application.Logger, txManager, userRepo, merchRepo, orderRepo, coinTxRepo, ledgerRepo, idemRepo, cartRepo, merchService, service.StockAlertOptions{
+		Notifier:          stockNotifier,
+		LowStockThreshold: cfg.Merch.LowStockThreshold,
+	})
+	cartService := service.NewCartService(application.Logger, txManager, cartRepo, merchService)
+	sendCoinService := service.NewSendCoinService(application.Logger, txManager, userRepo, coinTxRepo, ledgerRepo, idemRepo)
+	roleService := service.NewRoleService(application.Logger, txManager, userRepo, roleRepo, refreshRepo)
+	personalTokenService := service.NewPersonalTokenService(application.Logger, userRepo, personalTokenRepo)
+	infoService := service.NewInfoService(application.Logger, userRepo, orderRepo, coinTxRepo) // Предполагается, что NewInfoService реализован
+
+	// маршруты API генерируются из internal/schema/schema.yaml; JWT проверяется для операций с BearerAuth,
+	// отозванные токены и токены завершённых сессий отклоняются по данным AuthService. Операции /api/admin/... доступны ролям,
+	// перечисленным в scopes BearerAuth. Персональные токены (pat_...) принимаются только операциями
+	// со схемой PersonalTokenAuth и только с правами из её scopes
+	apiServer := handlers.NewServer(application.Logger, authService, infoService, sendCoinService, buyService, merchService, cartService, roleService, authService, personalTokenService, authService, keys)
+	authMiddleware := jwtmiddleware.WithPersonalTokens(jwtmiddleware.NewJWTMiddleware(keys, authService), personalTokenService)
+	if err := handlers.RegisterRoutes(router, application.Logger, apiServer, authMiddleware); err != nil {
+		log.Error("failed to register routes", slog.Any("error", err))
+		os.Exit(1)
+	}
 
 	srv := &http.Server{
 		Addr:         cfg.HTTPServer.Address,
@@ -101,3 +189,42 @@ func main() {
 	}
 	log.Info("server gracefully stopped")
 }
+
+// newIdentityProviders создаёт провайдеры учётных записей, перечисленные в конфиге.
+// local и ldap проверяют пароль в указанном порядке, oidc включает вход через перенаправление.
+func newIdentityProviders(log *slog.Logger, cfg config.IdentityConfig, userRepo storage.UserStorage, hasher password.Hasher) (service.IdentityProviders, error) {
+	var providers service.IdentityProviders
+	seen := make(map[string]bool)
+	for _, name := range cfg.Providers {
+		if seen[name] {
+			return providers, fmt.Errorf("identity provider %q is listed twice", name)
+		}
+		seen[name] = true
+
+		switch name {
+		case identity.ProviderLocal:
+			providers.Password = append(providers.Password, service.NewLocalIdentityProvider(log, userRepo, hasher))
+		case identity.ProviderLDAP:
+			ldapProvider, err := identity.NewLDAPProvider(cfg.LDAP)
+			if err != nil {
+				return providers, err
+			}
+			providers.Password = append(providers.Password, ldapProvider)
+		case identity.ProviderOIDC:
+			// настройки провайдера загружаются один раз при запуске
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			oidcProvider, err := identity.NewOIDCProvider(ctx, cfg.OIDC)
+			cancel()
+			if err != nil {
+				return providers, err
+			}
+			providers.Redirect = oidcProvider
+		default:
+			return providers, fmt.Errorf("unknown identity provider %q", name)
+		}
+	}
+	if len(providers.Password) == 0 && providers.Redirect == nil {
+		return providers, errors.New("at least one identity provider must be enabled")
+	}
+	return providers, nil
+}
@@ -0,0 +1,2818 @@
+// Package api provides primitives to interact with the openapi HTTP API.
+//
+// Code generated by github.com/oapi-codegen/oapi-codegen/v2 version (devel) DO NOT EDIT.
+package api
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/go-chi/chi/v5"
+	"github.com/oapi-codegen/runtime"
+	openapi_types "github.com/oapi-codegen/runtime/types"
+)
+
+const (
+	BearerAuthScopes        = "BearerAuth.Scopes"
+	PersonalTokenAuthScopes = "PersonalTokenAuth.Scopes"
+)
+
+// Defines values for CoinOperationType.
+const (
+	CoinOperationTypePurchase         CoinOperationType = "purchase"
+	CoinOperationTypeTransferReceived CoinOperationType = "transfer_received"
+	CoinOperationTypeTransferSent     CoinOperationType = "transfer_sent"
+)
+
+// Defines values for ErrorResponseCode.
+const (
+	ErrorResponseCodeCartEmpty                ErrorResponseCode = "cart_empty"
+	ErrorResponseCodeCartItemNotFound         ErrorResponseCode = "cart_item_not_found"
+	ErrorResponseCodeCheckoutFailed           ErrorResponseCode = "checkout_failed"
+	ErrorResponseCodeEmailNotVerified         ErrorResponseCode = "email_not_verified"
+	ErrorResponseCodeForbidden                ErrorResponseCode = "forbidden"
+	ErrorResponseCodeIdempotencyKeyReused     ErrorResponseCode = "idempotency_key_reused"
+	ErrorResponseCodeIdentityProviderDisabled ErrorResponseCode = "identity_provider_disabled"
+	ErrorResponseCodeInsufficientFunds        ErrorResponseCode = "insufficient_funds"
+	ErrorResponseCodeInternalError            ErrorResponseCode = "internal_error"
+	ErrorResponseCodeInvalidAmount            ErrorResponseCode = "invalid_amount"
+	ErrorResponseCodeInvalidChallengeToken    ErrorResponseCode = "invalid_challenge_token"
+	ErrorResponseCodeInvalidCredentials       ErrorResponseCode = "invalid_credentials"
+	ErrorResponseCodeInvalidCursor            ErrorResponseCode = "invalid_cursor"
+	ErrorResponseCodeInvalidMerchFilter       ErrorResponseCode = "invalid_merch_filter"
+	ErrorResponseCodeInvalidOidcState         ErrorResponseCode = "invalid_oidc_state"
+	ErrorResponseCodeInvalidPrice             ErrorResponseCode = "invalid_price"
+	ErrorResponseCodeInvalidQuantity          ErrorResponseCode = "invalid_quantity"
+	ErrorResponseCodeInvalidRefreshToken      ErrorResponseCode = "invalid_refresh_token"
+	ErrorResponseCodeInvalidRequest           ErrorResponseCode = "invalid_request"
+	ErrorResponseCodeInvalidResetToken        ErrorResponseCode = "invalid_reset_token"
+	ErrorResponseCodeInvalidRole              ErrorResponseCode = "invalid_role"
+	ErrorResponseCodeInvalidScope             ErrorResponseCode = "invalid_scope"
+	ErrorResponseCodeInvalidStock             ErrorResponseCode = "invalid_stock"
+	ErrorResponseCodeInvalidTokenExpiry       ErrorResponseCode = "invalid_token_expiry"
+	ErrorResponseCodeInvalidTwoFactorCode     ErrorResponseCode = "invalid_two_factor_code"
+	ErrorResponseCodeInvalidVerificationToken ErrorResponseCode = "invalid_verification_token"
+	ErrorResponseCodeMerchAlreadyExists       ErrorResponseCode = "merch_already_exists"
+	ErrorResponseCodeMerchNotFound            ErrorResponseCode = "merch_not_found"
+	ErrorResponseCodeOutOfStock               ErrorResponseCode = "out_of_stock"
+	ErrorResponseCodePersonalTokenNotFound    ErrorResponseCode = "personal_token_not_found"
+	ErrorResponseCodeReceiverNotFound         ErrorResponseCode = "receiver_not_found"
+	ErrorResponseCodeSelfRoleChange           ErrorResponseCode = "self_role_change"
+	ErrorResponseCodeSelfTransfer             ErrorResponseCode = "self_transfer"
+	ErrorResponseCodeSessionNotFound          ErrorResponseCode = "session_not_found"
+	ErrorResponseCodeTooManyAttempts          ErrorResponseCode = "too_many_attempts"
+	ErrorResponseCodeTwoFactorAlreadyEnabled  ErrorResponseCode = "two_factor_already_enabled"
+	ErrorResponseCodeTwoFactorNotEnabled      ErrorResponseCode = "two_factor_not_enabled"
+	ErrorResponseCodeTwoFactorRequired        ErrorResponseCode = "two_factor_required"
+	ErrorResponseCodeUnauthorized             ErrorResponseCode = "unauthorized"
+	ErrorResponseCodeUserAlreadyExists        ErrorResponseCode = "user_already_exists"
+	ErrorResponseCodeUserNotFound             ErrorResponseCode = "user_not_found"
+	ErrorResponseCodeValidationError          ErrorResponseCode = "validation_error"
+	ErrorResponseCodeWrongPassword            ErrorResponseCode = "wrong_password"
+)
+
+// Defines values for JWKAlg.
+const (
+	JWKAlgEdDSA JWKAlg = "EdDSA"
+	JWKAlgRS256 JWKAlg = "RS256"
+)
+
+// Defines values for JWKKty.
+const (
+	JWKKtyOKP JWKKty = "OKP"
+	JWKKtyRSA JWKKty = "RSA"
+)
+
+// Defines values for JWKUse.
+const (
+	JWKUseSig JWKUse = "sig"
+)
+
+// Defines values for PersonalTokenScope.
+const (
+	PersonalTokenScopeCoinsSend PersonalTokenScope = "coins:send"
+	PersonalTokenScopeInfoRead  PersonalTokenScope = "info:read"
+	PersonalTokenScopeMerchBuy  PersonalTokenScope = "merch:buy"
+)
+
+// Defines values for Role.
+const (
+	RoleAdmin        Role = "admin"
+	RoleEmployee     Role = "employee"
+	RoleFinance      Role = "finance"
+	RoleMerchManager Role = "merch-manager"
+)
+
+// Defines values for GetApiMerchParamsSort.
+const (
+	GetApiMerchParamsSortMinusName  GetApiMerchParamsSort = "-name"
+	GetApiMerchParamsSortMinusPrice GetApiMerchParamsSort = "-price"
+	GetApiMerchParamsSortName       GetApiMerchParamsSort = "name"
+	GetApiMerchParamsSortPrice      GetApiMerchParamsSort = "price"
+)
+
+// AddCartItemRequest defines model for AddCartItemRequest.
+type AddCartItemRequest struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+}
+
+// AdminMerchItem defines model for AdminMerchItem.
+type AdminMerchItem struct {
+	Archived bool `json:"archived"`
+
+	// ArchivedAt Время архивации; отсутствует у товара в каталоге.
+	ArchivedAt  *time.Time `json:"archivedAt,omitempty"`
+	Category    string     `json:"category"`
+	Description string     `json:"description"`
+	Name        string     `json:"name"`
+	Price       int        `json:"price"`
+
+	// Stock Остаток на складе; отсутствует, если остаток не учитывается.
+	Stock *int `json:"stock,omitempty"`
+}
+
+// AuthRequest defines model for AuthRequest.
+type AuthRequest struct {
+	// Device Метка устройства для refresh-токена. По умолчанию — User-Agent.
+	Device string `json:"device,omitempty"`
+
+	// Password Пароль для аутентификации.
+	Password string `json:"password"`
+
+	// Username Имя пользователя для аутентификации.
+	Username openapi_types.Email `json:"username"`
+}
+
+// AuthResponse defines model for AuthResponse.
+type AuthResponse struct {
+	// RefreshToken Refresh-токен для получения новой пары токенов через /api/auth/refresh.
+	RefreshToken string `json:"refreshToken"`
+
+	// Token Короткоживущий JWT-токен для доступа к защищенным ресурсам.
+	Token string `json:"token"`
+}
+
+// BuyRequest defines model for BuyRequest.
+type BuyRequest struct {
+	// Item Название товара.
+	Item string `json:"item"`
+
+	// Quantity Количество единиц.
+	Quantity int `json:"quantity"`
+}
+
+// Cart defines model for Cart.
+type Cart struct {
+	Items      []CartItem `json:"items"`
+	TotalPrice int        `json:"totalPrice"`
+}
+
+// CartItem defines model for CartItem.
+type CartItem struct {
+	// Available Товар в каталоге и на складе хватает quantity единиц.
+	Available bool   `json:"available"`
+	Item      string `json:"item"`
+
+	// Price Текущая цена за единицу.
+	Price      int `json:"price"`
+	Quantity   int `json:"quantity"`
+	TotalPrice int `json:"totalPrice"`
+}
+
+// ChangePasswordRequest defines model for ChangePasswordRequest.
+type ChangePasswordRequest struct {
+	// CurrentPassword Текущий пароль.
+	CurrentPassword string `json:"currentPassword"`
+
+	// NewPassword Новый пароль.
+	NewPassword string `json:"newPassword"`
+}
+
+// ChangeRoleRequest defines model for ChangeRoleRequest.
+type ChangeRoleRequest struct {
+	// Reason Причина изменения для журнала.
+	Reason string `json:"reason,omitempty"`
+
+	// Role Роль пользователя.
+	Role Role `json:"role"`
+}
+
+// CheckoutErrorResponse defines model for CheckoutErrorResponse.
+type CheckoutErrorResponse struct {
+	// Code Всегда checkout_failed.
+	Code   string              `json:"code"`
+	Errors string              `json:"errors"`
+	Lines  []CheckoutLineError `json:"lines"`
+}
+
+// CheckoutLineError defines model for CheckoutLineError.
+type CheckoutLineError struct {
+	// Code Код ошибки строки, один из кодов ErrorResponse (merch_not_found, out_of_stock, invalid_quantity).
+	Code   string `json:"code"`
+	Errors string `json:"errors"`
+	Item   string `json:"item"`
+}
+
+// CheckoutOrder defines model for CheckoutOrder.
+type CheckoutOrder struct {
+	Id         int64  `json:"id"`
+	Item       string `json:"item"`
+	Quantity   int    `json:"quantity"`
+	TotalPrice int    `json:"totalPrice"`
+}
+
+// CheckoutResponse defines model for CheckoutResponse.
+type CheckoutResponse struct {
+	Orders []CheckoutOrder `json:"orders"`
+
+	// TotalPrice Сколько монет списано.
+	TotalPrice int `json:"totalPrice"`
+}
+
+// CoinHistory defines model for CoinHistory.
+type CoinHistory struct {
+	// Operations Переводы и покупки в хронологическом порядке.
+	Operations []CoinOperation `json:"operations"`
+	Received   []ReceivedCoins `json:"received"`
+	Sent       []SentCoins     `json:"sent"`
+}
+
+// CoinOperation defines model for CoinOperation.
+type CoinOperation struct {
+	// Amount Изменение баланса; отрицательное для списаний.
+	Amount int `json:"amount"`
+
+	// CreatedAt Время операции.
+	CreatedAt time.Time `json:"createdAt"`
+
+	// FromUser Отправитель (для полученных переводов).
+	FromUser string `json:"fromUser,omitempty"`
+
+	// Item Купленный товар (для покупок).
+	Item string `json:"item,omitempty"`
+
+	// OrderId Идентификатор заказа (для покупок).
+	OrderId int64 `json:"orderId,omitempty"`
+
+	// ToUser Получатель (для отправленных переводов).
+	ToUser string `json:"toUser,omitempty"`
+
+	// Type Тип операции.
+	Type CoinOperationType `json:"type"`
+}
+
+// CoinOperationType Тип операции.
+type CoinOperationType string
+
+// CreateMerchRequest defines model for CreateMerchRequest.
+type CreateMerchRequest struct {
+	Category    string `json:"category,omitempty"`
+	Description string `json:"description,omitempty"`
+
+	// Name Название; используется в адресах /api/buy и /api/merch.
+	Name  string `json:"name"`
+	Price int    `json:"price"`
+}
+
+// CreatePersonalTokenRequest defines model for CreatePersonalTokenRequest.
+type CreatePersonalTokenRequest struct {
+	// ExpiresAt Окончание срока действия. Без него токен бессрочный.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	// Name Название, по которому владелец узнает токен в списке.
+	Name   string               `json:"name"`
+	Scopes []PersonalTokenScope `json:"scopes"`
+}
+
+// CreatedPersonalToken defines model for CreatedPersonalToken.
+type CreatedPersonalToken struct {
+	PersonalToken PersonalToken `json:"personalToken"`
+
+	// Token Персональный токен; показывается один раз.
+	Token string `json:"token"`
+}
+
+// ErrorResponse defines model for ErrorResponse.
+type ErrorResponse struct {
+	// Code Машиночитаемый код ошибки.
+	Code ErrorResponseCode `json:"code"`
+
+	// Errors Сообщение об ошибке, описывающее проблему.
+	Errors string `json:"errors"`
+}
+
+// ErrorResponseCode Машиночитаемый код ошибки.
+type ErrorResponseCode string
+
+// ForgotPasswordRequest defines model for ForgotPasswordRequest.
+type ForgotPasswordRequest struct {
+	// Username Email пользователя.
+	Username openapi_types.Email `json:"username"`
+}
+
+// InfoResponse defines model for InfoResponse.
+type InfoResponse struct {
+	CoinHistory CoinHistory `json:"coinHistory"`
+
+	// Coins Количество доступных монет.
+	Coins     int             `json:"coins"`
+	Inventory []InventoryItem `json:"inventory"`
+}
+
+// InventoryItem defines model for InventoryItem.
+type InventoryItem struct {
+	// Quantity Количество предметов.
+	Quantity int `json:"quantity"`
+
+	// Type Тип предмета.
+	Type string `json:"type"`
+}
+
+// JWK defines model for JWK.
+type JWK struct {
+	Alg JWKAlg `json:"alg"`
+
+	// Crv OKP — кривая (Ed25519).
+	Crv string `json:"crv,omitempty"`
+
+	// E RSA — экспонента (base64url).
+	E string `json:"e,omitempty"`
+
+	// Kid Идентификатор ключа, совпадает с заголовком kid токена.
+	Kid string `json:"kid"`
+
+	// Kty Тип ключа.
+	Kty JWKKty `json:"kty"`
+
+	// N RSA — модуль (base64url).
+	N   string `json:"n,omitempty"`
+	Use JWKUse `json:"use"`
+
+	// X OKP — открытый ключ (base64url).
+	X string `json:"x,omitempty"`
+}
+
+// JWKAlg defines model for JWK.Alg.
+type JWKAlg string
+
+// JWKKty Тип ключа.
+type JWKKty string
+
+// JWKUse defines model for JWK.Use.
+type JWKUse string
+
+// JWKSet defines model for JWKSet.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// LogoutRequest defines model for LogoutRequest.
+type LogoutRequest struct {
+	// RefreshToken Refresh-токен этого устройства, который нужно отозвать.
+	RefreshToken string `json:"refreshToken,omitempty"`
+}
+
+// MerchItem defines model for MerchItem.
+type MerchItem struct {
+	// Available Можно ли купить товар сейчас. Каталог кэшируется, поэтому после покупки последней
+	// единицы товар может показываться доступным до истечения срока кэша; покупка в этом
+	// случае завершится ошибкой out_of_stock.
+	Available   bool   `json:"available"`
+	Category    string `json:"category"`
+	Description string `json:"description"`
+	Name        string `json:"name"`
+
+	// Price Цена в монетах.
+	Price int `json:"price"`
+}
+
+// MerchPage defines model for MerchPage.
+type MerchPage struct {
+	Items []MerchItem `json:"items"`
+
+	// NextCursor Курсор следующей страницы; отсутствует на последней.
+	NextCursor *string `json:"nextCursor,omitempty"`
+}
+
+// MerchPrice defines model for MerchPrice.
+type MerchPrice struct {
+	// ChangedBy Кто изменил цену; отсутствует у цен, заданных миграциями.
+	ChangedBy *int64 `json:"changedBy,omitempty"`
+	Price     int    `json:"price"`
+
+	// ValidFrom Начало действия цены; она действует до начала следующей записи.
+	ValidFrom time.Time `json:"validFrom"`
+}
+
+// MessageResponse defines model for MessageResponse.
+type MessageResponse struct {
+	// Message Сообщение об успешном выполнении.
+	Message string `json:"message"`
+}
+
+// PersonalToken defines model for PersonalToken.
+type PersonalToken struct {
+	CreatedAt time.Time `json:"createdAt"`
+
+	// ExpiresAt Окончание срока действия; отсутствует у бессрочного токена.
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Id        int64      `json:"id"`
+
+	// LastUsedAt Последнее использование с точностью до минуты.
+	LastUsedAt *time.Time           `json:"lastUsedAt,omitempty"`
+	Name       string               `json:"name"`
+	Scopes     []PersonalTokenScope `json:"scopes"`
+}
+
+// PersonalTokenScope Право персонального токена.
+type PersonalTokenScope string
+
+// ReceivedCoins defines model for ReceivedCoins.
+type ReceivedCoins struct {
+	// Amount Количество полученных монет.
+	Amount int `json:"amount"`
+
+	// FromUser Имя пользователя, который отправил монеты.
+	FromUser string `json:"fromUser,omitempty"`
+}
+
+// RecoveryCodesResponse defines model for RecoveryCodesResponse.
+type RecoveryCodesResponse struct {
+	// RecoveryCodes Одноразовые коды восстановления; показываются один раз.
+	RecoveryCodes []string `json:"recoveryCodes"`
+}
+
+// RefreshRequest defines model for RefreshRequest.
+type RefreshRequest struct {
+	// RefreshToken Refresh-токен, полученный при аутентификации или предыдущем обновлении.
+	RefreshToken string `json:"refreshToken"`
+}
+
+// ResetPasswordRequest defines model for ResetPasswordRequest.
+type ResetPasswordRequest struct {
+	// NewPassword Новый пароль.
+	NewPassword string `json:"newPassword"`
+
+	// Token Токен сброса пароля из письма.
+	Token string `json:"token"`
+}
+
+// RestockMerchRequest defines model for RestockMerchRequest.
+type RestockMerchRequest struct {
+	Quantity int `json:"quantity"`
+}
+
+// Role Роль пользователя.
+type Role string
+
+// RoleChange defines model for RoleChange.
+type RoleChange struct {
+	// ChangedBy Администратор, изменивший роль.
+	ChangedBy int64     `json:"changedBy"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	// NewRole Роль пользователя.
+	NewRole Role `json:"newRole"`
+
+	// OldRole Роль пользователя.
+	OldRole Role   `json:"oldRole"`
+	Reason  string `json:"reason,omitempty"`
+	UserId  int64  `json:"userId"`
+}
+
+// SendCoinRequest defines model for SendCoinRequest.
+type SendCoinRequest struct {
+	// Amount Количество монет, которые необходимо отправить.
+	Amount int `json:"amount"`
+
+	// ToUser Имя пользователя, которому нужно отправить монеты.
+	ToUser openapi_types.Email `json:"toUser"`
+}
+
+// SentCoins defines model for SentCoins.
+type SentCoins struct {
+	// Amount Количество отправленных монет.
+	Amount int `json:"amount"`
+
+	// ToUser Имя пользователя, которому отправлены монеты.
+	ToUser string `json:"toUser,omitempty"`
+}
+
+// Session defines model for Session.
+type Session struct {
+	CreatedAt time.Time `json:"createdAt"`
+
+	// Current Сессия, которой выполнен этот запрос.
+	Current   bool      `json:"current"`
+	ExpiresAt time.Time `json:"expiresAt"`
+	Id        int64     `json:"id"`
+
+	// Ip IP-адрес, с которого выполнен вход.
+	Ip string `json:"ip"`
+
+	// LastUsedAt Последнее использование с точностью до минуты.
+	LastUsedAt time.Time `json:"lastUsedAt"`
+
+	// UserAgent User-Agent клиента или имя устройства, переданное при входе.
+	UserAgent string `json:"userAgent"`
+}
+
+// SetMerchStockRequest defines model for SetMerchStockRequest.
+type SetMerchStockRequest struct {
+	// Stock Новый остаток; null выключает учёт остатка.
+	Stock *int `json:"stock"`
+}
+
+// TwoFactorChallengeRequest defines model for TwoFactorChallengeRequest.
+type TwoFactorChallengeRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+}
+
+// TwoFactorChallengeResponse defines model for TwoFactorChallengeResponse.
+type TwoFactorChallengeResponse struct {
+	// ChallengeToken Токен ожидания второго фактора.
+	ChallengeToken string    `json:"challengeToken"`
+	ExpiresAt      time.Time `json:"expiresAt"`
+
+	// SetupRequired Роль требует второй фактор, а он не подключён.
+	SetupRequired bool `json:"setupRequired"`
+}
+
+// TwoFactorCodeRequest defines model for TwoFactorCodeRequest.
+type TwoFactorCodeRequest struct {
+	// Code Шестизначный код TOTP или код восстановления.
+	Code string `json:"code"`
+}
+
+// TwoFactorEnrollment defines model for TwoFactorEnrollment.
+type TwoFactorEnrollment struct {
+	// ProvisioningUri URI otpauth:// для QR-кода.
+	ProvisioningUri string `json:"provisioningUri"`
+
+	// Secret Секрет в base32 для ручного ввода в приложение.
+	Secret string `json:"secret"`
+}
+
+// TwoFactorLoginRequest defines model for TwoFactorLoginRequest.
+type TwoFactorLoginRequest struct {
+	ChallengeToken string `json:"challengeToken"`
+
+	// Code Шестизначный код TOTP или код восстановления.
+	Code string `json:"code"`
+
+	// Device Метка устройства для refresh-токена. По умолчанию — User-Agent.
+	Device string `json:"device,omitempty"`
+}
+
+// TwoFactorPolicy defines model for TwoFactorPolicy.
+type TwoFactorPolicy struct {
+	// Roles Роли с обязательным вторым фактором.
+	Roles []Role `json:"roles"`
+}
+
+// TwoFactorRequirementRequest defines model for TwoFactorRequirementRequest.
+type TwoFactorRequirementRequest struct {
+	Required bool `json:"required"`
+}
+
+// TwoFactorSetupResponse defines model for TwoFactorSetupResponse.
+type TwoFactorSetupResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+	RefreshToken  string   `json:"refreshToken"`
+	Token         string   `json:"token"`
+}
+
+// UpdateMerchPriceRequest defines model for UpdateMerchPriceRequest.
+type UpdateMerchPriceRequest struct {
+	Price int `json:"price"`
+}
+
+// VerifyEmailRequest defines model for VerifyEmailRequest.
+type VerifyEmailRequest struct {
+	// Token Токен подтверждения из письма.
+	Token string `json:"token"`
+}
+
+// IdempotencyKey defines model for IdempotencyKey.
+type IdempotencyKey = string
+
+// MerchName defines model for MerchName.
+type MerchName = string
+
+// UserId defines model for UserId.
+type UserId = int64
+
+// GetApiAuthOidcCallbackParams defines parameters for GetApiAuthOidcCallback.
+type GetApiAuthOidcCallbackParams struct {
+	// Code Код авторизации от провайдера.
+	Code string `form:"code" json:"code"`
+
+	// State state из /api/auth/oidc/login; должен совпасть со значением cookie oidc_state.
+	State string `form:"state" json:"state"`
+}
+
+// PostApiBuyParams defines parameters for PostApiBuy.
+type PostApiBuyParams struct {
+	// IdempotencyKey Ключ идемпотентности. Повтор запроса с тем же ключом и телом возвращает сохранённый ответ без повторного списания монет.
+	IdempotencyKey *IdempotencyKey `json:"Idempotency-Key,omitempty"`
+}
+
+// GetApiBuyItemParams defines parameters for GetApiBuyItem.
+type GetApiBuyItemParams struct {
+	// IdempotencyKey Ключ идемпотентности. Повтор запроса с тем же ключом и телом возвращает сохранённый ответ без повторного списания монет.
+	IdempotencyKey *IdempotencyKey `json:"Idempotency-Key,omitempty"`
+}
+
+// GetApiMerchParams defines parameters for GetApiMerch.
+type GetApiMerchParams struct {
+	// Category Только товары категории.
+	Category *string `form:"category,omitempty" json:"category,omitempty"`
+
+	// MinPrice Наименьшая цена включительно.
+	MinPrice *int `form:"minPrice,omitempty" json:"minPrice,omitempty"`
+
+	// MaxPrice Наибольшая цена включительно.
+	MaxPrice *int `form:"maxPrice,omitempty" json:"maxPrice,omitempty"`
+
+	// Sort Порядок товаров; «-» — по убыванию. При равной цене товары идут по названию.
+	Sort *GetApiMerchParamsSort `form:"sort,omitempty" json:"sort,omitempty"`
+
+	// Cursor nextCursor предыдущей страницы.
+	Cursor *string `form:"cursor,omitempty" json:"cursor,omitempty"`
+
+	// Limit Размер страницы.
+	Limit *int `form:"limit,omitempty" json:"limit,omitempty"`
+}
+
+// GetApiMerchParamsSort defines parameters for GetApiMerch.
+type GetApiMerchParamsSort string
+
+// PostApiSendCoinParams defines parameters for PostApiSendCoin.
+type PostApiSendCoinParams struct {
+	// IdempotencyKey Ключ идемпотентности. Повтор запроса с тем же ключом и телом возвращает сохранённый ответ без повторного списания монет.
+	IdempotencyKey *IdempotencyKey `json:"Idempotency-Key,omitempty"`
+}
+
+// PostApiAdminMerchJSONRequestBody defines body for PostApiAdminMerch for application/json ContentType.
+type PostApiAdminMerchJSONRequestBody = CreateMerchRequest
+
+// PutApiAdminMerchNamePriceJSONRequestBody defines body for PutApiAdminMerchNamePrice for application/json ContentType.
+type PutApiAdminMerchNamePriceJSONRequestBody = UpdateMerchPriceRequest
+
+// PostApiAdminMerchNameRestockJSONRequestBody defines body for PostApiAdminMerchNameRestock for application/json ContentType.
+type PostApiAdminMerchNameRestockJSONRequestBody = RestockMerchRequest
+
+// PutApiAdminMerchNameStockJSONRequestBody defines body for PutApiAdminMerchNameStock for application/json ContentType.
+type PutApiAdminMerchNameStockJSONRequestBody = SetMerchStockRequest
+
+// PutApiAdminTwoFactorRolesRoleJSONRequestBody defines body for PutApiAdminTwoFactorRolesRole for application/json ContentType.
+type PutApiAdminTwoFactorRolesRoleJSONRequestBody = TwoFactorRequirementRequest
+
+// PutApiAdminUsersUserIdRoleJSONRequestBody defines body for PutApiAdminUsersUserIdRole for application/json ContentType.
+type PutApiAdminUsersUserIdRoleJSONRequestBody = ChangeRoleRequest
+
+// PostApiAuthJSONRequestBody defines body for PostApiAuth for application/json ContentType.
+type PostApiAuthJSONRequestBody = AuthRequest
+
+// PostApiAuthLogoutJSONRequestBody defines body for PostApiAuthLogout for application/json ContentType.
+type PostApiAuthLogoutJSONRequestBody = LogoutRequest
+
+// PostApiAuthRefreshJSONRequestBody defines body for PostApiAuthRefresh for application/json ContentType.
+type PostApiAuthRefreshJSONRequestBody = RefreshRequest
+
+// PostApiAuthTwoFactorJSONRequestBody defines body for PostApiAuthTwoFactor for application/json ContentType.
+type PostApiAuthTwoFactorJSONRequestBody = TwoFactorLoginRequest
+
+// PostApiAuthTwoFactorSetupJSONRequestBody defines body for PostApiAuthTwoFactorSetup for application/json ContentType.
+type PostApiAuthTwoFactorSetupJSONRequestBody = TwoFactorChallengeRequest
+
+// PostApiAuthTwoFactorSetupConfirmJSONRequestBody defines body for PostApiAuthTwoFactorSetupConfirm for application/json ContentType.
+type PostApiAuthTwoFactorSetupConfirmJSONRequestBody = TwoFactorLoginRequest
+
+// PostApiBuyJSONRequestBody defines body for PostApiBuy for application/json ContentType.
+type PostApiBuyJSONRequestBody = BuyRequest
+
+// PostApiCartItemsJSONRequestBody defines body for PostApiCartItems for application/json ContentType.
+type PostApiCartItemsJSONRequestBody = AddCartItemRequest
+
+// PostApiPasswordJSONRequestBody defines body for PostApiPassword for application/json ContentType.
+type PostApiPasswordJSONRequestBody = ChangePasswordRequest
+
+// PostApiPasswordForgotJSONRequestBody defines body for PostApiPasswordForgot for application/json ContentType.
+type PostApiPasswordForgotJSONRequestBody = ForgotPasswordRequest
+
+// PostApiPasswordResetJSONRequestBody defines body for PostApiPasswordReset for application/json ContentType.
+type PostApiPasswordResetJSONRequestBody = ResetPasswordRequest
+
+// PostApiRegisterJSONRequestBody defines body for PostApiRegister for application/json ContentType.
+type PostApiRegisterJSONRequestBody = AuthRequest
+
+// PostApiSendCoinJSONRequestBody defines body for PostApiSendCoin for application/json ContentType.
+type PostApiSendCoinJSONRequestBody = SendCoinRequest
+
+// PostApiTokensJSONRequestBody defines body for PostApiTokens for application/json ContentType.
+type PostApiTokensJSONRequestBody = CreatePersonalTokenRequest
+
+// PostApiTwoFactorConfirmJSONRequestBody defines body for PostApiTwoFactorConfirm for application/json ContentType.
+type PostApiTwoFactorConfirmJSONRequestBody = TwoFactorCodeRequest
+
+// PostApiTwoFactorDisableJSONRequestBody defines body for PostApiTwoFactorDisable for application/json ContentType.
+type PostApiTwoFactorDisableJSONRequestBody = TwoFactorCodeRequest
+
+// PostApiVerifyEmailJSONRequestBody defines body for PostApiVerifyEmail for application/json ContentType.
+type PostApiVerifyEmailJSONRequestBody = VerifyEmailRequest
+
+// ServerInterface represents all server handlers.
+type ServerInterface interface {
+	// Открытые ключи для проверки подписи токенов (JWKS, RFC 7517). Ключи HS256 не публикуются.
+	// (GET /.well-known/jwks.json)
+	GetWellKnownJwksJson(w http.ResponseWriter, r *http.Request)
+	// Все товары, включая архивные. Доступно менеджерам мерча и администраторам.
+	// (GET /api/admin/merch)
+	GetApiAdminMerch(w http.ResponseWriter, r *http.Request)
+	// Добавить товар в каталог. Цена записывается в историю цен.
+	// (POST /api/admin/merch)
+	PostApiAdminMerch(w http.ResponseWriter, r *http.Request)
+	// Убрать товар из каталога.
+	// (POST /api/admin/merch/{name}/archive)
+	PostApiAdminMerchNameArchive(w http.ResponseWriter, r *http.Request, name MerchName)
+	// Изменить цену товара.
+	// (PUT /api/admin/merch/{name}/price)
+	PutApiAdminMerchNamePrice(w http.ResponseWriter, r *http.Request, name MerchName)
+	// История цен товара, новые записи первыми.
+	// (GET /api/admin/merch/{name}/prices)
+	GetApiAdminMerchNamePrices(w http.ResponseWriter, r *http.Request, name MerchName)
+	// Пополнить склад.
+	// (POST /api/admin/merch/{name}/restock)
+	PostApiAdminMerchNameRestock(w http.ResponseWriter, r *http.Request, name MerchName)
+	// Вернуть архивный товар в каталог.
+	// (POST /api/admin/merch/{name}/restore)
+	PostApiAdminMerchNameRestore(w http.ResponseWriter, r *http.Request, name MerchName)
+	// Задать остаток товара.
+	// (PUT /api/admin/merch/{name}/stock)
+	PutApiAdminMerchNameStock(w http.ResponseWriter, r *http.Request, name MerchName)
+	// Роли, для которых второй фактор обязателен.
+	// (GET /api/admin/twoFactor/roles)
+	GetApiAdminTwoFactorRoles(w http.ResponseWriter, r *http.Request)
+	// Сделать второй фактор обязательным для роли или отменить требование.
+	// (PUT /api/admin/twoFactor/roles/{role})
+	PutApiAdminTwoFactorRolesRole(w http.ResponseWriter, r *http.Request, role Role)
+	// Изменить роль пользователя. Доступно только администраторам; изменение записывается в журнал.
+	// (PUT /api/admin/users/{userId}/role)
+	PutApiAdminUsersUserIdRole(w http.ResponseWriter, r *http.Request, userId UserId)
+	// Журнал изменений роли пользователя, новые записи первыми.
+	// (GET /api/admin/users/{userId}/roleChanges)
+	GetApiAdminUsersUserIdRoleChanges(w http.ResponseWriter, r *http.Request, userId UserId)
+	// Аутентификация и получение JWT-токена. Если на сервере включён auto_register, при первой аутентификации пользователь создается автоматически.
+	// (POST /api/auth)
+	PostApiAuth(w http.ResponseWriter, r *http.Request)
+	// Выйти на текущем устройстве. Отзывает access-токен и, если передан, refresh-токен.
+	// (POST /api/auth/logout)
+	PostApiAuthLogout(w http.ResponseWriter, r *http.Request)
+	// Выйти на всех устройствах. Все выданные пользователю токены перестают действовать.
+	// (POST /api/auth/logoutAll)
+	PostApiAuthLogoutAll(w http.ResponseWriter, r *http.Request)
+	// Завершить вход через OpenID Connect.
+	// (GET /api/auth/oidc/callback)
+	GetApiAuthOidcCallback(w http.ResponseWriter, r *http.Request, params GetApiAuthOidcCallbackParams)
+	// Начать вход через корпоративный провайдер OpenID Connect.
+	// (GET /api/auth/oidc/login)
+	GetApiAuthOidcLogin(w http.ResponseWriter, r *http.Request)
+	// Обновить пару токенов по refresh-токену. Старый refresh-токен отзывается.
+	// (POST /api/auth/refresh)
+	PostApiAuthRefresh(w http.ResponseWriter, r *http.Request)
+	// Завершить вход кодом второго фактора (TOTP или код восстановления).
+	// (POST /api/auth/twoFactor)
+	PostApiAuthTwoFactor(w http.ResponseWriter, r *http.Request)
+	// Начать обязательное подключение второго фактора по токену ожидания из /api/auth.
+	// (POST /api/auth/twoFactor/setup)
+	PostApiAuthTwoFactorSetup(w http.ResponseWriter, r *http.Request)
+	// Подтвердить обязательное подключение второго фактора и завершить вход.
+	// (POST /api/auth/twoFactor/setup/confirm)
+	PostApiAuthTwoFactorSetupConfirm(w http.ResponseWriter, r *http.Request)
+	// Купить предмет за монеты.
+	// (POST /api/buy)
+	PostApiBuy(w http.ResponseWriter, r *http.Request, params PostApiBuyParams)
+	// Купить предмет за монеты (устарело).
+	// (GET /api/buy/{item})
+	GetApiBuyItem(w http.ResponseWriter, r *http.Request, item string, params GetApiBuyItemParams)
+	// Корзина пользователя.
+	// (GET /api/cart)
+	GetApiCart(w http.ResponseWriter, r *http.Request)
+	// Добавить товар в корзину.
+	// (POST /api/cart/items)
+	PostApiCartItems(w http.ResponseWriter, r *http.Request)
+	// Убрать товар из корзины.
+	// (DELETE /api/cart/items/{item})
+	DeleteApiCartItemsItem(w http.ResponseWriter, r *http.Request, item string)
+	// Оформить корзину.
+	// (POST /api/checkout)
+	PostApiCheckout(w http.ResponseWriter, r *http.Request)
+	// Получить информацию о монетах, инвентаре и истории транзакций.
+	// (GET /api/info)
+	GetApiInfo(w http.ResponseWriter, r *http.Request)
+	// Каталог мерча.
+	// (GET /api/merch)
+	GetApiMerch(w http.ResponseWriter, r *http.Request, params GetApiMerchParams)
+	// Товар каталога по названию.
+	// (GET /api/merch/{name})
+	GetApiMerchName(w http.ResponseWriter, r *http.Request, name string)
+	// Сменить пароль. Все сессии пользователя, включая текущую, завершаются.
+	// (POST /api/password)
+	PostApiPassword(w http.ResponseWriter, r *http.Request)
+	// Запросить письмо с токеном сброса пароля.
+	// (POST /api/password/forgot)
+	PostApiPasswordForgot(w http.ResponseWriter, r *http.Request)
+	// Установить новый пароль токеном из письма. Все сессии пользователя завершаются.
+	// (POST /api/password/reset)
+	PostApiPasswordReset(w http.ResponseWriter, r *http.Request)
+	// Регистрация. Начальные монеты начисляются после подтверждения email.
+	// (POST /api/register)
+	PostApiRegister(w http.ResponseWriter, r *http.Request)
+	// Отправить монеты другому пользователю.
+	// (POST /api/sendCoin)
+	PostApiSendCoin(w http.ResponseWriter, r *http.Request, params PostApiSendCoinParams)
+	// Сессии текущего пользователя, недавно использованные первыми.
+	// (GET /api/sessions)
+	GetApiSessions(w http.ResponseWriter, r *http.Request)
+	// Завершить сессию, например на потерянном устройстве.
+	// (DELETE /api/sessions/{sessionId})
+	DeleteApiSessionsSessionId(w http.ResponseWriter, r *http.Request, sessionId int64)
+	// Персональные токены доступа текущего пользователя, новые первыми.
+	// (GET /api/tokens)
+	GetApiTokens(w http.ResponseWriter, r *http.Request)
+	// Выпустить персональный токен доступа для бота или интеграции.
+	// (POST /api/tokens)
+	PostApiTokens(w http.ResponseWriter, r *http.Request)
+	// Отозвать персональный токен доступа.
+	// (DELETE /api/tokens/{tokenId})
+	DeleteApiTokensTokenId(w http.ResponseWriter, r *http.Request, tokenId int64)
+	// Включить второй фактор кодом из приложения-аутентификатора.
+	// (POST /api/twoFactor/confirm)
+	PostApiTwoFactorConfirm(w http.ResponseWriter, r *http.Request)
+	// Отключить второй фактор кодом TOTP или кодом восстановления.
+	// (POST /api/twoFactor/disable)
+	PostApiTwoFactorDisable(w http.ResponseWriter, r *http.Request)
+	// Начать подключение второго фактора. Он включится после подтверждения кодом.
+	// (POST /api/twoFactor/enroll)
+	PostApiTwoFactorEnroll(w http.ResponseWriter, r *http.Request)
+	// Подтвердить email токеном из письма.
+	// (POST /api/verifyEmail)
+	PostApiVerifyEmail(w http.ResponseWriter, r *http.Request)
+}
+
+// Unimplemented server implementation that returns http.StatusNotImplemented for each endpoint.
+
+type Unimplemented struct{}
+
+// Открытые ключи для проверки подписи токенов (JWKS, RFC 7517). Ключи HS256 не публикуются.
+// (GET /.well-known/jwks.json)
+func (_ Unimplemented) GetWellKnownJwksJson(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Все товары, включая архивные. Доступно менеджерам мерча и администраторам.
+// (GET /api/admin/merch)
+func (_ Unimplemented) GetApiAdminMerch(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Добавить товар в каталог. Цена записывается в историю цен.
+// (POST /api/admin/merch)
+func (_ Unimplemented) PostApiAdminMerch(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Убрать товар из каталога.
+// (POST /api/admin/merch/{name}/archive)
+func (_ Unimplemented) PostApiAdminMerchNameArchive(w http.ResponseWriter, r *http.Request, name MerchName) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Изменить цену товара.
+// (PUT /api/admin/merch/{name}/price)
+func (_ Unimplemented) PutApiAdminMerchNamePrice(w http.ResponseWriter, r *http.Request, name MerchName) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// История цен товара, новые записи первыми.
+// (GET /api/admin/merch/{name}/prices)
+func (_ Unimplemented) GetApiAdminMerchNamePrices(w http.ResponseWriter, r *http.Request, name MerchName) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Пополнить склад.
+// (POST /api/admin/merch/{name}/restock)
+func (_ Unimplemented) PostApiAdminMerchNameRestock(w http.ResponseWriter, r *http.Request, name MerchName) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Вернуть архивный товар в каталог.
+// (POST /api/admin/merch/{name}/restore)
+func (_ Unimplemented) PostApiAdminMerchNameRestore(w http.ResponseWriter, r *http.Request, name MerchName) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Задать остаток товара.
+// (PUT /api/admin/merch/{name}/stock)
+func (_ Unimplemented) PutApiAdminMerchNameStock(w http.ResponseWriter, r *http.Request, name MerchName) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Роли, для которых второй фактор обязателен.
+// (GET /api/admin/twoFactor/roles)
+func (_ Unimplemented) GetApiAdminTwoFactorRoles(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Сделать второй фактор обязательным для роли или отменить требование.
+// (PUT /api/admin/twoFactor/roles/{role})
+func (_ Unimplemented) PutApiAdminTwoFactorRolesRole(w http.ResponseWriter, r *http.Request, role Role) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Изменить роль пользователя. Доступно только администраторам; изменение записывается в журнал.
+// (PUT /api/admin/users/{userId}/role)
+func (_ Unimplemented) PutApiAdminUsersUserIdRole(w http.ResponseWriter, r *http.Request, userId UserId) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Журнал изменений роли пользователя, новые записи первыми.
+// (GET /api/admin/users/{userId}/roleChanges)
+func (_ Unimplemented) GetApiAdminUsersUserIdRoleChanges(w http.ResponseWriter, r *http.Request, userId UserId) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Аутентификация и получение JWT-токена. Если на сервере включён auto_register, при первой аутентификации пользователь создается автоматически.
+// (POST /api/auth)
+func (_ Unimplemented) PostApiAuth(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Выйти на текущем устройстве. Отзывает access-токен и, если передан, refresh-токен.
+// (POST /api/auth/logout)
+func (_ Unimplemented) PostApiAuthLogout(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Выйти на всех устройствах. Все выданные пользователю токены перестают действовать.
+// (POST /api/auth/logoutAll)
+func (_ Unimplemented) PostApiAuthLogoutAll(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Завершить вход через OpenID Connect.
+// (GET /api/auth/oidc/callback)
+func (_ Unimplemented) GetApiAuthOidcCallback(w http.ResponseWriter, r *http.Request, params GetApiAuthOidcCallbackParams) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Начать вход через корпоративный провайдер OpenID Connect.
+// (GET /api/auth/oidc/login)
+func (_ Unimplemented) GetApiAuthOidcLogin(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Обновить пару токенов по refresh-токену. Старый refresh-токен отзывается.
+// (POST /api/auth/refresh)
+func (_ Unimplemented) PostApiAuthRefresh(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Завершить вход кодом второго фактора (TOTP или код восстановления).
+// (POST /api/auth/twoFactor)
+func (_ Unimplemented) PostApiAuthTwoFactor(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Начать обязательное подключение второго фактора по токену ожидания из /api/auth.
+// (POST /api/auth/twoFactor/setup)
+func (_ Unimplemented) PostApiAuthTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Подтвердить обязательное подключение второго фактора и завершить вход.
+// (POST /api/auth/twoFactor/setup/confirm)
+func (_ Unimplemented) PostApiAuthTwoFactorSetupConfirm(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Купить предмет за монеты.
+// (POST /api/buy)
+func (_ Unimplemented) PostApiBuy(w http.ResponseWriter, r *http.Request, params PostApiBuyParams) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Купить предмет за монеты (устарело).
+// (GET /api/buy/{item})
+func (_ Unimplemented) GetApiBuyItem(w http.ResponseWriter, r *http.Request, item string, params GetApiBuyItemParams) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Корзина пользователя.
+// (GET /api/cart)
+func (_ Unimplemented) GetApiCart(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Добавить товар в корзину.
+// (POST /api/cart/items)
+func (_ Unimplemented) PostApiCartItems(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Убрать товар из корзины.
+// (DELETE /api/cart/items/{item})
+func (_ Unimplemented) DeleteApiCartItemsItem(w http.ResponseWriter, r *http.Request, item string) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Оформить корзину.
+// (POST /api/checkout)
+func (_ Unimplemented) PostApiCheckout(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Получить информацию о монетах, инвентаре и истории транзакций.
+// (GET /api/info)
+func (_ Unimplemented) GetApiInfo(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Каталог мерча.
+// (GET /api/merch)
+func (_ Unimplemented) GetApiMerch(w http.ResponseWriter, r *http.Request, params GetApiMerchParams) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Товар каталога по названию.
+// (GET /api/merch/{name})
+func (_ Unimplemented) GetApiMerchName(w http.ResponseWriter, r *http.Request, name string) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Сменить пароль. Все сессии пользователя, включая текущую, завершаются.
+// (POST /api/password)
+func (_ Unimplemented) PostApiPassword(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Запросить письмо с токеном сброса пароля.
+// (POST /api/password/forgot)
+func (_ Unimplemented) PostApiPasswordForgot(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Установить новый пароль токеном из письма. Все сессии пользователя завершаются.
+// (POST /api/password/reset)
+func (_ Unimplemented) PostApiPasswordReset(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Регистрация. Начальные монеты начисляются после подтверждения email.
+// (POST /api/register)
+func (_ Unimplemented) PostApiRegister(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Отправить монеты другому пользователю.
+// (POST /api/sendCoin)
+func (_ Unimplemented) PostApiSendCoin(w http.ResponseWriter, r *http.Request, params PostApiSendCoinParams) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Сессии текущего пользователя, недавно использованные первыми.
+// (GET /api/sessions)
+func (_ Unimplemented) GetApiSessions(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Завершить сессию, например на потерянном устройстве.
+// (DELETE /api/sessions/{sessionId})
+func (_ Unimplemented) DeleteApiSessionsSessionId(w http.ResponseWriter, r *http.Request, sessionId int64) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Персональные токены доступа текущего пользователя, новые первыми.
+// (GET /api/tokens)
+func (_ Unimplemented) GetApiTokens(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Выпустить персональный токен доступа для бота или интеграции.
+// (POST /api/tokens)
+func (_ Unimplemented) PostApiTokens(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Отозвать персональный токен доступа.
+// (DELETE /api/tokens/{tokenId})
+func (_ Unimplemented) DeleteApiTokensTokenId(w http.ResponseWriter, r *http.Request, tokenId int64) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Включить второй фактор кодом из приложения-аутентификатора.
+// (POST /api/twoFactor/confirm)
+func (_ Unimplemented) PostApiTwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Отключить второй фактор кодом TOTP или кодом восстановления.
+// (POST /api/twoFactor/disable)
+func (_ Unimplemented) PostApiTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Начать подключение второго фактора. Он включится после подтверждения кодом.
+// (POST /api/twoFactor/enroll)
+func (_ Unimplemented) PostApiTwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// Подтвердить email токеном из письма.
+// (POST /api/verifyEmail)
+func (_ Unimplemented) PostApiVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNotImplemented)
+}
+
+// ServerInterfaceWrapper converts contexts to parameters.
+type ServerInterfaceWrapper struct {
+	Handler            ServerInterface
+	HandlerMiddlewares []MiddlewareFunc
+	ErrorHandlerFunc   func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+type MiddlewareFunc func(http.Handler) http.Handler
+
+// GetWellKnownJwksJson operation middleware
+func (siw *ServerInterfaceWrapper) GetWellKnownJwksJson(w http.ResponseWriter, r *http.Request) {
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetWellKnownJwksJson(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetApiAdminMerch operation middleware
+func (siw *ServerInterfaceWrapper) GetApiAdminMerch(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{"merch-manager", "admin"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetApiAdminMerch(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiAdminMerch operation middleware
+func (siw *ServerInterfaceWrapper) PostApiAdminMerch(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{"merch-manager", "admin"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiAdminMerch(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiAdminMerchNameArchive operation middleware
+func (siw *ServerInterfaceWrapper) PostApiAdminMerchNameArchive(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "name" -------------
+	var name MerchName
+
+	err = runtime.BindStyledParameterWithOptions("simple", "name", chi.URLParam(r, "name"), &name, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "name", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{"merch-manager", "admin"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiAdminMerchNameArchive(w, r, name)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PutApiAdminMerchNamePrice operation middleware
+func (siw *ServerInterfaceWrapper) PutApiAdminMerchNamePrice(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "name" -------------
+	var name MerchName
+
+	err = runtime.BindStyledParameterWithOptions("simple", "name", chi.URLParam(r, "name"), &name, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "name", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{"merch-manager", "admin"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PutApiAdminMerchNamePrice(w, r, name)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetApiAdminMerchNamePrices operation middleware
+func (siw *ServerInterfaceWrapper) GetApiAdminMerchNamePrices(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "name" -------------
+	var name MerchName
+
+	err = runtime.BindStyledParameterWithOptions("simple", "name", chi.URLParam(r, "name"), &name, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "name", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{"merch-manager", "admin"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetApiAdminMerchNamePrices(w, r, name)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiAdminMerchNameRestock operation middleware
+func (siw *ServerInterfaceWrapper) PostApiAdminMerchNameRestock(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "name" -------------
+	var name MerchName
+
+	err = runtime.BindStyledParameterWithOptions("simple", "name", chi.URLParam(r, "name"), &name, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "name", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{"merch-manager", "admin"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiAdminMerchNameRestock(w, r, name)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiAdminMerchNameRestore operation middleware
+func (siw *ServerInterfaceWrapper) PostApiAdminMerchNameRestore(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "name" -------------
+	var name MerchName
+
+	err = runtime.BindStyledParameterWithOptions("simple", "name", chi.URLParam(r, "name"), &name, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "name", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{"merch-manager", "admin"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiAdminMerchNameRestore(w, r, name)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PutApiAdminMerchNameStock operation middleware
+func (siw *ServerInterfaceWrapper) PutApiAdminMerchNameStock(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "name" -------------
+	var name MerchName
+
+	err = runtime.BindStyledParameterWithOptions("simple", "name", chi.URLParam(r, "name"), &name, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "name", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{"merch-manager", "admin"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PutApiAdminMerchNameStock(w, r, name)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetApiAdminTwoFactorRoles operation middleware
+func (siw *ServerInterfaceWrapper) GetApiAdminTwoFactorRoles(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{"admin"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetApiAdminTwoFactorRoles(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PutApiAdminTwoFactorRolesRole operation middleware
+func (siw *ServerInterfaceWrapper) PutApiAdminTwoFactorRolesRole(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "role" -------------
+	var role Role
+
+	err = runtime.BindStyledParameterWithOptions("simple", "role", chi.URLParam(r, "role"), &role, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "role", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{"admin"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PutApiAdminTwoFactorRolesRole(w, r, role)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PutApiAdminUsersUserIdRole operation middleware
+func (siw *ServerInterfaceWrapper) PutApiAdminUsersUserIdRole(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "userId" -------------
+	var userId UserId
+
+	err = runtime.BindStyledParameterWithOptions("simple", "userId", chi.URLParam(r, "userId"), &userId, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "userId", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{"admin"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PutApiAdminUsersUserIdRole(w, r, userId)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetApiAdminUsersUserIdRoleChanges operation middleware
+func (siw *ServerInterfaceWrapper) GetApiAdminUsersUserIdRoleChanges(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "userId" -------------
+	var userId UserId
+
+	err = runtime.BindStyledParameterWithOptions("simple", "userId", chi.URLParam(r, "userId"), &userId, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "userId", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{"admin"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetApiAdminUsersUserIdRoleChanges(w, r, userId)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiAuth operation middleware
+func (siw *ServerInterfaceWrapper) PostApiAuth(w http.ResponseWriter, r *http.Request) {
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiAuth(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiAuthLogout operation middleware
+func (siw *ServerInterfaceWrapper) PostApiAuthLogout(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiAuthLogout(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiAuthLogoutAll operation middleware
+func (siw *ServerInterfaceWrapper) PostApiAuthLogoutAll(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiAuthLogoutAll(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetApiAuthOidcCallback operation middleware
+func (siw *ServerInterfaceWrapper) GetApiAuthOidcCallback(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetApiAuthOidcCallbackParams
+
+	// ------------- Required query parameter "code" -------------
+
+	if paramValue := r.URL.Query().Get("code"); paramValue != "" {
+
+	} else {
+		siw.ErrorHandlerFunc(w, r, &RequiredParamError{ParamName: "code"})
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "code", r.URL.Query(), &params.Code)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "code", Err: err})
+		return
+	}
+
+	// ------------- Required query parameter "state" -------------
+
+	if paramValue := r.URL.Query().Get("state"); paramValue != "" {
+
+	} else {
+		siw.ErrorHandlerFunc(w, r, &RequiredParamError{ParamName: "state"})
+		return
+	}
+
+	err = runtime.BindQueryParameter("form", true, true, "state", r.URL.Query(), &params.State)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "state", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetApiAuthOidcCallback(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetApiAuthOidcLogin operation middleware
+func (siw *ServerInterfaceWrapper) GetApiAuthOidcLogin(w http.ResponseWriter, r *http.Request) {
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetApiAuthOidcLogin(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiAuthRefresh operation middleware
+func (siw *ServerInterfaceWrapper) PostApiAuthRefresh(w http.ResponseWriter, r *http.Request) {
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiAuthRefresh(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiAuthTwoFactor operation middleware
+func (siw *ServerInterfaceWrapper) PostApiAuthTwoFactor(w http.ResponseWriter, r *http.Request) {
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiAuthTwoFactor(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiAuthTwoFactorSetup operation middleware
+func (siw *ServerInterfaceWrapper) PostApiAuthTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiAuthTwoFactorSetup(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiAuthTwoFactorSetupConfirm operation middleware
+func (siw *ServerInterfaceWrapper) PostApiAuthTwoFactorSetupConfirm(w http.ResponseWriter, r *http.Request) {
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiAuthTwoFactorSetupConfirm(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiBuy operation middleware
+func (siw *ServerInterfaceWrapper) PostApiBuy(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, PersonalTokenAuthScopes, []string{"merch:buy"})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params PostApiBuyParams
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "Idempotency-Key" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("Idempotency-Key")]; found {
+		var IdempotencyKey IdempotencyKey
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "Idempotency-Key", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "Idempotency-Key", valueList[0], &IdempotencyKey, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "Idempotency-Key", Err: err})
+			return
+		}
+
+		params.IdempotencyKey = &IdempotencyKey
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiBuy(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetApiBuyItem operation middleware
+func (siw *ServerInterfaceWrapper) GetApiBuyItem(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "item" -------------
+	var item string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "item", chi.URLParam(r, "item"), &item, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "item", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, PersonalTokenAuthScopes, []string{"merch:buy"})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetApiBuyItemParams
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "Idempotency-Key" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("Idempotency-Key")]; found {
+		var IdempotencyKey IdempotencyKey
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "Idempotency-Key", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "Idempotency-Key", valueList[0], &IdempotencyKey, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "Idempotency-Key", Err: err})
+			return
+		}
+
+		params.IdempotencyKey = &IdempotencyKey
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetApiBuyItem(w, r, item, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetApiCart operation middleware
+func (siw *ServerInterfaceWrapper) GetApiCart(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, PersonalTokenAuthScopes, []string{"merch:buy"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetApiCart(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiCartItems operation middleware
+func (siw *ServerInterfaceWrapper) PostApiCartItems(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, PersonalTokenAuthScopes, []string{"merch:buy"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiCartItems(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// DeleteApiCartItemsItem operation middleware
+func (siw *ServerInterfaceWrapper) DeleteApiCartItemsItem(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "item" -------------
+	var item string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "item", chi.URLParam(r, "item"), &item, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "item", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, PersonalTokenAuthScopes, []string{"merch:buy"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteApiCartItemsItem(w, r, item)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiCheckout operation middleware
+func (siw *ServerInterfaceWrapper) PostApiCheckout(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, PersonalTokenAuthScopes, []string{"merch:buy"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiCheckout(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetApiInfo operation middleware
+func (siw *ServerInterfaceWrapper) GetApiInfo(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, PersonalTokenAuthScopes, []string{"info:read"})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetApiInfo(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetApiMerch operation middleware
+func (siw *ServerInterfaceWrapper) GetApiMerch(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params GetApiMerchParams
+
+	// ------------- Optional query parameter "category" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "category", r.URL.Query(), &params.Category)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "category", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "minPrice" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "minPrice", r.URL.Query(), &params.MinPrice)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "minPrice", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "maxPrice" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "maxPrice", r.URL.Query(), &params.MaxPrice)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "maxPrice", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "sort" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "sort", r.URL.Query(), &params.Sort)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "sort", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "cursor" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "cursor", r.URL.Query(), &params.Cursor)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "cursor", Err: err})
+		return
+	}
+
+	// ------------- Optional query parameter "limit" -------------
+
+	err = runtime.BindQueryParameter("form", true, false, "limit", r.URL.Query(), &params.Limit)
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "limit", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetApiMerch(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetApiMerchName operation middleware
+func (siw *ServerInterfaceWrapper) GetApiMerchName(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "name" -------------
+	var name string
+
+	err = runtime.BindStyledParameterWithOptions("simple", "name", chi.URLParam(r, "name"), &name, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "name", Err: err})
+		return
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetApiMerchName(w, r, name)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiPassword operation middleware
+func (siw *ServerInterfaceWrapper) PostApiPassword(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiPassword(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiPasswordForgot operation middleware
+func (siw *ServerInterfaceWrapper) PostApiPasswordForgot(w http.ResponseWriter, r *http.Request) {
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiPasswordForgot(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiPasswordReset operation middleware
+func (siw *ServerInterfaceWrapper) PostApiPasswordReset(w http.ResponseWriter, r *http.Request) {
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiPasswordReset(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiRegister operation middleware
+func (siw *ServerInterfaceWrapper) PostApiRegister(w http.ResponseWriter, r *http.Request) {
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiRegister(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiSendCoin operation middleware
+func (siw *ServerInterfaceWrapper) PostApiSendCoin(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	ctx = context.WithValue(ctx, PersonalTokenAuthScopes, []string{"coins:send"})
+
+	r = r.WithContext(ctx)
+
+	// Parameter object where we will unmarshal all parameters from the context
+	var params PostApiSendCoinParams
+
+	headers := r.Header
+
+	// ------------- Optional header parameter "Idempotency-Key" -------------
+	if valueList, found := headers[http.CanonicalHeaderKey("Idempotency-Key")]; found {
+		var IdempotencyKey IdempotencyKey
+		n := len(valueList)
+		if n != 1 {
+			siw.ErrorHandlerFunc(w, r, &TooManyValuesForParamError{ParamName: "Idempotency-Key", Count: n})
+			return
+		}
+
+		err = runtime.BindStyledParameterWithOptions("simple", "Idempotency-Key", valueList[0], &IdempotencyKey, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationHeader, Explode: false, Required: false})
+		if err != nil {
+			siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "Idempotency-Key", Err: err})
+			return
+		}
+
+		params.IdempotencyKey = &IdempotencyKey
+
+	}
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiSendCoin(w, r, params)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetApiSessions operation middleware
+func (siw *ServerInterfaceWrapper) GetApiSessions(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetApiSessions(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// DeleteApiSessionsSessionId operation middleware
+func (siw *ServerInterfaceWrapper) DeleteApiSessionsSessionId(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "sessionId" -------------
+	var sessionId int64
+
+	err = runtime.BindStyledParameterWithOptions("simple", "sessionId", chi.URLParam(r, "sessionId"), &sessionId, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "sessionId", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteApiSessionsSessionId(w, r, sessionId)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// GetApiTokens operation middleware
+func (siw *ServerInterfaceWrapper) GetApiTokens(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.GetApiTokens(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiTokens operation middleware
+func (siw *ServerInterfaceWrapper) PostApiTokens(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiTokens(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// DeleteApiTokensTokenId operation middleware
+func (siw *ServerInterfaceWrapper) DeleteApiTokensTokenId(w http.ResponseWriter, r *http.Request) {
+
+	var err error
+
+	// ------------- Path parameter "tokenId" -------------
+	var tokenId int64
+
+	err = runtime.BindStyledParameterWithOptions("simple", "tokenId", chi.URLParam(r, "tokenId"), &tokenId, runtime.BindStyledParameterOptions{ParamLocation: runtime.ParamLocationPath, Explode: false, Required: true})
+	if err != nil {
+		siw.ErrorHandlerFunc(w, r, &InvalidParamFormatError{ParamName: "tokenId", Err: err})
+		return
+	}
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.DeleteApiTokensTokenId(w, r, tokenId)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiTwoFactorConfirm operation middleware
+func (siw *ServerInterfaceWrapper) PostApiTwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiTwoFactorConfirm(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiTwoFactorDisable operation middleware
+func (siw *ServerInterfaceWrapper) PostApiTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiTwoFactorDisable(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiTwoFactorEnroll operation middleware
+func (siw *ServerInterfaceWrapper) PostApiTwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+
+	ctx := r.Context()
+
+	ctx = context.WithValue(ctx, BearerAuthScopes, []string{})
+
+	r = r.WithContext(ctx)
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiTwoFactorEnroll(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+// PostApiVerifyEmail operation middleware
+func (siw *ServerInterfaceWrapper) PostApiVerifyEmail(w http.ResponseWriter, r *http.Request) {
+
+	handler := http.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		siw.Handler.PostApiVerifyEmail(w, r)
+	}))
+
+	for _, middleware := range siw.HandlerMiddlewares {
+		handler = middleware(handler)
+	}
+
+	handler.ServeHTTP(w, r)
+}
+
+type UnescapedCookieParamError struct {
+	ParamName string
+	Err       error
+}
+
+func (e *UnescapedCookieParamError) Error() string {
+	return fmt.Sprintf("error unescaping cookie parameter '%s'", e.ParamName)
+}
+
+func (e *UnescapedCookieParamError) Unwrap() error {
+	return e.Err
+}
+
+type UnmarshalingParamError struct {
+	ParamName string
+	Err       error
+}
+
+func (e *UnmarshalingParamError) Error() string {
+	return fmt.Sprintf("Error unmarshaling parameter %s as JSON: %s", e.ParamName, e.Err.Error())
+}
+
+func (e *UnmarshalingParamError) Unwrap() error {
+	return e.Err
+}
+
+type RequiredParamError struct {
+	ParamName string
+}
+
+func (e *RequiredParamError) Error() string {
+	return fmt.Sprintf("Query argument %s is required, but not found", e.ParamName)
+}
+
+type RequiredHeaderError struct {
+	ParamName string
+	Err       error
+}
+
+func (e *RequiredHeaderError) Error() string {
+	return fmt.Sprintf("Header parameter %s is required, but not found", e.ParamName)
+}
+
+func (e *RequiredHeaderError) Unwrap() error {
+	return e.Err
+}
+
+type InvalidParamFormatError struct {
+	ParamName string
+	Err       error
+}
+
+func (e *InvalidParamFormatError) Error() string {
+	return fmt.Sprintf("Invalid format for parameter %s: %s", e.ParamName, e.Err.Error())
+}
+
+func (e *InvalidParamFormatError) Unwrap() error {
+	return e.Err
+}
+
+type TooManyValuesForParamError struct {
+	ParamName string
+	Count     int
+}
+
+func (e *TooManyValuesForParamError) Error() string {
+	return fmt.Sprintf("Expected one value for %s, got %d", e.ParamName, e.Count)
+}
+
+// Handler creates http.Handler with routing matching OpenAPI spec.
+func Handler(si ServerInterface) http.Handler {
+	return HandlerWithOptions(si, ChiServerOptions{})
+}
+
+type ChiServerOptions struct {
+	BaseURL          string
+	BaseRouter       chi.Router
+	Middlewares      []MiddlewareFunc
+	ErrorHandlerFunc func(w http.ResponseWriter, r *http.Request, err error)
+}
+
+// HandlerFromMux creates http.Handler with routing matching OpenAPI spec based on the provided mux.
+func HandlerFromMux(si ServerInterface, r chi.Router) http.Handler {
+	return HandlerWithOptions(si, ChiServerOptions{
+		BaseRouter: r,
+	})
+}
+
+func HandlerFromMuxWithBaseURL(si ServerInterface, r chi.Router, baseURL string) http.Handler {
+	return HandlerWithOptions(si, ChiServerOptions{
+		BaseURL:    baseURL,
+		BaseRouter: r,
+	})
+}
+
+// HandlerWithOptions creates http.Handler with additional options
+func HandlerWithOptions(si ServerInterface, options ChiServerOptions) http.Handler {
+	r := options.BaseRouter
+
+	if r == nil {
+		r = chi.NewRouter()
+	}
+	if options.ErrorHandlerFunc == nil {
+		options.ErrorHandlerFunc = func(w http.ResponseWriter, r *http.Request, err error) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		}
+	}
+	wrapper := ServerInterfaceWrapper{
+		Handler:            si,
+		HandlerMiddlewares: options.Middlewares,
+		ErrorHandlerFunc:   options.ErrorHandlerFunc,
+	}
+
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/.well-known/jwks.json", wrapper.GetWellKnownJwksJson)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/api/admin/merch", wrapper.GetApiAdminMerch)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/admin/merch", wrapper.PostApiAdminMerch)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/admin/merch/{name}/archive", wrapper.PostApiAdminMerchNameArchive)
+	})
+	r.Group(func(r chi.Router) {
+		r.Put(options.BaseURL+"/api/admin/merch/{name}/price", wrapper.PutApiAdminMerchNamePrice)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/api/admin/merch/{name}/prices", wrapper.GetApiAdminMerchNamePrices)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/admin/merch/{name}/restock", wrapper.PostApiAdminMerchNameRestock)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/admin/merch/{name}/restore", wrapper.PostApiAdminMerchNameRestore)
+	})
+	r.Group(func(r chi.Router) {
+		r.Put(options.BaseURL+"/api/admin/merch/{name}/stock", wrapper.PutApiAdminMerchNameStock)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/api/admin/twoFactor/roles", wrapper.GetApiAdminTwoFactorRoles)
+	})
+	r.Group(func(r chi.Router) {
+		r.Put(options.BaseURL+"/api/admin/twoFactor/roles/{role}", wrapper.PutApiAdminTwoFactorRolesRole)
+	})
+	r.Group(func(r chi.Router) {
+		r.Put(options.BaseURL+"/api/admin/users/{userId}/role", wrapper.PutApiAdminUsersUserIdRole)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/api/admin/users/{userId}/roleChanges", wrapper.GetApiAdminUsersUserIdRoleChanges)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/auth", wrapper.PostApiAuth)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/auth/logout", wrapper.PostApiAuthLogout)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/auth/logoutAll", wrapper.PostApiAuthLogoutAll)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/api/auth/oidc/callback", wrapper.GetApiAuthOidcCallback)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/api/auth/oidc/login", wrapper.GetApiAuthOidcLogin)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/auth/refresh", wrapper.PostApiAuthRefresh)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/auth/twoFactor", wrapper.PostApiAuthTwoFactor)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/auth/twoFactor/setup", wrapper.PostApiAuthTwoFactorSetup)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/auth/twoFactor/setup/confirm", wrapper.PostApiAuthTwoFactorSetupConfirm)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/buy", wrapper.PostApiBuy)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/api/buy/{item}", wrapper.GetApiBuyItem)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/api/cart", wrapper.GetApiCart)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/cart/items", wrapper.PostApiCartItems)
+	})
+	r.Group(func(r chi.Router) {
+		r.Delete(options.BaseURL+"/api/cart/items/{item}", wrapper.DeleteApiCartItemsItem)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/checkout", wrapper.PostApiCheckout)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/api/info", wrapper.GetApiInfo)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/api/merch", wrapper.GetApiMerch)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/api/merch/{name}", wrapper.GetApiMerchName)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/password", wrapper.PostApiPassword)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/password/forgot", wrapper.PostApiPasswordForgot)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/password/reset", wrapper.PostApiPasswordReset)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/register", wrapper.PostApiRegister)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/sendCoin", wrapper.PostApiSendCoin)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/api/sessions", wrapper.GetApiSessions)
+	})
+	r.Group(func(r chi.Router) {
+		r.Delete(options.BaseURL+"/api/sessions/{sessionId}", wrapper.DeleteApiSessionsSessionId)
+	})
+	r.Group(func(r chi.Router) {
+		r.Get(options.BaseURL+"/api/tokens", wrapper.GetApiTokens)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/tokens", wrapper.PostApiTokens)
+	})
+	r.Group(func(r chi.Router) {
+		r.Delete(options.BaseURL+"/api/tokens/{tokenId}", wrapper.DeleteApiTokensTokenId)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/twoFactor/confirm", wrapper.PostApiTwoFactorConfirm)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/twoFactor/disable", wrapper.PostApiTwoFactorDisable)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/twoFactor/enroll", wrapper.PostApiTwoFactorEnroll)
+	})
+	r.Group(func(r chi.Router) {
+		r.Post(options.BaseURL+"/api/verifyEmail", wrapper.PostApiVerifyEmail)
+	})
+
+	return r
+}
+
+// Base64 encoded, gzipped, json marshaled Swagger object
+var swaggerSpec = []string{
+
+	"H4sIAAAAAAAC/+x9W28bV7bmXylwzoM9KF3sODkdGXlwnOS0k8zEIzsnD5FHKJNbUrWpKqaqaEcdCLCk",
+	"dpxAbqvT6JnTCLrjTnpwZoB5oWjRoi6kgZ4/sOsvzC85WGtfau+qXRfZutA2X2yRrMu+rW/d1/qmVveX",
+	"W75HvCiszXxTazmBs0wiEuCnaw2y3PIj4tVXPiEr8E2DhPXAbUWu79VmavRHehA/jh9atE93aI8e0ud0",
+	"GK/THh3E63RAh/FavE77kxZ9Qoe0G6/TYXzforu0Q5/H9+Fn2rHiNQtvObToM9qz6D57Jh3CN3322wH7",
+	"1KVDuku78X3aib+nHdqL1614jQ7jB/AVHcQ/0AEdxJt0z8JxdPEKuk17dNeiz5MxwNjoUzqEu5/TPoyD",
+	"Dmg/3rLoIR3SAdw3WbNrLsxyiTgNEtTsmucsk9qMuioTsCx2LawvkWUH1mfZ+fpT4i1GS7WZi2+/bdei",
+	"lRbcEkaB6y3WVlft2n8hQX3pv+KTMsv5V9qB+bHB0B7MfQgfYXZyOC0nWkoGg//ZtYB81XYD0qjNREGb",
+	"qCPKjuDzkATXGobX/5nu8K3rx7+jfbpPO2LLYO0O4kd0lw8INyXeyhlUm72haFgLfrDsRLWZmutF71yq",
+	"2bVl13OX28u1mQty1VwvIoskqK2uropb8VheaTSuOkF0LSLLs+SrNgkj+LYV+C0SRC7Ba9yILKc25J1L",
+	"+Bbx8UJmd+zaV23Hi9xohd/JBzQ9XTI8daJfslcrz7ol7/Bv/4bUI3jRlcay6+FRuMYHqg/fCepL7l3S",
+	"UHbwtu83iePB3eLXK5FhF/8Y3wdqgrPcie/HD2gfd+xb2qf9y0gX8Vq8gf+u0268wahoQztsFu1afPs7",
+	"SHxPaQ/2Wu5aw4nIROTi2cusYt2JyKIfrBiOn62P1vC7x0kj80MrcOvqL3L57VoY+fU7hqX4CeeIh5ju",
+	"W3SAaAMAQztw1PNWw7ZoL16jB7Rv0WH6ET0r3ogf0n68Hm8iqfbwZiSFkoPBaZVNRF8JZdGS7TWfnHa0",
+	"lHvqG+QuX6TUSvwFhgk7CqNfi9cBfekemzRs9w5QsxWQhYCESxNstoAFtMPA24o3EBkP4occKh9b///+",
+	"nyzAkokri8SLYP7F6GfXvp5Y9Cfgy4nwjtua8HF4TnOi5cOSBQwlYKudMLznByaMeoIHFMFIjJp2YAMz",
+	"yIUHXju08rEaDvzKcIIBwDwzRv+ZkVYOIB55TGTZcZs1E6NQT44cj7I2+YcjbPleSLKng2/vTf8O8bIz",
+	"m81svpwMmywc+55gkwOc9xA47XPEmU0ruRF+s+BqhKJda8ppuVNOO1qa4kOYNMFGZB4X/RE59hDP75A+",
+	"AzyLN+LvaZ/uWR9/cdM04B1Gt/EGDM4Cwt1FkaEff097XEY4tGB0SP33UQA4nCzdBzZEW19J00a8314p",
+	"ZU1HZP4vzsmy6wnYhvvDAGBo0R7doX3c3G/5y06O+QHzNi+L/sc/BWShNlP7T1OJjDrFxYApIQDUVuUL",
+	"nCBwVvCzHznN63nswjDgsKbdlDfmHFZ913Gbzu2mCSx+EVtoYqgg3WZ4khU/4HjCxFuxkJkdykoF4lzl",
+	"c87M6Hp0H0mpE29Z8bcM8JFWtNfFGybmpp+x7K9H3gX12CRcUnmMray1cY+WHG+RXOcAmUt/9XYQEC+6",
+	"ns9kkoXpS4BjeF+Bn5io0SP3Cl73V1RMNo/+ql+V4VV6qvpI8tdw1m+S3PULiBP6JqB+Et9HWOmzY9Sn",
+	"u/QQz5TkGhyenwHmwkVw6lPY9vb0tBzWkQWHwG+SMuSAuWUWCm80rwep3/Hb0YdB4Af5rLXuN4hRFl+j",
+	"PfqU7tCOVedPml9w3CZpGFkggbeERiJuuh45Ajzyl33qegSHnsXJ1ArwV9tsKuJ9RUuSPLvqcgDn2QGZ",
+	"+jvap9t0H9R7IYzu075twe9wfPDwWMjvd1CY0JbfOrcMmtO850fzC37ba9gWrKu/MI+KgG253l2n6Tbm",
+	"BZycP+pi50CpGbT4gvHHFa3YZ0GDGFbLbRg14iyk5iL8cSJxo8ZfpMFxGXvkM8ynEB/mfvQDzJaslMmn",
+	"DtrPdJ/L5/sg3Eibjm7vGVbQ2fiwyxfAd71fu2HE1d7U3FskcGBsoVGjYWIySNM78SZKBSBw76P0CjQC",
+	"wvQDJBKQrJn0wMU3nOch3hDfj7foDgjCk3wHyxfZd73PxNhMixyQOhFmiEpPnOU3wJND0xND4kWVn3aD",
+	"eFHOk9L4LQbK32Cra563X8nUs0Ldst/2IqP6pzE1kOK2GR+jAzhW3KYAjPBbqRY+wo3rCf6nGx3pnlm6",
+	"qgfEicptPEP6HA+QSbkstNIsBP4yqO9Gu8k6Gmg7tEv7Yg7WObM6OIg34wcWfa4eY8BsA+hWZ+Q5OtKP",
+	"SBMH4r10T9GS9PEx6hnS/ZcaBlL/UW2lYN7eR2WuUzSmMryvPsrIz9nHJ3KjOtldHCqbfHByO8nuM4jY",
+	"ffrceHqJB5rml7UocLxwgQTzCm3L7ziRt9pBfckJVUjO09zhV1vQtUpdRnTAX9E+m69GKFbOlG7+omuV",
+	"so0qT70w/TJisVfJ3XDZQlCSlq14Q9g2UXvt0B1mMKGd+AEz6dxurwC7wr9RJDPYKVpOFJEA3vffv3Qm",
+	"fjs98e4t/v/Erf/8TyZgkurqEcwOmmk1f0evkyCEFULDTe7Okq9bbkBCI/L+hBx3IMygoLCvcfkVzag9",
+	"aVXtx1uTFv2B+Z4GqAYMLdVWtY32F7w7fsjgrDp6V9tSG4EHBWnu+BrSw3jDol1hbwDSj78F8+4uKmQo",
+	"JCmD7CbciksW+qksVX3Dut86guKi7dANuBcesux619jdF1KCgF1re+5XbcJ/xgNvPht8IPmHo6G9O3ss",
+	"WumfK8+jyLqJ4h84MZk+HD9iJ0HZhMuce8DW6j6HRF9CHN+tbsDU52JakxdTeP9CO6jcDfBM95kZix7i",
+	"jJg6p6l/Kt4LpS3gZGnX8DMKaPOoXOFmgxnZD9zfIj8Q99QD0iBe5DrNEL8N2wsLbt0lXjS/0PYaoXKp",
+	"5AAhaS7MC4YC51rXKWtS+g20L93E+zt/h6zMB6Qd4ljARj/vNAPiNFbmydduGKmvvUsCd8Gts9mIXUDj",
+	"Pz6d/azNiduY5cULfnDbbTSIJ96ljUrcBHYMPjf4e76O9hzUX/z5ZcdbmQc8Xm7h4O4Fvrc4r9iWkneH",
+	"JJJvlqu85DSbxFskmV+ie/78glOP/GCea8PKN3JNPLDcNfQfYRLGH+SpTd6CFKy+FUYxj2i9opxp/r26",
+	"PCEJQ9fXv3PxxEQr863Av+s2SDDfcEMxEPEK323U58PIidT3spOy4DYjEihf19tB6KtfCBMmuz5zNFSb",
+	"hTrL1GdFCa87QTQPmyc/AKZqs0pZmfA5wH+dJqehW4WWkIwePaRDus29JqjtDOm2SsI9mwlx/XiNYVP8",
+	"GK/uWSzEg26jcHmo2ZBzwEk3QZlA6SM/WPSjUgtvvvvuQ6C4wnCGF/XMmYZ7zVvwiyBUMxmUKeriUlAN",
+	"USeu6NlRfWFcwtdiXAxmJu8u8cSwKnHta+IOs0smbZXG4avvsbXFMC+l+obMWh7V3fUcNZwdUOWZBmle",
+	"iWLlRX9IpwL3ZUpIoXPs4y8+yU7PaS7Cf4JVzt64+PY7Nbv2YeODG1eMFF0P7mbH/dkn19FpT/fBPoEH",
+	"f8s692Hj4ttvX3j3pZQ8wyLN3riCL4t/T/e5VjHgGnPHOnfbCck7l9pB86Vee8c9omouYss6NsaN0S44",
+	"XMA6z42DTHl/yq1sXW5du+M2LC0kwiSQ34lW8k+KfK8q8MzeuFKzYVOMO+jlLynS7068wfT541nKNkMo",
+	"MbbQXTSO6uuCU4UeeogEiNeFvIezPp4hpkjpDvLAOy6XvGo20kgOQd0gBiZxh6xUV0uAKstgDR9oGsGn",
+	"/iKaxnP9aUcMy4h/jx9QnzRE89iKvsc2YhBv0Gcgk7NNGjIVMV5nTsYX3o/MRIsC2gq85H+hQzE8jLli",
+	"djKIsHqk2vfQl7aHxqy1SYv+qHrT4abfg1AS30/MFkz75auFai98hMCuXsbELn+hO4hTe3Oe5gLfVEeC",
+	"BPgMMSOtmsGgmWqW4rtgpd+BKYKktE57SjCNakFg0+hc1geIAXliInNevCbMerTHIKuLWuR3uGhMMZQS",
+	"GsToqKLm5JxnDB844ai91J7/uwg26CriCFiWjjOOrjBaAA/rdWeRvGwoSnLqDf4Oj3wdXWWKgdGczXR/",
+	"drrx9MUbXILeE77RjjiCudGbbCUzR7hcIGHzy18dsXkpwRV1ysb7RmkLzqjq++/TAx5aEm8Uhp/iNTY7",
+	"zjs4aSmt9ulTYSOOt+BzFft5ccgo6lYfBX5OJBbS1gETnzWTnpgLbgZbd+UKsR9I6AP5mI5pd1kYPFrW",
+	"KnttUtsnKCCZjHkrw9BZJPmKyDK7oLr+B1wHDfff0QGPzI83mVIlHWP98tMn3msadIktTnOOVbOYHptV",
+	"t+gUp426gk2npMdqI64cF9B0wujzMMdX+CQFC72UmZ9xNTltHCsbOuLPo/gxP89AhwOc9ObR7dQnYxcu",
+	"lMdQNtSNv2V+H8NbzGFOHa5GZo23OTueWDkX/BkwBHGdN5wJidcQRqKZ2+0Vo9yt+9Wru6vNyq/Jf1ti",
+	"EyjwFhdHRGelUdXxCNwheXW8qbz85fQDviKmTZ4ldf8uCVau+g0SFkVLK5cZMWMHiQQt7zyCr8eN3BDG",
+	"0UUCwuwBHi19ICS+rEU/fpxv0Zf0kY2YLgmJUMZvXghULY5NMbENRwuDGsHcUBgSDwIDiv7cpBJvIqv8",
+	"nqWFgRFRW0HGXAodT5nFKAnYniUhKTcsnlocZ76/6JdEDVyj2zKLTnnjFo+eY0bZR/SQx1geYbmEfb8s",
+	"WnSWoEpR7CjXkqqqu3QLrWSzvlGT/JvIDCkw8AokJsutpr9CpIF+YtnxHBZ4seB6jscCjiFPy4zIfpOw",
+	"YNmjCch/QIMhUyu5fM/A0dal5i4qcHuW8RjliwIvIBh55N5s5bhZu+Y3G0e5PIkWfgnTFI/BKZ2/wTiP",
+	"eYhizMlkbWWTyqSCG8RDxpt7wo/GfiW7S7HGHgsTAHn7AWcDh8Jko0RjsaNQREgFEUHVebUwmaRsR9pA",
+	"Mqz7iM4TPky7iFsnMYAvuey58U4lks8xrmVmCPGm8vrTkX5uMFfosahUPL3AqDiiGkT7mYXYyyiL3LAV",
+	"r3OVmPE0c46LpsQdsxbltrITuXZ9Igl8stFDoE4GJP3MdGiX0a/RTTDCqhqgJaZyZkeWpHmiVZ/2uRjX",
+	"kYJbH4khxxwtIgq5WYfFwnKpkC8Wiy0qsVaJMAs2StwxFbu11VXPSnJSzRQRoQBzA0SZXIzPyzFWhD4t",
+	"V/iy5bWbTXY6pPuHmwnih/EP8bp6wz7taKg+bdfgdmYwZ7nzJbyOjc80v5v3/I8wpuKqiN/InaSM8JAy",
+	"/1GkxtTdVceS6x/PDCZXFOZ5oTtJGYeuRqPx7yAml39l9t+9ALKEJGq3ZuUC5EqjSBE9ui2sg10FDNWR",
+	"2RYQ1JAOWJ450v2OODxQ28KEicV7kB6kOs/i/fEbBcfEHPz1fzi77bNYQhHUKAK/bn5287rEC/ZVkZJ8",
+	"1JzX9ELkxZDIKX7oBX6zuUw8wwwxJgj4pOstfh64BkScvWb5UQui0WampkRk/3+bnWAzyzlkIakHJIdf",
+	"oleenQ8LHKZvXRRPBZ+WYkykXR6azbwniKPoBXsmrLTlUMoHYmcmWrhin/qLBVLwEcHDHs1jZL8eRRTK",
+	"YKGcPK77TbduSGaCsMIwD+0wow8tNvEW3ZXS8CPhAe1KbedQB+UhPdRsXVVUy2LzFw6zcIYcFQEBCmxg",
+	"CbyXQK/8u/ClNxgeV7Y6VrX+2RlzXb5J6QWKHNgV7ImftxoiawI9h7mL+iIR/vmh/f8KsbMrGNmX+8Zy",
+	"axrjtrxo1H36jO4IBDkuc1p27IwjtAM3WrkBZ5uN9X3iBCSAUh7w6TZ++kgIJB9/cTPl8p6poaMizCTT",
+	"SLkbI7EhZGALzMzcokT71jlhArMtzQJmW9wAZlto/zqfMlQcKq5PJcaBdibnPPqEYSMTbkTqANTOYTFC",
+	"6hAzURLwyIP4Md0WCnPGZIy33Zd60EAJ7DAo4Y9xQMYA+57ioYk39XEwX7qIt4BpxA+wullPCGbIcgdo",
+	"oJGmexZXgRiFKIH7ljDipShqZVxMOZvccqL5zC5XyBRIT+Pc9c9u3GTpOXgEw/OTVt5hwe0RxolO1jS1",
+	"g4fmGVutbQzyejTnxRvK6/G2bZHw0o8f4EMvTb81adGfUq/j12XWGJ7+3DjRQ73AzCHuRTrKxjp3afrC",
+	"+UpbsYqRrgs+woMbgaJVu3L9mnXlrhv5Vrjkt8CzTgJmLaldmJyenEb7Z4t4TsutzdTewq8wxWkJKXdq",
+	"8h5pNifueP49b+o39+6Ek7/hts9FJvXJpFSwZ9b+hURfkGbzE7j843t3wo9DnwEtYw74yIvT00zi9iIu",
+	"qDqtVpMnEkyJxyd11UqC2CASDmduyBvaZjGSWhgf2MeE9tqje7ZFu/IzRI/KD32bqbpd3BPh/Okx7OTl",
+	"e/je2xYzJ/bi7+MfUsTEjgBIsCo41ma+vGXXwvbyshOsiARVOUa1aGA/qVnEYQIOnYjwojsi4CJdrOgc",
+	"rI1tzX501frnty/883mMLxOP/DWE20rS38CQ9j4WCBGkj6NlVY4AMFkyXNG+X2m5SQm4l93zSkJTquJc",
+	"VnxatU3MscuKO9lWvKEkmQ8VBx9TVDHcJUk9ix9PwisuTV84ttOrJySZD3EP0ItLlP3EXsbH8tYpj2VH",
+	"tQgxBU5CLA7p7enpUxzSH7lJ8D7fui09ThCDlIBaGM10MiSoSyZfZrxm3Fe2qpMqlkBRgifjzSyIJHUK",
+	"8UBNWvRPmliAFs0ex/tnbHjAACDw/j48BIsmdPI8a6y216pda/mhgRyv+6GBHlGQfN9vrBzbDhmSild1",
+	"SVFUsdHB4PhIKI0BRTTPOP524qvgRDR9ykTETiO3AGj+gTG+lOHLpel3T3FIvyiR2kDwHeC79DDFGTCk",
+	"A32KPYsZeuJHNoY3Y3CzJZQV2mNZ5xIaem8MZP5JEl4mBj5TRm7SSkKpZUBpOku4K6LO8dzGj3kQq1ls",
+	"mfoGYuZWp3gVUtSlOW6mQxk02NZqcSBWsyoCW1pAvxD+0Motju8PykAZeX9HD5jwqRTTgI/oaRrQLtcJ",
+	"IeQFzwlOAqR5JvqXADyUX77Cp2drNa+/NJ+Y5JIp+YDa6q0MVE+fEVQbCGUMjSXQeOlMoJFpEYCIe0xP",
+	"emNQ7e8YrdbJIBqv9KZgmnhlHjJJ82GrHeV5ZFMlLY0x+tnCPLaM2hfKr5IxlKlnaCMeHRl15zz6M3oC",
+	"mLEjD++GrPYGbgKz3OFj4zX+HDCb2NrMOM1B5BgmGODMweFwyOBSQ1MjULazOClKb74cSh6/NJ1nbK4k",
+	"Up8qTkv+rB+gzligHnONMdco4RpJvT0uC/NUslR57FJ2EVa2xknQC89SNqyeeYhjrWTP+7PCjbYSHWBM",
+	"9WOqHzWqN5xUjeJt3oGA2Z+VTErh9IRfMFG0CBkCIqP6clTcRBU/iLeY3Livxe2lG6eY67WDQRMjefQp",
+	"pJqLZCJLDd1GDjCxHRxvIoiQCax9Ub1NCIliIJUVYp7LMYKininLZPTEvJ9FEX+mUygRwWNBbwz5Y8gv",
+	"gfwnCs1wUU+2xaiA4oFmqKwKd8HrYf+L1xg3zGvcNab3Mb2PnF+Yc6cNpHXaKfAlZHwehXCQiHRG6+C/",
+	"sfIi6QQMFMAw6gtbVrHiWvw39DWn3Q59uisCWiYtfKf13lFTPmbmvHjdSMWHSUmkxEDJbKciwmrIiqIg",
+	"XPJaQnSvqlXvxoiKesZcnNGT9VKNBaVhjyVpjKW9MfqP0b8Q/QUKI6DpKFxo2ItEGP2UTEMoM+ol4f54",
+	"xwkCRzp1wrTcx5AlMabn1zuuzkwx/ODY0nGpxGeD4zAvqTBzzIyRHym6mvoG/lvNl6KemOLt4ViL3AIh",
+	"pRTlYYoc4ExxtEMlLTgTeb6BF65bvKOCniXJVMfLcx5jf3SHzZeVLoOI9HhNZKbDOhW0KBW1aPbVbuNJ",
+	"nH+uiKXDzSyrNZESswwts3nh9vyG2RVa2p2QTFaUL3XKotmpIGyx038s3o3ZwQiwg5958xYuQlVG/4QE",
+	"RG6xAGyeUQtMRXO48uR1tfZEhn1AUYZw6htWb2d1SrThNPOOv9GOqG4BmrKs9SlS3g15XJZTr5MwnNBz",
+	"tmCoqfppwi9EO3JuohyUWulbhJviozizMPMhQ+2x4s7WxdwBUn3Dz3GZzKyhRANnt56Y+p3t/nrKAK9U",
+	"1crFdtjQ0Qil6WNYM8tWH6SOnChoBycP8pSQ9JVxSxs3ECgL32J4sRE/lo8Zo/uoKe9GwTd+9Fqq8hUj",
+	"cu6XFd3LpvPE6/xSbM9amLhzOSODaR5/Q9Cl0l26CqNicFPJlJBCb3HnS4H4SccIqYhaIUbofyaLl134",
+	"vVEQfvv57T3yDuAYRccoOmIoWkxnilieX17wyAFQvNhATqjTk6RkrZY9zatGyK/43oDyrLRpHyAtPoWi",
+	"A/CeSdFdbVJ0VwvP8zxhpVV1vDFjoUtvXytooFbPnfMwLfwpBq33eRy1ddv1GoD1n35w5TrU1onvKxOn",
+	"Q92ApIjrcH3eknJhbFd4Bxk/4UQMg0DEEV23+0VxVe3opHJI4dFn5RbDVxcQzt+VpgA8rTen4DOH5IvT",
+	"F4/fMpQtLGcGIOWwK+xFpKexqqe8mqNZtZ606P9AjbFvaTXWrPesBacZEltpeKmU/WRhhHC45jw8zokK",
+	"KY2wl5m7GeL6eol8VbWMHBCIMI4m1VvjNf5E1pDCZDad84yabWIbxnnKjr+mH6fqvrfgBstAHWM72ejI",
+	"ABlw7yNng1NEB5xmMVc3g/KIpucAOM9ruZtJhUJZM2kHy/lj6V82xYunmX78M5Bi/B3v2UYPk3p5MMEN",
+	"uiNKycUPVLUcHfiCWcgibkBNiFYbep1TrR6sbNOkKPiDpPMl555opFtjVZuXiNMgrNPmLImClYkrC5Gx",
+	"tvD/lnSI3CZRlkD4AMZJB3QnEyYizxozCipDY+03k6XOFNtafeXkLF2e+kM+r7ESMWpDRsr0rI+/uJmu",
+	"0SfwnA7Sr+8pNSsgyMNy2pE/H5BFN4xIYMtqtokIslfS8KBcCEmU2nwhRJfupprYaa48ErIdLbGmdCck",
+	"pugd71a5pHJCgkm6v1FezIVmNx6KigTxJsOqMafK41SvtPqVLUezSffidUnk6wxOubnfUNcTqtH8lDga",
+	"UPTKeCMsdMz3BHxo9a5tQ0VQM91eaTaPQLpw9RlTlVLbp4S4xqf5NE4z7eLjHhjr08YPJi2+Y9X9bvre",
+	"8nPNLUmP43VD+jlrUKEfb+iiPlV3ms3bTv2OYmjNtkZhj8eCvnCGuCm4w9oCwo/0qTQSa4UgWdDwhkmA",
+	"7WAxN9TE9GMheTE4+WTfFZXxwqKKRvOsuGWRoeFIhoU+D1Kg3XhLBReZ5L/GUEkULUCXZJ9HJzAh257z",
+	"FMxJz9ssnSfSq3VOUTIvTb/FnonN5O9CRVWXNM6bjBzcHt6Olj5zG/WrYlczRnBDT46CHTBamFilVYyW",
+	"+apNgpUkXAbLFxeFy5SUZ00PD1v8M3NW6tg2oeb15SQKiXde4r2jWf0i/MKS5ap7ss5R3ffvuMSCB83j",
+	"K/Lmgz++xIRujQ0/1Qw/fy037KDhpoNqYXIYRkxIFPjBzy0mihobmvMTeM71sEnofHIUz58Ba36SBSks",
+	"N4pGYNYrVhjN2PwE+KqKdfxd/AM94B9Ehc94g0/nrbOdThWzyKm6Wv7I2JNqBf/s2gdX+Uh1pZZ2dWP+",
+	"q1hyLRtnrvbGfiT5tbYgLeJd+8C66nseqUdG6QXZQL7o8oQ/a8BJNJ0xnnWebExa9GdukoBvGY0zegZS",
+	"jh/gYwaJvRi2J8NQ5rxzv46i1mdec8W2bkBmjxuR9z51vj5vcfGCW6GUh+QIZuXMHvs/pJWOt6YvVl2Q",
+	"xH+fsyS6iexTn52xElFR2u7yxD+T5SsRBaD/z8RVXNfsi66m15uxev5n0oc/GUXx21bH9H+q9P9XWc3L",
+	"TPkw3fg+80ky45rMQDRI1MU4wdX8AhersC+WendFzUwpT+bFce69RDchUB9UPUuJcUd9ILrnzy+gaDUv",
+	"xNIZrR8gmjmZ9rkrG68MjeGRJd5S3ku2dlL1I7Q+t6PmN03q1XHHdydVnfyNN1BmWw2L4v9qY3aZ3WLz",
+	"wnvxDyw5U8Y1S7vUGciKJ9AM7BXH5p9kaLX0V0EW+Ea6Nj8aPLI2VCZBsWxsPKOB4ZQMdcttuli/5sEu",
+	"AG6dHJQu33p1nqSLdxdrk8PJxEaNaRckROakXIfsK8URyYNlhN/28WQRgEotuHbCOUBaC7BXPgJl9BR6",
+	"OkhftM96iZ6JGT0VeMnyRAS0igbV67ltGF/VKICxq/6MdHJ22IVdvSBz9NwRuwCez0V9FrdUye+m93A7",
+	"aaTNdGs9q1xLpU+mmeKU1pVK8x2tJ2W8NZEDxrIn69gJfzx4+9qo6waNl3eO1kIXpU2pJNWcDpWlizcy",
+	"i5fy/pQAhgh0fAHguMrvfI0ltZxul2b7VF4Ua9ZgoTiu4011NzctyQbizUJGMBb7xjBUCkNP0v6bkwAk",
+	"bjUzS0IK+txurxRmbcjqYMiBjfVn9RK1OFge7qu2Gzi8LBt2psIR5EP/37/JngoFFr332ytHzom71iDL",
+	"LT8iXn3lE7JyYgnO77dXzggSq8RTKforo70hP4TrY/FohKLpsdWw0dX7jO4wRwqP7tkwNjMVgKAEH+PT",
+	"4nXFvM6L24iGrCNYp+ysuotx0AI3FdS9PkhCtZKKsbQn9kDAskgcPURnj9BDBjwvsi9bkvWRBjWvDB1I",
+	"xWYHDJSwNWx7FJKgnVeQ7WXCC+1vTA2KeVW3GWBF6RDEH5PeXqJk0g4aP1m7GWb4wMMdb+pcbeobSGBe",
+	"1ZzqrYDUnSiJf8oCpOj6RbtcEOF8rY9S4bqVtDy+3V5RC6Fb71kXZtRajVs8pG7P+pcPb7JxPmWVpUDK",
+	"3BXBjIzG+9y4Az/15jzk6tAwd53Lns/5mB5B0OQaclBMbOTRw122ACxIZ4djRYevEZ4nuLqLnWo/4Kvg",
+	"+p5F+3Pep653Z8aaa09Pv1UXE8NP5LIVkOZ7c7WwjQHJfjDB+xXP1fKd+e+3V7CuZZWqVC67MD8qzRBY",
+	"9yKMfsxzxzx3zHPHPHfMc4+d51rnWDIA55oHdKjawutOEOVHtf27YlzZ0Uu4iMDnRLEEVy30+1dSavq0",
+	"d5md4QPMWmNVGC3sqHKA/HrNUGqAnS2eUDeMf4fgc5jU38pnbVdhNifIT/D5pjPxI46RFyh4s4Ga/v14",
+	"8ffNI271LBXVtFFpeErWAqrcyMhsKeJ9iDjByuyTlAWpKwLn2DB7IrOIx0KmfhXOT9zs7XiT1Rpgv2yz",
+	"6UHLSuvC9HRqMMxSpRwdURc63/gENHoNF+OEKnA0GuIVZ2RJqoZCWhXTVCv3UTaEZw6PtOOz41N0XlKl",
+	"w8co/JpKwW8cTyjtCC8JJt4wcgbF1tIgTRKRrL/yA/xeRdCTMxPcGil4ZGFBGWgcQ8erDB3K8DLSyhuJ",
+	"ISX91xMEUc209SVSv5MqKZLphSM1NJHw1I3X4scpWMJtEPLcHguDBq6OhgWWBjzDg16lUxLuYjYGnsy+",
+	"H2/YRepjkuXEq1uviUbrc15qjkm1F/C4xutw03a8yccYb2gvxaPExHC2cWLKCMc2Z1PD9EoIKwmK0kAb",
+	"PKhbWBitS9PvQvVpnlb/EA0hchVRA44fsvGypUnGBAHDLK9dxbQhPuN7rSBqKhI5q1D36KHN4JDlMx0y",
+	"E5qMUZzzdJuLWkwHX2QBn5kny61ohU1woHu/95QtLZLcxVk7SebA31FIrJlF1VfsLGLV0rxL2HS0+BFj",
+	"kU9pChrbj8/IfvzusZ/eCmHQEif6KXC3tc4xtFcMbW8mq/xJX4R8Adv1FvySwtHX4JITRDR4/tjB9UaK",
+	"3RJoLDiHMwFxGq8zvcpJGnsHH8hULGy+MJAkzPJ9HlsaM4RySHa2qSdzT/ST7vPAELKS6p4CAYgiRYUB",
+	"hqKmPRcE2cEXkXbplneQ7mnRn5U7vhWNsoayBo0i3oFU6JGvo6vtIPQDLs1zlxDEyvLSZsiYJOHTDnTI",
+	"Ah8NnjbQApRUSp6ZqNXoh4JE66wjyjPOQkURZ8zWYI/BwP77IpBh0qL/C32Fj2A2IMJC3AWwWylcyxmy",
+	"7DduKxbBGbntthiyYovO0rpDv6izkOsMo9nn1vSnYqtziw05EVn08ZvCyIcMuHRon08HDJbYH+RbQcNd",
+	"tfZuEk6aN4Zl17seuHVSS9UEcpfby7WZaTubJpQ3oMSC+nIDcr5+6QE9kacoSwWXrX/834l/HKBLkek+",
+	"G6CfiSZE8WNZ95ujINcr2Xx6qb3ui6Zxz1kqWIfuKk/KmWLoB5E2vQZZcNrNqDbDrrBrxIPJfik+TvD/",
+	"W3xhJtgftyoUoFJpOEu+eymCiTfzxlzHZxzxpP4N1+MQaxxUfVHTXXZzVufitA3Hg52EC9PTdnIuLhjO",
+	"xclGAAX1pevOYpGUrMCs3jn97JOSehbmSSUQKus4IduZX3CbEQnOJ3EXCqTLS9mROP/KR+X/qG6OxY5r",
+	"/FDcljBj3gi8RC5PellXsXBzwh4NC3dxb2ppAR07bo71+ClzS8FEHleRx7LlhOE9P2iUJotdFxeeZHs3",
+	"8ZIRToTQytVr3dXtChVoXpUcLy1SSm97Mi6be5Jlc3/WGphp6y5K5Cp9ggub8CRSM0rTckehYKutZ3jJ",
+	"8iAGZJha8INFv9jNIpwGDFp3uTt4DWbBCqiKamRl1XItPI6shKwVP8TbtoWLAZ7OXACaXXCbBbQn3gq6",
+	"TfvSn6T2RMhZLZBiC4z/ApQ+YutwMvjHHv5C+HfxVPFPuKYIs1oX7qZtSaNQoubrJfew5gTc+ggsIKNo",
+	"9nvV61nwuSSIIlebm06SgkZoLNlWnWkCfYzAEJCQRJUFh1m8+qTKqIUkeqWFh1dEMLCz2db0gFluikPm",
+	"E7ki6TPwatPW37Usfk5dovGdLjKlqYybQiUldo7G28t5t+j+Ukqcs+LCEekJd+FUyfEPaicltb3NwC4D",
+	"yqynVoRoGbncaPqz3h2BvpocNdI9BaQT8FWGiL9pgpGo7maJWjKyVGpPT4vhtVV5xI2Sd5JETeefPlHM",
+	"W0BBSLzGVd/1SqHghrhwROsjiPGNiySM/dnjhM3KiLsRP1TQdhRSN38cZ2C+fMRB3Xe9cAbA3RAilIgf",
+	"XCzVuEuyZDKc0tBfSWMhIWTuh/mhBD8LqTXektwL/leCAVjOpNKRaIBl8bNNzaykZdAOik9dw3OGskCv",
+	"zL1MV6aGnkhZ2mWeK608l5o+Co42RQiPt+ghp5mhPJxbYix9UWYfkJ4bn5DJo1s0aQvSZyWNFEk9N3Dg",
+	"hljq0+i/z19Wqfn+n9QgDF6dQldXxnbhk7ULJ3qh1hnwqSjbmteJnfX66zJbW75u3svvzi7of+ob/te1",
+	"Ripdp6wmOisvksxALX4tiILFZ/fiH7I9DHMavOm0tR4/4g3KEPt24w1bZHLuJGXg4i1Q6kQgVU/URBP3",
+	"wQuNKZwyBUlQ6A2xFJWctKFydb6ndsEPlp2IRSC8c6l2psEJ5dKuBvqqReKsItEN9QF3zEVdRxu4TldM",
+	"TPFuXTxMwviFOGbe6NcKa7NVoBWJ4DFzanDwORSttXjW3jpP9hkIe7qpa2uCrNhALCwJB7nJLjoNiUAT",
+	"NV9GLlCgG0s3sihKHdF5lx+ty4tiyxwLEyd2wF9ELj6a0MGrkWVlCjvPifxLUrNV6VGcNCXtZuuR9SyY",
+	"nx+4v8VdsM6xSVstJ5qfnJw8z4vD4EO06egBxHQ/Jb6D1G9nk9/4XmxiBXgrrPstEoLU8AC90ptWRk+b",
+	"tPRZDXnqoF7BFPWcPh2wYNFddAVsiqLzauvcOc/cO5d3UzsUeK147TKCliV7xJZsf4E/XMGjE4gDCogT",
+	"EW0pz8iBwEbSSEFiUQN3Vp3vOaeRUXPpcWUAgK3L5WhRI5gbC4ZJ618mClupNkaMDHmnSyTDwzFQn3QT",
+	"bZFQKf33JuLVi16nLBrcVIY1IROBDjNRMMlAmi36GdFk6hv8P6Pw5ShHDBpuslsqKUaRvPZ1UYt+0Vs8",
+	"pRt7japCpBiz33CF6Betk5umDqWVoewGv1bw81MyvRcEHxVQZJcKQ3+KzLwyvR9lhQYmJiUSZpXWCpct",
+	"HHI/I4VJ56ouEaZEsjnPZNJSez4IE9o2a91ZVF7fNlq/iuQt2XbndLpzXPUbZ9XYZ5bU/bskWIEhhC/Y",
+	"m6Ob6UR4xqCrdQ3Pa8ggkIZ764YjiMGn6SPM3V6BvK9Dz8ky4U/NemQNOPLOvNKbTGbZHrnJVRaoG27o",
+	"3G6S0tARCR0f8BteX4SqIgHmY9MwXhebOprolH/ECjq9vrmFEUTn3NxIzaotdUetHWVyRsC+JOCl+3qK",
+	"uC8As9kej/h1SXuvLMISbGBYHWBZw8Pa69ZbcSzmvLlijtZY8QXalUEbE7S9anRcPWA2IV+FQu+SwF1Y",
+	"wUDBUuL8V+XakxF8lDeMrtjDoyqNAZW21G2qxDxzD8SZC0emZBfd/vOGpLqYmw6yDMDS1JbaaurZRjwg",
+	"wV1hJW4HzdpMbSmKWjNTU02/7jSX/DCa+dX0r6Zrq7dW/2MAMmdXXhgwAQA=",
+}
+
+// GetSwagger returns the content of the embedded swagger specification file
+// or error if failed to decode
+func decodeSpec() ([]byte, error) {
+	zipped, err := base64.StdEncoding.DecodeString(strings.Join(swaggerSpec, ""))
+	if err != nil {
+		return nil, fmt.Errorf("error base64 decoding spec: %w", err)
+	}
+	zr, err := gzip.NewReader(bytes.NewReader(zipped))
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing spec: %w", err)
+	}
+	var buf bytes.Buffer
+	_, err = buf.ReadFrom(zr)
+	if err != nil {
+		return nil, fmt.Errorf("error decompressing spec: %w", err)
+	}
+
+	return buf.Bytes(), nil
+}
+
+var rawSpec = decodeSpecCached()
+
+// a naive cached of a decoded swagger spec
+func decodeSpecCached() func() ([]byte, error) {
+	data, err := decodeSpec()
+	return func() ([]byte, error) {
+		return data, err
+	}
+}
+
+// Constructs a synthetic filesystem for resolving external references when loading openapi specifications.
+func PathToRawSpec(pathToFile string) map[string]func() ([]byte, error) {
+	res := make(map[string]func() ([]byte, error))
+	if len(pathToFile) > 0 {
+		res[pathToFile] = rawSpec
+	}
+
+	return res
+}
+
+// GetSwagger returns the Swagger specification corresponding to the generated code
+// in this file. The external references of Swagger specification are resolved.
+// The logic of resolving external references is tightly connected to "import-mapping" feature.
+// Externally referenced files must be embedded in the corresponding golang packages.
+// Urls can be supported but this task was out of the scope.
+func GetSwagger() (swagger *openapi3.T, err error) {
+	resolvePath := PathToRawSpec("")
+
+	loader := openapi3.NewLoader()
+	loader.IsExternalRefsAllowed = true
+	loader.ReadFromURIFunc = func(loader *openapi3.Loader, url *url.URL) ([]byte, error) {
+		pathToFile := url.String()
+		pathToFile = path.Clean(pathToFile)
+		getSpec, ok := resolvePath[pathToFile]
+		if !ok {
+			err1 := fmt.Errorf("path not found: %s", pathToFile)
+			return nil, err1
+		}
+		return getSpec()
+	}
+	var specData []byte
+	specData, err = rawSpec()
+	if err != nil {
+		return
+	}
+	swagger, err = loader.LoadFromData(specData)
+	if err != nil {
+		return
+	}
+	return
+}
@@ -0,0 +1,4 @@
+// Package api содержит модели и интерфейс сервера, сгенерированные из internal/schema/schema.yaml.
+package api
+
+//go:generate go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen@v2.4.1 --config=cfg.yaml ../schema/schema.yaml
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/linemk/avito-shop/internal/api"
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
+	"github.com/linemk/avito-shop/internal/service"
+)
+
+// ChangeRoleHandler обрабатывает запрос PUT /api/admin/users/{userId}/role.
+// Доступ только для администраторов проверяется до вызова обработчика (scopes BearerAuth).
+func ChangeRoleHandler(log *slog.Logger, roleService service.RoleService) func(http.ResponseWriter, *http.Request, api.UserId) {
+	return func(w http.ResponseWriter, r *http.Request, userID api.UserId) {
+		const op = "handlers.ChangeRoleHandler"
+		logger := log.With(slog.String("op", op))
+
+		actorID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		var req api.ChangeRoleRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		change, err := roleService.ChangeRole(r.Context(), actorID, userID, models.Role(req.Role), req.Reason)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, toRoleChange(change))
+	}
+}
+
+// RoleChangesHandler обрабатывает запрос GET /api/admin/users/{userId}/roleChanges.
+func RoleChangesHandler(log *slog.Logger, roleService service.RoleService) func(http.ResponseWriter, *http.Request, api.UserId) {
+	return func(w http.ResponseWriter, r *http.Request, userID api.UserId) {
+		const op = "handlers.RoleChangesHandler"
+		logger := log.With(slog.String("op", op))
+
+		changes, err := roleService.ListRoleChanges(r.Context(), userID)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		resp := make([]api.RoleChange, 0, len(changes))
+		for _, c := range changes {
+			resp = append(resp, toRoleChange(c))
+		}
+		writeJSON(w, logger, http.StatusOK, resp)
+	}
+}
+
+// toRoleChange преобразует запись журнала в модель API
+func toRoleChange(c *models.RoleChange) api.RoleChange {
+	return api.RoleChange{
+		UserId:    c.UserID,
+		OldRole:   api.Role(c.OldRole),
+		NewRole:   api.Role(c.NewRole),
+		ChangedBy: c.ChangedBy,
+		Reason:    c.Reason,
+		CreatedAt: c.CreatedAt,
+	}
+}
@@ -2,61 +2,185 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"log/slog"
+	"net"
 	"net/http"
 
-	"github.com/go-playground/validator/v10"
+	"github.com/linemk/avito-shop/internal/api"
+	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
 	"github.com/linemk/avito-shop/internal/service"
 )
 
-// AuthRequest представляет структуру запроса для аутентификации с тегами валидации
-type AuthRequest struct {
-	Username string `json:"username" validate:"required,email"`
-	Password string `json:"password" validate:"required,min=8"`
-}
-
-// AuthResponse представляет структуру ответа с JWT-токеном
-type AuthResponse struct {
-	Token string `json:"token"`
-}
-
-var validate = validator.New()
-
 // AuthHandler – HTTP-обработчик для аутентификации, принимает логгер и экземпляр AuthService
 func AuthHandler(log *slog.Logger, authService service.AuthServiceInterface) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		const op = "handlers.AuthHandler"
 		logger := log.With(slog.String("op", op))
 
-		var req AuthRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			logger.Error("invalid request: decoding error", slog.Any("error", err))
-			http.Error(w, "invalid request", http.StatusBadRequest)
+		var req api.AuthRequest
+		if !decodeRequest(w, r, logger, &req) {
 			return
 		}
 
-		// Валидация структуры запроса с использованием validator
-		if err := validate.Struct(req); err != nil {
-			logger.Error("invalid request: validation error", slog.Any("error", err))
-			http.Error(w, "validation error", http.StatusBadRequest)
+		// Вызов бизнес-логики для аутентификации
+		result, err := authService.Login(r.Context(), string(req.Username), req.Password, requestDevice(r, req.Device), clientIP(r))
+		if err != nil {
+			writeServiceError(w, logger, err)
 			return
 		}
 
-		// Вызов бизнес-логики для аутентификации
-		token, err := authService.Login(r.Context(), req.Username, req.Password)
-		if err != nil {
-			logger.Error("login failed", slog.Any("error", err))
-			http.Error(w, err.Error(), http.StatusUnauthorized)
+		// Пароль верный, но нужен второй фактор: вместо токенов — токен ожидания
+		if result.Challenge != nil {
+			writeJSON(w, logger, http.StatusAccepted, api.TwoFactorChallengeResponse{
+				ChallengeToken: result.Challenge.Token,
+				SetupRequired:  result.Challenge.SetupRequired,
+				ExpiresAt:      result.Challenge.ExpiresAt,
+			})
 			return
 		}
 
-		// Формирование и отправка ответа с JWT-токеном
-		resp := AuthResponse{Token: token}
+		// Формирование и отправка ответа с парой токенов
+		resp := api.AuthResponse{Token: result.Tokens.AccessToken, RefreshToken: result.Tokens.RefreshToken}
 		w.Header().Set("Content-Type", "application/json")
 		if err := json.NewEncoder(w).Encode(resp); err != nil {
 			logger.Error("failed to encode response", slog.Any("error", err))
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, CodeInternalError, "internal server error")
 			return
 		}
 	}
 }
+
+// requestDevice возвращает метку устройства для refresh-токена: из запроса или User-Agent
+func requestDevice(r *http.Request, device string) string {
+	if device == "" {
+		return r.UserAgent()
+	}
+	return device
+}
+
+// clientIP возвращает IP-адрес клиента из RemoteAddr. За обратным прокси адрес из
+// X-Forwarded-For подставляет middleware.RealIP (http_server.trust_proxy_headers).
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RegisterHandler обрабатывает запрос POST /api/register: создаёт аккаунт и отправляет письмо подтверждения
+func RegisterHandler(log *slog.Logger, authService service.AuthServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.RegisterHandler"
+		logger := log.With(slog.String("op", op))
+
+		var req api.AuthRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		if err := authService.Register(r.Context(), string(req.Username), req.Password); err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusCreated, api.MessageResponse{Message: "Registration successful, check your email to confirm the address"})
+	}
+}
+
+// VerifyEmailHandler обрабатывает запрос POST /api/verifyEmail
+func VerifyEmailHandler(log *slog.Logger, authService service.AuthServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.VerifyEmailHandler"
+		logger := log.With(slog.String("op", op))
+
+		var req api.VerifyEmailRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		if err := authService.VerifyEmail(r.Context(), req.Token); err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, api.MessageResponse{Message: "Email confirmed"})
+	}
+}
+
+// RefreshHandler обрабатывает запрос POST /api/auth/refresh
+func RefreshHandler(log *slog.Logger, authService service.AuthServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.RefreshHandler"
+		logger := log.With(slog.String("op", op))
+
+		var req api.RefreshRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		pair, err := authService.Refresh(r.Context(), req.RefreshToken)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, api.AuthResponse{Token: pair.AccessToken, RefreshToken: pair.RefreshToken})
+	}
+}
+
+// LogoutHandler обрабатывает запрос POST /api/auth/logout: отзывает текущий access-токен
+// и refresh-токен из тела запроса, если он передан
+func LogoutHandler(log *slog.Logger, authService service.AuthServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.LogoutHandler"
+		logger := log.With(slog.String("op", op))
+
+		userID, ok := jwtmiddleware.FromContext(r.Context())
+		token, tokenOK := jwtmiddleware.TokenFromContext(r.Context())
+		if !ok || !tokenOK {
+			logger.Error("token not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		// тело необязательно: без него отзывается только access-токен
+		var req api.LogoutRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			logger.Error("invalid request: decoding error", slog.Any("error", err))
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid request")
+			return
+		}
+
+		if err := authService.Logout(r.Context(), userID, token, req.RefreshToken); err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, api.MessageResponse{Message: "Logged out"})
+	}
+}
+
+// LogoutAllHandler обрабатывает запрос POST /api/auth/logoutAll
+func LogoutAllHandler(log *slog.Logger, authService service.AuthServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.LogoutAllHandler"
+		logger := log.With(slog.String("op", op))
+
+		userID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		if err := authService.LogoutAll(r.Context(), userID); err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, api.MessageResponse{Message: "Logged out on all devices"})
+	}
+}
@@ -3,56 +3,90 @@ package handlers
 
 import (
 	"encoding/json"
+	"io"
 	"log/slog"
 	"net/http"
 
-	"github.com/go-chi/chi/v5"
+	"github.com/linemk/avito-shop/internal/api"
 	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
 	"github.com/linemk/avito-shop/internal/service"
 )
 
-// BuyResponse — структура ответа при успешной покупке.
-type BuyResponse struct {
-	Message string `json:"message"`
-}
+// buyDeprecation — значение заголовка Deprecation (RFC 9745) для GET /api/buy/{item}:
+// дата, с которой маршрут устарел, — 2026-10-17
+const buyDeprecation = "@1792195200"
 
-// BuyHandler обрабатывает запрос GET /api/buy/{item}
-func BuyHandler(log *slog.Logger, buyService service.BuyService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		const op = "handlers.BuyHandler"
+// PurchaseHandler обрабатывает запрос POST /api/buy
+func PurchaseHandler(log *slog.Logger, buyService service.BuyService) func(http.ResponseWriter, *http.Request, api.PostApiBuyParams) {
+	return func(w http.ResponseWriter, r *http.Request, params api.PostApiBuyParams) {
+		const op = "handlers.PurchaseHandler"
 		logger := log.With(slog.String("op", op))
 
-		// Извлекаем название товара из URL
-		item := chi.URLParam(r, "item")
-		if item == "" {
-			logger.Error("item parameter is missing")
-			http.Error(w, "item parameter is required", http.StatusBadRequest)
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Error("invalid request: reading body error", slog.Any("error", err))
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid request")
 			return
 		}
 
-		// Извлекаем userID из контекста (установленный JWT middleware)
-		// Предполагаем, что функция getUserIDFromContext извлекает userID корректно.
-		userID, ok := jwtmiddleware.FromContext(r.Context())
-		if !ok {
-			logger.Error("userID not found in context")
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+		// Верхняя граница количества в спецификации совпадает с service.MaxBuyQuantity
+		var req api.BuyRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			logger.Error("invalid request: decoding error", slog.Any("error", err))
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid request")
 			return
 		}
 
-		// Вызываем бизнес-логику для покупки
-		if err := buyService.Buy(r.Context(), userID, item); err != nil {
-			logger.Error("failed to complete purchase", slog.Any("error", err))
-			http.Error(w, err.Error(), http.StatusBadRequest)
-			return
-		}
+		// Тело входит в отпечаток запроса: повтор ключа с другим товаром или количеством — 409
+		writePurchase(w, r, logger, buyService, params.IdempotencyKey, body, req.Item, req.Quantity)
+	}
+}
+
+// BuyHandler обрабатывает запрос GET /api/buy/{item} — устаревший вариант POST /api/buy
+// с количеством 1. Ответ сообщает о замене заголовками Deprecation и Link.
+func BuyHandler(log *slog.Logger, buyService service.BuyService) func(http.ResponseWriter, *http.Request, string, api.GetApiBuyItemParams) {
+	return func(w http.ResponseWriter, r *http.Request, item string, params api.GetApiBuyItemParams) {
+		const op = "handlers.BuyHandler"
+		logger := log.With(slog.String("op", op))
+
+		w.Header().Set("Deprecation", buyDeprecation)
+		w.Header().Set("Link", `</api/buy>; rel="successor-version"`)
 
-		// Формируем ответ
-		resp := BuyResponse{Message: "Item purchased successfully"}
-		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			logger.Error("failed to encode response", slog.Any("error", err))
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+		writePurchase(w, r, logger, buyService, params.IdempotencyKey, nil, item, 1)
+	}
+}
+
+// writePurchase покупает товар и отправляет ответ. body входит в отпечаток запроса для Idempotency-Key.
+func writePurchase(w http.ResponseWriter, r *http.Request, logger *slog.Logger, buyService service.BuyService, idempotencyKey *api.IdempotencyKey, body []byte, item string, quantity int) {
+	// Извлекаем userID из контекста (установленный JWT middleware)
+	userID, ok := jwtmiddleware.FromContext(r.Context())
+	if !ok {
+		logger.Error("userID not found in context")
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	// Формируем ответ заранее: при наличии Idempotency-Key он сохраняется вместе с покупкой
+	respBody, err := marshalResponse(api.MessageResponse{Message: "Item purchased successfully"})
+	if err != nil {
+		logger.Error("failed to encode response", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, CodeInternalError, "internal server error")
+		return
+	}
+
+	ctx := withIdempotencyKey(r, idempotencyKey, body, http.StatusOK, respBody)
+
+	// Вызываем бизнес-логику для покупки
+	if err := buyService.Buy(ctx, userID, item, quantity); err != nil {
+		if handleIdempotencyError(w, logger, err) {
 			return
 		}
+		writeServiceError(w, logger, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if _, err := w.Write(respBody); err != nil {
+		logger.Error("failed to write response", slog.Any("error", err))
 	}
 }
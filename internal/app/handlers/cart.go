@@ -0,0 +1,153 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/linemk/avito-shop/internal/api"
+	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
+	"github.com/linemk/avito-shop/internal/service"
+)
+
+// GetCartHandler обрабатывает запрос GET /api/cart
+func GetCartHandler(log *slog.Logger, cartService service.CartService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.GetCartHandler"
+		logger := log.With(slog.String("op", op))
+
+		userID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		cart, err := cartService.GetCart(r.Context(), userID)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, toCart(cart))
+	}
+}
+
+// AddCartItemHandler обрабатывает запрос POST /api/cart/items
+func AddCartItemHandler(log *slog.Logger, cartService service.CartService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.AddCartItemHandler"
+		logger := log.With(slog.String("op", op))
+
+		userID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		var req api.AddCartItemRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		cart, err := cartService.AddToCart(r.Context(), userID, req.Item, req.Quantity)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, toCart(cart))
+	}
+}
+
+// RemoveCartItemHandler обрабатывает запрос DELETE /api/cart/items/{item}
+func RemoveCartItemHandler(log *slog.Logger, cartService service.CartService) func(http.ResponseWriter, *http.Request, string) {
+	return func(w http.ResponseWriter, r *http.Request, item string) {
+		const op = "handlers.RemoveCartItemHandler"
+		logger := log.With(slog.String("op", op))
+
+		userID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		cart, err := cartService.RemoveFromCart(r.Context(), userID, item)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, toCart(cart))
+	}
+}
+
+// CheckoutHandler обрабатывает запрос POST /api/checkout
+func CheckoutHandler(log *slog.Logger, buyService service.BuyService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.CheckoutHandler"
+		logger := log.With(slog.String("op", op))
+
+		userID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		result, err := buyService.Checkout(r.Context(), userID)
+		if err != nil {
+			var checkoutErr *service.CheckoutError
+			if errors.As(err, &checkoutErr) {
+				logger.Warn("request failed", slog.String("code", string(CodeCheckoutFailed)), slog.Any("error", err))
+				writeJSON(w, logger, http.StatusConflict, toCheckoutErrorResponse(checkoutErr))
+				return
+			}
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		resp := api.CheckoutResponse{Orders: make([]api.CheckoutOrder, 0, len(result.Orders)), TotalPrice: result.TotalPrice}
+		for _, o := range result.Orders {
+			resp.Orders = append(resp.Orders, api.CheckoutOrder{Id: o.ID, Item: o.MerchName, Quantity: o.Quantity, TotalPrice: o.TotalPrice})
+		}
+		writeJSON(w, logger, http.StatusOK, resp)
+	}
+}
+
+// toCart преобразует корзину в модель API
+func toCart(cart *service.Cart) api.Cart {
+	resp := api.Cart{Items: make([]api.CartItem, 0, len(cart.Items)), TotalPrice: cart.TotalPrice}
+	for _, item := range cart.Items {
+		resp.Items = append(resp.Items, api.CartItem{
+			Item:       item.MerchName,
+			Quantity:   item.Quantity,
+			Price:      item.Price,
+			TotalPrice: item.Price * item.Quantity,
+			Available:  item.Available,
+		})
+	}
+	return resp
+}
+
+// toCheckoutErrorResponse описывает причины по строкам кодами и сообщениями из serviceErrors
+func toCheckoutErrorResponse(e *service.CheckoutError) api.CheckoutErrorResponse {
+	resp := api.CheckoutErrorResponse{
+		Errors: "checkout failed",
+		Code:   string(CodeCheckoutFailed),
+		Lines:  make([]api.CheckoutLineError, 0, len(e.Lines)),
+	}
+	for _, line := range e.Lines {
+		code, message := CodeInternalError, "internal server error"
+		for _, se := range serviceErrors {
+			if errors.Is(line.Err, se.target) {
+				code, message = se.code, se.message
+				break
+			}
+		}
+		resp.Lines = append(resp.Lines, api.CheckoutLineError{Item: line.Item, Code: string(code), Errors: message})
+	}
+	return resp
+}
@@ -0,0 +1,336 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/go-chi/chi/v5"
+	"github.com/linemk/avito-shop/internal/api"
+	"github.com/linemk/avito-shop/internal/app/handlers"
+	"github.com/linemk/avito-shop/internal/config"
+	"github.com/linemk/avito-shop/internal/domain/models"
+	security "github.com/linemk/avito-shop/internal/jwtNew"
+	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
+	"github.com/linemk/avito-shop/internal/service"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestContract_AdminOperationsRequireRoles проверяет, что каждая операция /api/admin перечисляет
+// в BearerAuth роли, которым она доступна. Операция без ролей открыта только администраторам
+// (см. requireBearerAuth), но такая спецификация почти наверняка ошибочна.
+func TestContract_AdminOperationsRequireRoles(t *testing.T) {
+	spec, err := api.GetSwagger()
+	require.NoError(t, err)
+
+	var checked int
+	for path, item := range spec.Paths.Map() {
+		if !strings.HasPrefix(path, "/api/admin") {
+			continue
+		}
+		for method, op := range item.Operations() {
+			checked++
+			security := spec.Security
+			if op.Security != nil {
+				security = *op.Security
+			}
+			assert.NotEmpty(t, security, "%s %s has no security requirement", method, path)
+			for _, requirement := range security {
+				assert.NotEmpty(t, requirement["BearerAuth"], "%s %s must list roles in BearerAuth", method, path)
+			}
+		}
+	}
+	assert.NotZero(t, checked)
+}
+
+// TestContract_ResponsesMatchSchema прогоняет запросы через роутер API и проверяет,
+// что каждый ответ (статус, заголовки, тело) описан в internal/schema/schema.yaml.
+func TestContract_ResponsesMatchSchema(t *testing.T) {
+	// токены подписываются EdDSA-ключом из PEM, как в конфигурации с асимметричными ключами
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	require.NoError(t, err)
+	keyPath := filepath.Join(t.TempDir(), "signing.pem")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600))
+	keys, err := security.LoadKeySet(config.JWTConfig{
+		SigningKeyID: "test",
+		Keys:         []config.JWTKeyConfig{{ID: "test", PrivateKeyPath: keyPath}},
+	})
+	require.NoError(t, err)
+
+	token, err := keys.NewToken(context.Background(), &models.User{ID: 1, Email: "test@example.com", Role: models.RoleEmployee}, 0, time.Hour)
+	require.NoError(t, err)
+	adminToken, err := keys.NewToken(context.Background(), &models.User{ID: 2, Email: "admin@example.com", Role: models.RoleAdmin}, 0, time.Hour)
+	require.NoError(t, err)
+	managerToken, err := keys.NewToken(context.Background(), &models.User{ID: 3, Email: "merch@example.com", Role: models.RoleMerchManager}, 0, time.Hour)
+	require.NoError(t, err)
+
+	spec, err := api.GetSwagger()
+	require.NoError(t, err)
+	spec.Servers = nil
+	specRouter, err := gorillamux.NewRouter(spec)
+	require.NoError(t, err)
+
+	newRouter := func(auth *fakeAuthService, info *fakeInfoService, sendCoin *fakeSendCoinService, buy *fakeBuyService, merch *fakeMerchService, cart *fakeCartService, role *fakeRoleService, twoFactor *fakeTwoFactorService, tokens *fakePersonalTokenService, sessions *fakeSessionService, revoked bool) http.Handler {
+		logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+		r := chi.NewRouter()
+		server := handlers.NewServer(logger, auth, info, sendCoin, buy, merch, cart, role, twoFactor, tokens, sessions, keys)
+		authMiddleware := jwtmiddleware.WithPersonalTokens(jwtmiddleware.NewJWTMiddleware(keys, &fakeRevocationChecker{revoked: revoked}), tokens)
+		require.NoError(t, handlers.RegisterRoutes(r, logger, server, authMiddleware))
+		return r
+	}
+
+	fullInfo := &service.InfoResponse{
+		Coins:     900,
+		Inventory: []service.InventoryItem{{Type: "cup", Quantity: 1}},
+		CoinHistory: service.CoinHistory{
+			Received: []service.HistoryEntry{{FromUser: "a@example.com", Amount: 30}},
+			Sent:     []service.HistoryEntry{{ToUser: "b@example.com", Amount: 10}},
+			Operations: []service.CoinOperation{
+				{Type: models.CoinTxTransferReceived, Amount: 30, FromUser: "a@example.com", CreatedAt: time.Now()},
+				{Type: models.CoinTxPurchase, Amount: -20, Item: "cup", OrderID: 1, CreatedAt: time.Now()},
+			},
+		},
+	}
+
+	tests := []struct {
+		name     string
+		method   string
+		path     string
+		body     string
+		auth     bool
+		admin    bool
+		manager  bool
+		revoked  bool
+		authSvc  *fakeAuthService
+		infoSvc  *fakeInfoService
+		sendSvc  *fakeSendCoinService
+		buySvc   *fakeBuyService
+		merchSvc *fakeMerchService
+		cartSvc  *fakeCartService
+		roleSvc  *fakeRoleService
+		tfaSvc   *fakeTwoFactorService
+		tokenSvc *fakePersonalTokenService
+		sessSvc  *fakeSessionService
+		pat      string // персональный токен вместо JWT
+		cookie   string // state входа через OIDC в cookie
+		wantCode int
+	}{
+		{name: "auth ok", method: "POST", path: "/api/auth", body: `{"username":"test@example.com","password":"password123"}`, authSvc: &fakeAuthService{token: "t"}, wantCode: http.StatusOK},
+		{name: "auth invalid credentials", method: "POST", path: "/api/auth", body: `{"username":"test@example.com","password":"password123"}`, authSvc: &fakeAuthService{err: service.ErrInvalidCredentials}, wantCode: http.StatusUnauthorized},
+		{name: "auth body not matching spec", method: "POST", path: "/api/auth", body: `{"username":"test@example.com"}`, wantCode: http.StatusBadRequest},
+		{name: "auth short password", method: "POST", path: "/api/auth", body: `{"username":"test@example.com","password":"short"}`, wantCode: http.StatusBadRequest},
+		{name: "auth username not an email", method: "POST", path: "/api/auth", body: `{"username":"test","password":"password123"}`, wantCode: http.StatusBadRequest},
+		{name: "auth too many attempts", method: "POST", path: "/api/auth", body: `{"username":"test@example.com","password":"password123"}`, authSvc: &fakeAuthService{err: &service.TooManyAttemptsError{RetryAfter: time.Minute}}, wantCode: http.StatusTooManyRequests},
+		{name: "auth internal error", method: "POST", path: "/api/auth", body: `{"username":"test@example.com","password":"password123"}`, authSvc: &fakeAuthService{err: assert.AnError}, wantCode: http.StatusInternalServerError},
+		{name: "auth email not verified by provider", method: "POST", path: "/api/auth", body: `{"username":"test@example.com","password":"password123"}`, authSvc: &fakeAuthService{err: service.ErrEmailNotVerified}, wantCode: http.StatusForbidden},
+		{name: "oidc login redirect", method: "GET", path: "/api/auth/oidc/login", authSvc: &fakeAuthService{}, wantCode: http.StatusFound},
+		{name: "oidc login disabled", method: "GET", path: "/api/auth/oidc/login", authSvc: &fakeAuthService{err: service.ErrIdentityProviderDisabled}, wantCode: http.StatusNotFound},
+		{name: "oidc callback ok", method: "GET", path: "/api/auth/oidc/callback?code=c&state=state", cookie: "state", authSvc: &fakeAuthService{token: "t"}, wantCode: http.StatusOK},
+		{name: "oidc callback two-factor", method: "GET", path: "/api/auth/oidc/callback?code=c&state=state", cookie: "state", authSvc: &fakeAuthService{challenge: true}, wantCode: http.StatusAccepted},
+		{name: "oidc callback without cookie", method: "GET", path: "/api/auth/oidc/callback?code=c&state=state", authSvc: &fakeAuthService{token: "t"}, wantCode: http.StatusBadRequest},
+		{name: "oidc callback without code", method: "GET", path: "/api/auth/oidc/callback?state=state", cookie: "state", wantCode: http.StatusBadRequest},
+		{name: "oidc callback empty code", method: "GET", path: "/api/auth/oidc/callback?code=&state=state", cookie: "state", wantCode: http.StatusBadRequest},
+		{name: "oidc callback code rejected", method: "GET", path: "/api/auth/oidc/callback?code=c&state=state", cookie: "state", authSvc: &fakeAuthService{err: service.ErrInvalidCredentials}, wantCode: http.StatusUnauthorized},
+		{name: "oidc callback email not verified", method: "GET", path: "/api/auth/oidc/callback?code=c&state=state", cookie: "state", authSvc: &fakeAuthService{err: service.ErrEmailNotVerified}, wantCode: http.StatusForbidden},
+		{name: "jwks", method: "GET", path: "/.well-known/jwks.json", wantCode: http.StatusOK},
+		{name: "refresh ok", method: "POST", path: "/api/auth/refresh", body: `{"refreshToken":"r"}`, authSvc: &fakeAuthService{token: "t"}, wantCode: http.StatusOK},
+		{name: "refresh invalid token", method: "POST", path: "/api/auth/refresh", body: `{"refreshToken":"r"}`, authSvc: &fakeAuthService{err: service.ErrInvalidRefreshToken}, wantCode: http.StatusUnauthorized},
+		{name: "refresh empty token", method: "POST", path: "/api/auth/refresh", body: `{"refreshToken":""}`, wantCode: http.StatusBadRequest},
+		{name: "logout ok", method: "POST", path: "/api/auth/logout", body: `{"refreshToken":"r"}`, auth: true, authSvc: &fakeAuthService{}, wantCode: http.StatusOK},
+		{name: "logout without body", method: "POST", path: "/api/auth/logout", auth: true, authSvc: &fakeAuthService{}, wantCode: http.StatusOK},
+		{name: "logout all ok", method: "POST", path: "/api/auth/logoutAll", auth: true, authSvc: &fakeAuthService{}, wantCode: http.StatusOK},
+		{name: "logout all without token", method: "POST", path: "/api/auth/logoutAll", wantCode: http.StatusUnauthorized},
+		{name: "revoked token", method: "GET", path: "/api/info", auth: true, revoked: true, wantCode: http.StatusUnauthorized},
+		{name: "register ok", method: "POST", path: "/api/register", body: `{"username":"new@example.com","password":"password123"}`, authSvc: &fakeAuthService{}, wantCode: http.StatusCreated},
+		{name: "register existing user", method: "POST", path: "/api/register", body: `{"username":"new@example.com","password":"password123"}`, authSvc: &fakeAuthService{err: service.ErrUserAlreadyExists}, wantCode: http.StatusConflict},
+		{name: "verify email ok", method: "POST", path: "/api/verifyEmail", body: `{"token":"abc"}`, authSvc: &fakeAuthService{}, wantCode: http.StatusOK},
+		{name: "verify email invalid token", method: "POST", path: "/api/verifyEmail", body: `{"token":"abc"}`, authSvc: &fakeAuthService{err: service.ErrInvalidVerificationToken}, wantCode: http.StatusBadRequest},
+		{name: "change password ok", method: "POST", path: "/api/password", body: `{"currentPassword":"password123","newPassword":"newpassword"}`, auth: true, authSvc: &fakeAuthService{}, wantCode: http.StatusOK},
+		{name: "change password wrong current", method: "POST", path: "/api/password", body: `{"currentPassword":"wrong","newPassword":"newpassword"}`, auth: true, authSvc: &fakeAuthService{err: service.ErrWrongPassword}, wantCode: http.StatusBadRequest},
+		{name: "change password short", method: "POST", path: "/api/password", body: `{"currentPassword":"password123","newPassword":"short"}`, auth: true, wantCode: http.StatusBadRequest},
+		{name: "change password without token", method: "POST", path: "/api/password", body: `{"currentPassword":"password123","newPassword":"newpassword"}`, wantCode: http.StatusUnauthorized},
+		{name: "forgot password", method: "POST", path: "/api/password/forgot", body: `{"username":"test@example.com"}`, authSvc: &fakeAuthService{}, wantCode: http.StatusAccepted},
+		{name: "forgot password not an email", method: "POST", path: "/api/password/forgot", body: `{"username":"test"}`, wantCode: http.StatusBadRequest},
+		{name: "reset password ok", method: "POST", path: "/api/password/reset", body: `{"token":"abc","newPassword":"newpassword"}`, authSvc: &fakeAuthService{}, wantCode: http.StatusOK},
+		{name: "reset password invalid token", method: "POST", path: "/api/password/reset", body: `{"token":"abc","newPassword":"newpassword"}`, authSvc: &fakeAuthService{err: service.ErrInvalidResetToken}, wantCode: http.StatusBadRequest},
+		{name: "info ok", method: "GET", path: "/api/info", auth: true, infoSvc: &fakeInfoService{resp: fullInfo}, wantCode: http.StatusOK},
+		{name: "info empty history", method: "GET", path: "/api/info", auth: true, infoSvc: &fakeInfoService{resp: &service.InfoResponse{Coins: 1000}}, wantCode: http.StatusOK},
+		{name: "info without token", method: "GET", path: "/api/info", wantCode: http.StatusUnauthorized},
+		{name: "info internal error", method: "GET", path: "/api/info", auth: true, infoSvc: &fakeInfoService{err: assert.AnError}, wantCode: http.StatusInternalServerError},
+		{name: "send coin ok", method: "POST", path: "/api/sendCoin", body: `{"toUser":"b@example.com","amount":10}`, auth: true, sendSvc: &fakeSendCoinService{}, wantCode: http.StatusOK},
+		{name: "send coin receiver not found", method: "POST", path: "/api/sendCoin", body: `{"toUser":"b@example.com","amount":10}`, auth: true, sendSvc: &fakeSendCoinService{err: service.ErrReceiverNotFound}, wantCode: http.StatusNotFound},
+		{name: "send coin key reused", method: "POST", path: "/api/sendCoin", body: `{"toUser":"b@example.com","amount":10}`, auth: true, sendSvc: &fakeSendCoinService{err: service.ErrIdempotencyKeyReused}, wantCode: http.StatusConflict},
+		{name: "send coin negative amount", method: "POST", path: "/api/sendCoin", body: `{"toUser":"b@example.com","amount":-5}`, auth: true, wantCode: http.StatusBadRequest},
+		{name: "send coin empty receiver", method: "POST", path: "/api/sendCoin", body: `{"toUser":"","amount":10}`, auth: true, wantCode: http.StatusBadRequest},
+		{name: "buy ok", method: "GET", path: "/api/buy/cup", auth: true, buySvc: &fakeBuyService{}, wantCode: http.StatusOK},
+		{name: "buy unknown item", method: "GET", path: "/api/buy/unknown", auth: true, buySvc: &fakeBuyService{err: service.ErrMerchNotFound}, wantCode: http.StatusNotFound},
+		{name: "buy email not verified", method: "GET", path: "/api/buy/cup", auth: true, buySvc: &fakeBuyService{err: service.ErrEmailNotVerified}, wantCode: http.StatusForbidden},
+		{name: "buy insufficient funds", method: "GET", path: "/api/buy/cup", auth: true, buySvc: &fakeBuyService{err: service.ErrInsufficientFunds}, wantCode: http.StatusBadRequest},
+		{name: "buy quantity ok", method: "POST", path: "/api/buy", body: `{"item":"cup","quantity":3}`, auth: true, buySvc: &fakeBuyService{}, wantCode: http.StatusOK},
+		{name: "buy quantity out of bounds", method: "POST", path: "/api/buy", body: `{"item":"cup","quantity":0}`, auth: true, wantCode: http.StatusBadRequest},
+		{name: "buy without quantity", method: "POST", path: "/api/buy", body: `{"item":"cup"}`, auth: true, wantCode: http.StatusBadRequest},
+		{name: "buy quantity over limit", method: "POST", path: "/api/buy", body: `{"item":"cup","quantity":101}`, auth: true, wantCode: http.StatusBadRequest},
+		{name: "buy without item", method: "POST", path: "/api/buy", body: `{"quantity":1}`, auth: true, wantCode: http.StatusBadRequest},
+		{name: "buy quantity out of stock", method: "POST", path: "/api/buy", body: `{"item":"hoody","quantity":50}`, auth: true, buySvc: &fakeBuyService{err: service.ErrOutOfStock}, wantCode: http.StatusConflict},
+		{name: "buy quantity insufficient funds", method: "POST", path: "/api/buy", body: `{"item":"hoody","quantity":50}`, auth: true, buySvc: &fakeBuyService{err: service.ErrInsufficientFunds}, wantCode: http.StatusBadRequest},
+		{name: "buy quantity without token", method: "POST", path: "/api/buy", body: `{"item":"cup","quantity":1}`, wantCode: http.StatusUnauthorized},
+		{name: "buy out of stock", method: "GET", path: "/api/buy/hoody", auth: true, buySvc: &fakeBuyService{err: service.ErrOutOfStock}, wantCode: http.StatusConflict},
+		{name: "merch catalog", method: "GET", path: "/api/merch?category=accessories&sort=price&limit=1", merchSvc: &fakeMerchService{}, wantCode: http.StatusOK},
+		{name: "merch catalog invalid cursor", method: "GET", path: "/api/merch?cursor=abc", merchSvc: &fakeMerchService{err: service.ErrInvalidCursor}, wantCode: http.StatusBadRequest},
+		{name: "merch catalog invalid price range", method: "GET", path: "/api/merch?minPrice=100&maxPrice=10", merchSvc: &fakeMerchService{err: service.ErrInvalidMerchFilter}, wantCode: http.StatusBadRequest},
+		{name: "merch catalog unknown sort", method: "GET", path: "/api/merch?sort=stock", wantCode: http.StatusBadRequest},
+		{name: "merch catalog limit too large", method: "GET", path: "/api/merch?limit=1000", wantCode: http.StatusBadRequest},
+		{name: "merch catalog invalid min price", method: "GET", path: "/api/merch?minPrice=cheap", wantCode: http.StatusBadRequest},
+		{name: "merch item", method: "GET", path: "/api/merch/cup", merchSvc: &fakeMerchService{}, wantCode: http.StatusOK},
+		{name: "merch item not found", method: "GET", path: "/api/merch/car", merchSvc: &fakeMerchService{err: service.ErrMerchNotFound}, wantCode: http.StatusNotFound},
+		{name: "admin merch list", method: "GET", path: "/api/admin/merch", manager: true, merchSvc: &fakeMerchService{}, wantCode: http.StatusOK},
+		{name: "admin merch list by employee", method: "GET", path: "/api/admin/merch", auth: true, wantCode: http.StatusForbidden},
+		{name: "create merch", method: "POST", path: "/api/admin/merch", body: `{"name":"scarf","price":150,"category":"clothing"}`, manager: true, merchSvc: &fakeMerchService{}, wantCode: http.StatusCreated},
+		{name: "create merch by admin", method: "POST", path: "/api/admin/merch", body: `{"name":"scarf","price":150}`, admin: true, merchSvc: &fakeMerchService{}, wantCode: http.StatusCreated},
+		{name: "create merch duplicate", method: "POST", path: "/api/admin/merch", body: `{"name":"cup","price":20}`, manager: true, merchSvc: &fakeMerchService{err: service.ErrMerchAlreadyExists}, wantCode: http.StatusConflict},
+		{name: "create merch invalid name", method: "POST", path: "/api/admin/merch", body: `{"name":"Big Cup","price":20}`, manager: true, wantCode: http.StatusBadRequest},
+		{name: "create merch zero price", method: "POST", path: "/api/admin/merch", body: `{"name":"scarf","price":0}`, manager: true, wantCode: http.StatusBadRequest},
+		{name: "create merch by employee", method: "POST", path: "/api/admin/merch", body: `{"name":"scarf","price":150}`, auth: true, wantCode: http.StatusForbidden},
+		{name: "update merch price", method: "PUT", path: "/api/admin/merch/cup/price", body: `{"price":25}`, manager: true, merchSvc: &fakeMerchService{}, wantCode: http.StatusOK},
+		{name: "update unknown merch price", method: "PUT", path: "/api/admin/merch/car/price", body: `{"price":25}`, manager: true, merchSvc: &fakeMerchService{err: service.ErrMerchNotFound}, wantCode: http.StatusNotFound},
+		{name: "archive merch", method: "POST", path: "/api/admin/merch/cup/archive", manager: true, merchSvc: &fakeMerchService{}, wantCode: http.StatusOK},
+		{name: "restore merch", method: "POST", path: "/api/admin/merch/cup/restore", manager: true, merchSvc: &fakeMerchService{}, wantCode: http.StatusOK},
+		{name: "merch price history", method: "GET", path: "/api/admin/merch/cup/prices", manager: true, merchSvc: &fakeMerchService{}, wantCode: http.StatusOK},
+		{name: "restock merch", method: "POST", path: "/api/admin/merch/hoody/restock", body: `{"quantity":40}`, manager: true, merchSvc: &fakeMerchService{}, wantCode: http.StatusOK},
+		{name: "restock merch zero quantity", method: "POST", path: "/api/admin/merch/hoody/restock", body: `{"quantity":0}`, manager: true, wantCode: http.StatusBadRequest},
+		{name: "restock unknown merch", method: "POST", path: "/api/admin/merch/car/restock", body: `{"quantity":1}`, manager: true, merchSvc: &fakeMerchService{err: service.ErrMerchNotFound}, wantCode: http.StatusNotFound},
+		{name: "restock merch by employee", method: "POST", path: "/api/admin/merch/hoody/restock", body: `{"quantity":40}`, auth: true, wantCode: http.StatusForbidden},
+		{name: "set merch stock", method: "PUT", path: "/api/admin/merch/hoody/stock", body: `{"stock":0}`, manager: true, merchSvc: &fakeMerchService{}, wantCode: http.StatusOK},
+		{name: "disable merch stock tracking", method: "PUT", path: "/api/admin/merch/hoody/stock", body: `{"stock":null}`, manager: true, merchSvc: &fakeMerchService{}, wantCode: http.StatusOK},
+		{name: "set negative merch stock", method: "PUT", path: "/api/admin/merch/hoody/stock", body: `{"stock":-1}`, manager: true, wantCode: http.StatusBadRequest},
+		{name: "set merch stock without field", method: "PUT", path: "/api/admin/merch/hoody/stock", body: `{}`, manager: true, wantCode: http.StatusBadRequest},
+		{name: "set merch stock not a number", method: "PUT", path: "/api/admin/merch/hoody/stock", body: `{"stock":"many"}`, manager: true, wantCode: http.StatusBadRequest},
+		{name: "set merch stock invalid", method: "PUT", path: "/api/admin/merch/hoody/stock", body: `{"stock":5}`, manager: true, merchSvc: &fakeMerchService{err: service.ErrInvalidStock}, wantCode: http.StatusBadRequest},
+		{name: "change role ok", method: "PUT", path: "/api/admin/users/1/role", body: `{"role":"finance","reason":"moved to finance"}`, admin: true, roleSvc: &fakeRoleService{}, wantCode: http.StatusOK},
+		{name: "change role by employee", method: "PUT", path: "/api/admin/users/1/role", body: `{"role":"admin"}`, auth: true, wantCode: http.StatusForbidden},
+		{name: "change role without token", method: "PUT", path: "/api/admin/users/1/role", body: `{"role":"admin"}`, wantCode: http.StatusUnauthorized},
+		{name: "change role unknown role", method: "PUT", path: "/api/admin/users/1/role", body: `{"role":"root"}`, admin: true, wantCode: http.StatusBadRequest},
+		{name: "change own role", method: "PUT", path: "/api/admin/users/2/role", body: `{"role":"employee"}`, admin: true, roleSvc: &fakeRoleService{err: service.ErrSelfRoleChange}, wantCode: http.StatusBadRequest},
+		{name: "change role user not found", method: "PUT", path: "/api/admin/users/99/role", body: `{"role":"finance"}`, admin: true, roleSvc: &fakeRoleService{err: service.ErrUserNotFound}, wantCode: http.StatusNotFound},
+		{name: "role changes ok", method: "GET", path: "/api/admin/users/1/roleChanges", admin: true, roleSvc: &fakeRoleService{}, wantCode: http.StatusOK},
+		{name: "role changes by employee", method: "GET", path: "/api/admin/users/1/roleChanges", auth: true, wantCode: http.StatusForbidden},
+		{name: "role changes invalid user id", method: "GET", path: "/api/admin/users/0/roleChanges", admin: true, wantCode: http.StatusBadRequest},
+		{name: "auth two-factor challenge", method: "POST", path: "/api/auth", body: `{"username":"test@example.com","password":"password123"}`, authSvc: &fakeAuthService{challenge: true}, wantCode: http.StatusAccepted},
+		{name: "two-factor login ok", method: "POST", path: "/api/auth/twoFactor", body: `{"challengeToken":"c","code":"123456"}`, tfaSvc: &fakeTwoFactorService{}, wantCode: http.StatusOK},
+		{name: "two-factor login wrong code", method: "POST", path: "/api/auth/twoFactor", body: `{"challengeToken":"c","code":"123456"}`, tfaSvc: &fakeTwoFactorService{err: service.ErrInvalidTwoFactorCode}, wantCode: http.StatusBadRequest},
+		{name: "two-factor login expired challenge", method: "POST", path: "/api/auth/twoFactor", body: `{"challengeToken":"c","code":"123456"}`, tfaSvc: &fakeTwoFactorService{err: service.ErrInvalidChallengeToken}, wantCode: http.StatusUnauthorized},
+		{name: "two-factor login locked", method: "POST", path: "/api/auth/twoFactor", body: `{"challengeToken":"c","code":"123456"}`, tfaSvc: &fakeTwoFactorService{err: &service.TooManyAttemptsError{RetryAfter: time.Minute}}, wantCode: http.StatusTooManyRequests},
+		{name: "two-factor setup", method: "POST", path: "/api/auth/twoFactor/setup", body: `{"challengeToken":"c"}`, tfaSvc: &fakeTwoFactorService{}, wantCode: http.StatusOK},
+		{name: "two-factor setup confirm", method: "POST", path: "/api/auth/twoFactor/setup/confirm", body: `{"challengeToken":"c","code":"123456"}`, tfaSvc: &fakeTwoFactorService{}, wantCode: http.StatusOK},
+		{name: "two-factor enroll", method: "POST", path: "/api/twoFactor/enroll", auth: true, tfaSvc: &fakeTwoFactorService{}, wantCode: http.StatusOK},
+		{name: "two-factor enroll already enabled", method: "POST", path: "/api/twoFactor/enroll", auth: true, tfaSvc: &fakeTwoFactorService{err: service.ErrTwoFactorAlreadyEnabled}, wantCode: http.StatusConflict},
+		{name: "two-factor confirm", method: "POST", path: "/api/twoFactor/confirm", body: `{"code":"123456"}`, auth: true, tfaSvc: &fakeTwoFactorService{}, wantCode: http.StatusOK},
+		{name: "two-factor confirm empty code", method: "POST", path: "/api/twoFactor/confirm", body: `{"code":""}`, auth: true, wantCode: http.StatusBadRequest},
+		{name: "two-factor disable", method: "POST", path: "/api/twoFactor/disable", body: `{"code":"123456"}`, auth: true, tfaSvc: &fakeTwoFactorService{}, wantCode: http.StatusOK},
+		{name: "two-factor disable required by role", method: "POST", path: "/api/twoFactor/disable", body: `{"code":"123456"}`, auth: true, tfaSvc: &fakeTwoFactorService{err: service.ErrTwoFactorRequired}, wantCode: http.StatusForbidden},
+		{name: "two-factor enroll without token", method: "POST", path: "/api/twoFactor/enroll", wantCode: http.StatusUnauthorized},
+		{name: "refresh requires two-factor", method: "POST", path: "/api/auth/refresh", body: `{"refreshToken":"r"}`, authSvc: &fakeAuthService{err: service.ErrTwoFactorRequired}, wantCode: http.StatusForbidden},
+		{name: "two-factor policy", method: "GET", path: "/api/admin/twoFactor/roles", admin: true, tfaSvc: &fakeTwoFactorService{}, wantCode: http.StatusOK},
+		{name: "set two-factor requirement", method: "PUT", path: "/api/admin/twoFactor/roles/finance", body: `{"required":true}`, admin: true, tfaSvc: &fakeTwoFactorService{}, wantCode: http.StatusOK},
+		{name: "set two-factor requirement by employee", method: "PUT", path: "/api/admin/twoFactor/roles/finance", body: `{"required":true}`, auth: true, wantCode: http.StatusForbidden},
+		{name: "set two-factor requirement unknown role", method: "PUT", path: "/api/admin/twoFactor/roles/root", body: `{"required":true}`, admin: true, wantCode: http.StatusBadRequest},
+		{name: "create personal token", method: "POST", path: "/api/tokens", body: `{"name":"kudos bot","scopes":["coins:send","info:read"],"expiresAt":"2099-01-01T00:00:00Z"}`, auth: true, tokenSvc: &fakePersonalTokenService{}, wantCode: http.StatusCreated},
+		{name: "create personal token unknown scope", method: "POST", path: "/api/tokens", body: `{"name":"kudos bot","scopes":["admin"]}`, auth: true, wantCode: http.StatusBadRequest},
+		{name: "create personal token expired", method: "POST", path: "/api/tokens", body: `{"name":"kudos bot","scopes":["coins:send"],"expiresAt":"2000-01-01T00:00:00Z"}`, auth: true, tokenSvc: &fakePersonalTokenService{err: service.ErrInvalidTokenExpiry}, wantCode: http.StatusBadRequest},
+		{name: "create personal token with personal token", method: "POST", path: "/api/tokens", body: `{"name":"kudos bot","scopes":["coins:send"]}`, pat: "pat_test", tokenSvc: &fakePersonalTokenService{scopes: models.Scopes}, wantCode: http.StatusUnauthorized},
+		{name: "list personal tokens", method: "GET", path: "/api/tokens", auth: true, tokenSvc: &fakePersonalTokenService{}, wantCode: http.StatusOK},
+		{name: "revoke personal token", method: "DELETE", path: "/api/tokens/1", auth: true, tokenSvc: &fakePersonalTokenService{}, wantCode: http.StatusOK},
+		{name: "revoke unknown personal token", method: "DELETE", path: "/api/tokens/99", auth: true, tokenSvc: &fakePersonalTokenService{err: service.ErrPersonalTokenNotFound}, wantCode: http.StatusNotFound},
+		{name: "revoke personal token invalid id", method: "DELETE", path: "/api/tokens/0", auth: true, wantCode: http.StatusBadRequest},
+		{name: "list sessions", method: "GET", path: "/api/sessions", auth: true, sessSvc: &fakeSessionService{}, wantCode: http.StatusOK},
+		{name: "list sessions without token", method: "GET", path: "/api/sessions", wantCode: http.StatusUnauthorized},
+		{name: "list sessions with personal token", method: "GET", path: "/api/sessions", pat: "pat_test", tokenSvc: &fakePersonalTokenService{scopes: models.Scopes}, wantCode: http.StatusUnauthorized},
+		{name: "revoke session", method: "DELETE", path: "/api/sessions/1", auth: true, sessSvc: &fakeSessionService{}, wantCode: http.StatusOK},
+		{name: "revoke unknown session", method: "DELETE", path: "/api/sessions/99", auth: true, sessSvc: &fakeSessionService{err: service.ErrSessionNotFound}, wantCode: http.StatusNotFound},
+		{name: "revoke session invalid id", method: "DELETE", path: "/api/sessions/abc", auth: true, wantCode: http.StatusBadRequest},
+		{name: "info with personal token", method: "GET", path: "/api/info", pat: "pat_test", tokenSvc: &fakePersonalTokenService{scopes: []models.Scope{models.ScopeInfoRead}}, infoSvc: &fakeInfoService{resp: fullInfo}, wantCode: http.StatusOK},
+		{name: "send coin with personal token", method: "POST", path: "/api/sendCoin", body: `{"toUser":"b@example.com","amount":10}`, pat: "pat_test", tokenSvc: &fakePersonalTokenService{scopes: []models.Scope{models.ScopeCoinsSend}}, sendSvc: &fakeSendCoinService{}, wantCode: http.StatusOK},
+		{name: "send coin with personal token without scope", method: "POST", path: "/api/sendCoin", body: `{"toUser":"b@example.com","amount":10}`, pat: "pat_test", tokenSvc: &fakePersonalTokenService{scopes: []models.Scope{models.ScopeInfoRead}}, wantCode: http.StatusForbidden},
+		{name: "buy quantity with personal token", method: "POST", path: "/api/buy", body: `{"item":"cup","quantity":2}`, pat: "pat_test", tokenSvc: &fakePersonalTokenService{scopes: []models.Scope{models.ScopeMerchBuy}}, buySvc: &fakeBuyService{}, wantCode: http.StatusOK},
+		{name: "buy with personal token", method: "GET", path: "/api/buy/cup", pat: "pat_test", tokenSvc: &fakePersonalTokenService{scopes: []models.Scope{models.ScopeMerchBuy}}, buySvc: &fakeBuyService{}, wantCode: http.StatusOK},
+		{name: "get cart", method: "GET", path: "/api/cart", auth: true, cartSvc: &fakeCartService{}, wantCode: http.StatusOK},
+		{name: "add cart item", method: "POST", path: "/api/cart/items", body: `{"item":"cup","quantity":2}`, auth: true, cartSvc: &fakeCartService{}, wantCode: http.StatusOK},
+		{name: "add cart item over limit", method: "POST", path: "/api/cart/items", body: `{"item":"cup","quantity":101}`, auth: true, wantCode: http.StatusBadRequest},
+		{name: "add cart item limit reached", method: "POST", path: "/api/cart/items", body: `{"item":"cup","quantity":50}`, auth: true, cartSvc: &fakeCartService{err: service.ErrInvalidQuantity}, wantCode: http.StatusBadRequest},
+		{name: "add unknown cart item", method: "POST", path: "/api/cart/items", body: `{"item":"car","quantity":1}`, auth: true, cartSvc: &fakeCartService{err: service.ErrMerchNotFound}, wantCode: http.StatusNotFound},
+		{name: "remove cart item", method: "DELETE", path: "/api/cart/items/cup", auth: true, cartSvc: &fakeCartService{}, wantCode: http.StatusOK},
+		{name: "remove missing cart item", method: "DELETE", path: "/api/cart/items/pen", auth: true, cartSvc: &fakeCartService{err: service.ErrCartItemNotFound}, wantCode: http.StatusNotFound},
+		{name: "cart without token", method: "GET", path: "/api/cart", wantCode: http.StatusUnauthorized},
+		{name: "checkout", method: "POST", path: "/api/checkout", auth: true, buySvc: &fakeBuyService{}, wantCode: http.StatusOK},
+		{name: "checkout with personal token", method: "POST", path: "/api/checkout", pat: "pat_test", tokenSvc: &fakePersonalTokenService{scopes: []models.Scope{models.ScopeMerchBuy}}, buySvc: &fakeBuyService{}, wantCode: http.StatusOK},
+		{name: "checkout empty cart", method: "POST", path: "/api/checkout", auth: true, buySvc: &fakeBuyService{err: service.ErrCartEmpty}, wantCode: http.StatusBadRequest},
+		{name: "checkout insufficient funds", method: "POST", path: "/api/checkout", auth: true, buySvc: &fakeBuyService{err: service.ErrInsufficientFunds}, wantCode: http.StatusBadRequest},
+		{name: "checkout rejected lines", method: "POST", path: "/api/checkout", auth: true, buySvc: &fakeBuyService{err: &service.CheckoutError{Lines: []service.CheckoutLineError{{Item: "hoody", Err: service.ErrOutOfStock}, {Item: "socks", Err: service.ErrMerchNotFound}}}}, wantCode: http.StatusConflict},
+		{name: "logout all with personal token", method: "POST", path: "/api/auth/logoutAll", pat: "pat_test", tokenSvc: &fakePersonalTokenService{scopes: models.Scopes}, wantCode: http.StatusUnauthorized},
+		{name: "admin operation with personal token", method: "GET", path: "/api/admin/twoFactor/roles", pat: "pat_test", tokenSvc: &fakePersonalTokenService{scopes: models.Scopes}, wantCode: http.StatusUnauthorized},
+		{name: "unknown personal token", method: "GET", path: "/api/info", pat: "pat_unknown", tokenSvc: &fakePersonalTokenService{scopes: models.Scopes}, wantCode: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := newRouter(tt.authSvc, tt.infoSvc, tt.sendSvc, tt.buySvc, tt.merchSvc, tt.cartSvc, tt.roleSvc, tt.tfaSvc, tt.tokenSvc, tt.sessSvc, tt.revoked)
+
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			if tt.auth {
+				req.Header.Set("Authorization", "Bearer "+token)
+			}
+			if tt.admin {
+				req.Header.Set("Authorization", "Bearer "+adminToken)
+			}
+			if tt.manager {
+				req.Header.Set("Authorization", "Bearer "+managerToken)
+			}
+			if tt.pat != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.pat)
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "oidc_state", Value: tt.cookie})
+			}
+			rr := httptest.NewRecorder()
+			router.ServeHTTP(rr, req)
+			require.Equal(t, tt.wantCode, rr.Code, rr.Body.String())
+
+			route, pathParams, err := specRouter.FindRoute(req)
+			require.NoError(t, err)
+			err = openapi3filter.ValidateResponse(context.Background(), &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: &openapi3filter.RequestValidationInput{
+					Request:    req,
+					PathParams: pathParams,
+					Route:      route,
+				},
+				Status: rr.Code,
+				Header: rr.Header(),
+				Body:   io.NopCloser(bytes.NewReader(rr.Body.Bytes())),
+				Options: &openapi3filter.Options{
+					IncludeResponseStatus: true,
+				},
+			})
+			assert.NoError(t, err, "response does not match schema: %s", rr.Body.String())
+		})
+	}
+}
@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/linemk/avito-shop/internal/api"
+	"github.com/linemk/avito-shop/internal/service"
+)
+
+// Коды ошибок в ответах API. Клиенты различают ошибки по коду, а не по тексту сообщения.
+const (
+	CodeInvalidRequest       = api.ErrorResponseCodeInvalidRequest
+	CodeValidationError      = api.ErrorResponseCodeValidationError
+	CodeUnauthorized         = api.ErrorResponseCodeUnauthorized
+	CodeInvalidCredentials   = api.ErrorResponseCodeInvalidCredentials
+	CodeInsufficientFunds    = api.ErrorResponseCodeInsufficientFunds
+	CodeInvalidAmount        = api.ErrorResponseCodeInvalidAmount
+	CodeSelfTransfer         = api.ErrorResponseCodeSelfTransfer
+	CodeMerchNotFound        = api.ErrorResponseCodeMerchNotFound
+	CodeReceiverNotFound     = api.ErrorResponseCodeReceiverNotFound
+	CodeIdempotencyKeyReused = api.ErrorResponseCodeIdempotencyKeyReused
+	CodeUserAlreadyExists    = api.ErrorResponseCodeUserAlreadyExists
+	CodeInvalidToken         = api.ErrorResponseCodeInvalidVerificationToken
+	CodeEmailNotVerified     = api.ErrorResponseCodeEmailNotVerified
+	CodeInvalidRefreshToken  = api.ErrorResponseCodeInvalidRefreshToken
+	CodeForbidden            = api.ErrorResponseCodeForbidden
+	CodeUserNotFound         = api.ErrorResponseCodeUserNotFound
+	CodeInvalidRole          = api.ErrorResponseCodeInvalidRole
+	CodeSelfRoleChange       = api.ErrorResponseCodeSelfRoleChange
+	CodeTooManyAttempts      = api.ErrorResponseCodeTooManyAttempts
+	CodeWrongPassword        = api.ErrorResponseCodeWrongPassword
+	CodeInvalidResetToken    = api.ErrorResponseCodeInvalidResetToken
+	CodeInvalidChallenge     = api.ErrorResponseCodeInvalidChallengeToken
+	CodeInvalidTwoFactorCode = api.ErrorResponseCodeInvalidTwoFactorCode
+	CodeTwoFactorEnabled     = api.ErrorResponseCodeTwoFactorAlreadyEnabled
+	CodeTwoFactorNotEnabled  = api.ErrorResponseCodeTwoFactorNotEnabled
+	CodeTwoFactorRequired    = api.ErrorResponseCodeTwoFactorRequired
+	CodeInvalidScope         = api.ErrorResponseCodeInvalidScope
+	CodeInvalidTokenExpiry   = api.ErrorResponseCodeInvalidTokenExpiry
+	CodePersonalTokenUnknown = api.ErrorResponseCodePersonalTokenNotFound
+	CodeSessionNotFound      = api.ErrorResponseCodeSessionNotFound
+	CodeProviderDisabled     = api.ErrorResponseCodeIdentityProviderDisabled
+	CodeInvalidOIDCState     = api.ErrorResponseCodeInvalidOidcState
+	CodeInvalidMerchFilter   = api.ErrorResponseCodeInvalidMerchFilter
+	CodeInvalidCursor        = api.ErrorResponseCodeInvalidCursor
+	CodeInvalidPrice         = api.ErrorResponseCodeInvalidPrice
+	CodeMerchAlreadyExists   = api.ErrorResponseCodeMerchAlreadyExists
+	CodeOutOfStock           = api.ErrorResponseCodeOutOfStock
+	CodeInvalidStock         = api.ErrorResponseCodeInvalidStock
+	CodeInvalidQuantity      = api.ErrorResponseCodeInvalidQuantity
+	CodeCartEmpty            = api.ErrorResponseCodeCartEmpty
+	CodeCartItemNotFound     = api.ErrorResponseCodeCartItemNotFound
+	CodeCheckoutFailed       = api.ErrorResponseCodeCheckoutFailed
+	CodeInternalError        = api.ErrorResponseCodeInternalError
+)
+
+// ErrorResponse — тело ответа с ошибкой из OpenAPI.
+type ErrorResponse = api.ErrorResponse
+
+// ErrorCode — машиночитаемый код ошибки из OpenAPI.
+type ErrorCode = api.ErrorResponseCode
+
+// apiError описывает, как ошибка сервиса отдаётся клиенту
+type apiError struct {
+	target  error
+	status  int
+	code    ErrorCode
+	message string
+}
+
+// serviceErrors сопоставляет ошибки сервисов со статусами и кодами ответа
+var serviceErrors = []apiError{
+	{service.ErrInvalidCredentials, http.StatusUnauthorized, CodeInvalidCredentials, "invalid username or password"},
+	{service.ErrInsufficientFunds, http.StatusBadRequest, CodeInsufficientFunds, "insufficient funds"},
+	{service.ErrInvalidAmount, http.StatusBadRequest, CodeInvalidAmount, "amount must be positive"},
+	{service.ErrSelfTransfer, http.StatusBadRequest, CodeSelfTransfer, "cannot transfer coins to yourself"},
+	{service.ErrMerchNotFound, http.StatusNotFound, CodeMerchNotFound, "merch not found"},
+	{service.ErrInvalidMerchFilter, http.StatusBadRequest, CodeInvalidMerchFilter, "invalid merch filter"},
+	{service.ErrInvalidCursor, http.StatusBadRequest, CodeInvalidCursor, "invalid or expired cursor"},
+	{service.ErrInvalidPrice, http.StatusBadRequest, CodeInvalidPrice, "price must be positive"},
+	{service.ErrMerchAlreadyExists, http.StatusConflict, CodeMerchAlreadyExists, "merch already exists"},
+	{service.ErrOutOfStock, http.StatusConflict, CodeOutOfStock, "merch is out of stock"},
+	{service.ErrInvalidStock, http.StatusBadRequest, CodeInvalidStock, "invalid stock quantity"},
+	{service.ErrInvalidQuantity, http.StatusBadRequest, CodeInvalidQuantity, "invalid purchase quantity"},
+	{service.ErrCartEmpty, http.StatusBadRequest, CodeCartEmpty, "cart is empty"},
+	{service.ErrCartItemNotFound, http.StatusNotFound, CodeCartItemNotFound, "item is not in the cart"},
+	{service.ErrReceiverNotFound, http.StatusNotFound, CodeReceiverNotFound, "receiver not found"},
+	{service.ErrIdempotencyKeyReused, http.StatusConflict, CodeIdempotencyKeyReused, "idempotency key reused with different request"},
+	{service.ErrUserAlreadyExists, http.StatusConflict, CodeUserAlreadyExists, "user already exists"},
+	{service.ErrInvalidVerificationToken, http.StatusBadRequest, CodeInvalidToken, "invalid or expired verification token"},
+	{service.ErrEmailNotVerified, http.StatusForbidden, CodeEmailNotVerified, "email is not verified"},
+	{service.ErrInvalidRefreshToken, http.StatusUnauthorized, CodeInvalidRefreshToken, "invalid or expired refresh token"},
+	{service.ErrTooManyAttempts, http.StatusTooManyRequests, CodeTooManyAttempts, "too many login attempts, try again later"},
+	{service.ErrWrongPassword, http.StatusBadRequest, CodeWrongPassword, "current password is incorrect"},
+	{service.ErrInvalidResetToken, http.StatusBadRequest, CodeInvalidResetToken, "invalid or expired password reset token"},
+	{service.ErrInvalidChallengeToken, http.StatusUnauthorized, CodeInvalidChallenge, "invalid or expired two-factor challenge"},
+	{service.ErrInvalidTwoFactorCode, http.StatusBadRequest, CodeInvalidTwoFactorCode, "invalid two-factor code"},
+	{service.ErrTwoFactorAlreadyEnabled, http.StatusConflict, CodeTwoFactorEnabled, "two-factor authentication is already enabled"},
+	{service.ErrTwoFactorNotEnabled, http.StatusBadRequest, CodeTwoFactorNotEnabled, "two-factor authentication is not enabled"},
+	{service.ErrTwoFactorRequired, http.StatusForbidden, CodeTwoFactorRequired, "two-factor authentication is required for your role"},
+	{service.ErrInvalidScope, http.StatusBadRequest, CodeInvalidScope, "invalid personal token scope"},
+	{service.ErrInvalidTokenExpiry, http.StatusBadRequest, CodeInvalidTokenExpiry, "personal token expiry must be in the future"},
+	{service.ErrPersonalTokenNotFound, http.StatusNotFound, CodePersonalTokenUnknown, "personal token not found"},
+	{service.ErrSessionNotFound, http.StatusNotFound, CodeSessionNotFound, "session not found"},
+	{service.ErrIdentityProviderDisabled, http.StatusNotFound, CodeProviderDisabled, "identity provider is not enabled"},
+	{service.ErrInvalidOIDCState, http.StatusBadRequest, CodeInvalidOIDCState, "invalid or expired login state"},
+	{service.ErrUserNotFound, http.StatusNotFound, CodeUserNotFound, "user not found"},
+	{service.ErrInvalidRole, http.StatusBadRequest, CodeInvalidRole, "invalid role"},
+	{service.ErrSelfRoleChange, http.StatusBadRequest, CodeSelfRoleChange, "cannot change your own role"},
+}
+
+// writeError отправляет ошибку в формате ErrorResponse
+func writeError(w http.ResponseWriter, status int, code ErrorCode, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(ErrorResponse{Errors: message, Code: code})
+}
+
+// writeJSON отправляет успешный ответ в формате JSON
+func writeJSON(w http.ResponseWriter, logger *slog.Logger, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("failed to encode response", slog.Any("error", err))
+	}
+}
+
+// writeServiceError отправляет ответ для ошибки сервиса. Известные ошибки получают свой статус и код,
+// остальные отдаются как 500 без подробностей: текст ошибки попадает только в лог.
+func writeServiceError(w http.ResponseWriter, logger *slog.Logger, err error) {
+	// для блокировки после неудачных попыток входа клиент узнаёт, когда повторить запрос
+	var tooMany *service.TooManyAttemptsError
+	if errors.As(err, &tooMany) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(tooMany.RetryAfter.Seconds()))))
+	}
+	for _, e := range serviceErrors {
+		if errors.Is(err, e.target) {
+			logger.Warn("request failed", slog.String("code", string(e.code)), slog.Any("error", err))
+			writeError(w, e.status, e.code, e.message)
+			return
+		}
+	}
+	logger.Error("internal error", slog.Any("error", err))
+	writeError(w, http.StatusInternalServerError, CodeInternalError, "internal server error")
+}
@@ -4,26 +4,151 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"fmt"
 	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
 	"github.com/linemk/avito-shop/internal/service"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"testing"
+	"time"
 
+	"github.com/linemk/avito-shop/internal/api"
 	"github.com/linemk/avito-shop/internal/app/handlers"
+	"github.com/linemk/avito-shop/internal/domain/models"
 	"github.com/stretchr/testify/assert"
 	"log/slog"
 )
 
 // fakeAuthService — фиктивная реализация для тестирования.
 type fakeAuthService struct {
-	token string
-	err   error
+	token     string
+	challenge bool // Login требует второй фактор
+	err       error
+}
+
+func (f *fakeAuthService) Login(ctx context.Context, username, password, device, clientIP string) (*service.LoginResult, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	if f.challenge {
+		return &service.LoginResult{Challenge: &service.TwoFactorChallenge{Token: "challenge", ExpiresAt: time.Now().Add(time.Minute)}}, nil
+	}
+	return &service.LoginResult{Tokens: &service.TokenPair{AccessToken: f.token, RefreshToken: "refresh-" + f.token}}, nil
+}
+
+func (f *fakeAuthService) Refresh(ctx context.Context, refreshToken string) (*service.TokenPair, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &service.TokenPair{AccessToken: f.token, RefreshToken: "refresh-" + f.token}, nil
+}
+
+func (f *fakeAuthService) Logout(ctx context.Context, userID int64, token jwtmiddleware.TokenInfo, refreshToken string) error {
+	return f.err
+}
+
+func (f *fakeAuthService) LogoutAll(ctx context.Context, userID int64) error {
+	return f.err
+}
+
+// fakeRevocationChecker считает отозванными все токены, если revoked = true.
+type fakeRevocationChecker struct {
+	revoked bool
+}
+
+func (f *fakeRevocationChecker) CheckAccessToken(ctx context.Context, userID int64, token jwtmiddleware.TokenInfo) error {
+	if f.revoked {
+		return jwtmiddleware.ErrTokenRevoked
+	}
+	return nil
+}
+
+// fakeSessionService возвращает две сессии пользователя с ID 1 и 2; err возвращается из всех методов.
+type fakeSessionService struct {
+	err error
+}
+
+func (f *fakeSessionService) ListSessions(ctx context.Context, userID int64) ([]*models.Session, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	now := time.Now()
+	return []*models.Session{
+		{ID: 2, UserID: userID, UserAgent: "phone", IP: "198.51.100.7", CreatedAt: now, LastUsedAt: now, ExpiresAt: now.Add(time.Hour)},
+		{ID: 1, UserID: userID, UserAgent: "laptop", IP: "203.0.113.5", CreatedAt: now, LastUsedAt: now, ExpiresAt: now.Add(time.Hour)},
+	}, nil
+}
+
+func (f *fakeSessionService) RevokeSession(ctx context.Context, userID, sessionID int64) error {
+	return f.err
+}
+
+// fakePersonalTokenService принимает персональный токен pat_test с правами scopes;
+// err возвращается из всех методов управления токенами.
+type fakePersonalTokenService struct {
+	scopes []models.Scope
+	err    error
+}
+
+func (f *fakePersonalTokenService) CreatePersonalToken(ctx context.Context, userID int64, name string, scopes []models.Scope, expiresAt *time.Time) (*models.PersonalToken, string, error) {
+	if f.err != nil {
+		return nil, "", f.err
+	}
+	return &models.PersonalToken{ID: 1, UserID: userID, Name: name, Scopes: scopes, CreatedAt: time.Now(), ExpiresAt: expiresAt}, "pat_test", nil
 }
 
-func (f *fakeAuthService) Login(ctx context.Context, username, password string) (string, error) {
-	return f.token, f.err
+func (f *fakePersonalTokenService) ListPersonalTokens(ctx context.Context, userID int64) ([]*models.PersonalToken, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	lastUsed := time.Now()
+	return []*models.PersonalToken{{ID: 1, UserID: userID, Name: "kudos bot", Scopes: []models.Scope{models.ScopeCoinsSend}, CreatedAt: time.Now(), LastUsedAt: &lastUsed}}, nil
+}
+
+func (f *fakePersonalTokenService) RevokePersonalToken(ctx context.Context, userID, tokenID int64) error {
+	return f.err
+}
+
+func (f *fakePersonalTokenService) AuthenticatePersonalToken(ctx context.Context, token string) (*jwtmiddleware.PersonalTokenIdentity, error) {
+	if f == nil || token != "pat_test" {
+		return nil, jwtmiddleware.ErrInvalidToken
+	}
+	return &jwtmiddleware.PersonalTokenIdentity{UserID: 1, Role: models.RoleEmployee, Scopes: f.scopes}, nil
+}
+
+func (f *fakeAuthService) Register(ctx context.Context, username, password string) error {
+	return f.err
+}
+
+func (f *fakeAuthService) VerifyEmail(ctx context.Context, token string) error {
+	return f.err
+}
+
+func (f *fakeAuthService) ChangePassword(ctx context.Context, userID int64, currentPassword, newPassword string) error {
+	return f.err
+}
+
+func (f *fakeAuthService) RequestPasswordReset(ctx context.Context, email string) error {
+	return f.err
+}
+
+func (f *fakeAuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	return f.err
+}
+
+func (f *fakeAuthService) BeginOIDCLogin(ctx context.Context) (*service.OIDCLogin, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &service.OIDCLogin{URL: "https://idp.example.com/authorize?state=state", State: "state"}, nil
+}
+
+func (f *fakeAuthService) CompleteOIDCLogin(ctx context.Context, code, state, expectedState, device, clientIP string) (*service.LoginResult, error) {
+	if f.err == nil && state != expectedState {
+		return nil, service.ErrInvalidOIDCState
+	}
+	return f.Login(ctx, "", "", device, "")
 }
 
 type fakeInfoService struct {
@@ -35,6 +160,233 @@ func (f *fakeInfoService) GetInfo(ctx context.Context, userID int64) (*service.I
 	return f.resp, f.err
 }
 
+// fakeBuyService запоминает товар и количество последней покупки; err возвращается из всех методов.
+type fakeBuyService struct {
+	item     string
+	quantity int
+	err      error
+}
+
+func (f *fakeBuyService) Buy(ctx context.Context, userID int64, item string, quantity int) error {
+	f.item, f.quantity = item, quantity
+	return f.err
+}
+
+func (f *fakeBuyService) Checkout(ctx context.Context, userID int64) (*service.CheckoutResult, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &service.CheckoutResult{
+		Orders:     []*models.Order{{ID: 1, UserID: userID, MerchName: "cup", Quantity: 2, TotalPrice: 40}},
+		TotalPrice: 40,
+	}, nil
+}
+
+// fakeCartService возвращает корзину с одной кружкой; err возвращается из всех методов.
+type fakeCartService struct {
+	item     string
+	quantity int
+	err      error
+}
+
+func (f *fakeCartService) cart() (*service.Cart, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &service.Cart{
+		Items:      []*models.CartItem{{MerchID: 2, MerchName: "cup", Price: 20, Quantity: 2, Available: true}},
+		TotalPrice: 40,
+	}, nil
+}
+
+func (f *fakeCartService) GetCart(ctx context.Context, userID int64) (*service.Cart, error) {
+	return f.cart()
+}
+
+func (f *fakeCartService) AddToCart(ctx context.Context, userID int64, item string, quantity int) (*service.Cart, error) {
+	f.item, f.quantity = item, quantity
+	return f.cart()
+}
+
+func (f *fakeCartService) RemoveFromCart(ctx context.Context, userID int64, item string) (*service.Cart, error) {
+	f.item = item
+	return f.cart()
+}
+
+// fakeMerchService запоминает последний фильтр каталога и заданный остаток; err возвращается из всех методов.
+type fakeMerchService struct {
+	filter service.MerchFilter
+	stock  *int
+	err    error
+}
+
+func (f *fakeMerchService) ListMerch(ctx context.Context, filter service.MerchFilter) (*service.MerchPage, error) {
+	f.filter = filter
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &service.MerchPage{
+		Items:      []*models.Merch{{ID: 2, Name: "cup", Price: 20, Description: "Кружка", Category: "accessories", Available: true}},
+		NextCursor: "next",
+	}, nil
+}
+
+func (f *fakeMerchService) GetMerch(ctx context.Context, name string) (*models.Merch, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.Merch{ID: 2, Name: name, Price: 20, Category: "accessories", Available: true}, nil
+}
+
+func (f *fakeMerchService) ListAllMerch(ctx context.Context) ([]*models.Merch, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	archivedAt := time.Now()
+	return []*models.Merch{
+		{ID: 2, Name: "cup", Price: 20, Category: "accessories", Available: true},
+		{ID: 8, Name: "socks", Price: 10, Category: "clothing", ArchivedAt: &archivedAt},
+	}, nil
+}
+
+func (f *fakeMerchService) CreateMerch(ctx context.Context, actorID int64, merch *models.Merch) error {
+	if f.err != nil {
+		return f.err
+	}
+	merch.ID, merch.Available = 11, true
+	return nil
+}
+
+func (f *fakeMerchService) UpdateMerchPrice(ctx context.Context, actorID int64, name string, price int) (*models.Merch, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.Merch{ID: 2, Name: name, Price: price, Available: true}, nil
+}
+
+func (f *fakeMerchService) ArchiveMerch(ctx context.Context, actorID int64, name string) (*models.Merch, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	archivedAt := time.Now()
+	return &models.Merch{ID: 2, Name: name, Price: 20, ArchivedAt: &archivedAt}, nil
+}
+
+func (f *fakeMerchService) RestoreMerch(ctx context.Context, actorID int64, name string) (*models.Merch, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.Merch{ID: 2, Name: name, Price: 20, Available: true}, nil
+}
+
+func (f *fakeMerchService) ListMerchPrices(ctx context.Context, name string) ([]*models.MerchPrice, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	changedBy := int64(5)
+	return []*models.MerchPrice{
+		{ID: 2, MerchID: 2, Price: 25, ValidFrom: time.Now(), ChangedBy: &changedBy},
+		{ID: 1, MerchID: 2, Price: 20, ValidFrom: time.Unix(0, 0)},
+	}, nil
+}
+
+func (f *fakeMerchService) RestockMerch(ctx context.Context, actorID int64, name string, quantity int) (*models.Merch, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.Merch{ID: 2, Name: name, Price: 20, Available: true, Stock: &quantity}, nil
+}
+
+func (f *fakeMerchService) SetMerchStock(ctx context.Context, actorID int64, name string, stock *int) (*models.Merch, error) {
+	f.stock = stock
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.Merch{ID: 2, Name: name, Price: 20, Available: stock == nil || *stock > 0, Stock: stock}, nil
+}
+
+func (f *fakeMerchService) InvalidateCatalog() {}
+
+type fakeSendCoinService struct {
+	err   error
+	calls int
+}
+
+func (f *fakeSendCoinService) SendCoin(ctx context.Context, fromUserID int64, toUser string, amount int) error {
+	f.calls++
+	return f.err
+}
+
+type fakeRoleService struct {
+	err error
+}
+
+func (f *fakeRoleService) ChangeRole(ctx context.Context, actorID, userID int64, role models.Role, reason string) (*models.RoleChange, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &models.RoleChange{UserID: userID, OldRole: models.RoleEmployee, NewRole: role, ChangedBy: actorID, Reason: reason, CreatedAt: time.Now()}, nil
+}
+
+func (f *fakeRoleService) ListRoleChanges(ctx context.Context, userID int64) ([]*models.RoleChange, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []*models.RoleChange{{UserID: userID, OldRole: models.RoleEmployee, NewRole: models.RoleFinance, ChangedBy: 1, CreatedAt: time.Now()}}, nil
+}
+
+// fakeTwoFactorService возвращает err из всех методов или успешный результат.
+type fakeTwoFactorService struct {
+	err error
+}
+
+func (f *fakeTwoFactorService) VerifyTwoFactor(ctx context.Context, challengeToken, code, device, clientIP string) (*service.TokenPair, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &service.TokenPair{AccessToken: "t", RefreshToken: "r"}, nil
+}
+
+func (f *fakeTwoFactorService) BeginTwoFactorSetup(ctx context.Context, challengeToken string) (*service.TwoFactorEnrollment, error) {
+	return f.EnrollTwoFactor(ctx, 0)
+}
+
+func (f *fakeTwoFactorService) ConfirmTwoFactorSetup(ctx context.Context, challengeToken, code, device, clientIP string) (*service.TokenPair, []string, error) {
+	if f.err != nil {
+		return nil, nil, f.err
+	}
+	return &service.TokenPair{AccessToken: "t", RefreshToken: "r"}, []string{"AAAA-BBBB-CCCC-DDDD"}, nil
+}
+
+func (f *fakeTwoFactorService) EnrollTwoFactor(ctx context.Context, userID int64) (*service.TwoFactorEnrollment, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return &service.TwoFactorEnrollment{Secret: "SECRET", ProvisioningURI: "otpauth://totp/Avito%20shop:user?secret=SECRET"}, nil
+}
+
+func (f *fakeTwoFactorService) ConfirmTwoFactor(ctx context.Context, userID int64, code string) ([]string, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []string{"AAAA-BBBB-CCCC-DDDD"}, nil
+}
+
+func (f *fakeTwoFactorService) DisableTwoFactor(ctx context.Context, userID int64, code string) error {
+	return f.err
+}
+
+func (f *fakeTwoFactorService) SetTwoFactorRequired(ctx context.Context, actorID int64, role models.Role, required bool) error {
+	return f.err
+}
+
+func (f *fakeTwoFactorService) ListTwoFactorRequiredRoles(ctx context.Context) ([]models.Role, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return []models.Role{models.RoleAdmin}, nil
+}
+
 func TestAuthHandler_Success(t *testing.T) {
 	// Фиктивный сервис возвращает корректный токен.
 	fakeSvc := &fakeAuthService{token: "test-token", err: nil}
@@ -51,11 +403,13 @@ func TestAuthHandler_Success(t *testing.T) {
 	assert.Equal(t, http.StatusOK, rr.Code, "Expected status 200 OK")
 
 	var resp struct {
-		Token string `json:"token"`
+		Token        string `json:"token"`
+		RefreshToken string `json:"refreshToken"`
 	}
 	err := json.NewDecoder(rr.Body).Decode(&resp)
 	assert.NoError(t, err, "Response decoding should succeed")
 	assert.Equal(t, "test-token", resp.Token, "Returned token should match fake token")
+	assert.Equal(t, "refresh-test-token", resp.RefreshToken)
 }
 
 func TestAuthHandler_InvalidJSON(t *testing.T) {
@@ -72,22 +426,26 @@ func TestAuthHandler_InvalidJSON(t *testing.T) {
 	assert.Equal(t, http.StatusBadRequest, rr.Code, "Expected status 400 for invalid JSON")
 }
 
-func TestAuthHandler_ValidationError(t *testing.T) {
-	fakeSvc := &fakeAuthService{}
+func TestAuthHandler_LoginError(t *testing.T) {
+	fakeSvc := &fakeAuthService{token: "", err: fmt.Errorf("auth.Login: %w", service.ErrInvalidCredentials)}
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	handler := handlers.AuthHandler(logger, fakeSvc)
 
-	reqBody := `{"username": "test@example.com", "password": "short"}`
+	reqBody := `{"username": "test@example.com", "password": "password123"}`
 	req := httptest.NewRequest("POST", "/api/auth", bytes.NewBufferString(reqBody))
 	req.Header.Set("Content-Type", "application/json")
 	rr := httptest.NewRecorder()
 
 	handler.ServeHTTP(rr, req)
-	assert.Equal(t, http.StatusBadRequest, rr.Code, "Expected status 400 for validation error")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code, "Expected status 401 for login error")
+
+	var resp handlers.ErrorResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, handlers.CodeInvalidCredentials, resp.Code)
 }
 
-func TestAuthHandler_LoginError(t *testing.T) {
-	fakeSvc := &fakeAuthService{token: "", err: assert.AnError}
+func TestAuthHandler_TooManyAttempts(t *testing.T) {
+	fakeSvc := &fakeAuthService{err: fmt.Errorf("auth.Login: %w", &service.TooManyAttemptsError{RetryAfter: 1500 * time.Millisecond})}
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
 	handler := handlers.AuthHandler(logger, fakeSvc)
 
@@ -97,7 +455,88 @@ func TestAuthHandler_LoginError(t *testing.T) {
 	rr := httptest.NewRecorder()
 
 	handler.ServeHTTP(rr, req)
-	assert.Equal(t, http.StatusUnauthorized, rr.Code, "Expected status 401 for login error")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "2", rr.Header().Get("Retry-After"), "Retry-After is rounded up to whole seconds")
+
+	var resp handlers.ErrorResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, handlers.CodeTooManyAttempts, resp.Code)
+}
+
+func TestAuthHandler_InternalError(t *testing.T) {
+	fakeSvc := &fakeAuthService{token: "", err: fmt.Errorf("auth.Login: failed to get user: %w", assert.AnError)}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	handler := handlers.AuthHandler(logger, fakeSvc)
+
+	reqBody := `{"username": "test@example.com", "password": "password123"}`
+	req := httptest.NewRequest("POST", "/api/auth", bytes.NewBufferString(reqBody))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusInternalServerError, rr.Code, "Expected status 500 for unexpected errors")
+	assert.NotContains(t, rr.Body.String(), "auth.Login", "Internal error details must not leak to the client")
+}
+
+func TestOIDCLoginHandler_SetsStateCookie(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	handler := handlers.OIDCLoginHandler(logger, &fakeAuthService{})
+
+	req := httptest.NewRequest("GET", "/api/auth/oidc/login", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusFound, rr.Code)
+	assert.Equal(t, "https://idp.example.com/authorize?state=state", rr.Header().Get("Location"))
+	cookies := rr.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "oidc_state", cookies[0].Name)
+		assert.Equal(t, "state", cookies[0].Value)
+		assert.True(t, cookies[0].HttpOnly)
+		assert.Equal(t, http.SameSiteLaxMode, cookies[0].SameSite)
+	}
+}
+
+func TestOIDCCallbackHandler_ClearsStateCookie(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	handler := handlers.OIDCCallbackHandler(logger, &fakeAuthService{token: "test-token"})
+
+	// state из запроса не совпадает с cookie: вход отклоняется, cookie всё равно удаляется
+	req := httptest.NewRequest("GET", "/api/auth/oidc/callback?code=c&state=other", nil)
+	req.AddCookie(&http.Cookie{Name: "oidc_state", Value: "state"})
+	rr := httptest.NewRecorder()
+	handler(rr, req, api.GetApiAuthOidcCallbackParams{Code: "c", State: "other"})
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "invalid_oidc_state")
+	cookies := rr.Result().Cookies()
+	if assert.Len(t, cookies, 1) {
+		assert.Equal(t, "oidc_state", cookies[0].Name)
+		assert.Equal(t, -1, cookies[0].MaxAge)
+	}
+}
+
+func TestListSessionsHandler_MarksCurrentSession(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	handler := handlers.ListSessionsHandler(logger, &fakeSessionService{})
+
+	req := httptest.NewRequest("GET", "/api/sessions", nil)
+	ctx := context.WithValue(req.Context(), jwtmiddleware.UserIDKey, int64(1))
+	ctx = context.WithValue(ctx, jwtmiddleware.TokenKey, jwtmiddleware.TokenInfo{ID: "jti", SessionID: 1})
+	req = req.WithContext(ctx)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var resp []api.Session
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	if assert.Len(t, resp, 2) {
+		assert.False(t, resp[0].Current)
+		assert.True(t, resp[1].Current)
+		assert.Equal(t, "laptop", resp[1].UserAgent)
+		assert.Equal(t, "203.0.113.5", resp[1].Ip)
+	}
 }
 
 func TestInfoHandler_Success(t *testing.T) {
@@ -183,3 +622,188 @@ func TestInfoHandler_ServiceError(t *testing.T) {
 
 	assert.Equal(t, http.StatusInternalServerError, rr.Code, "Expected status 500 when service returns error")
 }
+
+func TestSendCoinHandler_IdempotentReplay(t *testing.T) {
+	// Сервис сообщает, что запрос с таким ключом уже выполнен.
+	stored := []byte(`{"message":"Coins transferred successfully"}` + "\n")
+	fakeSvc := &fakeSendCoinService{err: &service.ReplayError{ResponseCode: http.StatusOK, ResponseBody: stored}}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	handler := handlers.SendCoinHandler(logger, fakeSvc)
+
+	reqBody := `{"toUser": "receiver@example.com", "amount": 10}`
+	req := httptest.NewRequest("POST", "/api/sendCoin", bytes.NewBufferString(reqBody))
+	req = req.WithContext(context.WithValue(req.Context(), jwtmiddleware.UserIDKey, int64(1)))
+	rr := httptest.NewRecorder()
+
+	key := "retry-1"
+	handler(rr, req, api.PostApiSendCoinParams{IdempotencyKey: &key})
+	assert.Equal(t, http.StatusOK, rr.Code, "Replayed request should return stored status")
+	assert.Equal(t, string(stored), rr.Body.String(), "Replayed request should return stored body")
+	assert.Equal(t, "true", rr.Header().Get("Idempotent-Replayed"))
+}
+
+func TestSendCoinHandler_IdempotencyKeyReused(t *testing.T) {
+	fakeSvc := &fakeSendCoinService{err: service.ErrIdempotencyKeyReused}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	handler := handlers.SendCoinHandler(logger, fakeSvc)
+
+	reqBody := `{"toUser": "receiver@example.com", "amount": 20}`
+	req := httptest.NewRequest("POST", "/api/sendCoin", bytes.NewBufferString(reqBody))
+	req = req.WithContext(context.WithValue(req.Context(), jwtmiddleware.UserIDKey, int64(1)))
+	rr := httptest.NewRecorder()
+
+	key := "retry-1"
+	handler(rr, req, api.PostApiSendCoinParams{IdempotencyKey: &key})
+	assert.Equal(t, http.StatusConflict, rr.Code, "Expected status 409 when key is reused with another body")
+}
+
+func TestSendCoinHandler_ServiceErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		code   handlers.ErrorCode
+	}{
+		{"receiver not found", service.ErrReceiverNotFound, http.StatusNotFound, handlers.CodeReceiverNotFound},
+		{"insufficient funds", service.ErrInsufficientFunds, http.StatusBadRequest, handlers.CodeInsufficientFunds},
+		{"self transfer", service.ErrSelfTransfer, http.StatusBadRequest, handlers.CodeSelfTransfer},
+		{"internal error", fmt.Errorf("service.SendCoinService.SendCoin: failed to lock transfer parties: %w", assert.AnError), http.StatusInternalServerError, handlers.CodeInternalError},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fakeSvc := &fakeSendCoinService{err: fmt.Errorf("service.SendCoinService.SendCoin: %w", tt.err)}
+			logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+			handler := handlers.SendCoinHandler(logger, fakeSvc)
+
+			reqBody := `{"toUser": "receiver@example.com", "amount": 20}`
+			req := httptest.NewRequest("POST", "/api/sendCoin", bytes.NewBufferString(reqBody))
+			req = req.WithContext(context.WithValue(req.Context(), jwtmiddleware.UserIDKey, int64(1)))
+			rr := httptest.NewRecorder()
+
+			handler(rr, req, api.PostApiSendCoinParams{})
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+			var resp handlers.ErrorResponse
+			assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+			assert.Equal(t, tt.code, resp.Code)
+			assert.NotContains(t, resp.Errors, "service.", "Internal op names must not leak to the client")
+		})
+	}
+}
+
+func TestBuyHandler_MerchNotFound(t *testing.T) {
+	fakeSvc := &fakeBuyService{err: fmt.Errorf("service.BuyService.Buy: %w", service.ErrMerchNotFound)}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	handler := handlers.BuyHandler(logger, fakeSvc)
+
+	req := httptest.NewRequest("GET", "/api/buy/unknown", nil)
+	req = req.WithContext(context.WithValue(req.Context(), jwtmiddleware.UserIDKey, int64(1)))
+	rr := httptest.NewRecorder()
+
+	handler(rr, req, "unknown", api.GetApiBuyItemParams{})
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	var resp handlers.ErrorResponse
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&resp))
+	assert.Equal(t, handlers.CodeMerchNotFound, resp.Code)
+}
+
+func TestPurchaseHandler(t *testing.T) {
+	fakeSvc := &fakeBuyService{}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	handler := handlers.PurchaseHandler(logger, fakeSvc)
+
+	req := httptest.NewRequest("POST", "/api/buy", bytes.NewBufferString(`{"item":"hoody","quantity":3}`))
+	req = req.WithContext(context.WithValue(req.Context(), jwtmiddleware.UserIDKey, int64(1)))
+	rr := httptest.NewRecorder()
+	handler(rr, req, api.PostApiBuyParams{})
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "hoody", fakeSvc.item)
+	assert.Equal(t, 3, fakeSvc.quantity)
+	assert.Empty(t, rr.Header().Get("Deprecation"))
+}
+
+func TestBuyHandler_Deprecated(t *testing.T) {
+	fakeSvc := &fakeBuyService{}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	handler := handlers.BuyHandler(logger, fakeSvc)
+
+	req := httptest.NewRequest("GET", "/api/buy/cup", nil)
+	req = req.WithContext(context.WithValue(req.Context(), jwtmiddleware.UserIDKey, int64(1)))
+	rr := httptest.NewRecorder()
+	handler(rr, req, "cup", api.GetApiBuyItemParams{})
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "cup", fakeSvc.item)
+	assert.Equal(t, 1, fakeSvc.quantity)
+	assert.Equal(t, "@1792195200", rr.Header().Get("Deprecation"))
+	assert.Equal(t, `</api/buy>; rel="successor-version"`, rr.Header().Get("Link"))
+}
+
+func TestListMerchHandler_PassesFilter(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	merchService := &fakeMerchService{}
+	handler := handlers.ListMerchHandler(logger, merchService)
+
+	category, cursor, sort := "clothing", "abc", api.GetApiMerchParamsSortMinusPrice
+	minPrice, maxPrice, limit := 10, 300, 5
+	req := httptest.NewRequest("GET", "/api/merch?category=clothing&minPrice=10&maxPrice=300&sort=-price&cursor=abc&limit=5", nil)
+	rr := httptest.NewRecorder()
+	handler(rr, req, api.GetApiMerchParams{
+		Category: &category,
+		MinPrice: &minPrice,
+		MaxPrice: &maxPrice,
+		Sort:     &sort,
+		Cursor:   &cursor,
+		Limit:    &limit,
+	})
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	assert.Equal(t, service.MerchFilter{
+		Category: "clothing",
+		MinPrice: &minPrice,
+		MaxPrice: &maxPrice,
+		Sort:     service.MerchSortPriceDesc,
+		Cursor:   "abc",
+		Limit:    5,
+	}, merchService.filter)
+
+	var resp api.MerchPage
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Len(t, resp.Items, 1)
+	if assert.NotNil(t, resp.NextCursor) {
+		assert.Equal(t, "next", *resp.NextCursor)
+	}
+}
+
+func TestSetMerchStockHandler_NullDisablesTracking(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	merchService := &fakeMerchService{}
+	handler := handlers.SetMerchStockHandler(logger, merchService)
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("PUT", "/api/admin/merch/hoody/stock", bytes.NewBufferString(body))
+		req = req.WithContext(context.WithValue(req.Context(), jwtmiddleware.UserIDKey, int64(3)))
+		rr := httptest.NewRecorder()
+		handler(rr, req, "hoody")
+		return rr
+	}
+
+	rr := send(`{"stock":40}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	if assert.NotNil(t, merchService.stock) {
+		assert.Equal(t, 40, *merchService.stock)
+	}
+	var resp api.AdminMerchItem
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	if assert.NotNil(t, resp.Stock) {
+		assert.Equal(t, 40, *resp.Stock)
+	}
+
+	rr = send(`{"stock":null}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Nil(t, merchService.stock)
+}
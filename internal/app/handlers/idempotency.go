@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/linemk/avito-shop/internal/api"
+	"github.com/linemk/avito-shop/internal/service"
+)
+
+// withIdempotencyKey добавляет в контекст ключ идемпотентности из заголовка Idempotency-Key вместе с ответом,
+// который сервис сохранит в одной транзакции с изменениями баланса. Без заголовка контекст не меняется.
+func withIdempotencyKey(r *http.Request, key *api.IdempotencyKey, body []byte, responseCode int, response []byte) context.Context {
+	if key == nil || *key == "" {
+		return r.Context()
+	}
+
+	return service.WithIdempotency(r.Context(), service.IdempotencyRequest{
+		Key:          *key,
+		RequestHash:  requestHash(r, body),
+		ResponseCode: responseCode,
+		ResponseBody: response,
+	})
+}
+
+// requestHash вычисляет отпечаток запроса: метод, путь и тело
+func requestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method))
+	h.Write([]byte{'\n'})
+	h.Write([]byte(r.URL.Path))
+	h.Write([]byte{'\n'})
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// handleIdempotencyError отвечает на повтор запроса сохранённым ответом. Возвращает true, если ответ отправлен.
+// Повторное использование ключа с другим телом отдаётся через writeServiceError со статусом 409.
+func handleIdempotencyError(w http.ResponseWriter, logger *slog.Logger, err error) bool {
+	var replay *service.ReplayError
+	if errors.As(err, &replay) {
+		logger.Info("replaying stored response for idempotency key")
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Idempotent-Replayed", "true")
+		w.WriteHeader(replay.ResponseCode)
+		if _, err := w.Write(replay.ResponseBody); err != nil {
+			logger.Error("failed to write replayed response", slog.Any("error", err))
+		}
+		return true
+	}
+	return false
+}
+
+// marshalResponse кодирует ответ так же, как json.Encoder (с переводом строки в конце)
+func marshalResponse(v any) ([]byte, error) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(body, '\n'), nil
+}
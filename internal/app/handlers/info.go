@@ -5,33 +5,11 @@ import (
 	"log/slog"
 	"net/http"
 
+	"github.com/linemk/avito-shop/internal/api"
 	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
 	"github.com/linemk/avito-shop/internal/service"
 )
 
-// InfoResponse — структура ответа, соответствующая OpenAPI.
-type InfoResponse struct {
-	Coins       int             `json:"coins"`
-	Inventory   []InventoryItem `json:"inventory"`
-	CoinHistory CoinHistory     `json:"coinHistory"`
-}
-
-type InventoryItem struct {
-	Type     string `json:"type"`
-	Quantity int    `json:"quantity"`
-}
-
-type CoinHistory struct {
-	Received []HistoryEntry `json:"received"`
-	Sent     []HistoryEntry `json:"sent"`
-}
-
-type HistoryEntry struct {
-	FromUser string `json:"fromUser,omitempty"`
-	ToUser   string `json:"toUser,omitempty"`
-	Amount   int    `json:"amount"`
-}
-
 // InfoHandler обрабатывает запрос GET /api/info.
 // Он извлекает идентификатор пользователя из контекста (установленный JWT‑middleware),
 // затем вызывает сервис InfoService для получения информации о балансе, инвентаре и истории транзакций.
@@ -44,7 +22,7 @@ func InfoHandler(log *slog.Logger, infoService service.InfoService) http.Handler
 		userID, ok := jwtmiddleware.FromContext(r.Context())
 		if !ok {
 			logger.Error("userID not found in context")
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 			return
 		}
 
@@ -52,15 +30,50 @@ func InfoHandler(log *slog.Logger, infoService service.InfoService) http.Handler
 		info, err := infoService.GetInfo(r.Context(), userID)
 		if err != nil {
 			logger.Error("failed to get info", slog.Any("error", err))
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, CodeInternalError, "internal server error")
 			return
 		}
 
 		// Отправка JSON‑ответа клиенту.
 		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(info); err != nil {
+		if err := json.NewEncoder(w).Encode(toInfoResponse(info)); err != nil {
 			logger.Error("failed to encode response", slog.Any("error", err))
-			http.Error(w, "internal server error", http.StatusInternalServerError)
+			writeError(w, http.StatusInternalServerError, CodeInternalError, "internal server error")
 		}
 	}
 }
+
+// toInfoResponse преобразует ответ сервиса в модель API.
+// Пустые списки отдаются как [], а не null: в спецификации они обязательные массивы.
+func toInfoResponse(info *service.InfoResponse) api.InfoResponse {
+	resp := api.InfoResponse{
+		Coins:     info.Coins,
+		Inventory: make([]api.InventoryItem, 0, len(info.Inventory)),
+		CoinHistory: api.CoinHistory{
+			Received:   make([]api.ReceivedCoins, 0, len(info.CoinHistory.Received)),
+			Sent:       make([]api.SentCoins, 0, len(info.CoinHistory.Sent)),
+			Operations: make([]api.CoinOperation, 0, len(info.CoinHistory.Operations)),
+		},
+	}
+	for _, item := range info.Inventory {
+		resp.Inventory = append(resp.Inventory, api.InventoryItem{Type: item.Type, Quantity: item.Quantity})
+	}
+	for _, e := range info.CoinHistory.Received {
+		resp.CoinHistory.Received = append(resp.CoinHistory.Received, api.ReceivedCoins{FromUser: e.FromUser, Amount: e.Amount})
+	}
+	for _, e := range info.CoinHistory.Sent {
+		resp.CoinHistory.Sent = append(resp.CoinHistory.Sent, api.SentCoins{ToUser: e.ToUser, Amount: e.Amount})
+	}
+	for _, op := range info.CoinHistory.Operations {
+		resp.CoinHistory.Operations = append(resp.CoinHistory.Operations, api.CoinOperation{
+			Type:      api.CoinOperationType(op.Type),
+			Amount:    op.Amount,
+			FromUser:  op.FromUser,
+			ToUser:    op.ToUser,
+			Item:      op.Item,
+			OrderId:   op.OrderID,
+			CreatedAt: op.CreatedAt,
+		})
+	}
+	return resp
+}
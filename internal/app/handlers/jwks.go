@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/linemk/avito-shop/internal/api"
+	security "github.com/linemk/avito-shop/internal/jwtNew"
+)
+
+// jwksMaxAge — сколько секунд клиенты могут кэшировать JWKS. Новый ключ нужно добавить
+// в набор заранее, не позже чем за это время до начала подписи им.
+const jwksMaxAge = "300"
+
+// PublicKeyProvider отдаёт открытые ключи проверки подписи токенов
+type PublicKeyProvider interface {
+	PublicKeys() []security.JWK
+}
+
+// JWKSHandler обрабатывает запрос GET /.well-known/jwks.json
+func JWKSHandler(log *slog.Logger, keys PublicKeyProvider) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.JWKSHandler"
+		logger := log.With(slog.String("op", op))
+
+		resp := api.JWKSet{Keys: make([]api.JWK, 0)}
+		for _, k := range keys.PublicKeys() {
+			resp.Keys = append(resp.Keys, api.JWK{
+				Kty: api.JWKKty(k.Kty),
+				Kid: k.Kid,
+				Use: api.JWKUse(k.Use),
+				Alg: api.JWKAlg(k.Alg),
+				N:   k.N,
+				E:   k.E,
+				Crv: k.Crv,
+				X:   k.X,
+			})
+		}
+
+		w.Header().Set("Cache-Control", "public, max-age="+jwksMaxAge)
+		writeJSON(w, logger, http.StatusOK, resp)
+	}
+}
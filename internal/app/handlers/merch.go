@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"context"
+	"log/slog"
+	"net/http"
+
+	"github.com/linemk/avito-shop/internal/api"
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
+	"github.com/linemk/avito-shop/internal/service"
+)
+
+// ListMerchHandler обрабатывает запрос GET /api/merch
+func ListMerchHandler(log *slog.Logger, merchService service.MerchService) func(http.ResponseWriter, *http.Request, api.GetApiMerchParams) {
+	return func(w http.ResponseWriter, r *http.Request, params api.GetApiMerchParams) {
+		const op = "handlers.ListMerchHandler"
+		logger := log.With(slog.String("op", op))
+
+		filter := service.MerchFilter{MinPrice: params.MinPrice, MaxPrice: params.MaxPrice}
+		if params.Category != nil {
+			filter.Category = *params.Category
+		}
+		if params.Sort != nil {
+			filter.Sort = service.MerchSort(*params.Sort)
+		}
+		if params.Cursor != nil {
+			filter.Cursor = *params.Cursor
+		}
+		if params.Limit != nil {
+			filter.Limit = *params.Limit
+		}
+
+		page, err := merchService.ListMerch(r.Context(), filter)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		resp := api.MerchPage{Items: make([]api.MerchItem, 0, len(page.Items))}
+		for _, m := range page.Items {
+			resp.Items = append(resp.Items, toMerchItem(m))
+		}
+		if page.NextCursor != "" {
+			resp.NextCursor = &page.NextCursor
+		}
+		writeJSON(w, logger, http.StatusOK, resp)
+	}
+}
+
+// GetMerchHandler обрабатывает запрос GET /api/merch/{name}
+func GetMerchHandler(log *slog.Logger, merchService service.MerchService) func(http.ResponseWriter, *http.Request, string) {
+	return func(w http.ResponseWriter, r *http.Request, name string) {
+		const op = "handlers.GetMerchHandler"
+		logger := log.With(slog.String("op", op))
+
+		merch, err := merchService.GetMerch(r.Context(), name)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, toMerchItem(merch))
+	}
+}
+
+// ListAllMerchHandler обрабатывает запрос GET /api/admin/merch
+func ListAllMerchHandler(log *slog.Logger, merchService service.MerchService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.ListAllMerchHandler"
+		logger := log.With(slog.String("op", op))
+
+		items, err := merchService.ListAllMerch(r.Context())
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		resp := make([]api.AdminMerchItem, 0, len(items))
+		for _, m := range items {
+			resp = append(resp, toAdminMerchItem(m))
+		}
+		writeJSON(w, logger, http.StatusOK, resp)
+	}
+}
+
+// CreateMerchHandler обрабатывает запрос POST /api/admin/merch
+func CreateMerchHandler(log *slog.Logger, merchService service.MerchService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.CreateMerchHandler"
+		logger := log.With(slog.String("op", op))
+
+		actorID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		var req api.CreateMerchRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		merch := &models.Merch{Name: req.Name, Price: req.Price, Description: req.Description, Category: req.Category}
+		if err := merchService.CreateMerch(r.Context(), actorID, merch); err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusCreated, toAdminMerchItem(merch))
+	}
+}
+
+// UpdateMerchPriceHandler обрабатывает запрос PUT /api/admin/merch/{name}/price
+func UpdateMerchPriceHandler(log *slog.Logger, merchService service.MerchService) func(http.ResponseWriter, *http.Request, api.MerchName) {
+	return func(w http.ResponseWriter, r *http.Request, name api.MerchName) {
+		const op = "handlers.UpdateMerchPriceHandler"
+		logger := log.With(slog.String("op", op))
+
+		actorID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		var req api.UpdateMerchPriceRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		merch, err := merchService.UpdateMerchPrice(r.Context(), actorID, name, req.Price)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, toAdminMerchItem(merch))
+	}
+}
+
+// RestockMerchHandler обрабатывает запрос POST /api/admin/merch/{name}/restock
+func RestockMerchHandler(log *slog.Logger, merchService service.MerchService) func(http.ResponseWriter, *http.Request, api.MerchName) {
+	return func(w http.ResponseWriter, r *http.Request, name api.MerchName) {
+		const op = "handlers.RestockMerchHandler"
+		logger := log.With(slog.String("op", op))
+
+		actorID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		var req api.RestockMerchRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		merch, err := merchService.RestockMerch(r.Context(), actorID, name, req.Quantity)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, toAdminMerchItem(merch))
+	}
+}
+
+// SetMerchStockHandler обрабатывает запрос PUT /api/admin/merch/{name}/stock
+func SetMerchStockHandler(log *slog.Logger, merchService service.MerchService) func(http.ResponseWriter, *http.Request, api.MerchName) {
+	return func(w http.ResponseWriter, r *http.Request, name api.MerchName) {
+		const op = "handlers.SetMerchStockHandler"
+		logger := log.With(slog.String("op", op))
+
+		actorID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		// stock обязателен по спецификации, поэтому nil — явный null: учёт остатка выключается
+		var req api.SetMerchStockRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		merch, err := merchService.SetMerchStock(r.Context(), actorID, name, req.Stock)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, toAdminMerchItem(merch))
+	}
+}
+
+// ArchiveMerchHandler обрабатывает запрос POST /api/admin/merch/{name}/archive
+func ArchiveMerchHandler(log *slog.Logger, merchService service.MerchService) func(http.ResponseWriter, *http.Request, api.MerchName) {
+	return func(w http.ResponseWriter, r *http.Request, name api.MerchName) {
+		const op = "handlers.ArchiveMerchHandler"
+		writeMerchArchiveChange(w, r, log.With(slog.String("op", op)), name, merchService.ArchiveMerch)
+	}
+}
+
+// RestoreMerchHandler обрабатывает запрос POST /api/admin/merch/{name}/restore
+func RestoreMerchHandler(log *slog.Logger, merchService service.MerchService) func(http.ResponseWriter, *http.Request, api.MerchName) {
+	return func(w http.ResponseWriter, r *http.Request, name api.MerchName) {
+		const op = "handlers.RestoreMerchHandler"
+		writeMerchArchiveChange(w, r, log.With(slog.String("op", op)), name, merchService.RestoreMerch)
+	}
+}
+
+// MerchPricesHandler обрабатывает запрос GET /api/admin/merch/{name}/prices
+func MerchPricesHandler(log *slog.Logger, merchService service.MerchService) func(http.ResponseWriter, *http.Request, api.MerchName) {
+	return func(w http.ResponseWriter, r *http.Request, name api.MerchName) {
+		const op = "handlers.MerchPricesHandler"
+		logger := log.With(slog.String("op", op))
+
+		prices, err := merchService.ListMerchPrices(r.Context(), name)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		resp := make([]api.MerchPrice, 0, len(prices))
+		for _, p := range prices {
+			resp = append(resp, api.MerchPrice{Price: p.Price, ValidFrom: p.ValidFrom, ChangedBy: p.ChangedBy})
+		}
+		writeJSON(w, logger, http.StatusOK, resp)
+	}
+}
+
+// writeMerchArchiveChange архивирует товар name или возвращает его в каталог через change
+func writeMerchArchiveChange(w http.ResponseWriter, r *http.Request, logger *slog.Logger, name string, change func(ctx context.Context, actorID int64, name string) (*models.Merch, error)) {
+	actorID, ok := jwtmiddleware.FromContext(r.Context())
+	if !ok {
+		logger.Error("userID not found in context")
+		writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+		return
+	}
+
+	merch, err := change(r.Context(), actorID, name)
+	if err != nil {
+		writeServiceError(w, logger, err)
+		return
+	}
+
+	writeJSON(w, logger, http.StatusOK, toAdminMerchItem(merch))
+}
+
+// toMerchItem преобразует товар в модель API
+func toMerchItem(m *models.Merch) api.MerchItem {
+	return api.MerchItem{
+		Name:        m.Name,
+		Price:       m.Price,
+		Description: m.Description,
+		Category:    m.Category,
+		Available:   m.Available,
+	}
+}
+
+// toAdminMerchItem преобразует товар в модель API для управления каталогом
+func toAdminMerchItem(m *models.Merch) api.AdminMerchItem {
+	return api.AdminMerchItem{
+		Name:        m.Name,
+		Price:       m.Price,
+		Description: m.Description,
+		Category:    m.Category,
+		Archived:    m.ArchivedAt != nil,
+		ArchivedAt:  m.ArchivedAt,
+		Stock:       m.Stock,
+	}
+}
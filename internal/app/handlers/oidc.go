@@ -0,0 +1,81 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/linemk/avito-shop/internal/api"
+	"github.com/linemk/avito-shop/internal/service"
+)
+
+// oidcStateCookie хранит state входа через OIDC между перенаправлением к провайдеру и обратным вызовом
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStatePath   = "/api/auth/oidc"
+	oidcStateTTL    = 10 * time.Minute
+)
+
+// OIDCLoginHandler обрабатывает запрос GET /api/auth/oidc/login
+func OIDCLoginHandler(log *slog.Logger, authService service.AuthServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.OIDCLoginHandler"
+		logger := log.With(slog.String("op", op))
+
+		login, err := authService.BeginOIDCLogin(r.Context())
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		// SameSite=Lax: cookie отправляется при переходе с сайта провайдера обратно к нам
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Value:    login.State,
+			Path:     oidcStatePath,
+			MaxAge:   int(oidcStateTTL.Seconds()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, login.URL, http.StatusFound)
+	}
+}
+
+// OIDCCallbackHandler обрабатывает запрос GET /api/auth/oidc/callback
+func OIDCCallbackHandler(log *slog.Logger, authService service.AuthServiceInterface) func(http.ResponseWriter, *http.Request, api.GetApiAuthOidcCallbackParams) {
+	return func(w http.ResponseWriter, r *http.Request, params api.GetApiAuthOidcCallbackParams) {
+		const op = "handlers.OIDCCallbackHandler"
+		logger := log.With(slog.String("op", op))
+
+		var expectedState string
+		if cookie, err := r.Cookie(oidcStateCookie); err == nil {
+			expectedState = cookie.Value
+		}
+		// state одноразовый: cookie удаляется при любом исходе
+		http.SetCookie(w, &http.Cookie{
+			Name:     oidcStateCookie,
+			Path:     oidcStatePath,
+			MaxAge:   -1,
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+
+		result, err := authService.CompleteOIDCLogin(r.Context(), params.Code, params.State, expectedState, r.UserAgent(), clientIP(r))
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		if result.Challenge != nil {
+			writeJSON(w, logger, http.StatusAccepted, api.TwoFactorChallengeResponse{
+				ChallengeToken: result.Challenge.Token,
+				SetupRequired:  result.Challenge.SetupRequired,
+				ExpiresAt:      result.Challenge.ExpiresAt,
+			})
+			return
+		}
+		writeJSON(w, logger, http.StatusOK, api.AuthResponse{Token: result.Tokens.AccessToken, RefreshToken: result.Tokens.RefreshToken})
+	}
+}
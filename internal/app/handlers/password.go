@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/linemk/avito-shop/internal/api"
+	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
+	"github.com/linemk/avito-shop/internal/service"
+)
+
+// ChangePasswordHandler обрабатывает запрос POST /api/password
+func ChangePasswordHandler(log *slog.Logger, authService service.AuthServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.ChangePasswordHandler"
+		logger := log.With(slog.String("op", op))
+
+		userID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		var req api.ChangePasswordRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		if err := authService.ChangePassword(r.Context(), userID, req.CurrentPassword, req.NewPassword); err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, api.MessageResponse{Message: "Password changed, please log in again"})
+	}
+}
+
+// ForgotPasswordHandler обрабатывает запрос POST /api/password/forgot.
+// Ответ одинаковый для зарегистрированных и неизвестных адресов.
+func ForgotPasswordHandler(log *slog.Logger, authService service.AuthServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.ForgotPasswordHandler"
+		logger := log.With(slog.String("op", op))
+
+		var req api.ForgotPasswordRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		if err := authService.RequestPasswordReset(r.Context(), string(req.Username)); err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusAccepted, api.MessageResponse{Message: "If the email is registered, a password reset link has been sent"})
+	}
+}
+
+// ResetPasswordHandler обрабатывает запрос POST /api/password/reset
+func ResetPasswordHandler(log *slog.Logger, authService service.AuthServiceInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.ResetPasswordHandler"
+		logger := log.With(slog.String("op", op))
+
+		var req api.ResetPasswordRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		if err := authService.ResetPassword(r.Context(), req.Token, req.NewPassword); err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, api.MessageResponse{Message: "Password has been reset"})
+	}
+}
@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/linemk/avito-shop/internal/api"
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
+	"github.com/linemk/avito-shop/internal/service"
+)
+
+// CreatePersonalTokenHandler обрабатывает запрос POST /api/tokens
+func CreatePersonalTokenHandler(log *slog.Logger, tokenService service.PersonalTokenService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.CreatePersonalTokenHandler"
+		logger := log.With(slog.String("op", op))
+
+		userID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		var req api.CreatePersonalTokenRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+		scopes := make([]models.Scope, 0, len(req.Scopes))
+		for _, scope := range req.Scopes {
+			scopes = append(scopes, models.Scope(scope))
+		}
+
+		pt, token, err := tokenService.CreatePersonalToken(r.Context(), userID, req.Name, scopes, req.ExpiresAt)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusCreated, api.CreatedPersonalToken{Token: token, PersonalToken: toPersonalToken(pt)})
+	}
+}
+
+// ListPersonalTokensHandler обрабатывает запрос GET /api/tokens
+func ListPersonalTokensHandler(log *slog.Logger, tokenService service.PersonalTokenService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.ListPersonalTokensHandler"
+		logger := log.With(slog.String("op", op))
+
+		userID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		tokens, err := tokenService.ListPersonalTokens(r.Context(), userID)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		resp := make([]api.PersonalToken, 0, len(tokens))
+		for _, pt := range tokens {
+			resp = append(resp, toPersonalToken(pt))
+		}
+		writeJSON(w, logger, http.StatusOK, resp)
+	}
+}
+
+// RevokePersonalTokenHandler обрабатывает запрос DELETE /api/tokens/{tokenId}
+func RevokePersonalTokenHandler(log *slog.Logger, tokenService service.PersonalTokenService) func(http.ResponseWriter, *http.Request, int64) {
+	return func(w http.ResponseWriter, r *http.Request, tokenID int64) {
+		const op = "handlers.RevokePersonalTokenHandler"
+		logger := log.With(slog.String("op", op))
+
+		userID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		if err := tokenService.RevokePersonalToken(r.Context(), userID, tokenID); err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, api.MessageResponse{Message: "Token revoked"})
+	}
+}
+
+// toPersonalToken преобразует персональный токен в модель API
+func toPersonalToken(pt *models.PersonalToken) api.PersonalToken {
+	scopes := make([]api.PersonalTokenScope, 0, len(pt.Scopes))
+	for _, scope := range pt.Scopes {
+		scopes = append(scopes, api.PersonalTokenScope(scope))
+	}
+	return api.PersonalToken{
+		Id:         pt.ID,
+		Name:       pt.Name,
+		Scopes:     scopes,
+		CreatedAt:  pt.CreatedAt,
+		ExpiresAt:  pt.ExpiresAt,
+		LastUsedAt: pt.LastUsedAt,
+	}
+}
@@ -0,0 +1,451 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/go-chi/chi/v5"
+	nethttpmiddleware "github.com/oapi-codegen/nethttp-middleware"
+
+	"github.com/linemk/avito-shop/internal/api"
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
+	"github.com/linemk/avito-shop/internal/service"
+)
+
+// Server реализует api.ServerInterface, сгенерированный из internal/schema/schema.yaml,
+// поверх обработчиков этого пакета.
+type Server struct {
+	auth           http.HandlerFunc
+	register       http.HandlerFunc
+	verifyEmail    http.HandlerFunc
+	refresh        http.HandlerFunc
+	logout         http.HandlerFunc
+	logoutAll      http.HandlerFunc
+	changePassword http.HandlerFunc
+	forgotPassword http.HandlerFunc
+	resetPassword  http.HandlerFunc
+	oidcLogin      http.HandlerFunc
+	oidcCallback   func(http.ResponseWriter, *http.Request, api.GetApiAuthOidcCallbackParams)
+	info           http.HandlerFunc
+	sendCoin       func(http.ResponseWriter, *http.Request, api.PostApiSendCoinParams)
+	buy            func(http.ResponseWriter, *http.Request, string, api.GetApiBuyItemParams)
+	purchase       func(http.ResponseWriter, *http.Request, api.PostApiBuyParams)
+	listMerch      func(http.ResponseWriter, *http.Request, api.GetApiMerchParams)
+	getMerch       func(http.ResponseWriter, *http.Request, string)
+	jwks           http.HandlerFunc
+	changeRole     func(http.ResponseWriter, *http.Request, api.UserId)
+	roleChanges    func(http.ResponseWriter, *http.Request, api.UserId)
+
+	twoFactorLogin        http.HandlerFunc
+	twoFactorSetup        http.HandlerFunc
+	twoFactorSetupConfirm http.HandlerFunc
+	twoFactorEnroll       http.HandlerFunc
+	twoFactorConfirm      http.HandlerFunc
+	twoFactorDisable      http.HandlerFunc
+	twoFactorPolicy       http.HandlerFunc
+	setTwoFactorRequired  func(http.ResponseWriter, *http.Request, api.Role)
+
+	createPersonalToken http.HandlerFunc
+	listPersonalTokens  http.HandlerFunc
+	revokePersonalToken func(http.ResponseWriter, *http.Request, int64)
+
+	listSessions  http.HandlerFunc
+	revokeSession func(http.ResponseWriter, *http.Request, int64)
+
+	listAllMerch     http.HandlerFunc
+	createMerch      http.HandlerFunc
+	updateMerchPrice func(http.ResponseWriter, *http.Request, api.MerchName)
+	archiveMerch     func(http.ResponseWriter, *http.Request, api.MerchName)
+	restoreMerch     func(http.ResponseWriter, *http.Request, api.MerchName)
+	restockMerch     func(http.ResponseWriter, *http.Request, api.MerchName)
+	setMerchStock    func(http.ResponseWriter, *http.Request, api.MerchName)
+	merchPrices      func(http.ResponseWriter, *http.Request, api.MerchName)
+
+	getCart        http.HandlerFunc
+	addCartItem    http.HandlerFunc
+	removeCartItem func(http.ResponseWriter, *http.Request, string)
+	checkout       http.HandlerFunc
+}
+
+var _ api.ServerInterface = (*Server)(nil)
+
+func init() {
+	// kin-openapi не проверяет format: email без явно заданного правила
+	openapi3.DefineStringFormatValidator("email", openapi3.NewCallbackValidator(validateEmail))
+}
+
+// NewServer создаёт реализацию API поверх сервисов приложения.
+func NewServer(log *slog.Logger, authService service.AuthServiceInterface, infoService service.InfoService, sendCoinService service.SendCoinService, buyService service.BuyService, merchService service.MerchService, cartService service.CartService, roleService service.RoleService, twoFactorService service.TwoFactorService, tokenService service.PersonalTokenService, sessionService service.SessionService, keys PublicKeyProvider) *Server {
+	return &Server{
+		auth:           AuthHandler(log, authService),
+		register:       RegisterHandler(log, authService),
+		verifyEmail:    VerifyEmailHandler(log, authService),
+		refresh:        RefreshHandler(log, authService),
+		logout:         LogoutHandler(log, authService),
+		logoutAll:      LogoutAllHandler(log, authService),
+		changePassword: ChangePasswordHandler(log, authService),
+		forgotPassword: ForgotPasswordHandler(log, authService),
+		resetPassword:  ResetPasswordHandler(log, authService),
+		oidcLogin:      OIDCLoginHandler(log, authService),
+		oidcCallback:   OIDCCallbackHandler(log, authService),
+		info:           InfoHandler(log, infoService),
+		sendCoin:       SendCoinHandler(log, sendCoinService),
+		buy:            BuyHandler(log, buyService),
+		purchase:       PurchaseHandler(log, buyService),
+		listMerch:      ListMerchHandler(log, merchService),
+		getMerch:       GetMerchHandler(log, merchService),
+		jwks:           JWKSHandler(log, keys),
+		changeRole:     ChangeRoleHandler(log, roleService),
+		roleChanges:    RoleChangesHandler(log, roleService),
+
+		twoFactorLogin:        TwoFactorLoginHandler(log, twoFactorService),
+		twoFactorSetup:        TwoFactorSetupHandler(log, twoFactorService),
+		twoFactorSetupConfirm: TwoFactorSetupConfirmHandler(log, twoFactorService),
+		twoFactorEnroll:       TwoFactorEnrollHandler(log, twoFactorService),
+		twoFactorConfirm:      TwoFactorConfirmHandler(log, twoFactorService),
+		twoFactorDisable:      TwoFactorDisableHandler(log, twoFactorService),
+		twoFactorPolicy:       TwoFactorPolicyHandler(log, twoFactorService),
+		setTwoFactorRequired:  SetTwoFactorRequirementHandler(log, twoFactorService),
+
+		createPersonalToken: CreatePersonalTokenHandler(log, tokenService),
+		listPersonalTokens:  ListPersonalTokensHandler(log, tokenService),
+		revokePersonalToken: RevokePersonalTokenHandler(log, tokenService),
+
+		listSessions:  ListSessionsHandler(log, sessionService),
+		revokeSession: RevokeSessionHandler(log, sessionService),
+
+		listAllMerch:     ListAllMerchHandler(log, merchService),
+		createMerch:      CreateMerchHandler(log, merchService),
+		updateMerchPrice: UpdateMerchPriceHandler(log, merchService),
+		archiveMerch:     ArchiveMerchHandler(log, merchService),
+		restoreMerch:     RestoreMerchHandler(log, merchService),
+		restockMerch:     RestockMerchHandler(log, merchService),
+		setMerchStock:    SetMerchStockHandler(log, merchService),
+		merchPrices:      MerchPricesHandler(log, merchService),
+
+		getCart:        GetCartHandler(log, cartService),
+		addCartItem:    AddCartItemHandler(log, cartService),
+		removeCartItem: RemoveCartItemHandler(log, cartService),
+		checkout:       CheckoutHandler(log, buyService),
+	}
+}
+
+func (s *Server) PostApiAuth(w http.ResponseWriter, r *http.Request) {
+	s.auth(w, r)
+}
+
+func (s *Server) PostApiAuthRefresh(w http.ResponseWriter, r *http.Request) {
+	s.refresh(w, r)
+}
+
+func (s *Server) PostApiAuthLogout(w http.ResponseWriter, r *http.Request) {
+	s.logout(w, r)
+}
+
+func (s *Server) PostApiAuthLogoutAll(w http.ResponseWriter, r *http.Request) {
+	s.logoutAll(w, r)
+}
+
+func (s *Server) GetApiAuthOidcLogin(w http.ResponseWriter, r *http.Request) {
+	s.oidcLogin(w, r)
+}
+
+func (s *Server) GetApiAuthOidcCallback(w http.ResponseWriter, r *http.Request, params api.GetApiAuthOidcCallbackParams) {
+	s.oidcCallback(w, r, params)
+}
+
+func (s *Server) PostApiPassword(w http.ResponseWriter, r *http.Request) {
+	s.changePassword(w, r)
+}
+
+func (s *Server) PostApiPasswordForgot(w http.ResponseWriter, r *http.Request) {
+	s.forgotPassword(w, r)
+}
+
+func (s *Server) PostApiPasswordReset(w http.ResponseWriter, r *http.Request) {
+	s.resetPassword(w, r)
+}
+
+func (s *Server) PostApiRegister(w http.ResponseWriter, r *http.Request) {
+	s.register(w, r)
+}
+
+func (s *Server) PostApiVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	s.verifyEmail(w, r)
+}
+
+func (s *Server) GetApiInfo(w http.ResponseWriter, r *http.Request) {
+	s.info(w, r)
+}
+
+func (s *Server) PostApiSendCoin(w http.ResponseWriter, r *http.Request, params api.PostApiSendCoinParams) {
+	s.sendCoin(w, r, params)
+}
+
+func (s *Server) GetApiCart(w http.ResponseWriter, r *http.Request) {
+	s.getCart(w, r)
+}
+
+func (s *Server) PostApiCartItems(w http.ResponseWriter, r *http.Request) {
+	s.addCartItem(w, r)
+}
+
+func (s *Server) DeleteApiCartItemsItem(w http.ResponseWriter, r *http.Request, item string) {
+	s.removeCartItem(w, r, item)
+}
+
+func (s *Server) PostApiCheckout(w http.ResponseWriter, r *http.Request) {
+	s.checkout(w, r)
+}
+
+func (s *Server) PostApiBuy(w http.ResponseWriter, r *http.Request, params api.PostApiBuyParams) {
+	s.purchase(w, r, params)
+}
+
+func (s *Server) GetApiBuyItem(w http.ResponseWriter, r *http.Request, item string, params api.GetApiBuyItemParams) {
+	s.buy(w, r, item, params)
+}
+
+func (s *Server) GetApiMerch(w http.ResponseWriter, r *http.Request, params api.GetApiMerchParams) {
+	s.listMerch(w, r, params)
+}
+
+func (s *Server) GetApiMerchName(w http.ResponseWriter, r *http.Request, name string) {
+	s.getMerch(w, r, name)
+}
+
+func (s *Server) PutApiAdminUsersUserIdRole(w http.ResponseWriter, r *http.Request, userID api.UserId) {
+	s.changeRole(w, r, userID)
+}
+
+func (s *Server) GetApiAdminUsersUserIdRoleChanges(w http.ResponseWriter, r *http.Request, userID api.UserId) {
+	s.roleChanges(w, r, userID)
+}
+
+func (s *Server) GetApiAdminMerch(w http.ResponseWriter, r *http.Request) {
+	s.listAllMerch(w, r)
+}
+
+func (s *Server) PostApiAdminMerch(w http.ResponseWriter, r *http.Request) {
+	s.createMerch(w, r)
+}
+
+func (s *Server) PutApiAdminMerchNamePrice(w http.ResponseWriter, r *http.Request, name api.MerchName) {
+	s.updateMerchPrice(w, r, name)
+}
+
+func (s *Server) PostApiAdminMerchNameArchive(w http.ResponseWriter, r *http.Request, name api.MerchName) {
+	s.archiveMerch(w, r, name)
+}
+
+func (s *Server) PostApiAdminMerchNameRestore(w http.ResponseWriter, r *http.Request, name api.MerchName) {
+	s.restoreMerch(w, r, name)
+}
+
+func (s *Server) PostApiAdminMerchNameRestock(w http.ResponseWriter, r *http.Request, name api.MerchName) {
+	s.restockMerch(w, r, name)
+}
+
+func (s *Server) PutApiAdminMerchNameStock(w http.ResponseWriter, r *http.Request, name api.MerchName) {
+	s.setMerchStock(w, r, name)
+}
+
+func (s *Server) GetApiAdminMerchNamePrices(w http.ResponseWriter, r *http.Request, name api.MerchName) {
+	s.merchPrices(w, r, name)
+}
+
+func (s *Server) PostApiAuthTwoFactor(w http.ResponseWriter, r *http.Request) {
+	s.twoFactorLogin(w, r)
+}
+
+func (s *Server) PostApiAuthTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	s.twoFactorSetup(w, r)
+}
+
+func (s *Server) PostApiAuthTwoFactorSetupConfirm(w http.ResponseWriter, r *http.Request) {
+	s.twoFactorSetupConfirm(w, r)
+}
+
+func (s *Server) PostApiTwoFactorEnroll(w http.ResponseWriter, r *http.Request) {
+	s.twoFactorEnroll(w, r)
+}
+
+func (s *Server) PostApiTwoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	s.twoFactorConfirm(w, r)
+}
+
+func (s *Server) PostApiTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	s.twoFactorDisable(w, r)
+}
+
+func (s *Server) GetApiAdminTwoFactorRoles(w http.ResponseWriter, r *http.Request) {
+	s.twoFactorPolicy(w, r)
+}
+
+func (s *Server) PutApiAdminTwoFactorRolesRole(w http.ResponseWriter, r *http.Request, role api.Role) {
+	s.setTwoFactorRequired(w, r, role)
+}
+
+func (s *Server) GetApiTokens(w http.ResponseWriter, r *http.Request) {
+	s.listPersonalTokens(w, r)
+}
+
+func (s *Server) PostApiTokens(w http.ResponseWriter, r *http.Request) {
+	s.createPersonalToken(w, r)
+}
+
+func (s *Server) DeleteApiTokensTokenId(w http.ResponseWriter, r *http.Request, tokenID int64) {
+	s.revokePersonalToken(w, r, tokenID)
+}
+
+func (s *Server) GetApiSessions(w http.ResponseWriter, r *http.Request) {
+	s.listSessions(w, r)
+}
+
+func (s *Server) DeleteApiSessionsSessionId(w http.ResponseWriter, r *http.Request, sessionID int64) {
+	s.revokeSession(w, r, sessionID)
+}
+
+func (s *Server) GetWellKnownJwksJson(w http.ResponseWriter, r *http.Request) {
+	s.jwks(w, r)
+}
+
+// RegisterRoutes регистрирует на роутере маршруты из спецификации.
+// authMiddleware применяется только к операциям, для которых спецификация требует BearerAuth.
+// После аутентификации запрос проверяется по спецификации; при несоответствии возвращается 400.
+func RegisterRoutes(r chi.Router, log *slog.Logger, si api.ServerInterface, authMiddleware func(http.Handler) http.Handler) error {
+	spec, err := api.GetSwagger()
+	if err != nil {
+		return fmt.Errorf("failed to load openapi spec: %w", err)
+	}
+
+	validator := nethttpmiddleware.OapiRequestValidatorWithOptions(spec, &nethttpmiddleware.Options{
+		// аутентификацию выполняет authMiddleware, валидатор проверяет только параметры и тело
+		Options:              openapi3filter.Options{AuthenticationFunc: openapi3filter.NoopAuthenticationFunc},
+		ErrorHandlerWithOpts: validationErrorHandler(log),
+		DoNotValidateServers: true,
+	})
+
+	api.HandlerWithOptions(si, api.ChiServerOptions{
+		BaseRouter: r,
+		// последний middleware в списке выполняется первым
+		Middlewares:      []api.MiddlewareFunc{validator, requireBearerAuth(authMiddleware)},
+		ErrorHandlerFunc: paramErrorHandler(log),
+	})
+	return nil
+}
+
+// requireBearerAuth применяет authMiddleware к операциям, для которых сгенерированный
+// код отметил в контексте требование BearerAuth или PersonalTokenAuth. Scopes BearerAuth в спецификации — роли,
+// которым доступна операция: для непустого списка после аутентификации проверяется роль.
+// Так операции /api/admin/... образуют группу, доступную только администраторам; операция этой группы,
+// для которой в спецификации забыли указать BearerAuth или роли, всё равно доступна только им.
+// Scopes PersonalTokenAuth — права, которые нужны персональному токену (см. requireTokenScopes).
+func requireBearerAuth(authMiddleware func(http.Handler) http.Handler) api.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		protected := authMiddleware(requireTokenScopes(requireScopeRoles(next)))
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if isAdminPath(r.URL.Path) || r.Context().Value(api.BearerAuthScopes) != nil || r.Context().Value(api.PersonalTokenAuthScopes) != nil {
+				protected.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireTokenScopes проверяет права запроса с персональным токеном: операция должна допускать
+// PersonalTokenAuth, а у токена должны быть все права из её scopes. Запросы с access-токеном сессии
+// проходят без проверки.
+func requireTokenScopes(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := jwtmiddleware.ScopesFromContext(r.Context()); !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+		required, ok := r.Context().Value(api.PersonalTokenAuthScopes).([]string)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "personal tokens are not accepted for this operation")
+			return
+		}
+		scopes := make([]models.Scope, 0, len(required))
+		for _, scope := range required {
+			scopes = append(scopes, models.Scope(scope))
+		}
+		jwtmiddleware.RequireScope(scopes...)(next).ServeHTTP(w, r)
+	})
+}
+
+// requireScopeRoles проверяет роль пользователя по scopes BearerAuth операции
+func requireScopeRoles(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		scopes, _ := r.Context().Value(api.BearerAuthScopes).([]string)
+		if len(scopes) == 0 && isAdminPath(r.URL.Path) {
+			scopes = []string{string(models.RoleAdmin)}
+		}
+		if len(scopes) == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		roles := make([]models.Role, 0, len(scopes))
+		for _, scope := range scopes {
+			roles = append(roles, models.Role(scope))
+		}
+		jwtmiddleware.RequireRole(roles...)(next).ServeHTTP(w, r)
+	})
+}
+
+// isAdminPath сообщает, относится ли путь к группе операций администрирования /api/admin
+func isAdminPath(path string) bool {
+	return path == "/api/admin" || strings.HasPrefix(path, "/api/admin/")
+}
+
+// validateEmail принимает адрес вида user@example.com — без отображаемого имени и угловых скобок
+func validateEmail(s string) error {
+	addr, err := mail.ParseAddress(s)
+	if err != nil {
+		return err
+	}
+	if addr.Address != s {
+		return errors.New("email must be a bare address")
+	}
+	return nil
+}
+
+// validationErrorHandler отвечает на запросы, не прошедшие проверку по спецификации
+func validationErrorHandler(log *slog.Logger) nethttpmiddleware.ErrorHandlerWithOpts {
+	return func(_ context.Context, err error, w http.ResponseWriter, _ *http.Request, opts nethttpmiddleware.ErrorHandlerOpts) {
+		logger := log.With(slog.String("op", "handlers.RequestValidator"))
+		logger.Warn("request does not match spec", slog.Any("error", err))
+
+		var reqErr *openapi3filter.RequestError
+		switch {
+		case errors.As(err, &reqErr):
+			// первая строка ошибки kin-openapi описывает проблему, остальные — схему целиком
+			message, _, _ := strings.Cut(reqErr.Error(), "\n")
+			writeError(w, http.StatusBadRequest, CodeValidationError, message)
+		case opts.StatusCode == http.StatusNotFound:
+			writeError(w, http.StatusNotFound, CodeInvalidRequest, "not found")
+		case opts.StatusCode == http.StatusMethodNotAllowed:
+			writeError(w, http.StatusMethodNotAllowed, CodeInvalidRequest, "method not allowed")
+		default:
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid request")
+		}
+	}
+}
+
+// paramErrorHandler отвечает на ошибки разбора параметров в сгенерированном коде
+func paramErrorHandler(log *slog.Logger) func(w http.ResponseWriter, r *http.Request, err error) {
+	return func(w http.ResponseWriter, _ *http.Request, err error) {
+		log.Warn("invalid request parameters", slog.String("op", "handlers.ParamErrorHandler"), slog.Any("error", err))
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, err.Error())
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/linemk/avito-shop/internal/api"
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
+	"github.com/linemk/avito-shop/internal/service"
+)
+
+// ListSessionsHandler обрабатывает запрос GET /api/sessions
+func ListSessionsHandler(log *slog.Logger, sessionService service.SessionService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.ListSessionsHandler"
+		logger := log.With(slog.String("op", op))
+
+		userID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		sessions, err := sessionService.ListSessions(r.Context(), userID)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		// токен, выданный до появления сессий, ни к одной из них не относится
+		token, _ := jwtmiddleware.TokenFromContext(r.Context())
+		resp := make([]api.Session, 0, len(sessions))
+		for _, session := range sessions {
+			resp = append(resp, toSession(session, token.SessionID))
+		}
+		writeJSON(w, logger, http.StatusOK, resp)
+	}
+}
+
+// RevokeSessionHandler обрабатывает запрос DELETE /api/sessions/{sessionId}
+func RevokeSessionHandler(log *slog.Logger, sessionService service.SessionService) func(http.ResponseWriter, *http.Request, int64) {
+	return func(w http.ResponseWriter, r *http.Request, sessionID int64) {
+		const op = "handlers.RevokeSessionHandler"
+		logger := log.With(slog.String("op", op))
+
+		userID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		if err := sessionService.RevokeSession(r.Context(), userID, sessionID); err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, api.MessageResponse{Message: "Session revoked"})
+	}
+}
+
+// toSession преобразует сессию в модель API; currentID — сессия текущего запроса
+func toSession(s *models.Session, currentID int64) api.Session {
+	return api.Session{
+		Id:         s.ID,
+		UserAgent:  s.UserAgent,
+		Ip:         s.IP,
+		CreatedAt:  s.CreatedAt,
+		LastUsedAt: s.LastUsedAt,
+		ExpiresAt:  s.ExpiresAt,
+		Current:    s.ID == currentID,
+	}
+}
@@ -2,60 +2,65 @@ package handlers
 
 import (
 	"encoding/json"
+	"io"
 	"log/slog"
 	"net/http"
 
+	"github.com/linemk/avito-shop/internal/api"
 	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
 	"github.com/linemk/avito-shop/internal/service"
 )
 
-// SendCoinRequest представляет входной JSON для перевода монет.
-type SendCoinRequest struct {
-	ToUser string `json:"toUser" validate:"required,email"`
-	Amount int    `json:"amount" validate:"required,gt=0"`
-}
-
-// SendCoinResponse представляет ответ при успешном переводе.
-type SendCoinResponse struct {
-	Message string `json:"message"`
-}
-
 // SendCoinHandler обрабатывает запрос POST /api/sendCoin.
-func SendCoinHandler(log *slog.Logger, sendCoinService service.SendCoinService) http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
+func SendCoinHandler(log *slog.Logger, sendCoinService service.SendCoinService) func(http.ResponseWriter, *http.Request, api.PostApiSendCoinParams) {
+	return func(w http.ResponseWriter, r *http.Request, params api.PostApiSendCoinParams) {
 		const op = "handlers.SendCoinHandler"
 		logger := log.With(slog.String("op", op))
 
-		var req SendCoinRequest
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			logger.Error("invalid request: decoding error", slog.Any("error", err))
-			http.Error(w, "invalid request", http.StatusBadRequest)
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Error("invalid request: reading body error", slog.Any("error", err))
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid request")
 			return
 		}
 
-		// Здесь можно добавить валидацию через validator, если необходимо
+		var req api.SendCoinRequest
+		if err := json.Unmarshal(body, &req); err != nil {
+			logger.Error("invalid request: decoding error", slog.Any("error", err))
+			writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid request")
+			return
+		}
 
 		// Извлекаем userID отправителя из контекста (установленного JWT middleware)
 		userID, ok := jwtmiddleware.FromContext(r.Context())
 		if !ok {
 			logger.Error("userID not found in context")
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
 			return
 		}
 
+		// Ответ формируем заранее: при наличии Idempotency-Key он сохраняется вместе с переводом
+		respBody, err := marshalResponse(api.MessageResponse{Message: "Coins transferred successfully"})
+		if err != nil {
+			logger.Error("failed to encode response", slog.Any("error", err))
+			writeError(w, http.StatusInternalServerError, CodeInternalError, "internal server error")
+			return
+		}
+
+		ctx := withIdempotencyKey(r, params.IdempotencyKey, body, http.StatusOK, respBody)
+
 		// Вызываем бизнес-логику для перевода монет
-		if err := sendCoinService.SendCoin(r.Context(), userID, req.ToUser, req.Amount); err != nil {
-			logger.Error("failed to send coin", slog.Any("error", err))
-			http.Error(w, err.Error(), http.StatusBadRequest)
+		if err := sendCoinService.SendCoin(ctx, userID, string(req.ToUser), req.Amount); err != nil {
+			if handleIdempotencyError(w, logger, err) {
+				return
+			}
+			writeServiceError(w, logger, err)
 			return
 		}
 
-		resp := SendCoinResponse{Message: "Coins transferred successfully"}
 		w.Header().Set("Content-Type", "application/json")
-		if err := json.NewEncoder(w).Encode(resp); err != nil {
-			logger.Error("failed to encode response", slog.Any("error", err))
-			http.Error(w, "internal server error", http.StatusInternalServerError)
-			return
+		if _, err := w.Write(respBody); err != nil {
+			logger.Error("failed to write response", slog.Any("error", err))
 		}
 	}
 }
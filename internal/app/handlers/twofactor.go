@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+
+	"github.com/linemk/avito-shop/internal/api"
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
+	"github.com/linemk/avito-shop/internal/service"
+)
+
+// TwoFactorLoginHandler обрабатывает запрос POST /api/auth/twoFactor
+func TwoFactorLoginHandler(log *slog.Logger, twoFactorService service.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.TwoFactorLoginHandler"
+		logger := log.With(slog.String("op", op))
+
+		var req api.TwoFactorLoginRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		pair, err := twoFactorService.VerifyTwoFactor(r.Context(), req.ChallengeToken, req.Code, requestDevice(r, req.Device), clientIP(r))
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, api.AuthResponse{Token: pair.AccessToken, RefreshToken: pair.RefreshToken})
+	}
+}
+
+// TwoFactorSetupHandler обрабатывает запрос POST /api/auth/twoFactor/setup
+func TwoFactorSetupHandler(log *slog.Logger, twoFactorService service.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.TwoFactorSetupHandler"
+		logger := log.With(slog.String("op", op))
+
+		var req api.TwoFactorChallengeRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		enrollment, err := twoFactorService.BeginTwoFactorSetup(r.Context(), req.ChallengeToken)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, toTwoFactorEnrollment(enrollment))
+	}
+}
+
+// TwoFactorSetupConfirmHandler обрабатывает запрос POST /api/auth/twoFactor/setup/confirm
+func TwoFactorSetupConfirmHandler(log *slog.Logger, twoFactorService service.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.TwoFactorSetupConfirmHandler"
+		logger := log.With(slog.String("op", op))
+
+		var req api.TwoFactorLoginRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		pair, recoveryCodes, err := twoFactorService.ConfirmTwoFactorSetup(r.Context(), req.ChallengeToken, req.Code, requestDevice(r, req.Device), clientIP(r))
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, api.TwoFactorSetupResponse{
+			Token:         pair.AccessToken,
+			RefreshToken:  pair.RefreshToken,
+			RecoveryCodes: recoveryCodes,
+		})
+	}
+}
+
+// TwoFactorEnrollHandler обрабатывает запрос POST /api/twoFactor/enroll
+func TwoFactorEnrollHandler(log *slog.Logger, twoFactorService service.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.TwoFactorEnrollHandler"
+		logger := log.With(slog.String("op", op))
+
+		userID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		enrollment, err := twoFactorService.EnrollTwoFactor(r.Context(), userID)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, toTwoFactorEnrollment(enrollment))
+	}
+}
+
+// TwoFactorConfirmHandler обрабатывает запрос POST /api/twoFactor/confirm
+func TwoFactorConfirmHandler(log *slog.Logger, twoFactorService service.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.TwoFactorConfirmHandler"
+		logger := log.With(slog.String("op", op))
+
+		userID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		var req api.TwoFactorCodeRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		recoveryCodes, err := twoFactorService.ConfirmTwoFactor(r.Context(), userID, req.Code)
+		if err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, api.RecoveryCodesResponse{RecoveryCodes: recoveryCodes})
+	}
+}
+
+// TwoFactorDisableHandler обрабатывает запрос POST /api/twoFactor/disable
+func TwoFactorDisableHandler(log *slog.Logger, twoFactorService service.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.TwoFactorDisableHandler"
+		logger := log.With(slog.String("op", op))
+
+		userID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		var req api.TwoFactorCodeRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		if err := twoFactorService.DisableTwoFactor(r.Context(), userID, req.Code); err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeJSON(w, logger, http.StatusOK, api.MessageResponse{Message: "Two-factor authentication disabled"})
+	}
+}
+
+// TwoFactorPolicyHandler обрабатывает запрос GET /api/admin/twoFactor/roles
+func TwoFactorPolicyHandler(log *slog.Logger, twoFactorService service.TwoFactorService) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		const op = "handlers.TwoFactorPolicyHandler"
+		logger := log.With(slog.String("op", op))
+
+		writeTwoFactorPolicy(w, r, logger, twoFactorService)
+	}
+}
+
+// SetTwoFactorRequirementHandler обрабатывает запрос PUT /api/admin/twoFactor/roles/{role}
+func SetTwoFactorRequirementHandler(log *slog.Logger, twoFactorService service.TwoFactorService) func(http.ResponseWriter, *http.Request, api.Role) {
+	return func(w http.ResponseWriter, r *http.Request, role api.Role) {
+		const op = "handlers.SetTwoFactorRequirementHandler"
+		logger := log.With(slog.String("op", op))
+
+		actorID, ok := jwtmiddleware.FromContext(r.Context())
+		if !ok {
+			logger.Error("userID not found in context")
+			writeError(w, http.StatusUnauthorized, CodeUnauthorized, "unauthorized")
+			return
+		}
+
+		var req api.TwoFactorRequirementRequest
+		if !decodeRequest(w, r, logger, &req) {
+			return
+		}
+
+		if err := twoFactorService.SetTwoFactorRequired(r.Context(), actorID, models.Role(role), req.Required); err != nil {
+			writeServiceError(w, logger, err)
+			return
+		}
+
+		writeTwoFactorPolicy(w, r, logger, twoFactorService)
+	}
+}
+
+// writeTwoFactorPolicy отправляет список ролей с обязательным вторым фактором
+func writeTwoFactorPolicy(w http.ResponseWriter, r *http.Request, logger *slog.Logger, twoFactorService service.TwoFactorService) {
+	roles, err := twoFactorService.ListTwoFactorRequiredRoles(r.Context())
+	if err != nil {
+		writeServiceError(w, logger, err)
+		return
+	}
+	resp := api.TwoFactorPolicy{Roles: make([]api.Role, 0, len(roles))}
+	for _, role := range roles {
+		resp.Roles = append(resp.Roles, api.Role(role))
+	}
+	writeJSON(w, logger, http.StatusOK, resp)
+}
+
+// decodeRequest разбирает тело запроса; при ошибке отправляет ответ 400 и возвращает false.
+// Ограничения полей проверяет валидатор спецификации до вызова обработчика (см. RegisterRoutes).
+func decodeRequest(w http.ResponseWriter, r *http.Request, logger *slog.Logger, req any) bool {
+	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
+		logger.Error("invalid request: decoding error", slog.Any("error", err))
+		writeError(w, http.StatusBadRequest, CodeInvalidRequest, "invalid request")
+		return false
+	}
+	return true
+}
+
+// toTwoFactorEnrollment преобразует данные подключения в модель API
+func toTwoFactorEnrollment(e *service.TwoFactorEnrollment) api.TwoFactorEnrollment {
+	return api.TwoFactorEnrollment{Secret: e.Secret, ProvisioningUri: e.ProvisioningURI}
+}
@@ -14,6 +14,10 @@ type Config struct {
 	HTTPServer HTTPServerConfig `yaml:"http_server"`
 	Database   DatabaseConfig   `yaml:"database"`
 	JWT        JWTConfig        `yaml:"jwt"`
+	Auth       AuthConfig       `yaml:"auth"`
+	Mailer     MailerConfig     `yaml:"mailer"`
+	Merch      MerchConfig      `yaml:"merch"`
+	Notifier   NotifierConfig   `yaml:"notifier"`
 	Migrations MigrationsConfig `yaml:"migrations"`
 }
 
@@ -22,6 +26,8 @@ type HTTPServerConfig struct {
 	Address     string        `yaml:"address" env-default:"localhost:8080"`
 	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	// TrustProxyHeaders — брать IP клиента из X-Forwarded-For/X-Real-IP; включать только за доверенным прокси
+	TrustProxyHeaders bool `yaml:"trust_proxy_headers" env-default:"false"`
 }
 
 // DB struct
@@ -31,12 +37,128 @@ type DatabaseConfig struct {
 	User     string `yaml:"user" env-required:"true"`
 	Password string `yaml:"-" env:"DB_PASSWORD" env-required:"true"`
 	Name     string `yaml:"name" env-required:"true"`
+	// повтор транзакций при конфликтах сериализации и взаимоблокировках
+	TxMaxRetries   int           `yaml:"tx_max_retries" env-default:"3"`
+	TxRetryBackoff time.Duration `yaml:"tx_retry_backoff" env-default:"20ms"`
+	TxMaxBackoff   time.Duration `yaml:"tx_max_backoff" env-default:"500ms"`
 }
 
 // jwt token settings
 type JWTConfig struct {
-	Secret   string `yaml:"-" env:"JWT_SECRET" env-required:"true"`
-	TokenTTL int    `yaml:"token_ttl" env-default:"60"`
+	// общий секрет HS256; используется, только если не заданы keys
+	Secret   string `yaml:"-" env:"JWT_SECRET"`
+	TokenTTL int    `yaml:"token_ttl" env-default:"15"` // срок действия access-токена в минутах
+	// срок действия refresh-токена; при каждом обновлении выдаётся новый
+	RefreshTokenTTL time.Duration `yaml:"refresh_token_ttl" env-default:"720h"`
+	// kid ключа из keys, которым подписываются новые токены
+	SigningKeyID string `yaml:"signing_key_id" env:"JWT_SIGNING_KEY_ID"`
+	// ключи RS256/EdDSA; все они принимаются при проверке и публикуются в /.well-known/jwks.json
+	Keys []JWTKeyConfig `yaml:"keys"`
+}
+
+// jwt key loaded from PEM; for rotation keep the previous key with public_key_path only
+type JWTKeyConfig struct {
+	ID             string `yaml:"id"`
+	PrivateKeyPath string `yaml:"private_key_path"` // PKCS#8 или PKCS#1
+	PublicKeyPath  string `yaml:"public_key_path"`  // PKIX или PKCS#1
+}
+
+// registration and email verification settings
+type AuthConfig struct {
+	// AutoRegister — старое поведение: неизвестный email на /api/auth создаёт подтверждённый аккаунт
+	AutoRegister    bool          `yaml:"auto_register" env:"AUTH_AUTO_REGISTER" env-default:"false"`
+	VerificationTTL time.Duration `yaml:"verification_ttl" env-default:"24h"`
+	// PasswordResetTTL — срок действия токена сброса пароля из письма
+	PasswordResetTTL time.Duration    `yaml:"password_reset_ttl" env-default:"1h"`
+	BruteForce       BruteForceConfig `yaml:"brute_force"`
+	Password         PasswordConfig   `yaml:"password"`
+	TwoFactor        TwoFactorConfig  `yaml:"two_factor"`
+	Identity         IdentityConfig   `yaml:"identity"`
+}
+
+// identity providers: password logins are checked by local and ldap in the order listed,
+// oidc enables login via redirect to the corporate identity provider
+type IdentityConfig struct {
+	Providers []string   `yaml:"providers" env:"AUTH_IDENTITY_PROVIDERS" env-default:"local"` // local, ldap, oidc
+	LDAP      LDAPConfig `yaml:"ldap"`
+	OIDC      OIDCConfig `yaml:"oidc"`
+}
+
+// LDAP bind: the user entry is found by user_filter, then bound with the entered password
+type LDAPConfig struct {
+	URL      string `yaml:"url"` // ldap://host:389 или ldaps://host:636
+	StartTLS bool   `yaml:"start_tls" env-default:"false"`
+	// служебная учётная запись для поиска пользователя; пусто — анонимный поиск
+	BindDN       string `yaml:"bind_dn"`
+	BindPassword string `yaml:"-" env:"LDAP_BIND_PASSWORD"`
+	BaseDN       string `yaml:"base_dn"`
+	UserFilter   string `yaml:"user_filter" env-default:"(mail=%s)"` // %s — экранированный логин
+	// атрибут с email и неизменяемый идентификатор записи, по которому пользователь связывается с аккаунтом
+	EmailAttribute   string        `yaml:"email_attribute" env-default:"mail"`
+	SubjectAttribute string        `yaml:"subject_attribute" env-default:"entryUUID"`
+	Timeout          time.Duration `yaml:"timeout" env-default:"5s"`
+}
+
+// OpenID Connect authorization code flow
+type OIDCConfig struct {
+	IssuerURL    string   `yaml:"issuer_url"`
+	ClientID     string   `yaml:"client_id"`
+	ClientSecret string   `yaml:"-" env:"OIDC_CLIENT_SECRET"`
+	RedirectURL  string   `yaml:"redirect_url"` // адрес /api/auth/oidc/callback, зарегистрированный у провайдера
+	Scopes       []string `yaml:"scopes" env-default:"openid,email,profile"`
+}
+
+// TOTP second factor settings
+type TwoFactorConfig struct {
+	Issuer       string        `yaml:"issuer" env-default:"Avito shop"` // название в приложении-аутентификаторе
+	ChallengeTTL time.Duration `yaml:"challenge_ttl" env-default:"5m"`  // срок ввода кода после проверки пароля
+	Skew         int           `yaml:"skew" env-default:"1"`            // допустимое расхождение часов в шагах по 30 секунд
+}
+
+// password hashing; hashes made with other algorithm or parameters are upgraded on login
+type PasswordConfig struct {
+	Algorithm         string `yaml:"algorithm" env-default:"argon2id"` // argon2id или bcrypt
+	BcryptCost        int    `yaml:"bcrypt_cost" env-default:"10"`
+	Argon2Memory      uint32 `yaml:"argon2_memory" env-default:"65536"` // КиБ
+	Argon2Iterations  uint32 `yaml:"argon2_iterations" env-default:"3"`
+	Argon2Parallelism uint8  `yaml:"argon2_parallelism" env-default:"2"`
+	Argon2SaltLength  uint32 `yaml:"argon2_salt_length" env-default:"16"`
+	Argon2KeyLength   uint32 `yaml:"argon2_key_length" env-default:"32"`
+}
+
+// brute-force protection for /api/auth: failures are counted per account and per client IP
+type BruteForceConfig struct {
+	Store               string        `yaml:"store" env-default:"memory"` // memory (один экземпляр) или postgres (несколько реплик)
+	Window              time.Duration `yaml:"window" env-default:"15m"`   // неудачи старше этого срока забываются
+	BaseDelay           time.Duration `yaml:"base_delay" env-default:"1s"`
+	MaxDelay            time.Duration `yaml:"max_delay" env-default:"1m"`
+	LockoutDuration     time.Duration `yaml:"lockout_duration" env-default:"15m"`
+	AccountFreeAttempts int           `yaml:"account_free_attempts" env-default:"3"`
+	AccountMaxFailures  int           `yaml:"account_max_failures" env-default:"10"`
+	IPFreeAttempts      int           `yaml:"ip_free_attempts" env-default:"20"`
+	IPMaxFailures       int           `yaml:"ip_max_failures" env-default:"100"`
+}
+
+// mailer settings
+type MailerConfig struct {
+	Type string `yaml:"type" env-default:"log"` // log или file
+	Dir  string `yaml:"dir" env-default:"./mail"`
+	From string `yaml:"from" env-default:"no-reply@avito-shop.local"`
+}
+
+// merch catalog settings
+type MerchConfig struct {
+	// сколько каталог хранится в памяти; изменения через API сбрасывают его сразу, 0 — без кэша
+	CatalogCacheTTL time.Duration `yaml:"catalog_cache_ttl" env-default:"1m"`
+	// оповещение отправляется, когда покупка опускает остаток до этого значения или ниже
+	LowStockThreshold int `yaml:"low_stock_threshold" env-default:"5"`
+}
+
+// service alerts settings
+type NotifierConfig struct {
+	Type       string        `yaml:"type" env-default:"log"`       // log или webhook
+	WebhookURL string        `yaml:"-" env:"NOTIFIER_WEBHOOK_URL"` // адрес вебхука может содержать секрет, поэтому только из окружения
+	Timeout    time.Duration `yaml:"timeout" env-default:"2s"`
 }
 
 type MigrationsConfig struct {
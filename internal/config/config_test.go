@@ -56,7 +56,30 @@ migrations:
 	assert.Equal(t, "postgres", cfg.Database.User)
 	assert.Equal(t, "shop", cfg.Database.Name)
 	assert.Equal(t, 60, cfg.JWT.TokenTTL)
+	assert.Equal(t, 720*time.Hour, cfg.JWT.RefreshTokenTTL)
 	assert.Equal(t, "./migrations", cfg.Migrations.Path)
+	// Значения по умолчанию для регистрации и почты
+	assert.False(t, cfg.Auth.AutoRegister)
+	assert.Equal(t, 24*time.Hour, cfg.Auth.VerificationTTL)
+	assert.Equal(t, time.Hour, cfg.Auth.PasswordResetTTL)
+	assert.Equal(t, "log", cfg.Mailer.Type)
+	// Значения по умолчанию для защиты от перебора паролей
+	assert.Equal(t, "memory", cfg.Auth.BruteForce.Store)
+	assert.Equal(t, 15*time.Minute, cfg.Auth.BruteForce.LockoutDuration)
+	assert.Equal(t, 10, cfg.Auth.BruteForce.AccountMaxFailures)
+	assert.False(t, cfg.HTTPServer.TrustProxyHeaders)
+	assert.Equal(t, "argon2id", cfg.Auth.Password.Algorithm)
+	assert.Equal(t, 5*time.Minute, cfg.Auth.TwoFactor.ChallengeTTL)
+	assert.Equal(t, 1, cfg.Auth.TwoFactor.Skew)
+	assert.Equal(t, uint32(65536), cfg.Auth.Password.Argon2Memory)
+	// По умолчанию пароль проверяется только локально
+	assert.Equal(t, []string{"local"}, cfg.Auth.Identity.Providers)
+	assert.Equal(t, "(mail=%s)", cfg.Auth.Identity.LDAP.UserFilter)
+	assert.Equal(t, 5*time.Second, cfg.Auth.Identity.LDAP.Timeout)
+	assert.Equal(t, []string{"openid", "email", "profile"}, cfg.Auth.Identity.OIDC.Scopes)
+	assert.Equal(t, time.Minute, cfg.Merch.CatalogCacheTTL)
+	assert.Equal(t, 5, cfg.Merch.LowStockThreshold)
+	assert.Equal(t, "log", cfg.Notifier.Type)
 }
 
 func TestMustLoadByPath_FileNotFound(t *testing.T) {
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// CartItem — строка корзины пользователя с текущей ценой и доступностью товара
+type CartItem struct {
+	MerchID   int64
+	MerchName string
+	Price     int // текущая цена за единицу; списывается цена на момент оформления
+	Quantity  int
+	Available bool // товар в каталоге и на складе хватает Quantity единиц
+	AddedAt   time.Time
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// IdempotencyRecord представляет сохранённый результат запроса с ключом идемпотентности
+type IdempotencyRecord struct {
+	UserID         int64
+	Key            string
+	RequestHash    string
+	ResponseStatus int
+	ResponseBody   []byte
+	CreatedAt      time.Time
+}
@@ -0,0 +1,51 @@
+package models
+
+import "time"
+
+// Коды системных счетов журнала
+const (
+	LedgerAccountCompanyIssuance = "company_issuance" // эмиссия: источник всех монет
+	LedgerAccountShopRevenue     = "shop_revenue"     // выручка магазина от покупок
+)
+
+// Типы записей журнала
+const (
+	LedgerEntrySignupGrant    = "signup_grant"    // начальные монеты при регистрации
+	LedgerEntryTransfer       = "transfer"        // перевод между сотрудниками
+	LedgerEntryPurchase       = "purchase"        // покупка мерча
+	LedgerEntryAdminGrant     = "admin_grant"     // начисление администратором
+	LedgerEntryAdjustment     = "adjustment"      // корректировка по итогам сверки
+	LedgerEntryOpeningBalance = "opening_balance" // входящий остаток при переходе на журнал
+)
+
+// LedgerAccountRef указывает счёт журнала: кошелёк пользователя (UserID) либо системный счёт (Code)
+type LedgerAccountRef struct {
+	UserID int64
+	Code   string
+}
+
+// WalletAccount возвращает ссылку на кошелёк пользователя
+func WalletAccount(userID int64) LedgerAccountRef {
+	return LedgerAccountRef{UserID: userID}
+}
+
+// SystemAccount возвращает ссылку на системный счёт
+func SystemAccount(code string) LedgerAccountRef {
+	return LedgerAccountRef{Code: code}
+}
+
+// LedgerPosting — изменение баланса одного счёта; положительная сумма увеличивает баланс
+type LedgerPosting struct {
+	Account LedgerAccountRef
+	Amount  int
+}
+
+// LedgerEntry — запись журнала: набор проводок с нулевой суммой
+type LedgerEntry struct {
+	ID        int64
+	Kind      string
+	Reference string // ссылка на бизнес-объект, например "order:42"
+	Reason    string // пояснение для аудита
+	Postings  []LedgerPosting
+	CreatedAt time.Time
+}
@@ -0,0 +1,11 @@
+package models
+
+import "time"
+
+// LoginAttempt — счётчик неудачных попыток входа по ключу: аккаунту или IP-адресу клиента
+type LoginAttempt struct {
+	Key           string
+	Failures      int       // неудачные попытки подряд в пределах окна
+	LastFailureAt time.Time // время последней неудачной попытки
+	LockedUntil   time.Time // до этого момента попытки отклоняются; нулевое значение — без блокировки
+}
@@ -1,8 +1,24 @@
 package models
 
+import "time"
+
 // Merch представляет товар мерча, доступный для покупки
 type Merch struct {
-	ID    int64  // Уникальный идентификатор товара
-	Name  string // Название товара (уникальное)
-	Price int    // Цена товара в монетах
+	ID          int64      // Уникальный идентификатор товара
+	Name        string     // Название товара (уникальное)
+	Price       int        // Цена товара в монетах
+	Description string     // Описание для каталога
+	Category    string     // Категория каталога, например clothing
+	Available   bool       // Товар можно купить
+	ArchivedAt  *time.Time // Время архивации; nil — товар в каталоге
+	Stock       *int       // Остаток на складе; nil — остаток не учитывается
+}
+
+// MerchPrice — запись истории цен: цена действует с ValidFrom до следующей записи
+type MerchPrice struct {
+	ID        int64
+	MerchID   int64
+	Price     int
+	ValidFrom time.Time
+	ChangedBy *int64 // nil — цена задана миграцией
 }
@@ -0,0 +1,42 @@
+package models
+
+import "time"
+
+// PersonalTokenPrefix — префикс персонального токена, по которому он отличается от JWT
+const PersonalTokenPrefix = "pat_"
+
+// Scope — право персонального токена доступа на группу операций API
+type Scope string
+
+const (
+	ScopeInfoRead  Scope = "info:read"  // баланс, инвентарь и история операций
+	ScopeCoinsSend Scope = "coins:send" // переводы монет
+	ScopeMerchBuy  Scope = "merch:buy"  // покупка мерча
+)
+
+// Scopes — все права персональных токенов
+var Scopes = []Scope{ScopeInfoRead, ScopeCoinsSend, ScopeMerchBuy}
+
+// Valid сообщает, является ли значение известным правом
+func (s Scope) Valid() bool {
+	for _, scope := range Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// PersonalToken — персональный токен доступа для ботов и интеграций. Действует от имени
+// владельца, но только для операций из Scopes. В БД хранится только хэш токена.
+type PersonalToken struct {
+	ID         int64
+	UserID     int64
+	Name       string
+	Scopes     []Scope
+	TokenHash  []byte
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time // nil — бессрочный
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+}
@@ -0,0 +1,24 @@
+package models
+
+// BalanceFacts — исходные данные сверки баланса одного пользователя
+type BalanceFacts struct {
+	UserID        int64
+	Email         string
+	CoinBalance   int  // кэш баланса в users.coin_balance
+	Grants        int  // начисления по журналу: регистрация и ручные начисления
+	LegacyUser    bool // пользователь создан до журнала (есть запись opening_balance)
+	Received      int  // сумма полученных переводов
+	Sent          int  // сумма отправленных переводов
+	Spent         int  // сумма orders.total_price
+	LedgerBalance int  // сумма проводок по кошельку
+}
+
+// OrderPriceMismatch — заказ, у которого total_price не равен quantity * price
+type OrderPriceMismatch struct {
+	OrderID       int64
+	UserID        int64
+	MerchName     string
+	Quantity      int
+	TotalPrice    int
+	ExpectedPrice int
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+// Role — роль пользователя, определяет доступ к административным операциям
+type Role string
+
+const (
+	RoleEmployee     Role = "employee"      // сотрудник: покупки и переводы
+	RoleMerchManager Role = "merch-manager" // управление каталогом мерча
+	RoleFinance      Role = "finance"       // финансовые операции и сверка
+	RoleAdmin        Role = "admin"         // всё, включая управление ролями
+)
+
+// Roles — все роли в порядке возрастания привилегий
+var Roles = []Role{RoleEmployee, RoleMerchManager, RoleFinance, RoleAdmin}
+
+// Valid сообщает, является ли значение известной ролью
+func (r Role) Valid() bool {
+	for _, role := range Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// RoleChange — запись журнала изменения роли
+type RoleChange struct {
+	ID        int64
+	UserID    int64
+	OldRole   Role
+	NewRole   Role
+	ChangedBy int64
+	Reason    string
+	CreatedAt time.Time
+}
@@ -0,0 +1,18 @@
+package models
+
+import "time"
+
+// Session — вход пользователя на одном устройстве: от входа до выхода или отзыва.
+// Refresh-токены сессии сменяют друг друга при ротации, а access-токены несут её ID (claim sid),
+// поэтому отозванная сессия перестаёт приниматься сразу, не дожидаясь истечения access-токена.
+type Session struct {
+	ID     int64
+	UserID int64
+	// UserAgent — User-Agent клиента или имя устройства, переданное при входе
+	UserAgent  string
+	IP         string // IP-адрес, с которого выполнен вход
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	ExpiresAt  time.Time // продлевается при каждом обновлении токенов
+	RevokedAt  *time.Time
+}
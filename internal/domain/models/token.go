@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Назначения одноразовых токенов
+const (
+	TokenPurposeEmailVerification = "email_verification" // подтверждение email после регистрации
+	TokenPurposePasswordReset     = "password_reset"     // сброс забытого пароля
+	TokenPurposeTwoFactorLogin    = "two_factor_login"   // вход, ожидающий кода второго фактора
+	TokenPurposeTwoFactorSetup    = "two_factor_setup"   // вход, ожидающий подключения обязательного второго фактора
+)
+
+// OneTimeToken — одноразовый токен с ограниченным сроком действия.
+// В БД хранится только хэш, сам токен знает лишь получатель письма.
+type OneTimeToken struct {
+	UserID    int64
+	Purpose   string
+	TokenHash []byte
+	ExpiresAt time.Time
+}
+
+// RefreshToken — долгоживущий токен для получения новых access-токенов.
+// При каждом обновлении токен отзывается и заменяется новым (ротация).
+type RefreshToken struct {
+	ID         int64
+	UserID     int64
+	SessionID  int64 // 0 — токен выдан до появления сессий
+	TokenHash  []byte
+	Device     string // метка устройства, например User-Agent клиента
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	RevokedAt  *time.Time
+	ReplacedBy *int64 // токен, выданный взамен при ротации
+}
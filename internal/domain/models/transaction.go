@@ -2,6 +2,13 @@ package models
 
 import "time"
 
+// Типы операций с монетами
+const (
+	CoinTxTransferSent     = "transfer_sent"     // отправленный перевод
+	CoinTxTransferReceived = "transfer_received" // полученный перевод
+	CoinTxPurchase         = "purchase"          // списание за покупку мерча
+)
+
 // CoinTransaction представляет операцию с монетами.
 type CoinTransaction struct {
 	ID            int64     `json:"id"`
@@ -9,5 +16,7 @@ type CoinTransaction struct {
 	Amount        int       `json:"amount"`
 	Type          string    `json:"type"` // например, "transfer_sent" или "transfer_received"
 	RelatedUserID *int64    `json:"related_user_id,omitempty"`
+	OrderID       *int64    `json:"order_id,omitempty"` // заказ, за который списаны монеты (для покупок)
+	MerchName     string    `json:"merch_name"`         // Имя товара заказа; заполняется через JOIN
 	CreatedAt     time.Time `json:"created_at"`
 }
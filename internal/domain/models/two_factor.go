@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// TwoFactor — секрет TOTP пользователя. Пока ConfirmedAt пуст, подключение не завершено
+// и второй фактор при входе не запрашивается.
+type TwoFactor struct {
+	UserID       int64
+	Secret       []byte
+	ConfirmedAt  *time.Time
+	LastUsedStep int64 // последний принятый шаг TOTP: один код нельзя использовать дважды
+}
+
+// Enabled сообщает, что подключение второго фактора подтверждено
+func (t *TwoFactor) Enabled() bool {
+	return t != nil && t.ConfirmedAt != nil
+}
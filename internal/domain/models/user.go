@@ -6,4 +6,7 @@ type User struct {
 	Email       string
 	PassHash    []byte
 	CoinBalance int
+	// EmailVerified — email подтверждён; без подтверждения нельзя переводить монеты и покупать
+	EmailVerified bool
+	Role          Role
 }
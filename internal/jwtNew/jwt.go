@@ -2,8 +2,9 @@ package security
 
 import (
 	"context"
-	"errors"
-	"os"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -11,19 +12,36 @@ import (
 )
 
 // NewToken генерирует JWT-токен для указанного пользователя с заданным временем жизни.
-func NewToken(ctx context.Context, user *models.User, ttl time.Duration) (string, error) {
+// Токен подписывается активным ключом набора, его kid указывается в заголовке.
+// Каждый токен получает уникальный jti, по которому его можно отозвать. Токен сессии
+// (sessionID не 0) несёт её ID в claim sid и перестаёт приниматься вместе с отзывом сессии.
+func (k *KeySet) NewToken(ctx context.Context, user *models.User, sessionID int64, ttl time.Duration) (string, error) {
+	jti, err := newTokenID()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
 	claims := jwt.MapClaims{
 		"user_id": user.ID,
 		"email":   user.Email,
-		"exp":     time.Now().Add(ttl).Unix(),
-		"iat":     time.Now().Unix(),
+		"role":    string(user.Role),
+		"jti":     jti,
+		"exp":     now.Add(ttl).Unix(),
+		// iat с миллисекундами: по нему токен сравнивается с tokens_valid_after пользователя,
+		// и токен, выданный сразу после «выхода на всех устройствах», не должен считаться отозванным
+		"iat": float64(now.UnixMilli()) / 1000,
+	}
+	if sessionID != 0 {
+		claims["sid"] = sessionID
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return k.sign(claims)
+}
 
-	secretStr := os.Getenv("JWT_SECRET")
-	if secretStr == "" {
-		return "", errors.New("JWT_SECRET environment variable is not set")
+// newTokenID генерирует случайный идентификатор токена (claim jti)
+func newTokenID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token id: %w", err)
 	}
-	secret := []byte(secretStr)
-	return token.SignedString(secret)
+	return hex.EncodeToString(b), nil
 }
@@ -2,73 +2,269 @@ package jwtmiddleware
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"math"
 	"net/http"
-	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/linemk/avito-shop/internal/domain/models"
+	security "github.com/linemk/avito-shop/internal/jwtNew"
 )
 
 type contextKey string
 
-const UserIDKey contextKey = "userID"
+const (
+	UserIDKey contextKey = "userID"
+	TokenKey  contextKey = "token"
+	RoleKey   contextKey = "role"
+	ScopesKey contextKey = "scopes"
+)
 
-// NewJWTMiddleware создаёт middleware для проверки JWT, секрет берётся из переменной окружения.
-func NewJWTMiddleware() func(http.Handler) http.Handler {
-	// Можно также принять секрет как параметр, если не хочется брать его внутри.
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		panic("JWT_SECRET is not set")
-	}
+var (
+	// ErrTokenRevoked возвращается RevocationChecker для отозванного токена
+	ErrTokenRevoked = errors.New("token revoked")
+	// ErrInvalidToken возвращается PersonalTokenAuthenticator для неизвестного, истёкшего или отозванного токена
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+// RevocationChecker проверяет, не отозван ли токен (logout, «выйти на всех устройствах»).
+type RevocationChecker interface {
+	// CheckAccessToken возвращает ErrTokenRevoked, если токен или его сессия отозваны.
+	CheckAccessToken(ctx context.Context, userID int64, token TokenInfo) error
+}
+
+// TokenInfo — сведения о проверенном access-токене, нужные для его отзыва
+type TokenInfo struct {
+	ID        string // jti
+	IssuedAt  time.Time
+	ExpiresAt time.Time
+	SessionID int64 // sid; 0 — токен выдан до появления сессий
+}
+
+// PersonalTokenIdentity — владелец и права проверенного персонального токена
+type PersonalTokenIdentity struct {
+	UserID int64
+	Role   models.Role
+	Scopes []models.Scope
+}
+
+// PersonalTokenAuthenticator проверяет персональные токены доступа.
+type PersonalTokenAuthenticator interface {
+	// AuthenticatePersonalToken возвращает владельца и права токена или ErrInvalidToken.
+	AuthenticatePersonalToken(ctx context.Context, token string) (*PersonalTokenIdentity, error)
+}
+
+// NewJWTMiddleware создаёт middleware для проверки JWT. Подпись проверяется ключом из keys
+// по kid из заголовка токена; кроме подписи и срока действия проверяется, что токен не отозван.
+func NewJWTMiddleware(keys *security.KeySet, revocations RevocationChecker) func(http.Handler) http.Handler {
+	parser := jwt.NewParser(jwt.WithValidMethods(keys.Methods()))
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			// Извлекаем токен из заголовка Authorization (формат: "Bearer <token>")
 			authHeader := r.Header.Get("Authorization")
 			if authHeader == "" {
-				http.Error(w, "missing token", http.StatusUnauthorized)
+				unauthorized(w, "missing token")
 				return
 			}
 			parts := strings.Split(authHeader, " ")
 			if len(parts) != 2 || parts[0] != "Bearer" {
-				http.Error(w, "invalid token format", http.StatusUnauthorized)
+				unauthorized(w, "invalid token format")
 				return
 			}
 			tokenStr := parts[1]
 
-			// Парсинг и проверка токена
-			token, err := jwt.Parse(tokenStr, func(t *jwt.Token) (interface{}, error) {
-				// Проверка алгоритма
-				if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
-					return nil, errors.New("unexpected signing method")
-				}
-				return []byte(secret), nil
-			})
+			// Парсинг и проверка токена; ключ и алгоритм выбирает набор ключей
+			token, err := parser.Parse(tokenStr, keys.Keyfunc)
 			if err != nil || !token.Valid {
-				http.Error(w, "invalid token", http.StatusUnauthorized)
+				unauthorized(w, "invalid token")
 				return
 			}
 
 			claims, ok := token.Claims.(jwt.MapClaims)
 			if !ok {
-				http.Error(w, "invalid token claims", http.StatusUnauthorized)
+				unauthorized(w, "invalid token claims")
 				return
 			}
 			// Извлекаем, например, user_id
 			userID, ok := claims["user_id"].(float64) // jwt.MapClaims использует float64 для числовых значений
 			if !ok {
-				http.Error(w, "invalid token claims", http.StatusUnauthorized)
+				unauthorized(w, "invalid token claims")
+				return
+			}
+			info, ok := tokenInfo(claims)
+			if !ok {
+				unauthorized(w, "invalid token claims")
+				return
+			}
+
+			// Проверка отзыва: jti в списке отозванных, токен выдан до tokens_valid_after или его сессия отозвана
+			if err := revocations.CheckAccessToken(r.Context(), int64(userID), info); err != nil {
+				if errors.Is(err, ErrTokenRevoked) {
+					unauthorized(w, "token revoked")
+					return
+				}
+				writeError(w, http.StatusInternalServerError, "internal_error", "internal server error")
 				return
 			}
-			// Устанавливаем userID в контекст запроса
+
+			// Токены без роли выданы до её появления: у их владельцев наименьшие права
+			role := models.RoleEmployee
+			if claim, ok := claims["role"].(string); ok && models.Role(claim).Valid() {
+				role = models.Role(claim)
+			}
+
+			// Устанавливаем userID, роль и сведения о токене в контекст запроса
 			ctx := context.WithValue(r.Context(), UserIDKey, int64(userID))
+			ctx = context.WithValue(ctx, TokenKey, info)
+			ctx = context.WithValue(ctx, RoleKey, role)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+// WithPersonalTokens дополняет middleware проверки JWT приёмом персональных токенов: токены
+// с префиксом models.PersonalTokenPrefix проверяет tokens, остальные передаются jwtMiddleware.
+// Для персонального токена в контекст кроме userID и роли записываются его права (ScopesFromContext).
+func WithPersonalTokens(jwtMiddleware func(http.Handler) http.Handler, tokens PersonalTokenAuthenticator) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		jwtNext := jwtMiddleware(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			tokenStr, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+			if !ok || !strings.HasPrefix(tokenStr, models.PersonalTokenPrefix) {
+				jwtNext.ServeHTTP(w, r)
+				return
+			}
+
+			identity, err := tokens.AuthenticatePersonalToken(r.Context(), tokenStr)
+			if err != nil {
+				if errors.Is(err, ErrInvalidToken) {
+					unauthorized(w, "invalid token")
+					return
+				}
+				writeError(w, http.StatusInternalServerError, "internal_error", "internal server error")
+				return
+			}
+
+			ctx := context.WithValue(r.Context(), UserIDKey, identity.UserID)
+			ctx = context.WithValue(ctx, RoleKey, identity.Role)
+			ctx = context.WithValue(ctx, ScopesKey, identity.Scopes)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// tokenInfo извлекает jti, iat, exp и необязательный sid. iat может содержать доли секунды.
+func tokenInfo(claims jwt.MapClaims) (TokenInfo, bool) {
+	jti, ok := claims["jti"].(string)
+	if !ok || jti == "" {
+		return TokenInfo{}, false
+	}
+	iat, ok := claims["iat"].(float64)
+	if !ok {
+		return TokenInfo{}, false
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return TokenInfo{}, false
+	}
+	var sessionID int64
+	if claim, ok := claims["sid"]; ok {
+		sid, ok := claim.(float64)
+		if !ok {
+			return TokenInfo{}, false
+		}
+		sessionID = int64(sid)
+	}
+	return TokenInfo{
+		ID:        jti,
+		IssuedAt:  time.UnixMilli(int64(math.Round(iat * 1000))),
+		ExpiresAt: time.Unix(int64(exp), 0),
+		SessionID: sessionID,
+	}, true
+}
+
+// unauthorized отвечает 401 в формате ErrorResponse из OpenAPI
+func unauthorized(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusUnauthorized, "unauthorized", message)
+}
+
+// writeError отвечает ошибкой в формате ErrorResponse из OpenAPI
+func writeError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(struct {
+		Errors string `json:"errors"`
+		Code   string `json:"code"`
+	}{Errors: message, Code: code})
+}
+
 // FromContext извлекает userID из контекста.
 func FromContext(ctx context.Context) (int64, bool) {
 	id, ok := ctx.Value(UserIDKey).(int64)
 	return id, ok
 }
+
+// RoleFromContext извлекает роль пользователя из контекста.
+func RoleFromContext(ctx context.Context) (models.Role, bool) {
+	role, ok := ctx.Value(RoleKey).(models.Role)
+	return role, ok
+}
+
+// RequireRole пропускает запрос, только если роль из токена входит в roles; иначе отвечает 403.
+// Применяется после NewJWTMiddleware. Роль в токене обновляется при следующем refresh:
+// после изменения роли ранее выданные access-токены отзываются.
+func RequireRole(roles ...models.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			role, ok := RoleFromContext(r.Context())
+			if !ok {
+				unauthorized(w, "unauthorized")
+				return
+			}
+			if !slices.Contains(roles, role) {
+				writeError(w, http.StatusForbidden, "forbidden", "insufficient role")
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ScopesFromContext извлекает права персонального токена. Для запроса с access-токеном сессии
+// возвращает false: права сессии ограничены только ролью.
+func ScopesFromContext(ctx context.Context) ([]models.Scope, bool) {
+	scopes, ok := ctx.Value(ScopesKey).([]models.Scope)
+	return scopes, ok
+}
+
+// RequireScope пропускает запрос с персональным токеном, только если у токена есть все права scopes;
+// иначе отвечает 403. Запросы с access-токеном сессии пропускаются без проверки.
+func RequireScope(scopes ...models.Scope) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			granted, ok := ScopesFromContext(r.Context())
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			for _, scope := range scopes {
+				if !slices.Contains(granted, scope) {
+					writeError(w, http.StatusForbidden, "forbidden", "insufficient scope")
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// TokenFromContext извлекает сведения о текущем access-токене из контекста.
+func TokenFromContext(ctx context.Context) (TokenInfo, bool) {
+	info, ok := ctx.Value(TokenKey).(TokenInfo)
+	return info, ok
+}
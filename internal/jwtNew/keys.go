@@ -0,0 +1,268 @@
+package security
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/linemk/avito-shop/internal/config"
+)
+
+// hmacKeyID — kid токенов, подписанных общим секретом (HS256)
+const hmacKeyID = "hs256"
+
+// minRSAKeyBits — минимальная длина RSA-ключа
+const minRSAKeyBits = 2048
+
+// signingKey — ключ подписи или проверки токенов
+type signingKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.PrivateKey // nil для ключей, которые только проверяют подпись
+	public  crypto.PublicKey  // для HS256 — сам секрет ([]byte)
+}
+
+// KeySet хранит ключ, которым подписываются новые токены, и все ключи, которыми
+// проверяется подпись. Старые ключи остаются в наборе на время ротации, пока не истекут
+// выданные ими токены.
+type KeySet struct {
+	signing *signingKey
+	keys    map[string]*signingKey // ключ — kid
+	order   []string               // порядок публикации в JWKS
+}
+
+// JWK — открытый ключ в формате RFC 7517 для публикации в /.well-known/jwks.json
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`   // RSA: модуль
+	E   string `json:"e,omitempty"`   // RSA: экспонента
+	Crv string `json:"crv,omitempty"` // OKP: кривая
+	X   string `json:"x,omitempty"`   // OKP: открытый ключ
+}
+
+// LoadKeySet создаёт набор ключей из конфигурации. Если ключи не заданы, токены подписываются
+// общим секретом (HS256); такие токены могут проверить только сервисы, знающие секрет.
+func LoadKeySet(cfg config.JWTConfig) (*KeySet, error) {
+	if len(cfg.Keys) == 0 {
+		if cfg.Secret == "" {
+			return nil, errors.New("neither jwt keys nor JWT_SECRET are configured")
+		}
+		return NewHMACKeySet(cfg.Secret), nil
+	}
+	if cfg.SigningKeyID == "" {
+		return nil, errors.New("jwt signing_key_id is not set")
+	}
+
+	ks := &KeySet{keys: make(map[string]*signingKey)}
+	for _, kc := range cfg.Keys {
+		key, err := loadKey(kc)
+		if err != nil {
+			return nil, fmt.Errorf("jwt key %q: %w", kc.ID, err)
+		}
+		if _, ok := ks.keys[key.id]; ok {
+			return nil, fmt.Errorf("duplicate jwt key id %q", key.id)
+		}
+		ks.keys[key.id] = key
+		ks.order = append(ks.order, key.id)
+	}
+
+	signing, ok := ks.keys[cfg.SigningKeyID]
+	if !ok {
+		return nil, fmt.Errorf("jwt signing key %q not found", cfg.SigningKeyID)
+	}
+	if signing.private == nil {
+		return nil, fmt.Errorf("jwt signing key %q has no private key", cfg.SigningKeyID)
+	}
+	ks.signing = signing
+	return ks, nil
+}
+
+// NewHMACKeySet создаёт набор из одного общего секрета (HS256).
+func NewHMACKeySet(secret string) *KeySet {
+	key := &signingKey{
+		id:      hmacKeyID,
+		method:  jwt.SigningMethodHS256,
+		private: []byte(secret),
+		public:  []byte(secret),
+	}
+	return &KeySet{signing: key, keys: map[string]*signingKey{key.id: key}, order: []string{key.id}}
+}
+
+// sign подписывает claims активным ключом и указывает его kid в заголовке
+func (k *KeySet) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(k.signing.method, claims)
+	token.Header["kid"] = k.signing.id
+	return token.SignedString(k.signing.private)
+}
+
+// Keyfunc выбирает ключ проверки по kid из заголовка токена. Алгоритм токена должен
+// совпадать с алгоритмом ключа, иначе открытый ключ можно было бы подставить как HMAC-секрет.
+// Токен без kid проверяется активным ключом.
+func (k *KeySet) Keyfunc(t *jwt.Token) (interface{}, error) {
+	key := k.signing
+	if kid, ok := t.Header["kid"].(string); ok {
+		if key, ok = k.keys[kid]; !ok {
+			return nil, fmt.Errorf("unknown key id %q", kid)
+		}
+	}
+	if t.Method.Alg() != key.method.Alg() {
+		return nil, errors.New("unexpected signing method")
+	}
+	return key.public, nil
+}
+
+// Methods возвращает алгоритмы всех ключей набора для jwt.WithValidMethods.
+func (k *KeySet) Methods() []string {
+	seen := make(map[string]bool)
+	var methods []string
+	for _, id := range k.order {
+		alg := k.keys[id].method.Alg()
+		if !seen[alg] {
+			seen[alg] = true
+			methods = append(methods, alg)
+		}
+	}
+	return methods
+}
+
+// PublicKeys возвращает открытые ключи для JWKS. Общий секрет HS256 не публикуется.
+func (k *KeySet) PublicKeys() []JWK {
+	keys := make([]JWK, 0, len(k.order))
+	for _, id := range k.order {
+		key := k.keys[id]
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			keys = append(keys, JWK{
+				Kty: "RSA",
+				Kid: key.id,
+				Use: "sig",
+				Alg: key.method.Alg(),
+				N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+			})
+		case ed25519.PublicKey:
+			keys = append(keys, JWK{
+				Kty: "OKP",
+				Kid: key.id,
+				Use: "sig",
+				Alg: key.method.Alg(),
+				Crv: "Ed25519",
+				X:   base64.RawURLEncoding.EncodeToString(pub),
+			})
+		}
+	}
+	return keys
+}
+
+// loadKey читает ключ из PEM-файла. Для ключа с закрытой частью открытая выводится из неё.
+func loadKey(kc config.JWTKeyConfig) (*signingKey, error) {
+	if kc.ID == "" {
+		return nil, errors.New("id is required")
+	}
+	key := &signingKey{id: kc.ID}
+	switch {
+	case kc.PrivateKeyPath != "":
+		block, err := readPEM(kc.PrivateKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		private, err := parsePrivateKey(block)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := private.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported key type %T", private)
+		}
+		key.private = private
+		key.public = signer.Public()
+	case kc.PublicKeyPath != "":
+		block, err := readPEM(kc.PublicKeyPath)
+		if err != nil {
+			return nil, err
+		}
+		public, err := parsePublicKey(block)
+		if err != nil {
+			return nil, err
+		}
+		key.public = public
+	default:
+		return nil, errors.New("private_key_path or public_key_path is required")
+	}
+
+	switch pub := key.public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("rsa key must be at least %d bits", minRSAKeyBits)
+		}
+		key.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		key.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", key.public)
+	}
+	return key, nil
+}
+
+func readPEM(path string) (*pem.Block, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read key file: %w", err)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data in %s", path)
+	}
+	return block, nil
+}
+
+// parsePrivateKey поддерживает PKCS#8 (RSA и Ed25519) и PKCS#1 (RSA)
+func parsePrivateKey(block *pem.Block) (crypto.PrivateKey, error) {
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		return key, nil
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// parsePublicKey поддерживает PKIX (RSA и Ed25519) и PKCS#1 (RSA)
+func parsePublicKey(block *pem.Block) (crypto.PublicKey, error) {
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		return key, nil
+	case "RSA PUBLIC KEY":
+		key, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		return key, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
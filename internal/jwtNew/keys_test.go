@@ -0,0 +1,157 @@
+package security_test
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/linemk/avito-shop/internal/config"
+	"github.com/linemk/avito-shop/internal/domain/models"
+	security "github.com/linemk/avito-shop/internal/jwtNew"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePEM записывает PEM-блок во временный файл и возвращает путь к нему
+func writePEM(t *testing.T, name, blockType string, der []byte) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0o600))
+	return path
+}
+
+func newRSAKeyFiles(t *testing.T) (privatePath, publicPath string) {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	pubDER, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	require.NoError(t, err)
+	return writePEM(t, "rsa.pem", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(key)),
+		writePEM(t, "rsa.pub.pem", "PUBLIC KEY", pubDER)
+}
+
+func newEd25519KeyFile(t *testing.T) string {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	require.NoError(t, err)
+	return writePEM(t, "ed25519.pem", "PRIVATE KEY", der)
+}
+
+func parse(keys *security.KeySet, token string) (*jwt.Token, error) {
+	return jwt.NewParser(jwt.WithValidMethods(keys.Methods())).Parse(token, keys.Keyfunc)
+}
+
+func TestKeySet_RotationKeepsOldTokensValid(t *testing.T) {
+	rsaPrivate, rsaPublic := newRSAKeyFiles(t)
+	edPrivate := newEd25519KeyFile(t)
+	user := &models.User{ID: 1, Email: "test@example.com"}
+
+	// Старый ключ — RS256.
+	oldKeys, err := security.LoadKeySet(config.JWTConfig{
+		SigningKeyID: "2026-04",
+		Keys:         []config.JWTKeyConfig{{ID: "2026-04", PrivateKeyPath: rsaPrivate}},
+	})
+	require.NoError(t, err)
+	oldToken, err := oldKeys.NewToken(context.Background(), user, 0, time.Hour)
+	require.NoError(t, err)
+
+	// После ротации подписывает EdDSA-ключ, RSA-ключ остаётся только для проверки.
+	keys, err := security.LoadKeySet(config.JWTConfig{
+		SigningKeyID: "2026-10",
+		Keys: []config.JWTKeyConfig{
+			{ID: "2026-10", PrivateKeyPath: edPrivate},
+			{ID: "2026-04", PublicKeyPath: rsaPublic},
+		},
+	})
+	require.NoError(t, err)
+	newToken, err := keys.NewToken(context.Background(), user, 0, time.Hour)
+	require.NoError(t, err)
+
+	parsed, err := parse(keys, newToken)
+	require.NoError(t, err)
+	assert.Equal(t, "2026-10", parsed.Header["kid"])
+	assert.Equal(t, "EdDSA", parsed.Method.Alg())
+
+	parsed, err = parse(keys, oldToken)
+	require.NoError(t, err, "Tokens signed with the previous key stay valid during rotation")
+	assert.Equal(t, "2026-04", parsed.Header["kid"])
+
+	// Набор без старого ключа его токены не принимает.
+	_, err = parse(edOnlyKeySet(t, edPrivate), oldToken)
+	assert.Error(t, err)
+
+	jwks := keys.PublicKeys()
+	require.Len(t, jwks, 2)
+	assert.Equal(t, security.JWK{Kty: "OKP", Kid: "2026-10", Use: "sig", Alg: "EdDSA", Crv: "Ed25519", X: jwks[0].X}, jwks[0])
+	assert.Equal(t, "RSA", jwks[1].Kty)
+	assert.Equal(t, "AQAB", jwks[1].E)
+	assert.NotEmpty(t, jwks[1].N)
+}
+
+// edOnlyKeySet создаёт набор только из EdDSA-ключа
+func edOnlyKeySet(t *testing.T, edPrivate string) *security.KeySet {
+	t.Helper()
+	keys, err := security.LoadKeySet(config.JWTConfig{
+		SigningKeyID: "2026-10",
+		Keys:         []config.JWTKeyConfig{{ID: "2026-10", PrivateKeyPath: edPrivate}},
+	})
+	require.NoError(t, err)
+	return keys
+}
+
+func TestKeySet_RejectsAlgorithmMismatch(t *testing.T) {
+	_, rsaPublic := newRSAKeyFiles(t)
+	edPrivate := newEd25519KeyFile(t)
+	keys, err := security.LoadKeySet(config.JWTConfig{
+		SigningKeyID: "ed",
+		Keys: []config.JWTKeyConfig{
+			{ID: "ed", PrivateKeyPath: edPrivate},
+			{ID: "rsa", PublicKeyPath: rsaPublic},
+		},
+	})
+	require.NoError(t, err)
+
+	// Токен, подписанный HS256 содержимым открытого ключа, с kid RSA-ключа.
+	pubPEM, err := os.ReadFile(rsaPublic)
+	require.NoError(t, err)
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"user_id": 1, "exp": time.Now().Add(time.Hour).Unix()})
+	forged.Header["kid"] = "rsa"
+	forgedStr, err := forged.SignedString(pubPEM)
+	require.NoError(t, err)
+
+	_, err = parse(keys, forgedStr)
+	assert.Error(t, err)
+}
+
+func TestLoadKeySet_Errors(t *testing.T) {
+	_, rsaPublic := newRSAKeyFiles(t)
+
+	_, err := security.LoadKeySet(config.JWTConfig{})
+	assert.Error(t, err, "Either keys or secret are required")
+
+	_, err = security.LoadKeySet(config.JWTConfig{
+		SigningKeyID: "rsa",
+		Keys:         []config.JWTKeyConfig{{ID: "rsa", PublicKeyPath: rsaPublic}},
+	})
+	assert.Error(t, err, "Signing key must have a private part")
+
+	_, err = security.LoadKeySet(config.JWTConfig{
+		SigningKeyID: "missing",
+		Keys:         []config.JWTKeyConfig{{ID: "rsa", PublicKeyPath: rsaPublic}},
+	})
+	assert.Error(t, err)
+
+	keys, err := security.LoadKeySet(config.JWTConfig{Secret: "secret"})
+	require.NoError(t, err)
+	assert.Empty(t, keys.PublicKeys(), "HMAC secret must not be published")
+}
@@ -0,0 +1,69 @@
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Value — кэш одного значения со сквозным чтением: при промахе значение загружает load,
+// остальные читатели ждут эту загрузку, а не обращаются к источнику параллельно.
+// Значение устаревает через ttl или сразу после Invalidate; ttl <= 0 отключает кэширование.
+type Value[T any] struct {
+	ttl  time.Duration
+	load func(ctx context.Context) (T, error)
+
+	mu       sync.RWMutex
+	value    T
+	loaded   bool
+	loadedAt time.Time
+}
+
+// NewValue создаёт кэш значения, которое загружает load.
+func NewValue[T any](ttl time.Duration, load func(ctx context.Context) (T, error)) *Value[T] {
+	return &Value[T]{ttl: ttl, load: load}
+}
+
+// Get возвращает закэшированное значение или загружает его. Ошибка загрузки не кэшируется.
+func (v *Value[T]) Get(ctx context.Context) (T, error) {
+	// без кэша читатели не ждут друг друга: каждый загружает значение сам
+	if v.ttl <= 0 {
+		return v.load(ctx)
+	}
+
+	v.mu.RLock()
+	if v.fresh() {
+		value := v.value
+		v.mu.RUnlock()
+		return value, nil
+	}
+	v.mu.RUnlock()
+
+	// загрузка под блокировкой записи: Invalidate, вызванный во время загрузки,
+	// дождётся её и сбросит значение, прочитанное до изменения источника
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if v.fresh() {
+		return v.value, nil
+	}
+	value, err := v.load(ctx)
+	if err != nil {
+		var zero T
+		return zero, err
+	}
+	v.value, v.loaded, v.loadedAt = value, true, time.Now()
+	return value, nil
+}
+
+// Invalidate сбрасывает значение; следующий Get загрузит его заново.
+func (v *Value[T]) Invalidate() {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	var zero T
+	v.value, v.loaded = zero, false
+}
+
+// fresh сообщает, можно ли отдать сохранённое значение; вызывается под блокировкой
+func (v *Value[T]) fresh() bool {
+	return v.loaded && v.ttl > 0 && time.Since(v.loadedAt) < v.ttl
+}
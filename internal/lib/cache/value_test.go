@@ -0,0 +1,114 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/linemk/avito-shop/internal/lib/cache"
+)
+
+func TestValue_ReadThrough(t *testing.T) {
+	var loads atomic.Int32
+	ttl := 200 * time.Millisecond
+	v := cache.NewValue(ttl, func(ctx context.Context) (int32, error) {
+		return loads.Add(1), nil
+	})
+	ctx := context.Background()
+
+	got, err := v.Get(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int32(1), got)
+	got, _ = v.Get(ctx)
+	assert.Equal(t, int32(1), got, "Value is served from cache")
+
+	v.Invalidate()
+	got, _ = v.Get(ctx)
+	assert.Equal(t, int32(2), got, "Invalidate forces a reload")
+
+	time.Sleep(ttl)
+	got, _ = v.Get(ctx)
+	assert.Equal(t, int32(3), got, "Expired value is reloaded")
+}
+
+func TestValue_ErrorNotCached(t *testing.T) {
+	fail := true
+	v := cache.NewValue(time.Minute, func(ctx context.Context) (string, error) {
+		if fail {
+			return "", errors.New("db is down")
+		}
+		return "catalog", nil
+	})
+
+	_, err := v.Get(context.Background())
+	assert.Error(t, err)
+	fail = false
+	got, err := v.Get(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, "catalog", got)
+}
+
+func TestValue_ConcurrentMissLoadsOnce(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	v := cache.NewValue(time.Minute, func(ctx context.Context) (int, error) {
+		loads.Add(1)
+		<-release
+		return 42, nil
+	})
+
+	var wg sync.WaitGroup
+	for range 10 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got, err := v.Get(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, 42, got)
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	assert.Equal(t, int32(1), loads.Load())
+}
+
+func TestValue_ZeroTTLDisablesCache(t *testing.T) {
+	var loads atomic.Int32
+	v := cache.NewValue(0, func(ctx context.Context) (int32, error) {
+		return loads.Add(1), nil
+	})
+	_, _ = v.Get(context.Background())
+	_, _ = v.Get(context.Background())
+	assert.Equal(t, int32(2), loads.Load())
+}
+
+func TestValue_ZeroTTLLoadsConcurrently(t *testing.T) {
+	var loads atomic.Int32
+	release := make(chan struct{})
+	v := cache.NewValue(0, func(ctx context.Context) (int, error) {
+		loads.Add(1)
+		<-release
+		return 42, nil
+	})
+
+	var wg sync.WaitGroup
+	for range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := v.Get(context.Background())
+			assert.NoError(t, err)
+		}()
+	}
+	// все загрузки начались до того, как первая завершилась: блокировки нет
+	assert.Eventually(t, func() bool { return loads.Load() == 3 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+}
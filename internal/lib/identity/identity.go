@@ -0,0 +1,30 @@
+package identity
+
+import "errors"
+
+// имена провайдеров учётных записей; под этими именами провайдеры указываются в конфиге
+// и запоминаются в связке внешней учётной записи с пользователем магазина
+const (
+	ProviderLocal = "local"
+	ProviderLDAP  = "ldap"
+	ProviderOIDC  = "oidc"
+)
+
+var (
+	// ErrInvalidCredentials возвращается, если провайдер знает пользователя, но пароль или код неверен
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	// ErrUnknownUser возвращается, если провайдер не знает пользователя; тогда проверяется следующий провайдер
+	ErrUnknownUser = errors.New("unknown user")
+)
+
+// Identity — учётная запись, подтверждённая провайдером.
+type Identity struct {
+	// Provider — имя провайдера, Subject — неизменяемый идентификатор учётной записи у провайдера.
+	// Пара (Provider, Subject) связывается с пользователем магазина при первом входе.
+	Provider string
+	Subject  string
+	Email    string
+	// EmailVerified — провайдер подтверждает, что адрес принадлежит пользователю. Только такой
+	// адрес можно использовать, чтобы связать учётную запись с уже существующим пользователем.
+	EmailVerified bool
+}
@@ -0,0 +1,137 @@
+package identity
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/go-ldap/ldap/v3"
+	"github.com/linemk/avito-shop/internal/config"
+)
+
+// LDAPProvider проверяет логин и пароль в каталоге LDAP: запись пользователя ищется по фильтру
+// (от имени служебной учётной записи или анонимно), затем выполняется bind с DN найденной записи
+// и введённым паролем. Соединение открывается на каждую проверку.
+type LDAPProvider struct {
+	cfg config.LDAPConfig
+}
+
+// NewLDAPProvider создаёт провайдер LDAP по настройкам из конфига.
+func NewLDAPProvider(cfg config.LDAPConfig) (*LDAPProvider, error) {
+	if cfg.URL == "" || cfg.BaseDN == "" {
+		return nil, errors.New("ldap url and base_dn are required")
+	}
+	if strings.Count(cfg.UserFilter, "%s") != 1 {
+		return nil, errors.New("ldap user_filter must contain exactly one %s")
+	}
+	if cfg.EmailAttribute == "" {
+		return nil, errors.New("ldap email_attribute is required")
+	}
+	return &LDAPProvider{cfg: cfg}, nil
+}
+
+// Name возвращает имя провайдера.
+func (p *LDAPProvider) Name() string {
+	return ProviderLDAP
+}
+
+// Authenticate проверяет пароль пользователя username. Пользователь, которого нет в каталоге, —
+// ErrUnknownUser, неверный пароль — ErrInvalidCredentials. Email из каталога считается
+// подтверждённым; запись без email возвращается с пустым адресом.
+func (p *LDAPProvider) Authenticate(ctx context.Context, username, password string) (*Identity, error) {
+	const op = "identity.LDAPProvider.Authenticate"
+
+	// пустой пароль сервер LDAP принял бы как анонимный bind (RFC 4513, 5.1.2)
+	if password == "" {
+		return nil, ErrInvalidCredentials
+	}
+
+	conn, err := p.dial(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer conn.Close()
+
+	if p.cfg.BindDN != "" {
+		if err := conn.Bind(p.cfg.BindDN, p.cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("%s: service account bind failed: %w", op, err)
+		}
+	}
+
+	attributes := []string{p.cfg.EmailAttribute}
+	if p.cfg.SubjectAttribute != "" {
+		attributes = append(attributes, p.cfg.SubjectAttribute)
+	}
+	res, err := conn.Search(ldap.NewSearchRequest(
+		p.cfg.BaseDN, ldap.ScopeWholeSubtree, ldap.NeverDerefAliases,
+		2, int(p.cfg.Timeout.Seconds()), false,
+		fmt.Sprintf(p.cfg.UserFilter, ldap.EscapeFilter(username)),
+		attributes, nil,
+	))
+	if err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultSizeLimitExceeded) {
+			return nil, fmt.Errorf("%s: user filter matches more than one entry", op)
+		}
+		return nil, fmt.Errorf("%s: search failed: %w", op, err)
+	}
+	switch len(res.Entries) {
+	case 0:
+		return nil, ErrUnknownUser
+	case 1:
+	default:
+		return nil, fmt.Errorf("%s: user filter matches more than one entry", op)
+	}
+	entry := res.Entries[0]
+
+	if err := conn.Bind(entry.DN, password); err != nil {
+		if ldap.IsErrorWithCode(err, ldap.LDAPResultInvalidCredentials) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%s: user bind failed: %w", op, err)
+	}
+
+	subject := entry.DN
+	if p.cfg.SubjectAttribute != "" {
+		if value := entry.GetAttributeValue(p.cfg.SubjectAttribute); value != "" {
+			subject = value
+		}
+	}
+	email := entry.GetAttributeValue(p.cfg.EmailAttribute)
+	return &Identity{
+		Provider:      ProviderLDAP,
+		Subject:       subject,
+		Email:         email,
+		EmailVerified: email != "",
+	}, nil
+}
+
+// dial открывает соединение с сервером; при start_tls соединение сразу переводится на TLS
+func (p *LDAPProvider) dial(ctx context.Context) (*ldap.Conn, error) {
+	dialer := &net.Dialer{Timeout: p.cfg.Timeout}
+	if deadline, ok := ctx.Deadline(); ok {
+		dialer.Deadline = deadline
+	}
+	conn, err := ldap.DialURL(p.cfg.URL, ldap.DialWithDialer(dialer))
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	if p.cfg.Timeout > 0 {
+		conn.SetTimeout(p.cfg.Timeout)
+	}
+	if p.cfg.StartTLS {
+		u, err := url.Parse(p.cfg.URL)
+		if err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to parse url: %w", err)
+		}
+		if err := conn.StartTLS(&tls.Config{ServerName: u.Hostname()}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("failed to start tls: %w", err)
+		}
+	}
+	return conn, nil
+}
@@ -0,0 +1,217 @@
+package identity_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	ber "github.com/go-asn1-ber/asn1-ber"
+	"github.com/go-ldap/ldap/v3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/linemk/avito-shop/internal/config"
+	"github.com/linemk/avito-shop/internal/lib/identity"
+)
+
+// fakeLDAPEntry — запись каталога fakeLDAPServer
+type fakeLDAPEntry struct {
+	dn         string
+	password   string
+	attributes map[string]string
+}
+
+// fakeLDAPServer — сервер LDAP в памяти процесса. Понимает только простой bind, поиск
+// по фильтру равенства одного атрибута и unbind — ровно то, что использует LDAPProvider.
+type fakeLDAPServer struct {
+	entries []fakeLDAPEntry
+	binds   atomic.Int32
+}
+
+// start запускает сервер на случайном порту и возвращает его адрес ldap://
+func (s *fakeLDAPServer) start(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return "ldap://" + listener.Addr().String()
+}
+
+func (s *fakeLDAPServer) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		packet, err := ber.ReadPacket(conn)
+		if err != nil || len(packet.Children) < 2 {
+			return
+		}
+		messageID := packet.Children[0].Value
+		op := packet.Children[1]
+		switch op.Tag {
+		case ldap.ApplicationBindRequest:
+			s.binds.Add(1)
+			dn := op.Children[1].Value.(string)
+			password := op.Children[2].Data.String()
+			code := uint16(ldap.LDAPResultInvalidCredentials)
+			for _, e := range s.entries {
+				if e.dn == dn && e.password == password {
+					code = ldap.LDAPResultSuccess
+				}
+			}
+			s.write(conn, messageID, result(ldap.ApplicationBindResponse, code))
+		case ldap.ApplicationSearchRequest:
+			filter, err := ldap.DecompileFilter(op.Children[6])
+			if err != nil {
+				s.write(conn, messageID, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultProtocolError))
+				continue
+			}
+			for _, e := range s.entries {
+				for name, value := range e.attributes {
+					if filter == fmt.Sprintf("(%s=%s)", name, ldap.EscapeFilter(value)) {
+						s.write(conn, messageID, searchEntry(e))
+					}
+				}
+			}
+			s.write(conn, messageID, result(ldap.ApplicationSearchResultDone, ldap.LDAPResultSuccess))
+		default:
+			return
+		}
+	}
+}
+
+func (s *fakeLDAPServer) write(conn net.Conn, messageID any, op *ber.Packet) {
+	packet := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "LDAP Response")
+	packet.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagInteger, messageID, "Message ID"))
+	packet.AppendChild(op)
+	_, _ = conn.Write(packet.Bytes())
+}
+
+// result — ответ на bind или окончание поиска с кодом code
+func result(tag ber.Tag, code uint16) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, tag, nil, "Result")
+	op.AppendChild(ber.NewInteger(ber.ClassUniversal, ber.TypePrimitive, ber.TagEnumerated, int64(code), "Result Code"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Matched DN"))
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, "", "Diagnostic Message"))
+	return op
+}
+
+func searchEntry(e fakeLDAPEntry) *ber.Packet {
+	op := ber.Encode(ber.ClassApplication, ber.TypeConstructed, ldap.ApplicationSearchResultEntry, nil, "Search Result Entry")
+	op.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, e.dn, "Object Name"))
+	attributes := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attributes")
+	for name, value := range e.attributes {
+		attribute := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSequence, nil, "Attribute")
+		attribute.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, name, "Type"))
+		values := ber.Encode(ber.ClassUniversal, ber.TypeConstructed, ber.TagSet, nil, "Values")
+		values.AppendChild(ber.NewString(ber.ClassUniversal, ber.TypePrimitive, ber.TagOctetString, value, "Value"))
+		attribute.AppendChild(values)
+		attributes.AppendChild(attribute)
+	}
+	op.AppendChild(attributes)
+	return op
+}
+
+func newFakeDirectory(t *testing.T) (*fakeLDAPServer, config.LDAPConfig) {
+	server := &fakeLDAPServer{entries: []fakeLDAPEntry{
+		{dn: "cn=shop,ou=services,dc=corp", password: "service-secret"},
+		{dn: "uid=alice,ou=people,dc=corp", password: "corp-secret", attributes: map[string]string{
+			"mail": "alice@corp.example.com", "entryUUID": "5f1c0c1e-alice",
+		}},
+		{dn: "uid=nomail,ou=people,dc=corp", password: "corp-secret", attributes: map[string]string{
+			"uid": "nomail",
+		}},
+	}}
+	return server, config.LDAPConfig{
+		URL:              server.start(t),
+		BindDN:           "cn=shop,ou=services,dc=corp",
+		BindPassword:     "service-secret",
+		BaseDN:           "ou=people,dc=corp",
+		UserFilter:       "(mail=%s)",
+		EmailAttribute:   "mail",
+		SubjectAttribute: "entryUUID",
+		Timeout:          time.Second,
+	}
+}
+
+func TestLDAPProvider_Authenticate(t *testing.T) {
+	server, cfg := newFakeDirectory(t)
+	provider, err := identity.NewLDAPProvider(cfg)
+	require.NoError(t, err)
+	ctx := context.Background()
+
+	ident, err := provider.Authenticate(ctx, "alice@corp.example.com", "corp-secret")
+	require.NoError(t, err)
+	assert.Equal(t, &identity.Identity{
+		Provider:      identity.ProviderLDAP,
+		Subject:       "5f1c0c1e-alice",
+		Email:         "alice@corp.example.com",
+		EmailVerified: true,
+	}, ident)
+
+	_, err = provider.Authenticate(ctx, "alice@corp.example.com", "wrong")
+	assert.ErrorIs(t, err, identity.ErrInvalidCredentials)
+	_, err = provider.Authenticate(ctx, "bob@corp.example.com", "corp-secret")
+	assert.ErrorIs(t, err, identity.ErrUnknownUser)
+	// Спецсимволы фильтра экранируются: «*» не находит всех пользователей
+	_, err = provider.Authenticate(ctx, "*", "corp-secret")
+	assert.ErrorIs(t, err, identity.ErrUnknownUser)
+
+	// Пустой пароль отклоняется без обращения к серверу: иначе bind прошёл бы как анонимный
+	binds := server.binds.Load()
+	_, err = provider.Authenticate(ctx, "alice@corp.example.com", "")
+	assert.ErrorIs(t, err, identity.ErrInvalidCredentials)
+	assert.Equal(t, binds, server.binds.Load())
+}
+
+func TestLDAPProvider_EntryWithoutEmail(t *testing.T) {
+	_, cfg := newFakeDirectory(t)
+	cfg.UserFilter = "(uid=%s)"
+	provider, err := identity.NewLDAPProvider(cfg)
+	require.NoError(t, err)
+
+	// Без entryUUID идентификатором служит DN, без email адрес не считается подтверждённым
+	ident, err := provider.Authenticate(context.Background(), "nomail", "corp-secret")
+	require.NoError(t, err)
+	assert.Equal(t, "uid=nomail,ou=people,dc=corp", ident.Subject)
+	assert.Empty(t, ident.Email)
+	assert.False(t, ident.EmailVerified)
+}
+
+func TestLDAPProvider_ServiceAccountRejected(t *testing.T) {
+	_, cfg := newFakeDirectory(t)
+	cfg.BindPassword = "wrong"
+	provider, err := identity.NewLDAPProvider(cfg)
+	require.NoError(t, err)
+
+	// Ошибка служебной учётной записи — ошибка настройки, а не неверный пароль пользователя
+	_, err = provider.Authenticate(context.Background(), "alice@corp.example.com", "corp-secret")
+	assert.Error(t, err)
+	assert.False(t, errors.Is(err, identity.ErrInvalidCredentials) || errors.Is(err, identity.ErrUnknownUser))
+}
+
+func TestNewLDAPProvider_InvalidConfig(t *testing.T) {
+	valid := config.LDAPConfig{URL: "ldap://localhost", BaseDN: "dc=corp", UserFilter: "(mail=%s)", EmailAttribute: "mail"}
+	_, err := identity.NewLDAPProvider(valid)
+	assert.NoError(t, err)
+
+	noURL := valid
+	noURL.URL = ""
+	_, err = identity.NewLDAPProvider(noURL)
+	assert.Error(t, err)
+
+	badFilter := valid
+	badFilter.UserFilter = "(mail=alice)"
+	_, err = identity.NewLDAPProvider(badFilter)
+	assert.Error(t, err)
+}
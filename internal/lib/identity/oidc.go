@@ -0,0 +1,107 @@
+package identity
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/linemk/avito-shop/internal/config"
+	"golang.org/x/oauth2"
+)
+
+// OIDCProvider реализует вход через OpenID Connect по коду авторизации: пользователь
+// перенаправляется к провайдеру, а код из обратного вызова обменивается на id_token.
+// Подпись, издатель, получатель и срок id_token проверяются по ключам провайдера.
+type OIDCProvider struct {
+	oauth    oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCProvider создаёт провайдер OIDC; настройки провайдера загружаются из
+// {issuer_url}/.well-known/openid-configuration.
+func NewOIDCProvider(ctx context.Context, cfg config.OIDCConfig) (*OIDCProvider, error) {
+	if cfg.IssuerURL == "" || cfg.ClientID == "" || cfg.RedirectURL == "" {
+		return nil, errors.New("oidc issuer_url, client_id and redirect_url are required")
+	}
+	provider, err := oidc.NewProvider(ctx, cfg.IssuerURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover oidc provider: %w", err)
+	}
+	scopes := cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{oidc.ScopeOpenID, "email"}
+	}
+	return &OIDCProvider{
+		oauth: oauth2.Config{
+			ClientID:     cfg.ClientID,
+			ClientSecret: cfg.ClientSecret,
+			Endpoint:     provider.Endpoint(),
+			RedirectURL:  cfg.RedirectURL,
+			Scopes:       scopes,
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: cfg.ClientID}),
+	}, nil
+}
+
+// Name возвращает имя провайдера.
+func (p *OIDCProvider) Name() string {
+	return ProviderOIDC
+}
+
+// AuthCodeURL возвращает адрес, на который перенаправляется пользователь. state возвращается
+// провайдером в обратный вызов без изменений; nonce для id_token вычисляется из state.
+func (p *OIDCProvider) AuthCodeURL(state string) string {
+	return p.oauth.AuthCodeURL(state, oidc.Nonce(nonceFor(state)))
+}
+
+// Exchange обменивает код авторизации на id_token и возвращает учётную запись из него.
+// state — значение, с которым начинался вход. Просроченный или чужой код и id_token,
+// который не прошёл проверку, — ErrInvalidCredentials.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, state string) (*Identity, error) {
+	const op = "identity.OIDCProvider.Exchange"
+
+	token, err := p.oauth.Exchange(ctx, code)
+	if err != nil {
+		var retrieveErr *oauth2.RetrieveError
+		if errors.As(err, &retrieveErr) && retrieveErr.ErrorCode == "invalid_grant" {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("%s: failed to exchange code: %w", op, err)
+	}
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%s: token response has no id_token", op)
+	}
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidCredentials, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(idToken.Nonce), []byte(nonceFor(state))) != 1 {
+		return nil, fmt.Errorf("%w: id_token nonce mismatch", ErrInvalidCredentials)
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%s: failed to parse id_token claims: %w", op, err)
+	}
+	return &Identity{
+		Provider:      ProviderOIDC,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.Email != "" && claims.EmailVerified,
+	}, nil
+}
+
+// nonceFor вычисляет nonce из state: state хранится в cookie браузера, начавшего вход,
+// поэтому id_token, выданный для другого входа, не будет принят
+func nonceFor(state string) string {
+	sum := sha256.Sum256([]byte("nonce:" + state))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
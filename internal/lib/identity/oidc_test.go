@@ -0,0 +1,199 @@
+package identity_test
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/linemk/avito-shop/internal/config"
+	"github.com/linemk/avito-shop/internal/lib/identity"
+)
+
+// fakeOIDCServer — провайдер OpenID Connect в памяти процесса: отдаёт настройки, ключи
+// и обменивает выданные коды на id_token, подписанный RS256.
+type fakeOIDCServer struct {
+	*httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]jwt.MapClaims // код -> claims id_token
+}
+
+func newFakeOIDCServer(t *testing.T) *fakeOIDCServer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	s := &fakeOIDCServer{key: key, codes: make(map[string]jwt.MapClaims)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, map[string]any{
+			"issuer":                                s.URL,
+			"authorization_endpoint":                s.URL + "/authorize",
+			"token_endpoint":                        s.URL + "/token",
+			"jwks_uri":                              s.URL + "/jwks",
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeTestJSON(w, http.StatusOK, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"alg": "RS256",
+			"use": "sig",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		clientID, clientSecret, _ := r.BasicAuth()
+		if clientID != "shop" || clientSecret != "client-secret" {
+			writeTestJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+			return
+		}
+		s.mu.Lock()
+		claims, ok := s.codes[r.PostFormValue("code")]
+		delete(s.codes, r.PostFormValue("code"))
+		s.mu.Unlock()
+		if !ok {
+			writeTestJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+		token.Header["kid"] = "test"
+		idToken, err := token.SignedString(key)
+		require.NoError(t, err)
+		writeTestJSON(w, http.StatusOK, map[string]any{
+			"access_token": "access",
+			"token_type":   "Bearer",
+			"expires_in":   3600,
+			"id_token":     idToken,
+		})
+	})
+	s.Server = httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+	return s
+}
+
+// issueCode выдаёт код, который обменивается на id_token с claims поверх стандартных
+func (s *fakeOIDCServer) issueCode(code string, claims jwt.MapClaims) {
+	base := jwt.MapClaims{
+		"iss": s.URL,
+		"aud": "shop",
+		"sub": "sub-alice",
+		"iat": time.Now().Unix(),
+		"exp": time.Now().Add(time.Minute).Unix(),
+	}
+	for k, v := range claims {
+		base[k] = v
+	}
+	s.mu.Lock()
+	s.codes[code] = base
+	s.mu.Unlock()
+}
+
+func writeTestJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func newTestOIDCProvider(t *testing.T, server *fakeOIDCServer) *identity.OIDCProvider {
+	provider, err := identity.NewOIDCProvider(context.Background(), config.OIDCConfig{
+		IssuerURL:    server.URL,
+		ClientID:     "shop",
+		ClientSecret: "client-secret",
+		RedirectURL:  "https://shop.example.com/api/auth/oidc/callback",
+		Scopes:       []string{"openid", "email"},
+	})
+	require.NoError(t, err)
+	return provider
+}
+
+func TestOIDCProvider_Exchange(t *testing.T) {
+	server := newFakeOIDCServer(t)
+	provider := newTestOIDCProvider(t, server)
+	ctx := context.Background()
+
+	authURL, err := url.Parse(provider.AuthCodeURL("state-1"))
+	require.NoError(t, err)
+	assert.Equal(t, server.URL+"/authorize", authURL.Scheme+"://"+authURL.Host+authURL.Path)
+	assert.Equal(t, "state-1", authURL.Query().Get("state"))
+	assert.Equal(t, "shop", authURL.Query().Get("client_id"))
+	nonce := authURL.Query().Get("nonce")
+	require.NotEmpty(t, nonce)
+
+	server.issueCode("code-1", jwt.MapClaims{"nonce": nonce, "email": "alice@corp.example.com", "email_verified": true})
+	ident, err := provider.Exchange(ctx, "code-1", "state-1")
+	require.NoError(t, err)
+	assert.Equal(t, &identity.Identity{
+		Provider:      identity.ProviderOIDC,
+		Subject:       "sub-alice",
+		Email:         "alice@corp.example.com",
+		EmailVerified: true,
+	}, ident)
+
+	// Код одноразовый
+	_, err = provider.Exchange(ctx, "code-1", "state-1")
+	assert.ErrorIs(t, err, identity.ErrInvalidCredentials)
+
+	// Непроверенный провайдером email не считается подтверждённым
+	server.issueCode("code-2", jwt.MapClaims{"nonce": nonce, "email": "alice@corp.example.com"})
+	ident, err = provider.Exchange(ctx, "code-2", "state-1")
+	require.NoError(t, err)
+	assert.False(t, ident.EmailVerified)
+}
+
+func TestOIDCProvider_Exchange_RejectsInvalidIDToken(t *testing.T) {
+	server := newFakeOIDCServer(t)
+	provider := newTestOIDCProvider(t, server)
+	ctx := context.Background()
+
+	authURL, err := url.Parse(provider.AuthCodeURL("state-1"))
+	require.NoError(t, err)
+	nonce := authURL.Query().Get("nonce")
+
+	tests := []struct {
+		name   string
+		claims jwt.MapClaims
+		state  string
+	}{
+		// id_token выдан для входа, начатого в другом браузере
+		{name: "other login", claims: jwt.MapClaims{"nonce": nonce}, state: "state-2"},
+		{name: "no nonce", claims: jwt.MapClaims{}, state: "state-1"},
+		{name: "other audience", claims: jwt.MapClaims{"nonce": nonce, "aud": "other-app"}, state: "state-1"},
+		{name: "other issuer", claims: jwt.MapClaims{"nonce": nonce, "iss": "https://evil.example.com"}, state: "state-1"},
+		{name: "expired", claims: jwt.MapClaims{"nonce": nonce, "exp": time.Now().Add(-time.Hour).Unix()}, state: "state-1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server.issueCode("code-"+tt.name, tt.claims)
+			_, err := provider.Exchange(ctx, "code-"+tt.name, tt.state)
+			assert.ErrorIs(t, err, identity.ErrInvalidCredentials)
+		})
+	}
+}
+
+func TestNewOIDCProvider_DiscoveryFails(t *testing.T) {
+	server := httptest.NewServer(http.NotFoundHandler())
+	defer server.Close()
+
+	_, err := identity.NewOIDCProvider(context.Background(), config.OIDCConfig{
+		IssuerURL:   server.URL,
+		ClientID:    "shop",
+		RedirectURL: "https://shop.example.com/api/auth/oidc/callback",
+	})
+	assert.Error(t, err)
+}
@@ -0,0 +1,112 @@
+package mailer
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/linemk/avito-shop/internal/config"
+)
+
+// типы отправителей писем
+const (
+	TypeLog  = "log"
+	TypeFile = "file"
+)
+
+// Message — письмо пользователю
+type Message struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer отправляет письма пользователям.
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// New создаёт отправителя писем по настройкам из конфига.
+// Для локальной разработки письма пишутся в лог или в файлы, реальной отправки нет.
+func New(log *slog.Logger, cfg config.MailerConfig) (Mailer, error) {
+	switch cfg.Type {
+	case TypeLog, "":
+		return NewLogMailer(log, cfg.From), nil
+	case TypeFile:
+		return NewFileMailer(cfg.Dir, cfg.From)
+	default:
+		return nil, fmt.Errorf("unknown mailer type %q", cfg.Type)
+	}
+}
+
+type logMailer struct {
+	log  *slog.Logger
+	from string
+}
+
+// NewLogMailer создаёт отправителя, который пишет письма в лог.
+func NewLogMailer(log *slog.Logger, from string) Mailer {
+	return &logMailer{log: log, from: from}
+}
+
+func (m *logMailer) Send(_ context.Context, msg Message) error {
+	m.log.Info("email sent",
+		slog.String("op", "mailer.LogMailer.Send"),
+		slog.String("from", m.from),
+		slog.String("to", msg.To),
+		slog.String("subject", msg.Subject),
+		slog.String("body", msg.Body),
+	)
+	return nil
+}
+
+type fileMailer struct {
+	dir  string
+	from string
+	seq  atomic.Int64
+}
+
+// NewFileMailer создаёт отправителя, который сохраняет каждое письмо в отдельный .eml файл в dir.
+func NewFileMailer(dir, from string) (Mailer, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("failed to create mail directory: %w", err)
+	}
+	return &fileMailer{dir: dir, from: from}, nil
+}
+
+func (m *fileMailer) Send(_ context.Context, msg Message) error {
+	const op = "mailer.FileMailer.Send"
+
+	now := time.Now().UTC()
+	name := fmt.Sprintf("%s-%d-%s.eml", now.Format("20060102T150405.000000000"), m.seq.Add(1), sanitize(msg.To))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", m.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", msg.Subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", now.Format(time.RFC1123Z))
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(msg.Body)
+
+	if err := os.WriteFile(filepath.Join(m.dir, name), []byte(b.String()), 0o600); err != nil {
+		return fmt.Errorf("%s: failed to write message: %w", op, err)
+	}
+	return nil
+}
+
+// sanitize оставляет в адресе только символы, безопасные для имени файла
+func sanitize(s string) string {
+	return strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '.', r == '-', r == '_', r == '@':
+			return r
+		default:
+			return '_'
+		}
+	}, s)
+}
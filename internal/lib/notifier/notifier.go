@@ -0,0 +1,109 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/linemk/avito-shop/internal/config"
+)
+
+// типы получателей оповещений
+const (
+	TypeLog     = "log"
+	TypeWebhook = "webhook"
+)
+
+// LowStockAlert — оповещение о том, что товар заканчивается на складе
+type LowStockAlert struct {
+	Item      string `json:"item"`
+	Stock     int    `json:"stock"`     // остаток после покупки; 0 — товар закончился
+	Threshold int    `json:"threshold"` // порог из конфига, при переходе через который отправлено оповещение
+}
+
+// Notifier доставляет служебные оповещения менеджерам мерча.
+type Notifier interface {
+	NotifyLowStock(ctx context.Context, alert LowStockAlert) error
+}
+
+// New создаёт получателя оповещений по настройкам из конфига.
+func New(log *slog.Logger, cfg config.NotifierConfig) (Notifier, error) {
+	switch cfg.Type {
+	case TypeLog, "":
+		return NewLogNotifier(log), nil
+	case TypeWebhook:
+		if cfg.WebhookURL == "" {
+			return nil, fmt.Errorf("NOTIFIER_WEBHOOK_URL is required for type %q", TypeWebhook)
+		}
+		return NewWebhookNotifier(cfg.WebhookURL, &http.Client{Timeout: cfg.Timeout}), nil
+	default:
+		return nil, fmt.Errorf("unknown notifier type %q", cfg.Type)
+	}
+}
+
+type logNotifier struct {
+	log *slog.Logger
+}
+
+// NewLogNotifier создаёт получателя, который пишет оповещения в лог.
+func NewLogNotifier(log *slog.Logger) Notifier {
+	return &logNotifier{log: log}
+}
+
+func (n *logNotifier) NotifyLowStock(_ context.Context, alert LowStockAlert) error {
+	n.log.Warn("merch stock is low",
+		slog.String("op", "notifier.LogNotifier.NotifyLowStock"),
+		slog.String("item", alert.Item),
+		slog.Int("stock", alert.Stock),
+		slog.Int("threshold", alert.Threshold),
+	)
+	return nil
+}
+
+type webhookNotifier struct {
+	url    string
+	client *http.Client
+}
+
+// NewWebhookNotifier создаёт получателя, который отправляет оповещение JSON-запросом POST на url,
+// например во входящий вебхук чата менеджеров. Ответ не 2xx считается ошибкой.
+func NewWebhookNotifier(url string, client *http.Client) Notifier {
+	return &webhookNotifier{url: url, client: client}
+}
+
+// webhookPayload — тело запроса вебхука
+type webhookPayload struct {
+	Event string `json:"event"`
+	Text  string `json:"text"` // готовое сообщение для чатов, которые показывают только text
+	LowStockAlert
+}
+
+func (n *webhookNotifier) NotifyLowStock(ctx context.Context, alert LowStockAlert) error {
+	const op = "notifier.WebhookNotifier.NotifyLowStock"
+
+	body, err := json.Marshal(webhookPayload{
+		Event:         "merch.low_stock",
+		Text:          fmt.Sprintf("Товар %s заканчивается: осталось %d шт.", alert.Item, alert.Stock),
+		LowStockAlert: alert,
+	})
+	if err != nil {
+		return fmt.Errorf("%s: failed to encode alert: %w", op, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, n.url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%s: failed to create request: %w", op, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := n.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%s: failed to send alert: %w", op, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s: webhook responded with status %d", op, resp.StatusCode)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package notifier_test
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/linemk/avito-shop/internal/config"
+	"github.com/linemk/avito-shop/internal/lib/notifier"
+)
+
+func TestWebhookNotifier_NotifyLowStock(t *testing.T) {
+	var got map[string]any
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&got))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	n := notifier.NewWebhookNotifier(server.URL, server.Client())
+	alert := notifier.LowStockAlert{Item: "hoody", Stock: 3, Threshold: 5}
+	require.NoError(t, n.NotifyLowStock(context.Background(), alert))
+	assert.Equal(t, "merch.low_stock", got["event"])
+	assert.Equal(t, "hoody", got["item"])
+	assert.EqualValues(t, 3, got["stock"])
+	assert.EqualValues(t, 5, got["threshold"])
+	assert.NotEmpty(t, got["text"])
+
+	// Ответ не 2xx — ошибка доставки
+	status = http.StatusInternalServerError
+	assert.Error(t, n.NotifyLowStock(context.Background(), alert))
+}
+
+func TestNew(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+
+	_, err := notifier.New(logger, config.NotifierConfig{Type: notifier.TypeLog})
+	assert.NoError(t, err)
+	_, err = notifier.New(logger, config.NotifierConfig{Type: notifier.TypeWebhook, WebhookURL: "https://chat.example.com/hooks/merch"})
+	assert.NoError(t, err)
+
+	// Вебхук без адреса и неизвестный тип — ошибка настройки
+	_, err = notifier.New(logger, config.NotifierConfig{Type: notifier.TypeWebhook})
+	assert.Error(t, err)
+	_, err = notifier.New(logger, config.NotifierConfig{Type: "sms"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,193 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/linemk/avito-shop/internal/config"
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// алгоритмы хэширования паролей
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+)
+
+// ErrUnknownHashFormat возвращается для хэша, формат которого не распознан
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// Hasher хэширует пароли и проверяет их. Хэши хранятся в формате PHC
+// ($argon2id$v=19$m=...,t=...,p=...$соль$хэш) или в формате bcrypt ($2a$...),
+// поэтому алгоритм и параметры определяются по самому хэшу.
+type Hasher interface {
+	// Hash возвращает закодированный хэш пароля с новой случайной солью.
+	Hash(password string) ([]byte, error)
+	// Verify проверяет пароль по хэшу любого поддерживаемого алгоритма.
+	Verify(password string, encoded []byte) (bool, error)
+	// NeedsRehash сообщает, что хэш создан другим алгоритмом или с другими параметрами
+	// и после успешного входа его стоит пересчитать.
+	NeedsRehash(encoded []byte) bool
+}
+
+// New создаёт Hasher по настройкам из конфига.
+func New(cfg config.PasswordConfig) (Hasher, error) {
+	switch cfg.Algorithm {
+	case AlgorithmArgon2id, "":
+		if cfg.Argon2Memory == 0 || cfg.Argon2Iterations == 0 || cfg.Argon2Parallelism == 0 {
+			return nil, errors.New("argon2id parameters must be positive")
+		}
+		if cfg.Argon2SaltLength < 8 || cfg.Argon2KeyLength < 16 {
+			return nil, errors.New("argon2id salt must be at least 8 bytes and key at least 16 bytes")
+		}
+		return &Argon2idHasher{Params: Argon2Params{
+			Memory:      cfg.Argon2Memory,
+			Iterations:  cfg.Argon2Iterations,
+			Parallelism: cfg.Argon2Parallelism,
+			SaltLength:  cfg.Argon2SaltLength,
+			KeyLength:   cfg.Argon2KeyLength,
+		}}, nil
+	case AlgorithmBcrypt:
+		if cfg.BcryptCost < bcrypt.MinCost || cfg.BcryptCost > bcrypt.MaxCost {
+			return nil, fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+		return NewBcryptHasher(cfg.BcryptCost), nil
+	default:
+		return nil, fmt.Errorf("unknown password hashing algorithm %q", cfg.Algorithm)
+	}
+}
+
+// Verify проверяет пароль по хэшу bcrypt или argon2id.
+func Verify(password string, encoded []byte) (bool, error) {
+	switch {
+	case isBcrypt(encoded):
+		err := bcrypt.CompareHashAndPassword(encoded, []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		if err != nil {
+			return false, fmt.Errorf("failed to compare bcrypt hash: %w", err)
+		}
+		return true, nil
+	case strings.HasPrefix(string(encoded), "$"+AlgorithmArgon2id+"$"):
+		params, salt, key, err := decodeArgon2id(string(encoded))
+		if err != nil {
+			return false, err
+		}
+		actual := argon2.IDKey([]byte(password), salt, params.Iterations, params.Memory, params.Parallelism, uint32(len(key)))
+		return subtle.ConstantTimeCompare(actual, key) == 1, nil
+	default:
+		return false, ErrUnknownHashFormat
+	}
+}
+
+// BcryptHasher хэширует пароли bcrypt с заданной стоимостью.
+type BcryptHasher struct {
+	Cost int
+}
+
+func NewBcryptHasher(cost int) *BcryptHasher {
+	return &BcryptHasher{Cost: cost}
+}
+
+func (h *BcryptHasher) Hash(password string) ([]byte, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.Cost)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	return hash, nil
+}
+
+func (h *BcryptHasher) Verify(password string, encoded []byte) (bool, error) {
+	return Verify(password, encoded)
+}
+
+func (h *BcryptHasher) NeedsRehash(encoded []byte) bool {
+	if !isBcrypt(encoded) {
+		return true
+	}
+	cost, err := bcrypt.Cost(encoded)
+	return err != nil || cost != h.Cost
+}
+
+// Argon2Params — параметры argon2id
+type Argon2Params struct {
+	Memory      uint32 // память в КиБ
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Argon2idHasher хэширует пароли argon2id и кодирует результат в формате PHC.
+type Argon2idHasher struct {
+	Params Argon2Params
+}
+
+func (h *Argon2idHasher) Hash(password string) ([]byte, error) {
+	salt := make([]byte, h.Params.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return nil, fmt.Errorf("failed to generate salt: %w", err)
+	}
+	key := argon2.IDKey([]byte(password), salt, h.Params.Iterations, h.Params.Memory, h.Params.Parallelism, h.Params.KeyLength)
+	encoded := fmt.Sprintf("$%s$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		AlgorithmArgon2id, argon2.Version, h.Params.Memory, h.Params.Iterations, h.Params.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt), base64.RawStdEncoding.EncodeToString(key))
+	return []byte(encoded), nil
+}
+
+func (h *Argon2idHasher) Verify(password string, encoded []byte) (bool, error) {
+	return Verify(password, encoded)
+}
+
+func (h *Argon2idHasher) NeedsRehash(encoded []byte) bool {
+	params, salt, key, err := decodeArgon2id(string(encoded))
+	if err != nil {
+		return true
+	}
+	return params.Memory != h.Params.Memory ||
+		params.Iterations != h.Params.Iterations ||
+		params.Parallelism != h.Params.Parallelism ||
+		uint32(len(salt)) != h.Params.SaltLength ||
+		uint32(len(key)) != h.Params.KeyLength
+}
+
+func isBcrypt(encoded []byte) bool {
+	s := string(encoded)
+	return strings.HasPrefix(s, "$2a$") || strings.HasPrefix(s, "$2b$") || strings.HasPrefix(s, "$2y$")
+}
+
+// decodeArgon2id разбирает хэш вида $argon2id$v=19$m=65536,t=3,p=2$соль$хэш
+func decodeArgon2id(encoded string) (Argon2Params, []byte, []byte, error) {
+	var params Argon2Params
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != AlgorithmArgon2id {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id version: %w", err)
+	}
+	if version != argon2.Version {
+		return params, nil, nil, fmt.Errorf("unsupported argon2id version %d", version)
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Iterations, &params.Parallelism); err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id parameters: %w", err)
+	}
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id salt: %w", err)
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, fmt.Errorf("invalid argon2id hash: %w", err)
+	}
+	params.SaltLength = uint32(len(salt))
+	params.KeyLength = uint32(len(key))
+	return params, salt, key, nil
+}
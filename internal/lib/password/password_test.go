@@ -0,0 +1,82 @@
+package password_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/linemk/avito-shop/internal/config"
+	"github.com/linemk/avito-shop/internal/lib/password"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// лёгкие параметры argon2id, чтобы тесты выполнялись быстро
+var testArgon2 = config.PasswordConfig{
+	Algorithm:         password.AlgorithmArgon2id,
+	Argon2Memory:      1024,
+	Argon2Iterations:  1,
+	Argon2Parallelism: 1,
+	Argon2SaltLength:  16,
+	Argon2KeyLength:   32,
+}
+
+func TestArgon2idHasher_PHCFormat(t *testing.T) {
+	hasher, err := password.New(testArgon2)
+	require.NoError(t, err)
+
+	hash, err := hasher.Hash("password123")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(hash), "$argon2id$v=19$m=1024,t=1,p=1$"), string(hash))
+	assert.Len(t, strings.Split(string(hash), "$"), 6)
+
+	ok, err := hasher.Verify("password123", hash)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = hasher.Verify("wrong-password", hash)
+	require.NoError(t, err)
+	assert.False(t, ok)
+	assert.False(t, hasher.NeedsRehash(hash))
+
+	// Другие параметры — хэш нужно пересчитать
+	stronger := testArgon2
+	stronger.Argon2Iterations = 2
+	strongerHasher, err := password.New(stronger)
+	require.NoError(t, err)
+	assert.True(t, strongerHasher.NeedsRehash(hash))
+}
+
+func TestHasher_VerifiesOtherAlgorithms(t *testing.T) {
+	legacy, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	require.NoError(t, err)
+
+	argon, err := password.New(testArgon2)
+	require.NoError(t, err)
+	ok, err := argon.Verify("password123", legacy)
+	require.NoError(t, err)
+	assert.True(t, ok, "bcrypt hashes stay valid after switching to argon2id")
+	assert.True(t, argon.NeedsRehash(legacy))
+
+	bc := password.NewBcryptHasher(bcrypt.MinCost)
+	assert.False(t, bc.NeedsRehash(legacy))
+	assert.True(t, password.NewBcryptHasher(bcrypt.MinCost+1).NeedsRehash(legacy), "Changed cost requires rehash")
+
+	argonHash, err := argon.Hash("password123")
+	require.NoError(t, err)
+	ok, err = bc.Verify("password123", argonHash)
+	require.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, bc.NeedsRehash(argonHash))
+
+	_, err = bc.Verify("password123", []byte("plain"))
+	assert.ErrorIs(t, err, password.ErrUnknownHashFormat)
+}
+
+func TestNew_InvalidConfig(t *testing.T) {
+	_, err := password.New(config.PasswordConfig{Algorithm: "md5"})
+	assert.Error(t, err)
+	_, err = password.New(config.PasswordConfig{Algorithm: password.AlgorithmBcrypt, BcryptCost: 1})
+	assert.Error(t, err)
+	_, err = password.New(config.PasswordConfig{Algorithm: password.AlgorithmArgon2id})
+	assert.Error(t, err)
+}
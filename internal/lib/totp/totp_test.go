@@ -0,0 +1,60 @@
+package totp_test
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/linemk/avito-shop/internal/lib/totp"
+)
+
+// Секрет из тестовых векторов RFC 6238 (SHA1)
+var rfcSecret = []byte("12345678901234567890")
+
+func TestCode_RFC6238Vectors(t *testing.T) {
+	// В RFC коды восьмизначные; шестизначный код — последние шесть цифр
+	vectors := map[int64]string{
+		59:          "287082",
+		1111111109:  "081804",
+		1111111111:  "050471",
+		1234567890:  "005924",
+		2000000000:  "279037",
+		20000000000: "353130",
+	}
+	for unix, want := range vectors {
+		assert.Equal(t, want, totp.Code(rfcSecret, totp.Step(time.Unix(unix, 0))), "time %d", unix)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	code := totp.Code(rfcSecret, totp.Step(now))
+
+	step, ok := totp.Validate(rfcSecret, code, now, 1)
+	assert.True(t, ok)
+	assert.Equal(t, totp.Step(now), step)
+
+	// Расхождение часов на один шаг допускается, на два — нет
+	_, ok = totp.Validate(rfcSecret, code, now.Add(totp.Period), 1)
+	assert.True(t, ok)
+	_, ok = totp.Validate(rfcSecret, code, now.Add(2*totp.Period), 1)
+	assert.False(t, ok)
+
+	_, ok = totp.Validate(rfcSecret, "000000", now, 1)
+	assert.False(t, ok)
+	_, ok = totp.Validate(rfcSecret, "12345", now, 1)
+	assert.False(t, ok)
+}
+
+func TestProvisioningURI(t *testing.T) {
+	uri, err := url.Parse(totp.ProvisioningURI("Avito shop", "user@example.com", rfcSecret))
+	assert.NoError(t, err)
+	assert.Equal(t, "otpauth", uri.Scheme)
+	assert.Equal(t, "totp", uri.Host)
+	assert.Equal(t, "/Avito shop:user@example.com", uri.Path)
+	assert.Equal(t, "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ", uri.Query().Get("secret"))
+	assert.Equal(t, "Avito shop", uri.Query().Get("issuer"))
+	assert.Equal(t, "6", uri.Query().Get("digits"))
+}
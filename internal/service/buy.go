@@ -3,108 +3,180 @@ package service
 
 import (
 	"context"
-	"database/sql"
+	"errors"
 	"fmt"
 	"log/slog"
 
+	"github.com/linemk/avito-shop/internal/domain/models"
 	"github.com/linemk/avito-shop/internal/storage"
 )
 
+// MaxBuyQuantity — наибольшее количество единиц товара в одной покупке
+const MaxBuyQuantity = 100
+
 type BuyService interface {
-	Buy(ctx context.Context, userID int64, item string) error
+	// Buy покупает quantity единиц товара одним заказом. quantity вне 1..MaxBuyQuantity — ErrInvalidQuantity.
+	Buy(ctx context.Context, userID int64, item string, quantity int) error
+	// Checkout оформляет всю корзину пользователя в одной транзакции. Если хотя бы одну строку нельзя
+	// оформить, не оформляется ничего и возвращается *CheckoutError с причинами по строкам.
+	Checkout(ctx context.Context, userID int64) (*CheckoutResult, error)
 }
 
 type buyService struct {
-	log       *slog.Logger
-	userRepo  storage.UserStorage
-	merchRepo storage.MerchStorage
-	orderRepo storage.OrderStorage
-	db        *sql.DB
+	log        *slog.Logger
+	txManager  storage.TxManager
+	userRepo   storage.UserStorage
+	merchRepo  storage.MerchStorage
+	orderRepo  storage.OrderStorage
+	coinTxRepo storage.CoinTransactionStorage
+	ledgerRepo storage.LedgerStorage
+	idemRepo   storage.IdempotencyStorage
+	cartRepo   storage.CartStorage
+	stock      StockAlertOptions
+	// catalog сбрасывает кэш каталога после списания остатка; nil — кэша нет
+	catalog MerchService
 }
 
-func NewBuyService(log *slog.Logger, db *sql.DB, userRepo storage.UserStorage, merchRepo storage.MerchStorage, orderRepo storage.OrderStorage) BuyService {
+func NewBuyService(log *slog.Logger, txManager storage.TxManager, userRepo storage.UserStorage, merchRepo storage.MerchStorage, orderRepo storage.OrderStorage, coinTxRepo storage.CoinTransactionStorage, ledgerRepo storage.LedgerStorage, idemRepo storage.IdempotencyStorage, cartRepo storage.CartStorage, catalog MerchService, stock StockAlertOptions) BuyService {
 	return &buyService{
-		log:       log,
-		db:        db,
-		userRepo:  userRepo,
-		merchRepo: merchRepo,
-		orderRepo: orderRepo,
+		log:        log,
+		txManager:  txManager,
+		userRepo:   userRepo,
+		merchRepo:  merchRepo,
+		orderRepo:  orderRepo,
+		coinTxRepo: coinTxRepo,
+		ledgerRepo: ledgerRepo,
+		idemRepo:   idemRepo,
+		cartRepo:   cartRepo,
+		stock:      stock,
+		catalog:    catalog,
 	}
 }
 
-// Buy осуществляет покупку товара:
-// 1. Запускается транзакция.
+// Buy осуществляет покупку товара в одной транзакции:
+// 1. Сохраняется ключ идемпотентности (если передан); повтор запроса возвращает *ReplayError.
 // 2. Получается мерч по названию.
-// 3. Получается пользователь.
-// 4. Проверяется, достаточно ли средств у пользователя.
-// 5. Обновляется баланс пользователя.
-// 6. Создается заказ.
-// Если что-то идет не так, транзакция откатывается.
-func (s *buyService) Buy(ctx context.Context, userID int64, item string) error {
+// 3. Получается пользователь (строка блокируется до конца транзакции).
+// 4. Проверяется, что email подтверждён и у пользователя достаточно средств на quantity единиц.
+// 5. Со склада списывается quantity единиц; если на складе меньше — ErrOutOfStock.
+// 6. Создается один заказ на все единицы.
+// 7. В журнал записывается списание с кошелька пользователя на выручку магазина.
+// 8. Списание записывается в историю операций со ссылкой на заказ.
+// Если что-то идет не так, транзакция откатывается. После фиксации, если остаток опустился
+// до порога, менеджеры получают оповещение, а кэш каталога сбрасывается, чтобы закончившийся
+// товар сразу стал недоступен.
+func (s *buyService) Buy(ctx context.Context, userID int64, item string, quantity int) error {
 	const op = "service.BuyService.Buy"
-	logger := s.log.With(slog.String("op", op), slog.Int64("userID", userID), slog.String("item", item))
-	logger.Info("starting purchase transaction")
+	logger := s.log.With(slog.String("op", op), slog.Int64("userID", userID), slog.String("item", item), slog.Int("quantity", quantity))
 
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		logger.Error("failed to begin transaction", slog.Any("error", err))
-		return fmt.Errorf("%s: failed to begin transaction: %w", op, err)
+	if quantity < 1 || quantity > MaxBuyQuantity {
+		return fmt.Errorf("%s: quantity %d: %w", op, quantity, ErrInvalidQuantity)
 	}
+	logger.Info("starting purchase transaction")
 
-	// Получаем мерч по названию через транзакцию
-	merch, err := s.merchRepo.GetMerchByName(ctx, tx, item)
-	if err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			logger.Error("transaction rollback failed", slog.Any("error", rbErr))
+	// остаток после списания; nil — остаток товара не учитывается
+	var remaining *int
+	err := s.txManager.Do(ctx, func(ctx context.Context) error {
+		// Сохраняем ключ идемпотентности в той же транзакции, что и списание монет
+		if err := reserveIdempotencyKey(ctx, s.idemRepo, userID); err != nil {
+			return err
 		}
-		logger.Error("failed to get merch", slog.Any("error", err))
-		return fmt.Errorf("%s: failed to get merch: %w", op, err)
-	}
 
-	// Получаем пользователя через транзакцию
-	user, err := s.userRepo.GetUserByIDtx(ctx, tx, userID)
-	if err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			logger.Error("transaction rollback failed", slog.Any("error", rbErr))
+		merch, err := s.merchRepo.GetMerchByName(ctx, item)
+		if err != nil {
+			if errors.Is(err, storage.ErrMerchNotFound) {
+				logger.Warn("merch not found")
+				return ErrMerchNotFound
+			}
+			logger.Error("failed to get merch", slog.Any("error", err))
+			return fmt.Errorf("failed to get merch: %w", err)
 		}
-		logger.Error("failed to get user", slog.Any("error", err))
-		return fmt.Errorf("%s: failed to get user: %w", op, err)
-	}
 
-	// Проверяем, достаточно ли средств
-	if user.CoinBalance < merch.Price {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			logger.Error("transaction rollback failed", slog.Any("error", rbErr))
+		// Получаем пользователя с блокировкой строки, чтобы параллельные покупки не перезаписали баланс
+		user, err := s.userRepo.GetUserByIDForUpdate(ctx, userID)
+		if err != nil {
+			logger.Error("failed to get user", slog.Any("error", err))
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+
+		// Покупать можно только после подтверждения email
+		if !user.EmailVerified {
+			logger.Warn("user email is not verified")
+			return ErrEmailNotVerified
 		}
-		logger.Warn("insufficient funds", slog.Int("balance", user.CoinBalance), slog.Int("price", merch.Price))
-		return fmt.Errorf("%s: insufficient funds", op)
-	}
 
-	// Обновляем баланс пользователя
-	newBalance := user.CoinBalance - merch.Price
-	if err := s.userRepo.UpdateUserBalance(ctx, tx, userID, newBalance); err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			logger.Error("transaction rollback failed", slog.Any("error", rbErr))
+		// Проверяем, достаточно ли средств
+		totalPrice := merch.Price * quantity
+		if user.CoinBalance < totalPrice {
+			logger.Warn("insufficient funds", slog.Int("balance", user.CoinBalance), slog.Int("totalPrice", totalPrice))
+			return ErrInsufficientFunds
 		}
-		logger.Error("failed to update user balance", slog.Any("error", err))
-		return fmt.Errorf("%s: failed to update user balance: %w", op, err)
+
+		// Списываем товар со склада; строка товара уже заблокирована, поэтому остаток не уйдёт в минус
+		remaining, err = s.merchRepo.DecrementMerchStock(ctx, merch.ID, quantity)
+		if err != nil {
+			if errors.Is(err, storage.ErrOutOfStock) {
+				logger.Warn("merch is out of stock")
+				return ErrOutOfStock
+			}
+			logger.Error("failed to decrement merch stock", slog.Any("error", err))
+			return fmt.Errorf("failed to decrement merch stock: %w", err)
+		}
+
+		// Создаем заказ и списываем монеты
+		_, err = s.placeOrder(ctx, logger, userID, merch, quantity)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	logger.Info("purchase completed successfully")
+	if remaining != nil {
+		s.invalidateCatalog()
+		s.stock.notifyLowStock(ctx, logger, item, *remaining+quantity, *remaining)
+	}
+	return nil
+}
+
+// invalidateCatalog сбрасывает кэш каталога: доступность товара зависит от остатка.
+// Вызывается после фиксации транзакции, списавшей остаток.
+func (s *buyService) invalidateCatalog() {
+	if s.catalog != nil {
+		s.catalog.InvalidateCatalog()
+	}
+}
+
+// placeOrder создаёт заказ на quantity единиц товара по текущей цене и списывает его стоимость:
+// проводка с кошелька пользователя на выручку магазина и запись в истории операций со ссылкой на заказ.
+// Вызывается в транзакции покупки после проверки баланса и списания со склада.
+func (s *buyService) placeOrder(ctx context.Context, logger *slog.Logger, userID int64, merch *models.Merch, quantity int) (int64, error) {
+	totalPrice := merch.Price * quantity
+
 	// Создаем заказ
-	if err := s.orderRepo.CreateOrder(ctx, tx, userID, merch.ID, 1, merch.Price); err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			logger.Error("transaction rollback failed", slog.Any("error", rbErr))
-		}
+	orderID, err := s.orderRepo.CreateOrder(ctx, userID, merch.ID, quantity, totalPrice)
+	if err != nil {
 		logger.Error("failed to create order", slog.Any("error", err))
-		return fmt.Errorf("%s: failed to create order: %w", op, err)
+		return 0, fmt.Errorf("failed to create order: %w", err)
 	}
 
-	// Коммит транзакции
-	if err := tx.Commit(); err != nil {
-		logger.Error("failed to commit transaction", slog.Any("error", err))
-		return fmt.Errorf("%s: failed to commit transaction: %w", op, err)
+	// Списываем монеты: кошелёк пользователя -> выручка магазина
+	if _, err := s.ledgerRepo.PostEntry(ctx, &models.LedgerEntry{
+		Kind:      models.LedgerEntryPurchase,
+		Reference: fmt.Sprintf("order:%d", orderID),
+		Postings: []models.LedgerPosting{
+			{Account: models.WalletAccount(userID), Amount: -totalPrice},
+			{Account: models.SystemAccount(models.LedgerAccountShopRevenue), Amount: totalPrice},
+		},
+	}); err != nil {
+		logger.Error("failed to post purchase to ledger", slog.Any("error", err))
+		return 0, fmt.Errorf("failed to post purchase to ledger: %w", err)
 	}
 
-	logger.Info("purchase completed successfully")
-	return nil
+	// Записываем списание в историю операций пользователя
+	if err := s.coinTxRepo.CreatePurchaseTransaction(ctx, userID, totalPrice, orderID); err != nil {
+		logger.Error("failed to record purchase transaction", slog.Any("error", err))
+		return 0, fmt.Errorf("failed to record purchase transaction: %w", err)
+	}
+	return orderID, nil
 }
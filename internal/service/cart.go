@@ -0,0 +1,291 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/storage"
+)
+
+// Cart — корзина пользователя по текущим ценам
+type Cart struct {
+	Items      []*models.CartItem
+	TotalPrice int
+}
+
+// CheckoutResult — заказы, созданные при оформлении корзины, по одному на строку
+type CheckoutResult struct {
+	Orders     []*models.Order
+	TotalPrice int
+}
+
+// CheckoutLineError — причина, по которой строку корзины нельзя оформить:
+// ErrMerchNotFound, ErrOutOfStock или ErrInvalidQuantity
+type CheckoutLineError struct {
+	Item string
+	Err  error
+}
+
+// CheckoutError возвращается, если хотя бы одну строку корзины нельзя оформить; errors.Is
+// сопоставляет его с ErrCheckoutFailed. Строки упорядочены по названию товара.
+type CheckoutError struct {
+	Lines []CheckoutLineError
+}
+
+func (e *CheckoutError) Error() string {
+	return fmt.Sprintf("checkout failed: %d cart line(s) rejected", len(e.Lines))
+}
+
+func (e *CheckoutError) Unwrap() error {
+	return ErrCheckoutFailed
+}
+
+// CartService управляет корзиной пользователя. Наличие на складе и баланс проверяются
+// только при оформлении (BuyService.Checkout), корзина лишь показывает текущую доступность.
+type CartService interface {
+	// GetCart возвращает корзину пользователя.
+	GetCart(ctx context.Context, userID int64) (*Cart, error)
+	// AddToCart добавляет quantity единиц товара каталога к корзине. Количество товара в корзине
+	// не может превысить MaxBuyQuantity, иначе — ErrInvalidQuantity.
+	AddToCart(ctx context.Context, userID int64, item string, quantity int) (*Cart, error)
+	// RemoveFromCart убирает товар из корзины; товара нет в корзине — ErrCartItemNotFound.
+	RemoveFromCart(ctx context.Context, userID int64, item string) (*Cart, error)
+}
+
+type cartService struct {
+	log          *slog.Logger
+	txManager    storage.TxManager
+	cartRepo     storage.CartStorage
+	merchService MerchService
+}
+
+// NewCartService создаёт сервис корзины. Товары ищутся в каталоге MerchService без блокировки строк
+// merch, поэтому добавление в корзину не ждёт покупок того же товара.
+func NewCartService(log *slog.Logger, txManager storage.TxManager, cartRepo storage.CartStorage, merchService MerchService) CartService {
+	return &cartService{
+		log:          log,
+		txManager:    txManager,
+		cartRepo:     cartRepo,
+		merchService: merchService,
+	}
+}
+
+func (s *cartService) GetCart(ctx context.Context, userID int64) (*Cart, error) {
+	const op = "service.CartService.GetCart"
+
+	cart, err := s.loadCart(ctx, userID)
+	if err != nil {
+		s.log.Error("failed to load cart", slog.String("op", op), slog.Int64("userID", userID), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return cart, nil
+}
+
+func (s *cartService) AddToCart(ctx context.Context, userID int64, item string, quantity int) (*Cart, error) {
+	const op = "service.CartService.AddToCart"
+	logger := s.log.With(slog.String("op", op), slog.Int64("userID", userID), slog.String("item", item))
+
+	if quantity < 1 || quantity > MaxBuyQuantity {
+		return nil, fmt.Errorf("%s: quantity %d: %w", op, quantity, ErrInvalidQuantity)
+	}
+	merch, err := s.merchService.GetMerch(ctx, item)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = s.txManager.Do(ctx, func(ctx context.Context) error {
+		total, err := s.cartRepo.AddCartItem(ctx, userID, merch.ID, quantity)
+		if err != nil {
+			return err
+		}
+		// проверка после добавления откатывает транзакцию и не требует читать корзину заранее
+		if total > MaxBuyQuantity {
+			return fmt.Errorf("%d in cart: %w", total, ErrInvalidQuantity)
+		}
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, ErrInvalidQuantity) {
+			logger.Error("failed to add cart item", slog.Any("error", err))
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	logger.Info("item added to cart", slog.Int("quantity", quantity))
+
+	cart, err := s.loadCart(ctx, userID)
+	if err != nil {
+		logger.Error("failed to load cart", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return cart, nil
+}
+
+func (s *cartService) RemoveFromCart(ctx context.Context, userID int64, item string) (*Cart, error) {
+	const op = "service.CartService.RemoveFromCart"
+	logger := s.log.With(slog.String("op", op), slog.Int64("userID", userID), slog.String("item", item))
+
+	if err := s.cartRepo.RemoveCartItem(ctx, userID, item); err != nil {
+		if errors.Is(err, storage.ErrCartItemNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrCartItemNotFound)
+		}
+		logger.Error("failed to remove cart item", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	logger.Info("item removed from cart")
+
+	cart, err := s.loadCart(ctx, userID)
+	if err != nil {
+		logger.Error("failed to load cart", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return cart, nil
+}
+
+// loadCart читает корзину и считает её стоимость по текущим ценам
+func (s *cartService) loadCart(ctx context.Context, userID int64) (*Cart, error) {
+	items, err := s.cartRepo.ListCartItems(ctx, userID, false)
+	if err != nil {
+		return nil, err
+	}
+	cart := &Cart{Items: items}
+	for _, item := range items {
+		cart.TotalPrice += item.Price * item.Quantity
+	}
+	return cart, nil
+}
+
+// checkoutLine — строка корзины, товар которой заблокирован для оформления
+type checkoutLine struct {
+	merch     *models.Merch
+	quantity  int
+	remaining *int // остаток после списания; nil — остаток не учитывается
+}
+
+// Checkout оформляет корзину в одной транзакции:
+// 1. Строки корзины блокируются; пустая корзина — ErrCartEmpty. Корзина очищается в той же
+// транзакции, поэтому повтор запроса после оформления получает ErrCartEmpty, а не второй заказ.
+// 2. Товары блокируются в порядке названий: параллельные оформления с общими товарами ждут
+// друг друга, а не попадают во взаимоблокировку.
+// 3. Получается пользователь (строка блокируется до конца транзакции), проверяется подтверждение email.
+// 4. Со склада списываются все строки. Строки, товар которых архивирован или закончился,
+// собираются в *CheckoutError, и транзакция откатывается целиком.
+// 5. Баланс проверяется один раз для суммы всей корзины.
+// 6. На каждую строку создается заказ со списанием монет, как в Buy, и корзина очищается.
+// После фиксации для товаров, остаток которых опустился до порога, отправляются оповещения.
+func (s *buyService) Checkout(ctx context.Context, userID int64) (*CheckoutResult, error) {
+	const op = "service.BuyService.Checkout"
+	logger := s.log.With(slog.String("op", op), slog.Int64("userID", userID))
+	logger.Info("starting checkout transaction")
+
+	var lines []*checkoutLine
+	var result *CheckoutResult
+	err := s.txManager.Do(ctx, func(ctx context.Context) error {
+		// транзакция может повториться после конфликта: результат предыдущей попытки отбрасывается
+		lines, result = nil, &CheckoutResult{}
+
+		// строки упорядочены по названию товара, в этом же порядке блокируются товары
+		items, err := s.cartRepo.ListCartItems(ctx, userID, true)
+		if err != nil {
+			logger.Error("failed to list cart items", slog.Any("error", err))
+			return fmt.Errorf("failed to list cart items: %w", err)
+		}
+		if len(items) == 0 {
+			logger.Warn("cart is empty")
+			return ErrCartEmpty
+		}
+
+		var rejected []CheckoutLineError
+		for _, item := range items {
+			if item.Quantity > MaxBuyQuantity {
+				rejected = append(rejected, CheckoutLineError{Item: item.MerchName, Err: ErrInvalidQuantity})
+				continue
+			}
+			merch, err := s.merchRepo.GetMerchByName(ctx, item.MerchName)
+			if err != nil {
+				if errors.Is(err, storage.ErrMerchNotFound) {
+					rejected = append(rejected, CheckoutLineError{Item: item.MerchName, Err: ErrMerchNotFound})
+					continue
+				}
+				logger.Error("failed to get merch", slog.String("item", item.MerchName), slog.Any("error", err))
+				return fmt.Errorf("failed to get merch: %w", err)
+			}
+			lines = append(lines, &checkoutLine{merch: merch, quantity: item.Quantity})
+		}
+
+		user, err := s.userRepo.GetUserByIDForUpdate(ctx, userID)
+		if err != nil {
+			logger.Error("failed to get user", slog.Any("error", err))
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		if !user.EmailVerified {
+			logger.Warn("user email is not verified")
+			return ErrEmailNotVerified
+		}
+
+		// остаток списывается по всем строкам, чтобы сообщить обо всех закончившихся товарах сразу
+		for _, line := range lines {
+			line.remaining, err = s.merchRepo.DecrementMerchStock(ctx, line.merch.ID, line.quantity)
+			if err != nil {
+				if errors.Is(err, storage.ErrOutOfStock) {
+					rejected = append(rejected, CheckoutLineError{Item: line.merch.Name, Err: ErrOutOfStock})
+					continue
+				}
+				logger.Error("failed to decrement merch stock", slog.String("item", line.merch.Name), slog.Any("error", err))
+				return fmt.Errorf("failed to decrement merch stock: %w", err)
+			}
+			result.TotalPrice += line.merch.Price * line.quantity
+		}
+		if len(rejected) > 0 {
+			slices.SortFunc(rejected, func(a, b CheckoutLineError) int { return cmp.Compare(a.Item, b.Item) })
+			logger.Warn("cart lines rejected", slog.Int("lines", len(rejected)))
+			return &CheckoutError{Lines: rejected}
+		}
+
+		if user.CoinBalance < result.TotalPrice {
+			logger.Warn("insufficient funds", slog.Int("balance", user.CoinBalance), slog.Int("totalPrice", result.TotalPrice))
+			return ErrInsufficientFunds
+		}
+
+		for _, line := range lines {
+			orderID, err := s.placeOrder(ctx, logger.With(slog.String("item", line.merch.Name)), userID, line.merch, line.quantity)
+			if err != nil {
+				return err
+			}
+			result.Orders = append(result.Orders, &models.Order{
+				ID:         orderID,
+				UserID:     userID,
+				MerchID:    line.merch.ID,
+				MerchName:  line.merch.Name,
+				Quantity:   line.quantity,
+				TotalPrice: line.merch.Price * line.quantity,
+			})
+		}
+
+		if err := s.cartRepo.ClearCart(ctx, userID); err != nil {
+			logger.Error("failed to clear cart", slog.Any("error", err))
+			return fmt.Errorf("failed to clear cart: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("checkout completed successfully", slog.Int("orders", len(result.Orders)), slog.Int("totalPrice", result.TotalPrice))
+	stockChanged := false
+	for _, line := range lines {
+		if line.remaining != nil {
+			stockChanged = true
+			s.stock.notifyLowStock(ctx, logger.With(slog.String("item", line.merch.Name)), line.merch.Name, *line.remaining+line.quantity, *line.remaining)
+		}
+	}
+	if stockChanged {
+		s.invalidateCatalog()
+	}
+	return result, nil
+}
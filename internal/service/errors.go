@@ -0,0 +1,51 @@
+package service
+
+import "errors"
+
+// Ошибки бизнес-логики. Сервисы оборачивают их через %w, транспортный слой
+// сопоставляет их со статусами HTTP через errors.Is.
+var (
+	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrInsufficientFunds  = errors.New("insufficient funds")
+	ErrMerchNotFound      = errors.New("merch not found")
+	ErrReceiverNotFound   = errors.New("receiver not found")
+	ErrSelfTransfer       = errors.New("cannot transfer coins to yourself")
+	ErrInvalidAmount      = errors.New("amount must be positive")
+	ErrInvalidMerchFilter = errors.New("invalid merch filter")
+	ErrInvalidCursor      = errors.New("invalid or expired cursor")
+	ErrInvalidPrice       = errors.New("price must be positive")
+	ErrMerchAlreadyExists = errors.New("merch already exists")
+	ErrOutOfStock         = errors.New("merch is out of stock")
+	ErrInvalidStock       = errors.New("invalid stock quantity")
+	ErrInvalidQuantity    = errors.New("invalid purchase quantity")
+	ErrCartEmpty          = errors.New("cart is empty")
+	ErrCartItemNotFound   = errors.New("item is not in the cart")
+	ErrCheckoutFailed     = errors.New("checkout failed")
+
+	ErrUserAlreadyExists        = errors.New("user already exists")
+	ErrInvalidVerificationToken = errors.New("invalid or expired verification token")
+	ErrEmailNotVerified         = errors.New("email is not verified")
+	ErrInvalidRefreshToken      = errors.New("invalid or expired refresh token")
+	ErrTooManyAttempts          = errors.New("too many login attempts")
+	ErrWrongPassword            = errors.New("current password is incorrect")
+	ErrInvalidResetToken        = errors.New("invalid or expired password reset token")
+
+	ErrInvalidChallengeToken   = errors.New("invalid or expired two-factor challenge")
+	ErrInvalidTwoFactorCode    = errors.New("invalid two-factor code")
+	ErrTwoFactorAlreadyEnabled = errors.New("two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled     = errors.New("two-factor authentication is not enabled")
+	ErrTwoFactorRequired       = errors.New("two-factor authentication is required for this role")
+
+	ErrInvalidScope          = errors.New("invalid personal token scope")
+	ErrInvalidTokenExpiry    = errors.New("personal token expiry must be in the future")
+	ErrPersonalTokenNotFound = errors.New("personal token not found")
+
+	ErrSessionNotFound = errors.New("session not found")
+
+	ErrIdentityProviderDisabled = errors.New("identity provider is not enabled")
+	ErrInvalidOIDCState         = errors.New("invalid oidc login state")
+
+	ErrUserNotFound   = errors.New("user not found")
+	ErrInvalidRole    = errors.New("invalid role")
+	ErrSelfRoleChange = errors.New("cannot change your own role")
+)
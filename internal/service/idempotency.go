@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/storage"
+)
+
+// ErrIdempotencyKeyReused возвращается, если ключ уже использован для запроса с другим телом.
+var ErrIdempotencyKeyReused = errors.New("idempotency key reused with different request")
+
+// IdempotencyRequest описывает ключ идемпотентности запроса и ответ,
+// который будет сохранён вместе с изменениями в БД при успешном выполнении.
+type IdempotencyRequest struct {
+	Key          string
+	RequestHash  string
+	ResponseCode int
+	ResponseBody []byte
+}
+
+// ReplayError возвращается, если запрос с таким ключом уже был выполнен.
+// Содержит ответ, сохранённый при первом выполнении.
+type ReplayError struct {
+	ResponseCode int
+	ResponseBody []byte
+}
+
+func (e *ReplayError) Error() string {
+	return "request already processed"
+}
+
+type idempotencyCtxKey struct{}
+
+// WithIdempotency добавляет в контекст ключ идемпотентности для мутирующей операции сервиса.
+func WithIdempotency(ctx context.Context, req IdempotencyRequest) context.Context {
+	return context.WithValue(ctx, idempotencyCtxKey{}, req)
+}
+
+func idempotencyFromContext(ctx context.Context) (IdempotencyRequest, bool) {
+	req, ok := ctx.Value(idempotencyCtxKey{}).(IdempotencyRequest)
+	return req, ok
+}
+
+// reserveIdempotencyKey сохраняет ключ идемпотентности из контекста в текущей транзакции.
+// Если ключ уже сохранён, возвращает *ReplayError с прежним ответом или ErrIdempotencyKeyReused,
+// когда тело запроса отличается. Без ключа в контексте ничего не делает.
+func reserveIdempotencyKey(ctx context.Context, repo storage.IdempotencyStorage, userID int64) error {
+	req, ok := idempotencyFromContext(ctx)
+	if !ok {
+		return nil
+	}
+
+	saved, err := repo.SaveKey(ctx, &models.IdempotencyRecord{
+		UserID:         userID,
+		Key:            req.Key,
+		RequestHash:    req.RequestHash,
+		ResponseStatus: req.ResponseCode,
+		ResponseBody:   req.ResponseBody,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save idempotency key: %w", err)
+	}
+	if saved {
+		return nil
+	}
+
+	existing, err := repo.GetKey(ctx, userID, req.Key)
+	if err != nil {
+		return fmt.Errorf("failed to get idempotency key: %w", err)
+	}
+	if existing.RequestHash != req.RequestHash {
+		return ErrIdempotencyKeyReused
+	}
+	return &ReplayError{ResponseCode: existing.ResponseStatus, ResponseBody: existing.ResponseBody}
+}
@@ -0,0 +1,316 @@
+package service
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/lib/identity"
+	"github.com/linemk/avito-shop/internal/lib/password"
+	"github.com/linemk/avito-shop/internal/storage"
+)
+
+// IdentityProvider проверяет логин и пароль пользователя: локальный пароль магазина,
+// bind в LDAP и т. п. Пользователь, которого провайдер не знает, — identity.ErrUnknownUser,
+// неверный пароль — identity.ErrInvalidCredentials.
+type IdentityProvider interface {
+	Name() string
+	Authenticate(ctx context.Context, username, password string) (*identity.Identity, error)
+}
+
+// RedirectIdentityProvider — провайдер со входом через перенаправление (OIDC).
+type RedirectIdentityProvider interface {
+	Name() string
+	// AuthCodeURL возвращает адрес провайдера для входа; state вернётся в обратный вызов.
+	AuthCodeURL(state string) string
+	// Exchange обменивает код из обратного вызова на учётную запись.
+	Exchange(ctx context.Context, code, state string) (*identity.Identity, error)
+}
+
+// IdentityProviders — провайдеры учётных записей, выбранные в конфиге
+type IdentityProviders struct {
+	// Password — провайдеры входа по логину и паролю в порядке опроса; пусто — только локальные пароли
+	Password []IdentityProvider
+	// Redirect — провайдер входа через перенаправление; nil — такой вход выключен
+	Redirect RedirectIdentityProvider
+}
+
+// OIDCLogin — начало входа через OIDC: пользователь перенаправляется на URL,
+// а State сохраняется у клиента и сверяется в обратном вызове
+type OIDCLogin struct {
+	URL   string
+	State string
+}
+
+type localIdentityProvider struct {
+	log      *slog.Logger
+	userRepo storage.UserStorage
+	hasher   password.Hasher
+}
+
+// NewLocalIdentityProvider создаёт провайдер, который проверяет пароль по хэшу из таблицы users.
+// Хэш, созданный устаревшим алгоритмом или с другими параметрами, после входа пересчитывается.
+func NewLocalIdentityProvider(log *slog.Logger, userRepo storage.UserStorage, hasher password.Hasher) IdentityProvider {
+	return &localIdentityProvider{log: log, userRepo: userRepo, hasher: hasher}
+}
+
+func (p *localIdentityProvider) Name() string {
+	return identity.ProviderLocal
+}
+
+// Authenticate проверяет пароль; пользователь без локального пароля (создан при входе через
+// LDAP или OIDC) для этого провайдера неизвестен, и проверка переходит к следующему провайдеру
+func (p *localIdentityProvider) Authenticate(ctx context.Context, email, password string) (*identity.Identity, error) {
+	const op = "identity.local.Authenticate"
+	logger := p.log.With(slog.String("op", op), slog.String("email", email))
+
+	user, err := p.userRepo.GetUserByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, identity.ErrUnknownUser
+		}
+		return nil, fmt.Errorf("%s: failed to get user: %w", op, err)
+	}
+	if len(user.PassHash) == 0 {
+		return nil, identity.ErrUnknownUser
+	}
+	ok, err := p.hasher.Verify(password, user.PassHash)
+	if err != nil {
+		return nil, fmt.Errorf("%s: failed to verify password: %w", op, err)
+	}
+	if !ok {
+		return nil, identity.ErrInvalidCredentials
+	}
+	p.rehashPassword(ctx, logger, user, password)
+
+	return &identity.Identity{
+		Provider:      identity.ProviderLocal,
+		Subject:       strconv.FormatInt(user.ID, 10),
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+	}, nil
+}
+
+// rehashPassword пересчитывает хэш пароля, если он создан устаревшим алгоритмом или с другими
+// параметрами. Вызывается только после успешной проверки пароля; ошибка не мешает входу,
+// хэш будет пересчитан при следующем.
+func (p *localIdentityProvider) rehashPassword(ctx context.Context, logger *slog.Logger, user *models.User, password string) {
+	if !p.hasher.NeedsRehash(user.PassHash) {
+		return
+	}
+	passHash, err := p.hasher.Hash(password)
+	if err != nil {
+		logger.Error("failed to rehash password", slog.Any("error", err))
+		return
+	}
+	if err := p.userRepo.UpdatePassHash(ctx, user.ID, passHash); err != nil {
+		logger.Error("failed to save rehashed password", slog.Any("error", err))
+		return
+	}
+	user.PassHash = passHash
+	logger.Info("password hash upgraded", slog.Int64("userID", user.ID))
+}
+
+// authenticate опрашивает провайдеры по порядку: решает первый провайдер, который знает пользователя.
+// Если пользователя не знает ни один провайдер, возвращается ErrInvalidCredentials, а при
+// включённом AutoRegister создаётся подтверждённый аккаунт с локальным паролем (старое поведение).
+func (a *AuthService) authenticate(ctx context.Context, logger *slog.Logger, email, password string) (*models.User, error) {
+	for _, provider := range a.opts.Identity.Password {
+		ident, err := provider.Authenticate(ctx, email, password)
+		switch {
+		case err == nil:
+			logger.Info("credentials accepted", slog.String("provider", provider.Name()))
+			return a.provisionUser(ctx, logger, ident)
+		case errors.Is(err, identity.ErrUnknownUser):
+			continue
+		case errors.Is(err, identity.ErrInvalidCredentials):
+			logger.Warn("invalid password", slog.String("provider", provider.Name()))
+			return nil, ErrInvalidCredentials
+		default:
+			return nil, fmt.Errorf("identity provider %s: %w", provider.Name(), err)
+		}
+	}
+	if !a.opts.AutoRegister {
+		logger.Warn("user not found")
+		return nil, ErrInvalidCredentials
+	}
+
+	logger.Info("user not found, creating new user")
+	// Хеширование пароля алгоритмом из конфига (соль добавляется автоматически)
+	passHash, err := a.hasher.Hash(password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hash password: %w", err)
+	}
+	var user *models.User
+	err = a.txManager.Do(ctx, func(ctx context.Context) error {
+		user, err = a.createAccount(ctx, email, passHash)
+		if err != nil {
+			return err
+		}
+		return a.activate(ctx, user)
+	})
+	if err != nil {
+		// аккаунт без локального пароля, созданный внешним провайдером, не перехватывается
+		if errors.Is(err, ErrUserAlreadyExists) {
+			logger.Warn("user has no local password")
+			return nil, ErrInvalidCredentials
+		}
+		return nil, fmt.Errorf("failed to create user: %w", err)
+	}
+	return user, nil
+}
+
+// provisionUser возвращает пользователя магазина для учётной записи провайдера. При первом входе
+// внешняя учётная запись связывается с пользователем с тем же email, а если его нет, создаётся
+// подтверждённый аккаунт без локального пароля с начальными монетами. Связать запись по email
+// можно, только если провайдер подтвердил адрес, иначе — ErrEmailNotVerified. Неподтверждённый
+// аккаунт перед связыванием теряет локальный пароль, второй фактор и все выданные токены.
+func (a *AuthService) provisionUser(ctx context.Context, logger *slog.Logger, ident *identity.Identity) (*models.User, error) {
+	if ident.Provider == identity.ProviderLocal {
+		userID, err := strconv.ParseInt(ident.Subject, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local subject %q: %w", ident.Subject, err)
+		}
+		user, err := a.userRepo.GetUserByID(ctx, userID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user: %w", err)
+		}
+		return user, nil
+	}
+
+	var user *models.User
+	err := a.txManager.Do(ctx, func(ctx context.Context) error {
+		userID, err := a.identityRepo.GetIdentityUserID(ctx, ident.Provider, ident.Subject)
+		if err == nil {
+			user, err = a.userRepo.GetUserByID(ctx, userID)
+			if err != nil {
+				return fmt.Errorf("failed to get user: %w", err)
+			}
+			return nil
+		}
+		if !errors.Is(err, storage.ErrIdentityNotFound) {
+			return err
+		}
+
+		if !ident.EmailVerified {
+			return ErrEmailNotVerified
+		}
+		user, err = a.userRepo.GetUserByEmail(ctx, ident.Email)
+		if errors.Is(err, storage.ErrUserNotFound) {
+			// pass_hash не может быть NULL; пустой хэш означает, что локального пароля нет
+			user, err = a.createAccount(ctx, ident.Email, []byte{})
+			if err == nil {
+				logger.Info("user provisioned", slog.String("provider", ident.Provider), slog.Int64("userID", user.ID))
+			}
+		} else if err == nil && !user.EmailVerified {
+			// владение адресом не подтверждалось, поэтому аккаунт мог зарегистрировать кто угодно:
+			// его пароль, второй фактор и выданные токены не должны перейти к владельцу email
+			if err := a.resetUnverifiedAccount(ctx, user); err != nil {
+				return err
+			}
+			logger.Warn("unverified account credentials reset", slog.String("provider", ident.Provider), slog.Int64("userID", user.ID))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		// провайдер подтвердил email, поэтому неподтверждённый аккаунт активируется
+		if err := a.activate(ctx, user); err != nil {
+			return err
+		}
+		if err := a.identityRepo.LinkIdentity(ctx, ident.Provider, ident.Subject, user.ID); err != nil {
+			return err
+		}
+		logger.Info("identity linked", slog.String("provider", ident.Provider), slog.Int64("userID", user.ID))
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// resetUnverifiedAccount убирает у неподтверждённого аккаунта всё, что мог задать его регистратор:
+// локальный пароль, второй фактор, одноразовые токены, сессии и токены доступа.
+func (a *AuthService) resetUnverifiedAccount(ctx context.Context, user *models.User) error {
+	if err := a.userRepo.UpdatePassHash(ctx, user.ID, []byte{}); err != nil {
+		return fmt.Errorf("failed to clear password: %w", err)
+	}
+	user.PassHash = []byte{}
+	if err := a.twoFactorRepo.DeleteTwoFactor(ctx, user.ID); err != nil {
+		return fmt.Errorf("failed to delete two-factor: %w", err)
+	}
+	for _, purpose := range []string{
+		models.TokenPurposeEmailVerification,
+		models.TokenPurposePasswordReset,
+		models.TokenPurposeTwoFactorLogin,
+		models.TokenPurposeTwoFactorSetup,
+	} {
+		if err := a.tokenRepo.RevokeTokens(ctx, user.ID, purpose); err != nil {
+			return fmt.Errorf("failed to revoke %s tokens: %w", purpose, err)
+		}
+	}
+	return a.revokeAllTokens(ctx, user.ID)
+}
+
+// BeginOIDCLogin начинает вход через OIDC. Если провайдер не включён — ErrIdentityProviderDisabled.
+func (a *AuthService) BeginOIDCLogin(_ context.Context) (*OIDCLogin, error) {
+	const op = "auth.BeginOIDCLogin"
+
+	if a.opts.Identity.Redirect == nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrIdentityProviderDisabled)
+	}
+	state, _, err := newOneTimeToken()
+	if err != nil {
+		a.log.Error("failed to generate state", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return &OIDCLogin{URL: a.opts.Identity.Redirect.AuthCodeURL(state), State: state}, nil
+}
+
+// CompleteOIDCLogin завершает вход через OIDC по коду из обратного вызова. state из обратного
+// вызова должен совпасть с expectedState, сохранённым в BeginOIDCLogin, иначе — ErrInvalidOIDCState.
+// Как и Login, при включённом втором факторе возвращает токен ожидания.
+func (a *AuthService) CompleteOIDCLogin(ctx context.Context, code, state, expectedState, device, clientIP string) (*LoginResult, error) {
+	const op = "auth.CompleteOIDCLogin"
+	logger := a.log.With(slog.String("op", op), slog.String("ip", clientIP))
+
+	provider := a.opts.Identity.Redirect
+	if provider == nil {
+		return nil, fmt.Errorf("%s: %w", op, ErrIdentityProviderDisabled)
+	}
+	if expectedState == "" || subtle.ConstantTimeCompare([]byte(state), []byte(expectedState)) != 1 {
+		logger.Warn("oidc state mismatch")
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidOIDCState)
+	}
+
+	ident, err := provider.Exchange(ctx, code, state)
+	if err != nil {
+		if errors.Is(err, identity.ErrInvalidCredentials) {
+			logger.Warn("oidc code rejected", slog.Any("error", err))
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidCredentials)
+		}
+		logger.Error("failed to exchange oidc code", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	user, err := a.provisionUser(ctx, logger, ident)
+	if err != nil {
+		if errors.Is(err, ErrEmailNotVerified) {
+			logger.Warn("oidc email not verified", slog.String("subject", ident.Subject))
+		} else {
+			logger.Error("failed to provision user", slog.Any("error", err))
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	result, err := a.completeLogin(ctx, user, device, clientIP)
+	if err != nil {
+		logger.Error("failed to complete login", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	logger.Info("user logged in via oidc", slog.Int64("userID", user.ID))
+	return result, nil
+}
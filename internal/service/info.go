@@ -4,7 +4,10 @@ import (
 	"context"
 	"fmt"
 	"log/slog"
+	"slices"
+	"time"
 
+	"github.com/linemk/avito-shop/internal/domain/models"
 	"github.com/linemk/avito-shop/internal/storage"
 )
 
@@ -43,8 +46,9 @@ type InventoryItem struct {
 }
 
 type CoinHistory struct {
-	Received []HistoryEntry `json:"received"`
-	Sent     []HistoryEntry `json:"sent"`
+	Received   []HistoryEntry  `json:"received"`
+	Sent       []HistoryEntry  `json:"sent"`
+	Operations []CoinOperation `json:"operations"` // переводы и покупки от старых к новым
 }
 
 type HistoryEntry struct {
@@ -53,6 +57,18 @@ type HistoryEntry struct {
 	Amount   int    `json:"amount"`
 }
 
+// CoinOperation — операция в общей истории: перевод или покупка.
+// Amount положителен для поступлений и отрицателен для списаний.
+type CoinOperation struct {
+	Type      string    `json:"type"`
+	Amount    int       `json:"amount"`
+	FromUser  string    `json:"fromUser,omitempty"`
+	ToUser    string    `json:"toUser,omitempty"`
+	Item      string    `json:"item,omitempty"`
+	OrderID   int64     `json:"orderId,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
 // GetInfo собирает информацию о пользователе, например, баланс, инвентарь и историю транзакций.
 // Здесь для примера мы просто возвращаем баланс из таблицы пользователей. В реальной реализации
 // необходимо обращаться к соответствующим репозиториям для инвентаря и транзакций.
@@ -92,45 +108,68 @@ func (s *infoService) GetInfo(ctx context.Context, userID int64) (*InfoResponse,
 	transactions, err := s.coinTxRepo.GetTransactionsByUserID(ctx, userID)
 	var received []HistoryEntry
 	var sent []HistoryEntry
+	var operations []CoinOperation
 	if err != nil {
 		s.log.Error("failed to get coin transactions", slog.Any("error", err))
 		// Если ошибка получения транзакций, можно продолжить с пустой историей
 	} else {
+		operations = make([]CoinOperation, 0, len(transactions))
 		for _, tx := range transactions {
+			operation := s.toCoinOperation(ctx, tx)
 			switch tx.Type {
-			case "transfer_received":
-				fromName := ""
-				if tx.RelatedUserID != nil {
-					fromUser, err := s.userRepo.GetUserByID(ctx, *tx.RelatedUserID)
-					if err == nil {
-						fromName = fromUser.Email
-					}
-				}
+			case models.CoinTxTransferReceived:
 				received = append(received, HistoryEntry{
-					FromUser: fromName,
+					FromUser: operation.FromUser,
 					Amount:   tx.Amount,
 				})
-			case "transfer_sent":
-				toName := ""
-				if tx.RelatedUserID != nil {
-					toUser, err := s.userRepo.GetUserByID(ctx, *tx.RelatedUserID)
-					if err == nil {
-						toName = toUser.Email
-					}
-				}
+			case models.CoinTxTransferSent:
 				sent = append(sent, HistoryEntry{
-					ToUser: toName,
+					ToUser: operation.ToUser,
 					Amount: tx.Amount,
 				})
 			}
+			operations = append(operations, operation)
 		}
+		// Транзакции приходят от новых к старым, общая история отдаётся в хронологическом порядке
+		slices.Reverse(operations)
 	}
 
 	// Для упрощения примера, инвентарь и история транзакций возвращаются пустыми.
 	resp := &InfoResponse{
 		Coins:       user.CoinBalance,
 		Inventory:   inventory,
-		CoinHistory: CoinHistory{Received: received, Sent: sent}, // Здесь - транзакции
+		CoinHistory: CoinHistory{Received: received, Sent: sent, Operations: operations}, // Здесь - транзакции
 	}
 	return resp, nil
 }
+
+// toCoinOperation преобразует запись о транзакции в операцию общей истории
+func (s *infoService) toCoinOperation(ctx context.Context, tx *models.CoinTransaction) CoinOperation {
+	op := CoinOperation{Type: tx.Type, Amount: tx.Amount, CreatedAt: tx.CreatedAt}
+	switch tx.Type {
+	case models.CoinTxTransferReceived:
+		op.FromUser = s.relatedUserName(ctx, tx.RelatedUserID)
+	case models.CoinTxTransferSent:
+		op.Amount = -tx.Amount
+		op.ToUser = s.relatedUserName(ctx, tx.RelatedUserID)
+	case models.CoinTxPurchase:
+		op.Amount = -tx.Amount
+		op.Item = tx.MerchName
+		if tx.OrderID != nil {
+			op.OrderID = *tx.OrderID
+		}
+	}
+	return op
+}
+
+// relatedUserName возвращает имя второго участника перевода или пустую строку
+func (s *infoService) relatedUserName(ctx context.Context, userID *int64) string {
+	if userID == nil {
+		return ""
+	}
+	user, err := s.userRepo.GetUserByID(ctx, *userID)
+	if err != nil {
+		return ""
+	}
+	return user.Email
+}
@@ -0,0 +1,454 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"time"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/lib/cache"
+	"github.com/linemk/avito-shop/internal/storage"
+)
+
+// MerchSort — порядок товаров в каталоге; при равной цене товары упорядочиваются по названию
+type MerchSort string
+
+const (
+	MerchSortName      MerchSort = "name"
+	MerchSortNameDesc  MerchSort = "-name"
+	MerchSortPrice     MerchSort = "price"
+	MerchSortPriceDesc MerchSort = "-price"
+)
+
+// Valid сообщает, известен ли порядок сортировки.
+func (s MerchSort) Valid() bool {
+	switch s {
+	case MerchSortName, MerchSortNameDesc, MerchSortPrice, MerchSortPriceDesc:
+		return true
+	}
+	return false
+}
+
+const (
+	// DefaultMerchPageSize — размер страницы каталога, если limit не задан
+	DefaultMerchPageSize = 20
+	// MaxMerchPageSize — наибольший размер страницы каталога
+	MaxMerchPageSize = 100
+)
+
+// MerchFilter — условия выборки страницы каталога
+type MerchFilter struct {
+	Category string // пусто — все категории
+	MinPrice *int
+	MaxPrice *int
+	Sort     MerchSort // пусто — по названию
+	// Cursor — NextCursor предыдущей страницы; пусто — первая страница
+	Cursor string
+	Limit  int // 0 — DefaultMerchPageSize
+}
+
+// MerchPage — страница каталога. NextCursor пуст на последней странице.
+type MerchPage struct {
+	Items      []*models.Merch
+	NextCursor string
+}
+
+// MerchOptions — настройки MerchService
+type MerchOptions struct {
+	// CatalogCacheTTL — сколько каталог хранится в памяти; изменения через сервис и покупки сбрасывают кэш сразу,
+	// а срок ограничивает устаревание при изменениях в обход него (миграции, другие реплики)
+	CatalogCacheTTL time.Duration
+}
+
+// MerchService отдаёт каталог мерча и управляет им. Каталог читается из памяти процесса
+// и загружается из БД при первом запросе после изменения или истечения срока.
+// Архивные товары в каталог не попадают, но остаются в заказах и инвентаре пользователей.
+type MerchService interface {
+	// ListMerch возвращает страницу каталога с учётом фильтров, сортировки и курсора.
+	ListMerch(ctx context.Context, filter MerchFilter) (*MerchPage, error)
+	// GetMerch возвращает товар каталога по названию или ErrMerchNotFound.
+	GetMerch(ctx context.Context, name string) (*models.Merch, error)
+
+	// ListAllMerch возвращает все товары, включая архивные, минуя кэш каталога.
+	ListAllMerch(ctx context.Context) ([]*models.Merch, error)
+	// CreateMerch добавляет товар и записывает его цену в историю. Название занято — ErrMerchAlreadyExists.
+	CreateMerch(ctx context.Context, actorID int64, merch *models.Merch) error
+	// UpdateMerchPrice меняет цену товара, в том числе архивного; новая цена записывается в историю.
+	UpdateMerchPrice(ctx context.Context, actorID int64, name string, price int) (*models.Merch, error)
+	// ArchiveMerch убирает товар из каталога; купить его больше нельзя.
+	ArchiveMerch(ctx context.Context, actorID int64, name string) (*models.Merch, error)
+	// RestoreMerch возвращает архивный товар в каталог.
+	RestoreMerch(ctx context.Context, actorID int64, name string) (*models.Merch, error)
+	// ListMerchPrices возвращает историю цен товара, новые записи первыми.
+	ListMerchPrices(ctx context.Context, name string) ([]*models.MerchPrice, error)
+	// RestockMerch добавляет на склад quantity единиц товара; quantity не больше нуля — ErrInvalidStock.
+	// Для товара без учёта остатка учёт начинается с quantity.
+	RestockMerch(ctx context.Context, actorID int64, name string, quantity int) (*models.Merch, error)
+	// SetMerchStock задаёт остаток по результатам инвентаризации; nil выключает учёт остатка,
+	// отрицательный остаток — ErrInvalidStock.
+	SetMerchStock(ctx context.Context, actorID int64, name string, stock *int) (*models.Merch, error)
+	// InvalidateCatalog сбрасывает кэш каталога после изменения товаров в обход сервиса,
+	// например списания остатка при покупке.
+	InvalidateCatalog()
+}
+
+type merchService struct {
+	log       *slog.Logger
+	txManager storage.TxManager
+	merchRepo storage.MerchStorage
+	catalog   *cache.Value[[]*models.Merch]
+}
+
+func NewMerchService(log *slog.Logger, txManager storage.TxManager, merchRepo storage.MerchStorage, opts MerchOptions) MerchService {
+	return &merchService{
+		log:       log,
+		txManager: txManager,
+		merchRepo: merchRepo,
+		catalog: cache.NewValue(opts.CatalogCacheTTL, func(ctx context.Context) ([]*models.Merch, error) {
+			return merchRepo.ListMerch(ctx, false)
+		}),
+	}
+}
+
+func (s *merchService) InvalidateCatalog() {
+	s.catalog.Invalidate()
+}
+
+// merchCursor — позиция в каталоге: ключ сортировки последнего товара страницы.
+// Порядок сортировки сохраняется, чтобы курсор нельзя было применить к другому порядку.
+type merchCursor struct {
+	Sort  MerchSort `json:"s"`
+	Name  string    `json:"n"`
+	Price int       `json:"p"`
+}
+
+func (s *merchService) ListMerch(ctx context.Context, filter MerchFilter) (*MerchPage, error) {
+	const op = "service.MerchService.ListMerch"
+
+	if filter.Sort == "" {
+		filter.Sort = MerchSortName
+	}
+	if !filter.Sort.Valid() {
+		return nil, fmt.Errorf("%s: unknown sort %q: %w", op, filter.Sort, ErrInvalidMerchFilter)
+	}
+	if filter.MinPrice != nil && filter.MaxPrice != nil && *filter.MinPrice > *filter.MaxPrice {
+		return nil, fmt.Errorf("%s: minPrice is greater than maxPrice: %w", op, ErrInvalidMerchFilter)
+	}
+	if filter.Limit <= 0 {
+		filter.Limit = DefaultMerchPageSize
+	}
+	filter.Limit = min(filter.Limit, MaxMerchPageSize)
+	var after *merchCursor
+	if filter.Cursor != "" {
+		cursor, err := decodeMerchCursor(filter.Cursor)
+		if err != nil || cursor.Sort != filter.Sort {
+			return nil, fmt.Errorf("%s: %w", op, ErrInvalidCursor)
+		}
+		after = cursor
+	}
+
+	catalog, err := s.catalog.Get(ctx)
+	if err != nil {
+		s.log.Error("failed to load merch catalog", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	compare := merchComparator(filter.Sort)
+	items := make([]*models.Merch, 0, len(catalog))
+	for _, m := range catalog {
+		if filter.Category != "" && m.Category != filter.Category {
+			continue
+		}
+		if (filter.MinPrice != nil && m.Price < *filter.MinPrice) || (filter.MaxPrice != nil && m.Price > *filter.MaxPrice) {
+			continue
+		}
+		// товары до курсора включительно уже были на предыдущих страницах
+		if after != nil && compare(&models.Merch{Name: after.Name, Price: after.Price}, m) >= 0 {
+			continue
+		}
+		items = append(items, m)
+	}
+	slices.SortFunc(items, compare)
+
+	page := &MerchPage{Items: make([]*models.Merch, 0, min(len(items), filter.Limit))}
+	for _, m := range items[:min(len(items), filter.Limit)] {
+		// каталог в кэше общий для всех запросов, наружу отдаются копии
+		copied := *m
+		page.Items = append(page.Items, &copied)
+	}
+	if len(items) > filter.Limit {
+		last := page.Items[len(page.Items)-1]
+		page.NextCursor = encodeMerchCursor(merchCursor{Sort: filter.Sort, Name: last.Name, Price: last.Price})
+	}
+	return page, nil
+}
+
+func (s *merchService) GetMerch(ctx context.Context, name string) (*models.Merch, error) {
+	const op = "service.MerchService.GetMerch"
+
+	catalog, err := s.catalog.Get(ctx)
+	if err != nil {
+		s.log.Error("failed to load merch catalog", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	for _, m := range catalog {
+		if m.Name == name {
+			copied := *m
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("%s: %w", op, ErrMerchNotFound)
+}
+
+func (s *merchService) ListAllMerch(ctx context.Context) ([]*models.Merch, error) {
+	const op = "service.MerchService.ListAllMerch"
+
+	items, err := s.merchRepo.ListMerch(ctx, true)
+	if err != nil {
+		s.log.Error("failed to list merch", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return items, nil
+}
+
+func (s *merchService) CreateMerch(ctx context.Context, actorID int64, merch *models.Merch) error {
+	const op = "service.MerchService.CreateMerch"
+	logger := s.log.With(slog.String("op", op), slog.Int64("actorID", actorID), slog.String("item", merch.Name))
+
+	if merch.Price <= 0 {
+		return fmt.Errorf("%s: %w", op, ErrInvalidPrice)
+	}
+	err := s.txManager.Do(ctx, func(ctx context.Context) error {
+		if err := s.merchRepo.CreateMerch(ctx, merch); err != nil {
+			if errors.Is(err, storage.ErrMerchExists) {
+				return ErrMerchAlreadyExists
+			}
+			return err
+		}
+		return s.merchRepo.CreateMerchPrice(ctx, &models.MerchPrice{MerchID: merch.ID, Price: merch.Price, ChangedBy: &actorID})
+	})
+	if err != nil {
+		if !errors.Is(err, ErrMerchAlreadyExists) {
+			logger.Error("failed to create merch", slog.Any("error", err))
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	// кэш сбрасывается после фиксации: загрузка до неё прочитала бы каталог без нового товара
+	s.catalog.Invalidate()
+
+	logger.Info("merch created", slog.Int("price", merch.Price))
+	return nil
+}
+
+func (s *merchService) UpdateMerchPrice(ctx context.Context, actorID int64, name string, price int) (*models.Merch, error) {
+	const op = "service.MerchService.UpdateMerchPrice"
+	logger := s.log.With(slog.String("op", op), slog.Int64("actorID", actorID), slog.String("item", name))
+
+	if price <= 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidPrice)
+	}
+	var merch *models.Merch
+	oldPrice := 0
+	err := s.txManager.Do(ctx, func(ctx context.Context) error {
+		var err error
+		merch, err = s.getMerchForUpdate(ctx, name)
+		if err != nil {
+			return err
+		}
+		oldPrice = merch.Price
+		// та же цена не создаёт запись в истории
+		if merch.Price == price {
+			return nil
+		}
+		if err := s.merchRepo.UpdateMerchPrice(ctx, merch.ID, price); err != nil {
+			return err
+		}
+		merch.Price = price
+		return s.merchRepo.CreateMerchPrice(ctx, &models.MerchPrice{MerchID: merch.ID, Price: price, ChangedBy: &actorID})
+	})
+	if err != nil {
+		if !errors.Is(err, ErrMerchNotFound) {
+			logger.Error("failed to update merch price", slog.Any("error", err))
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	s.catalog.Invalidate()
+
+	logger.Info("merch price changed", slog.Int("oldPrice", oldPrice), slog.Int("price", price))
+	return merch, nil
+}
+
+func (s *merchService) ArchiveMerch(ctx context.Context, actorID int64, name string) (*models.Merch, error) {
+	const op = "service.MerchService.ArchiveMerch"
+	return s.setArchived(ctx, op, actorID, name, true)
+}
+
+func (s *merchService) RestoreMerch(ctx context.Context, actorID int64, name string) (*models.Merch, error) {
+	const op = "service.MerchService.RestoreMerch"
+	return s.setArchived(ctx, op, actorID, name, false)
+}
+
+// setArchived архивирует товар или возвращает его в каталог; повторный вызов ничего не меняет
+func (s *merchService) setArchived(ctx context.Context, op string, actorID int64, name string, archived bool) (*models.Merch, error) {
+	logger := s.log.With(slog.String("op", op), slog.Int64("actorID", actorID), slog.String("item", name))
+
+	var merch *models.Merch
+	err := s.txManager.Do(ctx, func(ctx context.Context) error {
+		var err error
+		merch, err = s.getMerchForUpdate(ctx, name)
+		if err != nil {
+			return err
+		}
+		return s.merchRepo.SetMerchArchived(ctx, merch, archived)
+	})
+	if err != nil {
+		if !errors.Is(err, ErrMerchNotFound) {
+			logger.Error("failed to change merch archive state", slog.Any("error", err))
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	s.catalog.Invalidate()
+
+	logger.Info("merch archive state changed", slog.Bool("archived", archived))
+	return merch, nil
+}
+
+func (s *merchService) ListMerchPrices(ctx context.Context, name string) ([]*models.MerchPrice, error) {
+	const op = "service.MerchService.ListMerchPrices"
+
+	prices, err := s.merchRepo.ListMerchPrices(ctx, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrMerchNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrMerchNotFound)
+		}
+		s.log.Error("failed to list merch prices", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return prices, nil
+}
+
+func (s *merchService) RestockMerch(ctx context.Context, actorID int64, name string, quantity int) (*models.Merch, error) {
+	const op = "service.MerchService.RestockMerch"
+	logger := s.log.With(slog.String("op", op), slog.Int64("actorID", actorID), slog.String("item", name))
+
+	if quantity <= 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidStock)
+	}
+	var merch *models.Merch
+	err := s.txManager.Do(ctx, func(ctx context.Context) error {
+		var err error
+		merch, err = s.getMerchForUpdate(ctx, name)
+		if err != nil {
+			return err
+		}
+		stock, err := s.merchRepo.RestockMerch(ctx, merch.ID, quantity)
+		if err != nil {
+			return err
+		}
+		merch.Stock = &stock
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, ErrMerchNotFound) {
+			logger.Error("failed to restock merch", slog.Any("error", err))
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	merch.Available = merch.ArchivedAt == nil
+	s.catalog.Invalidate()
+
+	logger.Info("merch restocked", slog.Int("quantity", quantity), slog.Int("stock", *merch.Stock))
+	return merch, nil
+}
+
+func (s *merchService) SetMerchStock(ctx context.Context, actorID int64, name string, stock *int) (*models.Merch, error) {
+	const op = "service.MerchService.SetMerchStock"
+	logger := s.log.With(slog.String("op", op), slog.Int64("actorID", actorID), slog.String("item", name))
+
+	if stock != nil && *stock < 0 {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidStock)
+	}
+	var merch *models.Merch
+	err := s.txManager.Do(ctx, func(ctx context.Context) error {
+		var err error
+		merch, err = s.getMerchForUpdate(ctx, name)
+		if err != nil {
+			return err
+		}
+		if err := s.merchRepo.SetMerchStock(ctx, merch.ID, stock); err != nil {
+			return err
+		}
+		merch.Stock = stock
+		return nil
+	})
+	if err != nil {
+		if !errors.Is(err, ErrMerchNotFound) {
+			logger.Error("failed to set merch stock", slog.Any("error", err))
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	merch.Available = merch.ArchivedAt == nil && (stock == nil || *stock > 0)
+	s.catalog.Invalidate()
+
+	if stock == nil {
+		logger.Info("merch stock tracking disabled")
+	} else {
+		logger.Info("merch stock set", slog.Int("stock", *stock))
+	}
+	return merch, nil
+}
+
+// getMerchForUpdate читает товар, в том числе архивный, с блокировкой строки
+func (s *merchService) getMerchForUpdate(ctx context.Context, name string) (*models.Merch, error) {
+	merch, err := s.merchRepo.GetMerchByNameForUpdate(ctx, name)
+	if err != nil {
+		if errors.Is(err, storage.ErrMerchNotFound) {
+			return nil, ErrMerchNotFound
+		}
+		return nil, fmt.Errorf("failed to get merch: %w", err)
+	}
+	return merch, nil
+}
+
+// merchComparator возвращает функцию сравнения товаров для порядка sort.
+// Названия уникальны, поэтому порядок полный и курсор однозначно задаёт позицию.
+func merchComparator(sort MerchSort) func(a, b *models.Merch) int {
+	byName := func(a, b *models.Merch) int { return cmp.Compare(a.Name, b.Name) }
+	switch sort {
+	case MerchSortNameDesc:
+		return func(a, b *models.Merch) int { return byName(b, a) }
+	case MerchSortPrice:
+		return func(a, b *models.Merch) int { return cmp.Or(cmp.Compare(a.Price, b.Price), byName(a, b)) }
+	case MerchSortPriceDesc:
+		return func(a, b *models.Merch) int { return cmp.Or(cmp.Compare(b.Price, a.Price), byName(a, b)) }
+	default:
+		return byName
+	}
+}
+
+// encodeMerchCursor кодирует курсор в непрозрачную для клиента строку
+func encodeMerchCursor(c merchCursor) string {
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeMerchCursor(s string) (*merchCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	var c merchCursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, err
+	}
+	if c.Name == "" {
+		return nil, errors.New("empty cursor")
+	}
+	return &c, nil
+}
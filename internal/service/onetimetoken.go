@@ -0,0 +1,27 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+)
+
+// oneTimeTokenBytes — длина случайной части одноразового токена
+const oneTimeTokenBytes = 32
+
+// newOneTimeToken генерирует одноразовый токен для письма и его хэш для хранения в БД
+func newOneTimeToken() (token string, hash []byte, err error) {
+	b := make([]byte, oneTimeTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", nil, fmt.Errorf("failed to generate token: %w", err)
+	}
+	token = base64.RawURLEncoding.EncodeToString(b)
+	return token, hashOneTimeToken(token), nil
+}
+
+// hashOneTimeToken возвращает SHA-256 токена. Токен случайный и длинный, поэтому соль не нужна.
+func hashOneTimeToken(token string) []byte {
+	sum := sha256.Sum256([]byte(token))
+	return sum[:]
+}
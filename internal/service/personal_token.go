@@ -0,0 +1,158 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
+	"github.com/linemk/avito-shop/internal/storage"
+)
+
+const (
+	// maxPersonalTokenNameLength — ограничение длины названия токена
+	maxPersonalTokenNameLength = 100
+	// personalTokenTouchInterval — как часто обновлять время последнего использования токена:
+	// бот может делать много запросов подряд, записывать каждый незачем
+	personalTokenTouchInterval = time.Minute
+)
+
+// PersonalTokenService управляет персональными токенами доступа для ботов и интеграций.
+// Токен действует от имени владельца, но только для операций, разрешённых его правами.
+type PersonalTokenService interface {
+	// CreatePersonalToken выпускает токен; сам токен возвращается только здесь, хранится лишь его хэш.
+	CreatePersonalToken(ctx context.Context, userID int64, name string, scopes []models.Scope, expiresAt *time.Time) (*models.PersonalToken, string, error)
+	// ListPersonalTokens возвращает действующие токены пользователя, новые первыми.
+	ListPersonalTokens(ctx context.Context, userID int64) ([]*models.PersonalToken, error)
+	// RevokePersonalToken отзывает токен пользователя.
+	RevokePersonalToken(ctx context.Context, userID, tokenID int64) error
+
+	jwtmiddleware.PersonalTokenAuthenticator
+}
+
+type personalTokenService struct {
+	log       *slog.Logger
+	userRepo  storage.UserStorage
+	tokenRepo storage.PersonalTokenStorage
+}
+
+func NewPersonalTokenService(log *slog.Logger, userRepo storage.UserStorage, tokenRepo storage.PersonalTokenStorage) PersonalTokenService {
+	return &personalTokenService{
+		log:       log,
+		userRepo:  userRepo,
+		tokenRepo: tokenRepo,
+	}
+}
+
+// CreatePersonalToken выпускает токен вида pat_<случайная строка>. Права не должны повторяться;
+// срок действия, если задан, должен быть в будущем.
+func (s *personalTokenService) CreatePersonalToken(ctx context.Context, userID int64, name string, scopes []models.Scope, expiresAt *time.Time) (*models.PersonalToken, string, error) {
+	const op = "service.PersonalTokenService.CreatePersonalToken"
+	logger := s.log.With(slog.String("op", op), slog.Int64("userID", userID))
+
+	if len(scopes) == 0 {
+		return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidScope)
+	}
+	for i, scope := range scopes {
+		if !scope.Valid() || slices.Contains(scopes[:i], scope) {
+			return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidScope)
+		}
+	}
+	if expiresAt != nil && !expiresAt.After(time.Now()) {
+		return nil, "", fmt.Errorf("%s: %w", op, ErrInvalidTokenExpiry)
+	}
+	name = strings.TrimSpace(name)
+	if len(name) > maxPersonalTokenNameLength {
+		name = strings.ToValidUTF8(name[:maxPersonalTokenNameLength], "")
+	}
+
+	secret, _, err := newOneTimeToken()
+	if err != nil {
+		logger.Error("failed to generate personal token", slog.Any("error", err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+	token := models.PersonalTokenPrefix + secret
+	pt := &models.PersonalToken{
+		UserID:    userID,
+		Name:      name,
+		Scopes:    scopes,
+		TokenHash: hashOneTimeToken(token),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.tokenRepo.CreatePersonalToken(ctx, pt); err != nil {
+		logger.Error("failed to save personal token", slog.Any("error", err))
+		return nil, "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("personal token created", slog.Int64("tokenID", pt.ID), slog.Any("scopes", scopes))
+	return pt, token, nil
+}
+
+func (s *personalTokenService) ListPersonalTokens(ctx context.Context, userID int64) ([]*models.PersonalToken, error) {
+	const op = "service.PersonalTokenService.ListPersonalTokens"
+
+	tokens, err := s.tokenRepo.ListPersonalTokens(ctx, userID)
+	if err != nil {
+		s.log.Error("failed to list personal tokens", slog.String("op", op), slog.Int64("userID", userID), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return tokens, nil
+}
+
+func (s *personalTokenService) RevokePersonalToken(ctx context.Context, userID, tokenID int64) error {
+	const op = "service.PersonalTokenService.RevokePersonalToken"
+	logger := s.log.With(slog.String("op", op), slog.Int64("userID", userID), slog.Int64("tokenID", tokenID))
+
+	if err := s.tokenRepo.RevokePersonalToken(ctx, userID, tokenID); err != nil {
+		if errors.Is(err, storage.ErrPersonalTokenNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrPersonalTokenNotFound)
+		}
+		logger.Error("failed to revoke personal token", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("personal token revoked")
+	return nil
+}
+
+// AuthenticatePersonalToken проверяет токен для jwtmiddleware. Роль берётся из текущей роли владельца,
+// поэтому понижение роли сразу действует и на его токены.
+func (s *personalTokenService) AuthenticatePersonalToken(ctx context.Context, token string) (*jwtmiddleware.PersonalTokenIdentity, error) {
+	const op = "service.PersonalTokenService.AuthenticatePersonalToken"
+	logger := s.log.With(slog.String("op", op))
+
+	pt, err := s.tokenRepo.GetPersonalTokenByHash(ctx, hashOneTimeToken(token))
+	if err != nil {
+		if errors.Is(err, storage.ErrPersonalTokenNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, jwtmiddleware.ErrInvalidToken)
+		}
+		logger.Error("failed to get personal token", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	user, err := s.userRepo.GetUserByID(ctx, pt.UserID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, jwtmiddleware.ErrInvalidToken)
+		}
+		logger.Error("failed to get token owner", slog.Int64("userID", pt.UserID), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if pt.LastUsedAt == nil || time.Since(*pt.LastUsedAt) > personalTokenTouchInterval {
+		// время использования только для списка токенов: из-за сбоя записи запрос не отклоняем
+		if err := s.tokenRepo.TouchPersonalToken(ctx, pt.ID); err != nil {
+			logger.Warn("failed to update personal token last use", slog.Int64("tokenID", pt.ID), slog.Any("error", err))
+		}
+	}
+
+	role := user.Role
+	if !role.Valid() {
+		role = models.RoleEmployee
+	}
+	return &jwtmiddleware.PersonalTokenIdentity{UserID: user.ID, Role: role, Scopes: pt.Scopes}, nil
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/storage"
+)
+
+// ReconcileService сверяет кэш балансов с историей операций и исправляет расхождения.
+type ReconcileService interface {
+	// Reconcile строит отчёт о расхождениях.
+	Reconcile(ctx context.Context) (*ReconcileReport, error)
+	// Fix записывает корректирующие проводки для расхождений по балансам из отчёта.
+	Fix(ctx context.Context, report *ReconcileReport, reason string) error
+}
+
+// ReconcileReport — результат сверки
+type ReconcileReport struct {
+	CheckedAt    time.Time          `json:"checkedAt"`
+	CheckedUsers int                `json:"checkedUsers"`
+	Users        []UserDiscrepancy  `json:"users"`
+	Orders       []OrderDiscrepancy `json:"orders"`
+}
+
+// UserDiscrepancy — расхождение баланса пользователя.
+// Expected = начальное начисление + полученные переводы - отправленные переводы - сумма заказов.
+type UserDiscrepancy struct {
+	UserID        int64  `json:"userId"`
+	Email         string `json:"email"`
+	CoinBalance   int    `json:"coinBalance"`
+	Expected      int    `json:"expected"`
+	Difference    int    `json:"difference"` // Expected - CoinBalance
+	LedgerBalance int    `json:"ledgerBalance"`
+	Fixed         bool   `json:"fixed"`
+}
+
+// OrderDiscrepancy — заказ с неверной суммой
+type OrderDiscrepancy struct {
+	OrderID       int64  `json:"orderId"`
+	UserID        int64  `json:"userId"`
+	Item          string `json:"item"`
+	Quantity      int    `json:"quantity"`
+	TotalPrice    int    `json:"totalPrice"`
+	ExpectedPrice int    `json:"expectedPrice"`
+}
+
+// HasMismatches сообщает, остались ли неисправленные расхождения
+func (r *ReconcileReport) HasMismatches() bool {
+	if len(r.Orders) > 0 {
+		return true
+	}
+	for _, u := range r.Users {
+		if !u.Fixed {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrReasonRequired возвращается, если корректировка запрошена без причины для аудита
+var ErrReasonRequired = errors.New("audit reason is required")
+
+type reconcileService struct {
+	log           *slog.Logger
+	txManager     storage.TxManager
+	userRepo      storage.UserStorage
+	ledgerRepo    storage.LedgerStorage
+	reconcileRepo storage.ReconcileStorage
+}
+
+func NewReconcileService(log *slog.Logger, txManager storage.TxManager, userRepo storage.UserStorage, ledgerRepo storage.LedgerStorage, reconcileRepo storage.ReconcileStorage) ReconcileService {
+	return &reconcileService{
+		log:           log,
+		txManager:     txManager,
+		userRepo:      userRepo,
+		ledgerRepo:    ledgerRepo,
+		reconcileRepo: reconcileRepo,
+	}
+}
+
+func (s *reconcileService) Reconcile(ctx context.Context) (*ReconcileReport, error) {
+	const op = "service.ReconcileService.Reconcile"
+	logger := s.log.With(slog.String("op", op))
+
+	facts, err := s.reconcileRepo.ListBalanceFacts(ctx)
+	if err != nil {
+		logger.Error("failed to list balance facts", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: failed to list balance facts: %w", op, err)
+	}
+
+	report := &ReconcileReport{CheckedAt: time.Now().UTC(), CheckedUsers: len(facts)}
+	for _, f := range facts {
+		if d, ok := checkBalance(f); ok {
+			report.Users = append(report.Users, d)
+		}
+	}
+
+	mismatches, err := s.reconcileRepo.ListOrderPriceMismatches(ctx)
+	if err != nil {
+		logger.Error("failed to list order price mismatches", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: failed to list order price mismatches: %w", op, err)
+	}
+	for _, m := range mismatches {
+		report.Orders = append(report.Orders, OrderDiscrepancy{
+			OrderID:       m.OrderID,
+			UserID:        m.UserID,
+			Item:          m.MerchName,
+			Quantity:      m.Quantity,
+			TotalPrice:    m.TotalPrice,
+			ExpectedPrice: m.ExpectedPrice,
+		})
+	}
+
+	logger.Info("reconciliation finished",
+		slog.Int("checkedUsers", report.CheckedUsers),
+		slog.Int("userMismatches", len(report.Users)),
+		slog.Int("orderMismatches", len(report.Orders)),
+	)
+	return report, nil
+}
+
+// Fix выравнивает баланс каждого пользователя из отчёта по ожидаемому значению записью
+// журнала типа adjustment. Расхождение пересчитывается под блокировкой строки пользователя,
+// поэтому операции, прошедшие после построения отчёта, не искажают корректировку.
+// Заказы с неверной суммой и расхождение кэша с журналом при верном ожидаемом балансе
+// не исправляются автоматически и остаются в отчёте.
+func (s *reconcileService) Fix(ctx context.Context, report *ReconcileReport, reason string) error {
+	const op = "service.ReconcileService.Fix"
+	logger := s.log.With(slog.String("op", op))
+
+	if reason == "" {
+		return fmt.Errorf("%s: %w", op, ErrReasonRequired)
+	}
+
+	for i := range report.Users {
+		d := &report.Users[i]
+		fixed := false
+		err := s.txManager.Do(ctx, func(ctx context.Context) error {
+			fixed = false
+			if _, err := s.userRepo.GetUserByIDForUpdate(ctx, d.UserID); err != nil {
+				return fmt.Errorf("failed to lock user: %w", err)
+			}
+			facts, err := s.reconcileRepo.GetBalanceFactsByUserID(ctx, d.UserID)
+			if err != nil {
+				return fmt.Errorf("failed to get balance facts: %w", err)
+			}
+			current, ok := checkBalance(facts)
+			if !ok {
+				fixed = true
+				return nil
+			}
+			if current.Difference == 0 {
+				return nil
+			}
+			_, err = s.ledgerRepo.PostEntry(ctx, &models.LedgerEntry{
+				Kind:      models.LedgerEntryAdjustment,
+				Reference: fmt.Sprintf("reconcile:user:%d", d.UserID),
+				Reason:    reason,
+				Postings: []models.LedgerPosting{
+					{Account: models.SystemAccount(models.LedgerAccountCompanyIssuance), Amount: -current.Difference},
+					{Account: models.WalletAccount(d.UserID), Amount: current.Difference},
+				},
+			})
+			fixed = err == nil
+			return err
+		})
+		if err != nil {
+			logger.Error("failed to fix balance", slog.Int64("userID", d.UserID), slog.Any("error", err))
+			return fmt.Errorf("%s: failed to fix balance of user %d: %w", op, d.UserID, err)
+		}
+		d.Fixed = fixed
+		if fixed {
+			logger.Info("balance adjusted", slog.Int64("userID", d.UserID), slog.Int("difference", d.Difference))
+		} else {
+			logger.Warn("cached balance differs from ledger, adjustment skipped", slog.Int64("userID", d.UserID))
+		}
+	}
+	return nil
+}
+
+// checkBalance вычисляет ожидаемый баланс и возвращает расхождение, если оно есть.
+// Пользователям, созданным до журнала, засчитывается стандартное начальное начисление.
+func checkBalance(f *models.BalanceFacts) (UserDiscrepancy, bool) {
+	grants := f.Grants
+	if f.LegacyUser {
+		grants += InitialCoinGrant
+	}
+	expected := grants + f.Received - f.Sent - f.Spent
+	if expected == f.CoinBalance && f.LedgerBalance == f.CoinBalance {
+		return UserDiscrepancy{}, false
+	}
+	return UserDiscrepancy{
+		UserID:        f.UserID,
+		Email:         f.Email,
+		CoinBalance:   f.CoinBalance,
+		Expected:      expected,
+		Difference:    expected - f.CoinBalance,
+		LedgerBalance: f.LedgerBalance,
+	}, true
+}
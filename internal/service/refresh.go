@@ -0,0 +1,240 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
+	"github.com/linemk/avito-shop/internal/storage"
+)
+
+// TokenPair — короткоживущий access-токен (JWT) и refresh-токен для его обновления
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+}
+
+// maxDeviceLength — ограничение длины метки устройства
+const maxDeviceLength = 255
+
+// Refresh выдаёт новую пару токенов по refresh-токену. Старый refresh-токен отзывается (ротация),
+// сессия продлевается. Токен отозванной сессии не принимается. Для токена, выданного до появления
+// сессий, начинается новая сессия. Повторное предъявление уже заменённого токена означает,
+// что он утёк: в этом случае отзываются все токены пользователя — refresh, access и сессии.
+func (a *AuthService) Refresh(ctx context.Context, refreshToken string) (*TokenPair, error) {
+	const op = "auth.Refresh"
+	logger := a.log.With(slog.String("op", op))
+
+	var pair *TokenPair
+	var reusedByUserID int64
+	err := a.txManager.Do(ctx, func(ctx context.Context) error {
+		stored, err := a.refreshRepo.GetRefreshTokenForUpdate(ctx, hashOneTimeToken(refreshToken))
+		if err != nil {
+			if errors.Is(err, storage.ErrTokenNotFound) {
+				return ErrInvalidRefreshToken
+			}
+			return err
+		}
+		if stored.RevokedAt != nil {
+			if stored.ReplacedBy != nil {
+				reusedByUserID = stored.UserID
+			}
+			return ErrInvalidRefreshToken
+		}
+		if time.Now().After(stored.ExpiresAt) {
+			return ErrInvalidRefreshToken
+		}
+
+		user, err := a.userRepo.GetUserByID(ctx, stored.UserID)
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		// роли назначили обязательный второй фактор: сессии без него не продлеваются
+		if err := a.checkTwoFactorRequirement(ctx, user); err != nil {
+			return err
+		}
+		session, err := a.refreshSession(ctx, stored)
+		if err != nil {
+			return err
+		}
+		newPair, newID, err := a.issueTokens(ctx, user, session)
+		if err != nil {
+			return err
+		}
+		if err := a.refreshRepo.RevokeRefreshToken(ctx, stored.ID, &newID); err != nil {
+			return err
+		}
+		pair = newPair
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrTwoFactorRequired) {
+			logger.Warn("refresh rejected until two-factor is enabled")
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if !errors.Is(err, ErrInvalidRefreshToken) {
+			logger.Error("failed to refresh tokens", slog.Any("error", err))
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		logger.Warn("invalid refresh token")
+		if reusedByUserID != 0 {
+			// отзыв выполняется после отката транзакции, иначе он откатился бы вместе с ней
+			logger.Warn("refresh token reuse detected, revoking all sessions", slog.Int64("userID", reusedByUserID))
+			// выданные access-токены и сессии тоже отзываются: ими мог завладеть тот, кто украл refresh-токен
+			if err := a.txManager.Do(ctx, func(ctx context.Context) error {
+				return a.revokeAllTokens(ctx, reusedByUserID)
+			}); err != nil {
+				logger.Error("failed to revoke tokens", slog.Any("error", err))
+			}
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("tokens refreshed")
+	return pair, nil
+}
+
+// Logout отзывает текущий access-токен (по jti), его сессию и, если передан, refresh-токен этого устройства.
+// Чужой или неизвестный refresh-токен игнорируется.
+func (a *AuthService) Logout(ctx context.Context, userID int64, token jwtmiddleware.TokenInfo, refreshToken string) error {
+	const op = "auth.Logout"
+	logger := a.log.With(slog.String("op", op), slog.Int64("userID", userID))
+
+	err := a.txManager.Do(ctx, func(ctx context.Context) error {
+		if err := a.refreshRepo.RevokeAccessToken(ctx, token.ID, userID, token.ExpiresAt); err != nil {
+			return err
+		}
+		if token.SessionID != 0 {
+			err := a.sessionRepo.RevokeSession(ctx, userID, token.SessionID)
+			if err != nil && !errors.Is(err, storage.ErrSessionNotFound) {
+				return err
+			}
+			if err := a.refreshRepo.RevokeSessionRefreshTokens(ctx, token.SessionID); err != nil {
+				return err
+			}
+		}
+		if refreshToken == "" {
+			return nil
+		}
+		stored, err := a.refreshRepo.GetRefreshTokenForUpdate(ctx, hashOneTimeToken(refreshToken))
+		if err != nil {
+			if errors.Is(err, storage.ErrTokenNotFound) {
+				return nil
+			}
+			return err
+		}
+		if stored.UserID != userID {
+			logger.Warn("refresh token belongs to another user")
+			return nil
+		}
+		return a.refreshRepo.RevokeRefreshToken(ctx, stored.ID, nil)
+	})
+	if err != nil {
+		logger.Error("failed to logout", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("user logged out")
+	return nil
+}
+
+// LogoutAll завершает все сессии пользователя: access-токены, выданные до этого момента,
+// перестают приниматься, все refresh-токены отзываются.
+func (a *AuthService) LogoutAll(ctx context.Context, userID int64) error {
+	const op = "auth.LogoutAll"
+	logger := a.log.With(slog.String("op", op), slog.Int64("userID", userID))
+
+	err := a.txManager.Do(ctx, func(ctx context.Context) error {
+		return a.revokeAllTokens(ctx, userID)
+	})
+	if err != nil {
+		logger.Error("failed to logout everywhere", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("user logged out everywhere")
+	return nil
+}
+
+// CheckAccessToken реализует jwtmiddleware.RevocationChecker. Токен сессии (claim sid) принимается,
+// только пока сессия действует.
+func (a *AuthService) CheckAccessToken(ctx context.Context, userID int64, token jwtmiddleware.TokenInfo) error {
+	const op = "auth.CheckAccessToken"
+	logger := a.log.With(slog.String("op", op))
+
+	revoked, err := a.refreshRepo.IsAccessTokenRevoked(ctx, userID, token.ID, token.IssuedAt)
+	if err != nil {
+		logger.Error("failed to check access token", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if revoked {
+		return fmt.Errorf("%s: %w", op, jwtmiddleware.ErrTokenRevoked)
+	}
+	if token.SessionID == 0 {
+		return nil
+	}
+	active, err := a.checkSession(ctx, logger, userID, token.SessionID)
+	if err != nil {
+		logger.Error("failed to check session", slog.Int64("sessionID", token.SessionID), slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if !active {
+		return fmt.Errorf("%s: %w", op, jwtmiddleware.ErrTokenRevoked)
+	}
+	return nil
+}
+
+// revokeAllTokens делает недействительными все выданные пользователю токены
+func (a *AuthService) revokeAllTokens(ctx context.Context, userID int64) error {
+	if err := a.refreshRepo.SetTokensValidAfter(ctx, userID, time.Now()); err != nil {
+		return err
+	}
+	return a.refreshRepo.RevokeUserRefreshTokens(ctx, userID)
+}
+
+// refreshSession возвращает продлённую сессию refresh-токена; для токена без сессии начинает новую
+func (a *AuthService) refreshSession(ctx context.Context, stored *models.RefreshToken) (*models.Session, error) {
+	if stored.SessionID == 0 {
+		// адрес, с которого выполнен вход, для таких токенов не сохранился
+		return a.createSession(ctx, stored.UserID, stored.Device, "")
+	}
+	session, err := a.sessionRepo.GetActiveSession(ctx, stored.SessionID)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("failed to get session: %w", err)
+	}
+	session.ExpiresAt = time.Now().Add(a.opts.RefreshTokenTTL)
+	if err := a.sessionRepo.ExtendSession(ctx, session.ID, session.ExpiresAt); err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// issueTokens выдаёт access-токен сессии и сохраняет её новый refresh-токен; возвращает также ID refresh-токена
+func (a *AuthService) issueTokens(ctx context.Context, user *models.User, session *models.Session) (*TokenPair, int64, error) {
+	accessToken, err := a.keys.NewToken(ctx, user, session.ID, a.opts.TokenTTL)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to generate token: %w", err)
+	}
+	refreshToken, refreshHash, err := newOneTimeToken()
+	if err != nil {
+		return nil, 0, err
+	}
+	id, err := a.refreshRepo.CreateRefreshToken(ctx, &models.RefreshToken{
+		UserID:    user.ID,
+		SessionID: session.ID,
+		TokenHash: refreshHash,
+		Device:    session.UserAgent,
+		ExpiresAt: time.Now().Add(a.opts.RefreshTokenTTL),
+	})
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to save refresh token: %w", err)
+	}
+	return &TokenPair{AccessToken: accessToken, RefreshToken: refreshToken}, id, nil
+}
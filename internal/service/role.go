@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/storage"
+)
+
+// maxRoleChangeReasonLength — ограничение длины причины изменения роли
+const maxRoleChangeReasonLength = 500
+
+// RoleService управляет ролями пользователей. Каждое изменение роли записывается в журнал.
+type RoleService interface {
+	// ChangeRole назначает пользователю userID роль от имени администратора actorID.
+	ChangeRole(ctx context.Context, actorID, userID int64, role models.Role, reason string) (*models.RoleChange, error)
+	// ListRoleChanges возвращает журнал изменений роли пользователя, новые записи первыми.
+	ListRoleChanges(ctx context.Context, userID int64) ([]*models.RoleChange, error)
+}
+
+type roleService struct {
+	log         *slog.Logger
+	txManager   storage.TxManager
+	userRepo    storage.UserStorage
+	roleRepo    storage.RoleStorage
+	refreshRepo storage.RefreshTokenStorage
+}
+
+func NewRoleService(log *slog.Logger, txManager storage.TxManager, userRepo storage.UserStorage, roleRepo storage.RoleStorage, refreshRepo storage.RefreshTokenStorage) RoleService {
+	return &roleService{
+		log:         log,
+		txManager:   txManager,
+		userRepo:    userRepo,
+		roleRepo:    roleRepo,
+		refreshRepo: refreshRepo,
+	}
+}
+
+// ChangeRole меняет роль в одной транзакции с записью в журнал. Access-токены пользователя,
+// выданные до изменения, отзываются: роль в токене обновится при следующем refresh.
+// Свою роль администратор изменить не может, чтобы не остаться без администраторов по ошибке.
+func (s *roleService) ChangeRole(ctx context.Context, actorID, userID int64, role models.Role, reason string) (*models.RoleChange, error) {
+	const op = "service.RoleService.ChangeRole"
+	logger := s.log.With(slog.String("op", op), slog.Int64("actorID", actorID), slog.Int64("userID", userID), slog.String("role", string(role)))
+
+	if !role.Valid() {
+		return nil, fmt.Errorf("%s: %w", op, ErrInvalidRole)
+	}
+	if actorID == userID {
+		return nil, fmt.Errorf("%s: %w", op, ErrSelfRoleChange)
+	}
+	reason = strings.TrimSpace(reason)
+	if len(reason) > maxRoleChangeReasonLength {
+		reason = strings.ToValidUTF8(reason[:maxRoleChangeReasonLength], "")
+	}
+
+	var change *models.RoleChange
+	err := s.txManager.Do(ctx, func(ctx context.Context) error {
+		user, err := s.userRepo.GetUserByIDForUpdate(ctx, userID)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				return ErrUserNotFound
+			}
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		change = &models.RoleChange{
+			UserID:    userID,
+			OldRole:   user.Role,
+			NewRole:   role,
+			ChangedBy: actorID,
+			Reason:    reason,
+		}
+		if user.Role == role {
+			// роль не меняется: ни журнал, ни токены не трогаем
+			change.CreatedAt = time.Now()
+			return nil
+		}
+		if err := s.roleRepo.UpdateUserRole(ctx, userID, role); err != nil {
+			return err
+		}
+		if err := s.roleRepo.CreateRoleChange(ctx, change); err != nil {
+			return err
+		}
+		return s.refreshRepo.SetTokensValidAfter(ctx, userID, time.Now())
+	})
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			logger.Warn("user not found")
+		} else {
+			logger.Error("failed to change role", slog.Any("error", err))
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("role changed", slog.String("oldRole", string(change.OldRole)))
+	return change, nil
+}
+
+func (s *roleService) ListRoleChanges(ctx context.Context, userID int64) ([]*models.RoleChange, error) {
+	const op = "service.RoleService.ListRoleChanges"
+	logger := s.log.With(slog.String("op", op), slog.Int64("userID", userID))
+
+	if _, err := s.userRepo.GetUserByID(ctx, userID); err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		logger.Error("failed to get user", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	changes, err := s.roleRepo.ListRoleChanges(ctx, userID)
+	if err != nil {
+		logger.Error("failed to list role changes", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return changes, nil
+}
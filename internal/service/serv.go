@@ -9,80 +9,289 @@ import (
 
 	"github.com/linemk/avito-shop/internal/domain/models"
 	security "github.com/linemk/avito-shop/internal/jwtNew"
+	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
+	"github.com/linemk/avito-shop/internal/lib/mailer"
+	"github.com/linemk/avito-shop/internal/lib/password"
 	"github.com/linemk/avito-shop/internal/storage"
-	"golang.org/x/crypto/bcrypt"
 )
 
+// InitialCoinGrant — количество монет, выдаваемых каждому новому сотруднику
+const InitialCoinGrant = 1000
+
+// AuthOptions — настройки AuthService
+type AuthOptions struct {
+	// TokenTTL — срок действия access-токена
+	TokenTTL time.Duration
+	// RefreshTokenTTL — срок действия refresh-токена
+	RefreshTokenTTL time.Duration
+	// AutoRegister включает старое поведение: Login с неизвестным email создаёт подтверждённый аккаунт
+	AutoRegister bool
+	// VerificationTTL — срок действия токена подтверждения email
+	VerificationTTL time.Duration
+	// PasswordResetTTL — срок действия токена сброса пароля
+	PasswordResetTTL time.Duration
+	// Throttle — защита от перебора паролей
+	Throttle LoginThrottleOptions
+	// TwoFactor — второй фактор (TOTP)
+	TwoFactor TwoFactorOptions
+	// Identity — провайдеры учётных записей (локальные пароли, LDAP, OIDC)
+	Identity IdentityProviders
+}
+
 type AuthService struct {
-	log      *slog.Logger
-	userRepo storage.UserStorage
-	tokenTTL time.Duration
+	log           *slog.Logger
+	txManager     storage.TxManager
+	userRepo      storage.UserStorage
+	ledgerRepo    storage.LedgerStorage
+	tokenRepo     storage.OneTimeTokenStorage
+	refreshRepo   storage.RefreshTokenStorage
+	attemptRepo   storage.LoginAttemptStorage
+	twoFactorRepo storage.TwoFactorStorage
+	identityRepo  storage.IdentityStorage
+	sessionRepo   storage.SessionStorage
+	mailer        mailer.Mailer
+	hasher        password.Hasher
+	keys          *security.KeySet
+	opts          AuthOptions
 }
 
-func NewAuthService(log *slog.Logger, userRepo storage.UserStorage, tokenTTL time.Duration) *AuthService {
+// NewAuthService создаёт сервис аутентификации. Если провайдеры учётных записей не заданы,
+// пароль проверяется только по локальному хэшу.
+func NewAuthService(log *slog.Logger, txManager storage.TxManager, userRepo storage.UserStorage, ledgerRepo storage.LedgerStorage, tokenRepo storage.OneTimeTokenStorage, refreshRepo storage.RefreshTokenStorage, attemptRepo storage.LoginAttemptStorage, twoFactorRepo storage.TwoFactorStorage, identityRepo storage.IdentityStorage, sessionRepo storage.SessionStorage, mailer mailer.Mailer, hasher password.Hasher, keys *security.KeySet, opts AuthOptions) *AuthService {
+	if len(opts.Identity.Password) == 0 && opts.Identity.Redirect == nil {
+		opts.Identity.Password = []IdentityProvider{NewLocalIdentityProvider(log, userRepo, hasher)}
+	}
 	return &AuthService{
-		log:      log,
-		userRepo: userRepo,
-		tokenTTL: tokenTTL,
+		log:           log,
+		txManager:     txManager,
+		userRepo:      userRepo,
+		ledgerRepo:    ledgerRepo,
+		tokenRepo:     tokenRepo,
+		refreshRepo:   refreshRepo,
+		attemptRepo:   attemptRepo,
+		twoFactorRepo: twoFactorRepo,
+		identityRepo:  identityRepo,
+		sessionRepo:   sessionRepo,
+		mailer:        mailer,
+		hasher:        hasher,
+		keys:          keys,
+		opts:          opts,
 	}
 }
 
 type AuthServiceInterface interface {
-	Login(ctx context.Context, username, password string) (string, error)
+	Login(ctx context.Context, username, password, device, clientIP string) (*LoginResult, error)
+	Register(ctx context.Context, username, password string) error
+	VerifyEmail(ctx context.Context, token string) error
+	Refresh(ctx context.Context, refreshToken string) (*TokenPair, error)
+	Logout(ctx context.Context, userID int64, token jwtmiddleware.TokenInfo, refreshToken string) error
+	LogoutAll(ctx context.Context, userID int64) error
+	ChangePassword(ctx context.Context, userID int64, currentPassword, newPassword string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	BeginOIDCLogin(ctx context.Context) (*OIDCLogin, error)
+	CompleteOIDCLogin(ctx context.Context, code, state, expectedState, device, clientIP string) (*LoginResult, error)
 }
 
-// Login осуществляет аутентификацию пользователя.
-// Если пользователь не найден, он создаётся (при этом пароль хэшируется через bcrypt, который автоматически добавляет соль).
-// Если пользователь найден, введённый пароль сравнивается с сохранённым хэшированным значением.
-// После успешной проверки генерируется JWT-токен (секрет для подписи берется из переменной окружения).
-func (a *AuthService) Login(ctx context.Context, email, password string) (string, error) {
+// Login осуществляет аутентификацию пользователя: пароль проверяют провайдеры из AuthOptions.Identity
+// (локальный хэш bcrypt или argon2id, bind в LDAP), после успешной проверки выдаются access-токен (JWT)
+// и refresh-токен с меткой устройства device. При первом входе через внешний провайдер пользователь
+// создаётся или связывается с существующим по подтверждённому email (см. provisionUser).
+// Неизвестный email — ошибка ErrInvalidCredentials. Если включён AutoRegister, вместо этого
+// создаётся подтверждённый аккаунт с начальными монетами (старое поведение).
+// Неудачные попытки считаются по аккаунту и по IP-адресу clientIP; пока любой из них
+// заблокирован, возвращается *TooManyAttemptsError без проверки пароля.
+// Хэш, созданный устаревшим алгоритмом или с другими параметрами, после входа пересчитывается.
+// Если у пользователя включён второй фактор или его роль требует второй фактор, вместо пары токенов
+// возвращается токен ожидания (LoginResult.Challenge); вход завершается через TwoFactorService.
+func (a *AuthService) Login(ctx context.Context, email, password, device, clientIP string) (*LoginResult, error) {
 	const op = "auth.Login"
 	logger := a.log.With(
 		slog.String("op", op),
 		slog.String("email", email),
+		slog.String("ip", clientIP),
 	)
 	logger.Info("checking user")
 
-	// Попытка получить пользователя по email из базы
-	user, err := a.userRepo.GetUserByEmail(ctx, email)
+	reservations, err := a.reserveLoginAttempt(ctx, logger, a.loginThrottleKeys(email, clientIP))
 	if err != nil {
-		if errors.Is(err, storage.ErrUserNotFound) {
-			logger.Info("user not found, creating new user")
-			// Хеширование пароля с помощью bcrypt (автоматически добавляет соль)
-			passHash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-			if err != nil {
-				logger.Error("failed to hash password", slog.Any("error", err))
-				return "", fmt.Errorf("%s: failed to hash password: %w", op, err)
-			}
-			newUser := &models.User{
-				Email:       email,
-				PassHash:    passHash,
-				CoinBalance: 1000, // начальный баланс
-			}
-			user, err = a.userRepo.CreateUser(ctx, newUser)
-			if err != nil {
-				logger.Error("failed to create user", slog.Any("error", err))
-				return "", fmt.Errorf("%s: failed to create user: %w", op, err)
+		logger.Warn("login attempt rejected", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	user, err := a.authenticate(ctx, logger, email, password)
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidCredentials):
+			a.registerLoginFailure(ctx, logger, reservations)
+		case errors.Is(err, ErrEmailNotVerified):
+			logger.Warn("identity provider did not verify email")
+			a.releaseLoginAttempt(ctx, logger, reservations)
+		default:
+			logger.Error("failed to authenticate user", slog.Any("error", err))
+			a.releaseLoginAttempt(ctx, logger, reservations)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	result, err := a.completeLogin(ctx, user, device, clientIP)
+	if err != nil {
+		logger.Error("failed to complete login", slog.Any("error", err))
+		a.releaseLoginAttempt(ctx, logger, reservations)
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	if result.Challenge != nil && !result.Challenge.SetupRequired {
+		// счётчик неудач сбрасывается только после второго фактора, иначе перебор кодов
+		// можно было бы бесконечно продолжать, перемежая его входом по паролю
+		a.releaseLoginAttempt(ctx, logger, reservations)
+		logger.Info("password accepted, waiting for second factor", slog.Int64("userID", user.ID))
+		return result, nil
+	}
+	a.acceptLoginAttempt(ctx, logger, reservations)
+
+	if result.Challenge != nil {
+		logger.Info("password accepted, two-factor setup required", slog.Int64("userID", user.ID))
+		return result, nil
+	}
+	logger.Info("user logged in successfully", slog.Int64("userID", user.ID))
+	return result, nil
+}
+
+// Register создаёт неподтверждённый аккаунт и отправляет письмо с токеном подтверждения.
+// Начальные монеты начисляются только после подтверждения email (см. VerifyEmail).
+// Письмо отправляется после фиксации транзакции: повтор транзакции при конфликте сериализации
+// не отправляет второе письмо, а токен из письма всегда сохранён. Если отправить письмо не удалось,
+// возвращается ошибка, но аккаунт уже создан.
+func (a *AuthService) Register(ctx context.Context, email, password string) error {
+	const op = "auth.Register"
+	logger := a.log.With(
+		slog.String("op", op),
+		slog.String("email", email),
+	)
+
+	passHash, err := a.hasher.Hash(password)
+	if err != nil {
+		logger.Error("failed to hash password", slog.Any("error", err))
+		return fmt.Errorf("%s: failed to hash password: %w", op, err)
+	}
+	token, tokenHash, err := newOneTimeToken()
+	if err != nil {
+		logger.Error("failed to generate verification token", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.txManager.Do(ctx, func(ctx context.Context) error {
+		user, err := a.createAccount(ctx, email, passHash)
+		if err != nil {
+			return err
+		}
+		if err := a.tokenRepo.CreateToken(ctx, &models.OneTimeToken{
+			UserID:    user.ID,
+			Purpose:   models.TokenPurposeEmailVerification,
+			TokenHash: tokenHash,
+			ExpiresAt: time.Now().Add(a.opts.VerificationTTL),
+		}); err != nil {
+			return fmt.Errorf("failed to save verification token: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, ErrUserAlreadyExists) {
+			logger.Warn("user already exists")
+		} else {
+			logger.Error("failed to register user", slog.Any("error", err))
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := a.mailer.Send(ctx, verificationMessage(email, token, a.opts.VerificationTTL)); err != nil {
+		logger.Error("failed to send verification email", slog.Any("error", err))
+		return fmt.Errorf("%s: failed to send verification email: %w", op, err)
+	}
+
+	logger.Info("user registered, verification email sent")
+	return nil
+}
+
+// VerifyEmail подтверждает email по токену из письма и начисляет начальные монеты.
+// Токен одноразовый: повторное подтверждение возвращает ErrInvalidVerificationToken.
+func (a *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	const op = "auth.VerifyEmail"
+	logger := a.log.With(slog.String("op", op))
+
+	err := a.txManager.Do(ctx, func(ctx context.Context) error {
+		userID, err := a.tokenRepo.ConsumeToken(ctx, models.TokenPurposeEmailVerification, hashOneTimeToken(token))
+		if err != nil {
+			if errors.Is(err, storage.ErrTokenNotFound) {
+				return ErrInvalidVerificationToken
 			}
+			return fmt.Errorf("failed to consume verification token: %w", err)
+		}
+		user, err := a.userRepo.GetUserByIDForUpdate(ctx, userID)
+		if err != nil {
+			return fmt.Errorf("failed to get user: %w", err)
+		}
+		return a.activate(ctx, user)
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidVerificationToken) {
+			logger.Warn("invalid verification token")
 		} else {
-			logger.Error("failed to get user", slog.Any("error", err))
-			return "", fmt.Errorf("%s: failed to get user: %w", op, err)
+			logger.Error("failed to verify email", slog.Any("error", err))
 		}
-	} else {
-		// Если пользователь найден, сравниваем введённый пароль с хэшированным паролем
-		if err := bcrypt.CompareHashAndPassword(user.PassHash, []byte(password)); err != nil {
-			logger.Warn("invalid password")
-			return "", fmt.Errorf("%s: invalid credentials: %w", op, err)
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("email verified")
+	return nil
+}
+
+// createAccount создаёт неподтверждённого пользователя с пустым кошельком
+func (a *AuthService) createAccount(ctx context.Context, email string, passHash []byte) (*models.User, error) {
+	user, err := a.userRepo.CreateUser(ctx, &models.User{Email: email, PassHash: passHash, Role: models.RoleEmployee})
+	if err != nil {
+		if errors.Is(err, storage.ErrUserExists) {
+			return nil, ErrUserAlreadyExists
 		}
+		return nil, fmt.Errorf("failed to create user: %w", err)
 	}
+	if err := a.ledgerRepo.CreateWallet(ctx, user.ID); err != nil {
+		return nil, fmt.Errorf("failed to create wallet: %w", err)
+	}
+	return user, nil
+}
 
-	// Генерация JWT-токена. Функция auth.NewToken внутри сама загружает секрет из переменной окружения JWT_SECRET.
-	token, err := security.NewToken(ctx, user, a.tokenTTL)
+// activate отмечает email подтверждённым и начисляет начальные монеты из счёта эмиссии.
+// Для уже подтверждённого пользователя ничего не делает, поэтому монеты не начисляются дважды.
+func (a *AuthService) activate(ctx context.Context, user *models.User) error {
+	verified, err := a.userRepo.MarkEmailVerified(ctx, user.ID)
 	if err != nil {
-		logger.Error("failed to generate token", slog.Any("error", err))
-		return "", fmt.Errorf("%s: failed to generate token: %w", op, err)
+		return err
+	}
+	if !verified {
+		return nil
+	}
+	if _, err := a.ledgerRepo.PostEntry(ctx, &models.LedgerEntry{
+		Kind:      models.LedgerEntrySignupGrant,
+		Reference: fmt.Sprintf("user:%d", user.ID),
+		Postings: []models.LedgerPosting{
+			{Account: models.SystemAccount(models.LedgerAccountCompanyIssuance), Amount: -InitialCoinGrant},
+			{Account: models.WalletAccount(user.ID), Amount: InitialCoinGrant},
+		},
+	}); err != nil {
+		return fmt.Errorf("failed to post signup grant: %w", err)
 	}
+	user.EmailVerified = true
+	return nil
+}
 
-	logger.Info("user logged in successfully", slog.Int64("userID", user.ID))
-	return token, nil
+// verificationMessage формирует письмо с токеном подтверждения email
+func verificationMessage(email, token string, ttl time.Duration) mailer.Message {
+	return mailer.Message{
+		To:      email,
+		Subject: "Confirm your email",
+		Body: fmt.Sprintf("Welcome to Avito shop!\n\n"+
+			"To confirm your email, send this token to POST /api/verifyEmail:\n\n%s\n\n"+
+			"The token expires in %s. If you did not register, ignore this email.\n", token, ttl),
+	}
 }
@@ -2,15 +2,27 @@ package service_test
 
 import (
 	"context"
-	"database/sql"
 	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/linemk/avito-shop/internal/config"
 	"github.com/linemk/avito-shop/internal/domain/models"
+	security "github.com/linemk/avito-shop/internal/jwtNew"
+	"github.com/linemk/avito-shop/internal/jwtNew/jwtmiddleware"
+	"github.com/linemk/avito-shop/internal/lib/identity"
+	"github.com/linemk/avito-shop/internal/lib/mailer"
+	"github.com/linemk/avito-shop/internal/lib/notifier"
+	"github.com/linemk/avito-shop/internal/lib/password"
+	"github.com/linemk/avito-shop/internal/lib/totp"
 	"github.com/linemk/avito-shop/internal/service"
 	"github.com/linemk/avito-shop/internal/storage"
 	"github.com/stretchr/testify/assert"
@@ -18,7 +30,12 @@ import (
 )
 
 type fakeUserRepo struct {
-	users map[string]*models.User // ключ — email
+	users     map[string]*models.User // ключ — email
+	lockOrder []int64                 // порядок блокировки строк через GetUserByIDForUpdate
+	// staleByEmail — устаревшие снимки пользователей, которые возвращает чтение вне транзакции
+	staleByEmail map[string]*models.User
+	// outsideTxReads — количество чтений пользователя по email вне транзакции TxManager
+	outsideTxReads int
 }
 
 var _ storage.UserStorage = (*fakeUserRepo)(nil)
@@ -28,6 +45,12 @@ func newFakeUserRepo() *fakeUserRepo {
 }
 
 func (f *fakeUserRepo) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	if !storage.InTransaction(ctx) {
+		f.outsideTxReads++
+		if stale, ok := f.staleByEmail[email]; ok {
+			return stale, nil
+		}
+	}
 	user, ok := f.users[email]
 	if !ok {
 		return nil, storage.ErrUserNotFound
@@ -36,6 +59,9 @@ func (f *fakeUserRepo) GetUserByEmail(ctx context.Context, email string) (*model
 }
 
 func (f *fakeUserRepo) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
+	if _, ok := f.users[user.Email]; ok {
+		return nil, storage.ErrUserExists
+	}
 	user.ID = int64(len(f.users) + 1)
 	f.users[user.Email] = user
 	return user, nil
@@ -50,453 +76,3108 @@ func (f *fakeUserRepo) GetUserByID(ctx context.Context, id int64) (*models.User,
 	return nil, storage.ErrUserNotFound
 }
 
-func (f *fakeUserRepo) GetUserByIDtx(ctx context.Context, tx *sql.Tx, id int64) (*models.User, error) {
+func (f *fakeUserRepo) GetUserByIDForUpdate(ctx context.Context, id int64) (*models.User, error) {
+	f.lockOrder = append(f.lockOrder, id)
 	return f.GetUserByID(ctx, id)
 }
 
-func (f *fakeUserRepo) UpdateUserBalance(ctx context.Context, tx *sql.Tx, id int64, newBalance int) error {
-	for _, u := range f.users {
-		if u.ID == id {
-			u.CoinBalance = newBalance
-			return nil
-		}
+func (f *fakeUserRepo) MarkEmailVerified(ctx context.Context, id int64) (bool, error) {
+	user, err := f.GetUserByID(ctx, id)
+	if err != nil {
+		return false, err
+	}
+	if user.EmailVerified {
+		return false, nil
 	}
-	return storage.ErrUserNotFound
+	user.EmailVerified = true
+	return true, nil
 }
 
-type fakeOrderRepo struct {
-	orders map[int64][]*models.Order // ключ: userID
+func (f *fakeUserRepo) UpdatePassHash(ctx context.Context, id int64, passHash []byte) error {
+	user, err := f.GetUserByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	user.PassHash = passHash
+	return nil
 }
 
-var _ storage.OrderStorage = (*fakeOrderRepo)(nil)
+// fakeLedgerRepo применяет проводки к балансам пользователей fakeUserRepo.
+type fakeLedgerRepo struct {
+	userRepo *fakeUserRepo
+	wallets  map[int64]bool
+	entries  []*models.LedgerEntry
+}
 
-func newFakeOrderRepo() *fakeOrderRepo {
-	return &fakeOrderRepo{orders: make(map[int64][]*models.Order)}
+var _ storage.LedgerStorage = (*fakeLedgerRepo)(nil)
+
+func newFakeLedgerRepo(userRepo *fakeUserRepo) *fakeLedgerRepo {
+	return &fakeLedgerRepo{userRepo: userRepo, wallets: make(map[int64]bool)}
 }
 
-func (f *fakeOrderRepo) GetOrdersByUserID(ctx context.Context, userID int64) ([]*models.Order, error) {
-	if orders, ok := f.orders[userID]; ok {
-		return orders, nil
+func (f *fakeLedgerRepo) CreateWallet(ctx context.Context, userID int64) error {
+	f.wallets[userID] = true
+	return nil
+}
+
+func (f *fakeLedgerRepo) PostEntry(ctx context.Context, entry *models.LedgerEntry) (int64, error) {
+	sum := 0
+	for _, p := range entry.Postings {
+		sum += p.Amount
 	}
-	return []*models.Order{}, nil
+	if sum != 0 {
+		return 0, storage.ErrUnbalancedEntry
+	}
+	for _, p := range entry.Postings {
+		if p.Account.Code != "" {
+			continue
+		}
+		user, err := f.userRepo.GetUserByID(ctx, p.Account.UserID)
+		if err != nil {
+			return 0, err
+		}
+		user.CoinBalance += p.Amount
+	}
+	f.entries = append(f.entries, entry)
+	entry.ID = int64(len(f.entries))
+	return entry.ID, nil
 }
 
-func (f *fakeOrderRepo) CreateOrder(ctx context.Context, tx *sql.Tx, userID int64, merchID int64, quantity int, totalPrice int) error {
-	// Не требуется для теста InfoService
-	return nil
+func (f *fakeLedgerRepo) GetWalletBalance(ctx context.Context, userID int64) (int, error) {
+	user, err := f.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return 0, err
+	}
+	return user.CoinBalance, nil
 }
 
-type fakeMerchRepo struct {
-	merchs map[string]*models.Merch // ключ — название мерча
+// fakeTxManager выполняет функцию без реальной транзакции.
+type fakeTxManager struct{}
+
+func (fakeTxManager) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return fn(ctx)
 }
 
-var _ storage.MerchStorage = (*fakeMerchRepo)(nil)
+func (fakeTxManager) DoWithOptions(ctx context.Context, opts storage.TxOptions, fn func(ctx context.Context) error) error {
+	return fn(ctx)
+}
 
-func newFakeMerchRepo() *fakeMerchRepo {
-	return &fakeMerchRepo{merchs: make(map[string]*models.Merch)}
+// retryingTxManager выполняет fn attempts раз подряд, как TxManager при повторах после конфликтов
+// сериализации, и возвращает commitErr, как если бы не удалась фиксация последней попытки.
+type retryingTxManager struct {
+	attempts  int
+	commitErr error
 }
 
-func (f *fakeMerchRepo) GetMerchByName(ctx context.Context, tx *sql.Tx, name string) (*models.Merch, error) {
-	merch, ok := f.merchs[name]
-	if !ok {
-		return nil, errors.New("merch not found")
+func (m retryingTxManager) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return m.DoWithOptions(ctx, storage.TxOptions{}, fn)
+}
+
+func (m retryingTxManager) DoWithOptions(ctx context.Context, opts storage.TxOptions, fn func(ctx context.Context) error) error {
+	for range m.attempts {
+		if err := fn(ctx); err != nil {
+			return err
+		}
 	}
-	return merch, nil
+	return m.commitErr
 }
 
-type fakeCoinTxRepo struct {
-	transactions map[int64][]*models.CoinTransaction // ключ: userID
+// fakeTokenRepo хранит одноразовые токены в памяти; ключ — хэш токена.
+type fakeTokenRepo struct {
+	tokens map[string]*models.OneTimeToken
+	used   map[string]bool
 }
 
-var _ storage.CoinTransactionStorage = (*fakeCoinTxRepo)(nil)
+var _ storage.OneTimeTokenStorage = (*fakeTokenRepo)(nil)
 
-func newFakeCoinTxRepo() *fakeCoinTxRepo {
-	return &fakeCoinTxRepo{transactions: make(map[int64][]*models.CoinTransaction)}
+func newFakeTokenRepo() *fakeTokenRepo {
+	return &fakeTokenRepo{tokens: make(map[string]*models.OneTimeToken), used: make(map[string]bool)}
 }
 
-func (f *fakeCoinTxRepo) GetTransactionsByUserID(ctx context.Context, userID int64) ([]*models.CoinTransaction, error) {
-	if txs, ok := f.transactions[userID]; ok {
-		return txs, nil
+func (f *fakeTokenRepo) CreateToken(ctx context.Context, token *models.OneTimeToken) error {
+	f.tokens[string(token.TokenHash)] = token
+	return nil
+}
+
+func (f *fakeTokenRepo) ConsumeToken(ctx context.Context, purpose string, tokenHash []byte) (int64, error) {
+	token, ok := f.tokens[string(tokenHash)]
+	if !ok || token.Purpose != purpose || f.used[string(tokenHash)] || time.Now().After(token.ExpiresAt) {
+		return 0, storage.ErrTokenNotFound
 	}
-	return []*models.CoinTransaction{}, nil
+	f.used[string(tokenHash)] = true
+	return token.UserID, nil
 }
 
-func (f *fakeCoinTxRepo) CreateTransaction(ctx context.Context, tx *sql.Tx, userID int64, amount int, txType string, relatedUserID *int64) error {
-	// Не требуется для теста InfoService
+func (f *fakeTokenRepo) PeekToken(ctx context.Context, purpose string, tokenHash []byte) (int64, error) {
+	token, ok := f.tokens[string(tokenHash)]
+	if !ok || token.Purpose != purpose || f.used[string(tokenHash)] || time.Now().After(token.ExpiresAt) {
+		return 0, storage.ErrTokenNotFound
+	}
+	return token.UserID, nil
+}
+
+func (f *fakeTokenRepo) RevokeTokens(ctx context.Context, userID int64, purpose string) error {
+	for hash, token := range f.tokens {
+		if token.UserID == userID && token.Purpose == purpose {
+			f.used[hash] = true
+		}
+	}
 	return nil
 }
 
-func TestAuthService_Login_NewUser(t *testing.T) {
-	os.Setenv("JWT_SECRET", "testsecret")
-	defer os.Unsetenv("JWT_SECRET")
+// fakeMailer запоминает отправленные письма.
+type fakeMailer struct {
+	sent []mailer.Message
+}
 
-	fakeRepo := newFakeUserRepo()
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	authSvc := service.NewAuthService(logger, fakeRepo, 60*time.Minute)
-	ctx := context.Background()
+func (f *fakeMailer) Send(ctx context.Context, msg mailer.Message) error {
+	f.sent = append(f.sent, msg)
+	return nil
+}
 
-	email := "newuser@example.com"
-	password := "password123"
+// fakeRefreshRepo хранит refresh-токены и отзывы access-токенов в памяти.
+type fakeRefreshRepo struct {
+	tokens      []*models.RefreshToken
+	revokedJTIs map[string]bool
+	validAfter  map[int64]time.Time
+}
 
-	token, err := authSvc.Login(ctx, email, password)
-	assert.NoError(t, err, "Login should succeed for a new user")
-	assert.NotEmpty(t, token, "Token should not be empty")
+var _ storage.RefreshTokenStorage = (*fakeRefreshRepo)(nil)
 
-	user, err := fakeRepo.GetUserByEmail(ctx, email)
-	assert.NoError(t, err, "User should exist after creation")
-	assert.Equal(t, 1000, user.CoinBalance, "Initial coin balance should be 1000")
-	// Проверяем, что пароль хэширован (не равен исходному паролю)
-	assert.NotEqual(t, password, string(user.PassHash), "Password should be hashed")
+func newFakeRefreshRepo() *fakeRefreshRepo {
+	return &fakeRefreshRepo{revokedJTIs: make(map[string]bool), validAfter: make(map[int64]time.Time)}
 }
 
-func TestAuthService_Login_ExistingUser_CorrectPassword(t *testing.T) {
-	os.Setenv("JWT_SECRET", "testsecret")
-	defer os.Unsetenv("JWT_SECRET")
+func (f *fakeRefreshRepo) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) (int64, error) {
+	f.tokens = append(f.tokens, token)
+	token.ID = int64(len(f.tokens))
+	return token.ID, nil
+}
 
-	fakeRepo := newFakeUserRepo()
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	authSvc := service.NewAuthService(logger, fakeRepo, 60*time.Minute)
-	ctx := context.Background()
+func (f *fakeRefreshRepo) GetRefreshTokenForUpdate(ctx context.Context, tokenHash []byte) (*models.RefreshToken, error) {
+	for _, t := range f.tokens {
+		if string(t.TokenHash) == string(tokenHash) {
+			return t, nil
+		}
+	}
+	return nil, storage.ErrTokenNotFound
+}
 
-	email := "existing@example.com"
-	password := "password123"
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	assert.NoError(t, err)
-	user := &models.User{
-		Email:       email,
-		PassHash:    hashed,
-		CoinBalance: 1000,
+func (f *fakeRefreshRepo) RevokeRefreshToken(ctx context.Context, id int64, replacedBy *int64) error {
+	t := f.tokens[id-1]
+	if t.RevokedAt == nil {
+		now := time.Now()
+		t.RevokedAt = &now
+		t.ReplacedBy = replacedBy
 	}
-	_, err = fakeRepo.CreateUser(ctx, user)
-	assert.NoError(t, err)
+	return nil
+}
 
-	token, err := authSvc.Login(ctx, email, password)
-	assert.NoError(t, err, "Login should succeed with correct password")
-	assert.NotEmpty(t, token, "Token should be returned")
+func (f *fakeRefreshRepo) RevokeUserRefreshTokens(ctx context.Context, userID int64) error {
+	for _, t := range f.tokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			now := time.Now()
+			t.RevokedAt = &now
+		}
+	}
+	return nil
 }
 
-func TestAuthService_Login_ExistingUser_WrongPassword(t *testing.T) {
-	os.Setenv("JWT_SECRET", "testsecret")
-	defer os.Unsetenv("JWT_SECRET")
+func (f *fakeRefreshRepo) RevokeSessionRefreshTokens(ctx context.Context, sessionID int64) error {
+	for _, t := range f.tokens {
+		if t.SessionID == sessionID && t.RevokedAt == nil {
+			now := time.Now()
+			t.RevokedAt = &now
+		}
+	}
+	return nil
+}
 
-	fakeRepo := newFakeUserRepo()
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	authSvc := service.NewAuthService(logger, fakeRepo, 60*time.Minute)
-	ctx := context.Background()
+func (f *fakeRefreshRepo) RevokeAccessToken(ctx context.Context, jti string, userID int64, expiresAt time.Time) error {
+	f.revokedJTIs[jti] = true
+	return nil
+}
 
-	email := "existing@example.com"
-	password := "password123"
-	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
-	assert.NoError(t, err)
-	user := &models.User{
-		Email:       email,
-		PassHash:    hashed,
-		CoinBalance: 1000,
+func (f *fakeRefreshRepo) SetTokensValidAfter(ctx context.Context, userID int64, t time.Time) error {
+	f.validAfter[userID] = t
+	return nil
+}
+
+func (f *fakeRefreshRepo) IsAccessTokenRevoked(ctx context.Context, userID int64, jti string, issuedAt time.Time) (bool, error) {
+	return f.revokedJTIs[jti] || f.validAfter[userID].After(issuedAt), nil
+}
+
+// activeRefreshTokens возвращает неотозванные refresh-токены пользователя
+func (f *fakeRefreshRepo) activeRefreshTokens(userID int64) int {
+	n := 0
+	for _, t := range f.tokens {
+		if t.UserID == userID && t.RevokedAt == nil {
+			n++
+		}
 	}
-	_, err = fakeRepo.CreateUser(ctx, user)
-	assert.NoError(t, err)
+	return n
+}
 
-	token, err := authSvc.Login(ctx, email, "wrongpassword")
-	assert.Error(t, err, "Login should fail with incorrect password")
-	assert.Empty(t, token, "Token should be empty on failed login")
+// fakeTwoFactorRepo хранит секреты TOTP, коды восстановления и требования ролей в памяти.
+type fakeTwoFactorRepo struct {
+	secrets       map[int64]*models.TwoFactor
+	recoveryCodes map[int64]map[string]bool // userID -> хэш кода -> использован
+	requiredRoles map[models.Role]bool
 }
 
-func TestInfoService_GetInfo_Success(t *testing.T) {
-	// Создаем фиктивные репозитории.
-	userRepo := newFakeUserRepo()
-	orderRepo := newFakeOrderRepo()
-	coinTxRepo := newFakeCoinTxRepo()
+var _ storage.TwoFactorStorage = (*fakeTwoFactorRepo)(nil)
 
-	// Добавляем пользователя с балансом 920, ID=1.
-	user := &models.User{
-		ID:          1,
-		Email:       "test@example.com",
-		PassHash:    []byte("hashed-password"),
-		CoinBalance: 920,
+func newFakeTwoFactorRepo() *fakeTwoFactorRepo {
+	return &fakeTwoFactorRepo{
+		secrets:       make(map[int64]*models.TwoFactor),
+		recoveryCodes: make(map[int64]map[string]bool),
+		requiredRoles: make(map[models.Role]bool),
 	}
+}
 
-	userRepo.users[user.Email] = user
+func (f *fakeTwoFactorRepo) GetTwoFactor(ctx context.Context, userID int64) (*models.TwoFactor, error) {
+	tf, ok := f.secrets[userID]
+	if !ok {
+		return nil, storage.ErrTwoFactorNotFound
+	}
+	copied := *tf
+	return &copied, nil
+}
 
-	// Добавляем пару заказов для пользователя (например, куплена футболка: 2 единицы)
-	orderRepo.orders[user.ID] = []*models.Order{
-		{
-			ID:         1,
-			UserID:     user.ID,
-			MerchID:    1,
-			MerchName:  "t-shirt",
-			Quantity:   1,
-			TotalPrice: 80,
-			CreatedAt:  time.Now().Add(-time.Hour),
-		},
-		{
-			ID:         2,
-			UserID:     user.ID,
-			MerchID:    1,
-			MerchName:  "t-shirt",
-			Quantity:   1,
-			TotalPrice: 80,
-			CreatedAt:  time.Now().Add(-30 * time.Minute),
-		},
+func (f *fakeTwoFactorRepo) SaveTwoFactorSecret(ctx context.Context, userID int64, secret []byte) error {
+	if f.secrets[userID].Enabled() {
+		return nil
 	}
+	f.secrets[userID] = &models.TwoFactor{UserID: userID, Secret: secret}
+	return nil
+}
 
-	// Добавляем транзакции для пользователя
-	coinTxRepo.transactions[user.ID] = []*models.CoinTransaction{
-		{
-			ID:            1,
-			UserID:        user.ID,
-			Amount:        80,
-			Type:          "transfer_received",
-			RelatedUserID: nil,
-			CreatedAt:     time.Now().Add(-45 * time.Minute),
-		},
-		{
-			ID:            2,
-			UserID:        user.ID,
-			Amount:        80,
-			Type:          "transfer_sent",
-			RelatedUserID: nil,
-			CreatedAt:     time.Now().Add(-50 * time.Minute),
-		},
+func (f *fakeTwoFactorRepo) ConfirmTwoFactor(ctx context.Context, userID int64, step int64) error {
+	tf, ok := f.secrets[userID]
+	if !ok || tf.Enabled() {
+		return storage.ErrTwoFactorNotFound
 	}
+	now := time.Now()
+	tf.ConfirmedAt = &now
+	tf.LastUsedStep = step
+	return nil
+}
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	infoSvc := service.NewInfoService(logger, userRepo, orderRepo, coinTxRepo)
+func (f *fakeTwoFactorRepo) UseTwoFactorStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	tf, ok := f.secrets[userID]
+	if !ok || tf.LastUsedStep >= step {
+		return false, nil
+	}
+	tf.LastUsedStep = step
+	return true, nil
+}
 
-	ctx := context.Background()
-	infoResp, err := infoSvc.GetInfo(ctx, user.ID)
-	assert.NoError(t, err, "GetInfo should succeed")
-	assert.Equal(t, 920, infoResp.Coins, "User coin balance should match")
+func (f *fakeTwoFactorRepo) DeleteTwoFactor(ctx context.Context, userID int64) error {
+	delete(f.secrets, userID)
+	delete(f.recoveryCodes, userID)
+	return nil
+}
 
-	// Проверяем инвентарь: два заказа футболок должны сгруппироваться в один элемент с количеством 2.
-	assert.Len(t, infoResp.Inventory, 1, "There should be one inventory item")
-	if len(infoResp.Inventory) > 0 {
-		assert.Equal(t, "t-shirt", infoResp.Inventory[0].Type, "Inventory item type should be t-shirt")
-		assert.Equal(t, 2, infoResp.Inventory[0].Quantity, "Inventory quantity should be 2")
+func (f *fakeTwoFactorRepo) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes [][]byte) error {
+	f.recoveryCodes[userID] = make(map[string]bool, len(codeHashes))
+	for _, hash := range codeHashes {
+		f.recoveryCodes[userID][string(hash)] = false
 	}
+	return nil
+}
 
-	// Проверяем транзакции: ожидаем одну запись для каждого типа
-	assert.Len(t, infoResp.CoinHistory.Received, 1, "There should be one received transaction")
-	assert.Len(t, infoResp.CoinHistory.Sent, 1, "There should be one sent transaction")
+func (f *fakeTwoFactorRepo) UseRecoveryCode(ctx context.Context, userID int64, codeHash []byte) (bool, error) {
+	used, ok := f.recoveryCodes[userID][string(codeHash)]
+	if !ok || used {
+		return false, nil
+	}
+	f.recoveryCodes[userID][string(codeHash)] = true
+	return true, nil
 }
 
-func TestInfoService_GetInfo_UserNotFound(t *testing.T) {
-	userRepo := newFakeUserRepo()
-	orderRepo := newFakeOrderRepo()
-	coinTxRepo := newFakeCoinTxRepo()
+func (f *fakeTwoFactorRepo) IsTwoFactorRequired(ctx context.Context, role models.Role) (bool, error) {
+	return f.requiredRoles[role], nil
+}
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	infoSvc := service.NewInfoService(logger, userRepo, orderRepo, coinTxRepo)
+func (f *fakeTwoFactorRepo) SetTwoFactorRequired(ctx context.Context, role models.Role, required bool, updatedBy int64) error {
+	if required {
+		f.requiredRoles[role] = true
+	} else {
+		delete(f.requiredRoles, role)
+	}
+	return nil
+}
 
-	ctx := context.Background()
-	_, err := infoSvc.GetInfo(ctx, 999) // Пользователь с таким ID не существует
-	assert.Error(t, err, "Expected error for non-existing user")
+func (f *fakeTwoFactorRepo) ListTwoFactorRequiredRoles(ctx context.Context) ([]models.Role, error) {
+	var roles []models.Role
+	for role := range f.requiredRoles {
+		roles = append(roles, role)
+	}
+	return roles, nil
 }
 
-func TestBuyService_Buy_Success(t *testing.T) {
-	// Используем sqlmock для создания фиктивной БД.
-	db, mock, err := sqlmock.New()
-	assert.NoError(t, err)
-	defer db.Close()
+// fakeIdentityRepo хранит связи внешних учётных записей с пользователями в памяти.
+type fakeIdentityRepo struct {
+	links map[string]int64 // provider + "/" + subject -> userID
+}
 
-	// Ожидаем вызов BeginTx и Commit.
-	mock.ExpectBegin()
-	mock.ExpectCommit()
+var _ storage.IdentityStorage = (*fakeIdentityRepo)(nil)
 
-	// Создаем fake репозитории.
-	fakeUserRepo := newFakeUserRepo()
-	fakeMerchRepo := newFakeMerchRepo()
-	fakeOrderRepo := newFakeOrderRepo()
+func newFakeIdentityRepo() *fakeIdentityRepo {
+	return &fakeIdentityRepo{links: make(map[string]int64)}
+}
 
-	// Добавляем пользователя с балансом 1000, ID=1.
-	user := &models.User{
-		ID:          1,
-		Email:       "test@example.com",
-		PassHash:    []byte("hashed"),
-		CoinBalance: 1000,
+func (f *fakeIdentityRepo) GetIdentityUserID(ctx context.Context, provider, subject string) (int64, error) {
+	userID, ok := f.links[provider+"/"+subject]
+	if !ok {
+		return 0, storage.ErrIdentityNotFound
 	}
-	fakeUserRepo.users[user.Email] = user
+	return userID, nil
+}
 
-	// Добавляем мерч "t-shirt" с ценой 80.
-	fakeMerchRepo.merchs["t-shirt"] = &models.Merch{
-		ID:    1,
-		Name:  "t-shirt",
-		Price: 80,
+func (f *fakeIdentityRepo) LinkIdentity(ctx context.Context, provider, subject string, userID int64) error {
+	if _, ok := f.links[provider+"/"+subject]; !ok {
+		f.links[provider+"/"+subject] = userID
 	}
+	return nil
+}
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	buySvc := service.NewBuyService(logger, db, fakeUserRepo, fakeMerchRepo, fakeOrderRepo)
+// fakeSessionRepo хранит сессии в памяти; ID сессии — её номер в sessions, начиная с 1.
+type fakeSessionRepo struct {
+	sessions []*models.Session
+}
 
-	// Вызываем метод Buy.
-	err = buySvc.Buy(context.Background(), user.ID, "t-shirt")
-	assert.NoError(t, err, "Buy should succeed")
+var _ storage.SessionStorage = (*fakeSessionRepo)(nil)
 
-	// Проверяем, что баланс пользователя обновился: 1000 - 80 = 920.
+func newFakeSessionRepo() *fakeSessionRepo {
+	return &fakeSessionRepo{}
+}
+
+func (f *fakeSessionRepo) CreateSession(ctx context.Context, session *models.Session) error {
+	f.sessions = append(f.sessions, session)
+	session.ID = int64(len(f.sessions))
+	session.CreatedAt = time.Now()
+	session.LastUsedAt = session.CreatedAt
+	return nil
+}
+
+func (f *fakeSessionRepo) active(sessionID int64) (*models.Session, bool) {
+	if sessionID < 1 || sessionID > int64(len(f.sessions)) {
+		return nil, false
+	}
+	s := f.sessions[sessionID-1]
+	return s, s.RevokedAt == nil && s.ExpiresAt.After(time.Now())
+}
+
+func (f *fakeSessionRepo) GetActiveSession(ctx context.Context, sessionID int64) (*models.Session, error) {
+	s, ok := f.active(sessionID)
+	if !ok {
+		return nil, storage.ErrSessionNotFound
+	}
+	copied := *s
+	return &copied, nil
+}
+
+func (f *fakeSessionRepo) ListActiveSessions(ctx context.Context, userID int64) ([]*models.Session, error) {
+	var sessions []*models.Session
+	for i := len(f.sessions) - 1; i >= 0; i-- {
+		if s, ok := f.active(int64(i + 1)); ok && s.UserID == userID {
+			sessions = append(sessions, s)
+		}
+	}
+	return sessions, nil
+}
+
+func (f *fakeSessionRepo) TouchSession(ctx context.Context, sessionID int64) error {
+	f.sessions[sessionID-1].LastUsedAt = time.Now()
+	return nil
+}
+
+func (f *fakeSessionRepo) ExtendSession(ctx context.Context, sessionID int64, expiresAt time.Time) error {
+	s := f.sessions[sessionID-1]
+	s.ExpiresAt = expiresAt
+	s.LastUsedAt = time.Now()
+	return nil
+}
+
+func (f *fakeSessionRepo) RevokeSession(ctx context.Context, userID, sessionID int64) error {
+	s, ok := f.active(sessionID)
+	if !ok || s.UserID != userID {
+		return storage.ErrSessionNotFound
+	}
+	now := time.Now()
+	s.RevokedAt = &now
+	return nil
+}
+
+// fakePersonalTokenRepo хранит персональные токены в памяти; ключ — хэш токена.
+type fakePersonalTokenRepo struct {
+	tokens  map[string]*models.PersonalToken
+	touched int
+}
+
+var _ storage.PersonalTokenStorage = (*fakePersonalTokenRepo)(nil)
+
+func newFakePersonalTokenRepo() *fakePersonalTokenRepo {
+	return &fakePersonalTokenRepo{tokens: make(map[string]*models.PersonalToken)}
+}
+
+func (f *fakePersonalTokenRepo) CreatePersonalToken(ctx context.Context, token *models.PersonalToken) error {
+	token.ID = int64(len(f.tokens) + 1)
+	token.CreatedAt = time.Now()
+	f.tokens[string(token.TokenHash)] = token
+	return nil
+}
+
+func (f *fakePersonalTokenRepo) ListPersonalTokens(ctx context.Context, userID int64) ([]*models.PersonalToken, error) {
+	var tokens []*models.PersonalToken
+	for _, token := range f.tokens {
+		if token.UserID == userID && token.RevokedAt == nil {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+func (f *fakePersonalTokenRepo) GetPersonalTokenByHash(ctx context.Context, tokenHash []byte) (*models.PersonalToken, error) {
+	token, ok := f.tokens[string(tokenHash)]
+	if !ok || token.RevokedAt != nil || (token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt)) {
+		return nil, storage.ErrPersonalTokenNotFound
+	}
+	return token, nil
+}
+
+func (f *fakePersonalTokenRepo) RevokePersonalToken(ctx context.Context, userID, tokenID int64) error {
+	for _, token := range f.tokens {
+		if token.ID == tokenID && token.UserID == userID && token.RevokedAt == nil {
+			now := time.Now()
+			token.RevokedAt = &now
+			return nil
+		}
+	}
+	return storage.ErrPersonalTokenNotFound
+}
+
+func (f *fakePersonalTokenRepo) TouchPersonalToken(ctx context.Context, tokenID int64) error {
+	for _, token := range f.tokens {
+		if token.ID == tokenID {
+			now := time.Now()
+			token.LastUsedAt = &now
+			f.touched++
+		}
+	}
+	return nil
+}
+
+// newTestAuthService создаёт AuthService с фиктивными зависимостями.
+func newTestAuthService(userRepo *fakeUserRepo, ledgerRepo *fakeLedgerRepo, tokenRepo *fakeTokenRepo, refreshRepo *fakeRefreshRepo, m *fakeMailer, autoRegister bool) *service.AuthService {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	return service.NewAuthService(logger, fakeTxManager{}, userRepo, ledgerRepo, tokenRepo, refreshRepo, storage.NewMemoryLoginAttemptStorage(), newFakeTwoFactorRepo(), newFakeIdentityRepo(), newFakeSessionRepo(), m, password.NewBcryptHasher(bcrypt.MinCost), security.NewHMACKeySet("testsecret"), service.AuthOptions{
+		TokenTTL:         15 * time.Minute,
+		RefreshTokenTTL:  24 * time.Hour,
+		AutoRegister:     autoRegister,
+		VerificationTTL:  time.Hour,
+		PasswordResetTTL: time.Hour,
+	})
+}
+
+type fakeOrderRepo struct {
+	orders map[int64][]*models.Order // ключ: userID
+}
+
+var _ storage.OrderStorage = (*fakeOrderRepo)(nil)
+
+func newFakeOrderRepo() *fakeOrderRepo {
+	return &fakeOrderRepo{orders: make(map[int64][]*models.Order)}
+}
+
+func (f *fakeOrderRepo) GetOrdersByUserID(ctx context.Context, userID int64) ([]*models.Order, error) {
+	if orders, ok := f.orders[userID]; ok {
+		return orders, nil
+	}
+	return []*models.Order{}, nil
+}
+
+func (f *fakeOrderRepo) CreateOrder(ctx context.Context, userID int64, merchID int64, quantity int, totalPrice int) (int64, error) {
+	order := &models.Order{UserID: userID, MerchID: merchID, Quantity: quantity, TotalPrice: totalPrice, CreatedAt: time.Now()}
+	f.orders[userID] = append(f.orders[userID], order)
+	order.ID = int64(len(f.orders[userID]))
+	return order.ID, nil
+}
+
+type fakeMerchRepo struct {
+	merchs    map[string]*models.Merch // ключ — название мерча
+	prices    []*models.MerchPrice
+	listCalls int
+}
+
+var _ storage.MerchStorage = (*fakeMerchRepo)(nil)
+
+func newFakeMerchRepo() *fakeMerchRepo {
+	return &fakeMerchRepo{merchs: make(map[string]*models.Merch)}
+}
+
+func (f *fakeMerchRepo) GetMerchByName(ctx context.Context, name string) (*models.Merch, error) {
+	merch, ok := f.merchs[name]
+	if !ok || merch.ArchivedAt != nil {
+		return nil, storage.ErrMerchNotFound
+	}
+	return merch, nil
+}
+
+func (f *fakeMerchRepo) ListMerch(ctx context.Context, includeArchived bool) ([]*models.Merch, error) {
+	f.listCalls++
+	merchs := make([]*models.Merch, 0, len(f.merchs))
+	for _, merch := range f.merchs {
+		if merch.ArchivedAt != nil && !includeArchived {
+			continue
+		}
+		copied := *merch
+		// доступность считается как в scanMerch: товар не в архиве и есть на складе
+		copied.Available = copied.ArchivedAt == nil && (copied.Stock == nil || *copied.Stock > 0)
+		merchs = append(merchs, &copied)
+	}
+	return merchs, nil
+}
+
+func (f *fakeMerchRepo) GetMerchByNameForUpdate(ctx context.Context, name string) (*models.Merch, error) {
+	merch, ok := f.merchs[name]
+	if !ok {
+		return nil, storage.ErrMerchNotFound
+	}
+	copied := *merch
+	return &copied, nil
+}
+
+func (f *fakeMerchRepo) CreateMerch(ctx context.Context, merch *models.Merch) error {
+	if _, ok := f.merchs[merch.Name]; ok {
+		return storage.ErrMerchExists
+	}
+	merch.ID = int64(len(f.merchs) + 1)
+	merch.Available = true
+	copied := *merch
+	f.merchs[merch.Name] = &copied
+	return nil
+}
+
+func (f *fakeMerchRepo) UpdateMerchPrice(ctx context.Context, merchID int64, price int) error {
+	for _, merch := range f.merchs {
+		if merch.ID == merchID {
+			merch.Price = price
+			return nil
+		}
+	}
+	return storage.ErrMerchNotFound
+}
+
+func (f *fakeMerchRepo) SetMerchArchived(ctx context.Context, merch *models.Merch, archived bool) error {
+	stored, ok := f.merchs[merch.Name]
+	if !ok {
+		return storage.ErrMerchNotFound
+	}
+	if !archived {
+		stored.ArchivedAt = nil
+	} else if stored.ArchivedAt == nil {
+		now := time.Now()
+		stored.ArchivedAt = &now
+	}
+	stored.Available = !archived
+	merch.ArchivedAt, merch.Available = stored.ArchivedAt, stored.Available
+	return nil
+}
+
+func (f *fakeMerchRepo) CreateMerchPrice(ctx context.Context, price *models.MerchPrice) error {
+	price.ID = int64(len(f.prices) + 1)
+	price.ValidFrom = time.Now()
+	f.prices = append(f.prices, price)
+	return nil
+}
+
+func (f *fakeMerchRepo) ListMerchPrices(ctx context.Context, name string) ([]*models.MerchPrice, error) {
+	merch, ok := f.merchs[name]
+	if !ok {
+		return nil, storage.ErrMerchNotFound
+	}
+	var prices []*models.MerchPrice
+	for i := len(f.prices) - 1; i >= 0; i-- {
+		if f.prices[i].MerchID == merch.ID {
+			prices = append(prices, f.prices[i])
+		}
+	}
+	return prices, nil
+}
+
+func (f *fakeMerchRepo) DecrementMerchStock(ctx context.Context, merchID int64, quantity int) (*int, error) {
+	for _, merch := range f.merchs {
+		if merch.ID != merchID {
+			continue
+		}
+		if merch.Stock == nil {
+			return nil, nil
+		}
+		if *merch.Stock < quantity {
+			return nil, storage.ErrOutOfStock
+		}
+		remaining := *merch.Stock - quantity
+		merch.Stock = &remaining
+		return &remaining, nil
+	}
+	return nil, storage.ErrOutOfStock
+}
+
+func (f *fakeMerchRepo) RestockMerch(ctx context.Context, merchID int64, quantity int) (int, error) {
+	for _, merch := range f.merchs {
+		if merch.ID == merchID {
+			stock := quantity
+			if merch.Stock != nil {
+				stock += *merch.Stock
+			}
+			merch.Stock = &stock
+			return stock, nil
+		}
+	}
+	return 0, storage.ErrMerchNotFound
+}
+
+func (f *fakeMerchRepo) SetMerchStock(ctx context.Context, merchID int64, stock *int) error {
+	for _, merch := range f.merchs {
+		if merch.ID == merchID {
+			merch.Stock = stock
+			return nil
+		}
+	}
+	return storage.ErrMerchNotFound
+}
+
+// fakeCartRepo хранит корзины в памяти; цены и доступность берутся из товаров merchRepo
+type fakeCartRepo struct {
+	merchRepo *fakeMerchRepo
+	items     map[int64]map[int64]int // userID -> merchID -> количество
+}
+
+var _ storage.CartStorage = (*fakeCartRepo)(nil)
+
+func newFakeCartRepo(merchRepo *fakeMerchRepo) *fakeCartRepo {
+	return &fakeCartRepo{merchRepo: merchRepo, items: make(map[int64]map[int64]int)}
+}
+
+func (f *fakeCartRepo) ListCartItems(ctx context.Context, userID int64, forUpdate bool) ([]*models.CartItem, error) {
+	var items []*models.CartItem
+	for _, merch := range f.merchRepo.merchs {
+		quantity, ok := f.items[userID][merch.ID]
+		if !ok {
+			continue
+		}
+		items = append(items, &models.CartItem{
+			MerchID:   merch.ID,
+			MerchName: merch.Name,
+			Price:     merch.Price,
+			Quantity:  quantity,
+			Available: merch.ArchivedAt == nil && (merch.Stock == nil || *merch.Stock >= quantity),
+		})
+	}
+	slices.SortFunc(items, func(a, b *models.CartItem) int { return strings.Compare(a.MerchName, b.MerchName) })
+	return items, nil
+}
+
+func (f *fakeCartRepo) AddCartItem(ctx context.Context, userID, merchID int64, quantity int) (int, error) {
+	if f.items[userID] == nil {
+		f.items[userID] = make(map[int64]int)
+	}
+	f.items[userID][merchID] += quantity
+	return f.items[userID][merchID], nil
+}
+
+func (f *fakeCartRepo) RemoveCartItem(ctx context.Context, userID int64, item string) error {
+	merch, ok := f.merchRepo.merchs[item]
+	if !ok {
+		return storage.ErrCartItemNotFound
+	}
+	if _, ok := f.items[userID][merch.ID]; !ok {
+		return storage.ErrCartItemNotFound
+	}
+	delete(f.items[userID], merch.ID)
+	return nil
+}
+
+func (f *fakeCartRepo) ClearCart(ctx context.Context, userID int64) error {
+	delete(f.items, userID)
+	return nil
+}
+
+// fakeNotifier запоминает отправленные оповещения
+type fakeNotifier struct {
+	alerts []notifier.LowStockAlert
+}
+
+func (n *fakeNotifier) NotifyLowStock(ctx context.Context, alert notifier.LowStockAlert) error {
+	n.alerts = append(n.alerts, alert)
+	return nil
+}
+
+type fakeCoinTxRepo struct {
+	transactions map[int64][]*models.CoinTransaction // ключ: userID
+}
+
+var _ storage.CoinTransactionStorage = (*fakeCoinTxRepo)(nil)
+
+func newFakeCoinTxRepo() *fakeCoinTxRepo {
+	return &fakeCoinTxRepo{transactions: make(map[int64][]*models.CoinTransaction)}
+}
+
+func (f *fakeCoinTxRepo) GetTransactionsByUserID(ctx context.Context, userID int64) ([]*models.CoinTransaction, error) {
+	if txs, ok := f.transactions[userID]; ok {
+		return txs, nil
+	}
+	return []*models.CoinTransaction{}, nil
+}
+
+func (f *fakeCoinTxRepo) CreateTransaction(ctx context.Context, userID int64, amount int, txType string, relatedUserID *int64) error {
+	// Не требуется для теста InfoService
+	return nil
+}
+
+func (f *fakeCoinTxRepo) CreatePurchaseTransaction(ctx context.Context, userID int64, amount int, orderID int64) error {
+	f.transactions[userID] = append(f.transactions[userID], &models.CoinTransaction{
+		UserID:  userID,
+		Amount:  amount,
+		Type:    models.CoinTxPurchase,
+		OrderID: &orderID,
+	})
+	return nil
+}
+
+type fakeIdempotencyRepo struct {
+	records map[string]*models.IdempotencyRecord // ключ: userID/key
+}
+
+var _ storage.IdempotencyStorage = (*fakeIdempotencyRepo)(nil)
+
+func newFakeIdempotencyRepo() *fakeIdempotencyRepo {
+	return &fakeIdempotencyRepo{records: make(map[string]*models.IdempotencyRecord)}
+}
+
+func (f *fakeIdempotencyRepo) SaveKey(ctx context.Context, record *models.IdempotencyRecord) (bool, error) {
+	id := fmt.Sprintf("%d/%s", record.UserID, record.Key)
+	if _, ok := f.records[id]; ok {
+		return false, nil
+	}
+	f.records[id] = record
+	return true, nil
+}
+
+func (f *fakeIdempotencyRepo) GetKey(ctx context.Context, userID int64, key string) (*models.IdempotencyRecord, error) {
+	record, ok := f.records[fmt.Sprintf("%d/%s", userID, key)]
+	if !ok {
+		return nil, storage.ErrIdempotencyKeyNotFound
+	}
+	return record, nil
+}
+
+// fakeReconcileRepo возвращает заранее заданные данные для сверки.
+type fakeReconcileRepo struct {
+	facts  map[int64]*models.BalanceFacts
+	orders []*models.OrderPriceMismatch
+}
+
+var _ storage.ReconcileStorage = (*fakeReconcileRepo)(nil)
+
+func newFakeReconcileRepo() *fakeReconcileRepo {
+	return &fakeReconcileRepo{facts: make(map[int64]*models.BalanceFacts)}
+}
+
+func (f *fakeReconcileRepo) ListBalanceFacts(ctx context.Context) ([]*models.BalanceFacts, error) {
+	var facts []*models.BalanceFacts
+	for _, fact := range f.facts {
+		facts = append(facts, fact)
+	}
+	return facts, nil
+}
+
+func (f *fakeReconcileRepo) GetBalanceFactsByUserID(ctx context.Context, userID int64) (*models.BalanceFacts, error) {
+	if fact, ok := f.facts[userID]; ok {
+		return fact, nil
+	}
+	return nil, storage.ErrUserNotFound
+}
+
+func (f *fakeReconcileRepo) ListOrderPriceMismatches(ctx context.Context) ([]*models.OrderPriceMismatch, error) {
+	return f.orders, nil
+}
+
+// fakeRoleRepo меняет роли пользователей fakeUserRepo и хранит журнал изменений.
+type fakeRoleRepo struct {
+	userRepo *fakeUserRepo
+	changes  []*models.RoleChange
+}
+
+var _ storage.RoleStorage = (*fakeRoleRepo)(nil)
+
+func (f *fakeRoleRepo) UpdateUserRole(ctx context.Context, userID int64, role models.Role) error {
+	user, err := f.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	user.Role = role
+	return nil
+}
+
+func (f *fakeRoleRepo) CreateRoleChange(ctx context.Context, change *models.RoleChange) error {
+	change.ID = int64(len(f.changes) + 1)
+	change.CreatedAt = time.Now()
+	f.changes = append(f.changes, change)
+	return nil
+}
+
+func (f *fakeRoleRepo) ListRoleChanges(ctx context.Context, userID int64) ([]*models.RoleChange, error) {
+	var changes []*models.RoleChange
+	for i := len(f.changes) - 1; i >= 0; i-- {
+		if f.changes[i].UserID == userID {
+			changes = append(changes, f.changes[i])
+		}
+	}
+	return changes, nil
+}
+
+func TestAuthService_Login_NewUser(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	authSvc := newTestAuthService(fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), newFakeRefreshRepo(), &fakeMailer{}, true)
+	ctx := context.Background()
+
+	email := "newuser@example.com"
+	password := "password123"
+
+	pair, err := authSvc.Login(ctx, email, password, "test-device", "")
+	assert.NoError(t, err, "Login should succeed for a new user")
+	assert.NotEmpty(t, pair.Tokens.AccessToken, "Token should not be empty")
+
+	user, err := fakeRepo.GetUserByEmail(ctx, email)
+	assert.NoError(t, err, "User should exist after creation")
+	assert.Equal(t, 1000, user.CoinBalance, "Initial coin balance should be 1000")
+	// Проверяем, что пароль хэширован (не равен исходному паролю)
+	assert.NotEqual(t, password, string(user.PassHash), "Password should be hashed")
+}
+
+func TestAuthService_Login_ExistingUser_CorrectPassword(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	authSvc := newTestAuthService(fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), newFakeRefreshRepo(), &fakeMailer{}, true)
+	ctx := context.Background()
+
+	email := "existing@example.com"
+	password := "password123"
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	assert.NoError(t, err)
+	user := &models.User{
+		Email:       email,
+		PassHash:    hashed,
+		CoinBalance: 1000,
+	}
+	_, err = fakeRepo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+
+	pair, err := authSvc.Login(ctx, email, password, "test-device", "")
+	assert.NoError(t, err, "Login should succeed with correct password")
+	assert.NotEmpty(t, pair.Tokens.AccessToken, "Token should be returned")
+	assert.NotEmpty(t, pair.Tokens.RefreshToken, "Refresh token should be returned")
+}
+
+func TestAuthService_Login_ExistingUser_WrongPassword(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	authSvc := newTestAuthService(fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), newFakeRefreshRepo(), &fakeMailer{}, true)
+	ctx := context.Background()
+
+	email := "existing@example.com"
+	password := "password123"
+	hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	assert.NoError(t, err)
+	user := &models.User{
+		Email:       email,
+		PassHash:    hashed,
+		CoinBalance: 1000,
+	}
+	_, err = fakeRepo.CreateUser(ctx, user)
+	assert.NoError(t, err)
+
+	pair, err := authSvc.Login(ctx, email, "wrongpassword", "test-device", "")
+	assert.Error(t, err, "Login should fail with incorrect password")
+	assert.Nil(t, pair, "Token should be empty on failed login")
+}
+
+func TestInfoService_GetInfo_Success(t *testing.T) {
+	// Создаем фиктивные репозитории.
+	userRepo := newFakeUserRepo()
+	orderRepo := newFakeOrderRepo()
+	coinTxRepo := newFakeCoinTxRepo()
+
+	// Добавляем пользователя с балансом 920, ID=1.
+	user := &models.User{
+		ID:          1,
+		Email:       "test@example.com",
+		PassHash:    []byte("hashed-password"),
+		CoinBalance: 920,
+	}
+
+	userRepo.users[user.Email] = user
+
+	// Добавляем пару заказов для пользователя (например, куплена футболка: 2 единицы)
+	orderRepo.orders[user.ID] = []*models.Order{
+		{
+			ID:         1,
+			UserID:     user.ID,
+			MerchID:    1,
+			MerchName:  "t-shirt",
+			Quantity:   1,
+			TotalPrice: 80,
+			CreatedAt:  time.Now().Add(-time.Hour),
+		},
+		{
+			ID:         2,
+			UserID:     user.ID,
+			MerchID:    1,
+			MerchName:  "t-shirt",
+			Quantity:   1,
+			TotalPrice: 80,
+			CreatedAt:  time.Now().Add(-30 * time.Minute),
+		},
+	}
+
+	// Добавляем транзакции для пользователя
+	coinTxRepo.transactions[user.ID] = []*models.CoinTransaction{
+		{
+			ID:            1,
+			UserID:        user.ID,
+			Amount:        80,
+			Type:          "transfer_received",
+			RelatedUserID: nil,
+			CreatedAt:     time.Now().Add(-45 * time.Minute),
+		},
+		{
+			ID:            2,
+			UserID:        user.ID,
+			Amount:        80,
+			Type:          "transfer_sent",
+			RelatedUserID: nil,
+			CreatedAt:     time.Now().Add(-50 * time.Minute),
+		},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	infoSvc := service.NewInfoService(logger, userRepo, orderRepo, coinTxRepo)
+
+	ctx := context.Background()
+	infoResp, err := infoSvc.GetInfo(ctx, user.ID)
+	assert.NoError(t, err, "GetInfo should succeed")
+	assert.Equal(t, 920, infoResp.Coins, "User coin balance should match")
+
+	// Проверяем инвентарь: два заказа футболок должны сгруппироваться в один элемент с количеством 2.
+	assert.Len(t, infoResp.Inventory, 1, "There should be one inventory item")
+	if len(infoResp.Inventory) > 0 {
+		assert.Equal(t, "t-shirt", infoResp.Inventory[0].Type, "Inventory item type should be t-shirt")
+		assert.Equal(t, 2, infoResp.Inventory[0].Quantity, "Inventory quantity should be 2")
+	}
+
+	// Проверяем транзакции: ожидаем одну запись для каждого типа
+	assert.Len(t, infoResp.CoinHistory.Received, 1, "There should be one received transaction")
+	assert.Len(t, infoResp.CoinHistory.Sent, 1, "There should be one sent transaction")
+}
+
+func TestInfoService_GetInfo_UnifiedHistory(t *testing.T) {
+	userRepo := newFakeUserRepo()
+	orderRepo := newFakeOrderRepo()
+	coinTxRepo := newFakeCoinTxRepo()
+
+	user := &models.User{ID: 1, Email: "test@example.com", CoinBalance: 940}
+	friend := &models.User{ID: 2, Email: "friend@example.com", CoinBalance: 1000}
+	userRepo.users[user.Email] = user
+	userRepo.users[friend.Email] = friend
+
+	now := time.Now()
+	orderID := int64(7)
+	// Репозиторий отдаёт операции от новых к старым.
+	coinTxRepo.transactions[user.ID] = []*models.CoinTransaction{
+		{ID: 3, UserID: user.ID, Amount: 80, Type: models.CoinTxPurchase, OrderID: &orderID, MerchName: "t-shirt", CreatedAt: now.Add(-10 * time.Minute)},
+		{ID: 2, UserID: user.ID, Amount: 30, Type: models.CoinTxTransferSent, RelatedUserID: &friend.ID, CreatedAt: now.Add(-20 * time.Minute)},
+		{ID: 1, UserID: user.ID, Amount: 50, Type: models.CoinTxTransferReceived, RelatedUserID: &friend.ID, CreatedAt: now.Add(-30 * time.Minute)},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	infoSvc := service.NewInfoService(logger, userRepo, orderRepo, coinTxRepo)
+
+	infoResp, err := infoSvc.GetInfo(context.Background(), user.ID)
+	assert.NoError(t, err)
+
+	// Разделение на полученные и отправленные сохраняется.
+	assert.Equal(t, []service.HistoryEntry{{FromUser: friend.Email, Amount: 50}}, infoResp.CoinHistory.Received)
+	assert.Equal(t, []service.HistoryEntry{{ToUser: friend.Email, Amount: 30}}, infoResp.CoinHistory.Sent)
+
+	// Общая история идёт от старых операций к новым и включает покупки.
+	assert.Equal(t, []service.CoinOperation{
+		{Type: models.CoinTxTransferReceived, Amount: 50, FromUser: friend.Email, CreatedAt: now.Add(-30 * time.Minute)},
+		{Type: models.CoinTxTransferSent, Amount: -30, ToUser: friend.Email, CreatedAt: now.Add(-20 * time.Minute)},
+		{Type: models.CoinTxPurchase, Amount: -80, Item: "t-shirt", OrderID: 7, CreatedAt: now.Add(-10 * time.Minute)},
+	}, infoResp.CoinHistory.Operations)
+}
+
+func TestInfoService_GetInfo_UserNotFound(t *testing.T) {
+	userRepo := newFakeUserRepo()
+	orderRepo := newFakeOrderRepo()
+	coinTxRepo := newFakeCoinTxRepo()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	infoSvc := service.NewInfoService(logger, userRepo, orderRepo, coinTxRepo)
+
+	ctx := context.Background()
+	_, err := infoSvc.GetInfo(ctx, 999) // Пользователь с таким ID не существует
+	assert.Error(t, err, "Expected error for non-existing user")
+}
+
+func TestBuyService_Buy_Success(t *testing.T) {
+	// Используем sqlmock для создания фиктивной БД.
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// Ожидаем вызов BeginTx и Commit.
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	// Создаем fake репозитории.
+	fakeUserRepo := newFakeUserRepo()
+	fakeMerchRepo := newFakeMerchRepo()
+	fakeOrderRepo := newFakeOrderRepo()
+
+	// Добавляем пользователя с балансом 1000, ID=1.
+	user := &models.User{
+		ID:            1,
+		Email:         "test@example.com",
+		PassHash:      []byte("hashed"),
+		CoinBalance:   1000,
+		EmailVerified: true,
+	}
+	fakeUserRepo.users[user.Email] = user
+
+	// Добавляем мерч "t-shirt" с ценой 80.
+	fakeMerchRepo.merchs["t-shirt"] = &models.Merch{
+		ID:    1,
+		Name:  "t-shirt",
+		Price: 80,
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	buySvc := service.NewBuyService(logger, storage.NewTxManager(db, storage.RetryPolicy{}), fakeUserRepo, fakeMerchRepo, fakeOrderRepo, newFakeCoinTxRepo(), newFakeLedgerRepo(fakeUserRepo), nil, nil, nil, service.StockAlertOptions{})
+
+	// Вызываем метод Buy.
+	err = buySvc.Buy(context.Background(), user.ID, "t-shirt", 1)
+	assert.NoError(t, err, "Buy should succeed")
+
+	// Проверяем, что баланс пользователя обновился: 1000 - 80 = 920.
 	updatedUser, err := fakeUserRepo.GetUserByID(context.Background(), user.ID)
 	assert.NoError(t, err)
-	assert.Equal(t, 920, updatedUser.CoinBalance, "User balance should be updated to 920")
+	assert.Equal(t, 920, updatedUser.CoinBalance, "User balance should be updated to 920")
+
+	// Проверяем ожидания sqlmock.
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err, "sqlmock expectations should be met")
+}
+
+func TestBuyService_Buy_InsufficientFunds(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// Ожидаем вызов BeginTx и Commit не произойдет, а вместо этого будет Rollback.
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	fakeUserRepo := newFakeUserRepo()
+	fakeMerchRepo := newFakeMerchRepo()
+	fakeOrderRepo := newFakeOrderRepo()
+
+	// Пользователь с балансом 50, ID=1.
+	user := &models.User{
+		ID:            1,
+		Email:         "test@example.com",
+		PassHash:      []byte("hashed"),
+		CoinBalance:   50,
+		EmailVerified: true,
+	}
+	fakeUserRepo.users[user.Email] = user
+
+	// Мерч "t-shirt" с ценой 80.
+	fakeMerchRepo.merchs["t-shirt"] = &models.Merch{
+		ID:    1,
+		Name:  "t-shirt",
+		Price: 80,
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	buySvc := service.NewBuyService(logger, storage.NewTxManager(db, storage.RetryPolicy{}), fakeUserRepo, fakeMerchRepo, fakeOrderRepo, newFakeCoinTxRepo(), newFakeLedgerRepo(fakeUserRepo), nil, nil, nil, service.StockAlertOptions{})
+
+	err = buySvc.Buy(context.Background(), user.ID, "t-shirt", 1)
+	assert.Error(t, err, "Buy should fail due to insufficient funds")
+	assert.ErrorIs(t, err, service.ErrInsufficientFunds)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err, "sqlmock expectations should be met")
+}
+
+func TestSendCoinService_Success(t *testing.T) {
+	// Используем sqlmock для создания фиктивной БД.
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// Ожидаем вызов BeginTx и Commit.
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	// Создаем фиктивный репозиторий пользователей.
+	fakeUserRepo := newFakeUserRepo()
+	fakeCoinTxRepo := newFakeCoinTxRepo()
+
+	// Добавляем отправителя и получателя.
+	sender := &models.User{
+		ID:            1,
+		Email:         "sender@example.com",
+		PassHash:      []byte("hashed"),
+		CoinBalance:   1000,
+		EmailVerified: true,
+	}
+	receiver := &models.User{
+		ID:            2,
+		Email:         "receiver@example.com",
+		PassHash:      []byte("hashed"),
+		CoinBalance:   500,
+		EmailVerified: true,
+	}
+	fakeUserRepo.users[sender.Email] = sender
+	fakeUserRepo.users[receiver.Email] = receiver
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	sendCoinSvc := service.NewSendCoinService(logger, storage.NewTxManager(db, storage.RetryPolicy{}), fakeUserRepo, fakeCoinTxRepo, newFakeLedgerRepo(fakeUserRepo), nil)
+
+	// Перевод 100 монет от отправителя к получателю.
+	err = sendCoinSvc.SendCoin(context.Background(), sender.ID, receiver.Email, 100)
+	assert.NoError(t, err, "SendCoin should succeed with valid data")
+
+	// Проверяем, что баланс отправителя уменьшился, а получателя увеличился.
+	updatedSender, err := fakeUserRepo.GetUserByID(context.Background(), sender.ID)
+	assert.NoError(t, err)
+	updatedReceiver, err := fakeUserRepo.GetUserByEmail(context.Background(), receiver.Email)
+	assert.NoError(t, err)
+	assert.Equal(t, 900, updatedSender.CoinBalance, "Sender balance should be updated to 900")
+	assert.Equal(t, 600, updatedReceiver.CoinBalance, "Receiver balance should be updated to 600")
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err, "sqlmock expectations should be met")
+}
+
+func TestSendCoinService_SelfTransfer(t *testing.T) {
+	// Создаем фиктивную БД, хотя в этом тесте транзакция не дойдёт до вызова BeginTx.
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// Ожидаем вызов BeginTx и затем Rollback.
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	fakeUserRepo := newFakeUserRepo()
+	fakeCoinTxRepo := newFakeCoinTxRepo()
+
+	// Добавляем пользователя с балансом 1000.
+	user := &models.User{
+		ID:            1,
+		Email:         "user@example.com",
+		PassHash:      []byte("hashed"),
+		CoinBalance:   1000,
+		EmailVerified: true,
+	}
+	fakeUserRepo.users[user.Email] = user
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	sendCoinSvc := service.NewSendCoinService(logger, storage.NewTxManager(db, storage.RetryPolicy{}), fakeUserRepo, fakeCoinTxRepo, newFakeLedgerRepo(fakeUserRepo), nil)
+
+	// Пытаемся перевести монеты самому себе.
+	err = sendCoinSvc.SendCoin(context.Background(), user.ID, user.Email, 100)
+	assert.Error(t, err, "SendCoin should fail when transferring coins to self")
+	assert.ErrorIs(t, err, service.ErrSelfTransfer)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err, "sqlmock expectations should be met")
+}
+
+func TestSendCoinService_InsufficientFunds(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// Ожидаем вызов BeginTx и Rollback, поскольку средств недостаточно.
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	fakeUserRepo := newFakeUserRepo()
+	fakeCoinTxRepo := newFakeCoinTxRepo()
+
+	// Добавляем отправителя с балансом 50.
+	sender := &models.User{
+		ID:            1,
+		Email:         "sender@example.com",
+		PassHash:      []byte("hashed"),
+		CoinBalance:   50,
+		EmailVerified: true,
+	}
+	// Получатель с балансом 500.
+	receiver := &models.User{
+		ID:            2,
+		Email:         "receiver@example.com",
+		PassHash:      []byte("hashed"),
+		CoinBalance:   500,
+		EmailVerified: true,
+	}
+	fakeUserRepo.users[sender.Email] = sender
+	fakeUserRepo.users[receiver.Email] = receiver
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	sendCoinSvc := service.NewSendCoinService(logger, storage.NewTxManager(db, storage.RetryPolicy{}), fakeUserRepo, fakeCoinTxRepo, newFakeLedgerRepo(fakeUserRepo), nil)
+
+	// Пытаемся перевести 100 монет, но у отправителя недостаточно средств.
+	err = sendCoinSvc.SendCoin(context.Background(), sender.ID, receiver.Email, 100)
+	assert.Error(t, err, "SendCoin should fail due to insufficient funds")
+	assert.ErrorIs(t, err, service.ErrInsufficientFunds)
+
+	err = mock.ExpectationsWereMet()
+	assert.NoError(t, err, "sqlmock expectations should be met")
+}
+
+func TestSendCoinService_LocksUsersInIDOrder(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	fakeUserRepo := newFakeUserRepo()
+	fakeCoinTxRepo := newFakeCoinTxRepo()
+
+	// Отправитель имеет больший ID, чем получатель: блокировки всё равно берутся по возрастанию ID.
+	sender := &models.User{ID: 7, Email: "sender@example.com", PassHash: []byte("hashed"), CoinBalance: 1000, EmailVerified: true}
+	receiver := &models.User{ID: 3, Email: "receiver@example.com", PassHash: []byte("hashed"), CoinBalance: 500, EmailVerified: true}
+	fakeUserRepo.users[sender.Email] = sender
+	fakeUserRepo.users[receiver.Email] = receiver
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	sendCoinSvc := service.NewSendCoinService(logger, storage.NewTxManager(db, storage.RetryPolicy{}), fakeUserRepo, fakeCoinTxRepo, newFakeLedgerRepo(fakeUserRepo), nil)
+
+	err = sendCoinSvc.SendCoin(context.Background(), sender.ID, receiver.Email, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, []int64{3, 7}, fakeUserRepo.lockOrder, "Rows should be locked in ascending ID order")
+	assert.Equal(t, 900, sender.CoinBalance)
+	assert.Equal(t, 600, receiver.CoinBalance)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSendCoinService_ReceiverReadInsideTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	fakeUserRepo := newFakeUserRepo()
+	fakeCoinTxRepo := newFakeCoinTxRepo()
+
+	sender := &models.User{ID: 1, Email: "sender@example.com", PassHash: []byte("hashed"), CoinBalance: 1000, EmailVerified: true}
+	receiver := &models.User{ID: 2, Email: "receiver@example.com", PassHash: []byte("hashed"), CoinBalance: 500, EmailVerified: true}
+	fakeUserRepo.users[sender.Email] = sender
+	fakeUserRepo.users[receiver.Email] = receiver
+
+	// Вне транзакции виден устаревший баланс получателя (до параллельного перевода ему 300 монет).
+	// Если сервис прочитает получателя вне транзакции, начисление перезапишет актуальный баланс.
+	fakeUserRepo.staleByEmail = map[string]*models.User{
+		receiver.Email: {ID: 2, Email: receiver.Email, PassHash: []byte("hashed"), CoinBalance: 200, EmailVerified: true},
+	}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	sendCoinSvc := service.NewSendCoinService(logger, storage.NewTxManager(db, storage.RetryPolicy{}), fakeUserRepo, fakeCoinTxRepo, newFakeLedgerRepo(fakeUserRepo), nil)
+
+	err = sendCoinSvc.SendCoin(context.Background(), sender.ID, receiver.Email, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, 900, sender.CoinBalance)
+	assert.Equal(t, 600, receiver.CoinBalance, "Receiver balance must be based on the transactional read")
+	assert.Zero(t, fakeUserRepo.outsideTxReads, "Receiver must not be read outside the transaction")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSendCoinService_IdempotencyKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	// Первый запрос выполняется, повтор и запрос с другим телом откатываются.
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	fakeUserRepo := newFakeUserRepo()
+	fakeCoinTxRepo := newFakeCoinTxRepo()
+	fakeIdemRepo := newFakeIdempotencyRepo()
+
+	sender := &models.User{ID: 1, Email: "sender@example.com", PassHash: []byte("hashed"), CoinBalance: 1000, EmailVerified: true}
+	receiver := &models.User{ID: 2, Email: "receiver@example.com", PassHash: []byte("hashed"), CoinBalance: 500, EmailVerified: true}
+	fakeUserRepo.users[sender.Email] = sender
+	fakeUserRepo.users[receiver.Email] = receiver
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	sendCoinSvc := service.NewSendCoinService(logger, storage.NewTxManager(db, storage.RetryPolicy{}), fakeUserRepo, fakeCoinTxRepo, newFakeLedgerRepo(fakeUserRepo), fakeIdemRepo)
+
+	idem := service.IdempotencyRequest{Key: "key-1", RequestHash: "hash-1", ResponseCode: 200, ResponseBody: []byte(`{"message":"ok"}`)}
+	ctx := service.WithIdempotency(context.Background(), idem)
+
+	err = sendCoinSvc.SendCoin(ctx, sender.ID, receiver.Email, 100)
+	assert.NoError(t, err, "First request should succeed")
+
+	// Повтор с тем же ключом и телом возвращает сохранённый ответ и не переводит монеты повторно.
+	err = sendCoinSvc.SendCoin(ctx, sender.ID, receiver.Email, 100)
+	var replay *service.ReplayError
+	assert.True(t, errors.As(err, &replay), "Retry should be replayed")
+	if replay != nil {
+		assert.Equal(t, 200, replay.ResponseCode)
+		assert.Equal(t, idem.ResponseBody, replay.ResponseBody)
+	}
+	assert.Equal(t, 900, sender.CoinBalance, "Coins must be moved only once")
+	assert.Equal(t, 600, receiver.CoinBalance, "Coins must be moved only once")
+
+	// Тот же ключ с другим телом запроса — конфликт.
+	idem.RequestHash = "hash-2"
+	err = sendCoinSvc.SendCoin(service.WithIdempotency(context.Background(), idem), sender.ID, receiver.Email, 50)
+	assert.True(t, errors.Is(err, service.ErrIdempotencyKeyReused), "Key reuse with another body should conflict")
+	assert.Equal(t, 900, sender.CoinBalance)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthService_Login_NewUser_PostsSignupGrant(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	fakeLedger := newFakeLedgerRepo(fakeRepo)
+	authSvc := newTestAuthService(fakeRepo, fakeLedger, newFakeTokenRepo(), newFakeRefreshRepo(), &fakeMailer{}, true)
+
+	_, err := authSvc.Login(context.Background(), "grant@example.com", "password123", "", "")
+	assert.NoError(t, err)
+
+	user, err := fakeRepo.GetUserByEmail(context.Background(), "grant@example.com")
+	assert.NoError(t, err)
+	assert.True(t, fakeLedger.wallets[user.ID], "Wallet should be created for a new user")
+
+	// Начальные монеты приходят из счёта эмиссии.
+	assert.Len(t, fakeLedger.entries, 1)
+	entry := fakeLedger.entries[0]
+	assert.Equal(t, models.LedgerEntrySignupGrant, entry.Kind)
+	assert.Equal(t, []models.LedgerPosting{
+		{Account: models.SystemAccount(models.LedgerAccountCompanyIssuance), Amount: -1000},
+		{Account: models.WalletAccount(user.ID), Amount: 1000},
+	}, entry.Postings)
+}
+
+func TestBuyService_Buy_PostsLedgerEntry(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectCommit()
+
+	fakeUserRepo := newFakeUserRepo()
+	fakeMerchRepo := newFakeMerchRepo()
+	fakeOrderRepo := newFakeOrderRepo()
+	fakeCoinTxRepo := newFakeCoinTxRepo()
+	fakeLedger := newFakeLedgerRepo(fakeUserRepo)
+
+	user := &models.User{ID: 1, Email: "test@example.com", PassHash: []byte("hashed"), CoinBalance: 1000, EmailVerified: true}
+	fakeUserRepo.users[user.Email] = user
+	fakeMerchRepo.merchs["cup"] = &models.Merch{ID: 2, Name: "cup", Price: 20}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	buySvc := service.NewBuyService(logger, storage.NewTxManager(db, storage.RetryPolicy{}), fakeUserRepo, fakeMerchRepo, fakeOrderRepo, fakeCoinTxRepo, fakeLedger, nil, nil, nil, service.StockAlertOptions{})
+
+	err = buySvc.Buy(context.Background(), user.ID, "cup", 1)
+	assert.NoError(t, err)
+
+	// Покупка — перенос монет с кошелька на выручку магазина со ссылкой на заказ.
+	assert.Len(t, fakeLedger.entries, 1)
+	entry := fakeLedger.entries[0]
+	assert.Equal(t, models.LedgerEntryPurchase, entry.Kind)
+	assert.Equal(t, "order:1", entry.Reference)
+	assert.Equal(t, []models.LedgerPosting{
+		{Account: models.WalletAccount(user.ID), Amount: -20},
+		{Account: models.SystemAccount(models.LedgerAccountShopRevenue), Amount: 20},
+	}, entry.Postings)
+	assert.Equal(t, 980, user.CoinBalance)
+
+	// Списание попадает в историю операций со ссылкой на заказ.
+	orderID := int64(1)
+	assert.Equal(t, []*models.CoinTransaction{
+		{UserID: user.ID, Amount: 20, Type: models.CoinTxPurchase, OrderID: &orderID},
+	}, fakeCoinTxRepo.transactions[user.ID])
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReconcileService_Reconcile(t *testing.T) {
+	fakeUserRepo := newFakeUserRepo()
+	fakeReconcile := newFakeReconcileRepo()
+	// Баланс совпадает с историей.
+	fakeReconcile.facts[1] = &models.BalanceFacts{UserID: 1, Email: "ok@example.com", CoinBalance: 950, Grants: 1000, Sent: 50, LedgerBalance: 950}
+	// Пользователь до журнала: начальные 1000 монет засчитываются без записи signup_grant.
+	fakeReconcile.facts[2] = &models.BalanceFacts{UserID: 2, Email: "legacy@example.com", CoinBalance: 1030, LegacyUser: true, Received: 50, Spent: 20, LedgerBalance: 1030}
+	// Баланс больше ожидаемого.
+	fakeReconcile.facts[3] = &models.BalanceFacts{UserID: 3, Email: "drift@example.com", CoinBalance: 1100, Grants: 1000, LedgerBalance: 1100}
+	fakeReconcile.orders = []*models.OrderPriceMismatch{{OrderID: 5, UserID: 1, MerchName: "cup", Quantity: 1, TotalPrice: 10, ExpectedPrice: 20}}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	svc := service.NewReconcileService(logger, fakeTxManager{}, fakeUserRepo, newFakeLedgerRepo(fakeUserRepo), fakeReconcile)
+
+	report, err := svc.Reconcile(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, 3, report.CheckedUsers)
+	assert.Equal(t, []service.UserDiscrepancy{
+		{UserID: 3, Email: "drift@example.com", CoinBalance: 1100, Expected: 1000, Difference: -100, LedgerBalance: 1100},
+	}, report.Users)
+	assert.Equal(t, []service.OrderDiscrepancy{
+		{OrderID: 5, UserID: 1, Item: "cup", Quantity: 1, TotalPrice: 10, ExpectedPrice: 20},
+	}, report.Orders)
+	assert.True(t, report.HasMismatches())
+}
+
+func TestReconcileService_Fix_PostsAdjustment(t *testing.T) {
+	fakeUserRepo := newFakeUserRepo()
+	fakeLedger := newFakeLedgerRepo(fakeUserRepo)
+	fakeReconcile := newFakeReconcileRepo()
+
+	user := &models.User{ID: 3, Email: "drift@example.com", CoinBalance: 1100}
+	fakeUserRepo.users[user.Email] = user
+	fakeReconcile.facts[3] = &models.BalanceFacts{UserID: 3, Email: user.Email, CoinBalance: 1100, Grants: 1000, LedgerBalance: 1100}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	svc := service.NewReconcileService(logger, fakeTxManager{}, fakeUserRepo, fakeLedger, fakeReconcile)
+
+	report, err := svc.Reconcile(context.Background())
+	assert.NoError(t, err)
+
+	err = svc.Fix(context.Background(), report, "")
+	assert.ErrorIs(t, err, service.ErrReasonRequired)
+	assert.Empty(t, fakeLedger.entries)
+
+	err = svc.Fix(context.Background(), report, "duplicate grant, ticket 42")
+	assert.NoError(t, err)
+
+	// Лишние монеты списываются обратно на счёт эмиссии с указанием причины.
+	assert.Len(t, fakeLedger.entries, 1)
+	entry := fakeLedger.entries[0]
+	assert.Equal(t, models.LedgerEntryAdjustment, entry.Kind)
+	assert.Equal(t, "reconcile:user:3", entry.Reference)
+	assert.Equal(t, "duplicate grant, ticket 42", entry.Reason)
+	assert.Equal(t, []models.LedgerPosting{
+		{Account: models.SystemAccount(models.LedgerAccountCompanyIssuance), Amount: 100},
+		{Account: models.WalletAccount(3), Amount: -100},
+	}, entry.Postings)
+	assert.Equal(t, 1000, user.CoinBalance)
+	assert.Equal(t, []int64{3}, fakeUserRepo.lockOrder)
+	assert.True(t, report.Users[0].Fixed)
+	assert.False(t, report.HasMismatches())
+}
+
+func TestAuthService_Login_UnknownUserWithoutAutoRegister(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	authSvc := newTestAuthService(fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), newFakeRefreshRepo(), &fakeMailer{}, false)
+
+	pair, err := authSvc.Login(context.Background(), "nobody@example.com", "password123", "", "")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	assert.Nil(t, pair)
+	assert.Empty(t, fakeRepo.users, "Login must not create users when auto-registration is disabled")
+}
+
+func TestAuthService_Register_SendsVerificationEmail(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	fakeLedger := newFakeLedgerRepo(fakeRepo)
+	m := &fakeMailer{}
+	authSvc := newTestAuthService(fakeRepo, fakeLedger, newFakeTokenRepo(), newFakeRefreshRepo(), m, false)
+	ctx := context.Background()
+
+	err := authSvc.Register(ctx, "new@example.com", "password123")
+	assert.NoError(t, err)
+
+	user, err := fakeRepo.GetUserByEmail(ctx, "new@example.com")
+	assert.NoError(t, err)
+	assert.False(t, user.EmailVerified)
+	assert.True(t, fakeLedger.wallets[user.ID], "Wallet should be created on registration")
+	// До подтверждения email монеты не начисляются.
+	assert.Empty(t, fakeLedger.entries)
+	assert.Equal(t, 0, user.CoinBalance)
+
+	assert.Len(t, m.sent, 1)
+	assert.Equal(t, "new@example.com", m.sent[0].To)
+
+	// Повторная регистрация с тем же email.
+	err = authSvc.Register(ctx, "new@example.com", "password123")
+	assert.ErrorIs(t, err, service.ErrUserAlreadyExists)
+}
+
+func TestAuthService_Register_CommitFailedSendsNoEmail(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	m := &fakeMailer{}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	txManager := retryingTxManager{attempts: 1, commitErr: errors.New("commit failed")}
+	authSvc := service.NewAuthService(logger, txManager, fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), newFakeRefreshRepo(),
+		storage.NewMemoryLoginAttemptStorage(), newFakeTwoFactorRepo(), newFakeIdentityRepo(), newFakeSessionRepo(), m, password.NewBcryptHasher(bcrypt.MinCost), security.NewHMACKeySet("testsecret"), service.AuthOptions{
+			TokenTTL:        time.Minute,
+			VerificationTTL: time.Hour,
+		})
+
+	// Токен не сохранён, поэтому письмо с ним не отправляется
+	err := authSvc.Register(context.Background(), "new@example.com", "password123")
+	assert.Error(t, err)
+	assert.Empty(t, m.sent)
+}
+
+func TestAuthService_VerifyEmail_GrantsCoinsOnce(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	fakeLedger := newFakeLedgerRepo(fakeRepo)
+	m := &fakeMailer{}
+	authSvc := newTestAuthService(fakeRepo, fakeLedger, newFakeTokenRepo(), newFakeRefreshRepo(), m, false)
+	ctx := context.Background()
+
+	assert.NoError(t, authSvc.Register(ctx, "new@example.com", "password123"))
+	assert.Len(t, m.sent, 1)
+
+	// Токен в письме стоит отдельной строкой после инструкции.
+	var token string
+	for _, line := range strings.Split(m.sent[0].Body, "\n") {
+		if len(line) == 43 && !strings.Contains(line, " ") {
+			token = line
+		}
+	}
+	assert.NotEmpty(t, token, "Verification email should contain the token")
+
+	assert.ErrorIs(t, authSvc.VerifyEmail(ctx, "wrong-token"), service.ErrInvalidVerificationToken)
+
+	assert.NoError(t, authSvc.VerifyEmail(ctx, token))
+	user, err := fakeRepo.GetUserByEmail(ctx, "new@example.com")
+	assert.NoError(t, err)
+	assert.True(t, user.EmailVerified)
+	assert.Equal(t, service.InitialCoinGrant, user.CoinBalance)
+	assert.Len(t, fakeLedger.entries, 1)
+
+	// Токен одноразовый.
+	assert.ErrorIs(t, authSvc.VerifyEmail(ctx, token), service.ErrInvalidVerificationToken)
+	assert.Equal(t, service.InitialCoinGrant, user.CoinBalance)
+}
+
+func TestBuyService_Buy_EmailNotVerified(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	fakeUserRepo := newFakeUserRepo()
+	fakeMerchRepo := newFakeMerchRepo()
+	fakeLedger := newFakeLedgerRepo(fakeUserRepo)
+
+	user := &models.User{ID: 1, Email: "test@example.com", PassHash: []byte("hashed"), CoinBalance: 1000}
+	fakeUserRepo.users[user.Email] = user
+	fakeMerchRepo.merchs["cup"] = &models.Merch{ID: 2, Name: "cup", Price: 20}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	buySvc := service.NewBuyService(logger, storage.NewTxManager(db, storage.RetryPolicy{}), fakeUserRepo, fakeMerchRepo, newFakeOrderRepo(), newFakeCoinTxRepo(), fakeLedger, nil, nil, nil, service.StockAlertOptions{})
+
+	err = buySvc.Buy(context.Background(), user.ID, "cup", 1)
+	assert.ErrorIs(t, err, service.ErrEmailNotVerified)
+	assert.Empty(t, fakeLedger.entries)
+	assert.Equal(t, 1000, user.CoinBalance)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAuthService_Refresh_RotatesToken(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	refreshRepo := newFakeRefreshRepo()
+	authSvc := newTestAuthService(fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), refreshRepo, &fakeMailer{}, true)
+	ctx := context.Background()
+
+	pair, err := authSvc.Login(ctx, "user@example.com", "password123", "laptop", "")
+	assert.NoError(t, err)
+	assert.Len(t, refreshRepo.tokens, 1)
+	assert.Equal(t, "laptop", refreshRepo.tokens[0].Device)
+	// В БД хранится только хэш.
+	assert.NotEqual(t, pair.Tokens.RefreshToken, string(refreshRepo.tokens[0].TokenHash))
+
+	rotated, err := authSvc.Refresh(ctx, pair.Tokens.RefreshToken)
+	assert.NoError(t, err)
+	assert.NotEqual(t, pair.Tokens.RefreshToken, rotated.RefreshToken)
+	assert.NotEmpty(t, rotated.AccessToken)
+	assert.Len(t, refreshRepo.tokens, 2)
+	assert.Equal(t, "laptop", refreshRepo.tokens[1].Device, "Device label is kept on rotation")
+	assert.Equal(t, int64(2), *refreshRepo.tokens[0].ReplacedBy)
+
+	_, err = authSvc.Refresh(ctx, "unknown")
+	assert.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+}
+
+func TestAuthService_Refresh_ReuseRevokesAllTokens(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	refreshRepo := newFakeRefreshRepo()
+	authSvc := newTestAuthService(fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), refreshRepo, &fakeMailer{}, true)
+	ctx := context.Background()
+
+	pair, err := authSvc.Login(ctx, "user@example.com", "password123", "laptop", "")
+	assert.NoError(t, err)
+	_, err = authSvc.Login(ctx, "user@example.com", "password123", "phone", "")
+	assert.NoError(t, err)
+	_, err = authSvc.Refresh(ctx, pair.Tokens.RefreshToken)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, refreshRepo.activeRefreshTokens(1))
+
+	// Заменённый токен предъявлен повторно — отзываются все сессии пользователя.
+	issuedAt := time.Now().Add(-time.Second)
+	_, err = authSvc.Refresh(ctx, pair.Tokens.RefreshToken)
+	assert.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+	assert.Equal(t, 0, refreshRepo.activeRefreshTokens(1))
+	// Выданные ранее access-токены тоже отзываются
+	assert.False(t, refreshRepo.validAfter[1].IsZero(), "SetTokensValidAfter is called on reuse")
+	assert.ErrorIs(t, authSvc.CheckAccessToken(ctx, 1, jwtmiddleware.TokenInfo{ID: "jti-1", IssuedAt: issuedAt}), jwtmiddleware.ErrTokenRevoked)
+}
+
+func TestAuthService_LogoutAll_RevokesIssuedTokens(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	refreshRepo := newFakeRefreshRepo()
+	authSvc := newTestAuthService(fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), refreshRepo, &fakeMailer{}, true)
+	ctx := context.Background()
+
+	pair, err := authSvc.Login(ctx, "user@example.com", "password123", "laptop", "")
+	assert.NoError(t, err)
+	issuedAt := time.Now().Add(-time.Second)
+	assert.NoError(t, authSvc.CheckAccessToken(ctx, 1, jwtmiddleware.TokenInfo{ID: "jti-1", IssuedAt: issuedAt}))
+
+	assert.NoError(t, authSvc.LogoutAll(ctx, 1))
+	assert.ErrorIs(t, authSvc.CheckAccessToken(ctx, 1, jwtmiddleware.TokenInfo{ID: "jti-1", IssuedAt: issuedAt}), jwtmiddleware.ErrTokenRevoked)
+	assert.NoError(t, authSvc.CheckAccessToken(ctx, 1, jwtmiddleware.TokenInfo{ID: "jti-2", IssuedAt: time.Now().Add(time.Second)}), "Tokens issued later stay valid")
+	assert.Equal(t, 0, refreshRepo.activeRefreshTokens(1))
+
+	_, err = authSvc.Refresh(ctx, pair.Tokens.RefreshToken)
+	assert.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+}
+
+func TestAuthService_Logout_RevokesCurrentTokens(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	refreshRepo := newFakeRefreshRepo()
+	authSvc := newTestAuthService(fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), refreshRepo, &fakeMailer{}, true)
+	ctx := context.Background()
+
+	laptop, err := authSvc.Login(ctx, "user@example.com", "password123", "laptop", "")
+	assert.NoError(t, err)
+	_, err = authSvc.Login(ctx, "user@example.com", "password123", "phone", "")
+	assert.NoError(t, err)
+
+	assert.NoError(t, authSvc.Logout(ctx, 1, jwtmiddleware.TokenInfo{ID: "jti-1", ExpiresAt: time.Now().Add(time.Hour)}, laptop.Tokens.RefreshToken))
+	assert.ErrorIs(t, authSvc.CheckAccessToken(ctx, 1, jwtmiddleware.TokenInfo{ID: "jti-1", IssuedAt: time.Now()}), jwtmiddleware.ErrTokenRevoked)
+	// Сессия на другом устройстве не затронута.
+	assert.Equal(t, 1, refreshRepo.activeRefreshTokens(1))
+	assert.Equal(t, "phone", refreshRepo.tokens[1].Device)
+	assert.Nil(t, refreshRepo.tokens[1].RevokedAt)
+}
+
+func TestAuthService_RevokeSession_TakesEffectImmediately(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	refreshRepo := newFakeRefreshRepo()
+	authSvc := newTestAuthService(fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), refreshRepo, &fakeMailer{}, true)
+	ctx := context.Background()
+
+	laptop, err := authSvc.Login(ctx, "user@example.com", "password123", "laptop", "203.0.113.5")
+	assert.NoError(t, err)
+	phone, err := authSvc.Login(ctx, "user@example.com", "password123", "phone", "198.51.100.7")
+	assert.NoError(t, err)
+
+	sessions, err := authSvc.ListSessions(ctx, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, sessions, 2) {
+		assert.Equal(t, "phone", sessions[0].UserAgent)
+		assert.Equal(t, "198.51.100.7", sessions[0].IP)
+		assert.Equal(t, "laptop", sessions[1].UserAgent)
+		assert.Equal(t, "203.0.113.5", sessions[1].IP)
+	}
+	laptopToken := jwtmiddleware.TokenInfo{ID: "jti-1", IssuedAt: time.Now(), SessionID: sessions[1].ID}
+	phoneToken := jwtmiddleware.TokenInfo{ID: "jti-2", IssuedAt: time.Now(), SessionID: sessions[0].ID}
+	assert.NoError(t, authSvc.CheckAccessToken(ctx, 1, laptopToken))
+	// sid чужой сессии не принимается
+	assert.ErrorIs(t, authSvc.CheckAccessToken(ctx, 2, laptopToken), jwtmiddleware.ErrTokenRevoked)
+
+	assert.ErrorIs(t, authSvc.RevokeSession(ctx, 2, laptopToken.SessionID), service.ErrSessionNotFound)
+	assert.NoError(t, authSvc.RevokeSession(ctx, 1, laptopToken.SessionID))
+	assert.ErrorIs(t, authSvc.RevokeSession(ctx, 1, laptopToken.SessionID), service.ErrSessionNotFound)
+
+	// Access-токен отозванной сессии отклоняется сразу, refresh-токен не продлевает её
+	assert.ErrorIs(t, authSvc.CheckAccessToken(ctx, 1, laptopToken), jwtmiddleware.ErrTokenRevoked)
+	_, err = authSvc.Refresh(ctx, laptop.Tokens.RefreshToken)
+	assert.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+
+	// Сессия на другом устройстве не затронута
+	assert.NoError(t, authSvc.CheckAccessToken(ctx, 1, phoneToken))
+	_, err = authSvc.Refresh(ctx, phone.Tokens.RefreshToken)
+	assert.NoError(t, err)
+	sessions, err = authSvc.ListSessions(ctx, 1)
+	assert.NoError(t, err)
+	if assert.Len(t, sessions, 1) {
+		assert.Equal(t, phoneToken.SessionID, sessions[0].ID)
+	}
+}
+
+func TestAuthService_Logout_EndsSession(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	refreshRepo := newFakeRefreshRepo()
+	authSvc := newTestAuthService(fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), refreshRepo, &fakeMailer{}, true)
+	ctx := context.Background()
+
+	laptop, err := authSvc.Login(ctx, "user@example.com", "password123", "laptop", "")
+	assert.NoError(t, err)
+	sessions, err := authSvc.ListSessions(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, sessions, 1)
+
+	// refresh-токен в запросе не передан, но сессия завершается вместе с ним
+	token := jwtmiddleware.TokenInfo{ID: "jti-1", ExpiresAt: time.Now().Add(time.Hour), SessionID: sessions[0].ID}
+	assert.NoError(t, authSvc.Logout(ctx, 1, token, ""))
+	sessions, err = authSvc.ListSessions(ctx, 1)
+	assert.NoError(t, err)
+	assert.Empty(t, sessions)
+	_, err = authSvc.Refresh(ctx, laptop.Tokens.RefreshToken)
+	assert.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+}
+
+func TestRoleService_ChangeRole_AuditsAndRevokesTokens(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	fakeRepo.users["admin@example.com"] = &models.User{ID: 1, Email: "admin@example.com", Role: models.RoleAdmin}
+	fakeRepo.users["user@example.com"] = &models.User{ID: 2, Email: "user@example.com", Role: models.RoleEmployee}
+	roleRepo := &fakeRoleRepo{userRepo: fakeRepo}
+	refreshRepo := newFakeRefreshRepo()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	roleSvc := service.NewRoleService(logger, fakeTxManager{}, fakeRepo, roleRepo, refreshRepo)
+	ctx := context.Background()
+
+	change, err := roleSvc.ChangeRole(ctx, 1, 2, models.RoleFinance, " quarterly audit ")
+	assert.NoError(t, err)
+	assert.Equal(t, models.RoleFinance, fakeRepo.users["user@example.com"].Role)
+	assert.Equal(t, models.RoleEmployee, change.OldRole)
+	assert.Equal(t, "quarterly audit", change.Reason)
+	assert.Equal(t, []int64{2}, fakeRepo.lockOrder)
+	// Токены со старой ролью перестают приниматься
+	assert.False(t, refreshRepo.validAfter[2].IsZero())
+
+	changes, err := roleSvc.ListRoleChanges(ctx, 2)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 1)
+	assert.Equal(t, int64(1), changes[0].ChangedBy)
+
+	// Повторное назначение той же роли не пишет журнал
+	_, err = roleSvc.ChangeRole(ctx, 1, 2, models.RoleFinance, "")
+	assert.NoError(t, err)
+	assert.Len(t, roleRepo.changes, 1)
+}
+
+func TestRoleService_ChangeRole_Errors(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	fakeRepo.users["admin@example.com"] = &models.User{ID: 1, Email: "admin@example.com", Role: models.RoleAdmin}
+	roleRepo := &fakeRoleRepo{userRepo: fakeRepo}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	roleSvc := service.NewRoleService(logger, fakeTxManager{}, fakeRepo, roleRepo, newFakeRefreshRepo())
+	ctx := context.Background()
+
+	_, err := roleSvc.ChangeRole(ctx, 1, 1, models.RoleEmployee, "")
+	assert.ErrorIs(t, err, service.ErrSelfRoleChange)
+	_, err = roleSvc.ChangeRole(ctx, 1, 2, models.Role("root"), "")
+	assert.ErrorIs(t, err, service.ErrInvalidRole)
+	_, err = roleSvc.ChangeRole(ctx, 1, 42, models.RoleFinance, "")
+	assert.ErrorIs(t, err, service.ErrUserNotFound)
+	_, err = roleSvc.ListRoleChanges(ctx, 42)
+	assert.ErrorIs(t, err, service.ErrUserNotFound)
+	assert.Empty(t, roleRepo.changes)
+	assert.Equal(t, models.RoleAdmin, fakeRepo.users["admin@example.com"].Role)
+}
+
+// newThrottledAuthService создаёт AuthService с заданной защитой от перебора паролей
+func newThrottledAuthService(userRepo *fakeUserRepo, attempts storage.LoginAttemptStorage, opts service.LoginThrottleOptions) *service.AuthService {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	return service.NewAuthService(logger, fakeTxManager{}, userRepo, newFakeLedgerRepo(userRepo), newFakeTokenRepo(), newFakeRefreshRepo(), attempts, newFakeTwoFactorRepo(), newFakeIdentityRepo(), newFakeSessionRepo(), &fakeMailer{}, password.NewBcryptHasher(bcrypt.MinCost), security.NewHMACKeySet("testsecret"), service.AuthOptions{
+		TokenTTL:        15 * time.Minute,
+		RefreshTokenTTL: 24 * time.Hour,
+		Throttle:        opts,
+	})
+}
+
+// newVictimUserRepo создаёт репозиторий с одним пользователем victim@example.com и паролем password123
+func newVictimUserRepo(t *testing.T) *fakeUserRepo {
+	fakeRepo := newFakeUserRepo()
+	hashed, err := bcrypt.GenerateFromPassword([]byte("password123"), bcrypt.MinCost)
+	assert.NoError(t, err)
+	fakeRepo.users["victim@example.com"] = &models.User{ID: 1, Email: "victim@example.com", PassHash: hashed}
+	return fakeRepo
+}
+
+func TestAuthService_Login_ExponentialBackoff(t *testing.T) {
+	attempts := storage.NewMemoryLoginAttemptStorage()
+	authSvc := newThrottledAuthService(newVictimUserRepo(t), attempts, service.LoginThrottleOptions{
+		Account:   service.ThrottlePolicy{FreeAttempts: 2},
+		IP:        service.ThrottlePolicy{FreeAttempts: 100},
+		Window:    time.Hour,
+		BaseDelay: time.Second,
+		MaxDelay:  time.Minute,
+	})
+	ctx := context.Background()
+
+	// Бесплатные попытки не блокируют
+	for i := 0; i < 2; i++ {
+		_, err := authSvc.Login(ctx, "victim@example.com", "wrong-password", "", "10.0.0.1")
+		assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	}
+	// Третья неудача включает задержку: следующая попытка отклоняется даже с верным паролем
+	_, err := authSvc.Login(ctx, "victim@example.com", "wrong-password", "", "10.0.0.2")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	_, err = authSvc.Login(ctx, "Victim@example.com", "password123", "", "10.0.0.3")
+	var tooMany *service.TooManyAttemptsError
+	assert.ErrorAs(t, err, &tooMany, "Lock applies to the account regardless of IP and email case")
+	assert.ErrorIs(t, err, service.ErrTooManyAttempts)
+	assert.True(t, tooMany.RetryAfter > 0 && tooMany.RetryAfter <= time.Second)
+
+	// Задержка удваивается: 5-я неудача подряд — 4 секунды
+	assert.NoError(t, attempts.ResetLoginAttempts(ctx, "account:victim@example.com"))
+	for i := 0; i < 4; i++ {
+		_, _, err = attempts.ReserveLoginAttempt(ctx, "account:victim@example.com", time.Now(), time.Now().Add(-time.Hour), 0, time.Time{})
+		assert.NoError(t, err)
+	}
+	_, err = authSvc.Login(ctx, "victim@example.com", "wrong-password", "", "")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	attempt, err := attempts.GetLoginAttempt(ctx, "account:victim@example.com")
+	assert.NoError(t, err)
+	assert.Equal(t, 5, attempt.Failures)
+	assert.WithinDuration(t, time.Now().Add(4*time.Second), attempt.LockedUntil, time.Second)
+}
+
+func TestAuthService_Login_LockoutAndReset(t *testing.T) {
+	attempts := storage.NewMemoryLoginAttemptStorage()
+	authSvc := newThrottledAuthService(newVictimUserRepo(t), attempts, service.LoginThrottleOptions{
+		Account:         service.ThrottlePolicy{MaxFailures: 3},
+		Window:          time.Hour,
+		LockoutDuration: 15 * time.Minute,
+	})
+	ctx := context.Background()
+
+	// Успешный вход сбрасывает счётчик аккаунта
+	for i := 0; i < 2; i++ {
+		_, err := authSvc.Login(ctx, "victim@example.com", "wrong-password", "", "")
+		assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	}
+	_, err := authSvc.Login(ctx, "victim@example.com", "password123", "", "")
+	assert.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		_, err := authSvc.Login(ctx, "victim@example.com", "wrong-password", "", "")
+		assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	}
+	_, err = authSvc.Login(ctx, "victim@example.com", "password123", "", "")
+	var tooMany *service.TooManyAttemptsError
+	assert.ErrorAs(t, err, &tooMany)
+	assert.InDelta(t, (15 * time.Minute).Seconds(), tooMany.RetryAfter.Seconds(), 5)
+}
+
+func TestAuthService_Login_LocksClientIP(t *testing.T) {
+	authSvc := newThrottledAuthService(newVictimUserRepo(t), storage.NewMemoryLoginAttemptStorage(), service.LoginThrottleOptions{
+		Account:         service.ThrottlePolicy{MaxFailures: 100},
+		IP:              service.ThrottlePolicy{MaxFailures: 3},
+		Window:          time.Hour,
+		LockoutDuration: time.Minute,
+	})
+	ctx := context.Background()
+
+	// Перебор по разным (в том числе несуществующим) аккаунтам с одного адреса
+	for i := 0; i < 3; i++ {
+		_, err := authSvc.Login(ctx, fmt.Sprintf("user%d@example.com", i), "password123", "", "10.0.0.1")
+		assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	}
+	_, err := authSvc.Login(ctx, "victim@example.com", "password123", "", "10.0.0.1")
+	assert.ErrorIs(t, err, service.ErrTooManyAttempts)
+
+	// С другого адреса аккаунт доступен
+	_, err = authSvc.Login(ctx, "victim@example.com", "password123", "", "10.0.0.2")
+	assert.NoError(t, err)
+}
+
+// slowCountingHasher считает проверки пароля и замедляет их, чтобы параллельные входы пересекались
+type slowCountingHasher struct {
+	password.Hasher
+	verifies atomic.Int32
+}
+
+func (h *slowCountingHasher) Verify(pass string, encoded []byte) (bool, error) {
+	h.verifies.Add(1)
+	time.Sleep(20 * time.Millisecond)
+	return h.Hasher.Verify(pass, encoded)
+}
+
+// syncUserRepo делает чтение fakeUserRepo по email безопасным для параллельных входов
+type syncUserRepo struct {
+	*fakeUserRepo
+	mu sync.Mutex
+}
+
+func (r *syncUserRepo) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.fakeUserRepo.GetUserByEmail(ctx, email)
+}
+
+func TestAuthService_Login_ParallelAttemptsRespectLockout(t *testing.T) {
+	const maxFailures = 3
+	victims := newVictimUserRepo(t)
+	userRepo := &syncUserRepo{fakeUserRepo: victims}
+	hasher := &slowCountingHasher{Hasher: password.NewBcryptHasher(bcrypt.MinCost)}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	authSvc := service.NewAuthService(logger, fakeTxManager{}, userRepo, newFakeLedgerRepo(victims), newFakeTokenRepo(), newFakeRefreshRepo(),
+		storage.NewMemoryLoginAttemptStorage(), newFakeTwoFactorRepo(), newFakeIdentityRepo(), newFakeSessionRepo(), &fakeMailer{}, hasher, security.NewHMACKeySet("testsecret"), service.AuthOptions{
+			TokenTTL:        15 * time.Minute,
+			RefreshTokenTTL: 24 * time.Hour,
+			Throttle: service.LoginThrottleOptions{
+				Account:         service.ThrottlePolicy{MaxFailures: maxFailures},
+				IP:              service.ThrottlePolicy{FreeAttempts: 100},
+				Window:          time.Hour,
+				LockoutDuration: 15 * time.Minute,
+			},
+		})
+	ctx := context.Background()
+
+	// Пачка параллельных попыток не успевает увидеть блокировку, поставленную после сравнения пароля
+	const attempts = 20
+	start := make(chan struct{})
+	errs := make(chan error, attempts)
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			_, err := authSvc.Login(ctx, "victim@example.com", "wrong-password", "", fmt.Sprintf("10.0.0.%d", i))
+			errs <- err
+		}()
+	}
+	close(start)
+	wg.Wait()
+	close(errs)
+
+	invalid := 0
+	for err := range errs {
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			invalid++
+			continue
+		}
+		assert.ErrorIs(t, err, service.ErrTooManyAttempts)
+	}
+	assert.LessOrEqual(t, int(hasher.verifies.Load()), maxFailures, "Only MaxFailures attempts reach the password check")
+	assert.Equal(t, int(hasher.verifies.Load()), invalid)
+
+	_, err := authSvc.Login(ctx, "victim@example.com", "password123", "", "10.0.1.1")
+	assert.ErrorIs(t, err, service.ErrTooManyAttempts)
+}
+
+func TestAuthService_Login_UpgradesLegacyHash(t *testing.T) {
+	fakeRepo := newVictimUserRepo(t) // хэш bcrypt
+	hasher, err := password.New(config.PasswordConfig{
+		Algorithm:         password.AlgorithmArgon2id,
+		Argon2Memory:      1024,
+		Argon2Iterations:  1,
+		Argon2Parallelism: 1,
+		Argon2SaltLength:  16,
+		Argon2KeyLength:   32,
+	})
+	assert.NoError(t, err)
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	authSvc := service.NewAuthService(logger, fakeTxManager{}, fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), newFakeRefreshRepo(),
+		storage.NewMemoryLoginAttemptStorage(), newFakeTwoFactorRepo(), newFakeIdentityRepo(), newFakeSessionRepo(), &fakeMailer{}, hasher, security.NewHMACKeySet("testsecret"), service.AuthOptions{TokenTTL: time.Minute})
+	ctx := context.Background()
+
+	// Неверный пароль хэш не меняет
+	_, err = authSvc.Login(ctx, "victim@example.com", "wrong-password", "", "")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	assert.True(t, strings.HasPrefix(string(fakeRepo.users["victim@example.com"].PassHash), "$2a$"))
+
+	_, err = authSvc.Login(ctx, "victim@example.com", "password123", "", "")
+	assert.NoError(t, err)
+	upgraded := fakeRepo.users["victim@example.com"].PassHash
+	assert.True(t, strings.HasPrefix(string(upgraded), "$argon2id$"), string(upgraded))
+
+	// Пароль подходит к новому хэшу, повторный вход его не меняет
+	_, err = authSvc.Login(ctx, "victim@example.com", "password123", "", "")
+	assert.NoError(t, err)
+	assert.Equal(t, upgraded, fakeRepo.users["victim@example.com"].PassHash)
+}
+
+// tokenFromMail извлекает одноразовый токен из письма: он стоит отдельной строкой после инструкции
+func tokenFromMail(t *testing.T, msg mailer.Message) string {
+	t.Helper()
+	for _, line := range strings.Split(msg.Body, "\n") {
+		if len(line) == 43 && !strings.Contains(line, " ") {
+			return line
+		}
+	}
+	t.Fatalf("email %q contains no token", msg.Subject)
+	return ""
+}
+
+func TestAuthService_ResetPassword_RevokesSessions(t *testing.T) {
+	fakeRepo := newVictimUserRepo(t)
+	refreshRepo := newFakeRefreshRepo()
+	m := &fakeMailer{}
+	authSvc := newTestAuthService(fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), refreshRepo, m, false)
+	ctx := context.Background()
+
+	pair, err := authSvc.Login(ctx, "victim@example.com", "password123", "laptop", "")
+	assert.NoError(t, err)
+	issuedAt := time.Now().Add(-time.Second)
+
+	// Для неизвестного email ответ тот же, но письмо не отправляется
+	assert.NoError(t, authSvc.RequestPasswordReset(ctx, "nobody@example.com"))
+	assert.Empty(t, m.sent)
+
+	assert.NoError(t, authSvc.RequestPasswordReset(ctx, "victim@example.com"))
+	assert.NoError(t, authSvc.RequestPasswordReset(ctx, "victim@example.com"))
+	assert.Len(t, m.sent, 2)
+	assert.Equal(t, "victim@example.com", m.sent[0].To)
+	older, token := tokenFromMail(t, m.sent[0]), tokenFromMail(t, m.sent[1])
+
+	assert.ErrorIs(t, authSvc.ResetPassword(ctx, "wrong-token", "newpassword"), service.ErrInvalidResetToken)
+	assert.NoError(t, authSvc.ResetPassword(ctx, token, "newpassword"))
+
+	// Все сессии завершены
+	assert.ErrorIs(t, authSvc.CheckAccessToken(ctx, 1, jwtmiddleware.TokenInfo{ID: "jti-1", IssuedAt: issuedAt}), jwtmiddleware.ErrTokenRevoked)
+	assert.Equal(t, 0, refreshRepo.activeRefreshTokens(1))
+	_, err = authSvc.Refresh(ctx, pair.Tokens.RefreshToken)
+	assert.ErrorIs(t, err, service.ErrInvalidRefreshToken)
+
+	// Токен одноразовый, ранее выданные токены сброса тоже больше не действуют
+	assert.ErrorIs(t, authSvc.ResetPassword(ctx, token, "anotherpassword"), service.ErrInvalidResetToken)
+	assert.ErrorIs(t, authSvc.ResetPassword(ctx, older, "anotherpassword"), service.ErrInvalidResetToken)
+
+	_, err = authSvc.Login(ctx, "victim@example.com", "password123", "", "")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	_, err = authSvc.Login(ctx, "victim@example.com", "newpassword", "", "")
+	assert.NoError(t, err)
+}
+
+func TestAuthService_RequestPasswordReset_SendsAfterCommit(t *testing.T) {
+	fakeRepo := newVictimUserRepo(t)
+	tokenRepo := newFakeTokenRepo()
+	m := &fakeMailer{}
+	newAuthService := func(txManager storage.TxManager) *service.AuthService {
+		logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+		return service.NewAuthService(logger, txManager, fakeRepo, newFakeLedgerRepo(fakeRepo), tokenRepo, newFakeRefreshRepo(),
+			storage.NewMemoryLoginAttemptStorage(), newFakeTwoFactorRepo(), newFakeIdentityRepo(), newFakeSessionRepo(), m, password.NewBcryptHasher(bcrypt.MinCost), security.NewHMACKeySet("testsecret"), service.AuthOptions{
+				TokenTTL:         time.Minute,
+				PasswordResetTTL: time.Hour,
+			})
+	}
+	ctx := context.Background()
+
+	// Транзакция повторена после конфликта сериализации — письмо одно
+	authSvc := newAuthService(retryingTxManager{attempts: 2})
+	assert.NoError(t, authSvc.RequestPasswordReset(ctx, "victim@example.com"))
+	assert.Len(t, m.sent, 1)
+	// токен из письма сохранён
+	assert.NoError(t, newAuthService(fakeTxManager{}).ResetPassword(ctx, tokenFromMail(t, m.sent[0]), "newpassword"))
+
+	// Токен не сохранён — письма нет
+	authSvc = newAuthService(retryingTxManager{attempts: 1, commitErr: errors.New("commit failed")})
+	assert.Error(t, authSvc.RequestPasswordReset(ctx, "victim@example.com"))
+	assert.Len(t, m.sent, 1)
+}
+
+func TestAuthService_ResetPassword_LiftsAccountLockout(t *testing.T) {
+	fakeRepo := newVictimUserRepo(t)
+	m := &fakeMailer{}
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	authSvc := service.NewAuthService(logger, fakeTxManager{}, fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), newFakeRefreshRepo(),
+		storage.NewMemoryLoginAttemptStorage(), newFakeTwoFactorRepo(), newFakeIdentityRepo(), newFakeSessionRepo(), m, password.NewBcryptHasher(bcrypt.MinCost), security.NewHMACKeySet("testsecret"), service.AuthOptions{
+			TokenTTL:         time.Minute,
+			PasswordResetTTL: time.Hour,
+			Throttle: service.LoginThrottleOptions{
+				Account:         service.ThrottlePolicy{MaxFailures: 1},
+				IP:              service.ThrottlePolicy{FreeAttempts: 100},
+				Window:          time.Hour,
+				LockoutDuration: time.Hour,
+			},
+		})
+	ctx := context.Background()
+
+	_, err := authSvc.Login(ctx, "victim@example.com", "wrong-password", "", "")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	_, err = authSvc.Login(ctx, "victim@example.com", "password123", "", "")
+	assert.ErrorIs(t, err, service.ErrTooManyAttempts)
+
+	assert.NoError(t, authSvc.RequestPasswordReset(ctx, "victim@example.com"))
+	assert.NoError(t, authSvc.ResetPassword(ctx, tokenFromMail(t, m.sent[0]), "newpassword"))
+
+	_, err = authSvc.Login(ctx, "victim@example.com", "newpassword", "", "")
+	assert.NoError(t, err)
+}
+
+func TestAuthService_ChangePassword(t *testing.T) {
+	fakeRepo := newVictimUserRepo(t)
+	refreshRepo := newFakeRefreshRepo()
+	authSvc := newTestAuthService(fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), refreshRepo, &fakeMailer{}, false)
+	ctx := context.Background()
+
+	_, err := authSvc.Login(ctx, "victim@example.com", "password123", "laptop", "")
+	assert.NoError(t, err)
+
+	assert.ErrorIs(t, authSvc.ChangePassword(ctx, 1, "wrong-password", "newpassword"), service.ErrWrongPassword)
+	assert.Equal(t, 1, refreshRepo.activeRefreshTokens(1), "Failed change must not end sessions")
+
+	assert.NoError(t, authSvc.ChangePassword(ctx, 1, "password123", "newpassword"))
+	assert.Equal(t, 0, refreshRepo.activeRefreshTokens(1))
+	assert.ErrorIs(t, authSvc.CheckAccessToken(ctx, 1, jwtmiddleware.TokenInfo{ID: "jti-1", IssuedAt: time.Now().Add(-time.Second)}), jwtmiddleware.ErrTokenRevoked)
+
+	_, err = authSvc.Login(ctx, "victim@example.com", "newpassword", "", "")
+	assert.NoError(t, err)
+}
+
+// newTwoFactorAuthService создаёт AuthService для victim@example.com (роль employee) с настроенным TOTP
+func newTwoFactorAuthService(t *testing.T) (*service.AuthService, *fakeTwoFactorRepo, *fakeRefreshRepo) {
+	fakeRepo := newVictimUserRepo(t)
+	fakeRepo.users["victim@example.com"].Role = models.RoleEmployee
+	twoFactorRepo := newFakeTwoFactorRepo()
+	refreshRepo := newFakeRefreshRepo()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	authSvc := service.NewAuthService(logger, fakeTxManager{}, fakeRepo, newFakeLedgerRepo(fakeRepo), newFakeTokenRepo(), refreshRepo,
+		storage.NewMemoryLoginAttemptStorage(), twoFactorRepo, newFakeIdentityRepo(), newFakeSessionRepo(), &fakeMailer{}, password.NewBcryptHasher(bcrypt.MinCost), security.NewHMACKeySet("testsecret"), service.AuthOptions{
+			TokenTTL:        time.Minute,
+			RefreshTokenTTL: time.Hour,
+			TwoFactor:       service.TwoFactorOptions{Issuer: "Avito shop", ChallengeTTL: time.Minute, Skew: 1},
+		})
+	return authSvc, twoFactorRepo, refreshRepo
+}
+
+func TestAuthService_TwoFactor_EnrollAndLogin(t *testing.T) {
+	authSvc, twoFactorRepo, refreshRepo := newTwoFactorAuthService(t)
+	ctx := context.Background()
+
+	before, err := authSvc.Login(ctx, "victim@example.com", "password123", "laptop", "")
+	assert.NoError(t, err)
+	assert.NotNil(t, before.Tokens, "Second factor is not asked before enrollment")
+
+	enrollment, err := authSvc.EnrollTwoFactor(ctx, 1)
+	assert.NoError(t, err)
+	assert.Contains(t, enrollment.ProvisioningURI, "otpauth://totp/")
+	secret := twoFactorRepo.secrets[1].Secret
+	assert.Equal(t, totp.EncodeSecret(secret), enrollment.Secret)
+
+	_, err = authSvc.ConfirmTwoFactor(ctx, 1, "000000")
+	assert.ErrorIs(t, err, service.ErrInvalidTwoFactorCode)
+	step := totp.Step(time.Now())
+	recoveryCodes, err := authSvc.ConfirmTwoFactor(ctx, 1, totp.Code(secret, step))
+	assert.NoError(t, err)
+	assert.Len(t, recoveryCodes, 10)
+	assert.Equal(t, 0, refreshRepo.activeRefreshTokens(1), "Sessions without second factor are revoked")
+	_, err = authSvc.EnrollTwoFactor(ctx, 1)
+	assert.ErrorIs(t, err, service.ErrTwoFactorAlreadyEnabled)
+
+	result, err := authSvc.Login(ctx, "victim@example.com", "password123", "laptop", "")
+	assert.NoError(t, err)
+	assert.Nil(t, result.Tokens)
+	assert.NotNil(t, result.Challenge)
+	assert.False(t, result.Challenge.SetupRequired)
+
+	// Код подтверждения уже использован; неверный код не расходует токен ожидания
+	_, err = authSvc.VerifyTwoFactor(ctx, result.Challenge.Token, totp.Code(secret, step), "laptop", "")
+	assert.ErrorIs(t, err, service.ErrInvalidTwoFactorCode)
+	pair, err := authSvc.VerifyTwoFactor(ctx, result.Challenge.Token, totp.Code(secret, step+1), "laptop", "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, pair.AccessToken)
+
+	// Токен ожидания одноразовый
+	_, err = authSvc.VerifyTwoFactor(ctx, result.Challenge.Token, totp.Code(secret, step+1), "laptop", "")
+	assert.ErrorIs(t, err, service.ErrInvalidChallengeToken)
+
+	// Код восстановления принимается без учёта регистра и дефисов, но только один раз
+	result, err = authSvc.Login(ctx, "victim@example.com", "password123", "laptop", "")
+	assert.NoError(t, err)
+	_, err = authSvc.VerifyTwoFactor(ctx, result.Challenge.Token, strings.ToLower(strings.ReplaceAll(recoveryCodes[0], "-", "")), "laptop", "")
+	assert.NoError(t, err)
+	result, err = authSvc.Login(ctx, "victim@example.com", "password123", "laptop", "")
+	assert.NoError(t, err)
+	_, err = authSvc.VerifyTwoFactor(ctx, result.Challenge.Token, recoveryCodes[0], "laptop", "")
+	assert.ErrorIs(t, err, service.ErrInvalidTwoFactorCode)
+
+	assert.NoError(t, authSvc.DisableTwoFactor(ctx, 1, recoveryCodes[1]))
+	result, err = authSvc.Login(ctx, "victim@example.com", "password123", "laptop", "")
+	assert.NoError(t, err)
+	assert.NotNil(t, result.Tokens)
+}
+
+func TestAuthService_TwoFactor_RequiredByRole(t *testing.T) {
+	authSvc, twoFactorRepo, _ := newTwoFactorAuthService(t)
+	ctx := context.Background()
+
+	before, err := authSvc.Login(ctx, "victim@example.com", "password123", "laptop", "")
+	assert.NoError(t, err)
+	assert.ErrorIs(t, authSvc.SetTwoFactorRequired(ctx, 2, models.Role("root"), true), service.ErrInvalidRole)
+	assert.NoError(t, authSvc.SetTwoFactorRequired(ctx, 2, models.RoleEmployee, true))
+
+	// Сессия, начатая до требования, не продлевается
+	_, err = authSvc.Refresh(ctx, before.Tokens.RefreshToken)
+	assert.ErrorIs(t, err, service.ErrTwoFactorRequired)
+
+	result, err := authSvc.Login(ctx, "victim@example.com", "password123", "laptop", "")
+	assert.NoError(t, err)
+	assert.NotNil(t, result.Challenge)
+	assert.True(t, result.Challenge.SetupRequired)
+	_, err = authSvc.VerifyTwoFactor(ctx, result.Challenge.Token, "123456", "laptop", "")
+	assert.ErrorIs(t, err, service.ErrInvalidChallengeToken, "Setup challenge cannot be used to log in")
+
+	_, err = authSvc.BeginTwoFactorSetup(ctx, result.Challenge.Token)
+	assert.NoError(t, err)
+	secret := twoFactorRepo.secrets[1].Secret
+	step := totp.Step(time.Now())
+	pair, recoveryCodes, err := authSvc.ConfirmTwoFactorSetup(ctx, result.Challenge.Token, totp.Code(secret, step), "laptop", "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, pair.AccessToken)
+	assert.Len(t, recoveryCodes, 10)
+
+	_, err = authSvc.Refresh(ctx, pair.RefreshToken)
+	assert.NoError(t, err)
+	err = authSvc.DisableTwoFactor(ctx, 1, totp.Code(secret, step+1))
+	assert.ErrorIs(t, err, service.ErrTwoFactorRequired)
+}
+
+func TestPersonalTokenService_CreateAndAuthenticate(t *testing.T) {
+	fakeRepo := newFakeUserRepo()
+	fakeRepo.users["bot-owner@example.com"] = &models.User{ID: 1, Email: "bot-owner@example.com", Role: models.RoleFinance}
+	tokenRepo := newFakePersonalTokenRepo()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	tokenSvc := service.NewPersonalTokenService(logger, fakeRepo, tokenRepo)
+	ctx := context.Background()
+
+	pt, token, err := tokenSvc.CreatePersonalToken(ctx, 1, "  kudos bot ", []models.Scope{models.ScopeCoinsSend, models.ScopeInfoRead}, nil)
+	assert.NoError(t, err)
+	assert.True(t, strings.HasPrefix(token, models.PersonalTokenPrefix))
+	assert.Equal(t, "kudos bot", pt.Name)
+	// В БД хранится только хэш.
+	assert.NotContains(t, string(pt.TokenHash), token)
+
+	identity, err := tokenSvc.AuthenticatePersonalToken(ctx, token)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), identity.UserID)
+	assert.Equal(t, models.RoleFinance, identity.Role)
+	assert.Equal(t, []models.Scope{models.ScopeCoinsSend, models.ScopeInfoRead}, identity.Scopes)
+	// Время использования обновляется не чаще раза в минуту
+	_, err = tokenSvc.AuthenticatePersonalToken(ctx, token)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, tokenRepo.touched)
+
+	_, err = tokenSvc.AuthenticatePersonalToken(ctx, token+"x")
+	assert.ErrorIs(t, err, jwtmiddleware.ErrInvalidToken)
+
+	tokens, err := tokenSvc.ListPersonalTokens(ctx, 1)
+	assert.NoError(t, err)
+	assert.Len(t, tokens, 1)
+	assert.ErrorIs(t, tokenSvc.RevokePersonalToken(ctx, 2, pt.ID), service.ErrPersonalTokenNotFound, "Only the owner can revoke a token")
+	assert.NoError(t, tokenSvc.RevokePersonalToken(ctx, 1, pt.ID))
+	_, err = tokenSvc.AuthenticatePersonalToken(ctx, token)
+	assert.ErrorIs(t, err, jwtmiddleware.ErrInvalidToken)
+	assert.ErrorIs(t, tokenSvc.RevokePersonalToken(ctx, 1, pt.ID), service.ErrPersonalTokenNotFound)
+}
+
+func TestPersonalTokenService_Create_Errors(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	tokenRepo := newFakePersonalTokenRepo()
+	tokenSvc := service.NewPersonalTokenService(logger, newFakeUserRepo(), tokenRepo)
+	ctx := context.Background()
+
+	_, _, err := tokenSvc.CreatePersonalToken(ctx, 1, "bot", nil, nil)
+	assert.ErrorIs(t, err, service.ErrInvalidScope)
+	_, _, err = tokenSvc.CreatePersonalToken(ctx, 1, "bot", []models.Scope{"admin"}, nil)
+	assert.ErrorIs(t, err, service.ErrInvalidScope)
+	_, _, err = tokenSvc.CreatePersonalToken(ctx, 1, "bot", []models.Scope{models.ScopeMerchBuy, models.ScopeMerchBuy}, nil)
+	assert.ErrorIs(t, err, service.ErrInvalidScope)
+	past := time.Now().Add(-time.Minute)
+	_, _, err = tokenSvc.CreatePersonalToken(ctx, 1, "bot", []models.Scope{models.ScopeMerchBuy}, &past)
+	assert.ErrorIs(t, err, service.ErrInvalidTokenExpiry)
+	assert.Empty(t, tokenRepo.tokens)
+}
+
+// fakeDirectory — провайдер учётных записей наподобие LDAP: пароли хранятся в памяти.
+type fakeDirectory struct {
+	accounts map[string]fakeDirectoryAccount // ключ — логин
+	err      error
+}
+
+type fakeDirectoryAccount struct {
+	password string
+	identity identity.Identity
+}
+
+func (f *fakeDirectory) Name() string {
+	return identity.ProviderLDAP
+}
+
+func (f *fakeDirectory) Authenticate(ctx context.Context, username, password string) (*identity.Identity, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	account, ok := f.accounts[username]
+	if !ok {
+		return nil, identity.ErrUnknownUser
+	}
+	if account.password != password {
+		return nil, identity.ErrInvalidCredentials
+	}
+	ident := account.identity
+	return &ident, nil
+}
+
+// fakeOIDC — провайдер со входом через перенаправление; код обменивается на учётную запись из codes.
+type fakeOIDC struct {
+	codes map[string]identity.Identity
+}
+
+func (f *fakeOIDC) Name() string {
+	return identity.ProviderOIDC
+}
+
+func (f *fakeOIDC) AuthCodeURL(state string) string {
+	return "https://idp.example.com/authorize?state=" + state
+}
+
+func (f *fakeOIDC) Exchange(ctx context.Context, code, state string) (*identity.Identity, error) {
+	ident, ok := f.codes[code]
+	if !ok {
+		return nil, identity.ErrInvalidCredentials
+	}
+	return &ident, nil
+}
+
+// newIdentityAuthService создаёт AuthService с локальными паролями и провайдерами directory и oidc.
+func newIdentityAuthService(userRepo *fakeUserRepo, identityRepo *fakeIdentityRepo, directory *fakeDirectory, oidc *fakeOIDC, autoRegister bool) *service.AuthService {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	hasher := password.NewBcryptHasher(bcrypt.MinCost)
+	providers := service.IdentityProviders{
+		Password: []service.IdentityProvider{service.NewLocalIdentityProvider(logger, userRepo, hasher), directory},
+	}
+	if oidc != nil {
+		providers.Redirect = oidc
+	}
+	return service.NewAuthService(logger, fakeTxManager{}, userRepo, newFakeLedgerRepo(userRepo), newFakeTokenRepo(), newFakeRefreshRepo(),
+		storage.NewMemoryLoginAttemptStorage(), newFakeTwoFactorRepo(), identityRepo, newFakeSessionRepo(), &fakeMailer{}, hasher, security.NewHMACKeySet("testsecret"), service.AuthOptions{
+			TokenTTL:        15 * time.Minute,
+			RefreshTokenTTL: 24 * time.Hour,
+			AutoRegister:    autoRegister,
+			Identity:        providers,
+		})
+}
+
+func TestAuthService_Login_ProvisionsUserFromIdentityProvider(t *testing.T) {
+	userRepo := newFakeUserRepo()
+	identityRepo := newFakeIdentityRepo()
+	directory := &fakeDirectory{accounts: map[string]fakeDirectoryAccount{
+		"alice@corp.example.com": {password: "corp-secret", identity: identity.Identity{
+			Provider: identity.ProviderLDAP, Subject: "uid-alice", Email: "alice@corp.example.com", EmailVerified: true,
+		}},
+	}}
+	authSvc := newIdentityAuthService(userRepo, identityRepo, directory, nil, false)
+	ctx := context.Background()
+
+	result, err := authSvc.Login(ctx, "alice@corp.example.com", "corp-secret", "laptop", "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, result.Tokens.AccessToken)
+
+	user := userRepo.users["alice@corp.example.com"]
+	if assert.NotNil(t, user, "User is provisioned on first login") {
+		assert.True(t, user.EmailVerified)
+		assert.Empty(t, user.PassHash, "Provisioned user has no local password")
+		assert.Equal(t, service.InitialCoinGrant, user.CoinBalance)
+		assert.Equal(t, user.ID, identityRepo.links["ldap/uid-alice"])
+	}
 
-	// Проверяем ожидания sqlmock.
-	err = mock.ExpectationsWereMet()
-	assert.NoError(t, err, "sqlmock expectations should be met")
+	// Второй вход находит пользователя по связке, даже если email в каталоге изменился
+	account := directory.accounts["alice@corp.example.com"]
+	account.identity.Email = "alice.smith@corp.example.com"
+	directory.accounts["alice@corp.example.com"] = account
+	_, err = authSvc.Login(ctx, "alice@corp.example.com", "corp-secret", "laptop", "")
+	assert.NoError(t, err)
+	assert.Len(t, userRepo.users, 1)
+	assert.Equal(t, service.InitialCoinGrant, user.CoinBalance, "Signup grant is posted once")
+
+	_, err = authSvc.Login(ctx, "alice@corp.example.com", "wrong", "laptop", "")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+
+	// Локального пароля нет: сменить его можно только через сброс по email
+	err = authSvc.ChangePassword(ctx, user.ID, "", "new-password")
+	assert.ErrorIs(t, err, service.ErrWrongPassword)
 }
 
-func TestBuyService_Buy_InsufficientFunds(t *testing.T) {
-	db, mock, err := sqlmock.New()
+func TestAuthService_Login_IdentityProviderLinksExistingUser(t *testing.T) {
+	userRepo := newFakeUserRepo()
+	hash, err := bcrypt.GenerateFromPassword([]byte("shop-password"), bcrypt.MinCost)
 	assert.NoError(t, err)
-	defer db.Close()
+	userRepo.users["bob@corp.example.com"] = &models.User{ID: 1, Email: "bob@corp.example.com", PassHash: hash, EmailVerified: true}
+	identityRepo := newFakeIdentityRepo()
+	directory := &fakeDirectory{accounts: map[string]fakeDirectoryAccount{
+		"bob": {password: "corp-secret", identity: identity.Identity{
+			Provider: identity.ProviderLDAP, Subject: "uid-bob", Email: "bob@corp.example.com", EmailVerified: true,
+		}},
+		"mallory": {password: "corp-secret", identity: identity.Identity{
+			Provider: identity.ProviderLDAP, Subject: "uid-mallory", Email: "bob@corp.example.com",
+		}},
+	}}
+	authSvc := newIdentityAuthService(userRepo, identityRepo, directory, nil, false)
+	ctx := context.Background()
 
-	// Ожидаем вызов BeginTx и Commit не произойдет, а вместо этого будет Rollback.
-	mock.ExpectBegin()
-	mock.ExpectRollback()
+	// Неподтверждённый провайдером email не связывается с чужим аккаунтом
+	_, err = authSvc.Login(ctx, "mallory", "corp-secret", "laptop", "")
+	assert.ErrorIs(t, err, service.ErrEmailNotVerified)
+	assert.Empty(t, identityRepo.links)
 
-	fakeUserRepo := newFakeUserRepo()
-	fakeMerchRepo := newFakeMerchRepo()
-	fakeOrderRepo := newFakeOrderRepo()
+	_, err = authSvc.Login(ctx, "bob", "corp-secret", "laptop", "")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), identityRepo.links["ldap/uid-bob"])
 
-	// Пользователь с балансом 50, ID=1.
-	user := &models.User{
-		ID:          1,
-		Email:       "test@example.com",
-		PassHash:    []byte("hashed"),
-		CoinBalance: 50,
-	}
-	fakeUserRepo.users[user.Email] = user
+	// Локальный пароль подтверждённого аккаунта продолжает работать, неверный локальный пароль не проверяется в каталоге
+	_, err = authSvc.Login(ctx, "bob@corp.example.com", "shop-password", "laptop", "")
+	assert.NoError(t, err)
+	_, err = authSvc.Login(ctx, "bob@corp.example.com", "corp-secret", "laptop", "")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+}
 
-	// Мерч "t-shirt" с ценой 80.
-	fakeMerchRepo.merchs["t-shirt"] = &models.Merch{
-		ID:    1,
-		Name:  "t-shirt",
-		Price: 80,
+func TestAuthService_OIDCLogin_ResetsUnverifiedAccount(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	hasher := password.NewBcryptHasher(bcrypt.MinCost)
+	userRepo := newFakeUserRepo()
+	refreshRepo := newFakeRefreshRepo()
+	twoFactorRepo := newFakeTwoFactorRepo()
+	identityRepo := newFakeIdentityRepo()
+	oidc := &fakeOIDC{codes: map[string]identity.Identity{
+		"victim-code": {Provider: identity.ProviderOIDC, Subject: "sub-dave", Email: "dave@corp.example.com", EmailVerified: true},
+	}}
+	authSvc := service.NewAuthService(logger, fakeTxManager{}, userRepo, newFakeLedgerRepo(userRepo), newFakeTokenRepo(), refreshRepo,
+		storage.NewMemoryLoginAttemptStorage(), twoFactorRepo, identityRepo, newFakeSessionRepo(), &fakeMailer{}, hasher, security.NewHMACKeySet("testsecret"), service.AuthOptions{
+			TokenTTL:        15 * time.Minute,
+			RefreshTokenTTL: 24 * time.Hour,
+			Identity: service.IdentityProviders{
+				Password: []service.IdentityProvider{service.NewLocalIdentityProvider(logger, userRepo, hasher)},
+				Redirect: oidc,
+			},
+		})
+	ctx := context.Background()
+
+	// Кто-то заранее регистрирует чужой адрес, не подтверждая его, и входит с этим паролем
+	err := authSvc.Register(ctx, "dave@corp.example.com", "attacker-password")
+	assert.NoError(t, err)
+	user := userRepo.users["dave@corp.example.com"]
+	if !assert.NotNil(t, user) || !assert.False(t, user.EmailVerified) {
+		return
 	}
+	attacker, err := authSvc.Login(ctx, "dave@corp.example.com", "attacker-password", "laptop", "")
+	assert.NoError(t, err)
+	twoFactorRepo.secrets[user.ID] = &models.TwoFactor{UserID: user.ID, Secret: []byte("attacker-secret")}
 
-	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	buySvc := service.NewBuyService(logger, db, fakeUserRepo, fakeMerchRepo, fakeOrderRepo)
+	login, err := authSvc.BeginOIDCLogin(ctx)
+	assert.NoError(t, err)
+	_, err = authSvc.CompleteOIDCLogin(ctx, "victim-code", login.State, login.State, "laptop", "")
+	assert.NoError(t, err)
 
-	err = buySvc.Buy(context.Background(), user.ID, "t-shirt")
-	assert.Error(t, err, "Buy should fail due to insufficient funds")
+	assert.Equal(t, user.ID, identityRepo.links["oidc/sub-dave"])
+	assert.True(t, user.EmailVerified)
+	assert.Empty(t, user.PassHash, "Password set before verification is discarded")
+	assert.NotContains(t, twoFactorRepo.secrets, user.ID, "Second factor set before verification is discarded")
+	assert.Contains(t, refreshRepo.validAfter, user.ID, "Access tokens issued before linking are revoked")
 
-	err = mock.ExpectationsWereMet()
-	assert.NoError(t, err, "sqlmock expectations should be met")
+	_, err = authSvc.Login(ctx, "dave@corp.example.com", "attacker-password", "laptop", "")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+	_, err = authSvc.Refresh(ctx, attacker.Tokens.RefreshToken)
+	assert.ErrorIs(t, err, service.ErrInvalidRefreshToken)
 }
 
-func TestSendCoinService_Success(t *testing.T) {
-	// Используем sqlmock для создания фиктивной БД.
-	db, mock, err := sqlmock.New()
+func TestAuthService_Login_IdentityProviderErrors(t *testing.T) {
+	userRepo := newFakeUserRepo()
+	directory := &fakeDirectory{accounts: map[string]fakeDirectoryAccount{}}
+	authSvc := newIdentityAuthService(userRepo, newFakeIdentityRepo(), directory, nil, true)
+	ctx := context.Background()
+
+	// Пользователя не знает ни один провайдер — срабатывает AutoRegister
+	_, err := authSvc.Login(ctx, "new@example.com", "password123", "laptop", "")
 	assert.NoError(t, err)
-	defer db.Close()
+	assert.NotEmpty(t, userRepo.users["new@example.com"].PassHash)
 
-	// Ожидаем вызов BeginTx и Commit.
-	mock.ExpectBegin()
-	mock.ExpectCommit()
+	// Аккаунт без локального пароля не перехватывается через AutoRegister
+	userRepo.users["sso@example.com"] = &models.User{ID: 2, Email: "sso@example.com", PassHash: []byte{}}
+	_, err = authSvc.Login(ctx, "sso@example.com", "password123", "laptop", "")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
 
-	// Создаем фиктивный репозиторий пользователей.
-	fakeUserRepo := newFakeUserRepo()
-	fakeCoinTxRepo := newFakeCoinTxRepo()
+	directory.err = errors.New("ldap: connection refused")
+	_, err = authSvc.Login(ctx, "sso@example.com", "password123", "laptop", "")
+	assert.Error(t, err)
+	assert.NotErrorIs(t, err, service.ErrInvalidCredentials)
+}
 
-	// Добавляем отправителя и получателя.
-	sender := &models.User{
-		ID:          1,
-		Email:       "sender@example.com",
-		PassHash:    []byte("hashed"),
-		CoinBalance: 1000,
+func TestAuthService_OIDCLogin(t *testing.T) {
+	userRepo := newFakeUserRepo()
+	identityRepo := newFakeIdentityRepo()
+	oidc := &fakeOIDC{codes: map[string]identity.Identity{
+		"good-code": {Provider: identity.ProviderOIDC, Subject: "sub-carol", Email: "carol@corp.example.com", EmailVerified: true},
+	}}
+	authSvc := newIdentityAuthService(userRepo, identityRepo, &fakeDirectory{}, oidc, false)
+	ctx := context.Background()
+
+	login, err := authSvc.BeginOIDCLogin(ctx)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, login.State)
+	assert.Equal(t, "https://idp.example.com/authorize?state="+login.State, login.URL)
+
+	_, err = authSvc.CompleteOIDCLogin(ctx, "good-code", login.State, "", "laptop", "")
+	assert.ErrorIs(t, err, service.ErrInvalidOIDCState)
+	_, err = authSvc.CompleteOIDCLogin(ctx, "good-code", login.State, login.State+"x", "laptop", "")
+	assert.ErrorIs(t, err, service.ErrInvalidOIDCState)
+	_, err = authSvc.CompleteOIDCLogin(ctx, "bad-code", login.State, login.State, "laptop", "")
+	assert.ErrorIs(t, err, service.ErrInvalidCredentials)
+
+	result, err := authSvc.CompleteOIDCLogin(ctx, "good-code", login.State, login.State, "laptop", "")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, result.Tokens.AccessToken)
+	user := userRepo.users["carol@corp.example.com"]
+	if assert.NotNil(t, user) {
+		assert.Equal(t, user.ID, identityRepo.links["oidc/sub-carol"])
 	}
-	receiver := &models.User{
-		ID:          2,
-		Email:       "receiver@example.com",
-		PassHash:    []byte("hashed"),
-		CoinBalance: 500,
+
+	disabled := newIdentityAuthService(newFakeUserRepo(), newFakeIdentityRepo(), &fakeDirectory{}, nil, false)
+	_, err = disabled.BeginOIDCLogin(ctx)
+	assert.ErrorIs(t, err, service.ErrIdentityProviderDisabled)
+}
+
+func newCatalogMerchRepo() *fakeMerchRepo {
+	repo := newFakeMerchRepo()
+	for _, m := range []models.Merch{
+		{ID: 1, Name: "t-shirt", Price: 80, Category: "clothing"},
+		{ID: 2, Name: "cup", Price: 20, Category: "accessories"},
+		{ID: 3, Name: "book", Price: 50, Category: "stationery"},
+		{ID: 4, Name: "pen", Price: 10, Category: "stationery"},
+		{ID: 5, Name: "powerbank", Price: 200, Category: "electronics"},
+		{ID: 6, Name: "hoody", Price: 300, Category: "clothing"},
+		{ID: 7, Name: "umbrella", Price: 200, Category: "accessories"},
+	} {
+		m.Available = true
+		repo.merchs[m.Name] = &m
 	}
-	fakeUserRepo.users[sender.Email] = sender
-	fakeUserRepo.users[receiver.Email] = receiver
+	return repo
+}
+
+func merchNames(items []*models.Merch) []string {
+	names := make([]string, 0, len(items))
+	for _, m := range items {
+		names = append(names, m.Name)
+	}
+	return names
+}
 
+func TestMerchService_ListMerch_FiltersAndSorts(t *testing.T) {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	sendCoinSvc := service.NewSendCoinService(logger, db, fakeUserRepo, fakeCoinTxRepo)
+	merchService := service.NewMerchService(logger, fakeTxManager{}, newCatalogMerchRepo(), service.MerchOptions{CatalogCacheTTL: time.Minute})
+	ctx := context.Background()
+	intPtr := func(v int) *int { return &v }
+
+	tests := []struct {
+		name   string
+		filter service.MerchFilter
+		want   []string
+	}{
+		{name: "default by name", filter: service.MerchFilter{}, want: []string{"book", "cup", "hoody", "pen", "powerbank", "t-shirt", "umbrella"}},
+		{name: "category", filter: service.MerchFilter{Category: "clothing", Sort: service.MerchSortNameDesc}, want: []string{"t-shirt", "hoody"}},
+		{name: "price range", filter: service.MerchFilter{MinPrice: intPtr(20), MaxPrice: intPtr(80), Sort: service.MerchSortPrice}, want: []string{"cup", "book", "t-shirt"}},
+		// при равной цене — по названию
+		{name: "price desc", filter: service.MerchFilter{MinPrice: intPtr(200), Sort: service.MerchSortPriceDesc}, want: []string{"hoody", "powerbank", "umbrella"}},
+		{name: "nothing found", filter: service.MerchFilter{Category: "food"}, want: []string{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := merchService.ListMerch(ctx, tt.filter)
+			if !assert.NoError(t, err) {
+				return
+			}
+			assert.Equal(t, tt.want, merchNames(page.Items))
+			assert.Empty(t, page.NextCursor)
+		})
+	}
 
-	// Перевод 100 монет от отправителя к получателю.
-	err = sendCoinSvc.SendCoin(context.Background(), sender.ID, receiver.Email, 100)
-	assert.NoError(t, err, "SendCoin should succeed with valid data")
+	_, err := merchService.ListMerch(ctx, service.MerchFilter{MinPrice: intPtr(100), MaxPrice: intPtr(50)})
+	assert.ErrorIs(t, err, service.ErrInvalidMerchFilter)
+	_, err = merchService.ListMerch(ctx, service.MerchFilter{Sort: "stock"})
+	assert.ErrorIs(t, err, service.ErrInvalidMerchFilter)
+}
 
-	// Проверяем, что баланс отправителя уменьшился, а получателя увеличился.
-	updatedSender, err := fakeUserRepo.GetUserByID(context.Background(), sender.ID)
+func TestMerchService_ListMerch_CursorPagination(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	merchService := service.NewMerchService(logger, fakeTxManager{}, newCatalogMerchRepo(), service.MerchOptions{CatalogCacheTTL: time.Minute})
+	ctx := context.Background()
+
+	// Страницы по цене не теряют и не повторяют товары с одинаковой ценой на границе страниц
+	var got []string
+	filter := service.MerchFilter{Sort: service.MerchSortPrice, Limit: 2}
+	for pages := 0; ; pages++ {
+		page, err := merchService.ListMerch(ctx, filter)
+		if !assert.NoError(t, err) || !assert.Less(t, pages, 10) {
+			return
+		}
+		assert.LessOrEqual(t, len(page.Items), 2)
+		got = append(got, merchNames(page.Items)...)
+		if page.NextCursor == "" {
+			break
+		}
+		filter.Cursor = page.NextCursor
+	}
+	assert.Equal(t, []string{"pen", "cup", "book", "t-shirt", "powerbank", "umbrella", "hoody"}, got)
+
+	first, err := merchService.ListMerch(ctx, service.MerchFilter{Sort: service.MerchSortPrice, Limit: 2})
 	assert.NoError(t, err)
-	updatedReceiver, err := fakeUserRepo.GetUserByEmail(context.Background(), receiver.Email)
+	// Курсор другого порядка сортировки и повреждённый курсор отклоняются
+	_, err = merchService.ListMerch(ctx, service.MerchFilter{Sort: service.MerchSortName, Cursor: first.NextCursor})
+	assert.ErrorIs(t, err, service.ErrInvalidCursor)
+	_, err = merchService.ListMerch(ctx, service.MerchFilter{Cursor: "not-a-cursor"})
+	assert.ErrorIs(t, err, service.ErrInvalidCursor)
+}
+
+func TestMerchService_CatalogCache(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	merchRepo := newCatalogMerchRepo()
+	merchService := service.NewMerchService(logger, fakeTxManager{}, merchRepo, service.MerchOptions{CatalogCacheTTL: time.Minute})
+	ctx := context.Background()
+
+	_, err := merchService.ListMerch(ctx, service.MerchFilter{})
 	assert.NoError(t, err)
-	assert.Equal(t, 900, updatedSender.CoinBalance, "Sender balance should be updated to 900")
-	assert.Equal(t, 600, updatedReceiver.CoinBalance, "Receiver balance should be updated to 600")
+	merch, err := merchService.GetMerch(ctx, "cup")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 20, merch.Price)
+	// Каталог загружен из БД один раз
+	assert.Equal(t, 1, merchRepo.listCalls)
+
+	// Изменение отданного товара не портит каталог в кэше
+	merch.Price = 1
+	merch, err = merchService.GetMerch(ctx, "cup")
+	if !assert.NoError(t, err) {
+		return
+	}
+	assert.Equal(t, 20, merch.Price)
 
-	err = mock.ExpectationsWereMet()
-	assert.NoError(t, err, "sqlmock expectations should be met")
+	_, err = merchService.GetMerch(ctx, "car")
+	assert.ErrorIs(t, err, service.ErrMerchNotFound)
+	assert.Equal(t, 1, merchRepo.listCalls)
 }
 
-func TestSendCoinService_SelfTransfer(t *testing.T) {
-	// Создаем фиктивную БД, хотя в этом тесте транзакция не дойдёт до вызова BeginTx.
-	db, mock, err := sqlmock.New()
+func TestMerchService_AdminChangesUpdateCatalog(t *testing.T) {
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	merchRepo := newCatalogMerchRepo()
+	merchService := service.NewMerchService(logger, fakeTxManager{}, merchRepo, service.MerchOptions{CatalogCacheTTL: time.Hour})
+	ctx := context.Background()
+	const managerID = 5
+
+	// Каталог загружен в кэш до изменений
+	_, err := merchService.ListMerch(ctx, service.MerchFilter{})
 	assert.NoError(t, err)
-	defer db.Close()
 
-	// Ожидаем вызов BeginTx и затем Rollback.
-	mock.ExpectBegin()
-	mock.ExpectRollback()
+	// Новый товар виден в каталоге сразу, цена записана в историю
+	err = merchService.CreateMerch(ctx, managerID, &models.Merch{Name: "scarf", Price: 150, Category: "clothing"})
+	assert.NoError(t, err)
+	merch, err := merchService.GetMerch(ctx, "scarf")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 150, merch.Price)
+	}
+	err = merchService.CreateMerch(ctx, managerID, &models.Merch{Name: "scarf", Price: 100})
+	assert.ErrorIs(t, err, service.ErrMerchAlreadyExists)
 
-	fakeUserRepo := newFakeUserRepo()
-	fakeCoinTxRepo := newFakeCoinTxRepo()
+	// Новая цена — новая запись истории; та же цена истории не меняет
+	merch, err = merchService.UpdateMerchPrice(ctx, managerID, "scarf", 120)
+	if assert.NoError(t, err) {
+		assert.Equal(t, 120, merch.Price)
+	}
+	_, err = merchService.UpdateMerchPrice(ctx, managerID, "scarf", 120)
+	assert.NoError(t, err)
+	merch, err = merchService.GetMerch(ctx, "scarf")
+	if assert.NoError(t, err) {
+		assert.Equal(t, 120, merch.Price)
+	}
+	prices, err := merchService.ListMerchPrices(ctx, "scarf")
+	assert.NoError(t, err)
+	if assert.Len(t, prices, 2) {
+		assert.Equal(t, 120, prices[0].Price)
+		assert.Equal(t, 150, prices[1].Price)
+		assert.Equal(t, int64(managerID), *prices[0].ChangedBy)
+	}
 
-	// Добавляем пользователя с балансом 1000.
-	user := &models.User{
-		ID:          1,
-		Email:       "user@example.com",
-		PassHash:    []byte("hashed"),
-		CoinBalance: 1000,
+	// Архивный товар пропадает из каталога, но остаётся в полном списке
+	merch, err = merchService.ArchiveMerch(ctx, managerID, "scarf")
+	if assert.NoError(t, err) {
+		assert.NotNil(t, merch.ArchivedAt)
 	}
-	fakeUserRepo.users[user.Email] = user
+	_, err = merchService.GetMerch(ctx, "scarf")
+	assert.ErrorIs(t, err, service.ErrMerchNotFound)
+	page, err := merchService.ListMerch(ctx, service.MerchFilter{Category: "clothing"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"hoody", "t-shirt"}, merchNames(page.Items))
+	all, err := merchService.ListAllMerch(ctx)
+	assert.NoError(t, err)
+	assert.Contains(t, merchNames(all), "scarf")
+
+	_, err = merchService.RestoreMerch(ctx, managerID, "scarf")
+	assert.NoError(t, err)
+	_, err = merchService.GetMerch(ctx, "scarf")
+	assert.NoError(t, err)
+
+	_, err = merchService.UpdateMerchPrice(ctx, managerID, "scarf", 0)
+	assert.ErrorIs(t, err, service.ErrInvalidPrice)
+	_, err = merchService.ArchiveMerch(ctx, managerID, "car")
+	assert.ErrorIs(t, err, service.ErrMerchNotFound)
+}
+
+func TestBuyService_Buy_ArchivedMerch(t *testing.T) {
+	fakeUserRepo := newFakeUserRepo()
+	fakeUserRepo.users["test@example.com"] = &models.User{ID: 1, Email: "test@example.com", CoinBalance: 1000, EmailVerified: true}
+	fakeMerchRepo := newFakeMerchRepo()
+	archivedAt := time.Now()
+	fakeMerchRepo.merchs["cup"] = &models.Merch{ID: 1, Name: "cup", Price: 20, ArchivedAt: &archivedAt}
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	sendCoinSvc := service.NewSendCoinService(logger, db, fakeUserRepo, fakeCoinTxRepo)
+	buySvc := service.NewBuyService(logger, fakeTxManager{}, fakeUserRepo, fakeMerchRepo, newFakeOrderRepo(), newFakeCoinTxRepo(), newFakeLedgerRepo(fakeUserRepo), nil, nil, nil, service.StockAlertOptions{})
 
-	// Пытаемся перевести монеты самому себе.
-	err = sendCoinSvc.SendCoin(context.Background(), user.ID, user.Email, 100)
-	assert.Error(t, err, "SendCoin should fail when transferring coins to self")
+	err := buySvc.Buy(context.Background(), 1, "cup", 1)
+	assert.ErrorIs(t, err, service.ErrMerchNotFound)
+	assert.Equal(t, 1000, fakeUserRepo.users["test@example.com"].CoinBalance)
+}
 
-	err = mock.ExpectationsWereMet()
-	assert.NoError(t, err, "sqlmock expectations should be met")
+func TestBuyService_Buy_OutOfStock(t *testing.T) {
+	fakeUserRepo := newFakeUserRepo()
+	fakeUserRepo.users["test@example.com"] = &models.User{ID: 1, Email: "test@example.com", CoinBalance: 1000, EmailVerified: true}
+	fakeMerchRepo := newFakeMerchRepo()
+	stock := 0
+	fakeMerchRepo.merchs["cup"] = &models.Merch{ID: 1, Name: "cup", Price: 20, Stock: &stock}
+	fakeOrderRepo := newFakeOrderRepo()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	buySvc := service.NewBuyService(logger, fakeTxManager{}, fakeUserRepo, fakeMerchRepo, fakeOrderRepo, newFakeCoinTxRepo(), newFakeLedgerRepo(fakeUserRepo), nil, nil, nil, service.StockAlertOptions{})
+
+	err := buySvc.Buy(context.Background(), 1, "cup", 1)
+	assert.ErrorIs(t, err, service.ErrOutOfStock)
+	assert.Equal(t, 1000, fakeUserRepo.users["test@example.com"].CoinBalance)
+	assert.Empty(t, fakeOrderRepo.orders[1])
+	assert.Equal(t, 0, *fakeMerchRepo.merchs["cup"].Stock)
 }
 
-func TestSendCoinService_InsufficientFunds(t *testing.T) {
-	db, mock, err := sqlmock.New()
+func TestBuyService_Buy_LowStockAlert(t *testing.T) {
+	fakeUserRepo := newFakeUserRepo()
+	fakeUserRepo.users["test@example.com"] = &models.User{ID: 1, Email: "test@example.com", CoinBalance: 1000, EmailVerified: true}
+	fakeMerchRepo := newFakeMerchRepo()
+	stock := 7
+	fakeMerchRepo.merchs["cup"] = &models.Merch{ID: 1, Name: "cup", Price: 20, Stock: &stock}
+	fakeMerchRepo.merchs["pen"] = &models.Merch{ID: 2, Name: "pen", Price: 10}
+	alerts := &fakeNotifier{}
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	buySvc := service.NewBuyService(logger, fakeTxManager{}, fakeUserRepo, fakeMerchRepo, newFakeOrderRepo(), newFakeCoinTxRepo(), newFakeLedgerRepo(fakeUserRepo), nil, nil, nil, service.StockAlertOptions{
+		Notifier:          alerts,
+		LowStockThreshold: 5,
+	})
+	ctx := context.Background()
+
+	// 7 -> 6: остаток выше порога
+	assert.NoError(t, buySvc.Buy(ctx, 1, "cup", 1))
+	assert.Empty(t, alerts.alerts)
+	// 6 -> 5: остаток опустился до порога — одно оповещение
+	assert.NoError(t, buySvc.Buy(ctx, 1, "cup", 1))
+	assert.Equal(t, []notifier.LowStockAlert{{Item: "cup", Stock: 5, Threshold: 5}}, alerts.alerts)
+	// 5 -> 4: остаток уже ниже порога, повторного оповещения нет
+	assert.NoError(t, buySvc.Buy(ctx, 1, "cup", 1))
+	assert.Len(t, alerts.alerts, 1)
+	assert.Equal(t, 4, *fakeMerchRepo.merchs["cup"].Stock)
+
+	// Остаток товара без учёта не меняется и оповещений не вызывает
+	assert.NoError(t, buySvc.Buy(ctx, 1, "pen", 1))
+	assert.Nil(t, fakeMerchRepo.merchs["pen"].Stock)
+	assert.Len(t, alerts.alerts, 1)
+	assert.Equal(t, 1000-3*20-10, fakeUserRepo.users["test@example.com"].CoinBalance)
+}
+
+func TestMerchService_RestockMerch(t *testing.T) {
+	fakeMerchRepo := newCatalogMerchRepo()
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	merchService := service.NewMerchService(logger, fakeTxManager{}, fakeMerchRepo, service.MerchOptions{CatalogCacheTTL: time.Hour})
+	ctx := context.Background()
+	const managerID = 3
+
+	// Товар без учёта остатка: учёт начинается с поступившего количества
+	merch, err := merchService.RestockMerch(ctx, managerID, "cup", 10)
 	assert.NoError(t, err)
-	defer db.Close()
+	if assert.NotNil(t, merch.Stock) {
+		assert.Equal(t, 10, *merch.Stock)
+	}
+	merch, err = merchService.RestockMerch(ctx, managerID, "cup", 5)
+	assert.NoError(t, err)
+	assert.Equal(t, 15, *merch.Stock)
 
-	// Ожидаем вызов BeginTx и Rollback, поскольку средств недостаточно.
-	mock.ExpectBegin()
-	mock.ExpectRollback()
+	// Нулевой остаток после инвентаризации делает товар недоступным в каталоге
+	zero := 0
+	merch, err = merchService.SetMerchStock(ctx, managerID, "cup", &zero)
+	assert.NoError(t, err)
+	assert.False(t, merch.Available)
+	assert.Equal(t, 0, *fakeMerchRepo.merchs["cup"].Stock)
+
+	merch, err = merchService.SetMerchStock(ctx, managerID, "cup", nil)
+	assert.NoError(t, err)
+	assert.True(t, merch.Available)
+	assert.Nil(t, fakeMerchRepo.merchs["cup"].Stock)
+
+	_, err = merchService.RestockMerch(ctx, managerID, "cup", 0)
+	assert.ErrorIs(t, err, service.ErrInvalidStock)
+	negative := -1
+	_, err = merchService.SetMerchStock(ctx, managerID, "cup", &negative)
+	assert.ErrorIs(t, err, service.ErrInvalidStock)
+	_, err = merchService.RestockMerch(ctx, managerID, "car", 1)
+	assert.ErrorIs(t, err, service.ErrMerchNotFound)
+}
 
+func TestBuyService_Buy_Quantity(t *testing.T) {
 	fakeUserRepo := newFakeUserRepo()
+	fakeUserRepo.users["test@example.com"] = &models.User{ID: 1, Email: "test@example.com", CoinBalance: 1000, EmailVerified: true}
+	fakeMerchRepo := newFakeMerchRepo()
+	stock := 8
+	fakeMerchRepo.merchs["hoody"] = &models.Merch{ID: 6, Name: "hoody", Price: 300, Stock: &stock}
+	fakeOrderRepo := newFakeOrderRepo()
 	fakeCoinTxRepo := newFakeCoinTxRepo()
+	alerts := &fakeNotifier{}
 
-	// Добавляем отправителя с балансом 50.
-	sender := &models.User{
-		ID:          1,
-		Email:       "sender@example.com",
-		PassHash:    []byte("hashed"),
-		CoinBalance: 50,
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	buySvc := service.NewBuyService(logger, fakeTxManager{}, fakeUserRepo, fakeMerchRepo, fakeOrderRepo, fakeCoinTxRepo, newFakeLedgerRepo(fakeUserRepo), nil, nil, nil, service.StockAlertOptions{
+		Notifier:          alerts,
+		LowStockThreshold: 5,
+	})
+	ctx := context.Background()
+
+	// Три единицы — один заказ на 3 × 300 монет; остаток 8 -> 5 переходит порог
+	assert.NoError(t, buySvc.Buy(ctx, 1, "hoody", 3))
+	assert.Equal(t, 100, fakeUserRepo.users["test@example.com"].CoinBalance)
+	if assert.Len(t, fakeOrderRepo.orders[1], 1) {
+		assert.Equal(t, 3, fakeOrderRepo.orders[1][0].Quantity)
+		assert.Equal(t, 900, fakeOrderRepo.orders[1][0].TotalPrice)
 	}
-	// Получатель с балансом 500.
-	receiver := &models.User{
-		ID:          2,
-		Email:       "receiver@example.com",
-		PassHash:    []byte("hashed"),
-		CoinBalance: 500,
+	if assert.Len(t, fakeCoinTxRepo.transactions[1], 1) {
+		assert.Equal(t, 900, fakeCoinTxRepo.transactions[1][0].Amount)
 	}
-	fakeUserRepo.users[sender.Email] = sender
-	fakeUserRepo.users[receiver.Email] = receiver
+	assert.Equal(t, 5, *fakeMerchRepo.merchs["hoody"].Stock)
+	assert.Equal(t, []notifier.LowStockAlert{{Item: "hoody", Stock: 5, Threshold: 5}}, alerts.alerts)
+
+	// Монет хватило бы на одну единицу, но не на две
+	fakeUserRepo.users["test@example.com"].CoinBalance = 500
+	err := buySvc.Buy(ctx, 1, "hoody", 2)
+	assert.ErrorIs(t, err, service.ErrInsufficientFunds)
+	assert.Equal(t, 5, *fakeMerchRepo.merchs["hoody"].Stock)
+
+	for _, quantity := range []int{0, -1, service.MaxBuyQuantity + 1} {
+		err := buySvc.Buy(ctx, 1, "hoody", quantity)
+		assert.ErrorIs(t, err, service.ErrInvalidQuantity, "quantity %d", quantity)
+	}
+	assert.Len(t, fakeOrderRepo.orders[1], 1)
+}
 
+func TestCartService_AddAndRemove(t *testing.T) {
+	fakeMerchRepo := newCatalogMerchRepo()
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
-	sendCoinSvc := service.NewSendCoinService(logger, db, fakeUserRepo, fakeCoinTxRepo)
+	merchService := service.NewMerchService(logger, fakeTxManager{}, fakeMerchRepo, service.MerchOptions{CatalogCacheTTL: time.Hour})
+	cartService := service.NewCartService(logger, fakeTxManager{}, newFakeCartRepo(fakeMerchRepo), merchService)
+	ctx := context.Background()
 
-	// Пытаемся перевести 100 монет, но у отправителя недостаточно средств.
-	err = sendCoinSvc.SendCoin(context.Background(), sender.ID, receiver.Email, 100)
-	assert.Error(t, err, "SendCoin should fail due to insufficient funds")
+	_, err := cartService.AddToCart(ctx, 1, "t-shirt", 1)
+	assert.NoError(t, err)
+	_, err = cartService.AddToCart(ctx, 1, "cup", 2)
+	assert.NoError(t, err)
+	// Повторное добавление увеличивает количество, а не создаёт вторую строку
+	cart, err := cartService.AddToCart(ctx, 1, "cup", 3)
+	assert.NoError(t, err)
+	if assert.Len(t, cart.Items, 2) {
+		assert.Equal(t, "cup", cart.Items[0].MerchName)
+		assert.Equal(t, 5, cart.Items[0].Quantity)
+		assert.Equal(t, "t-shirt", cart.Items[1].MerchName)
+	}
+	assert.Equal(t, 5*20+80, cart.TotalPrice)
 
-	err = mock.ExpectationsWereMet()
-	assert.NoError(t, err, "sqlmock expectations should be met")
+	// Корзины пользователей не пересекаются
+	cart, err = cartService.GetCart(ctx, 2)
+	assert.NoError(t, err)
+	assert.Empty(t, cart.Items)
+
+	_, err = cartService.AddToCart(ctx, 1, "cup", service.MaxBuyQuantity)
+	assert.ErrorIs(t, err, service.ErrInvalidQuantity)
+	_, err = cartService.AddToCart(ctx, 1, "cup", 0)
+	assert.ErrorIs(t, err, service.ErrInvalidQuantity)
+	_, err = cartService.AddToCart(ctx, 1, "car", 1)
+	assert.ErrorIs(t, err, service.ErrMerchNotFound)
+
+	cart, err = cartService.RemoveFromCart(ctx, 1, "t-shirt")
+	assert.NoError(t, err)
+	assert.Len(t, cart.Items, 1)
+	_, err = cartService.RemoveFromCart(ctx, 1, "t-shirt")
+	assert.ErrorIs(t, err, service.ErrCartItemNotFound)
+}
+
+// newCheckoutBuyService создаёт BuyService над корзиной пользователя с ID 1 и балансом balance
+func newCheckoutBuyService(balance int) (service.BuyService, *fakeUserRepo, *fakeMerchRepo, *fakeCartRepo, *fakeOrderRepo) {
+	fakeUserRepo := newFakeUserRepo()
+	fakeUserRepo.users["test@example.com"] = &models.User{ID: 1, Email: "test@example.com", CoinBalance: balance, EmailVerified: true}
+	fakeMerchRepo := newCatalogMerchRepo()
+	fakeCartRepo := newFakeCartRepo(fakeMerchRepo)
+	fakeOrderRepo := newFakeOrderRepo()
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	buySvc := service.NewBuyService(logger, fakeTxManager{}, fakeUserRepo, fakeMerchRepo, fakeOrderRepo, newFakeCoinTxRepo(), newFakeLedgerRepo(fakeUserRepo), nil, fakeCartRepo, nil, service.StockAlertOptions{})
+	return buySvc, fakeUserRepo, fakeMerchRepo, fakeCartRepo, fakeOrderRepo
+}
+
+func TestBuyService_Checkout(t *testing.T) {
+	buySvc, fakeUserRepo, fakeMerchRepo, fakeCartRepo, fakeOrderRepo := newCheckoutBuyService(1000)
+	stock := 10
+	fakeMerchRepo.merchs["cup"].Stock = &stock
+	ctx := context.Background()
+
+	_, _ = fakeCartRepo.AddCartItem(ctx, 1, fakeMerchRepo.merchs["t-shirt"].ID, 1)
+	_, _ = fakeCartRepo.AddCartItem(ctx, 1, fakeMerchRepo.merchs["cup"].ID, 2)
+	_, _ = fakeCartRepo.AddCartItem(ctx, 1, fakeMerchRepo.merchs["pen"].ID, 3)
+
+	result, err := buySvc.Checkout(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 80+2*20+3*10, result.TotalPrice)
+	if assert.Len(t, result.Orders, 3) {
+		// заказы создаются в порядке названий товаров
+		assert.Equal(t, "cup", result.Orders[0].MerchName)
+		assert.Equal(t, 2, result.Orders[0].Quantity)
+		assert.Equal(t, 40, result.Orders[0].TotalPrice)
+	}
+	assert.Len(t, fakeOrderRepo.orders[1], 3)
+	assert.Equal(t, 1000-150, fakeUserRepo.users["test@example.com"].CoinBalance)
+	assert.Equal(t, 8, *fakeMerchRepo.merchs["cup"].Stock)
+	assert.Empty(t, fakeCartRepo.items[1])
+
+	// Повтор после оформления не создаёт второй заказ
+	_, err = buySvc.Checkout(ctx, 1)
+	assert.ErrorIs(t, err, service.ErrCartEmpty)
+	assert.Len(t, fakeOrderRepo.orders[1], 3)
+}
+
+func TestBuyService_Checkout_LineErrors(t *testing.T) {
+	buySvc, fakeUserRepo, fakeMerchRepo, fakeCartRepo, fakeOrderRepo := newCheckoutBuyService(1000)
+	stock := 1
+	fakeMerchRepo.merchs["hoody"].Stock = &stock
+	archivedAt := time.Now()
+	fakeMerchRepo.merchs["umbrella"].ArchivedAt = &archivedAt
+	ctx := context.Background()
+
+	_, _ = fakeCartRepo.AddCartItem(ctx, 1, fakeMerchRepo.merchs["umbrella"].ID, 1)
+	_, _ = fakeCartRepo.AddCartItem(ctx, 1, fakeMerchRepo.merchs["hoody"].ID, 2)
+	_, _ = fakeCartRepo.AddCartItem(ctx, 1, fakeMerchRepo.merchs["cup"].ID, 1)
+
+	_, err := buySvc.Checkout(ctx, 1)
+	assert.ErrorIs(t, err, service.ErrCheckoutFailed)
+	var checkoutErr *service.CheckoutError
+	if assert.ErrorAs(t, err, &checkoutErr) {
+		assert.Equal(t, []service.CheckoutLineError{
+			{Item: "hoody", Err: service.ErrOutOfStock},
+			{Item: "umbrella", Err: service.ErrMerchNotFound},
+		}, checkoutErr.Lines)
+	}
+	// Не оформлена ни одна строка, в том числе доступная
+	assert.Empty(t, fakeOrderRepo.orders[1])
+	assert.Equal(t, 1000, fakeUserRepo.users["test@example.com"].CoinBalance)
+	assert.Len(t, fakeCartRepo.items[1], 3)
+}
+
+func TestBuyService_Checkout_InsufficientFunds(t *testing.T) {
+	buySvc, fakeUserRepo, fakeMerchRepo, fakeCartRepo, fakeOrderRepo := newCheckoutBuyService(350)
+	ctx := context.Background()
+
+	// Каждый товар по отдельности по карману, вся корзина — нет
+	_, _ = fakeCartRepo.AddCartItem(ctx, 1, fakeMerchRepo.merchs["hoody"].ID, 1)
+	_, _ = fakeCartRepo.AddCartItem(ctx, 1, fakeMerchRepo.merchs["t-shirt"].ID, 1)
+
+	_, err := buySvc.Checkout(ctx, 1)
+	assert.ErrorIs(t, err, service.ErrInsufficientFunds)
+	assert.Empty(t, fakeOrderRepo.orders[1])
+	assert.Equal(t, 350, fakeUserRepo.users["test@example.com"].CoinBalance)
+	assert.Len(t, fakeCartRepo.items[1], 2)
+}
+
+func TestBuyService_LastUnitInvalidatesCatalog(t *testing.T) {
+	fakeUserRepo := newFakeUserRepo()
+	fakeUserRepo.users["test@example.com"] = &models.User{ID: 1, Email: "test@example.com", CoinBalance: 1000, EmailVerified: true}
+	fakeMerchRepo := newCatalogMerchRepo()
+	one := 1
+	fakeMerchRepo.merchs["hoody"].Stock = &one
+	fakeCartRepo := newFakeCartRepo(fakeMerchRepo)
+
+	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
+	merchService := service.NewMerchService(logger, fakeTxManager{}, fakeMerchRepo, service.MerchOptions{CatalogCacheTTL: time.Hour})
+	catalog := &countingCatalog{MerchService: merchService}
+	buySvc := service.NewBuyService(logger, fakeTxManager{}, fakeUserRepo, fakeMerchRepo, newFakeOrderRepo(), newFakeCoinTxRepo(), newFakeLedgerRepo(fakeUserRepo), nil, fakeCartRepo, catalog, service.StockAlertOptions{})
+	ctx := context.Background()
+
+	// Каталог загружен в кэш, пока товар ещё есть на складе
+	merch, err := merchService.GetMerch(ctx, "hoody")
+	assert.NoError(t, err)
+	assert.True(t, merch.Available)
+
+	assert.NoError(t, buySvc.Buy(ctx, 1, "hoody", 1))
+	merch, err = merchService.GetMerch(ctx, "hoody")
+	assert.NoError(t, err)
+	assert.False(t, merch.Available)
+
+	assert.Equal(t, 1, catalog.invalidations)
+
+	// Оформление корзины тоже сбрасывает кэш — один раз, сколько бы строк ни списали остаток
+	two, ten := 2, 10
+	fakeMerchRepo.merchs["cup"].Stock = &two
+	fakeMerchRepo.merchs["pen"].Stock = &ten
+	merchService.InvalidateCatalog()
+	merch, err = merchService.GetMerch(ctx, "cup")
+	assert.NoError(t, err)
+	assert.True(t, merch.Available)
+
+	_, _ = fakeCartRepo.AddCartItem(ctx, 1, fakeMerchRepo.merchs["cup"].ID, 2)
+	_, _ = fakeCartRepo.AddCartItem(ctx, 1, fakeMerchRepo.merchs["pen"].ID, 1)
+	catalog.invalidations = 0
+	_, err = buySvc.Checkout(ctx, 1)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, catalog.invalidations)
+	merch, err = merchService.GetMerch(ctx, "cup")
+	assert.NoError(t, err)
+	assert.False(t, merch.Available)
+}
+
+// countingCatalog считает сбросы кэша каталога
+type countingCatalog struct {
+	service.MerchService
+	invalidations int
+}
+
+func (c *countingCatalog) InvalidateCatalog() {
+	c.invalidations++
+	c.MerchService.InvalidateCatalog()
 }
@@ -0,0 +1,119 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/storage"
+)
+
+// sessionTouchInterval — как часто обновлять время последнего использования сессии:
+// клиент делает много запросов подряд, записывать каждый незачем
+const sessionTouchInterval = time.Minute
+
+// SessionService показывает пользователю его сессии и позволяет завершить любую из них,
+// например при потере ноутбука. Отозванная сессия перестаёт приниматься сразу.
+type SessionService interface {
+	// ListSessions возвращает действующие сессии пользователя, недавно использованные первыми.
+	ListSessions(ctx context.Context, userID int64) ([]*models.Session, error)
+	// RevokeSession завершает сессию пользователя; чужая или уже завершённая — ErrSessionNotFound.
+	RevokeSession(ctx context.Context, userID, sessionID int64) error
+}
+
+var _ SessionService = (*AuthService)(nil)
+
+func (a *AuthService) ListSessions(ctx context.Context, userID int64) ([]*models.Session, error) {
+	const op = "auth.ListSessions"
+
+	sessions, err := a.sessionRepo.ListActiveSessions(ctx, userID)
+	if err != nil {
+		a.log.Error("failed to list sessions", slog.String("op", op), slog.Int64("userID", userID), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return sessions, nil
+}
+
+// RevokeSession завершает сессию: её refresh-токены отзываются, а access-токены отклоняются
+// jwtmiddleware при следующем запросе.
+func (a *AuthService) RevokeSession(ctx context.Context, userID, sessionID int64) error {
+	const op = "auth.RevokeSession"
+	logger := a.log.With(slog.String("op", op), slog.Int64("userID", userID), slog.Int64("sessionID", sessionID))
+
+	err := a.txManager.Do(ctx, func(ctx context.Context) error {
+		if err := a.sessionRepo.RevokeSession(ctx, userID, sessionID); err != nil {
+			return err
+		}
+		return a.refreshRepo.RevokeSessionRefreshTokens(ctx, sessionID)
+	})
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrSessionNotFound)
+		}
+		logger.Error("failed to revoke session", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("session revoked")
+	return nil
+}
+
+// startSession начинает сессию на устройстве device (User-Agent или имя, переданное клиентом)
+// с адреса clientIP и выдаёт её первую пару токенов
+func (a *AuthService) startSession(ctx context.Context, user *models.User, device, clientIP string) (*TokenPair, error) {
+	var pair *TokenPair
+	err := a.txManager.Do(ctx, func(ctx context.Context) error {
+		session, err := a.createSession(ctx, user.ID, device, clientIP)
+		if err != nil {
+			return err
+		}
+		pair, _, err = a.issueTokens(ctx, user, session)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return pair, nil
+}
+
+// createSession сохраняет новую сессию со сроком действия refresh-токена
+func (a *AuthService) createSession(ctx context.Context, userID int64, device, clientIP string) (*models.Session, error) {
+	if len(device) > maxDeviceLength {
+		device = strings.ToValidUTF8(device[:maxDeviceLength], "")
+	}
+	session := &models.Session{
+		UserID:    userID,
+		UserAgent: device,
+		IP:        clientIP,
+		ExpiresAt: time.Now().Add(a.opts.RefreshTokenTTL),
+	}
+	if err := a.sessionRepo.CreateSession(ctx, session); err != nil {
+		return nil, fmt.Errorf("failed to create session: %w", err)
+	}
+	return session, nil
+}
+
+// checkSession проверяет сессию access-токена и не чаще раза в sessionTouchInterval запоминает
+// время её использования. Сбой записи времени запрос не отклоняет.
+func (a *AuthService) checkSession(ctx context.Context, logger *slog.Logger, userID, sessionID int64) (bool, error) {
+	session, err := a.sessionRepo.GetActiveSession(ctx, sessionID)
+	if err != nil {
+		if errors.Is(err, storage.ErrSessionNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+	if session.UserID != userID {
+		return false, nil
+	}
+	if time.Since(session.LastUsedAt) > sessionTouchInterval {
+		if err := a.sessionRepo.TouchSession(ctx, session.ID); err != nil {
+			logger.Warn("failed to update session last use", slog.Int64("sessionID", session.ID), slog.Any("error", err))
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,32 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/linemk/avito-shop/internal/lib/notifier"
+)
+
+// StockAlertOptions — оповещения менеджеров о заканчивающемся товаре
+type StockAlertOptions struct {
+	// Notifier доставляет оповещения; nil — оповещения выключены
+	Notifier notifier.Notifier
+	// LowStockThreshold — остаток, при котором товар считается заканчивающимся
+	LowStockThreshold int
+}
+
+// notifyLowStock оповещает о заканчивающемся товаре, если покупка опустила остаток с before до after
+// через порог. Оповещение отправляется один раз при переходе через порог, а не при каждой покупке
+// ниже него; следующее — после пополнения склада выше порога. Вызывается после фиксации транзакции:
+// ошибка доставки только пишется в лог и не отменяет покупку.
+func (o StockAlertOptions) notifyLowStock(ctx context.Context, logger *slog.Logger, item string, before, after int) {
+	if o.Notifier == nil || before <= o.LowStockThreshold || after > o.LowStockThreshold {
+		return
+	}
+	alert := notifier.LowStockAlert{Item: item, Stock: after, Threshold: o.LowStockThreshold}
+	if err := o.Notifier.NotifyLowStock(ctx, alert); err != nil {
+		logger.Error("failed to send low stock alert", slog.Int("stock", after), slog.Any("error", err))
+		return
+	}
+	logger.Info("low stock alert sent", slog.Int("stock", after))
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+)
+
+// ThrottlePolicy — пороги неудачных попыток входа для одного вида ключа (аккаунт или IP)
+type ThrottlePolicy struct {
+	// FreeAttempts — неудачные попытки без задержки; после них задержка растёт экспоненциально
+	FreeAttempts int
+	// MaxFailures — после стольких неудач подряд ключ блокируется на LockoutDuration; 0 — без блокировки
+	MaxFailures int
+}
+
+// LoginThrottleOptions — настройки защиты /api/auth от перебора паролей
+type LoginThrottleOptions struct {
+	Account ThrottlePolicy
+	IP      ThrottlePolicy
+	// Window — неудачи старше этого срока не учитываются
+	Window time.Duration
+	// BaseDelay — задержка после первой неудачи сверх FreeAttempts, дальше удваивается
+	BaseDelay time.Duration
+	// MaxDelay ограничивает экспоненциальную задержку
+	MaxDelay time.Duration
+	// LockoutDuration — срок блокировки после MaxFailures неудач
+	LockoutDuration time.Duration
+}
+
+// TooManyAttemptsError возвращается Login, пока аккаунт или IP-адрес заблокированы.
+// errors.Is(err, ErrTooManyAttempts) для неё истинно.
+type TooManyAttemptsError struct {
+	RetryAfter time.Duration
+}
+
+func (e *TooManyAttemptsError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrTooManyAttempts, e.RetryAfter)
+}
+
+func (e *TooManyAttemptsError) Is(target error) bool {
+	return target == ErrTooManyAttempts
+}
+
+// throttleKey — ключ счётчика попыток вместе с его порогами
+type throttleKey struct {
+	key    string
+	policy ThrottlePolicy
+}
+
+// loginThrottleKeys возвращает ключи счётчиков для попытки входа: аккаунт и, если известен, IP-адрес
+func (a *AuthService) loginThrottleKeys(email, clientIP string) []throttleKey {
+	keys := []throttleKey{{key: "account:" + strings.ToLower(strings.TrimSpace(email)), policy: a.opts.Throttle.Account}}
+	if clientIP != "" {
+		keys = append(keys, throttleKey{key: "ip:" + clientIP, policy: a.opts.Throttle.IP})
+	}
+	return keys
+}
+
+// loginReservation — попытка, учтённая по ключу до проверки пароля или кода
+type loginReservation struct {
+	key     throttleKey
+	attempt *models.LoginAttempt
+}
+
+// reserveLoginAttempt учитывает попытку по всем ключам до проверки пароля или кода и возвращает
+// *TooManyAttemptsError, если хотя бы один из ключей заблокирован. Счётчик увеличивается и
+// сравнивается с MaxFailures одной операцией хранилища, поэтому из пачки параллельных попыток
+// до проверки доходят не больше MaxFailures. Проверка выполняется до поиска пользователя и сравнения
+// пароля, поэтому ответ не зависит от того, существует ли аккаунт. Учтённую попытку завершает
+// registerLoginFailure, acceptLoginAttempt или releaseLoginAttempt.
+func (a *AuthService) reserveLoginAttempt(ctx context.Context, logger *slog.Logger, keys []throttleKey) ([]loginReservation, error) {
+	opts := a.opts.Throttle
+	now := time.Now()
+	reservations := make([]loginReservation, 0, len(keys))
+	locked := false
+	var retryAfter time.Duration
+	for _, k := range keys {
+		attempt, reserved, err := a.attemptRepo.ReserveLoginAttempt(ctx, k.key, now, now.Add(-opts.Window), k.policy.MaxFailures, now.Add(opts.LockoutDuration))
+		if err != nil {
+			a.releaseLoginAttempt(ctx, logger, reservations)
+			return nil, fmt.Errorf("failed to check login attempts: %w", err)
+		}
+		if !reserved {
+			locked = true
+			if wait := attempt.LockedUntil.Sub(now); wait > retryAfter {
+				retryAfter = wait
+			}
+			continue
+		}
+		reservations = append(reservations, loginReservation{key: k, attempt: attempt})
+	}
+	if locked {
+		a.releaseLoginAttempt(ctx, logger, reservations)
+		return nil, &TooManyAttemptsError{RetryAfter: retryAfter}
+	}
+	return reservations, nil
+}
+
+// registerLoginFailure оставляет учтённую попытку неудачной и задерживает следующие попытки
+// по ключам, превысившим FreeAttempts. Ошибки хранилища только логируются: ответ клиенту
+// всё равно ErrInvalidCredentials.
+func (a *AuthService) registerLoginFailure(ctx context.Context, logger *slog.Logger, reservations []loginReservation) {
+	opts := a.opts.Throttle
+	now := time.Now()
+	for _, r := range reservations {
+		delay := opts.lockoutDelay(r.key.policy, r.attempt.Failures)
+		if delay <= 0 {
+			continue
+		}
+		if err := a.attemptRepo.SetLoginLockout(ctx, r.key.key, now.Add(delay)); err != nil {
+			logger.Error("failed to set login lockout", slog.String("key", r.key.key), slog.Any("error", err))
+			continue
+		}
+		logger.Warn("login locked", slog.String("key", r.key.key), slog.Int("failures", r.attempt.Failures), slog.Duration("delay", delay))
+	}
+}
+
+// acceptLoginAttempt завершает успешную попытку: счётчик аккаунта сбрасывается,
+// а попытка по IP-адресу отменяется (см. resetLoginFailures).
+func (a *AuthService) acceptLoginAttempt(ctx context.Context, logger *slog.Logger, reservations []loginReservation) {
+	a.resetLoginFailures(ctx, logger, []throttleKey{reservations[0].key})
+	a.releaseLoginAttempt(ctx, logger, reservations[1:])
+}
+
+// releaseLoginAttempt отменяет учтённые попытки, которые не были ни успешными, ни неудачными:
+// например, когда проверка прервалась ошибкой или вход ожидает второго фактора
+func (a *AuthService) releaseLoginAttempt(ctx context.Context, logger *slog.Logger, reservations []loginReservation) {
+	for _, r := range reservations {
+		if err := a.attemptRepo.ReleaseLoginAttempt(ctx, r.key.key, r.attempt.LockedUntil); err != nil {
+			logger.Error("failed to release login attempt", slog.String("key", r.key.key), slog.Any("error", err))
+		}
+	}
+}
+
+// resetLoginFailures сбрасывает счётчик аккаунта после успешного входа. Счётчик IP-адреса
+// не сбрасывается: иначе перебор чужих паролей можно было бы прерывать входом в свой аккаунт.
+func (a *AuthService) resetLoginFailures(ctx context.Context, logger *slog.Logger, keys []throttleKey) {
+	if err := a.attemptRepo.ResetLoginAttempts(ctx, keys[0].key); err != nil {
+		logger.Error("failed to reset login attempts", slog.Any("error", err))
+	}
+}
+
+// lockoutDelay вычисляет, на сколько заблокировать ключ после failures неудач подряд:
+// до FreeAttempts — без задержки, затем BaseDelay, удваиваясь до MaxDelay,
+// после MaxFailures — LockoutDuration.
+func (o LoginThrottleOptions) lockoutDelay(p ThrottlePolicy, failures int) time.Duration {
+	if p.MaxFailures > 0 && failures >= p.MaxFailures {
+		return o.LockoutDuration
+	}
+	excess := failures - p.FreeAttempts
+	if excess <= 0 || o.BaseDelay <= 0 {
+		return 0
+	}
+	delay := o.BaseDelay
+	for i := 1; i < excess; i++ {
+		delay *= 2
+		if o.MaxDelay > 0 && delay >= o.MaxDelay {
+			return o.MaxDelay
+		}
+	}
+	if o.MaxDelay > 0 && delay > o.MaxDelay {
+		return o.MaxDelay
+	}
+	return delay
+}
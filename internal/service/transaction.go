@@ -2,11 +2,11 @@ package service
 
 import (
 	"context"
-	"database/sql"
 	"errors"
 	"fmt"
 	"log/slog"
 
+	"github.com/linemk/avito-shop/internal/domain/models"
 	"github.com/linemk/avito-shop/internal/storage"
 )
 
@@ -17,17 +17,21 @@ type SendCoinService interface {
 
 type sendCoinService struct {
 	log        *slog.Logger
-	db         *sql.DB
+	txManager  storage.TxManager
 	userRepo   storage.UserStorage
 	coinTxRepo storage.CoinTransactionStorage
+	ledgerRepo storage.LedgerStorage
+	idemRepo   storage.IdempotencyStorage
 }
 
-func NewSendCoinService(log *slog.Logger, db *sql.DB, userRepo storage.UserStorage, coinTxRepo storage.CoinTransactionStorage) SendCoinService {
+func NewSendCoinService(log *slog.Logger, txManager storage.TxManager, userRepo storage.UserStorage, coinTxRepo storage.CoinTransactionStorage, ledgerRepo storage.LedgerStorage, idemRepo storage.IdempotencyStorage) SendCoinService {
 	return &sendCoinService{
 		log:        log,
-		db:         db,
+		txManager:  txManager,
 		userRepo:   userRepo,
 		coinTxRepo: coinTxRepo,
+		ledgerRepo: ledgerRepo,
+		idemRepo:   idemRepo,
 	}
 }
 
@@ -42,100 +46,103 @@ func (s *sendCoinService) SendCoin(ctx context.Context, fromUserID int64, toUser
 	logger.Info("starting coin transfer transaction")
 
 	if amount <= 0 {
-		return fmt.Errorf("%s: amount must be positive", op)
+		return fmt.Errorf("%s: %w", op, ErrInvalidAmount)
 	}
 
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		logger.Error("failed to begin transaction", slog.Any("error", err))
-		return fmt.Errorf("%s: failed to begin transaction: %w", op, err)
-	}
+	err := s.txManager.Do(ctx, func(ctx context.Context) error {
+		// Сохраняем ключ идемпотентности в той же транзакции, что и перевод монет
+		if err := reserveIdempotencyKey(ctx, s.idemRepo, fromUserID); err != nil {
+			return err
+		}
 
-	// Получаем отправителя через метод GetUserByIDtx (используем транзакцию)
-	sender, err := s.userRepo.GetUserByIDtx(ctx, tx, fromUserID)
-	if err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			logger.Error("transaction rollback failed", slog.Any("error", rbErr))
+		// Получаем получателя по email (username) в той же транзакции, что и последующие изменения баланса
+		receiver, err := s.userRepo.GetUserByEmail(ctx, toUser)
+		if err != nil {
+			if errors.Is(err, storage.ErrUserNotFound) {
+				logger.Error("receiver not found", slog.String("toUser", toUser))
+				return ErrReceiverNotFound
+			}
+			logger.Error("failed to get receiver", slog.Any("error", err))
+			return fmt.Errorf("failed to get receiver: %w", err)
 		}
-		logger.Error("failed to get sender", slog.Any("error", err))
-		return fmt.Errorf("%s: failed to get sender: %w", op, err)
-	}
 
-	// Получаем получателя по email (username)
-	receiver, err := s.userRepo.GetUserByEmail(ctx, toUser)
-	if err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			logger.Error("transaction rollback failed", slog.Any("error", rbErr))
+		// проверяем, не отправитель ли пытается сам себе перевести деньги
+		if fromUserID == receiver.ID {
+			logger.Error("cannot transfer coins to yourself")
+			return ErrSelfTransfer
 		}
-		if errors.Is(err, storage.ErrUserNotFound) {
-			logger.Error("receiver not found", slog.String("toUser", toUser))
-			return fmt.Errorf("%s: receiver not found", op)
+
+		// Блокируем строки обоих участников; дальше работаем только с заблокированными значениями баланса
+		sender, receiver, err := s.lockTransferParties(ctx, fromUserID, receiver.ID)
+		if err != nil {
+			logger.Error("failed to lock transfer parties", slog.Any("error", err))
+			return fmt.Errorf("failed to lock transfer parties: %w", err)
 		}
-		logger.Error("failed to get receiver", slog.Any("error", err))
-		return fmt.Errorf("%s: failed to get receiver: %w", op, err)
-	}
 
-	// проверяем, не отправитель ли пытается сам себе перевести деньги
-	if fromUserID == receiver.ID {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			logger.Error("transaction rollback failed", slog.Any("error", rbErr))
+		// Переводить монеты можно только после подтверждения email
+		if !sender.EmailVerified {
+			logger.Warn("sender email is not verified")
+			return ErrEmailNotVerified
 		}
-		logger.Error("cannot transfer coins to yourself")
-		return fmt.Errorf("%s: cannot transfer coins to yourself", op)
-	}
 
-	// Проверяем, достаточно ли средств у отправителя
-	if sender.CoinBalance < amount {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			logger.Error("transaction rollback failed", slog.Any("error", rbErr))
+		// Проверяем, достаточно ли средств у отправителя
+		if sender.CoinBalance < amount {
+			logger.Warn("insufficient funds", slog.Int("senderBalance", sender.CoinBalance))
+			return ErrInsufficientFunds
 		}
-		logger.Warn("insufficient funds", slog.Int("senderBalance", sender.CoinBalance))
-		return fmt.Errorf("%s: insufficient funds", op)
-	}
 
-	// Обновляем баланс отправителя: списываем монеты
-	newSenderBalance := sender.CoinBalance - amount
-	if err := s.userRepo.UpdateUserBalance(ctx, tx, fromUserID, newSenderBalance); err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			logger.Error("transaction rollback failed", slog.Any("error", rbErr))
+		// Переводим монеты: кошелёк отправителя -> кошелёк получателя
+		if _, err := s.ledgerRepo.PostEntry(ctx, &models.LedgerEntry{
+			Kind: models.LedgerEntryTransfer,
+			Postings: []models.LedgerPosting{
+				{Account: models.WalletAccount(sender.ID), Amount: -amount},
+				{Account: models.WalletAccount(receiver.ID), Amount: amount},
+			},
+		}); err != nil {
+			logger.Error("failed to post transfer to ledger", slog.Any("error", err))
+			return fmt.Errorf("failed to post transfer to ledger: %w", err)
 		}
-		logger.Error("failed to update sender balance", slog.Any("error", err))
-		return fmt.Errorf("%s: failed to update sender balance: %w", op, err)
-	}
 
-	// Обновляем баланс получателя: прибавляем монеты
-	newReceiverBalance := receiver.CoinBalance + amount
-	if err := s.userRepo.UpdateUserBalance(ctx, tx, receiver.ID, newReceiverBalance); err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			logger.Error("transaction rollback failed", slog.Any("error", rbErr))
+		// Регистрируем транзакцию для отправителя (положительная сумма, тип "transfer_sent")
+		if err := s.coinTxRepo.CreateTransaction(ctx, fromUserID, amount, models.CoinTxTransferSent, &receiver.ID); err != nil {
+			logger.Error("failed to record sender transaction", slog.Any("error", err))
+			return fmt.Errorf("failed to record sender transaction: %w", err)
 		}
-		logger.Error("failed to update receiver balance", slog.Any("error", err))
-		return fmt.Errorf("%s: failed to update receiver balance: %w", op, err)
-	}
 
-	// Регистрируем транзакцию для отправителя (положительная сумма, тип "transfer_sent")
-	if err := s.coinTxRepo.CreateTransaction(ctx, tx, fromUserID, amount, "transfer_sent", &receiver.ID); err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			logger.Error("transaction rollback failed", slog.Any("error", rbErr))
+		// Регистрируем транзакцию для получателя (положительная сумма, тип "transfer_received")
+		if err := s.coinTxRepo.CreateTransaction(ctx, receiver.ID, amount, models.CoinTxTransferReceived, &fromUserID); err != nil {
+			logger.Error("failed to record receiver transaction", slog.Any("error", err))
+			return fmt.Errorf("failed to record receiver transaction: %w", err)
 		}
-		logger.Error("failed to record sender transaction", slog.Any("error", err))
-		return fmt.Errorf("%s: failed to record sender transaction: %w", op, err)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Регистрируем транзакцию для получателя (положительная сумма, тип "transfer_received")
-	if err := s.coinTxRepo.CreateTransaction(ctx, tx, receiver.ID, amount, "transfer_received", &fromUserID); err != nil {
-		if rbErr := tx.Rollback(); rbErr != nil {
-			logger.Error("transaction rollback failed", slog.Any("error", rbErr))
-		}
-		logger.Error("failed to record receiver transaction", slog.Any("error", err))
-		return fmt.Errorf("%s: failed to record receiver transaction: %w", op, err)
+	logger.Info("coin transfer completed successfully")
+	return nil
+}
+
+// lockTransferParties блокирует строки отправителя и получателя в порядке возрастания ID.
+// Единый порядок захвата блокировок исключает взаимоблокировку встречных переводов A->B и B->A.
+func (s *sendCoinService) lockTransferParties(ctx context.Context, senderID, receiverID int64) (*models.User, *models.User, error) {
+	firstID, secondID := senderID, receiverID
+	if firstID > secondID {
+		firstID, secondID = secondID, firstID
 	}
 
-	if err := tx.Commit(); err != nil {
-		logger.Error("failed to commit transaction", slog.Any("error", err))
-		return fmt.Errorf("%s: failed to commit transaction: %w", op, err)
+	first, err := s.userRepo.GetUserByIDForUpdate(ctx, firstID)
+	if err != nil {
+		return nil, nil, err
+	}
+	second, err := s.userRepo.GetUserByIDForUpdate(ctx, secondID)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	logger.Info("coin transfer completed successfully")
-	return nil
+	if first.ID == senderID {
+		return first, second, nil
+	}
+	return second, first, nil
 }
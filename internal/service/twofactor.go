@@ -0,0 +1,533 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+	"github.com/linemk/avito-shop/internal/lib/totp"
+	"github.com/linemk/avito-shop/internal/storage"
+)
+
+// параметры кодов восстановления: 10 байт случайности — 16 символов base32
+const (
+	recoveryCodeCount = 10
+	recoveryCodeBytes = 10
+)
+
+// TwoFactorOptions — настройки второго фактора (TOTP)
+type TwoFactorOptions struct {
+	// Issuer — название сервиса в приложении-аутентификаторе
+	Issuer string
+	// ChallengeTTL — сколько ждать код второго фактора после проверки пароля
+	ChallengeTTL time.Duration
+	// Skew — допустимое расхождение часов клиента в шагах TOTP (по 30 секунд)
+	Skew int
+}
+
+// LoginResult — результат Login: пара токенов либо, если нужен второй фактор, токен ожидания.
+// Заполнено ровно одно из полей.
+type LoginResult struct {
+	Tokens    *TokenPair
+	Challenge *TwoFactorChallenge
+}
+
+// TwoFactorChallenge — вход, ожидающий второго фактора. Токен обменивается на пару токенов
+// в VerifyTwoFactor, а при SetupRequired — в ConfirmTwoFactorSetup после подключения TOTP.
+type TwoFactorChallenge struct {
+	Token string
+	// SetupRequired — роль требует второй фактор, но пользователь его ещё не подключил
+	SetupRequired bool
+	ExpiresAt     time.Time
+}
+
+// TwoFactorEnrollment — данные для подключения приложения-аутентификатора
+type TwoFactorEnrollment struct {
+	Secret          string // секрет в base32 для ручного ввода
+	ProvisioningURI string // otpauth:// для QR-кода
+}
+
+// TwoFactorService управляет вторым фактором (TOTP) и завершает вход, ожидающий кода.
+type TwoFactorService interface {
+	// VerifyTwoFactor обменивает токен ожидания и код TOTP или код восстановления на пару токенов.
+	VerifyTwoFactor(ctx context.Context, challengeToken, code, device, clientIP string) (*TokenPair, error)
+	// BeginTwoFactorSetup начинает обязательное подключение по токену ожидания из Login.
+	BeginTwoFactorSetup(ctx context.Context, challengeToken string) (*TwoFactorEnrollment, error)
+	// ConfirmTwoFactorSetup завершает обязательное подключение и вход; возвращает коды восстановления.
+	ConfirmTwoFactorSetup(ctx context.Context, challengeToken, code, device, clientIP string) (*TokenPair, []string, error)
+	// EnrollTwoFactor начинает подключение для вошедшего пользователя.
+	EnrollTwoFactor(ctx context.Context, userID int64) (*TwoFactorEnrollment, error)
+	// ConfirmTwoFactor включает второй фактор кодом из приложения; возвращает коды восстановления.
+	ConfirmTwoFactor(ctx context.Context, userID int64, code string) ([]string, error)
+	// DisableTwoFactor отключает второй фактор по коду TOTP или коду восстановления.
+	DisableTwoFactor(ctx context.Context, userID int64, code string) error
+	// SetTwoFactorRequired делает второй фактор обязательным для роли или отменяет требование.
+	SetTwoFactorRequired(ctx context.Context, actorID int64, role models.Role, required bool) error
+	// ListTwoFactorRequiredRoles возвращает роли с обязательным вторым фактором.
+	ListTwoFactorRequiredRoles(ctx context.Context) ([]models.Role, error)
+}
+
+var _ TwoFactorService = (*AuthService)(nil)
+
+// completeLogin завершает вход после проверки пароля: выдаёт пару токенов или, если у пользователя
+// включён второй фактор либо его роль требует второй фактор, — токен ожидания
+func (a *AuthService) completeLogin(ctx context.Context, user *models.User, device, clientIP string) (*LoginResult, error) {
+	tf, err := a.getTwoFactor(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	purpose := models.TokenPurposeTwoFactorLogin
+	if !tf.Enabled() {
+		required, err := a.twoFactorRepo.IsTwoFactorRequired(ctx, user.Role)
+		if err != nil {
+			return nil, err
+		}
+		if !required {
+			pair, err := a.startSession(ctx, user, device, clientIP)
+			if err != nil {
+				return nil, err
+			}
+			return &LoginResult{Tokens: pair}, nil
+		}
+		purpose = models.TokenPurposeTwoFactorSetup
+	}
+
+	token, tokenHash, err := newOneTimeToken()
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(a.opts.TwoFactor.ChallengeTTL)
+	if err := a.tokenRepo.CreateToken(ctx, &models.OneTimeToken{
+		UserID:    user.ID,
+		Purpose:   purpose,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return nil, fmt.Errorf("failed to save challenge token: %w", err)
+	}
+	return &LoginResult{Challenge: &TwoFactorChallenge{
+		Token:         token,
+		SetupRequired: purpose == models.TokenPurposeTwoFactorSetup,
+		ExpiresAt:     expiresAt,
+	}}, nil
+}
+
+// VerifyTwoFactor завершает вход вторым фактором. Неверный код учитывается как неудачная
+// попытка входа для аккаунта и IP-адреса, поэтому перебор кодов блокируется так же, как перебор паролей.
+func (a *AuthService) VerifyTwoFactor(ctx context.Context, challengeToken, code, device, clientIP string) (*TokenPair, error) {
+	const op = "auth.VerifyTwoFactor"
+	logger := a.log.With(slog.String("op", op), slog.String("ip", clientIP))
+
+	user, err := a.challengeUser(ctx, models.TokenPurposeTwoFactorLogin, challengeToken)
+	if err != nil {
+		logger.Warn("invalid challenge token", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	logger = logger.With(slog.Int64("userID", user.ID))
+
+	reservations, err := a.reserveLoginAttempt(ctx, logger, a.loginThrottleKeys(user.Email, clientIP))
+	if err != nil {
+		logger.Warn("two-factor attempt rejected", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var pair *TokenPair
+	err = a.txManager.Do(ctx, func(ctx context.Context) error {
+		tf, err := a.getTwoFactor(ctx, user.ID)
+		if err != nil {
+			return err
+		}
+		if !tf.Enabled() {
+			// второй фактор отключили, пока вход ожидал кода
+			return ErrInvalidChallengeToken
+		}
+		if err := a.verifySecondFactor(ctx, tf, code); err != nil {
+			return err
+		}
+		if _, err := a.tokenRepo.ConsumeToken(ctx, models.TokenPurposeTwoFactorLogin, hashOneTimeToken(challengeToken)); err != nil {
+			if errors.Is(err, storage.ErrTokenNotFound) {
+				return ErrInvalidChallengeToken
+			}
+			return fmt.Errorf("failed to consume challenge token: %w", err)
+		}
+		pair, err = a.startSession(ctx, user, device, clientIP)
+		return err
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, ErrInvalidTwoFactorCode):
+			logger.Warn("invalid two-factor code")
+			a.registerLoginFailure(ctx, logger, reservations)
+		case errors.Is(err, ErrInvalidChallengeToken):
+			logger.Warn("invalid challenge token")
+			a.releaseLoginAttempt(ctx, logger, reservations)
+		default:
+			logger.Error("failed to verify two-factor code", slog.Any("error", err))
+			a.releaseLoginAttempt(ctx, logger, reservations)
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.acceptLoginAttempt(ctx, logger, reservations)
+	logger.Info("user logged in with second factor")
+	return pair, nil
+}
+
+// BeginTwoFactorSetup начинает подключение второго фактора, обязательного для роли пользователя.
+// Повторный вызов с тем же токеном ожидания выдаёт новый секрет.
+func (a *AuthService) BeginTwoFactorSetup(ctx context.Context, challengeToken string) (*TwoFactorEnrollment, error) {
+	const op = "auth.BeginTwoFactorSetup"
+	logger := a.log.With(slog.String("op", op))
+
+	user, err := a.challengeUser(ctx, models.TokenPurposeTwoFactorSetup, challengeToken)
+	if err != nil {
+		logger.Warn("invalid challenge token", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	enrollment, err := a.enroll(ctx, user)
+	if err != nil {
+		logger.Error("failed to begin two-factor setup", slog.Int64("userID", user.ID), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("two-factor setup started", slog.Int64("userID", user.ID))
+	return enrollment, nil
+}
+
+// ConfirmTwoFactorSetup подтверждает обязательное подключение кодом из приложения и завершает вход.
+func (a *AuthService) ConfirmTwoFactorSetup(ctx context.Context, challengeToken, code, device, clientIP string) (*TokenPair, []string, error) {
+	const op = "auth.ConfirmTwoFactorSetup"
+	logger := a.log.With(slog.String("op", op), slog.String("ip", clientIP))
+
+	user, err := a.challengeUser(ctx, models.TokenPurposeTwoFactorSetup, challengeToken)
+	if err != nil {
+		logger.Warn("invalid challenge token", slog.Any("error", err))
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	logger = logger.With(slog.Int64("userID", user.ID))
+
+	var pair *TokenPair
+	var recoveryCodes []string
+	err = a.txManager.Do(ctx, func(ctx context.Context) error {
+		recoveryCodes, err = a.confirm(ctx, user.ID, code)
+		if err != nil {
+			return err
+		}
+		if _, err := a.tokenRepo.ConsumeToken(ctx, models.TokenPurposeTwoFactorSetup, hashOneTimeToken(challengeToken)); err != nil {
+			if errors.Is(err, storage.ErrTokenNotFound) {
+				return ErrInvalidChallengeToken
+			}
+			return fmt.Errorf("failed to consume challenge token: %w", err)
+		}
+		pair, err = a.startSession(ctx, user, device, clientIP)
+		return err
+	})
+	if err != nil {
+		if isTwoFactorClientError(err) {
+			logger.Warn("two-factor setup not confirmed", slog.Any("error", err))
+		} else {
+			logger.Error("failed to confirm two-factor setup", slog.Any("error", err))
+		}
+		return nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("two-factor enabled, user logged in")
+	return pair, recoveryCodes, nil
+}
+
+// EnrollTwoFactor выдаёт новый секрет TOTP. Второй фактор включается только после ConfirmTwoFactor,
+// поэтому незавершённое подключение не мешает входу.
+func (a *AuthService) EnrollTwoFactor(ctx context.Context, userID int64) (*TwoFactorEnrollment, error) {
+	const op = "auth.EnrollTwoFactor"
+	logger := a.log.With(slog.String("op", op), slog.Int64("userID", userID))
+
+	user, err := a.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return nil, fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		logger.Error("failed to get user", slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	enrollment, err := a.enroll(ctx, user)
+	if err != nil {
+		if errors.Is(err, ErrTwoFactorAlreadyEnabled) {
+			logger.Warn("two-factor already enabled")
+		} else {
+			logger.Error("failed to enroll two-factor", slog.Any("error", err))
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("two-factor enrollment started")
+	return enrollment, nil
+}
+
+// ConfirmTwoFactor включает второй фактор. Refresh-токены, выданные без второго фактора, отзываются.
+func (a *AuthService) ConfirmTwoFactor(ctx context.Context, userID int64, code string) ([]string, error) {
+	const op = "auth.ConfirmTwoFactor"
+	logger := a.log.With(slog.String("op", op), slog.Int64("userID", userID))
+
+	var recoveryCodes []string
+	err := a.txManager.Do(ctx, func(ctx context.Context) error {
+		var err error
+		recoveryCodes, err = a.confirm(ctx, userID, code)
+		return err
+	})
+	if err != nil {
+		if isTwoFactorClientError(err) {
+			logger.Warn("two-factor not confirmed", slog.Any("error", err))
+		} else {
+			logger.Error("failed to confirm two-factor", slog.Any("error", err))
+		}
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("two-factor enabled")
+	return recoveryCodes, nil
+}
+
+// DisableTwoFactor отключает второй фактор. Если он обязателен для роли пользователя,
+// возвращается ErrTwoFactorRequired. Неверный код учитывается как неудачная попытка входа.
+func (a *AuthService) DisableTwoFactor(ctx context.Context, userID int64, code string) error {
+	const op = "auth.DisableTwoFactor"
+	logger := a.log.With(slog.String("op", op), slog.Int64("userID", userID))
+
+	user, err := a.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrUserNotFound) {
+			return fmt.Errorf("%s: %w", op, ErrUserNotFound)
+		}
+		logger.Error("failed to get user", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	reservations, err := a.reserveLoginAttempt(ctx, logger, a.loginThrottleKeys(user.Email, ""))
+	if err != nil {
+		logger.Warn("two-factor attempt rejected", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	err = a.txManager.Do(ctx, func(ctx context.Context) error {
+		required, err := a.twoFactorRepo.IsTwoFactorRequired(ctx, user.Role)
+		if err != nil {
+			return err
+		}
+		if required {
+			return ErrTwoFactorRequired
+		}
+		tf, err := a.getTwoFactor(ctx, userID)
+		if err != nil {
+			return err
+		}
+		if !tf.Enabled() {
+			return ErrTwoFactorNotEnabled
+		}
+		if err := a.verifySecondFactor(ctx, tf, code); err != nil {
+			return err
+		}
+		return a.twoFactorRepo.DeleteTwoFactor(ctx, userID)
+	})
+	if err != nil {
+		if errors.Is(err, ErrInvalidTwoFactorCode) {
+			a.registerLoginFailure(ctx, logger, reservations)
+		} else {
+			a.releaseLoginAttempt(ctx, logger, reservations)
+		}
+		if isTwoFactorClientError(err) {
+			logger.Warn("two-factor not disabled", slog.Any("error", err))
+		} else {
+			logger.Error("failed to disable two-factor", slog.Any("error", err))
+		}
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	a.releaseLoginAttempt(ctx, logger, reservations)
+	logger.Info("two-factor disabled")
+	return nil
+}
+
+// SetTwoFactorRequired меняет требование второго фактора для роли. Пользователи роли без второго
+// фактора при следующем входе должны будут его подключить, а refresh для них перестаёт работать.
+func (a *AuthService) SetTwoFactorRequired(ctx context.Context, actorID int64, role models.Role, required bool) error {
+	const op = "auth.SetTwoFactorRequired"
+	logger := a.log.With(slog.String("op", op), slog.Int64("actorID", actorID), slog.String("role", string(role)), slog.Bool("required", required))
+
+	if !role.Valid() {
+		return fmt.Errorf("%s: %w", op, ErrInvalidRole)
+	}
+	if err := a.twoFactorRepo.SetTwoFactorRequired(ctx, role, required, actorID); err != nil {
+		logger.Error("failed to set two-factor requirement", slog.Any("error", err))
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	logger.Info("two-factor requirement changed")
+	return nil
+}
+
+func (a *AuthService) ListTwoFactorRequiredRoles(ctx context.Context) ([]models.Role, error) {
+	const op = "auth.ListTwoFactorRequiredRoles"
+
+	roles, err := a.twoFactorRepo.ListTwoFactorRequiredRoles(ctx)
+	if err != nil {
+		a.log.Error("failed to list two-factor requirements", slog.String("op", op), slog.Any("error", err))
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	return roles, nil
+}
+
+// checkTwoFactorRequirement возвращает ErrTwoFactorRequired, если роль пользователя требует
+// второй фактор, а он не подключён
+func (a *AuthService) checkTwoFactorRequirement(ctx context.Context, user *models.User) error {
+	required, err := a.twoFactorRepo.IsTwoFactorRequired(ctx, user.Role)
+	if err != nil || !required {
+		return err
+	}
+	tf, err := a.getTwoFactor(ctx, user.ID)
+	if err != nil {
+		return err
+	}
+	if !tf.Enabled() {
+		return ErrTwoFactorRequired
+	}
+	return nil
+}
+
+// challengeUser возвращает пользователя по действующему токену ожидания, не расходуя токен
+func (a *AuthService) challengeUser(ctx context.Context, purpose, challengeToken string) (*models.User, error) {
+	userID, err := a.tokenRepo.PeekToken(ctx, purpose, hashOneTimeToken(challengeToken))
+	if err != nil {
+		if errors.Is(err, storage.ErrTokenNotFound) {
+			return nil, ErrInvalidChallengeToken
+		}
+		return nil, fmt.Errorf("failed to get challenge token: %w", err)
+	}
+	user, err := a.userRepo.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+	return user, nil
+}
+
+// getTwoFactor возвращает секрет пользователя; если подключение не начиналось — nil без ошибки
+func (a *AuthService) getTwoFactor(ctx context.Context, userID int64) (*models.TwoFactor, error) {
+	tf, err := a.twoFactorRepo.GetTwoFactor(ctx, userID)
+	if err != nil {
+		if errors.Is(err, storage.ErrTwoFactorNotFound) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return tf, nil
+}
+
+// enroll сохраняет новый неподтверждённый секрет пользователя
+func (a *AuthService) enroll(ctx context.Context, user *models.User) (*TwoFactorEnrollment, error) {
+	tf, err := a.getTwoFactor(ctx, user.ID)
+	if err != nil {
+		return nil, err
+	}
+	if tf.Enabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := a.twoFactorRepo.SaveTwoFactorSecret(ctx, user.ID, secret); err != nil {
+		return nil, err
+	}
+	return &TwoFactorEnrollment{
+		Secret:          totp.EncodeSecret(secret),
+		ProvisioningURI: totp.ProvisioningURI(a.opts.TwoFactor.Issuer, user.Email, secret),
+	}, nil
+}
+
+// confirm включает второй фактор, выдаёт новые коды восстановления и отзывает refresh-токены,
+// полученные без второго фактора. Вызывается внутри транзакции.
+func (a *AuthService) confirm(ctx context.Context, userID int64, code string) ([]string, error) {
+	tf, err := a.getTwoFactor(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if tf == nil {
+		return nil, ErrTwoFactorNotEnabled
+	}
+	if tf.Enabled() {
+		return nil, ErrTwoFactorAlreadyEnabled
+	}
+	step, ok := totp.Validate(tf.Secret, strings.TrimSpace(code), time.Now(), a.opts.TwoFactor.Skew)
+	if !ok {
+		return nil, ErrInvalidTwoFactorCode
+	}
+	if err := a.twoFactorRepo.ConfirmTwoFactor(ctx, userID, step); err != nil {
+		return nil, err
+	}
+
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([][]byte, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		recoveryCode, err := newRecoveryCode()
+		if err != nil {
+			return nil, err
+		}
+		codes = append(codes, recoveryCode)
+		hashes = append(hashes, hashOneTimeToken(normalizeRecoveryCode(recoveryCode)))
+	}
+	if err := a.twoFactorRepo.ReplaceRecoveryCodes(ctx, userID, hashes); err != nil {
+		return nil, err
+	}
+	if err := a.refreshRepo.RevokeUserRefreshTokens(ctx, userID); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// verifySecondFactor проверяет код TOTP или код восстановления. Принятый код TOTP
+// и использованный код восстановления повторно не принимаются.
+func (a *AuthService) verifySecondFactor(ctx context.Context, tf *models.TwoFactor, code string) error {
+	code = strings.TrimSpace(code)
+	var ok bool
+	var err error
+	if step, valid := totp.Validate(tf.Secret, code, time.Now(), a.opts.TwoFactor.Skew); valid {
+		ok, err = a.twoFactorRepo.UseTwoFactorStep(ctx, tf.UserID, step)
+	} else if len(code) != totp.Digits {
+		ok, err = a.twoFactorRepo.UseRecoveryCode(ctx, tf.UserID, hashOneTimeToken(normalizeRecoveryCode(code)))
+	}
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrInvalidTwoFactorCode
+	}
+	return nil
+}
+
+// newRecoveryCode генерирует код восстановления вида XXXX-XXXX-XXXX-XXXX
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate recovery code: %w", err)
+	}
+	s := base32.StdEncoding.EncodeToString(b)
+	return s[0:4] + "-" + s[4:8] + "-" + s[8:12] + "-" + s[12:16], nil
+}
+
+// normalizeRecoveryCode приводит введённый код к виду, в котором хранится хэш
+func normalizeRecoveryCode(code string) string {
+	return strings.ToUpper(strings.NewReplacer("-", "", " ", "").Replace(code))
+}
+
+// isTwoFactorClientError сообщает, что ошибка вызвана запросом клиента, а не сбоем
+func isTwoFactorClientError(err error) bool {
+	return errors.Is(err, ErrInvalidTwoFactorCode) ||
+		errors.Is(err, ErrInvalidChallengeToken) ||
+		errors.Is(err, ErrTwoFactorAlreadyEnabled) ||
+		errors.Is(err, ErrTwoFactorNotEnabled) ||
+		errors.Is(err, ErrTwoFactorRequired)
+}
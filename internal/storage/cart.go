@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+)
+
+var ErrCartItemNotFound = errors.New("cart item not found")
+
+// CartStorage хранит корзины пользователей.
+type CartStorage interface {
+	// ListCartItems возвращает корзину пользователя, упорядоченную по названию товара.
+	// При forUpdate строки корзины блокируются до конца транзакции: параллельное оформление
+	// той же корзины ждёт и видит её уже пустой.
+	ListCartItems(ctx context.Context, userID int64, forUpdate bool) ([]*models.CartItem, error)
+	// AddCartItem добавляет quantity единиц товара и возвращает количество в корзине.
+	AddCartItem(ctx context.Context, userID, merchID int64, quantity int) (int, error)
+	// RemoveCartItem удаляет товар из корзины; товара нет в корзине — ErrCartItemNotFound.
+	RemoveCartItem(ctx context.Context, userID int64, item string) error
+	// ClearCart удаляет все товары из корзины.
+	ClearCart(ctx context.Context, userID int64) error
+}
+
+type cartRepository struct {
+	db *sql.DB
+}
+
+func NewCartRepository(db *sql.DB) CartStorage {
+	return &cartRepository{db: db}
+}
+
+func (r *cartRepository) ListCartItems(ctx context.Context, userID int64, forUpdate bool) ([]*models.CartItem, error) {
+	query := `
+		SELECT c.merch_id, m.name, m.price, c.quantity,
+		       m.archived_at IS NULL AND (m.stock IS NULL OR m.stock >= c.quantity), c.added_at
+		FROM cart_items c
+		JOIN merch m ON c.merch_id = m.id
+		WHERE c.user_id = $1
+		ORDER BY m.name`
+	if forUpdate {
+		// блокируются только строки корзины: товары блокирует покупка, в порядке названий
+		query += " FOR UPDATE OF c"
+	}
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list cart items: %w", err)
+	}
+	defer rows.Close()
+
+	var items []*models.CartItem
+	for rows.Next() {
+		item := &models.CartItem{}
+		if err := rows.Scan(&item.MerchID, &item.MerchName, &item.Price, &item.Quantity, &item.Available, &item.AddedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan cart item: %w", err)
+		}
+		items = append(items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list cart items: %w", err)
+	}
+	return items, nil
+}
+
+func (r *cartRepository) AddCartItem(ctx context.Context, userID, merchID int64, quantity int) (int, error) {
+	query := `INSERT INTO cart_items (user_id, merch_id, quantity) VALUES ($1, $2, $3)
+	          ON CONFLICT (user_id, merch_id) DO UPDATE SET quantity = cart_items.quantity + EXCLUDED.quantity
+	          RETURNING quantity`
+	var total int
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, userID, merchID, quantity).Scan(&total); err != nil {
+		return 0, fmt.Errorf("failed to add cart item: %w", err)
+	}
+	return total, nil
+}
+
+func (r *cartRepository) RemoveCartItem(ctx context.Context, userID int64, item string) error {
+	query := `DELETE FROM cart_items c USING merch m
+	          WHERE c.merch_id = m.id AND c.user_id = $1 AND m.name = $2`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, userID, item)
+	if err != nil {
+		return fmt.Errorf("failed to remove cart item: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrCartItemNotFound
+	}
+	return nil
+}
+
+func (r *cartRepository) ClearCart(ctx context.Context, userID int64) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM cart_items WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("failed to clear cart: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,61 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+)
+
+var ErrIdempotencyKeyNotFound = errors.New("idempotency key not found")
+
+// IdempotencyStorage описывает методы для работы с ключами идемпотентности.
+type IdempotencyStorage interface {
+	// SaveKey сохраняет ключ вместе с ответом в текущей транзакции.
+	// Возвращает false, если ключ для пользователя уже существует.
+	SaveKey(ctx context.Context, record *models.IdempotencyRecord) (bool, error)
+	// GetKey возвращает сохранённую запись по ключу.
+	GetKey(ctx context.Context, userID int64, key string) (*models.IdempotencyRecord, error)
+}
+
+type idempotencyRepository struct {
+	db *sql.DB
+}
+
+// NewIdempotencyRepository создаёт новый репозиторий ключей идемпотентности.
+func NewIdempotencyRepository(db *sql.DB) IdempotencyStorage {
+	return &idempotencyRepository{db: db}
+}
+
+// SaveKey вставляет ключ с ON CONFLICT DO NOTHING. Параллельный запрос с тем же ключом
+// ждёт на уникальном индексе, пока транзакция-владелец не завершится.
+func (r *idempotencyRepository) SaveKey(ctx context.Context, record *models.IdempotencyRecord) (bool, error) {
+	query := `INSERT INTO idempotency_keys (user_id, key, request_hash, response_status, response_body, created_at)
+	          VALUES ($1, $2, $3, $4, $5, NOW())
+	          ON CONFLICT (user_id, key) DO NOTHING`
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, record.UserID, record.Key, record.RequestHash, record.ResponseStatus, record.ResponseBody)
+	if err != nil {
+		return false, fmt.Errorf("failed to save idempotency key: %w", err)
+	}
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to save idempotency key: %w", err)
+	}
+	return affected > 0, nil
+}
+
+func (r *idempotencyRepository) GetKey(ctx context.Context, userID int64, key string) (*models.IdempotencyRecord, error) {
+	record := &models.IdempotencyRecord{}
+	query := `SELECT user_id, key, request_hash, response_status, response_body, created_at
+	          FROM idempotency_keys WHERE user_id = $1 AND key = $2`
+	row := conn(ctx, r.db).QueryRowContext(ctx, query, userID, key)
+	if err := row.Scan(&record.UserID, &record.Key, &record.RequestHash, &record.ResponseStatus, &record.ResponseBody, &record.CreatedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrIdempotencyKeyNotFound
+		}
+		return nil, err
+	}
+	return record, nil
+}
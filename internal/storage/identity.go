@@ -0,0 +1,49 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// ErrIdentityNotFound возвращается, если внешняя учётная запись ещё не связана с пользователем
+var ErrIdentityNotFound = errors.New("identity not found")
+
+// IdentityStorage связывает учётные записи внешних провайдеров с пользователями.
+type IdentityStorage interface {
+	// GetIdentityUserID возвращает пользователя, связанного с учётной записью, или ErrIdentityNotFound.
+	GetIdentityUserID(ctx context.Context, provider, subject string) (int64, error)
+	// LinkIdentity связывает учётную запись с пользователем; уже связанная запись не меняется.
+	LinkIdentity(ctx context.Context, provider, subject string, userID int64) error
+}
+
+type identityRepository struct {
+	db *sql.DB
+}
+
+// NewIdentityRepository создаёт новый репозиторий внешних учётных записей.
+func NewIdentityRepository(db *sql.DB) IdentityStorage {
+	return &identityRepository{db: db}
+}
+
+func (r *identityRepository) GetIdentityUserID(ctx context.Context, provider, subject string) (int64, error) {
+	query := "SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2"
+	var userID int64
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, provider, subject).Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrIdentityNotFound
+		}
+		return 0, fmt.Errorf("failed to get identity: %w", err)
+	}
+	return userID, nil
+}
+
+func (r *identityRepository) LinkIdentity(ctx context.Context, provider, subject string, userID int64) error {
+	query := `INSERT INTO user_identities (provider, subject, user_id, created_at) VALUES ($1, $2, $3, NOW())
+	          ON CONFLICT (provider, subject) DO NOTHING`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, provider, subject, userID); err != nil {
+		return fmt.Errorf("failed to link identity: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,153 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+)
+
+var (
+	ErrUnbalancedEntry       = errors.New("ledger entry is not balanced")
+	ErrLedgerAccountNotFound = errors.New("ledger account not found")
+	ErrTransactionRequired   = errors.New("operation requires a transaction")
+)
+
+// LedgerStorage описывает методы для работы с журналом двойной записи.
+type LedgerStorage interface {
+	// CreateWallet создаёт счёт-кошелёк пользователя.
+	CreateWallet(ctx context.Context, userID int64) error
+	// PostEntry записывает сбалансированную запись журнала и обновляет кэш coin_balance кошельков.
+	// Должен вызываться внутри транзакции TxManager.
+	PostEntry(ctx context.Context, entry *models.LedgerEntry) (int64, error)
+	// GetWalletBalance возвращает баланс кошелька, вычисленный по проводкам.
+	GetWalletBalance(ctx context.Context, userID int64) (int, error)
+}
+
+type ledgerRepository struct {
+	db *sql.DB
+}
+
+// NewLedgerRepository создаёт новый репозиторий журнала.
+func NewLedgerRepository(db *sql.DB) LedgerStorage {
+	return &ledgerRepository{db: db}
+}
+
+func (r *ledgerRepository) CreateWallet(ctx context.Context, userID int64) error {
+	query := `INSERT INTO ledger_accounts (kind, user_id, created_at) VALUES ('user_wallet', $1, NOW())`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to create wallet: %w", err)
+	}
+	return nil
+}
+
+// PostEntry проверяет, что сумма проводок равна нулю, сохраняет запись и проводки,
+// затем сдвигает coin_balance затронутых кошельков на сумму их проводок.
+func (r *ledgerRepository) PostEntry(ctx context.Context, entry *models.LedgerEntry) (int64, error) {
+	if !InTransaction(ctx) {
+		return 0, ErrTransactionRequired
+	}
+	if err := validateEntry(entry); err != nil {
+		return 0, err
+	}
+
+	q := conn(ctx, r.db)
+
+	var entryID int64
+	err := q.QueryRowContext(ctx,
+		`INSERT INTO ledger_entries (kind, reference, reason, created_at) VALUES ($1, $2, $3, NOW()) RETURNING id`,
+		entry.Kind, nullString(entry.Reference), nullString(entry.Reason),
+	).Scan(&entryID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create ledger entry: %w", err)
+	}
+
+	for _, p := range entry.Postings {
+		var res sql.Result
+		if p.Account.Code != "" {
+			res, err = q.ExecContext(ctx,
+				`INSERT INTO ledger_postings (entry_id, account_id, amount)
+				 SELECT $1, id, $2 FROM ledger_accounts WHERE code = $3`,
+				entryID, p.Amount, p.Account.Code)
+		} else {
+			res, err = q.ExecContext(ctx,
+				`INSERT INTO ledger_postings (entry_id, account_id, amount)
+				 SELECT $1, id, $2 FROM ledger_accounts WHERE user_id = $3`,
+				entryID, p.Amount, p.Account.UserID)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to create ledger posting: %w", err)
+		}
+		if err := expectOneRow(res, ErrLedgerAccountNotFound); err != nil {
+			return 0, err
+		}
+
+		if p.Account.Code != "" {
+			continue
+		}
+		// Кэш баланса кошелька; CHECK (coin_balance >= 0) не даст уйти в минус
+		res, err = q.ExecContext(ctx,
+			"UPDATE users SET coin_balance = coin_balance + $1 WHERE id = $2", p.Amount, p.Account.UserID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to update cached balance: %w", err)
+		}
+		if err := expectOneRow(res, ErrUserNotFound); err != nil {
+			return 0, err
+		}
+	}
+
+	entry.ID = entryID
+	return entryID, nil
+}
+
+func (r *ledgerRepository) GetWalletBalance(ctx context.Context, userID int64) (int, error) {
+	var balance int
+	query := `
+		SELECT COALESCE(SUM(p.amount), 0)
+		FROM ledger_accounts a
+		LEFT JOIN ledger_postings p ON p.account_id = a.id
+		WHERE a.user_id = $1
+		GROUP BY a.id`
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, userID).Scan(&balance); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrLedgerAccountNotFound
+		}
+		return 0, err
+	}
+	return balance, nil
+}
+
+// validateEntry проверяет запись до обращения к БД: минимум две ненулевые проводки с нулевой суммой
+func validateEntry(entry *models.LedgerEntry) error {
+	if len(entry.Postings) < 2 {
+		return fmt.Errorf("%w: at least two postings required", ErrUnbalancedEntry)
+	}
+	sum := 0
+	for _, p := range entry.Postings {
+		if p.Amount == 0 {
+			return fmt.Errorf("%w: zero posting", ErrUnbalancedEntry)
+		}
+		sum += p.Amount
+	}
+	if sum != 0 {
+		return fmt.Errorf("%w: postings sum to %d", ErrUnbalancedEntry, sum)
+	}
+	return nil
+}
+
+func expectOneRow(res sql.Result, notFound error) error {
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return notFound
+	}
+	return nil
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
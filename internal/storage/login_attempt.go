@@ -0,0 +1,224 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+)
+
+// типы хранилища попыток входа
+const (
+	LoginAttemptStoreMemory   = "memory"
+	LoginAttemptStorePostgres = "postgres"
+)
+
+// LoginAttemptStorage хранит счётчики неудачных попыток входа.
+type LoginAttemptStorage interface {
+	// GetLoginAttempt возвращает состояние ключа; для неизвестного ключа — нулевое состояние.
+	GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error)
+	// ReserveLoginAttempt атомарно учитывает попытку до проверки пароля: увеличивает счётчик и,
+	// если он достиг maxFailures (0 — без предела), сразу блокирует ключ до lockout. Если предыдущая
+	// попытка была раньше resetBefore, счётчик начинается заново. Пока ключ заблокирован, счётчик
+	// не меняется, а reserved == false; в обоих случаях возвращается состояние ключа.
+	ReserveLoginAttempt(ctx context.Context, key string, now, resetBefore time.Time, maxFailures int, lockout time.Time) (attempt *models.LoginAttempt, reserved bool, err error)
+	// ReleaseLoginAttempt отменяет учтённую попытку, которая не оказалась неудачной: уменьшает счётчик
+	// и снимает блокировку lockedUntil, если её поставил этот резерв.
+	ReleaseLoginAttempt(ctx context.Context, key string, lockedUntil time.Time) error
+	// SetLoginLockout блокирует ключ до until; более поздняя блокировка не сокращается.
+	SetLoginLockout(ctx context.Context, key string, until time.Time) error
+	// ResetLoginAttempts сбрасывает счётчик после успешного входа.
+	ResetLoginAttempts(ctx context.Context, key string) error
+}
+
+// NewLoginAttemptStorage создаёт хранилище попыток входа по типу из конфига:
+// memory — в памяти процесса (один экземпляр сервиса), postgres — общее для всех реплик.
+func NewLoginAttemptStorage(store string, db *sql.DB) (LoginAttemptStorage, error) {
+	switch store {
+	case LoginAttemptStoreMemory, "":
+		return NewMemoryLoginAttemptStorage(), nil
+	case LoginAttemptStorePostgres:
+		return NewLoginAttemptRepository(db), nil
+	default:
+		return nil, fmt.Errorf("unknown login attempt store %q", store)
+	}
+}
+
+type loginAttemptRepository struct {
+	db *sql.DB
+}
+
+// NewLoginAttemptRepository создаёт хранилище попыток входа в Postgres.
+func NewLoginAttemptRepository(db *sql.DB) LoginAttemptStorage {
+	return &loginAttemptRepository{db: db}
+}
+
+func (r *loginAttemptRepository) GetLoginAttempt(ctx context.Context, key string) (*models.LoginAttempt, error) {
+	query := "SELECT failures, last_failure_at, locked_until FROM login_attempts WHERE key = $1"
+	attempt := &models.LoginAttempt{Key: key}
+	var lockedUntil sql.NullTime
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, key).Scan(&attempt.Failures, &attempt.LastFailureAt, &lockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return attempt, nil
+		}
+		return nil, fmt.Errorf("failed to get login attempt: %w", err)
+	}
+	attempt.LockedUntil = lockedUntil.Time
+	return attempt, nil
+}
+
+// ReserveLoginAttempt выполняет upsert одним запросом: строка блокируется на время обновления,
+// поэтому параллельные попытки с разных реплик не проходят мимо предела. Если ключ заблокирован,
+// условие WHERE не даёт обновить строку и запрос ничего не возвращает.
+func (r *loginAttemptRepository) ReserveLoginAttempt(ctx context.Context, key string, now, resetBefore time.Time, maxFailures int, lockout time.Time) (*models.LoginAttempt, bool, error) {
+	query := `
+		INSERT INTO login_attempts (key, failures, last_failure_at, locked_until)
+		VALUES ($1, 1, $2, CASE WHEN $4 = 1 THEN $5::timestamptz END)
+		ON CONFLICT (key) DO UPDATE SET
+			failures = CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END,
+			last_failure_at = EXCLUDED.last_failure_at,
+			locked_until = CASE
+				WHEN $4 > 0 AND (CASE WHEN login_attempts.last_failure_at < $3 THEN 1 ELSE login_attempts.failures + 1 END) >= $4 THEN $5::timestamptz
+				ELSE login_attempts.locked_until
+			END
+		WHERE login_attempts.locked_until IS NULL OR login_attempts.locked_until <= $2
+		RETURNING failures, last_failure_at, locked_until`
+	attempt := &models.LoginAttempt{Key: key}
+	var lockedUntil sql.NullTime
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, key, now, resetBefore, maxFailures, lockout).Scan(&attempt.Failures, &attempt.LastFailureAt, &lockedUntil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			attempt, err := r.GetLoginAttempt(ctx, key)
+			return attempt, false, err
+		}
+		return nil, false, fmt.Errorf("failed to reserve login attempt: %w", err)
+	}
+	attempt.LockedUntil = lockedUntil.Time
+	return attempt, true, nil
+}
+
+func (r *loginAttemptRepository) ReleaseLoginAttempt(ctx context.Context, key string, lockedUntil time.Time) error {
+	query := `
+		UPDATE login_attempts SET
+			failures = GREATEST(failures - 1, 0),
+			locked_until = CASE WHEN locked_until = $2 THEN NULL ELSE locked_until END
+		WHERE key = $1`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, key, lockedUntil); err != nil {
+		return fmt.Errorf("failed to release login attempt: %w", err)
+	}
+	return nil
+}
+
+func (r *loginAttemptRepository) SetLoginLockout(ctx context.Context, key string, until time.Time) error {
+	// GREATEST игнорирует NULL, поэтому первая блокировка просто записывается
+	query := "UPDATE login_attempts SET locked_until = GREATEST(locked_until, $2) WHERE key = $1"
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, key, until); err != nil {
+		return fmt.Errorf("failed to set login lockout: %w", err)
+	}
+	return nil
+}
+
+func (r *loginAttemptRepository) ResetLoginAttempts(ctx context.Context, key string) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM login_attempts WHERE key = $1", key); err != nil {
+		return fmt.Errorf("failed to reset login attempts: %w", err)
+	}
+	return nil
+}
+
+// memoryPruneThreshold — при таком числе ключей из памяти удаляются устаревшие записи
+const memoryPruneThreshold = 10000
+
+type memoryLoginAttemptStorage struct {
+	mu       sync.Mutex
+	attempts map[string]*models.LoginAttempt
+}
+
+// NewMemoryLoginAttemptStorage создаёт хранилище попыток входа в памяти процесса.
+// Подходит только для одного экземпляра сервиса: реплики не видят счётчики друг друга.
+func NewMemoryLoginAttemptStorage() LoginAttemptStorage {
+	return &memoryLoginAttemptStorage{attempts: make(map[string]*models.LoginAttempt)}
+}
+
+func (s *memoryLoginAttemptStorage) GetLoginAttempt(_ context.Context, key string) (*models.LoginAttempt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempt, ok := s.attempts[key]; ok {
+		copied := *attempt
+		return &copied, nil
+	}
+	return &models.LoginAttempt{Key: key}, nil
+}
+
+func (s *memoryLoginAttemptStorage) ReserveLoginAttempt(_ context.Context, key string, now, resetBefore time.Time, maxFailures int, lockout time.Time) (*models.LoginAttempt, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.attempts) >= memoryPruneThreshold {
+		s.prune(now, resetBefore)
+	}
+	attempt, ok := s.attempts[key]
+	if !ok {
+		attempt = &models.LoginAttempt{Key: key}
+		s.attempts[key] = attempt
+	}
+	if attempt.LockedUntil.After(now) {
+		copied := *attempt
+		return &copied, false, nil
+	}
+	if attempt.LastFailureAt.Before(resetBefore) {
+		attempt.Failures = 0
+	}
+	attempt.Failures++
+	attempt.LastFailureAt = now
+	if maxFailures > 0 && attempt.Failures >= maxFailures {
+		attempt.LockedUntil = lockout
+	}
+	copied := *attempt
+	return &copied, true, nil
+}
+
+func (s *memoryLoginAttemptStorage) ReleaseLoginAttempt(_ context.Context, key string, lockedUntil time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	attempt, ok := s.attempts[key]
+	if !ok {
+		return nil
+	}
+	if attempt.Failures > 0 {
+		attempt.Failures--
+	}
+	if attempt.LockedUntil.Equal(lockedUntil) {
+		attempt.LockedUntil = time.Time{}
+	}
+	return nil
+}
+
+func (s *memoryLoginAttemptStorage) SetLoginLockout(_ context.Context, key string, until time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if attempt, ok := s.attempts[key]; ok && until.After(attempt.LockedUntil) {
+		attempt.LockedUntil = until
+	}
+	return nil
+}
+
+func (s *memoryLoginAttemptStorage) ResetLoginAttempts(_ context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.attempts, key)
+	return nil
+}
+
+// prune удаляет ключи без действующей блокировки, неудачи которых вышли за окно;
+// так перебор со множества адресов не растит память бесконечно
+func (s *memoryLoginAttemptStorage) prune(now, resetBefore time.Time) {
+	for key, attempt := range s.attempts {
+		if attempt.LastFailureAt.Before(resetBefore) && !attempt.LockedUntil.After(now) {
+			delete(s.attempts, key)
+		}
+	}
+}
@@ -4,14 +4,38 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 
+	"github.com/lib/pq"
 	"github.com/linemk/avito-shop/internal/domain/models"
 )
 
 // MerchStorage описывает методы для работы с таблицей мерча.
 type MerchStorage interface {
-	// GetMerchByName получает мерч по его названию, используя транзакцию.
-	GetMerchByName(ctx context.Context, tx *sql.Tx, name string) (*models.Merch, error)
+	// GetMerchByName получает товар каталога по его названию для покупки; архивный товар не находится.
+	// Строка блокируется до конца транзакции покупки: цена не меняется, а остаток можно списать.
+	GetMerchByName(ctx context.Context, name string) (*models.Merch, error)
+	// ListMerch возвращает товары, упорядоченные по названию; архивные — только при includeArchived.
+	ListMerch(ctx context.Context, includeArchived bool) ([]*models.Merch, error)
+	// GetMerchByNameForUpdate получает товар, в том числе архивный, с блокировкой строки для изменения.
+	GetMerchByNameForUpdate(ctx context.Context, name string) (*models.Merch, error)
+	// CreateMerch добавляет товар и заполняет его ID; название занято — ErrMerchExists.
+	CreateMerch(ctx context.Context, merch *models.Merch) error
+	// UpdateMerchPrice меняет текущую цену товара.
+	UpdateMerchPrice(ctx context.Context, merchID int64, price int) error
+	// SetMerchArchived архивирует товар или возвращает его в каталог и заполняет merch.ArchivedAt.
+	SetMerchArchived(ctx context.Context, merch *models.Merch, archived bool) error
+	// CreateMerchPrice записывает цену в историю; она действует с начала текущей транзакции.
+	CreateMerchPrice(ctx context.Context, price *models.MerchPrice) error
+	// ListMerchPrices возвращает историю цен товара, в том числе архивного, новые записи первыми.
+	ListMerchPrices(ctx context.Context, name string) ([]*models.MerchPrice, error)
+	// DecrementMerchStock списывает quantity единиц и возвращает остаток; nil — остаток не учитывается.
+	// Если на складе меньше quantity — ErrOutOfStock, остаток не меняется.
+	DecrementMerchStock(ctx context.Context, merchID int64, quantity int) (*int, error)
+	// RestockMerch добавляет quantity единиц и возвращает остаток; для товара без учёта остатка учёт начинается с quantity.
+	RestockMerch(ctx context.Context, merchID int64, quantity int) (int, error)
+	// SetMerchStock задаёт остаток по результатам инвентаризации; nil выключает учёт остатка.
+	SetMerchStock(ctx context.Context, merchID int64, stock *int) error
 }
 
 // merchRepository — конкретная реализация интерфейса MerchStorage.
@@ -24,18 +48,243 @@ func NewMerchRepository(db *sql.DB) MerchStorage {
 	return &merchRepository{db: db}
 }
 
-var ErrMerchNotFound = errors.New("merch not found")
+var (
+	ErrMerchNotFound = errors.New("merch not found")
+	ErrMerchExists   = errors.New("merch already exists")
+	ErrOutOfStock    = errors.New("merch is out of stock")
+)
+
+// merchColumns — столбцы merch в порядке, который ожидает scanMerch
+const merchColumns = "id, name, price, description, category, archived_at, stock"
 
-// GetMerchByName ищет мерч по имени в таблице merch.
-func (r *merchRepository) GetMerchByName(ctx context.Context, tx *sql.Tx, name string) (*models.Merch, error) {
+// GetMerchByName ищет товар каталога по имени в таблице merch.
+func (r *merchRepository) GetMerchByName(ctx context.Context, name string) (*models.Merch, error) {
 	merch := &models.Merch{}
-	query := "SELECT id, name, price FROM merch WHERE name = $1"
-	row := tx.QueryRowContext(ctx, query, name)
+	// FOR NO KEY UPDATE, а не FOR SHARE: списание остатка в той же транзакции не повышает блокировку,
+	// поэтому параллельные покупки одного товара ждут друг друга, а не попадают во взаимоблокировку
+	query := "SELECT id, name, price FROM merch WHERE name = $1 AND archived_at IS NULL FOR NO KEY UPDATE"
+	row := conn(ctx, r.db).QueryRowContext(ctx, query, name)
 	if err := row.Scan(&merch.ID, &merch.Name, &merch.Price); err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrMerchNotFound
 		}
 		return nil, err
 	}
+	merch.Available = true
+	return merch, nil
+}
+
+// ListMerch читает каталог целиком: товаров немного, фильтры и страницы применяет сервис
+func (r *merchRepository) ListMerch(ctx context.Context, includeArchived bool) ([]*models.Merch, error) {
+	query := "SELECT " + merchColumns + " FROM merch"
+	if !includeArchived {
+		query += " WHERE archived_at IS NULL"
+	}
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query+" ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list merch: %w", err)
+	}
+	defer rows.Close()
+
+	var items []*models.Merch
+	for rows.Next() {
+		merch, err := scanMerch(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan merch: %w", err)
+		}
+		items = append(items, merch)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list merch: %w", err)
+	}
+	return items, nil
+}
+
+func (r *merchRepository) GetMerchByNameForUpdate(ctx context.Context, name string) (*models.Merch, error) {
+	row := conn(ctx, r.db).QueryRowContext(ctx, "SELECT "+merchColumns+" FROM merch WHERE name = $1 FOR UPDATE", name)
+	merch, err := scanMerch(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrMerchNotFound
+		}
+		return nil, err
+	}
+	return merch, nil
+}
+
+func (r *merchRepository) CreateMerch(ctx context.Context, merch *models.Merch) error {
+	query := `INSERT INTO merch (name, price, description, category) VALUES ($1, $2, $3, $4) RETURNING id`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, merch.Name, merch.Price, merch.Description, merch.Category).Scan(&merch.ID)
+	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == pgUniqueViolation {
+			return ErrMerchExists
+		}
+		return fmt.Errorf("failed to create merch: %w", err)
+	}
+	merch.Available = true
+	return nil
+}
+
+func (r *merchRepository) UpdateMerchPrice(ctx context.Context, merchID int64, price int) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE merch SET price = $2 WHERE id = $1", merchID, price)
+	if err != nil {
+		return fmt.Errorf("failed to update merch price: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrMerchNotFound
+	}
+	return nil
+}
+
+func (r *merchRepository) SetMerchArchived(ctx context.Context, merch *models.Merch, archived bool) error {
+	// архивация повторно не сдвигает время первой архивации
+	query := "UPDATE merch SET archived_at = COALESCE(archived_at, NOW()) WHERE id = $1 RETURNING archived_at"
+	if !archived {
+		query = "UPDATE merch SET archived_at = NULL WHERE id = $1 RETURNING archived_at"
+	}
+	var archivedAt sql.NullTime
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, merch.ID).Scan(&archivedAt); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrMerchNotFound
+		}
+		return fmt.Errorf("failed to archive merch: %w", err)
+	}
+	merch.ArchivedAt = nil
+	if archivedAt.Valid {
+		merch.ArchivedAt = &archivedAt.Time
+	}
+	merch.Available = !archived
+	return nil
+}
+
+func (r *merchRepository) CreateMerchPrice(ctx context.Context, price *models.MerchPrice) error {
+	// NOW() — начало транзакции, как created_at заказов, поэтому заказ и цена сравниваются по одним часам
+	query := `INSERT INTO merch_price_history (merch_id, price, valid_from, changed_by)
+	          VALUES ($1, $2, NOW(), $3) RETURNING id, valid_from`
+	var changedBy sql.NullInt64
+	if price.ChangedBy != nil {
+		changedBy = sql.NullInt64{Int64: *price.ChangedBy, Valid: true}
+	}
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, price.MerchID, price.Price, changedBy).Scan(&price.ID, &price.ValidFrom)
+	if err != nil {
+		return fmt.Errorf("failed to create merch price: %w", err)
+	}
+	return nil
+}
+
+// ListMerchPrices читает историю через LEFT JOIN от merch: без строк — товара нет,
+// строка без записи истории — товар есть, но история пуста
+func (r *merchRepository) ListMerchPrices(ctx context.Context, name string) ([]*models.MerchPrice, error) {
+	query := `
+		SELECT h.id, m.id, h.price, h.valid_from, h.changed_by
+		FROM merch m
+		LEFT JOIN merch_price_history h ON h.merch_id = m.id
+		WHERE m.name = $1
+		ORDER BY h.valid_from DESC, h.id DESC`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list merch prices: %w", err)
+	}
+	defer rows.Close()
+
+	found := false
+	prices := []*models.MerchPrice{}
+	for rows.Next() {
+		found = true
+		p := &models.MerchPrice{}
+		var id, price, changedBy sql.NullInt64
+		var validFrom sql.NullTime
+		if err := rows.Scan(&id, &p.MerchID, &price, &validFrom, &changedBy); err != nil {
+			return nil, fmt.Errorf("failed to scan merch price: %w", err)
+		}
+		if !id.Valid {
+			continue
+		}
+		p.ID, p.Price, p.ValidFrom = id.Int64, int(price.Int64), validFrom.Time
+		if changedBy.Valid {
+			p.ChangedBy = &changedBy.Int64
+		}
+		prices = append(prices, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list merch prices: %w", err)
+	}
+	if !found {
+		return nil, ErrMerchNotFound
+	}
+	return prices, nil
+}
+
+func (r *merchRepository) DecrementMerchStock(ctx context.Context, merchID int64, quantity int) (*int, error) {
+	// остаток NULL не учитывается: NULL - quantity остаётся NULL
+	query := "UPDATE merch SET stock = stock - $2 WHERE id = $1 AND (stock IS NULL OR stock >= $2) RETURNING stock"
+	var stock sql.NullInt64
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, merchID, quantity).Scan(&stock); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOutOfStock
+		}
+		return nil, fmt.Errorf("failed to decrement merch stock: %w", err)
+	}
+	if !stock.Valid {
+		return nil, nil
+	}
+	remaining := int(stock.Int64)
+	return &remaining, nil
+}
+
+func (r *merchRepository) RestockMerch(ctx context.Context, merchID int64, quantity int) (int, error) {
+	var stock int
+	err := conn(ctx, r.db).QueryRowContext(ctx,
+		"UPDATE merch SET stock = COALESCE(stock, 0) + $2 WHERE id = $1 RETURNING stock", merchID, quantity,
+	).Scan(&stock)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrMerchNotFound
+		}
+		return 0, fmt.Errorf("failed to restock merch: %w", err)
+	}
+	return stock, nil
+}
+
+func (r *merchRepository) SetMerchStock(ctx context.Context, merchID int64, stock *int) error {
+	var value sql.NullInt64
+	if stock != nil {
+		value = sql.NullInt64{Int64: int64(*stock), Valid: true}
+	}
+	res, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE merch SET stock = $2 WHERE id = $1", merchID, value)
+	if err != nil {
+		return fmt.Errorf("failed to set merch stock: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrMerchNotFound
+	}
+	return nil
+}
+
+// scanMerch читает товар из строки запроса; sql.ErrNoRows возвращается без обёртки
+func scanMerch(row rowScanner) (*models.Merch, error) {
+	merch := &models.Merch{}
+	var archivedAt sql.NullTime
+	var stock sql.NullInt64
+	if err := row.Scan(&merch.ID, &merch.Name, &merch.Price, &merch.Description, &merch.Category, &archivedAt, &stock); err != nil {
+		return nil, err
+	}
+	if archivedAt.Valid {
+		merch.ArchivedAt = &archivedAt.Time
+	}
+	if stock.Valid {
+		remaining := int(stock.Int64)
+		merch.Stock = &remaining
+	}
+	merch.Available = merch.ArchivedAt == nil && (merch.Stock == nil || *merch.Stock > 0)
 	return merch, nil
 }
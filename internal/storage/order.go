@@ -10,8 +10,8 @@ import (
 
 // OrderStorage описывает методы для работы с заказами.
 type OrderStorage interface {
-	// CreateOrder вставляет новый заказ в таблицу orders с использованием транзакции.
-	CreateOrder(ctx context.Context, tx *sql.Tx, userID int64, merchID int64, quantity int, totalPrice int) error
+	// CreateOrder вставляет новый заказ в таблицу orders и возвращает его ID.
+	CreateOrder(ctx context.Context, userID int64, merchID int64, quantity int, totalPrice int) (int64, error)
 	// GetOrdersByUserID возвращает список заказов для указанного пользователя, с JOIN для получения имени товара.
 	GetOrdersByUserID(ctx context.Context, userID int64) ([]*models.Order, error)
 }
@@ -27,14 +27,14 @@ func NewOrderRepository(db *sql.DB) OrderStorage {
 }
 
 // CreateOrder вставляет новый заказ в таблицу orders.
-func (r *orderRepository) CreateOrder(ctx context.Context, tx *sql.Tx, userID int64, merchID int64, quantity int, totalPrice int) error {
+func (r *orderRepository) CreateOrder(ctx context.Context, userID int64, merchID int64, quantity int, totalPrice int) (int64, error) {
 	query := `INSERT INTO orders (user_id, merch_id, quantity, total_price, created_at) 
-	          VALUES ($1, $2, $3, $4, NOW())`
-	_, err := tx.ExecContext(ctx, query, userID, merchID, quantity, totalPrice)
-	if err != nil {
-		return fmt.Errorf("failed to create order: %w", err)
+	          VALUES ($1, $2, $3, $4, NOW()) RETURNING id`
+	var id int64
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, userID, merchID, quantity, totalPrice).Scan(&id); err != nil {
+		return 0, fmt.Errorf("failed to create order: %w", err)
 	}
-	return nil
+	return id, nil
 }
 
 // GetOrdersByUserID возвращает список заказов для пользователя с JOIN, чтобы получить имя товара.
@@ -45,7 +45,7 @@ func (r *orderRepository) GetOrdersByUserID(ctx context.Context, userID int64) (
 		JOIN merch m ON o.merch_id = m.id
 		WHERE o.user_id = $1
 		ORDER BY o.created_at DESC`
-	rows, err := r.db.QueryContext(ctx, query, userID)
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, err
 	}
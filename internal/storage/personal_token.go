@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+)
+
+// ErrPersonalTokenNotFound возвращается, если токена нет, он отозван, истёк
+// или выдан до «выхода на всех устройствах»
+var ErrPersonalTokenNotFound = errors.New("personal token not found")
+
+// activePersonalToken — условие для действующего токена; t — personal_tokens, u — users.
+// Токены, выданные до tokens_valid_after (выход на всех устройствах, смена пароля), не действуют,
+// как и access-токены.
+const activePersonalToken = `t.revoked_at IS NULL
+	AND (t.expires_at IS NULL OR t.expires_at > NOW())
+	AND (u.tokens_valid_after IS NULL OR t.created_at > u.tokens_valid_after)`
+
+// PersonalTokenStorage описывает хранение персональных токенов доступа.
+type PersonalTokenStorage interface {
+	// CreatePersonalToken сохраняет токен и заполняет ID и CreatedAt.
+	CreatePersonalToken(ctx context.Context, token *models.PersonalToken) error
+	// ListPersonalTokens возвращает действующие токены пользователя, новые первыми.
+	ListPersonalTokens(ctx context.Context, userID int64) ([]*models.PersonalToken, error)
+	// GetPersonalTokenByHash возвращает действующий токен по хэшу или ErrPersonalTokenNotFound.
+	GetPersonalTokenByHash(ctx context.Context, tokenHash []byte) (*models.PersonalToken, error)
+	// RevokePersonalToken отзывает токен пользователя; чужой или уже отозванный токен — ErrPersonalTokenNotFound.
+	RevokePersonalToken(ctx context.Context, userID, tokenID int64) error
+	// TouchPersonalToken запоминает время последнего использования токена.
+	TouchPersonalToken(ctx context.Context, tokenID int64) error
+}
+
+type personalTokenRepository struct {
+	db *sql.DB
+}
+
+// NewPersonalTokenRepository создаёт новый репозиторий персональных токенов.
+func NewPersonalTokenRepository(db *sql.DB) PersonalTokenStorage {
+	return &personalTokenRepository{db: db}
+}
+
+func (r *personalTokenRepository) CreatePersonalToken(ctx context.Context, token *models.PersonalToken) error {
+	query := `INSERT INTO personal_tokens (user_id, name, scopes, token_hash, expires_at, created_at)
+	          VALUES ($1, $2, $3, $4, $5, NOW()) RETURNING id, created_at`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		token.UserID, token.Name, pq.Array(scopeStrings(token.Scopes)), token.TokenHash, token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create personal token: %w", err)
+	}
+	return nil
+}
+
+func (r *personalTokenRepository) ListPersonalTokens(ctx context.Context, userID int64) ([]*models.PersonalToken, error) {
+	query := `
+		SELECT t.id, t.user_id, t.name, t.scopes, t.created_at, t.expires_at, t.last_used_at
+		FROM personal_tokens t JOIN users u ON u.id = t.user_id
+		WHERE t.user_id = $1 AND ` + activePersonalToken + `
+		ORDER BY t.created_at DESC, t.id DESC`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list personal tokens: %w", err)
+	}
+	defer rows.Close()
+
+	var tokens []*models.PersonalToken
+	for rows.Next() {
+		token, err := scanPersonalToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		tokens = append(tokens, token)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list personal tokens: %w", err)
+	}
+	return tokens, nil
+}
+
+func (r *personalTokenRepository) GetPersonalTokenByHash(ctx context.Context, tokenHash []byte) (*models.PersonalToken, error) {
+	query := `
+		SELECT t.id, t.user_id, t.name, t.scopes, t.created_at, t.expires_at, t.last_used_at
+		FROM personal_tokens t JOIN users u ON u.id = t.user_id
+		WHERE t.token_hash = $1 AND ` + activePersonalToken
+	token, err := scanPersonalToken(conn(ctx, r.db).QueryRowContext(ctx, query, tokenHash))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrPersonalTokenNotFound
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+func (r *personalTokenRepository) RevokePersonalToken(ctx context.Context, userID, tokenID int64) error {
+	query := "UPDATE personal_tokens SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL"
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, tokenID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke personal token: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrPersonalTokenNotFound
+	}
+	return nil
+}
+
+func (r *personalTokenRepository) TouchPersonalToken(ctx context.Context, tokenID int64) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE personal_tokens SET last_used_at = NOW() WHERE id = $1", tokenID); err != nil {
+		return fmt.Errorf("failed to update personal token: %w", err)
+	}
+	return nil
+}
+
+// scanPersonalToken читает токен из строки запроса; sql.ErrNoRows возвращается без обёртки
+func scanPersonalToken(row rowScanner) (*models.PersonalToken, error) {
+	token := &models.PersonalToken{}
+	var scopes []string
+	var expiresAt, lastUsedAt sql.NullTime
+	err := row.Scan(&token.ID, &token.UserID, &token.Name, pq.Array(&scopes), &token.CreatedAt, &expiresAt, &lastUsedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan personal token: %w", err)
+	}
+	token.Scopes = make([]models.Scope, 0, len(scopes))
+	for _, scope := range scopes {
+		token.Scopes = append(token.Scopes, models.Scope(scope))
+	}
+	if expiresAt.Valid {
+		token.ExpiresAt = &expiresAt.Time
+	}
+	if lastUsedAt.Valid {
+		token.LastUsedAt = &lastUsedAt.Time
+	}
+	return token, nil
+}
+
+// scopeStrings преобразует права в строки для столбца TEXT[]
+func scopeStrings(scopes []models.Scope) []string {
+	s := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		s = append(s, string(scope))
+	}
+	return s
+}
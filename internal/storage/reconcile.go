@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+)
+
+// ReconcileStorage описывает выборки для сверки балансов с историей операций.
+type ReconcileStorage interface {
+	// ListBalanceFacts возвращает данные для сверки по всем пользователям.
+	ListBalanceFacts(ctx context.Context) ([]*models.BalanceFacts, error)
+	// GetBalanceFactsByUserID возвращает данные для сверки по одному пользователю.
+	GetBalanceFactsByUserID(ctx context.Context, userID int64) (*models.BalanceFacts, error)
+	// ListOrderPriceMismatches возвращает заказы, сумма которых не равна quantity * price
+	// по цене, действовавшей на момент заказа.
+	ListOrderPriceMismatches(ctx context.Context) ([]*models.OrderPriceMismatch, error)
+}
+
+type reconcileRepository struct {
+	db *sql.DB
+}
+
+// NewReconcileRepository создаёт новый репозиторий сверки.
+func NewReconcileRepository(db *sql.DB) ReconcileStorage {
+	return &reconcileRepository{db: db}
+}
+
+const balanceFactsQuery = `
+	SELECT u.id, u.username, u.coin_balance,
+		COALESCE((SELECT SUM(p.amount)
+			FROM ledger_postings p
+			JOIN ledger_entries e ON e.id = p.entry_id
+			JOIN ledger_accounts a ON a.id = p.account_id
+			WHERE a.user_id = u.id AND e.kind IN ('signup_grant', 'admin_grant')), 0) AS grants,
+		EXISTS (SELECT 1 FROM ledger_entries e
+			WHERE e.kind = 'opening_balance' AND e.reference = 'user:' || u.id) AS legacy,
+		COALESCE((SELECT SUM(amount) FROM coin_transactions
+			WHERE user_id = u.id AND type = 'transfer_received'), 0) AS received,
+		COALESCE((SELECT SUM(amount) FROM coin_transactions
+			WHERE user_id = u.id AND type = 'transfer_sent'), 0) AS sent,
+		COALESCE((SELECT SUM(total_price) FROM orders WHERE user_id = u.id), 0) AS spent,
+		COALESCE((SELECT SUM(p.amount)
+			FROM ledger_postings p
+			JOIN ledger_accounts a ON a.id = p.account_id
+			WHERE a.user_id = u.id), 0) AS ledger_balance
+	FROM users u`
+
+func (r *reconcileRepository) ListBalanceFacts(ctx context.Context) ([]*models.BalanceFacts, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, balanceFactsQuery+" ORDER BY u.id")
+	if err != nil {
+		return nil, fmt.Errorf("failed to query balance facts: %w", err)
+	}
+	defer rows.Close()
+
+	var facts []*models.BalanceFacts
+	for rows.Next() {
+		f, err := scanBalanceFacts(rows)
+		if err != nil {
+			return nil, err
+		}
+		facts = append(facts, f)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return facts, nil
+}
+
+func (r *reconcileRepository) GetBalanceFactsByUserID(ctx context.Context, userID int64) (*models.BalanceFacts, error) {
+	row := conn(ctx, r.db).QueryRowContext(ctx, balanceFactsQuery+" WHERE u.id = $1", userID)
+	f, err := scanBalanceFacts(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+	return f, nil
+}
+
+// ListOrderPriceMismatches сравнивает сумму заказа с ценой из merch_price_history на момент заказа;
+// для заказа раньше первой записи истории берётся текущая цена
+func (r *reconcileRepository) ListOrderPriceMismatches(ctx context.Context) ([]*models.OrderPriceMismatch, error) {
+	query := `
+		SELECT o.id, o.user_id, m.name, o.quantity, o.total_price, o.quantity * COALESCE(p.price, m.price)
+		FROM orders o
+		JOIN merch m ON m.id = o.merch_id
+		LEFT JOIN LATERAL (
+			SELECT h.price FROM merch_price_history h
+			WHERE h.merch_id = o.merch_id AND h.valid_from <= o.created_at
+			ORDER BY h.valid_from DESC, h.id DESC
+			LIMIT 1
+		) p ON TRUE
+		WHERE o.total_price <> o.quantity * COALESCE(p.price, m.price)
+		ORDER BY o.id`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query order prices: %w", err)
+	}
+	defer rows.Close()
+
+	var mismatches []*models.OrderPriceMismatch
+	for rows.Next() {
+		m := &models.OrderPriceMismatch{}
+		if err := rows.Scan(&m.OrderID, &m.UserID, &m.MerchName, &m.Quantity, &m.TotalPrice, &m.ExpectedPrice); err != nil {
+			return nil, fmt.Errorf("failed to scan order price: %w", err)
+		}
+		mismatches = append(mismatches, m)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return mismatches, nil
+}
+
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanBalanceFacts(row rowScanner) (*models.BalanceFacts, error) {
+	f := &models.BalanceFacts{}
+	if err := row.Scan(&f.UserID, &f.Email, &f.CoinBalance, &f.Grants, &f.LegacyUser, &f.Received, &f.Sent, &f.Spent, &f.LedgerBalance); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
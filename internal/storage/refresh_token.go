@@ -0,0 +1,141 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+)
+
+// RefreshTokenStorage описывает хранение refresh-токенов и отзыв access-токенов.
+type RefreshTokenStorage interface {
+	// CreateRefreshToken сохраняет хэш refresh-токена и возвращает его ID.
+	CreateRefreshToken(ctx context.Context, token *models.RefreshToken) (int64, error)
+	// GetRefreshTokenForUpdate читает токен по хэшу с блокировкой строки; ErrTokenNotFound, если его нет.
+	GetRefreshTokenForUpdate(ctx context.Context, tokenHash []byte) (*models.RefreshToken, error)
+	// RevokeRefreshToken отзывает токен; replacedBy — токен, выданный взамен при ротации.
+	RevokeRefreshToken(ctx context.Context, id int64, replacedBy *int64) error
+	// RevokeUserRefreshTokens отзывает все действующие refresh-токены пользователя.
+	RevokeUserRefreshTokens(ctx context.Context, userID int64) error
+	// RevokeSessionRefreshTokens отзывает все действующие refresh-токены сессии.
+	RevokeSessionRefreshTokens(ctx context.Context, sessionID int64) error
+	// RevokeAccessToken запоминает jti отозванного access-токена до истечения его срока.
+	RevokeAccessToken(ctx context.Context, jti string, userID int64, expiresAt time.Time) error
+	// SetTokensValidAfter делает недействительными все access-токены пользователя, выданные раньше t.
+	SetTokensValidAfter(ctx context.Context, userID int64, t time.Time) error
+	// IsAccessTokenRevoked сообщает, отозван ли access-токен: по jti или по tokens_valid_after пользователя.
+	IsAccessTokenRevoked(ctx context.Context, userID int64, jti string, issuedAt time.Time) (bool, error)
+}
+
+type refreshTokenRepository struct {
+	db *sql.DB
+}
+
+// NewRefreshTokenRepository создаёт новый репозиторий refresh-токенов.
+func NewRefreshTokenRepository(db *sql.DB) RefreshTokenStorage {
+	return &refreshTokenRepository{db: db}
+}
+
+func (r *refreshTokenRepository) CreateRefreshToken(ctx context.Context, token *models.RefreshToken) (int64, error) {
+	query := `INSERT INTO refresh_tokens (user_id, session_id, token_hash, device, expires_at, created_at)
+	          VALUES ($1, $2, $3, $4, $5, NOW()) RETURNING id`
+	// токен без сессии (SessionID 0) сохраняется с session_id NULL
+	sessionID := sql.NullInt64{Int64: token.SessionID, Valid: token.SessionID != 0}
+	var id int64
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, token.UserID, sessionID, token.TokenHash, token.Device, token.ExpiresAt).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create refresh token: %w", err)
+	}
+	token.ID = id
+	return id, nil
+}
+
+func (r *refreshTokenRepository) GetRefreshTokenForUpdate(ctx context.Context, tokenHash []byte) (*models.RefreshToken, error) {
+	query := `
+		SELECT id, user_id, session_id, token_hash, device, expires_at, created_at, revoked_at, replaced_by
+		FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE`
+	token := &models.RefreshToken{}
+	var sessionID sql.NullInt64
+	var revokedAt sql.NullTime
+	var replacedBy sql.NullInt64
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, tokenHash).Scan(
+		&token.ID, &token.UserID, &sessionID, &token.TokenHash, &token.Device, &token.ExpiresAt, &token.CreatedAt, &revokedAt, &replacedBy,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTokenNotFound
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+	token.SessionID = sessionID.Int64
+	if revokedAt.Valid {
+		token.RevokedAt = &revokedAt.Time
+	}
+	if replacedBy.Valid {
+		token.ReplacedBy = &replacedBy.Int64
+	}
+	return token, nil
+}
+
+func (r *refreshTokenRepository) RevokeRefreshToken(ctx context.Context, id int64, replacedBy *int64) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW(), replaced_by = $2 WHERE id = $1 AND revoked_at IS NULL`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, id, replacedBy); err != nil {
+		return fmt.Errorf("failed to revoke refresh token: %w", err)
+	}
+	return nil
+}
+
+func (r *refreshTokenRepository) RevokeUserRefreshTokens(ctx context.Context, userID int64) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, userID); err != nil {
+		return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+	}
+	return nil
+}
+
+func (r *refreshTokenRepository) RevokeSessionRefreshTokens(ctx context.Context, sessionID int64) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE session_id = $1 AND revoked_at IS NULL`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, sessionID); err != nil {
+		return fmt.Errorf("failed to revoke session refresh tokens: %w", err)
+	}
+	return nil
+}
+
+func (r *refreshTokenRepository) RevokeAccessToken(ctx context.Context, jti string, userID int64, expiresAt time.Time) error {
+	query := `INSERT INTO revoked_access_tokens (jti, user_id, expires_at) VALUES ($1, $2, $3)
+	          ON CONFLICT (jti) DO NOTHING`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, jti, userID, expiresAt); err != nil {
+		return fmt.Errorf("failed to revoke access token: %w", err)
+	}
+	return nil
+}
+
+func (r *refreshTokenRepository) SetTokensValidAfter(ctx context.Context, userID int64, t time.Time) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, `UPDATE users SET tokens_valid_after = $2 WHERE id = $1`, userID, t)
+	if err != nil {
+		return fmt.Errorf("failed to set tokens_valid_after: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+// IsAccessTokenRevoked проверяет токен одним запросом. Токен удалённого пользователя считается отозванным.
+func (r *refreshTokenRepository) IsAccessTokenRevoked(ctx context.Context, userID int64, jti string, issuedAt time.Time) (bool, error) {
+	query := `
+		SELECT EXISTS (SELECT 1 FROM revoked_access_tokens WHERE jti = $2)
+		    OR COALESCE((SELECT COALESCE(tokens_valid_after > $3, FALSE) FROM users WHERE id = $1), TRUE)`
+	var revoked bool
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, userID, jti, issuedAt).Scan(&revoked); err != nil {
+		return false, fmt.Errorf("failed to check access token: %w", err)
+	}
+	return revoked, nil
+}
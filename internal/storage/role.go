@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+)
+
+// RoleStorage описывает изменение ролей и их журнал.
+type RoleStorage interface {
+	// UpdateUserRole меняет роль пользователя.
+	UpdateUserRole(ctx context.Context, userID int64, role models.Role) error
+	// CreateRoleChange записывает изменение роли в журнал.
+	CreateRoleChange(ctx context.Context, change *models.RoleChange) error
+	// ListRoleChanges возвращает журнал изменений роли пользователя, новые записи первыми.
+	ListRoleChanges(ctx context.Context, userID int64) ([]*models.RoleChange, error)
+}
+
+type roleRepository struct {
+	db *sql.DB
+}
+
+// NewRoleRepository создаёт новый репозиторий ролей.
+func NewRoleRepository(db *sql.DB) RoleStorage {
+	return &roleRepository{db: db}
+}
+
+func (r *roleRepository) UpdateUserRole(ctx context.Context, userID int64, role models.Role) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE users SET role = $2 WHERE id = $1", userID, role)
+	if err != nil {
+		return fmt.Errorf("failed to update role: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
+
+func (r *roleRepository) CreateRoleChange(ctx context.Context, change *models.RoleChange) error {
+	query := `INSERT INTO role_changes (user_id, old_role, new_role, changed_by, reason, created_at)
+	          VALUES ($1, $2, $3, $4, $5, NOW()) RETURNING id, created_at`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		change.UserID, change.OldRole, change.NewRole, change.ChangedBy, change.Reason,
+	).Scan(&change.ID, &change.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create role change: %w", err)
+	}
+	return nil
+}
+
+func (r *roleRepository) ListRoleChanges(ctx context.Context, userID int64) ([]*models.RoleChange, error) {
+	query := `
+		SELECT id, user_id, old_role, new_role, changed_by, reason, created_at
+		FROM role_changes WHERE user_id = $1
+		ORDER BY created_at DESC, id DESC`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list role changes: %w", err)
+	}
+	defer rows.Close()
+
+	var changes []*models.RoleChange
+	for rows.Next() {
+		c := &models.RoleChange{}
+		if err := rows.Scan(&c.ID, &c.UserID, &c.OldRole, &c.NewRole, &c.ChangedBy, &c.Reason, &c.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan role change: %w", err)
+		}
+		changes = append(changes, c)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list role changes: %w", err)
+	}
+	return changes, nil
+}
@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+)
+
+// ErrSessionNotFound возвращается, если сессии нет, она отозвана, истекла
+// или начата до «выхода на всех устройствах»
+var ErrSessionNotFound = errors.New("session not found")
+
+// activeSession — условие для действующей сессии; s — sessions, u — users
+const activeSession = `s.revoked_at IS NULL
+	AND s.expires_at > NOW()
+	AND (u.tokens_valid_after IS NULL OR s.created_at > u.tokens_valid_after)`
+
+// SessionStorage описывает хранение сессий пользователей.
+type SessionStorage interface {
+	// CreateSession сохраняет сессию и заполняет ID, CreatedAt и LastUsedAt.
+	CreateSession(ctx context.Context, session *models.Session) error
+	// GetActiveSession возвращает действующую сессию или ErrSessionNotFound.
+	GetActiveSession(ctx context.Context, sessionID int64) (*models.Session, error)
+	// ListActiveSessions возвращает действующие сессии пользователя, недавно использованные первыми.
+	ListActiveSessions(ctx context.Context, userID int64) ([]*models.Session, error)
+	// TouchSession запоминает время последнего использования сессии.
+	TouchSession(ctx context.Context, sessionID int64) error
+	// ExtendSession продлевает сессию до expiresAt при обновлении токенов.
+	ExtendSession(ctx context.Context, sessionID int64, expiresAt time.Time) error
+	// RevokeSession отзывает сессию пользователя; чужая или уже отозванная сессия — ErrSessionNotFound.
+	RevokeSession(ctx context.Context, userID, sessionID int64) error
+}
+
+type sessionRepository struct {
+	db *sql.DB
+}
+
+// NewSessionRepository создаёт новый репозиторий сессий.
+func NewSessionRepository(db *sql.DB) SessionStorage {
+	return &sessionRepository{db: db}
+}
+
+func (r *sessionRepository) CreateSession(ctx context.Context, session *models.Session) error {
+	query := `INSERT INTO sessions (user_id, user_agent, ip, expires_at, created_at, last_used_at)
+	          VALUES ($1, $2, $3, $4, NOW(), NOW()) RETURNING id, created_at`
+	err := conn(ctx, r.db).QueryRowContext(ctx, query,
+		session.UserID, session.UserAgent, session.IP, session.ExpiresAt,
+	).Scan(&session.ID, &session.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create session: %w", err)
+	}
+	session.LastUsedAt = session.CreatedAt
+	return nil
+}
+
+func (r *sessionRepository) GetActiveSession(ctx context.Context, sessionID int64) (*models.Session, error) {
+	query := `
+		SELECT s.id, s.user_id, s.user_agent, s.ip, s.created_at, s.last_used_at, s.expires_at
+		FROM sessions s JOIN users u ON u.id = s.user_id
+		WHERE s.id = $1 AND ` + activeSession
+	session, err := scanSession(conn(ctx, r.db).QueryRowContext(ctx, query, sessionID))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrSessionNotFound
+		}
+		return nil, err
+	}
+	return session, nil
+}
+
+func (r *sessionRepository) ListActiveSessions(ctx context.Context, userID int64) ([]*models.Session, error) {
+	query := `
+		SELECT s.id, s.user_id, s.user_agent, s.ip, s.created_at, s.last_used_at, s.expires_at
+		FROM sessions s JOIN users u ON u.id = s.user_id
+		WHERE s.user_id = $1 AND ` + activeSession + `
+		ORDER BY s.last_used_at DESC, s.id DESC`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []*models.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	return sessions, nil
+}
+
+func (r *sessionRepository) TouchSession(ctx context.Context, sessionID int64) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE sessions SET last_used_at = NOW() WHERE id = $1", sessionID); err != nil {
+		return fmt.Errorf("failed to update session: %w", err)
+	}
+	return nil
+}
+
+func (r *sessionRepository) ExtendSession(ctx context.Context, sessionID int64, expiresAt time.Time) error {
+	query := "UPDATE sessions SET expires_at = $2, last_used_at = NOW() WHERE id = $1"
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, sessionID, expiresAt); err != nil {
+		return fmt.Errorf("failed to extend session: %w", err)
+	}
+	return nil
+}
+
+func (r *sessionRepository) RevokeSession(ctx context.Context, userID, sessionID int64) error {
+	query := "UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL"
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, sessionID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke session: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// scanSession читает сессию из строки запроса; sql.ErrNoRows возвращается без обёртки
+func scanSession(row rowScanner) (*models.Session, error) {
+	session := &models.Session{}
+	err := row.Scan(&session.ID, &session.UserID, &session.UserAgent, &session.IP,
+		&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("failed to scan session: %w", err)
+	}
+	return session, nil
+}
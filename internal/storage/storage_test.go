@@ -2,6 +2,7 @@ package storage_test
 
 import (
 	"context"
+	"database/sql"
 	"errors"
 	"github.com/linemk/avito-shop/internal/domain/models"
 	"regexp"
@@ -9,6 +10,7 @@ import (
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
 	"github.com/linemk/avito-shop/internal/storage"
 	"github.com/stretchr/testify/assert"
 )
@@ -25,11 +27,11 @@ func TestGetUserByID_Success(t *testing.T) {
 	userID := int64(1)
 
 	// Подготавливаем ожидаемые строки результата.
-	rows := sqlmock.NewRows([]string{"id", "username", "pass_hash", "coin_balance"}).
-		AddRow(userID, "test@example.com", []byte("hashed-password"), 1000)
+	rows := sqlmock.NewRows([]string{"id", "username", "pass_hash", "coin_balance", "email_verified", "role"}).
+		AddRow(userID, "test@example.com", []byte("hashed-password"), 1000, true, "employee")
 
 	// Ожидаем выполнение запроса с аргументом userID.
-	mock.ExpectQuery("SELECT id, username, pass_hash, coin_balance FROM users WHERE id = \\$1").
+	mock.ExpectQuery("SELECT id, username, pass_hash, coin_balance, email_verified_at IS NOT NULL, role FROM users WHERE id = \\$1").
 		WithArgs(userID).WillReturnRows(rows)
 
 	// Вызываем тестируемую функцию.
@@ -55,8 +57,8 @@ func TestGetUserByID_NoRows(t *testing.T) {
 	userID := int64(2)
 
 	// Эмулируем ситуацию, когда запрос возвращает 0 строк.
-	rows := sqlmock.NewRows([]string{"id", "username", "pass_hash", "coin_balance"})
-	mock.ExpectQuery("SELECT id, username, pass_hash, coin_balance FROM users WHERE id = \\$1").
+	rows := sqlmock.NewRows([]string{"id", "username", "pass_hash", "coin_balance", "email_verified", "role"})
+	mock.ExpectQuery("SELECT id, username, pass_hash, coin_balance, email_verified_at IS NOT NULL, role FROM users WHERE id = \\$1").
 		WithArgs(userID).WillReturnRows(rows)
 
 	user, err := repo.GetUserByID(ctx, userID)
@@ -77,7 +79,7 @@ func TestGetUserByID_QueryError(t *testing.T) {
 	userID := int64(3)
 
 	// Эмулируем ошибку выполнения запроса.
-	mock.ExpectQuery("SELECT id, username, pass_hash, coin_balance FROM users WHERE id = \\$1").
+	mock.ExpectQuery("SELECT id, username, pass_hash, coin_balance, email_verified_at IS NOT NULL, role FROM users WHERE id = \\$1").
 		WithArgs(userID).WillReturnError(errors.New("db error"))
 
 	user, err := repo.GetUserByID(ctx, userID)
@@ -94,34 +96,31 @@ func TestGetMerchByName_Success(t *testing.T) {
 	assert.NoError(t, err)
 	defer db.Close()
 
-	// Ожидаем вызов Begin перед тем, как вызвать db.Begin().
-	mock.ExpectBegin()
 	repo := storage.NewMerchRepository(db)
+	txManager := storage.NewTxManager(db, storage.RetryPolicy{})
 	ctx := context.Background()
 	merchName := "t-shirt"
 
-	tx, err := db.Begin()
-	assert.NoError(t, err)
-
 	// Подготавливаем ожидаемые строки результата.
 	rows := sqlmock.NewRows([]string{"id", "name", "price"}).
 		AddRow(1, merchName, 80)
 
-	// Ожидаем запрос с аргументом merchName.
+	// Ожидаем запрос с аргументом merchName внутри транзакции.
 	query := "SELECT id, name, price FROM merch WHERE name = \\$1"
+	mock.ExpectBegin()
 	mock.ExpectQuery(query).WithArgs(merchName).WillReturnRows(rows)
-
-	// Вызываем GetMerchByName.
-	result, err := repo.GetMerchByName(ctx, tx, merchName)
-	assert.NoError(t, err)
-	assert.NotNil(t, result)
-	assert.Equal(t, int64(1), result.ID)
-	assert.Equal(t, merchName, result.Name)
-	assert.Equal(t, 80, result.Price)
-
-	// Ожидаем вызов Commit и коммитим транзакцию.
 	mock.ExpectCommit()
-	err = tx.Commit()
+
+	// Вызываем GetMerchByName в транзакции.
+	err = txManager.Do(ctx, func(ctx context.Context) error {
+		result, err := repo.GetMerchByName(ctx, merchName)
+		assert.NoError(t, err)
+		assert.NotNil(t, result)
+		assert.Equal(t, int64(1), result.ID)
+		assert.Equal(t, merchName, result.Name)
+		assert.Equal(t, 80, result.Price)
+		return err
+	})
 	assert.NoError(t, err)
 
 	// Проверяем, что все ожидания выполнены.
@@ -129,32 +128,221 @@ func TestGetMerchByName_Success(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestListMerch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewMerchRepository(db)
+	archivedAt := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	columns := []string{"id", "name", "price", "description", "category", "archived_at", "stock"}
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, price, description, category, archived_at, stock FROM merch WHERE archived_at IS NULL ORDER BY name")).
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(3, "book", 50, "Блокнот в твёрдой обложке", "stationery", nil, nil).
+			AddRow(2, "cup", 20, "Кружка с логотипом", "accessories", nil, 12).
+			AddRow(6, "hoody", 300, "Розовое худи", "clothing", nil, 0))
+	// Полный список для управления каталогом включает архивные товары
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT id, name, price, description, category, archived_at, stock FROM merch ORDER BY name")).
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(1, "socks", 10, "", "clothing", archivedAt, nil))
+
+	items, err := repo.ListMerch(context.Background(), false)
+	assert.NoError(t, err)
+	cupStock, hoodyStock := 12, 0
+	assert.Equal(t, []*models.Merch{
+		{ID: 3, Name: "book", Price: 50, Description: "Блокнот в твёрдой обложке", Category: "stationery", Available: true},
+		{ID: 2, Name: "cup", Price: 20, Description: "Кружка с логотипом", Category: "accessories", Available: true, Stock: &cupStock},
+		// Закончившийся товар остаётся в каталоге, но купить его нельзя
+		{ID: 6, Name: "hoody", Price: 300, Description: "Розовое худи", Category: "clothing", Stock: &hoodyStock},
+	}, items)
+
+	items, err = repo.ListMerch(context.Background(), true)
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.Merch{
+		{ID: 1, Name: "socks", Price: 10, Category: "clothing", ArchivedAt: &archivedAt},
+	}, items)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestDecrementMerchStock(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewMerchRepository(db)
+	query := regexp.QuoteMeta("UPDATE merch SET stock = stock - $2 WHERE id = $1 AND (stock IS NULL OR stock >= $2) RETURNING stock")
+
+	mock.ExpectQuery(query).WithArgs(2, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(4))
+	// Остаток товара не учитывается
+	mock.ExpectQuery(query).WithArgs(3, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(nil))
+	// На складе меньше, чем покупают: строка не обновляется
+	mock.ExpectQuery(query).WithArgs(6, 2).WillReturnRows(sqlmock.NewRows([]string{"stock"}))
+
+	stock, err := repo.DecrementMerchStock(context.Background(), 2, 1)
+	assert.NoError(t, err)
+	if assert.NotNil(t, stock) {
+		assert.Equal(t, 4, *stock)
+	}
+
+	stock, err = repo.DecrementMerchStock(context.Background(), 3, 1)
+	assert.NoError(t, err)
+	assert.Nil(t, stock)
+
+	_, err = repo.DecrementMerchStock(context.Background(), 6, 2)
+	assert.ErrorIs(t, err, storage.ErrOutOfStock)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListCartItems_ForUpdate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewCartRepository(db)
+	addedAt := time.Now()
+	mock.ExpectQuery(`FROM cart_items c\s+JOIN merch m ON c.merch_id = m.id\s+WHERE c.user_id = \$1\s+ORDER BY m.name FOR UPDATE OF c`).
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"merch_id", "name", "price", "quantity", "available", "added_at"}).
+			AddRow(2, "cup", 20, 2, true, addedAt).
+			AddRow(6, "hoody", 300, 1, false, addedAt))
+
+	items, err := repo.ListCartItems(context.Background(), 1, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.CartItem{
+		{MerchID: 2, MerchName: "cup", Price: 20, Quantity: 2, Available: true, AddedAt: addedAt},
+		{MerchID: 6, MerchName: "hoody", Price: 300, Quantity: 1, Available: false, AddedAt: addedAt},
+	}, items)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestAddCartItem(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewCartRepository(db)
+	// Повторное добавление складывает количество
+	mock.ExpectQuery(`INSERT INTO cart_items .+ ON CONFLICT \(user_id, merch_id\) DO UPDATE SET quantity = cart_items.quantity \+ EXCLUDED.quantity`).
+		WithArgs(1, 2, 3).
+		WillReturnRows(sqlmock.NewRows([]string{"quantity"}).AddRow(5))
+
+	total, err := repo.AddCartItem(context.Background(), 1, 2, 3)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, total)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRemoveCartItem_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewCartRepository(db)
+	mock.ExpectExec(`DELETE FROM cart_items c USING merch m`).
+		WithArgs(1, "cup").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = repo.RemoveCartItem(context.Background(), 1, "cup")
+	assert.ErrorIs(t, err, storage.ErrCartItemNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRestockMerch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewMerchRepository(db)
+	query := regexp.QuoteMeta("UPDATE merch SET stock = COALESCE(stock, 0) + $2 WHERE id = $1 RETURNING stock")
+
+	mock.ExpectQuery(query).WithArgs(6, 40).WillReturnRows(sqlmock.NewRows([]string{"stock"}).AddRow(40))
+	mock.ExpectQuery(query).WithArgs(99, 1).WillReturnRows(sqlmock.NewRows([]string{"stock"}))
+
+	stock, err := repo.RestockMerch(context.Background(), 6, 40)
+	assert.NoError(t, err)
+	assert.Equal(t, 40, stock)
+
+	_, err = repo.RestockMerch(context.Background(), 99, 1)
+	assert.ErrorIs(t, err, storage.ErrMerchNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateMerch_Duplicate(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewMerchRepository(db)
+
+	mock.ExpectQuery("INSERT INTO merch").
+		WithArgs("cup", 20, "", "accessories").
+		WillReturnError(&pq.Error{Code: "23505"})
+
+	err = repo.CreateMerch(context.Background(), &models.Merch{Name: "cup", Price: 20, Category: "accessories"})
+	assert.ErrorIs(t, err, storage.ErrMerchExists)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestListMerchPrices(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewMerchRepository(db)
+	validFrom := time.Date(2026, 10, 1, 12, 0, 0, 0, time.UTC)
+
+	columns := []string{"id", "merch_id", "price", "valid_from", "changed_by"}
+	mock.ExpectQuery("FROM merch m").WithArgs("cup").
+		WillReturnRows(sqlmock.NewRows(columns).
+			AddRow(5, 2, 25, validFrom, 7).
+			AddRow(2, 2, 20, time.Unix(0, 0).UTC(), nil))
+	// Товар без записей истории
+	mock.ExpectQuery("FROM merch m").WithArgs("scarf").
+		WillReturnRows(sqlmock.NewRows(columns).AddRow(nil, 3, nil, nil, nil))
+	mock.ExpectQuery("FROM merch m").WithArgs("car").
+		WillReturnRows(sqlmock.NewRows(columns))
+
+	prices, err := repo.ListMerchPrices(context.Background(), "cup")
+	assert.NoError(t, err)
+	changedBy := int64(7)
+	assert.Equal(t, []*models.MerchPrice{
+		{ID: 5, MerchID: 2, Price: 25, ValidFrom: validFrom, ChangedBy: &changedBy},
+		{ID: 2, MerchID: 2, Price: 20, ValidFrom: time.Unix(0, 0).UTC()},
+	}, prices)
+
+	prices, err = repo.ListMerchPrices(context.Background(), "scarf")
+	assert.NoError(t, err)
+	assert.Empty(t, prices)
+
+	_, err = repo.ListMerchPrices(context.Background(), "car")
+	assert.ErrorIs(t, err, storage.ErrMerchNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
 func TestGetMerchByName_NotFound(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
 
-	mock.ExpectBegin()
 	repo := storage.NewMerchRepository(db)
+	txManager := storage.NewTxManager(db, storage.RetryPolicy{})
 	ctx := context.Background()
 	merchName := "non-existent"
 
-	tx, err := db.Begin()
-	assert.NoError(t, err)
-
-	// Эмулируем ситуацию, когда запрос возвращает 0 строк.
+	// Эмулируем ситуацию, когда запрос возвращает 0 строк; транзакция откатывается.
 	rows := sqlmock.NewRows([]string{"id", "name", "price"})
 	query := "SELECT id, name, price FROM merch WHERE name = \\$1"
+	mock.ExpectBegin()
 	mock.ExpectQuery(query).WithArgs(merchName).WillReturnRows(rows)
+	mock.ExpectRollback()
 
-	result, err := repo.GetMerchByName(ctx, tx, merchName)
+	err = txManager.Do(ctx, func(ctx context.Context) error {
+		result, err := repo.GetMerchByName(ctx, merchName)
+		assert.Nil(t, result)
+		return err
+	})
 	assert.Error(t, err)
 	assert.True(t, errors.Is(err, storage.ErrMerchNotFound))
-	assert.Nil(t, result)
-
-	mock.ExpectRollback()
-	err = tx.Rollback()
-	assert.NoError(t, err)
 
 	err = mock.ExpectationsWereMet()
 	assert.NoError(t, err)
@@ -165,28 +353,20 @@ func TestGetMerchByName_QueryError(t *testing.T) {
 	assert.NoError(t, err)
 	defer db.Close()
 
-	mock.ExpectBegin()
 	repo := storage.NewMerchRepository(db)
 	ctx := context.Background()
 	merchName := "t-shirt"
 
-	tx, err := db.Begin()
-	assert.NoError(t, err)
-
-	// Эмулируем ошибку выполнения запроса.
+	// Эмулируем ошибку выполнения запроса вне транзакции.
 	query := "SELECT id, name, price FROM merch WHERE name = \\$1"
 	expectedError := errors.New("query error")
 	mock.ExpectQuery(query).WithArgs(merchName).WillReturnError(expectedError)
 
-	result, err := repo.GetMerchByName(ctx, tx, merchName)
+	result, err := repo.GetMerchByName(ctx, merchName)
 	assert.Error(t, err)
 	assert.Equal(t, expectedError, err)
 	assert.Nil(t, result)
 
-	mock.ExpectRollback()
-	err = tx.Rollback()
-	assert.NoError(t, err)
-
 	err = mock.ExpectationsWereMet()
 	assert.NoError(t, err)
 }
@@ -198,24 +378,21 @@ func TestCreateOrder_Success(t *testing.T) {
 	defer db.Close()
 
 	repo := storage.NewOrderRepository(db)
+	txManager := storage.NewTxManager(db, storage.RetryPolicy{})
 	ctx := context.Background()
 
-	// Ожидаем вызов BeginTx.
-	mock.ExpectBegin()
-	tx, err := db.Begin()
-	assert.NoError(t, err)
-
 	// Формируем ожидаемый SQL-запрос, используя regexp.QuoteMeta,
 	// чтобы экранировать специальные символы.
-	query := regexp.QuoteMeta("INSERT INTO orders (user_id, merch_id, quantity, total_price, created_at) VALUES ($1, $2, $3, $4, NOW())")
-	mock.ExpectExec(query).WithArgs(1, 2, 3, 150).WillReturnResult(sqlmock.NewResult(1, 1))
-
-	err = repo.CreateOrder(ctx, tx, 1, 2, 3, 150)
-	assert.NoError(t, err)
-
-	// Ожидаем Commit.
+	query := regexp.QuoteMeta("INSERT INTO orders (user_id, merch_id, quantity, total_price, created_at) VALUES ($1, $2, $3, $4, NOW()) RETURNING id")
+	mock.ExpectBegin()
+	mock.ExpectQuery(query).WithArgs(1, 2, 3, 150).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(5))
 	mock.ExpectCommit()
-	err = tx.Commit()
+
+	err = txManager.Do(ctx, func(ctx context.Context) error {
+		id, err := repo.CreateOrder(ctx, 1, 2, 3, 150)
+		assert.Equal(t, int64(5), id)
+		return err
+	})
 	assert.NoError(t, err)
 
 	// Проверяем, что все ожидания sqlmock выполнены.
@@ -292,10 +469,10 @@ func TestGetUserByEmail_Success(t *testing.T) {
 	email := "test@example.com"
 
 	// Подготавливаем ожидаемые строки результата.
-	rows := sqlmock.NewRows([]string{"id", "username", "pass_hash", "coin_balance"}).
-		AddRow(1, email, []byte("hashed-password"), 1000)
+	rows := sqlmock.NewRows([]string{"id", "username", "pass_hash", "coin_balance", "email_verified", "role"}).
+		AddRow(1, email, []byte("hashed-password"), 1000, true, "employee")
 	// Ожидаем запрос с аргументом email.
-	query := regexp.QuoteMeta("SELECT id, username, pass_hash, coin_balance FROM users WHERE username = $1")
+	query := regexp.QuoteMeta("SELECT id, username, pass_hash, coin_balance, email_verified_at IS NOT NULL, role FROM users WHERE username = $1")
 	mock.ExpectQuery(query).WithArgs(email).WillReturnRows(rows)
 
 	user, err := repo.GetUserByEmail(ctx, email)
@@ -319,8 +496,8 @@ func TestGetUserByEmail_NotFound(t *testing.T) {
 	email := "nonexistent@example.com"
 
 	// Эмулируем ситуацию, когда запрос возвращает 0 строк.
-	rows := sqlmock.NewRows([]string{"id", "username", "pass_hash", "coin_balance"})
-	query := regexp.QuoteMeta("SELECT id, username, pass_hash, coin_balance FROM users WHERE username = $1")
+	rows := sqlmock.NewRows([]string{"id", "username", "pass_hash", "coin_balance", "email_verified", "role"})
+	query := regexp.QuoteMeta("SELECT id, username, pass_hash, coin_balance, email_verified_at IS NOT NULL, role FROM users WHERE username = $1")
 	mock.ExpectQuery(query).WithArgs(email).WillReturnRows(rows)
 
 	user, err := repo.GetUserByEmail(ctx, email)
@@ -360,131 +537,771 @@ func TestCreateUser_Success(t *testing.T) {
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestUpdateUserBalance_Success(t *testing.T) {
+func TestPostEntry_Success(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
 
-	repo := storage.NewUserRepository(db)
+	repo := storage.NewLedgerRepository(db)
+	txManager := storage.NewTxManager(db, storage.RetryPolicy{})
 	ctx := context.Background()
-	userID := int64(1)
-	newBalance := 900
 
-	// Ожидаем вызов Begin.
+	entry := &models.LedgerEntry{
+		Kind:      models.LedgerEntryPurchase,
+		Reference: "order:7",
+		Postings: []models.LedgerPosting{
+			{Account: models.WalletAccount(1), Amount: -80},
+			{Account: models.SystemAccount(models.LedgerAccountShopRevenue), Amount: 80},
+		},
+	}
+
+	// Запись, проводка по кошельку с обновлением кэша баланса, проводка по системному счёту.
 	mock.ExpectBegin()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO ledger_entries (kind, reference, reason, created_at) VALUES ($1, $2, $3, NOW()) RETURNING id")).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(10))
+	mock.ExpectExec(regexp.QuoteMeta("SELECT $1, id, $2 FROM ledger_accounts WHERE user_id = $3")).
+		WithArgs(int64(10), -80, int64(1)).WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE users SET coin_balance = coin_balance + $1 WHERE id = $2")).
+		WithArgs(-80, int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("SELECT $1, id, $2 FROM ledger_accounts WHERE code = $3")).
+		WithArgs(int64(10), 80, models.LedgerAccountShopRevenue).WillReturnResult(sqlmock.NewResult(2, 1))
+	mock.ExpectCommit()
 
-	// Ожидаем вызов ExecContext с нужными параметрами.
-	query := regexp.QuoteMeta("UPDATE users SET coin_balance = $1 WHERE id = $2")
-	mock.ExpectExec(query).WithArgs(newBalance, userID).
-		WillReturnResult(sqlmock.NewResult(0, 1)) // 1 строка затронута
+	err = txManager.Do(ctx, func(ctx context.Context) error {
+		id, err := repo.PostEntry(ctx, entry)
+		assert.Equal(t, int64(10), id)
+		return err
+	})
+	assert.NoError(t, err)
 
-	// Создаем транзакцию.
-	tx, err := db.Begin()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostEntry_Unbalanced(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
+	defer db.Close()
 
-	err = repo.UpdateUserBalance(ctx, tx, userID, newBalance)
+	repo := storage.NewLedgerRepository(db)
+	txManager := storage.NewTxManager(db, storage.RetryPolicy{})
+
+	// Несбалансированная запись отклоняется до обращения к БД.
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	err = txManager.Do(context.Background(), func(ctx context.Context) error {
+		_, err := repo.PostEntry(ctx, &models.LedgerEntry{
+			Kind: models.LedgerEntryAdminGrant,
+			Postings: []models.LedgerPosting{
+				{Account: models.SystemAccount(models.LedgerAccountCompanyIssuance), Amount: -100},
+				{Account: models.WalletAccount(1), Amount: 90},
+			},
+		})
+		return err
+	})
+	assert.ErrorIs(t, err, storage.ErrUnbalancedEntry)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestPostEntry_RequiresTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
+	defer db.Close()
 
-	// Ожидаем вызов Commit.
-	mock.ExpectCommit()
-	err = tx.Commit()
+	repo := storage.NewLedgerRepository(db)
+
+	_, err = repo.PostEntry(context.Background(), &models.LedgerEntry{Kind: models.LedgerEntryTransfer})
+	assert.ErrorIs(t, err, storage.ErrTransactionRequired)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetUserByID_InTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
+	defer db.Close()
 
-	// Проверяем, что все ожидания sqlmock выполнены.
-	err = mock.ExpectationsWereMet()
+	repo := storage.NewUserRepository(db)
+	txManager := storage.NewTxManager(db, storage.RetryPolicy{})
+	ctx := context.Background()
+	userID := int64(1)
+	email := "test@example.com"
+
+	// Подготавливаем ожидаемые строки результата.
+	rows := sqlmock.NewRows([]string{"id", "username", "pass_hash", "coin_balance", "email_verified", "role"}).
+		AddRow(userID, email, []byte("hashed"), 1000, true, "employee")
+	query := regexp.QuoteMeta("SELECT id, username, pass_hash, coin_balance, email_verified_at IS NOT NULL, role FROM users WHERE id = $1")
+	mock.ExpectBegin()
+	mock.ExpectQuery(query).WithArgs(userID).WillReturnRows(rows)
+	mock.ExpectCommit()
+
+	err = txManager.Do(ctx, func(ctx context.Context) error {
+		user, err := repo.GetUserByID(ctx, userID)
+		assert.NoError(t, err)
+		assert.Equal(t, userID, user.ID)
+		assert.Equal(t, email, user.Email)
+		return err
+	})
 	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestUpdateUserBalance_NoRows(t *testing.T) {
+func TestGetUserByIDForUpdate_Success(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
 
 	repo := storage.NewUserRepository(db)
+	txManager := storage.NewTxManager(db, storage.RetryPolicy{})
 	ctx := context.Background()
-	userID := int64(99)
-	newBalance := 900
+	userID := int64(1)
 
-	// Ожидаем вызов Begin.
+	// Запрос должен блокировать строку пользователя до конца транзакции.
+	rows := sqlmock.NewRows([]string{"id", "username", "pass_hash", "coin_balance", "email_verified", "role"}).
+		AddRow(userID, "test@example.com", []byte("hashed"), 1000, true, "employee")
+	query := regexp.QuoteMeta("SELECT id, username, pass_hash, coin_balance, email_verified_at IS NOT NULL, role FROM users WHERE id = $1 FOR UPDATE")
 	mock.ExpectBegin()
+	mock.ExpectQuery(query).WithArgs(userID).WillReturnRows(rows)
+	mock.ExpectCommit()
 
-	query := regexp.QuoteMeta("UPDATE users SET coin_balance = $1 WHERE id = $2")
-	mock.ExpectExec(query).WithArgs(newBalance, userID).
-		WillReturnResult(sqlmock.NewResult(0, 0)) // 0 строк затронуто
+	err = txManager.Do(ctx, func(ctx context.Context) error {
+		user, err := repo.GetUserByIDForUpdate(ctx, userID)
+		assert.NoError(t, err)
+		assert.Equal(t, userID, user.ID)
+		assert.Equal(t, 1000, user.CoinBalance)
+		return err
+	})
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
 
-	tx, err := db.Begin()
+func TestGetUserByEmail_NotFoundInTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewUserRepository(db)
+	txManager := storage.NewTxManager(db, storage.RetryPolicy{})
+	ctx := context.Background()
+	email := "nonexistent@example.com"
+
+	rows := sqlmock.NewRows([]string{"id", "username", "pass_hash", "coin_balance", "email_verified", "role"})
+	query := regexp.QuoteMeta("SELECT id, username, pass_hash, coin_balance, email_verified_at IS NOT NULL, role FROM users WHERE username = $1")
+	mock.ExpectBegin()
+	mock.ExpectQuery(query).WithArgs(email).WillReturnRows(rows)
+	mock.ExpectRollback()
 
-	err = repo.UpdateUserBalance(ctx, tx, userID, newBalance)
+	err = txManager.Do(ctx, func(ctx context.Context) error {
+		user, err := repo.GetUserByEmail(ctx, email)
+		assert.Nil(t, user)
+		return err
+	})
 	assert.Error(t, err)
 	assert.True(t, errors.Is(err, storage.ErrUserNotFound))
 
-	// Ожидаем вызов Rollback.
-	mock.ExpectRollback()
-	err = tx.Rollback()
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSaveIdempotencyKey_Conflict(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewIdempotencyRepository(db)
+	txManager := storage.NewTxManager(db, storage.RetryPolicy{})
+	ctx := context.Background()
+
+	record := &models.IdempotencyRecord{UserID: 1, Key: "key-1", RequestHash: "hash", ResponseStatus: 200, ResponseBody: []byte("{}")}
+	query := regexp.QuoteMeta("INSERT INTO idempotency_keys")
+	// Ключ уже существует: ON CONFLICT DO NOTHING не вставляет строку.
+	mock.ExpectBegin()
+	mock.ExpectExec(query).WithArgs(record.UserID, record.Key, record.RequestHash, record.ResponseStatus, record.ResponseBody).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectCommit()
+
+	err = txManager.Do(ctx, func(ctx context.Context) error {
+		saved, err := repo.SaveKey(ctx, record)
+		assert.False(t, saved, "Existing key should not be saved again")
+		return err
+	})
 	assert.NoError(t, err)
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestGetUserByIDtx_Success(t *testing.T) {
+func TestTxManager_RetriesSerializationFailure(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
 
-	repo := storage.NewUserRepository(db)
+	repo := storage.NewOrderRepository(db)
+	txManager := storage.NewTxManager(db, storage.RetryPolicy{MaxRetries: 2, BaseBackoff: time.Millisecond})
 	ctx := context.Background()
-	userID := int64(1)
-	email := "test@example.com"
 
-	// Начинаем транзакцию.
+	query := regexp.QuoteMeta("INSERT INTO orders (user_id, merch_id, quantity, total_price, created_at)")
+	// Первая попытка завершается конфликтом сериализации и откатывается, вторая — коммитится.
+	mock.ExpectBegin()
+	mock.ExpectQuery(query).WithArgs(1, 2, 1, 80).WillReturnError(&pq.Error{Code: "40001"})
+	mock.ExpectRollback()
 	mock.ExpectBegin()
-	tx, err := db.Begin()
+	mock.ExpectQuery(query).WithArgs(1, 2, 1, 80).WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectCommit()
+
+	attempts := 0
+	err = txManager.Do(ctx, func(ctx context.Context) error {
+		attempts++
+		_, err := repo.CreateOrder(ctx, 1, 2, 1, 80)
+		return err
+	})
 	assert.NoError(t, err)
+	assert.Equal(t, 2, attempts, "Transaction should be retried once")
 
-	// Подготавливаем ожидаемые строки результата.
-	rows := sqlmock.NewRows([]string{"id", "username", "pass_hash", "coin_balance"}).
-		AddRow(userID, email, []byte("hashed"), 1000)
-	query := regexp.QuoteMeta("SELECT id, username, pass_hash, coin_balance FROM users WHERE id = $1")
-	mock.ExpectQuery(query).WithArgs(userID).WillReturnRows(rows)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
 
-	user, err := repo.GetUserByIDtx(ctx, tx, userID)
+func TestTxManager_DoesNotRetryOtherErrors(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
-	assert.Equal(t, userID, user.ID)
-	assert.Equal(t, email, user.Email)
+	defer db.Close()
+
+	txManager := storage.NewTxManager(db, storage.RetryPolicy{MaxRetries: 3, BaseBackoff: time.Millisecond})
+	expectedErr := errors.New("business error")
+
+	mock.ExpectBegin()
+	mock.ExpectRollback()
+
+	attempts := 0
+	err = txManager.Do(context.Background(), func(ctx context.Context) error {
+		attempts++
+		return expectedErr
+	})
+	assert.ErrorIs(t, err, expectedErr)
+	assert.Equal(t, 1, attempts, "Non-retryable errors should not be retried")
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
 
+func TestTxManager_NestedCallJoinsTransaction(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	txManager := storage.NewTxManager(db, storage.RetryPolicy{})
+
+	// Вложенный вызов не открывает новую транзакцию.
+	mock.ExpectBegin()
 	mock.ExpectCommit()
-	err = tx.Commit()
+
+	err = txManager.Do(context.Background(), func(ctx context.Context) error {
+		assert.True(t, storage.InTransaction(ctx))
+		return txManager.DoWithOptions(ctx, storage.TxOptions{Isolation: sql.LevelSerializable}, func(ctx context.Context) error {
+			return nil
+		})
+	})
 	assert.NoError(t, err)
 
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
 
-func TestGetUserByIDtx_NotFound(t *testing.T) {
+func TestListOrderPriceMismatches_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewReconcileRepository(db)
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "name", "quantity", "total_price", "expected"}).
+		AddRow(7, 1, "cup", 2, 30, 40)
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE o.total_price <> o.quantity * COALESCE(p.price, m.price)")).WillReturnRows(rows)
+
+	mismatches, err := repo.ListOrderPriceMismatches(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, []*models.OrderPriceMismatch{
+		{OrderID: 7, UserID: 1, MerchName: "cup", Quantity: 2, TotalPrice: 30, ExpectedPrice: 40},
+	}, mismatches)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreatePurchaseTransaction_Success(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewCoinTransactionRepository(db)
+
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO coin_transactions (user_id, amount, type, order_id, created_at)")).
+		WithArgs(int64(1), 80, models.CoinTxPurchase, int64(7)).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+
+	err = repo.CreatePurchaseTransaction(context.Background(), 1, 80, 7)
+	assert.NoError(t, err)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetTransactionsByUserID_WithPurchase(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewCoinTransactionRepository(db)
+	now := time.Now()
+
+	rows := sqlmock.NewRows([]string{"id", "user_id", "amount", "type", "related_user_id", "order_id", "name", "created_at"}).
+		AddRow(2, 1, 80, models.CoinTxPurchase, nil, 7, "t-shirt", now).
+		AddRow(1, 1, 50, models.CoinTxTransferReceived, 2, nil, "", now.Add(-time.Minute))
+	mock.ExpectQuery(regexp.QuoteMeta("LEFT JOIN orders o ON o.id = ct.order_id")).
+		WithArgs(int64(1)).
+		WillReturnRows(rows)
+
+	txs, err := repo.GetTransactionsByUserID(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.Len(t, txs, 2)
+	assert.Equal(t, int64(7), *txs[0].OrderID)
+	assert.Equal(t, "t-shirt", txs[0].MerchName)
+	assert.Nil(t, txs[1].OrderID)
+	assert.Equal(t, int64(2), *txs[1].RelatedUserID)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateUser_Duplicate(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
 	defer db.Close()
 
 	repo := storage.NewUserRepository(db)
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO users")).
+		WillReturnError(&pq.Error{Code: "23505"})
+
+	_, err = repo.CreateUser(context.Background(), &models.User{Email: "dup@example.com", PassHash: []byte("hashed")})
+	assert.ErrorIs(t, err, storage.ErrUserExists)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMarkEmailVerified(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewUserRepository(db)
+	query := regexp.QuoteMeta("UPDATE users SET email_verified_at = NOW() WHERE id = $1 AND email_verified_at IS NULL")
+	mock.ExpectExec(query).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).WithArgs(int64(1)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	changed, err := repo.MarkEmailVerified(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	// Повторное подтверждение ничего не меняет.
+	changed, err = repo.MarkEmailVerified(context.Background(), 1)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestConsumeToken(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewOneTimeTokenRepository(db)
+	hash := []byte("hash")
+	query := regexp.QuoteMeta("UPDATE one_time_tokens SET used_at = NOW()")
+	mock.ExpectQuery(query).WithArgs(hash, models.TokenPurposeEmailVerification).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(5))
+	mock.ExpectQuery(query).WithArgs(hash, models.TokenPurposeEmailVerification).
+		WillReturnError(sql.ErrNoRows)
+
+	userID, err := repo.ConsumeToken(context.Background(), models.TokenPurposeEmailVerification, hash)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), userID)
+
+	// Использованный, истёкший или неизвестный токен.
+	_, err = repo.ConsumeToken(context.Background(), models.TokenPurposeEmailVerification, hash)
+	assert.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeTokens(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewOneTimeTokenRepository(db)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE one_time_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL")).
+		WithArgs(int64(5), models.TokenPurposePasswordReset).WillReturnResult(sqlmock.NewResult(0, 2))
+
+	assert.NoError(t, repo.RevokeTokens(context.Background(), 5, models.TokenPurposePasswordReset))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetRefreshTokenForUpdate_Revoked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewRefreshTokenRepository(db)
+	now := time.Now()
+	query := regexp.QuoteMeta("FROM refresh_tokens WHERE token_hash = $1 FOR UPDATE")
+	mock.ExpectQuery(query).WithArgs([]byte("hash")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "session_id", "token_hash", "device", "expires_at", "created_at", "revoked_at", "replaced_by"}).
+			AddRow(1, 2, 7, []byte("hash"), "laptop", now.Add(time.Hour), now, now, 3))
+	mock.ExpectQuery(query).WithArgs([]byte("other")).WillReturnError(sql.ErrNoRows)
+
+	token, err := repo.GetRefreshTokenForUpdate(context.Background(), []byte("hash"))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), token.UserID)
+	assert.Equal(t, int64(7), token.SessionID)
+	assert.Equal(t, "laptop", token.Device)
+	assert.NotNil(t, token.RevokedAt)
+	assert.Equal(t, int64(3), *token.ReplacedBy)
+
+	_, err = repo.GetRefreshTokenForUpdate(context.Background(), []byte("other"))
+	assert.ErrorIs(t, err, storage.ErrTokenNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateRefreshToken_WithoutSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewRefreshTokenRepository(db)
+	expiresAt := time.Now().Add(time.Hour)
+	query := regexp.QuoteMeta("INSERT INTO refresh_tokens (user_id, session_id, token_hash, device, expires_at, created_at)")
+	mock.ExpectQuery(query).WithArgs(int64(2), sql.NullInt64{}, []byte("hash"), "laptop", expiresAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectQuery(query).WithArgs(int64(2), sql.NullInt64{Int64: 7, Valid: true}, []byte("hash2"), "laptop", expiresAt).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(2))
+
+	_, err = repo.CreateRefreshToken(context.Background(), &models.RefreshToken{UserID: 2, TokenHash: []byte("hash"), Device: "laptop", ExpiresAt: expiresAt})
+	assert.NoError(t, err)
+	id, err := repo.CreateRefreshToken(context.Background(), &models.RefreshToken{UserID: 2, SessionID: 7, TokenHash: []byte("hash2"), Device: "laptop", ExpiresAt: expiresAt})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), id)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetActiveSession(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewSessionRepository(db)
+	now := time.Now()
+	query := regexp.QuoteMeta("FROM sessions s JOIN users u ON u.id = s.user_id")
+	mock.ExpectQuery(query).WithArgs(int64(7)).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "user_agent", "ip", "created_at", "last_used_at", "expires_at"}).
+			AddRow(7, 2, "Firefox", "203.0.113.5", now, now, now.Add(time.Hour)))
+	mock.ExpectQuery(query).WithArgs(int64(8)).WillReturnError(sql.ErrNoRows)
+
+	session, err := repo.GetActiveSession(context.Background(), 7)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), session.UserID)
+	assert.Equal(t, "Firefox", session.UserAgent)
+	assert.Equal(t, "203.0.113.5", session.IP)
+
+	_, err = repo.GetActiveSession(context.Background(), 8)
+	assert.ErrorIs(t, err, storage.ErrSessionNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokeSession_NotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewSessionRepository(db)
+	query := regexp.QuoteMeta("UPDATE sessions SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL")
+	mock.ExpectExec(query).WithArgs(int64(7), int64(2)).WillReturnResult(sqlmock.NewResult(0, 1))
+	// чужая или уже отозванная сессия
+	mock.ExpectExec(query).WithArgs(int64(7), int64(3)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.RevokeSession(context.Background(), 2, 7))
+	assert.ErrorIs(t, repo.RevokeSession(context.Background(), 3, 7), storage.ErrSessionNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestIsAccessTokenRevoked(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewRefreshTokenRepository(db)
+	issuedAt := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("SELECT EXISTS (SELECT 1 FROM revoked_access_tokens WHERE jti = $2)")).
+		WithArgs(int64(1), "jti", issuedAt).
+		WillReturnRows(sqlmock.NewRows([]string{"revoked"}).AddRow(true))
+
+	revoked, err := repo.IsAccessTokenRevoked(context.Background(), 1, "jti", issuedAt)
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUpdateUserRole(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewRoleRepository(db)
+	query := regexp.QuoteMeta("UPDATE users SET role = $2 WHERE id = $1")
+	mock.ExpectExec(query).WithArgs(int64(1), models.RoleFinance).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).WithArgs(int64(2), models.RoleFinance).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.UpdateUserRole(context.Background(), 1, models.RoleFinance))
+	assert.ErrorIs(t, repo.UpdateUserRole(context.Background(), 2, models.RoleFinance), storage.ErrUserNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestCreateRoleChange(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewRoleRepository(db)
+	now := time.Now()
+	mock.ExpectQuery(regexp.QuoteMeta("INSERT INTO role_changes (user_id, old_role, new_role, changed_by, reason, created_at)")).
+		WithArgs(int64(2), models.RoleEmployee, models.RoleAdmin, int64(1), "promotion").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "created_at"}).AddRow(7, now))
+
+	change := &models.RoleChange{UserID: 2, OldRole: models.RoleEmployee, NewRole: models.RoleAdmin, ChangedBy: 1, Reason: "promotion"}
+	assert.NoError(t, repo.CreateRoleChange(context.Background(), change))
+	assert.Equal(t, int64(7), change.ID)
+	assert.Equal(t, now, change.CreatedAt)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestReserveLoginAttempt(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewLoginAttemptRepository(db)
+	now := time.Now()
+	resetBefore := now.Add(-15 * time.Minute)
+	lockout := now.Add(15 * time.Minute)
+	mock.ExpectQuery(regexp.QuoteMeta("WHERE login_attempts.locked_until IS NULL OR login_attempts.locked_until <= $2")).
+		WithArgs("account:a@example.com", now, resetBefore, 5, lockout).
+		WillReturnRows(sqlmock.NewRows([]string{"failures", "last_failure_at", "locked_until"}).AddRow(4, now, nil))
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE login_attempts SET locked_until = GREATEST(locked_until, $2) WHERE key = $1")).
+		WithArgs("account:a@example.com", now.Add(time.Minute)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	// заблокированный ключ не обновляется, состояние читается отдельно
+	mock.ExpectQuery(regexp.QuoteMeta("ON CONFLICT (key) DO UPDATE SET")).
+		WithArgs("account:a@example.com", now, resetBefore, 5, lockout).
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery(regexp.QuoteMeta("FROM login_attempts WHERE key = $1")).
+		WithArgs("account:a@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"failures", "last_failure_at", "locked_until"}).AddRow(4, now, now.Add(time.Minute)))
+	mock.ExpectExec(regexp.QuoteMeta("failures = GREATEST(failures - 1, 0)")).
+		WithArgs("account:a@example.com", now.Add(time.Minute)).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery(regexp.QuoteMeta("FROM login_attempts WHERE key = $1")).
+		WithArgs("ip:10.0.0.1").
+		WillReturnError(sql.ErrNoRows)
+
+	attempt, reserved, err := repo.ReserveLoginAttempt(context.Background(), "account:a@example.com", now, resetBefore, 5, lockout)
+	assert.NoError(t, err)
+	assert.True(t, reserved)
+	assert.Equal(t, 4, attempt.Failures)
+	assert.True(t, attempt.LockedUntil.IsZero())
+	assert.NoError(t, repo.SetLoginLockout(context.Background(), "account:a@example.com", now.Add(time.Minute)))
+
+	attempt, reserved, err = repo.ReserveLoginAttempt(context.Background(), "account:a@example.com", now, resetBefore, 5, lockout)
+	assert.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Equal(t, now.Add(time.Minute), attempt.LockedUntil)
+	assert.NoError(t, repo.ReleaseLoginAttempt(context.Background(), "account:a@example.com", attempt.LockedUntil))
+
+	attempt, err = repo.GetLoginAttempt(context.Background(), "ip:10.0.0.1")
+	assert.NoError(t, err, "Unknown key has zero state")
+	assert.Equal(t, 0, attempt.Failures)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestMemoryLoginAttemptStorage(t *testing.T) {
+	store := storage.NewMemoryLoginAttemptStorage()
 	ctx := context.Background()
-	userID := int64(99)
+	now := time.Now()
 
-	mock.ExpectBegin()
-	tx, err := db.Begin()
+	for i := 0; i < 3; i++ {
+		_, reserved, err := store.ReserveLoginAttempt(ctx, "ip:10.0.0.1", now, now.Add(-time.Minute), 0, time.Time{})
+		assert.NoError(t, err)
+		assert.True(t, reserved)
+	}
+	assert.NoError(t, store.SetLoginLockout(ctx, "ip:10.0.0.1", now.Add(time.Hour)))
+	assert.NoError(t, store.SetLoginLockout(ctx, "ip:10.0.0.1", now.Add(time.Minute)))
+
+	attempt, err := store.GetLoginAttempt(ctx, "ip:10.0.0.1")
 	assert.NoError(t, err)
+	assert.Equal(t, 3, attempt.Failures)
+	assert.Equal(t, now.Add(time.Hour), attempt.LockedUntil, "Shorter lockout does not override a longer one")
 
-	rows := sqlmock.NewRows([]string{"id", "username", "pass_hash", "coin_balance"})
-	query := regexp.QuoteMeta("SELECT id, username, pass_hash, coin_balance FROM users WHERE id = $1")
-	mock.ExpectQuery(query).WithArgs(userID).WillReturnRows(rows)
+	// Пока ключ заблокирован, попытки не учитываются
+	attempt, reserved, err := store.ReserveLoginAttempt(ctx, "ip:10.0.0.1", now, now.Add(-time.Minute), 0, time.Time{})
+	assert.NoError(t, err)
+	assert.False(t, reserved)
+	assert.Equal(t, 3, attempt.Failures)
 
-	user, err := repo.GetUserByIDtx(ctx, tx, userID)
+	// Попытка после окна начинает счёт заново
+	later := now.Add(2 * time.Hour)
+	attempt, reserved, err = store.ReserveLoginAttempt(ctx, "ip:10.0.0.1", later, later.Add(-time.Minute), 0, time.Time{})
+	assert.NoError(t, err)
+	assert.True(t, reserved)
+	assert.Equal(t, 1, attempt.Failures)
+
+	// Попытка, достигшая предела, сразу блокирует ключ; отмена снимает эту блокировку
+	attempt, reserved, err = store.ReserveLoginAttempt(ctx, "ip:10.0.0.1", later, later.Add(-time.Minute), 2, later.Add(time.Hour))
+	assert.NoError(t, err)
+	assert.True(t, reserved)
+	assert.Equal(t, later.Add(time.Hour), attempt.LockedUntil)
+	assert.NoError(t, store.ReleaseLoginAttempt(ctx, "ip:10.0.0.1", attempt.LockedUntil))
+	attempt, err = store.GetLoginAttempt(ctx, "ip:10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, attempt.Failures)
+	assert.True(t, attempt.LockedUntil.IsZero())
+
+	assert.NoError(t, store.ResetLoginAttempts(ctx, "ip:10.0.0.1"))
+	attempt, err = store.GetLoginAttempt(ctx, "ip:10.0.0.1")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, attempt.Failures)
+
+	_, err = storage.NewLoginAttemptStorage("redis", nil)
 	assert.Error(t, err)
-	assert.Nil(t, user)
-	assert.True(t, errors.Is(err, storage.ErrUserNotFound))
+}
 
-	mock.ExpectRollback()
-	err = tx.Rollback()
+func TestUpdatePassHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
 	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewUserRepository(db)
+	query := regexp.QuoteMeta("UPDATE users SET pass_hash = $2 WHERE id = $1")
+	mock.ExpectExec(query).WithArgs(int64(1), []byte("$argon2id$hash")).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).WithArgs(int64(2), []byte("$argon2id$hash")).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, repo.UpdatePassHash(context.Background(), 1, []byte("$argon2id$hash")))
+	assert.ErrorIs(t, repo.UpdatePassHash(context.Background(), 2, []byte("$argon2id$hash")), storage.ErrUserNotFound)
+
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestUseTwoFactorStep(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewTwoFactorRepository(db)
+	query := regexp.QuoteMeta("UPDATE user_totp SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2")
+	mock.ExpectExec(query).WithArgs(int64(5), int64(100)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(query).WithArgs(int64(5), int64(100)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	ok, err := repo.UseTwoFactorStep(context.Background(), 5, 100)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	// Повторное использование того же шага отклоняется
+	ok, err = repo.UseTwoFactorStep(context.Background(), 5, 100)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestSetTwoFactorRequired(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewTwoFactorRepository(db)
+	mock.ExpectExec(regexp.QuoteMeta("INSERT INTO role_two_factor_requirements (role, updated_by, updated_at)")).
+		WithArgs(models.RoleFinance, int64(1)).WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec(regexp.QuoteMeta("DELETE FROM role_two_factor_requirements WHERE role = $1")).
+		WithArgs(models.RoleFinance).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	assert.NoError(t, repo.SetTwoFactorRequired(context.Background(), models.RoleFinance, true, 1))
+	assert.NoError(t, repo.SetTwoFactorRequired(context.Background(), models.RoleFinance, false, 1))
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetPersonalTokenByHash(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewPersonalTokenRepository(db)
+	now := time.Now()
+	query := regexp.QuoteMeta("FROM personal_tokens t JOIN users u ON u.id = t.user_id WHERE t.token_hash = $1 AND t.revoked_at IS NULL")
+	mock.ExpectQuery(query).WithArgs([]byte("hash")).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "scopes", "created_at", "expires_at", "last_used_at"}).
+			AddRow(1, 2, "kudos bot", "{coins:send,info:read}", now, nil, now))
+	mock.ExpectQuery(query).WithArgs([]byte("other")).WillReturnError(sql.ErrNoRows)
+
+	token, err := repo.GetPersonalTokenByHash(context.Background(), []byte("hash"))
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Scope{models.ScopeCoinsSend, models.ScopeInfoRead}, token.Scopes)
+	assert.Nil(t, token.ExpiresAt)
+	assert.NotNil(t, token.LastUsedAt)
+
+	_, err = repo.GetPersonalTokenByHash(context.Background(), []byte("other"))
+	assert.ErrorIs(t, err, storage.ErrPersonalTokenNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestRevokePersonalToken_OtherUser(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewPersonalTokenRepository(db)
+	mock.ExpectExec(regexp.QuoteMeta("UPDATE personal_tokens SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL")).
+		WithArgs(int64(1), int64(3)).WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.ErrorIs(t, repo.RevokePersonalToken(context.Background(), 3, 1), storage.ErrPersonalTokenNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestGetIdentityUserID(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewIdentityRepository(db)
+	query := regexp.QuoteMeta("SELECT user_id FROM user_identities WHERE provider = $1 AND subject = $2")
+	mock.ExpectQuery(query).WithArgs("ldap", "uid-alice").WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(7))
+	mock.ExpectQuery(query).WithArgs("oidc", "sub-bob").WillReturnError(sql.ErrNoRows)
+
+	userID, err := repo.GetIdentityUserID(context.Background(), "ldap", "uid-alice")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(7), userID)
+	_, err = repo.GetIdentityUserID(context.Background(), "oidc", "sub-bob")
+	assert.ErrorIs(t, err, storage.ErrIdentityNotFound)
+	assert.NoError(t, mock.ExpectationsWereMet())
+}
+
+func TestLinkIdentity_KeepsExistingLink(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	assert.NoError(t, err)
+	defer db.Close()
+
+	repo := storage.NewIdentityRepository(db)
+	mock.ExpectExec(regexp.QuoteMeta("ON CONFLICT (provider, subject) DO NOTHING")).
+		WithArgs("ldap", "uid-alice", int64(7)).WillReturnResult(sqlmock.NewResult(0, 0))
 
+	assert.NoError(t, repo.LinkIdentity(context.Background(), "ldap", "uid-alice", 7))
 	assert.NoError(t, mock.ExpectationsWereMet())
 }
@@ -0,0 +1,81 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+)
+
+// ErrTokenNotFound возвращается, если токена нет, он истёк или уже использован
+var ErrTokenNotFound = errors.New("token not found")
+
+// OneTimeTokenStorage описывает хранение одноразовых токенов (подтверждение email и т.п.).
+type OneTimeTokenStorage interface {
+	// CreateToken сохраняет хэш токена.
+	CreateToken(ctx context.Context, token *models.OneTimeToken) error
+	// ConsumeToken помечает действующий токен использованным и возвращает ID пользователя.
+	ConsumeToken(ctx context.Context, purpose string, tokenHash []byte) (int64, error)
+	// PeekToken возвращает ID владельца действующего токена, не помечая токен использованным.
+	PeekToken(ctx context.Context, purpose string, tokenHash []byte) (int64, error)
+	// RevokeTokens помечает использованными все действующие токены пользователя с этим назначением.
+	RevokeTokens(ctx context.Context, userID int64, purpose string) error
+}
+
+type oneTimeTokenRepository struct {
+	db *sql.DB
+}
+
+// NewOneTimeTokenRepository создаёт новый репозиторий одноразовых токенов.
+func NewOneTimeTokenRepository(db *sql.DB) OneTimeTokenStorage {
+	return &oneTimeTokenRepository{db: db}
+}
+
+func (r *oneTimeTokenRepository) CreateToken(ctx context.Context, token *models.OneTimeToken) error {
+	query := `INSERT INTO one_time_tokens (token_hash, user_id, purpose, expires_at, created_at)
+	          VALUES ($1, $2, $3, $4, NOW())`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, token.TokenHash, token.UserID, token.Purpose, token.ExpiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+	return nil
+}
+
+// ConsumeToken атомарно помечает токен использованным, поэтому повторное и параллельное
+// использование одного токена невозможно
+func (r *oneTimeTokenRepository) ConsumeToken(ctx context.Context, purpose string, tokenHash []byte) (int64, error) {
+	query := `
+		UPDATE one_time_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id`
+	var userID int64
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, tokenHash, purpose).Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrTokenNotFound
+		}
+		return 0, fmt.Errorf("failed to consume token: %w", err)
+	}
+	return userID, nil
+}
+
+func (r *oneTimeTokenRepository) RevokeTokens(ctx context.Context, userID int64, purpose string) error {
+	query := "UPDATE one_time_tokens SET used_at = NOW() WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL"
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, userID, purpose); err != nil {
+		return fmt.Errorf("failed to revoke tokens: %w", err)
+	}
+	return nil
+}
+
+func (r *oneTimeTokenRepository) PeekToken(ctx context.Context, purpose string, tokenHash []byte) (int64, error) {
+	query := "SELECT user_id FROM one_time_tokens WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()"
+	var userID int64
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, tokenHash, purpose).Scan(&userID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrTokenNotFound
+		}
+		return 0, fmt.Errorf("failed to get token: %w", err)
+	}
+	return userID, nil
+}
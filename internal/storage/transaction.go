@@ -4,13 +4,16 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+
 	"github.com/linemk/avito-shop/internal/domain/models"
 )
 
 // CoinTransactionStorage описывает методы для работы с транзакциями.
 type CoinTransactionStorage interface {
 	// CreateTransaction создает запись о транзакции.
-	CreateTransaction(ctx context.Context, tx *sql.Tx, userID int64, amount int, txType string, relatedUserID *int64) error
+	CreateTransaction(ctx context.Context, userID int64, amount int, txType string, relatedUserID *int64) error
+	// CreatePurchaseTransaction записывает списание монет за заказ.
+	CreatePurchaseTransaction(ctx context.Context, userID int64, amount int, orderID int64) error
 	// GetTransactionsByUserID возвращает список транзакций для указанного пользователя.
 	GetTransactionsByUserID(ctx context.Context, userID int64) ([]*models.CoinTransaction, error)
 }
@@ -23,23 +26,37 @@ func NewCoinTransactionRepository(db *sql.DB) CoinTransactionStorage {
 	return &coinTransactionRepository{db: db}
 }
 
-func (r *coinTransactionRepository) CreateTransaction(ctx context.Context, tx *sql.Tx, userID int64, amount int, txType string, relatedUserID *int64) error {
+func (r *coinTransactionRepository) CreateTransaction(ctx context.Context, userID int64, amount int, txType string, relatedUserID *int64) error {
 	query := `INSERT INTO coin_transactions (user_id, amount, type, related_user_id, created_at)
 	          VALUES ($1, $2, $3, $4, NOW())`
-	_, err := tx.ExecContext(ctx, query, userID, amount, txType, relatedUserID)
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID, amount, txType, relatedUserID)
 	if err != nil {
 		return fmt.Errorf("failed to create coin transaction: %w", err)
 	}
 	return nil
 }
 
+func (r *coinTransactionRepository) CreatePurchaseTransaction(ctx context.Context, userID int64, amount int, orderID int64) error {
+	query := `INSERT INTO coin_transactions (user_id, amount, type, order_id, created_at)
+	          VALUES ($1, $2, $3, $4, NOW())`
+	_, err := conn(ctx, r.db).ExecContext(ctx, query, userID, amount, models.CoinTxPurchase, orderID)
+	if err != nil {
+		return fmt.Errorf("failed to create purchase transaction: %w", err)
+	}
+	return nil
+}
+
+// GetTransactionsByUserID возвращает операции от новых к старым; для покупок заполняется имя товара
 func (r *coinTransactionRepository) GetTransactionsByUserID(ctx context.Context, userID int64) ([]*models.CoinTransaction, error) {
 	query := `
-		SELECT id, user_id, amount, type, related_user_id, created_at
-		FROM coin_transactions
-		WHERE user_id = $1
-		ORDER BY created_at DESC`
-	rows, err := r.db.QueryContext(ctx, query, userID)
+		SELECT ct.id, ct.user_id, ct.amount, ct.type, ct.related_user_id, ct.order_id,
+			COALESCE(m.name, ''), ct.created_at
+		FROM coin_transactions ct
+		LEFT JOIN orders o ON o.id = ct.order_id
+		LEFT JOIN merch m ON m.id = o.merch_id
+		WHERE ct.user_id = $1
+		ORDER BY ct.created_at DESC, ct.id DESC`
+	rows, err := conn(ctx, r.db).QueryContext(ctx, query, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query coin transactions: %w", err)
 	}
@@ -48,7 +65,7 @@ func (r *coinTransactionRepository) GetTransactionsByUserID(ctx context.Context,
 	var transactions []*models.CoinTransaction
 	for rows.Next() {
 		tx := &models.CoinTransaction{}
-		if err := rows.Scan(&tx.ID, &tx.UserID, &tx.Amount, &tx.Type, &tx.RelatedUserID, &tx.CreatedAt); err != nil {
+		if err := rows.Scan(&tx.ID, &tx.UserID, &tx.Amount, &tx.Type, &tx.RelatedUserID, &tx.OrderID, &tx.MerchName, &tx.CreatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan coin transaction: %w", err)
 		}
 		transactions = append(transactions, tx)
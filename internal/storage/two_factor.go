@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/linemk/avito-shop/internal/domain/models"
+)
+
+// ErrTwoFactorNotFound возвращается, если пользователь не начинал подключение второго фактора
+var ErrTwoFactorNotFound = errors.New("two-factor secret not found")
+
+// TwoFactorStorage хранит секреты TOTP, коды восстановления и роли с обязательным вторым фактором.
+type TwoFactorStorage interface {
+	// GetTwoFactor возвращает секрет пользователя или ErrTwoFactorNotFound.
+	GetTwoFactor(ctx context.Context, userID int64) (*models.TwoFactor, error)
+	// SaveTwoFactorSecret начинает подключение заново с новым секретом.
+	// Подтверждённый секрет не перезаписывается.
+	SaveTwoFactorSecret(ctx context.Context, userID int64, secret []byte) error
+	// ConfirmTwoFactor завершает подключение; step — шаг TOTP кода подтверждения.
+	ConfirmTwoFactor(ctx context.Context, userID int64, step int64) error
+	// UseTwoFactorStep атомарно запоминает принятый шаг TOTP. Возвращает false,
+	// если этот или более поздний шаг уже использован.
+	UseTwoFactorStep(ctx context.Context, userID int64, step int64) (bool, error)
+	// DeleteTwoFactor отключает второй фактор и удаляет коды восстановления.
+	DeleteTwoFactor(ctx context.Context, userID int64) error
+	// ReplaceRecoveryCodes заменяет коды восстановления пользователя новыми.
+	ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes [][]byte) error
+	// UseRecoveryCode атомарно помечает неиспользованный код использованным; false — кода нет.
+	UseRecoveryCode(ctx context.Context, userID int64, codeHash []byte) (bool, error)
+	// IsTwoFactorRequired сообщает, обязателен ли второй фактор для роли.
+	IsTwoFactorRequired(ctx context.Context, role models.Role) (bool, error)
+	// SetTwoFactorRequired включает или выключает обязательный второй фактор для роли.
+	SetTwoFactorRequired(ctx context.Context, role models.Role, required bool, updatedBy int64) error
+	// ListTwoFactorRequiredRoles возвращает роли, для которых второй фактор обязателен.
+	ListTwoFactorRequiredRoles(ctx context.Context) ([]models.Role, error)
+}
+
+type twoFactorRepository struct {
+	db *sql.DB
+}
+
+// NewTwoFactorRepository создаёт новый репозиторий второго фактора.
+func NewTwoFactorRepository(db *sql.DB) TwoFactorStorage {
+	return &twoFactorRepository{db: db}
+}
+
+func (r *twoFactorRepository) GetTwoFactor(ctx context.Context, userID int64) (*models.TwoFactor, error) {
+	query := "SELECT user_id, secret, confirmed_at, last_used_step FROM user_totp WHERE user_id = $1"
+	tf := &models.TwoFactor{}
+	var confirmedAt sql.NullTime
+	err := conn(ctx, r.db).QueryRowContext(ctx, query, userID).Scan(&tf.UserID, &tf.Secret, &confirmedAt, &tf.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrTwoFactorNotFound
+		}
+		return nil, fmt.Errorf("failed to get two-factor secret: %w", err)
+	}
+	if confirmedAt.Valid {
+		tf.ConfirmedAt = &confirmedAt.Time
+	}
+	return tf, nil
+}
+
+func (r *twoFactorRepository) SaveTwoFactorSecret(ctx context.Context, userID int64, secret []byte) error {
+	query := `
+		INSERT INTO user_totp (user_id, secret, created_at) VALUES ($1, $2, NOW())
+		ON CONFLICT (user_id) DO UPDATE SET secret = EXCLUDED.secret, last_used_step = 0, created_at = NOW()
+		WHERE user_totp.confirmed_at IS NULL`
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, userID, secret); err != nil {
+		return fmt.Errorf("failed to save two-factor secret: %w", err)
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) ConfirmTwoFactor(ctx context.Context, userID int64, step int64) error {
+	query := "UPDATE user_totp SET confirmed_at = NOW(), last_used_step = $2 WHERE user_id = $1 AND confirmed_at IS NULL"
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return fmt.Errorf("failed to confirm two-factor secret: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrTwoFactorNotFound
+	}
+	return nil
+}
+
+// UseTwoFactorStep сравнивает и обновляет шаг одним запросом, поэтому один и тот же код,
+// отправленный параллельно, принимается только один раз
+func (r *twoFactorRepository) UseTwoFactorStep(ctx context.Context, userID int64, step int64) (bool, error) {
+	query := "UPDATE user_totp SET last_used_step = $2 WHERE user_id = $1 AND last_used_step < $2"
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, userID, step)
+	if err != nil {
+		return false, fmt.Errorf("failed to use two-factor step: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *twoFactorRepository) DeleteTwoFactor(ctx context.Context, userID int64) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	if _, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM user_totp WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("failed to delete two-factor secret: %w", err)
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes выполняет несколько запросов; вызывать внутри транзакции
+func (r *twoFactorRepository) ReplaceRecoveryCodes(ctx context.Context, userID int64, codeHashes [][]byte) error {
+	if _, err := conn(ctx, r.db).ExecContext(ctx, "DELETE FROM recovery_codes WHERE user_id = $1", userID); err != nil {
+		return fmt.Errorf("failed to delete recovery codes: %w", err)
+	}
+	for _, hash := range codeHashes {
+		if _, err := conn(ctx, r.db).ExecContext(ctx, "INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)", userID, hash); err != nil {
+			return fmt.Errorf("failed to save recovery code: %w", err)
+		}
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) UseRecoveryCode(ctx context.Context, userID int64, codeHash []byte) (bool, error) {
+	query := "UPDATE recovery_codes SET used_at = NOW() WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL"
+	res, err := conn(ctx, r.db).ExecContext(ctx, query, userID, codeHash)
+	if err != nil {
+		return false, fmt.Errorf("failed to use recovery code: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+	return n > 0, nil
+}
+
+func (r *twoFactorRepository) IsTwoFactorRequired(ctx context.Context, role models.Role) (bool, error) {
+	query := "SELECT EXISTS (SELECT 1 FROM role_two_factor_requirements WHERE role = $1)"
+	var required bool
+	if err := conn(ctx, r.db).QueryRowContext(ctx, query, role).Scan(&required); err != nil {
+		return false, fmt.Errorf("failed to check two-factor requirement: %w", err)
+	}
+	return required, nil
+}
+
+func (r *twoFactorRepository) SetTwoFactorRequired(ctx context.Context, role models.Role, required bool, updatedBy int64) error {
+	query := "DELETE FROM role_two_factor_requirements WHERE role = $1"
+	args := []any{role}
+	if required {
+		query = `INSERT INTO role_two_factor_requirements (role, updated_by, updated_at) VALUES ($1, $2, NOW())
+		         ON CONFLICT (role) DO UPDATE SET updated_by = EXCLUDED.updated_by, updated_at = NOW()`
+		args = append(args, updatedBy)
+	}
+	if _, err := conn(ctx, r.db).ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("failed to set two-factor requirement: %w", err)
+	}
+	return nil
+}
+
+func (r *twoFactorRepository) ListTwoFactorRequiredRoles(ctx context.Context) ([]models.Role, error) {
+	rows, err := conn(ctx, r.db).QueryContext(ctx, "SELECT role FROM role_two_factor_requirements ORDER BY role")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list two-factor requirements: %w", err)
+	}
+	defer rows.Close()
+
+	var roles []models.Role
+	for rows.Next() {
+		var role models.Role
+		if err := rows.Scan(&role); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles = append(roles, role)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to list two-factor requirements: %w", err)
+	}
+	return roles, nil
+}
@@ -0,0 +1,151 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SQLSTATE ошибок Postgres, после которых транзакцию безопасно повторить целиком
+const (
+	pgSerializationFailure = "40001"
+	pgDeadlockDetected     = "40P01"
+)
+
+// TxOptions задаёт параметры транзакции.
+type TxOptions struct {
+	// Isolation — уровень изоляции; sql.LevelDefault означает READ COMMITTED в Postgres
+	Isolation sql.IsolationLevel
+	ReadOnly  bool
+}
+
+// RetryPolicy задаёт повтор транзакций при конфликтах сериализации и взаимоблокировках.
+type RetryPolicy struct {
+	MaxRetries  int           // количество повторов после первой попытки
+	BaseBackoff time.Duration // пауза перед первым повтором, дальше удваивается
+	MaxBackoff  time.Duration // верхняя граница паузы
+}
+
+// TxManager выполняет функции в транзакции БД.
+// Транзакция передаётся репозиториям через контекст, поэтому сервисы не работают с *sql.Tx напрямую.
+type TxManager interface {
+	// Do выполняет fn в транзакции с уровнем изоляции по умолчанию.
+	Do(ctx context.Context, fn func(ctx context.Context) error) error
+	// DoWithOptions выполняет fn в транзакции с заданными параметрами.
+	DoWithOptions(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error
+}
+
+type txManager struct {
+	db     *sql.DB
+	policy RetryPolicy
+}
+
+// NewTxManager создаёт менеджер транзакций.
+func NewTxManager(db *sql.DB, policy RetryPolicy) TxManager {
+	return &txManager{db: db, policy: policy}
+}
+
+type txCtxKey struct{}
+
+// querier — общий набор методов *sql.DB и *sql.Tx, которым пользуются репозитории
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// conn возвращает транзакцию из контекста, а если её нет — пул соединений db
+func conn(ctx context.Context, db *sql.DB) querier {
+	if tx, ok := ctx.Value(txCtxKey{}).(*sql.Tx); ok {
+		return tx
+	}
+	return db
+}
+
+// InTransaction сообщает, выполняется ли код внутри транзакции TxManager
+func InTransaction(ctx context.Context) bool {
+	_, ok := ctx.Value(txCtxKey{}).(*sql.Tx)
+	return ok
+}
+
+func (m *txManager) Do(ctx context.Context, fn func(ctx context.Context) error) error {
+	return m.DoWithOptions(ctx, TxOptions{}, fn)
+}
+
+// DoWithOptions выполняет fn в транзакции: коммитит при успехе и откатывает при ошибке или панике.
+// Если контекст уже содержит транзакцию, fn выполняется в ней (вложенные вызовы не создают новую).
+// При ошибках сериализации и взаимоблокировках транзакция повторяется с экспоненциальной паузой.
+func (m *txManager) DoWithOptions(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error {
+	if _, ok := ctx.Value(txCtxKey{}).(*sql.Tx); ok {
+		return fn(ctx)
+	}
+
+	var err error
+	for attempt := 0; ; attempt++ {
+		err = m.runOnce(ctx, opts, fn)
+		if err == nil || !isRetryable(err) || attempt >= m.policy.MaxRetries {
+			return err
+		}
+
+		timer := time.NewTimer(m.backoff(attempt))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return errors.Join(err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
+
+func (m *txManager) runOnce(ctx context.Context, opts TxOptions, fn func(ctx context.Context) error) error {
+	tx, err := m.db.BeginTx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	defer func() {
+		if p := recover(); p != nil {
+			_ = tx.Rollback()
+			panic(p)
+		}
+	}()
+
+	if err := fn(context.WithValue(ctx, txCtxKey{}, tx)); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return errors.Join(err, fmt.Errorf("transaction rollback failed: %w", rbErr))
+		}
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit transaction: %w", err)
+	}
+	return nil
+}
+
+// backoff возвращает паузу перед повтором: BaseBackoff * 2^attempt со случайным разбросом
+func (m *txManager) backoff(attempt int) time.Duration {
+	d := m.policy.BaseBackoff << attempt
+	if m.policy.MaxBackoff > 0 && d > m.policy.MaxBackoff {
+		d = m.policy.MaxBackoff
+	}
+	if d <= 0 {
+		return 0
+	}
+	// разброс ±50%, чтобы повторы конкурирующих транзакций не совпадали по времени
+	return d/2 + time.Duration(rand.Int63n(int64(d))) // #nosec G404 -- джиттер не требует криптостойкости
+}
+
+// isRetryable сообщает, является ли ошибка конфликтом сериализации или взаимоблокировкой
+func isRetryable(err error) bool {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == pgSerializationFailure || pqErr.Code == pgDeadlockDetected
+	}
+	return false
+}
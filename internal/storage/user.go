@@ -4,20 +4,38 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 
+	"github.com/lib/pq"
 	"github.com/linemk/avito-shop/internal/domain/models"
 )
 
-var ErrUserNotFound = errors.New("user not found")
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUserExists   = errors.New("user already exists")
+)
+
+// pgUniqueViolation — SQLSTATE нарушения уникального ограничения
+const pgUniqueViolation = "23505"
 
+// userColumns — столбцы users в порядке, который ожидает scanUser
+const userColumns = "id, username, pass_hash, coin_balance, email_verified_at IS NOT NULL, role"
+
+// UserStorage описывает методы для работы с пользователями.
+// Если в контексте есть транзакция TxManager, запросы выполняются в ней.
+// Баланс coin_balance меняется только через LedgerStorage.PostEntry.
 type UserStorage interface {
 	// Получить пользователя по email
 	GetUserByEmail(ctx context.Context, email string) (*models.User, error)
 	// Создать нового пользователя
 	CreateUser(ctx context.Context, user *models.User) (*models.User, error)
 	GetUserByID(ctx context.Context, id int64) (*models.User, error)
-	GetUserByIDtx(ctx context.Context, tx *sql.Tx, id int64) (*models.User, error)
-	UpdateUserBalance(ctx context.Context, tx *sql.Tx, id int64, newBalance int) error
+	// GetUserByIDForUpdate читает пользователя и блокирует строку до конца транзакции
+	GetUserByIDForUpdate(ctx context.Context, id int64) (*models.User, error)
+	// MarkEmailVerified отмечает email подтверждённым; false, если он уже был подтверждён
+	MarkEmailVerified(ctx context.Context, id int64) (bool, error)
+	// UpdatePassHash заменяет хэш пароля
+	UpdatePassHash(ctx context.Context, id int64, passHash []byte) error
 }
 
 type userRepository struct {
@@ -30,9 +48,9 @@ func NewUserRepository(db *sql.DB) *userRepository {
 
 // получение уже существующего пользователя
 func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*models.User, error) {
-	user := &models.User{}
-	row := r.db.QueryRowContext(ctx, "SELECT id, username, pass_hash, coin_balance FROM users WHERE username = $1", email)
-	if err := row.Scan(&user.ID, &user.Email, &user.PassHash, &user.CoinBalance); err != nil {
+	row := conn(ctx, r.db).QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE username = $1", email)
+	user, err := scanUser(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
 		}
@@ -43,36 +61,41 @@ func (r *userRepository) GetUserByEmail(ctx context.Context, email string) (*mod
 
 func (r *userRepository) CreateUser(ctx context.Context, user *models.User) (*models.User, error) {
 	var id int64
-	err := r.db.QueryRowContext(ctx,
+	err := conn(ctx, r.db).QueryRowContext(ctx,
 		"INSERT INTO users (username, pass_hash, coin_balance) VALUES ($1, $2, $3) RETURNING id",
 		user.Email, user.PassHash, user.CoinBalance,
 	).Scan(&id)
 	if err != nil {
+		var pqErr *pq.Error
+		if errors.As(err, &pqErr) && pqErr.Code == pgUniqueViolation {
+			return nil, ErrUserExists
+		}
 		return nil, err
 	}
 	user.ID = id
 	return user, nil
 }
 
-func (r *userRepository) UpdateUserBalance(ctx context.Context, tx *sql.Tx, id int64, newBalance int) error {
-	res, err := tx.ExecContext(ctx, "UPDATE users SET coin_balance = $1 WHERE id = $2", newBalance, id)
+func (r *userRepository) MarkEmailVerified(ctx context.Context, id int64) (bool, error) {
+	res, err := conn(ctx, r.db).ExecContext(ctx,
+		"UPDATE users SET email_verified_at = NOW() WHERE id = $1 AND email_verified_at IS NULL", id)
 	if err != nil {
-		return err
+		return false, fmt.Errorf("failed to mark email verified: %w", err)
 	}
-	affected, err := res.RowsAffected()
+	n, err := res.RowsAffected()
 	if err != nil {
-		return err
+		return false, err
 	}
-	if affected == 0 {
-		return ErrUserNotFound
-	}
-	return nil
+	return n == 1, nil
 }
 
-func (r *userRepository) GetUserByIDtx(ctx context.Context, tx *sql.Tx, id int64) (*models.User, error) {
-	user := &models.User{}
-	row := tx.QueryRowContext(ctx, "SELECT id, username, pass_hash, coin_balance FROM users WHERE id = $1", id)
-	if err := row.Scan(&user.ID, &user.Email, &user.PassHash, &user.CoinBalance); err != nil {
+// GetUserByIDForUpdate читает пользователя с блокировкой строки (SELECT ... FOR UPDATE).
+// Параллельные транзакции, изменяющие баланс того же пользователя, ждут завершения текущей,
+// поэтому прочитанный баланс остаётся актуальным до коммита. Вызывать только внутри TxManager.
+func (r *userRepository) GetUserByIDForUpdate(ctx context.Context, id int64) (*models.User, error) {
+	row := conn(ctx, r.db).QueryRowContext(ctx, "SELECT "+userColumns+" FROM users WHERE id = $1 FOR UPDATE", id)
+	user, err := scanUser(row)
+	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrUserNotFound
 		}
@@ -80,3 +103,26 @@ func (r *userRepository) GetUserByIDtx(ctx context.Context, tx *sql.Tx, id int64
 	}
 	return user, nil
 }
+
+func scanUser(row rowScanner) (*models.User, error) {
+	user := &models.User{}
+	if err := row.Scan(&user.ID, &user.Email, &user.PassHash, &user.CoinBalance, &user.EmailVerified, &user.Role); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+func (r *userRepository) UpdatePassHash(ctx context.Context, id int64, passHash []byte) error {
+	res, err := conn(ctx, r.db).ExecContext(ctx, "UPDATE users SET pass_hash = $2 WHERE id = $1", id, passHash)
+	if err != nil {
+		return fmt.Errorf("failed to update password hash: %w", err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to update password hash: %w", err)
+	}
+	if n == 0 {
+		return ErrUserNotFound
+	}
+	return nil
+}
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS role_two_factor_requirements;
+DROP TABLE IF EXISTS recovery_codes;
+DROP TABLE IF EXISTS user_totp;
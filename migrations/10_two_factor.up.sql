@@ -0,0 +1,24 @@
+-- Второй фактор (TOTP). Запись без confirmed_at — начатое, но не подтверждённое подключение.
+CREATE TABLE IF NOT EXISTS user_totp (
+    user_id INTEGER PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    secret BYTEA NOT NULL,
+    confirmed_at TIMESTAMP WITH TIME ZONE,
+    last_used_step BIGINT NOT NULL DEFAULT 0,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Одноразовые коды восстановления; хранятся только их хэши
+CREATE TABLE IF NOT EXISTS recovery_codes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    code_hash BYTEA NOT NULL,
+    used_at TIMESTAMP WITH TIME ZONE,
+    UNIQUE (user_id, code_hash)
+);
+
+-- Роли, для которых второй фактор обязателен
+CREATE TABLE IF NOT EXISTS role_two_factor_requirements (
+    role TEXT PRIMARY KEY CHECK (role IN ('employee', 'merch-manager', 'finance', 'admin')),
+    updated_by INTEGER NOT NULL REFERENCES users(id),
+    updated_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
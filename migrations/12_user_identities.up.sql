@@ -0,0 +1,11 @@
+-- Учётные записи внешних провайдеров (LDAP, OIDC), связанные с пользователями магазина.
+-- subject — неизменяемый идентификатор у провайдера, поэтому смена email в каталоге не создаёт нового пользователя
+CREATE TABLE IF NOT EXISTS user_identities (
+    provider TEXT NOT NULL,
+    subject TEXT NOT NULL,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (provider, subject)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_identities_user_id ON user_identities (user_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_merch_category;
+ALTER TABLE merch DROP COLUMN IF EXISTS category;
+ALTER TABLE merch DROP COLUMN IF EXISTS description;
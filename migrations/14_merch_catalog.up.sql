@@ -0,0 +1,20 @@
+-- Описание и категория товара для каталога /api/merch
+ALTER TABLE merch ADD COLUMN IF NOT EXISTS description TEXT NOT NULL DEFAULT '';
+ALTER TABLE merch ADD COLUMN IF NOT EXISTS category TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_merch_category ON merch (category);
+
+UPDATE merch AS m SET description = v.description, category = v.category
+FROM (VALUES
+    ('t-shirt', 'Футболка с логотипом', 'clothing'),
+    ('cup', 'Кружка', 'accessories'),
+    ('book', 'Блокнот', 'stationery'),
+    ('pen', 'Ручка', 'stationery'),
+    ('powerbank', 'Внешний аккумулятор', 'electronics'),
+    ('hoody', 'Худи', 'clothing'),
+    ('umbrella', 'Зонт', 'accessories'),
+    ('socks', 'Носки', 'clothing'),
+    ('wallet', 'Кошелёк', 'accessories'),
+    ('pink-hoody', 'Розовое худи', 'clothing')
+) AS v (name, description, category)
+WHERE m.name = v.name;
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS merch_price_history;
+ALTER TABLE merch DROP COLUMN IF EXISTS archived_at;
@@ -0,0 +1,18 @@
+-- Архивный товар скрыт из каталога и не продаётся, но остаётся в существующих заказах
+ALTER TABLE merch ADD COLUMN IF NOT EXISTS archived_at TIMESTAMP WITH TIME ZONE;
+
+-- История цен: цена действует с valid_from до valid_from следующей записи того же товара.
+-- По ней сверка проверяет сумму заказа по цене на момент покупки
+CREATE TABLE IF NOT EXISTS merch_price_history (
+    id BIGSERIAL PRIMARY KEY,
+    merch_id INTEGER NOT NULL REFERENCES merch(id),
+    price INTEGER NOT NULL CHECK (price > 0),
+    valid_from TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    changed_by INTEGER REFERENCES users(id) -- NULL — цена задана миграцией
+);
+
+CREATE INDEX IF NOT EXISTS idx_merch_price_history_merch_id ON merch_price_history (merch_id, valid_from);
+
+-- До этой миграции цены не менялись, поэтому текущая цена действует с самого начала
+INSERT INTO merch_price_history (merch_id, price, valid_from)
+SELECT id, price, TIMESTAMP WITH TIME ZONE 'epoch' FROM merch;
@@ -0,0 +1,3 @@
+-- Остаток на складе. NULL — остаток не учитывается и товар не заканчивается (поведение до этой миграции);
+-- учёт включается первым пополнением через /api/admin/merch/{name}/restock
+ALTER TABLE merch ADD COLUMN IF NOT EXISTS stock INTEGER CHECK (stock >= 0);
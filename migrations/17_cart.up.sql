@@ -0,0 +1,9 @@
+-- Корзина сотрудника: одна строка на товар, количество копится при повторном добавлении.
+-- Строки удаляются при оформлении заказа в той же транзакции, что и списание монет
+CREATE TABLE IF NOT EXISTS cart_items (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    merch_id INTEGER NOT NULL REFERENCES merch(id),
+    quantity INTEGER NOT NULL CHECK (quantity > 0),
+    added_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, merch_id)
+);
@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    request_hash TEXT NOT NULL,        -- sha256 от метода, пути и тела запроса
+    response_status INTEGER NOT NULL,  -- HTTP-статус сохранённого ответа
+    response_body BYTEA NOT NULL,      -- тело сохранённого ответа, отдаётся при повторе запроса
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (user_id, key)
+);
@@ -0,0 +1,6 @@
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_coin_balance_non_negative;
+ALTER TABLE users ALTER COLUMN coin_balance SET DEFAULT 1000;
+DROP TABLE IF EXISTS ledger_postings;
+DROP FUNCTION IF EXISTS ledger_check_entry_balanced();
+DROP TABLE IF EXISTS ledger_entries;
+DROP TABLE IF EXISTS ledger_accounts;
@@ -0,0 +1,79 @@
+-- Двойная запись: каждое движение монет — сбалансированный набор проводок между счетами.
+-- users.coin_balance остаётся кэшем суммы проводок по кошельку пользователя.
+
+CREATE TABLE IF NOT EXISTS ledger_accounts (
+    id SERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,                                           -- 'user_wallet', 'company_issuance', 'shop_revenue'
+    user_id INTEGER UNIQUE REFERENCES users(id) ON DELETE CASCADE, -- заполняется только для кошельков
+    code TEXT UNIQUE,                                             -- код системного счёта
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    CHECK ((kind = 'user_wallet') = (user_id IS NOT NULL)),
+    CHECK ((kind = 'user_wallet') = (code IS NULL))
+);
+
+INSERT INTO ledger_accounts (kind, code) VALUES
+    ('company_issuance', 'company_issuance'), -- эмиссия: отсюда приходят все монеты (баланс отрицательный)
+    ('shop_revenue', 'shop_revenue')          -- выручка магазина от покупок мерча
+ON CONFLICT DO NOTHING;
+
+CREATE TABLE IF NOT EXISTS ledger_entries (
+    id SERIAL PRIMARY KEY,
+    kind TEXT NOT NULL,  -- 'signup_grant', 'transfer', 'purchase', 'admin_grant', 'adjustment', 'opening_balance'
+    reference TEXT,      -- ссылка на бизнес-объект, например 'order:42'
+    reason TEXT,         -- пояснение для аудита
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS ledger_postings (
+    id SERIAL PRIMARY KEY,
+    entry_id INTEGER NOT NULL REFERENCES ledger_entries(id) ON DELETE CASCADE,
+    account_id INTEGER NOT NULL REFERENCES ledger_accounts(id),
+    amount INTEGER NOT NULL CHECK (amount <> 0) -- положительная сумма увеличивает баланс счёта
+);
+
+CREATE INDEX IF NOT EXISTS idx_ledger_postings_entry_id ON ledger_postings (entry_id);
+CREATE INDEX IF NOT EXISTS idx_ledger_postings_account_id ON ledger_postings (account_id);
+
+-- Сумма проводок каждой записи должна быть равна нулю; проверяется при коммите транзакции
+CREATE OR REPLACE FUNCTION ledger_check_entry_balanced() RETURNS trigger AS $$
+BEGIN
+    IF (SELECT COALESCE(SUM(amount), 0) FROM ledger_postings WHERE entry_id = NEW.entry_id) <> 0 THEN
+        RAISE EXCEPTION 'ledger entry % is not balanced', NEW.entry_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS ledger_postings_balanced ON ledger_postings;
+CREATE CONSTRAINT TRIGGER ledger_postings_balanced
+    AFTER INSERT OR UPDATE ON ledger_postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION ledger_check_entry_balanced();
+
+-- Баланс теперь появляется только через проводки
+ALTER TABLE users ALTER COLUMN coin_balance SET DEFAULT 0;
+ALTER TABLE users ADD CONSTRAINT users_coin_balance_non_negative CHECK (coin_balance >= 0);
+
+-- Кошельки для существующих пользователей
+INSERT INTO ledger_accounts (kind, user_id)
+SELECT 'user_wallet', id FROM users
+ON CONFLICT DO NOTHING;
+
+-- Входящие остатки: историю до появления журнала восстановить нельзя,
+-- поэтому текущий баланс каждого пользователя фиксируется одной записью из эмиссии
+WITH entries AS (
+    INSERT INTO ledger_entries (kind, reference, reason)
+    SELECT 'opening_balance', 'user:' || id, 'opening balance at ledger introduction'
+    FROM users
+    WHERE coin_balance <> 0
+    RETURNING id, reference
+)
+INSERT INTO ledger_postings (entry_id, account_id, amount)
+SELECT e.id, a.id, u.coin_balance
+FROM entries e
+JOIN users u ON e.reference = 'user:' || u.id
+JOIN ledger_accounts a ON a.user_id = u.id
+UNION ALL
+SELECT e.id, (SELECT id FROM ledger_accounts WHERE code = 'company_issuance'), -u.coin_balance
+FROM entries e
+JOIN users u ON e.reference = 'user:' || u.id;
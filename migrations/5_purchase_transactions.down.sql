@@ -0,0 +1,3 @@
+DELETE FROM coin_transactions WHERE type = 'purchase' AND order_id IS NOT NULL;
+DROP INDEX IF EXISTS idx_coin_tx_order_id;
+ALTER TABLE coin_transactions DROP COLUMN IF EXISTS order_id;
@@ -0,0 +1,11 @@
+-- Покупки записываются в coin_transactions со ссылкой на заказ
+ALTER TABLE coin_transactions ADD COLUMN IF NOT EXISTS order_id INTEGER REFERENCES orders(id) ON DELETE CASCADE;
+
+-- Одна запись о списании на заказ
+CREATE UNIQUE INDEX IF NOT EXISTS idx_coin_tx_order_id ON coin_transactions (order_id) WHERE order_id IS NOT NULL;
+
+-- Заполняем записи для заказов, созданных до миграции
+INSERT INTO coin_transactions (user_id, amount, type, order_id, created_at)
+SELECT o.user_id, o.total_price, 'purchase', o.id, o.created_at
+FROM orders o
+WHERE NOT EXISTS (SELECT 1 FROM coin_transactions ct WHERE ct.order_id = o.id);
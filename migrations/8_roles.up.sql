@@ -0,0 +1,17 @@
+-- Роли пользователей. Первого администратора назначают вручную:
+-- UPDATE users SET role = 'admin' WHERE username = '...';
+ALTER TABLE users ADD COLUMN IF NOT EXISTS role TEXT NOT NULL DEFAULT 'employee'
+    CHECK (role IN ('employee', 'merch-manager', 'finance', 'admin'));
+
+-- Журнал изменения ролей
+CREATE TABLE IF NOT EXISTS role_changes (
+    id BIGSERIAL PRIMARY KEY,
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    old_role TEXT NOT NULL,
+    new_role TEXT NOT NULL,
+    changed_by INTEGER NOT NULL REFERENCES users(id),
+    reason TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_role_changes_user_id ON role_changes (user_id, created_at);
@@ -0,0 +1,10 @@
+-- Неудачные попытки входа для защиты от перебора паролей.
+-- key — "account:<email>" или "ip:<адрес>"; используется при auth.brute_force.store = postgres
+CREATE TABLE IF NOT EXISTS login_attempts (
+    key TEXT PRIMARY KEY,
+    failures INTEGER NOT NULL DEFAULT 0,
+    last_failure_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    locked_until TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_login_attempts_last_failure_at ON login_attempts (last_failure_at);
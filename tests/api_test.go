@@ -129,6 +129,54 @@ func TestBuyItem(t *testing.T) {
 	assert.Equal(t, http.StatusOK, resp.StatusCode)
 }
 
+func TestBuyItemQuantity(t *testing.T) {
+	token := Token
+	jsonBody, _ := json.Marshal(map[string]any{"item": "pen", "quantity": 2})
+	req, err := http.NewRequest("POST", baseURL+"/api/buy", bytes.NewBuffer(jsonBody))
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+}
+
+func TestCartCheckout(t *testing.T) {
+	token := Token
+	client := &http.Client{}
+
+	jsonBody, _ := json.Marshal(map[string]any{"item": "pen", "quantity": 2})
+	req, err := http.NewRequest("POST", baseURL+"/api/cart/items", bytes.NewBuffer(jsonBody))
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	req, err = http.NewRequest("POST", baseURL+"/api/checkout", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusOK, resp.StatusCode)
+
+	// Корзина очищена: повторное оформление отклоняется
+	req, err = http.NewRequest("POST", baseURL+"/api/checkout", nil)
+	assert.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+	resp, err = client.Do(req)
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+}
+
 func TestBuyItemNotFound(t *testing.T) {
 	token := Token
 	item := "nonexistent_item"
@@ -141,5 +189,5 @@ func TestBuyItemNotFound(t *testing.T) {
 	assert.NoError(t, err)
 	defer resp.Body.Close()
 
-	assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	assert.Equal(t, http.StatusNotFound, resp.StatusCode)
 }
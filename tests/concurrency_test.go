@@ -0,0 +1,103 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// InfoCoinsResponse — часть ответа /api/info, нужная для подсчёта баланса
+type InfoCoinsResponse struct {
+	Coins int `json:"coins"`
+}
+
+func authenticate(t *testing.T, username string) string {
+	requestBody := []byte(fmt.Sprintf(`{"username": %q, "password": "testpass"}`, username))
+	resp, err := http.Post(baseURL+"/api/auth", "application/json", bytes.NewBuffer(requestBody))
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var authResp AuthResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&authResp))
+	return authResp.Token
+}
+
+func getCoins(t *testing.T, token string) int {
+	req, err := http.NewRequest("GET", baseURL+"/api/info", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	var info InfoCoinsResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&info))
+	return info.Coins
+}
+
+// TestConcurrentTransfersKeepTotalSupply отправляет сотни параллельных переводов между
+// несколькими пользователями (в том числе встречных) и проверяет, что суммарное
+// количество монет не изменилось: монеты не создаются и не теряются.
+func TestConcurrentTransfersKeepTotalSupply(t *testing.T) {
+	const (
+		usersCount     = 5
+		transfersCount = 300
+	)
+
+	suffix := time.Now().UnixNano()
+	emails := make([]string, usersCount)
+	tokens := make([]string, usersCount)
+	for i := range emails {
+		emails[i] = fmt.Sprintf("concurrent%d_%d@example.com", i, suffix)
+		tokens[i] = authenticate(t, emails[i])
+	}
+
+	totalBefore := 0
+	for _, token := range tokens {
+		totalBefore += getCoins(t, token)
+	}
+
+	var wg sync.WaitGroup
+	client := &http.Client{}
+	for i := 0; i < transfersCount; i++ {
+		from := rand.Intn(usersCount)
+		to := (from + 1 + rand.Intn(usersCount-1)) % usersCount
+
+		wg.Add(1)
+		go func(from, to int) {
+			defer wg.Done()
+			body, _ := json.Marshal(SendCoinRequest{ToUser: emails[to], Amount: 1 + rand.Intn(50)})
+			req, err := http.NewRequest("POST", baseURL+"/api/sendCoin", bytes.NewBuffer(body))
+			if err != nil {
+				return
+			}
+			req.Header.Set("Authorization", "Bearer "+tokens[from])
+			req.Header.Set("Content-Type", "application/json")
+			resp, err := client.Do(req)
+			if err != nil {
+				return
+			}
+			resp.Body.Close()
+		}(from, to)
+	}
+	wg.Wait()
+
+	totalAfter := 0
+	for _, token := range tokens {
+		coins := getCoins(t, token)
+		assert.GreaterOrEqual(t, coins, 0, "Balance must never become negative")
+		totalAfter += coins
+	}
+	assert.Equal(t, totalBefore, totalAfter, "Total coin supply must stay the same")
+}